@@ -0,0 +1,79 @@
+// Package agreement renders the loan agreement of a booking as a PDF document, the written
+// agreement between the lender and the borrower of a tool some insurers ask the lenders for.
+package agreement
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultAppName is the name of the app in the agreements without one.
+const DefaultAppName = "Emprius"
+
+//go:embed templates/agreement.txt
+var agreementText string
+
+// agreementTemplate is the text of the agreements. The lines starting with # and ## are the
+// title and the section headings.
+var agreementTemplate = template.Must(template.New("agreement").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.Format("2 January 2006") },
+}).Parse(agreementText))
+
+// Agreement is the loan of a tool agreed by an accepted booking.
+type Agreement struct {
+	// AppName is the name of the app, DefaultAppName if empty.
+	AppName string
+	// Reference identifies the booking.
+	Reference string
+	Lender    Party
+	Borrower  Party
+	// Community is set if the lender lends a shared tool of the community.
+	Community string
+	Tool      Tool
+	StartDate time.Time
+	EndDate   time.Time
+	// Price is the tokens the booking costs, 0 if free.
+	Price uint64
+	// Payment describes the payment of the price in money, if any (i.e. "15.00 EUR, paid").
+	Payment            string
+	CancellationPolicy string
+	// Terms are the usage terms of the tool accepted by the borrower, if it had any.
+	Terms    *Terms
+	IssuedAt time.Time
+}
+
+// Party is the lender or the borrower of a tool.
+type Party struct {
+	Name  string
+	Email string
+}
+
+// Tool is the lent tool.
+type Tool struct {
+	Title          string
+	SerialNumber   string
+	AssetTag       string
+	EstimatedValue uint64
+}
+
+// Terms are the usage terms accepted by the borrower.
+type Terms struct {
+	Text       string
+	Version    int
+	AcceptedAt time.Time
+}
+
+// PDF renders the agreement as a PDF document.
+func (a *Agreement) PDF() ([]byte, error) {
+	if a.AppName == "" {
+		a.AppName = DefaultAppName
+	}
+	var text strings.Builder
+	if err := agreementTemplate.Execute(&text, a); err != nil {
+		return nil, fmt.Errorf("could not render agreement: %w", err)
+	}
+	return renderPDF("Loan agreement "+a.Reference, "Booking "+a.Reference, text.String()), nil
+}
@@ -0,0 +1,114 @@
+package agreement
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestAgreementPDF(t *testing.T) {
+	c := qt.New(t)
+
+	agreement := &Agreement{
+		Reference: "66f1c2d3e4f5a6b7c8d9e0f1",
+		Lender:    Party{Name: "Lender (owner)", Email: "lender@example.com"},
+		Borrower:  Party{Name: "José", Email: "borrower@example.com"},
+		Community: "testCommunity",
+		Tool: Tool{
+			Title:          "Cement mixer",
+			SerialNumber:   "SN-123",
+			EstimatedValue: 300,
+		},
+		StartDate:          time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:            time.Date(2026, 5, 3, 0, 0, 0, 0, time.UTC),
+		Price:              20,
+		Payment:            "15.00 EUR, paid",
+		CancellationPolicy: "flexible",
+		Terms:              &Terms{Text: "Clean it after use.", Version: 2, AcceptedAt: time.Date(2026, 4, 20, 0, 0, 0, 0, time.UTC)},
+		IssuedAt:           time.Date(2026, 4, 21, 0, 0, 0, 0, time.UTC),
+	}
+	data, err := agreement.PDF()
+	c.Assert(err, qt.IsNil)
+	c.Assert(agreement.AppName, qt.Equals, DefaultAppName)
+
+	content := string(data)
+	c.Assert(strings.HasPrefix(content, "%PDF-1.4\n"), qt.IsTrue)
+	c.Assert(strings.HasSuffix(content, "%%EOF\n"), qt.IsTrue)
+	for _, text := range []string{
+		"(Tool loan agreement)",
+		"(Lender: Lender \\(owner\\) <lender@example.com>, on behalf of the community testCommunity)",
+		"(Borrower: Jos\\351 <borrower@example.com>)",
+		"(Serial number: SN-123)",
+		"(From 1 May 2026 to 3 May 2026.)",
+		"(Price: 20 tokens.)",
+		"(Payment: 15.00 EUR, paid)",
+		"(Clean it after use.)",
+		"(Booking 66f1c2d3e4f5a6b7c8d9e0f1 - page 1 of 1)",
+	} {
+		c.Assert(content, qt.Contains, text)
+	}
+	c.Assert(content, qt.Not(qt.Contains), "Asset tag")
+	checkXref(c, data)
+
+	// Long terms are wrapped and continue on the next pages
+	agreement.Terms.Text = strings.Repeat("The tool must be cleaned and oiled after each use. ", 400)
+	agreement.Price = 0
+	data, err = agreement.PDF()
+	c.Assert(err, qt.IsNil)
+	content = string(data)
+	c.Assert(content, qt.Contains, "(The loan is free of charge.)")
+	count := regexp.MustCompile(`/Count (\d+)`).FindStringSubmatch(content)
+	c.Assert(count, qt.HasLen, 2)
+	pages, err := strconv.Atoi(count[1])
+	c.Assert(err, qt.IsNil)
+	c.Assert(pages > 1, qt.IsTrue)
+	c.Assert(content, qt.Contains, fmt.Sprintf(" - page %d of %d)", pages, pages))
+	checkXref(c, data)
+}
+
+// checkXref checks the cross-reference table points to each object of the document.
+func checkXref(c *qt.C, data []byte) {
+	start := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	c.Assert(start, qt.HasLen, 2)
+	xref, err := strconv.Atoi(string(start[1]))
+	c.Assert(err, qt.IsNil)
+	c.Assert(bytes.HasPrefix(data[xref:], []byte("xref\n")), qt.IsTrue)
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+	c.Assert(len(entries) > 5, qt.IsTrue)
+	for i, entry := range entries {
+		offset, err := strconv.Atoi(string(entry[1]))
+		c.Assert(err, qt.IsNil)
+		c.Assert(bytes.HasPrefix(data[offset:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))), qt.IsTrue)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(wrap("", false, 10, 100), qt.DeepEquals, []string{""})
+	c.Assert(wrap("short line", false, 10, 100), qt.DeepEquals, []string{"short line"})
+	lines := wrap("one two three four five six seven eight nine ten", false, 10, 100)
+	c.Assert(len(lines) > 1, qt.IsTrue)
+	c.Assert(strings.Join(lines, " "), qt.Equals, "one two three four five six seven eight nine ten")
+	for _, line := range lines {
+		c.Assert(textWidth(line, false, 10) <= 100, qt.IsTrue)
+	}
+	// Words longer than a line are broken
+	lines = wrap(strings.Repeat("w", 50), true, 10, 100)
+	c.Assert(len(lines) > 1, qt.IsTrue)
+	c.Assert(strings.Join(lines, ""), qt.Equals, strings.Repeat("w", 50))
+}
+
+func TestEncodeText(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(encodeText(`a (b) \c`), qt.Equals, `(a \(b\) \\c)`)
+	c.Assert(encodeText("10 € – ñ"), qt.Equals, `(10 \200 \226 \361)`)
+	c.Assert(encodeText("日本"), qt.Equals, "(??)")
+}
@@ -0,0 +1,235 @@
+package agreement
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// The documents are A4 pages, in points, written with the standard Helvetica fonts so no font
+// is embedded.
+const (
+	pageWidth    = 595.28
+	pageHeight   = 841.89
+	pageMargin   = 56.69
+	bodySize     = 10
+	headingSize  = 12
+	titleSize    = 16
+	footerSize   = 8
+	lineSpacing  = 1.4
+	defaultWidth = 556
+)
+
+// helveticaWidths and helveticaBoldWidths are the widths, in thousandths of the font size, of
+// the printable ASCII characters (32 to 126) of the Helvetica fonts. The other characters are
+// measured as defaultWidth, which is only used to wrap the lines.
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// winAnsi are the characters out of the Latin-1 range that have a code in the WinAnsiEncoding
+// of the fonts. The Latin-1 characters have the same code, the others are written as "?".
+var winAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+}
+
+// pdfLine is a line of text laid out on a page.
+type pdfLine struct {
+	text string
+	bold bool
+	size float64
+	// space is the vertical space before the line
+	space float64
+}
+
+// textWidth returns the width of the text in points.
+func textWidth(text string, bold bool, size float64) float64 {
+	widths := &helveticaWidths
+	if bold {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, r := range text {
+		if r >= 32 && r <= 126 {
+			total += widths[r-32]
+		} else {
+			total += defaultWidth
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// wrap splits the paragraph in the lines fitting in the width, breaking the words longer
+// than a line.
+func wrap(paragraph string, bold bool, size, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(paragraph) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if textWidth(candidate, bold, size) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		line = ""
+		for _, r := range word {
+			if line != "" && textWidth(line+string(r), bold, size) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			line += string(r)
+		}
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// layout splits the text in the lines of the document. The lines starting with "# " are the
+// title, those starting with "## " the headings, and the empty lines separate paragraphs.
+func layout(text string) []pdfLine {
+	width := pageWidth - 2*pageMargin
+	var lines []pdfLine
+	space := 0.0
+	for _, paragraph := range strings.Split(strings.TrimSpace(text), "\n") {
+		paragraph = strings.TrimRight(paragraph, " \t\r")
+		bold, size := false, float64(bodySize)
+		switch {
+		case paragraph == "":
+			space += bodySize * lineSpacing / 2
+			continue
+		case strings.HasPrefix(paragraph, "## "):
+			bold, size = true, headingSize
+			paragraph = paragraph[3:]
+			space += bodySize / 2
+		case strings.HasPrefix(paragraph, "# "):
+			bold, size = true, titleSize
+			paragraph = paragraph[2:]
+		}
+		for _, text := range wrap(paragraph, bold, size, width) {
+			lines = append(lines, pdfLine{text: text, bold: bold, size: size, space: space})
+			space = 0
+		}
+	}
+	return lines
+}
+
+// encodeText returns the text as a PDF string in the WinAnsiEncoding, escaping the
+// delimiters.
+func encodeText(text string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r <= 126:
+			b.WriteRune(r)
+		case r >= 0xA0 && r <= 0xFF:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case winAnsi[r] != 0:
+			fmt.Fprintf(&b, "\\%03o", winAnsi[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// paginate splits the lines in the content streams of the pages, each one with the footer
+// and the page number.
+func paginate(lines []pdfLine, footer string) []string {
+	var pages []*bytes.Buffer
+	var page *bytes.Buffer
+	y := 0.0
+	for _, line := range lines {
+		height := line.size * lineSpacing
+		if page == nil || y-line.space-height < pageMargin {
+			page = &bytes.Buffer{}
+			pages = append(pages, page)
+			y = pageHeight - pageMargin
+		} else {
+			y -= line.space
+		}
+		y -= height
+		font := "F1"
+		if line.bold {
+			font = "F2"
+		}
+		fmt.Fprintf(page, "BT /%s %g Tf %.2f %.2f Td %s Tj ET\n", font, line.size, pageMargin, y, encodeText(line.text))
+	}
+	if len(pages) == 0 {
+		pages = append(pages, &bytes.Buffer{})
+	}
+	streams := make([]string, len(pages))
+	for i, page := range pages {
+		fmt.Fprintf(page, "BT /F1 %d Tf %.2f %.2f Td %s Tj ET\n", footerSize, pageMargin, pageMargin/2,
+			encodeText(fmt.Sprintf("%s - page %d of %d", footer, i+1, len(pages))))
+		streams[i] = page.String()
+	}
+	return streams
+}
+
+// renderPDF writes the text as a PDF document with the title, paginated with the footer.
+func renderPDF(title, footer, text string) []byte {
+	streams := paginate(layout(text), footer)
+	// The objects are the catalog, the pages, the fonts, the info and each page with its
+	// content stream
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Title %s /Producer (Emprius) >>", encodeText(title)),
+	}
+	kids := make([]string, len(streams))
+	for i, stream := range streams {
+		pageID := len(objects) + 1
+		kids[i] = fmt.Sprintf("%d 0 R", pageID)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+				"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, pageID+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(stream), stream),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/emprius/emprius-app-backend/types"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// deleteProfileHandler handles DELETE /profile
+// It deletes the account of the user: open bookings are cancelled (notifying the other party),
+// tools are deleted or transferred to another user and the personal data is anonymized.
+// The user document is kept anonymized so the bookings of other users remain consistent.
+func (a *API) deleteProfileHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var req DeleteProfileRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if match, _ := a.verifyPassword(req.Password, user.Password); !match {
+		return nil, ErrWrongLogin
+	}
+
+	ctx := r.Context.Request.Context()
+	var recipient *db.User
+	if req.TransferToolsTo != "" {
+		if recipient, err = a.getDBUserByID(req.TransferToolsTo); err != nil {
+			return nil, err
+		}
+		if recipient.ID == user.ID || !recipient.Active || recipient.DeletedAt != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("cannot transfer tools to user %s", req.TransferToolsTo))
+		}
+	}
+	tools, cancelled, err := a.deleteAccount(ctx, user, recipient,
+		"A booking was cancelled because the other user deleted the account")
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("user %s deleted, %d tools processed, %d bookings cancelled", user.ID.Hex(), tools, cancelled)
+	a.audit(r, &db.AuditEntry{
+		Action:     db.AuditAccountDelete,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Details:    fmt.Sprintf("%d tools processed, %d bookings cancelled", tools, cancelled),
+	})
+
+	a.sendMail(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Account deleted",
+		Body:    fmt.Sprintf("Your %s account and its personal data have been deleted.", a.branding.AppName),
+	})
+	return nil, nil
+}
+
+// deleteAccount cancels the open bookings of the user, notifying the other party with the given
+// message, deletes the tools of the user or transfers them to the recipient if not nil, and
+// deletes its personal data. Returns the number of tools processed and of bookings cancelled.
+func (a *API) deleteAccount(ctx context.Context, user, recipient *db.User, cancelMessage string) (int, int, error) {
+	tools, err := a.database.ToolService.GetToolsByUserID(ctx, user.ID)
+	if err != nil {
+		return 0, 0, ErrInternalServerError.WithErr(err)
+	}
+
+	// Cancel the open bookings first, so no tool is lent or requested while it is moved
+	cancelled, err := a.database.BookingService.CancelUserOpenBookings(ctx, user.ID)
+	if err != nil {
+		return 0, 0, ErrInternalServerError.WithErr(err)
+	}
+	for _, booking := range cancelled {
+		a.notify(ctx, &db.Notification{
+			UserID:    otherParty(booking, user.ID),
+			Type:      db.NotificationBookingCancelled,
+			Message:   cancelMessage,
+			BookingID: booking.ID,
+		})
+		// The tools of the user are deleted or moved, only the borrowed dates are released
+		if booking.FromUserID == user.ID {
+			a.processWaitlist(ctx, booking)
+		}
+	}
+
+	for _, tool := range tools {
+		if recipient != nil {
+			if _, err := a.moveTool(tool, recipient.ID); err != nil {
+				return 0, 0, err
+			}
+			continue
+		}
+		if err := a.deleteTool(tool.ID); err != nil {
+			return 0, 0, err
+		}
+		if err := a.database.FavoriteService.DeleteToolFavorites(ctx, tool.ID); err != nil {
+			log.Error().Err(err).Msgf("could not delete favorites of tool %d", tool.ID)
+		}
+		if err := a.database.MaintenanceService.DeleteToolEntries(ctx, tool.ID); err != nil {
+			log.Error().Err(err).Msgf("could not delete the maintenance log of tool %d", tool.ID)
+		}
+		if err := a.database.ToolViewService.DeleteToolViews(ctx, tool.ID); err != nil {
+			log.Error().Err(err).Msgf("could not delete the views of tool %d", tool.ID)
+		}
+		if err := a.database.ValuationService.DeleteToolValuations(ctx, tool.ID); err != nil {
+			log.Error().Err(err).Msgf("could not delete the valuation history of tool %d", tool.ID)
+		}
+		if err := a.database.TransferService.CancelToolTransfers(ctx, tool.ID); err != nil {
+			log.Error().Err(err).Msgf("could not cancel the transfers of tool %d", tool.ID)
+		}
+		a.invalidateToolCaches(tool.Location)
+	}
+	if recipient != nil && len(tools) > 0 {
+		a.notify(ctx, &db.Notification{
+			UserID:  recipient.ID,
+			Type:    db.NotificationToolsTransferred,
+			Message: fmt.Sprintf("%s transferred you %d tools before deleting the account", user.Name, len(tools)),
+		})
+	}
+
+	if err := a.deleteUserData(ctx, user.ID); err != nil {
+		return 0, 0, ErrInternalServerError.WithErr(err)
+	}
+	return len(tools), len(cancelled), nil
+}
+
+// deleteUserData removes the personal data of the user from every collection and
+// anonymizes the user document.
+func (a *API) deleteUserData(ctx context.Context, userID primitive.ObjectID) error {
+	if err := a.database.BookingService.AnonymizeUserBookings(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.SavedSearchService.DeleteUserSavedSearches(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.FavoriteService.DeleteUserFavorites(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.NotificationService.DeleteUserNotifications(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.MessageService.DeleteUserMessages(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.RecoveryService.DeleteUserRecoveries(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.DeviceService.DeleteUserDevices(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.WaitlistService.DeleteUserEntries(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.InviteService.DeleteUnusedInvites(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.ToolService.RemoveManagerFromTools(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.TransferService.CancelUserTransfers(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.SessionService.DeleteUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.database.UserService.AnonymizeUser(ctx, userID); err != nil {
+		return err
+	}
+	a.infoCache.invalidate()
+	return nil
+}
+
+// exportProfileHandler handles GET /profile/export?format=json|zip
+// It returns all the data of the user for portability. The zip format also includes the
+// content of the avatar and tool images.
+func (a *API) exportProfileHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	format := "json"
+	if param := r.Context.URLParam("format"); param != nil {
+		format = param[0]
+	}
+	if format != "json" && format != "zip" {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid format %q", format))
+	}
+
+	export, err := a.profileExport(r.Context.Request.Context(), user)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if format == "json" {
+		return export, nil
+	}
+
+	data, err := a.profileExportZip(r.Context.Request.Context(), export)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &RawResponse{
+		ContentType: "application/zip",
+		Filename:    fmt.Sprintf("emprius-export-%s.zip", user.ID.Hex()),
+		Data:        data,
+	}, nil
+}
+
+// profileExport collects the data of the user.
+func (a *API) profileExport(ctx context.Context, user *db.User) (*ProfileExport, error) {
+	export := &ProfileExport{
+		ExportedAt:    time.Now(),
+		Profile:       new(User).FromDBUser(user),
+		Tools:         []*Tool{},
+		Bookings:      []BookingResponse{},
+		Ratings:       []ExportedRating{{Rating: int(user.Rating)}},
+		SavedSearches: []*SavedSearch{},
+		Favorites:     []int64{},
+		Images:        []types.HexBytes{},
+	}
+	export.TermsAcceptances = user.TermsAcceptances
+	if export.TermsAcceptances == nil {
+		export.TermsAcceptances = []db.TermsAcceptance{}
+	}
+	export.Images = append(export.Images, avatarImages(user)...)
+
+	tools, err := a.database.ToolService.GetToolsByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tools {
+		tool := new(Tool).FromDBTool(t)
+		showToolIdentifiers(tool)
+		export.Tools = append(export.Tools, tool)
+		export.Ratings = append(export.Ratings, ExportedRating{ToolID: t.ID, Rating: int(t.Rating)})
+		for _, image := range t.Images {
+			export.Images = append(export.Images, image.Hash)
+		}
+	}
+
+	requests, err := a.database.BookingService.GetUserRequests(ctx, user.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+	petitions, err := a.database.BookingService.GetUserPetitions(ctx, user.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, booking := range append(requests, petitions...) {
+		export.Bookings = append(export.Bookings, convertBookingToResponse(booking))
+	}
+
+	searches, err := a.database.SavedSearchService.GetUserSavedSearches(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range searches {
+		export.SavedSearches = append(export.SavedSearches, new(SavedSearch).FromDBSavedSearch(s))
+	}
+	for page := 0; ; page++ {
+		favorites, err := a.database.FavoriteService.GetUserFavorites(ctx, user.ID, page)
+		if err != nil {
+			return nil, err
+		}
+		if len(favorites) == 0 {
+			break
+		}
+		export.Favorites = append(export.Favorites, favorites...)
+	}
+	return export, nil
+}
+
+// profileExportZip packs the export as data.json together with the images of the user.
+// Images missing from the database are skipped.
+func (a *API) profileExportZip(ctx context.Context, export *ProfileExport) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	f, err := zw.Create("data.json")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, hash := range export.Images {
+		if seen[hash.String()] {
+			continue
+		}
+		seen[hash.String()] = true
+		image, err := a.database.ImageService.GetImage(ctx, hash)
+		if err != nil {
+			log.Warn().Err(err).Msgf("image %s not found for export", hash.String())
+			continue
+		}
+		f, err := zw.Create("images/" + hash.String())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(image.Content); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
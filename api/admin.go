@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/emprius/emprius-app-backend/policy"
+)
+
+// requireAdmin returns an error if the user performing the request is not an admin.
+func (a *API) requireAdmin(r *Request) error {
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return err
+	}
+	return authorize(policy.AdminAccess, subject, policy.Resource{})
+}
+
+// communityAdmins returns the admins of the community, falling back to every admin
+// if the community is empty or has none.
+func (a *API) communityAdmins(ctx context.Context, community string) ([]*db.User, error) {
+	if community != "" {
+		admins, err := a.database.UserService.GetAdmins(ctx, community)
+		if err != nil {
+			return nil, err
+		}
+		if len(admins) > 0 {
+			return admins, nil
+		}
+	}
+	return a.database.UserService.GetAdmins(ctx, "")
+}
+
+// adminToolsHandler handles GET /admin/tools?serialNumber=&assetTag=
+// It returns the tools of any owner matching the given serial number and/or asset tag.
+func (a *API) adminToolsHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	serialNumber, assetTag := "", ""
+	if param := r.Context.URLParam("serialNumber"); param != nil {
+		serialNumber = strings.TrimSpace(param[0])
+	}
+	if param := r.Context.URLParam("assetTag"); param != nil {
+		assetTag = strings.TrimSpace(param[0])
+	}
+	if serialNumber == "" && assetTag == "" {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing serialNumber or assetTag"))
+	}
+
+	tools, err := a.database.ToolService.GetToolsByIdentifier(r.Context.Request.Context(), serialNumber, assetTag)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := []*Tool{}
+	for _, t := range tools {
+		result = append(result, new(Tool).FromDBTool(t))
+	}
+	showToolIdentifiers(result...)
+	a.setBreadcrumbs(result...)
+	return &ToolsWrapper{Tools: result}, nil
+}
+
+// defaultAnalyticsDays is the default period of the admin analytics.
+const defaultAnalyticsDays = 90
+
+// adminOriginAttributionHandler handles GET /admin/analytics/origins?days=
+// It returns how many bookings were created from each origin in the last days, and how many
+// of them were accepted and returned.
+func (a *API) adminOriginAttributionHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	days := defaultAnalyticsDays
+	if param := r.Context.URLParam("days"); param != nil {
+		d, err := strconv.Atoi(param[0])
+		if err != nil || d <= 0 {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid days %q", param[0]))
+		}
+		days = d
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	origins, err := a.database.BookingService.GetOriginAttribution(r.Context.Request.Context(), since)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &OriginAttributionResponse{Since: since, Origins: origins}, nil
+}
+
+// adminImageUsageHandler handles GET /admin/images/usage
+// It returns the storage used by the images, and by the images of each user (its avatar and
+// the images of its tools), the users using the most first.
+func (a *API) adminImageUsageHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	images, bytes, err := a.database.ImageService.TotalUsage(ctx)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	users, err := a.database.ImageUsage(ctx)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &ImageUsageResponse{Images: images, Bytes: bytes, Users: users}, nil
+}
+
+// adminTestMailHandler handles POST /admin/mail/test
+// It sends to the admin a test email with the branding of the instance, which is returned.
+// Unlike the other emails, a failure to send it is returned.
+func (a *API) adminTestMailHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	admin, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	msg := &mail.Message{
+		To:      admin.Email,
+		Subject: a.branding.AppName + " test email",
+		Body: fmt.Sprintf("Hi %s,\n\nThis is a test email of %s, sent to check the branding of "+
+			"the emails of the instance.", admin.Name, a.branding.AppName),
+	}
+	if err := a.branding.Apply(msg); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if err := a.mailer.Send(r.Context.Request.Context(), msg); err != nil {
+		return nil, ErrMailNotSent.WithErr(err)
+	}
+	a.audit(r, &db.AuditEntry{Action: db.AuditTestMail, Details: admin.Email})
+	return &a.branding, nil
+}
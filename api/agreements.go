@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/agreement"
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+)
+
+// bookingAgreementHandler handles GET /bookings/{bookingId}/agreement.pdf
+// Returns the loan agreement of an accepted or returned booking as a PDF document, with the
+// parties, the tool and its valuation, the dates and the terms of the loan, i.e. for the
+// insurers asking the lenders for written agreements.
+func (a *API) bookingAgreementHandler(r *Request) (interface{}, error) {
+	booking, _, err := a.authorizedBookingFromRequest(r, "bookingId", policy.BookingRead)
+	if err != nil {
+		return nil, err
+	}
+	if booking.BookingStatus != db.BookingStatusAccepted && booking.BookingStatus != db.BookingStatusReturned {
+		return nil, ErrBookingWithoutAgreement.WithErr(fmt.Errorf("booking %s is %s", booking.ID.Hex(), booking.BookingStatus))
+	}
+	ctx := r.Context.Request.Context()
+	lender, err := a.database.UserService.GetUserByID(ctx, booking.ToUserID)
+	if err != nil {
+		return nil, ErrUserNotFound.WithErr(err)
+	}
+	borrower, err := a.database.UserService.GetUserByID(ctx, booking.FromUserID)
+	if err != nil {
+		return nil, ErrUserNotFound.WithErr(err)
+	}
+
+	doc := &agreement.Agreement{
+		AppName:            a.branding.AppName,
+		Reference:          booking.ID.Hex(),
+		Lender:             agreement.Party{Name: lender.Name, Email: lender.Email},
+		Borrower:           agreement.Party{Name: borrower.Name, Email: borrower.Email},
+		Community:          booking.Community,
+		Tool:               agreement.Tool{Title: "Deleted tool"},
+		StartDate:          booking.StartDate,
+		EndDate:            booking.EndDate,
+		CancellationPolicy: string(booking.CancellationPolicy),
+		IssuedAt:           time.Now(),
+	}
+	if doc.CancellationPolicy == "" {
+		doc.CancellationPolicy = string(db.CancellationFlexible)
+	}
+	if id, err := strconv.ParseInt(booking.ToolID, 10, 64); err == nil {
+		if tool, err := a.database.ToolService.GetToolByID(ctx, id); err == nil && tool != nil {
+			doc.Tool = agreement.Tool{
+				Title:          tool.Title,
+				SerialNumber:   tool.SerialNumber,
+				AssetTag:       tool.AssetTag,
+				EstimatedValue: tool.EstimatedValue,
+			}
+		}
+	}
+	if booking.Price != nil {
+		doc.Price = *booking.Price
+	}
+	if p := booking.Payment; p != nil {
+		doc.Payment = fmt.Sprintf("%d.%02d %s, %s", p.Amount/100, p.Amount%100, strings.ToUpper(p.Currency), p.Status)
+	}
+	if t := booking.AcceptedTerms; t != nil {
+		doc.Terms = &agreement.Terms{Text: t.Text, Version: t.Version, AcceptedAt: t.AcceptedAt}
+	}
+	data, err := doc.PDF()
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &RawResponse{
+		ContentType: "application/pdf",
+		Filename:    "agreement-" + booking.ID.Hex() + ".pdf",
+		Data:        data,
+	}, nil
+}
@@ -6,45 +6,382 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/geocoding"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/emprius/emprius-app-backend/password"
+	"github.com/emprius/emprius-app-backend/payment"
+	"github.com/emprius/emprius-app-backend/push"
+	"github.com/emprius/emprius-app-backend/telegram"
+	"github.com/emprius/emprius-app-backend/trust"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/jwtauth/v5"
 	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const (
 	jwtExpiration = 720 * time.Hour // 30 days
-	passwordSalt  = "emprius"       // salt for password hashing
+	passwordSalt  = "emprius"       // salt of the legacy password hashes
+
+	defaultPendingBookingTTL  = 7 * 24 * time.Hour // time before an unanswered booking request expires
+	defaultDisagreementPeriod = 7 * 24 * time.Hour // time to resolve a return disagreement before it is escalated
+	defaultMaxInviteCodes     = 5                  // unused invite codes a user can have
+	defaultInviteCodeCooldown = 24 * time.Hour     // time between two invite codes of a user
+	defaultCancellationWindow = 48 * time.Hour     // time before the start of a booking a strict cancellation is late
+	defaultCancellationFee    = 50                 // percentage of the price of a booking paid for a late cancellation
+	defaultDepreciationRate   = 10                 // percentage of its estimated value a tool loses each year
+	defaultAuditRetention     = 8760 * time.Hour   // time the audit log entries are kept (a year)
+	defaultLoginMaxAttempts   = 5                  // failed logins of an account before it is locked
+	defaultLoginLockout       = 5 * time.Minute    // duration of the first lockout, doubled on each further failure
+	defaultInactivityGrace    = 720 * time.Hour    // time between the inactivity warning and the anonymization (30 days)
+	defaultPaymentCurrency    = "eur"              // currency of the booking payments
+	defaultPaymentTokenValue  = 100                // value of a token in cents of the payment currency
 )
 
+// defaultMapCenter is the default center of the maps of the clients, in Catalonia.
+var defaultMapCenter = Location{Latitude: 41695384, Longitude: 2492793}
+
+// Options are the optional settings of the API.
+type Options struct {
+	// Mailer sends the emails to the users. If nil, emails are only logged.
+	Mailer mail.Sender
+	// AdminRecovery enables the account recovery flow approved by community admins,
+	// for deployments where email based recovery is not viable.
+	AdminRecovery bool
+	// CommunityToolApproval lets the community members share tools with their community, listed
+	// once approved by a community admin. Otherwise only the admins register community tools.
+	CommunityToolApproval bool
+	// PendingBookingTTL is the time a booking request can stay pending before it expires.
+	// Requests also expire when their start date is reached. Defaults to 7 days.
+	PendingBookingTTL time.Duration
+	// DisagreementPeriod is the time the parties have to resolve a return condition disagreement
+	// before it is escalated to a dispute handled by the community admins. Defaults to 7 days.
+	DisagreementPeriod time.Duration
+	// Geocoder resolves addresses to coordinates and coordinates to localities.
+	// If nil, locations must be given as coordinates and no locality is set.
+	Geocoder geocoding.Provider
+	// TrustWeights are the weights of the trust score components. Defaults to trust.DefaultWeights.
+	TrustWeights *trust.Weights
+	// FederationPeers are the base URLs of the peer instances queried by the federated searches.
+	FederationPeers []string
+	// FederationToken is the token shared by the instances of the federation. It is sent to the
+	// peers and required from them. If empty, the instance does not answer peer searches.
+	FederationToken string
+	// Push sends the push notifications to the devices of the users. If nil, they are only logged.
+	Push push.Sender
+	// VAPIDPublicKey is the Web Push application server key announced to the browsers.
+	VAPIDPublicKey string
+	// MaxInviteCodes is the maximum number of unused invite codes a user can have. Defaults to 5.
+	MaxInviteCodes int
+	// InviteCodeCooldown is the minimum time between two invite codes of a user. Defaults to 24 hours.
+	InviteCodeCooldown time.Duration
+	// PublicURL is the public base URL of the API, used in the links of the emails. If empty,
+	// the emails have no links.
+	PublicURL string
+	// CancellationWindow is the time before the start of a booking of a tool with a strict
+	// cancellation policy after which the renter pays a penalty to cancel it. Defaults to 48 hours.
+	CancellationWindow time.Duration
+	// CancellationFee is the percentage of the price of a booking paid as penalty for a late
+	// cancellation. Defaults to 50.
+	CancellationFee int
+	// DepreciationRate is the percentage of its estimated value a tool loses each year, suggested
+	// to its owner as the new valuation. Defaults to 10.
+	DepreciationRate int
+	// Branding is the name, logo, colors and links of the instance in the emails. Its empty
+	// fields use the mail package defaults.
+	Branding *mail.Branding
+	// Telegram is the bot that sends the notifications to the users that linked their Telegram
+	// account. If nil, the Telegram channel is disabled.
+	Telegram *telegram.Bot
+	// AuditRetention is the time the audit log entries are kept. Defaults to a year.
+	AuditRetention time.Duration
+	// TrustProxy takes the client IP of the audit log from the X-Forwarded-For and X-Real-IP
+	// headers, for deployments behind a reverse proxy.
+	TrustProxy bool
+	// CountryHeader is the header with the country code of the client set by the reverse proxy
+	// (i.e. CF-IPCountry), used to alert the users of logins from new countries.
+	CountryHeader string
+	// LoginMaxAttempts is the number of consecutive failed logins of an account after which its
+	// logins are locked. An IP is locked after four times as many. Defaults to 5.
+	LoginMaxAttempts int
+	// LoginLockout is the duration of the first lockout, doubled on each failure after it up to
+	// a day. Defaults to 5 minutes.
+	LoginLockout time.Duration
+	// PasswordPolicy is the policy of the passwords set on registration, profile update and
+	// account recovery. Defaults to password.DefaultPolicy.
+	PasswordPolicy *password.Policy
+	// PasswordHashing are the Argon2id parameters of the new password hashes. The hashes made with
+	// other parameters, or with the legacy scheme, are replaced on login. Defaults to
+	// password.DefaultArgon2.
+	PasswordHashing *password.Argon2Params
+	// SearchCacheTTL is the time the first pages of the tool searches are cached. Defaults to
+	// 30 seconds, a negative TTL disables the cache.
+	SearchCacheTTL time.Duration
+	// InfoCacheTTL is the time the GET /info response is cached. Defaults to a minute, a
+	// negative TTL disables the cache.
+	InfoCacheTTL time.Duration
+	// InboundAddress is the address receiving the replies to the booking notification emails,
+	// plus-addressed with a token of the booking and the user. If empty, the emails keep the
+	// branding reply-to address.
+	InboundAddress string
+	// InboundMailToken is the token required by the inbound mail webhook, which the mail
+	// provider posts the replies to. If empty, the webhook is disabled.
+	InboundMailToken string
+	// InactivityPeriod is the time without logins nor use of the sessions after which an account
+	// is inactive. The inactive users are emailed a warning, and their accounts anonymized if
+	// still inactive after InactivityGracePeriod. If zero, the accounts are never anonymized.
+	InactivityPeriod time.Duration
+	// InactivityGracePeriod is the time between the warning and the anonymization of an inactive
+	// account. Defaults to 30 days.
+	InactivityGracePeriod time.Duration
+	// Tenant is the id of the tenant served by the API in a multi-tenant deployment, empty
+	// otherwise. The tokens are only valid for the tenant that issued them.
+	Tenant string
+	// MapCenter is the default center of the maps of the clients, announced by GET /info.
+	// Defaults to Catalonia.
+	MapCenter *Location
+	// DefaultSearchRadius is the radius in meters of the tool searches without distance. If zero,
+	// they are only limited by MaxSearchRadius.
+	DefaultSearchRadius int
+	// MaxSearchRadius is the maximum radius in meters of the tool searches, the larger distances
+	// are reduced to it. If zero, the searches are not limited.
+	MaxSearchRadius int
+	// Payments collects in real money the price of the bookings, a payment is created when a
+	// booking with a price is accepted. If nil, the bookings are not paid in money.
+	Payments payment.Provider
+	// PaymentCurrency is the lower case ISO 4217 code of the currency of the payments. Defaults
+	// to eur.
+	PaymentCurrency string
+	// PaymentTokenValue is the value of a token of the booking prices in the minor unit of the
+	// payment currency (i.e. cents). Defaults to 100, a token is worth a unit of the currency.
+	PaymentTokenValue int64
+	// PaymentReturnURL is the page of the clients the payers are sent to after paying, with
+	// {booking} replaced by the booking id.
+	PaymentReturnURL string
+}
+
 // API type represents the API HTTP server with JWT authentication capabilities.
 type API struct {
-	Router            *chi.Mux
-	auth              *jwtauth.JWTAuth
-	registerAuthToken string
-	database          *db.Database
+	Router             *chi.Mux
+	auth               *jwtauth.JWTAuth
+	registerAuthToken  string
+	database           *db.Database
+	searchCache        *searchCache
+	infoCache          *infoCache
+	imageGCAt          time.Time
+	imageQueue         chan []byte
+	mailer             mail.Sender
+	adminRecovery      bool
+	toolApproval       bool
+	pendingBookingTTL  time.Duration
+	disagreementPeriod time.Duration
+	geocoder           geocoding.Provider
+	locationKey        []byte
+	trustWeights       trust.Weights
+	federationPeers    []string
+	federationToken    string
+	peerCache          *peerCache
+	publicStats        *publicStatsCache
+	push               push.Sender
+	vapidPublicKey     string
+	maxInviteCodes     int
+	inviteCooldown     time.Duration
+	publicURL          string
+	cancelWindow       time.Duration
+	cancelFee          uint64
+	depreciationRate   uint64
+	branding           mail.Branding
+	telegram           *telegram.Bot
+	auditRetention     time.Duration
+	trustProxy         bool
+	countryHeader      string
+	loginMaxAttempts   int
+	loginLockout       time.Duration
+	passwordPolicy     password.Policy
+	argon2             password.Argon2Params
+	inboundAddress     string
+	inboundToken       string
+	replyKey           []byte
+	inactivityPeriod   time.Duration
+	inactivityGrace    time.Duration
+	tenant             string
+	mapCenter          Location
+	searchRadius       int
+	maxSearchRadius    int
+	payments           payment.Provider
+	paymentCurrency    string
+	tokenValue         int64
+	paymentReturnURL   string
 }
 
 // New creates a new API HTTP server. It does not start the server. Use Start() for that.
-func New(secret, registerAuthToken string, database *db.Database) *API {
+// The options can be nil to use the defaults.
+func New(secret, registerAuthToken string, database *db.Database, opts *Options) *API {
+	if opts == nil {
+		opts = &Options{}
+	}
+	mailer := opts.Mailer
+	if mailer == nil {
+		mailer = mail.LogSender{}
+	}
+	pendingBookingTTL := opts.PendingBookingTTL
+	if pendingBookingTTL <= 0 {
+		pendingBookingTTL = defaultPendingBookingTTL
+	}
+	disagreementPeriod := opts.DisagreementPeriod
+	if disagreementPeriod <= 0 {
+		disagreementPeriod = defaultDisagreementPeriod
+	}
+	pushSender := opts.Push
+	if pushSender == nil {
+		pushSender = push.LogSender{}
+	}
+	trustWeights := trust.DefaultWeights
+	if opts.TrustWeights != nil {
+		trustWeights = *opts.TrustWeights
+	}
+	maxInviteCodes := opts.MaxInviteCodes
+	if maxInviteCodes <= 0 {
+		maxInviteCodes = defaultMaxInviteCodes
+	}
+	inviteCooldown := opts.InviteCodeCooldown
+	if inviteCooldown <= 0 {
+		inviteCooldown = defaultInviteCodeCooldown
+	}
+	cancelWindow := opts.CancellationWindow
+	if cancelWindow <= 0 {
+		cancelWindow = defaultCancellationWindow
+	}
+	cancelFee := opts.CancellationFee
+	if cancelFee <= 0 || cancelFee > 100 {
+		cancelFee = defaultCancellationFee
+	}
+	depreciationRate := opts.DepreciationRate
+	if depreciationRate <= 0 || depreciationRate > 100 {
+		depreciationRate = defaultDepreciationRate
+	}
+	auditRetention := opts.AuditRetention
+	if auditRetention <= 0 {
+		auditRetention = defaultAuditRetention
+	}
+	loginMaxAttempts := opts.LoginMaxAttempts
+	if loginMaxAttempts <= 0 {
+		loginMaxAttempts = defaultLoginMaxAttempts
+	}
+	loginLockout := opts.LoginLockout
+	if loginLockout <= 0 {
+		loginLockout = defaultLoginLockout
+	}
+	passwordPolicy := password.DefaultPolicy
+	if opts.PasswordPolicy != nil {
+		passwordPolicy = *opts.PasswordPolicy
+	}
+	argon2 := password.DefaultArgon2
+	if opts.PasswordHashing != nil {
+		argon2 = *opts.PasswordHashing
+	}
+	var searchCache *searchCache
+	switch {
+	case opts.SearchCacheTTL == 0:
+		searchCache = newSearchCache(searchCacheTTL)
+	case opts.SearchCacheTTL > 0:
+		searchCache = newSearchCache(opts.SearchCacheTTL)
+	}
+	infoTTL := opts.InfoCacheTTL
+	if infoTTL == 0 {
+		infoTTL = defaultInfoCacheTTL
+	}
+	inactivityGrace := opts.InactivityGracePeriod
+	if inactivityGrace <= 0 {
+		inactivityGrace = defaultInactivityGrace
+	}
+	mapCenter := defaultMapCenter
+	if opts.MapCenter != nil {
+		mapCenter = *opts.MapCenter
+	}
+	searchRadius := max(opts.DefaultSearchRadius, 0)
+	maxSearchRadius := max(opts.MaxSearchRadius, 0)
+	if maxSearchRadius > 0 && searchRadius > maxSearchRadius {
+		searchRadius = maxSearchRadius
+	}
+	paymentCurrency := strings.ToLower(opts.PaymentCurrency)
+	if paymentCurrency == "" {
+		paymentCurrency = defaultPaymentCurrency
+	}
+	tokenValue := opts.PaymentTokenValue
+	if tokenValue <= 0 {
+		tokenValue = defaultPaymentTokenValue
+	}
+	var branding mail.Branding
+	if opts.Branding != nil {
+		branding = *opts.Branding
+	}
 	return &API{
-		auth:              jwtauth.New("HS256", []byte(secret), nil),
-		database:          database,
-		registerAuthToken: registerAuthToken,
+		auth:               jwtauth.New("HS256", []byte(secret), nil),
+		database:           database,
+		registerAuthToken:  registerAuthToken,
+		searchCache:        searchCache,
+		infoCache:          newInfoCache(infoTTL),
+		imageQueue:         make(chan []byte, imageQueueSize),
+		mailer:             mailer,
+		adminRecovery:      opts.AdminRecovery,
+		toolApproval:       opts.CommunityToolApproval,
+		pendingBookingTTL:  pendingBookingTTL,
+		disagreementPeriod: disagreementPeriod,
+		geocoder:           opts.Geocoder,
+		locationKey:        newLocationKey(secret),
+		trustWeights:       trustWeights,
+		federationPeers:    opts.FederationPeers,
+		federationToken:    opts.FederationToken,
+		peerCache:          newPeerCache(federationCacheTTL),
+		publicStats:        &publicStatsCache{ttl: publicStatsTTL},
+		push:               pushSender,
+		vapidPublicKey:     opts.VAPIDPublicKey,
+		maxInviteCodes:     maxInviteCodes,
+		inviteCooldown:     inviteCooldown,
+		publicURL:          opts.PublicURL,
+		cancelWindow:       cancelWindow,
+		cancelFee:          uint64(cancelFee),
+		depreciationRate:   uint64(depreciationRate),
+		branding:           branding.WithDefaults(),
+		telegram:           opts.Telegram,
+		auditRetention:     auditRetention,
+		trustProxy:         opts.TrustProxy,
+		countryHeader:      opts.CountryHeader,
+		loginMaxAttempts:   loginMaxAttempts,
+		loginLockout:       loginLockout,
+		passwordPolicy:     passwordPolicy,
+		argon2:             argon2,
+		inboundAddress:     opts.InboundAddress,
+		inboundToken:       opts.InboundMailToken,
+		replyKey:           newReplyKey(secret),
+		inactivityPeriod:   opts.InactivityPeriod,
+		inactivityGrace:    inactivityGrace,
+		tenant:             opts.Tenant,
+		mapCenter:          mapCenter,
+		searchRadius:       searchRadius,
+		maxSearchRadius:    maxSearchRadius,
+		payments:           opts.Payments,
+		paymentCurrency:    paymentCurrency,
+		tokenValue:         tokenValue,
+		paymentReturnURL:   opts.PaymentReturnURL,
 	}
 }
 
-// Start starts the API HTTP server (non blocking).
+// Start starts the API HTTP server and the background jobs (non blocking).
 func (a *API) Start(host string, port int) {
 	go func() {
 		if err := http.ListenAndServe(fmt.Sprintf("%s:%d", host, port), a.router()); err != nil {
 			log.Fatal().Err(err).Msg("failed to start api router")
 		}
 	}()
+	a.startJobs()
 }
 
 // router creates the router with all the routes and middleware.
@@ -54,15 +391,38 @@ func (a *API) router() http.Handler {
 	r.Use(cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", idempotencyKeyHeader},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}).Handler)
+	if a.trustProxy {
+		r.Use(middleware.RealIP)
+	}
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Throttle(100))
 	r.Use(middleware.ThrottleBacklog(5000, 40000, 30*time.Second))
 	r.Use(middleware.Timeout(30 * time.Second))
+
+	// The same routes are served for every API version, the handlers adapt their request and
+	// response to the version when it changes them. The unversioned routes are version 1, so
+	// the existing clients keep working.
+	routes := chi.NewRouter()
+	a.routes(routes)
+	r.Route("/v1", func(r chi.Router) {
+		r.Use(withAPIVersion(APIVersion1))
+		r.Mount("/", routes)
+	})
+	r.Route("/v2", func(r chi.Router) {
+		r.Use(withAPIVersion(APIVersion2))
+		r.Mount("/", routes)
+	})
+	r.Mount("/", routes)
+	return r
+}
+
+// routes registers the routes of the API.
+func (a *API) routes(r chi.Router) {
 	// Protected routes
 	r.Group(func(r chi.Router) {
 		// Seek, verify and validate JWT tokens
@@ -71,6 +431,9 @@ func (a *API) router() http.Handler {
 		// Handle valid JWT tokens.
 		r.Use(a.authenticator)
 
+		// Reject the writes of the users that did not accept the current terms.
+		r.Use(a.requireTerms)
+
 		// Endpoints
 		// Users
 		log.Info().Msg("register route GET /profile")
@@ -79,18 +442,216 @@ func (a *API) router() http.Handler {
 		r.Get("/refresh", a.routerHandler(a.refreshHandler))
 		log.Info().Msg("register route POST /profile")
 		r.Post("/profile", a.routerHandler(a.userProfileUpdateHandler))
+		log.Info().Msg("register route DELETE /profile")
+		r.Delete("/profile", a.routerHandler(a.deleteProfileHandler))
+		log.Info().Msg("register route GET /profile/export")
+		r.Get("/profile/export", a.routerHandler(a.exportProfileHandler))
+		log.Info().Msg("register route GET /profile/stats")
+		r.Get("/profile/stats", a.routerHandler(a.ownerStatsHandler))
+		log.Info().Msg("register route GET /profile/onboarding")
+		r.Get("/profile/onboarding", a.routerHandler(a.onboardingHandler))
+		log.Info().Msg("register route PUT /profile/avatar")
+		r.Put("/profile/avatar", a.routerHandler(a.uploadAvatarHandler))
 		log.Info().Msg("register route GET /users")
 		r.Get("/users", a.routerHandler(a.usersHandler))
 		log.Info().Msg("register route GET /users/{id}")
 		r.Get("/users/{id}", a.routerHandler(a.getUserHandler))
+		log.Info().Msg("register route GET /users/{id}/profile")
+		r.Get("/users/{id}/profile", a.routerHandler(a.publicProfileHandler))
+		log.Info().Msg("register route POST /users/{id}/block")
+		r.Post("/users/{id}/block", a.routerHandler(a.blockUserHandler))
+		log.Info().Msg("register route DELETE /users/{id}/block")
+		r.Delete("/users/{id}/block", a.routerHandler(a.unblockUserHandler))
+		log.Info().Msg("register route GET /profile/blocked")
+		r.Get("/profile/blocked", a.routerHandler(a.blockedUsersHandler))
+
+		// Direct messages
+		// GET /messages
+		log.Info().Msg("register route GET /messages")
+		r.Get("/messages", a.routerHandler(a.conversationsHandler))
+		// GET /messages/{userId}
+		log.Info().Msg("register route GET /messages/{userId}")
+		r.Get("/messages/{userId}", a.routerHandler(a.messagesHandler))
+		// POST /messages/{userId}
+		log.Info().Msg("register route POST /messages/{userId}")
+		r.Post("/messages/{userId}", a.routerHandler(a.sendMessageHandler))
+
+		// Invites
+		// GET /profile/invites
+		log.Info().Msg("register route GET /profile/invites")
+		r.Get("/profile/invites", a.routerHandler(a.invitesHandler))
+		// POST /profile/invites
+		log.Info().Msg("register route POST /profile/invites")
+		r.Post("/profile/invites", a.routerHandler(a.createInviteHandler))
+		// DELETE /profile/invites/{code}
+		log.Info().Msg("register route DELETE /profile/invites/{code}")
+		r.Delete("/profile/invites/{code}", a.routerHandler(a.revokeInviteHandler))
+
+		// Saved searches
+		// POST /profile/searches
+		log.Info().Msg("register route POST /profile/searches")
+		r.Post("/profile/searches", a.routerHandler(a.addSavedSearchHandler))
+		// GET /profile/searches
+		log.Info().Msg("register route GET /profile/searches")
+		r.Get("/profile/searches", a.routerHandler(a.savedSearchesHandler))
+		// DELETE /profile/searches/{id}
+		log.Info().Msg("register route DELETE /profile/searches/{id}")
+		r.Delete("/profile/searches/{id}", a.routerHandler(a.deleteSavedSearchHandler))
+
+		// Favorites
+		// GET /profile/favorites
+		log.Info().Msg("register route GET /profile/favorites")
+		r.Get("/profile/favorites", a.routerHandler(a.favoritesHandler))
+
+		// Notifications
+		// GET /profile/notifications
+		log.Info().Msg("register route GET /profile/notifications")
+		r.Get("/profile/notifications", a.routerHandler(a.notificationsHandler))
+		// POST /profile/notifications/read
+		log.Info().Msg("register route POST /profile/notifications/read")
+		r.Post("/profile/notifications/read", a.routerHandler(a.readAllNotificationsHandler))
+		// POST /profile/notifications/{id}/read
+		log.Info().Msg("register route POST /profile/notifications/{id}/read")
+		r.Post("/profile/notifications/{id}/read", a.routerHandler(a.readNotificationHandler))
+		// GET /profile/notification-preferences
+		log.Info().Msg("register route GET /profile/notification-preferences")
+		r.Get("/profile/notification-preferences", a.routerHandler(a.notificationPreferencesHandler))
+		// PUT /profile/notification-preferences
+		log.Info().Msg("register route PUT /profile/notification-preferences")
+		r.Put("/profile/notification-preferences", a.routerHandler(a.updateNotificationPreferencesHandler))
+		// GET /profile/digest
+		log.Info().Msg("register route GET /profile/digest")
+		r.Get("/profile/digest", a.routerHandler(a.digestPreferencesHandler))
+		// PUT /profile/digest
+		log.Info().Msg("register route PUT /profile/digest")
+		r.Put("/profile/digest", a.routerHandler(a.updateDigestPreferencesHandler))
+		// GET /profile/telegram
+		log.Info().Msg("register route GET /profile/telegram")
+		r.Get("/profile/telegram", a.routerHandler(a.telegramHandler))
+		// POST /profile/telegram/link
+		log.Info().Msg("register route POST /profile/telegram/link")
+		r.Post("/profile/telegram/link", a.routerHandler(a.telegramLinkHandler))
+		// DELETE /profile/telegram
+		log.Info().Msg("register route DELETE /profile/telegram")
+		r.Delete("/profile/telegram", a.routerHandler(a.telegramUnlinkHandler))
+		// GET /profile/sessions
+		log.Info().Msg("register route GET /profile/sessions")
+		r.Get("/profile/sessions", a.routerHandler(a.sessionsHandler))
+		// DELETE /profile/sessions/{id}
+		log.Info().Msg("register route DELETE /profile/sessions/{id}")
+		r.Delete("/profile/sessions/{id}", a.routerHandler(a.deleteSessionHandler))
+		// GET /profile/terms
+		log.Info().Msg("register route GET /profile/terms")
+		r.Get("/profile/terms", a.routerHandler(a.profileTermsHandler))
+		// POST /profile/accept-terms
+		log.Info().Msg("register route POST /profile/accept-terms")
+		r.Post("/profile/accept-terms", a.routerHandler(a.acceptTermsHandler))
+
+		// Community boards
+		// POST /communities/{id}/posts
+		log.Info().Msg("register route POST /communities/{id}/posts")
+		r.Post("/communities/{id}/posts", a.routerHandler(a.createPostHandler))
+		// GET /communities/{id}/posts
+		log.Info().Msg("register route GET /communities/{id}/posts")
+		r.Get("/communities/{id}/posts", a.routerHandler(a.postsHandler))
+		// GET /communities/{id}/posts/{postId}
+		log.Info().Msg("register route GET /communities/{id}/posts/{postId}")
+		r.Get("/communities/{id}/posts/{postId}", a.routerHandler(a.postHandler))
+		// POST /communities/{id}/posts/{postId}/pin
+		log.Info().Msg("register route POST /communities/{id}/posts/{postId}/pin")
+		r.Post("/communities/{id}/posts/{postId}/pin", a.routerHandler(a.pinPostHandler))
+		// DELETE /communities/{id}/posts/{postId}/pin
+		log.Info().Msg("register route DELETE /communities/{id}/posts/{postId}/pin")
+		r.Delete("/communities/{id}/posts/{postId}/pin", a.routerHandler(a.unpinPostHandler))
+		// POST /communities/{id}/posts/{postId}/comments
+		log.Info().Msg("register route POST /communities/{id}/posts/{postId}/comments")
+		r.Post("/communities/{id}/posts/{postId}/comments", a.routerHandler(a.createCommentHandler))
+		// GET /communities/{id}/posts/{postId}/comments
+		log.Info().Msg("register route GET /communities/{id}/posts/{postId}/comments")
+		r.Get("/communities/{id}/posts/{postId}/comments", a.routerHandler(a.commentsHandler))
+		// POST /communities/{id}/crowdfunds
+		log.Info().Msg("register route POST /communities/{id}/crowdfunds")
+		r.Post("/communities/{id}/crowdfunds", a.routerHandler(a.createCrowdfundHandler))
+		// GET /communities/{id}/crowdfunds
+		log.Info().Msg("register route GET /communities/{id}/crowdfunds")
+		r.Get("/communities/{id}/crowdfunds", a.routerHandler(a.crowdfundsHandler))
+		// GET /communities/{id}/crowdfunds/{crowdfundId}
+		log.Info().Msg("register route GET /communities/{id}/crowdfunds/{crowdfundId}")
+		r.Get("/communities/{id}/crowdfunds/{crowdfundId}", a.routerHandler(a.crowdfundHandler))
+		// POST /communities/{id}/crowdfunds/{crowdfundId}/pledge
+		log.Info().Msg("register route POST /communities/{id}/crowdfunds/{crowdfundId}/pledge")
+		r.Post("/communities/{id}/crowdfunds/{crowdfundId}/pledge", a.routerHandler(a.pledgeCrowdfundHandler))
+		// DELETE /communities/{id}/crowdfunds/{crowdfundId}/pledge
+		log.Info().Msg("register route DELETE /communities/{id}/crowdfunds/{crowdfundId}/pledge")
+		r.Delete("/communities/{id}/crowdfunds/{crowdfundId}/pledge", a.routerHandler(a.withdrawCrowdfundHandler))
+		// POST /communities/{id}/crowdfunds/{crowdfundId}/complete
+		log.Info().Msg("register route POST /communities/{id}/crowdfunds/{crowdfundId}/complete")
+		r.Post("/communities/{id}/crowdfunds/{crowdfundId}/complete", a.routerHandler(a.completeCrowdfundHandler))
+		// POST /communities/{id}/crowdfunds/{crowdfundId}/cancel
+		log.Info().Msg("register route POST /communities/{id}/crowdfunds/{crowdfundId}/cancel")
+		r.Post("/communities/{id}/crowdfunds/{crowdfundId}/cancel", a.routerHandler(a.cancelCrowdfundHandler))
+		// GET /communities/{id}/pool
+		log.Info().Msg("register route GET /communities/{id}/pool")
+		r.Get("/communities/{id}/pool", a.routerHandler(a.communityPoolHandler))
+		// PUT /communities/{id}/pool/fee
+		log.Info().Msg("register route PUT /communities/{id}/pool/fee")
+		r.Put("/communities/{id}/pool/fee", a.routerHandler(a.communityFeeHandler))
+		// POST /communities/{id}/pool/payouts
+		log.Info().Msg("register route POST /communities/{id}/pool/payouts")
+		r.Post("/communities/{id}/pool/payouts", a.routerHandler(a.communityPayoutHandler))
+		// GET /communities/{id}/pool/movements
+		log.Info().Msg("register route GET /communities/{id}/pool/movements")
+		r.Get("/communities/{id}/pool/movements", a.routerHandler(a.communityPoolMovementsHandler))
+		// GET /communities/{id}/tools/pending
+		log.Info().Msg("register route GET /communities/{id}/tools/pending")
+		r.Get("/communities/{id}/tools/pending", a.routerHandler(a.pendingCommunityToolsHandler))
+		// PUT /communities/{id}/tools/{toolId}/approve
+		log.Info().Msg("register route PUT /communities/{id}/tools/{toolId}/approve")
+		r.Put("/communities/{id}/tools/{toolId}/approve", a.routerHandler(a.approveCommunityToolHandler))
+		// PUT /communities/{id}/tools/{toolId}/reject
+		log.Info().Msg("register route PUT /communities/{id}/tools/{toolId}/reject")
+		r.Put("/communities/{id}/tools/{toolId}/reject", a.routerHandler(a.rejectCommunityToolHandler))
+		// GET /communities/{id}/bookings
+		log.Info().Msg("register route GET /communities/{id}/bookings")
+		r.Get("/communities/{id}/bookings", a.routerHandler(a.communityBookingsHandler))
+		log.Info().Msg("register route GET /communities/{id}/stats")
+		r.Get("/communities/{id}/stats", a.routerHandler(a.communityStatsHandler))
+		// POST /communities/{id}/library/tags
+		log.Info().Msg("register route POST /communities/{id}/library/tags")
+		r.Post("/communities/{id}/library/tags", a.routerHandler(a.libraryTagHandler))
+		// GET /communities/{id}/library/tags/{tag}
+		log.Info().Msg("register route GET /communities/{id}/library/tags/{tag}")
+		r.Get("/communities/{id}/library/tags/{tag}", a.routerHandler(a.libraryToolHandler))
+		// POST /communities/{id}/library/checkout
+		log.Info().Msg("register route POST /communities/{id}/library/checkout")
+		r.Post("/communities/{id}/library/checkout", a.routerHandler(a.libraryCheckoutHandler))
+		// POST /communities/{id}/library/checkin
+		log.Info().Msg("register route POST /communities/{id}/library/checkin")
+		r.Post("/communities/{id}/library/checkin", a.routerHandler(a.libraryCheckinHandler))
+
+		// Devices
+		// POST /profile/devices
+		log.Info().Msg("register route POST /profile/devices")
+		r.Post("/profile/devices", a.routerHandler(a.registerDeviceHandler))
+		// GET /profile/devices
+		log.Info().Msg("register route GET /profile/devices")
+		r.Get("/profile/devices", a.routerHandler(a.devicesHandler))
+		// DELETE /profile/devices/{id}
+		log.Info().Msg("register route DELETE /profile/devices/{id}")
+		r.Delete("/profile/devices/{id}", a.routerHandler(a.deleteDeviceHandler))
 
 		// Images
 		// GET /images/{hash}
 		log.Info().Msg("register route GET /images/{hash}")
-		r.Get("/images/{hash}", a.routerHandler(a.imageHandler))
+		r.Get("/images/{hash}", a.routerHandler(versioned(a.imageHandler, map[int]ResponseAdapter{
+			APIVersion2: binaryImageV2,
+		})))
 		// POST /images
 		log.Info().Msg("register route POST /images")
-		r.Post("/images", a.routerHandler(a.imageUploadHandler))
+		r.Post("/images", a.routerHandler(a.idempotent(a.imageUploadHandler)))
+		// GET /media/{hash}
+		log.Info().Msg("register route GET /media/{hash}")
+		r.Get("/media/{hash}", a.routerHandler(a.mediaHandler))
 
 		// Tools
 		// GET /tools
@@ -99,6 +660,18 @@ func (a *API) router() http.Handler {
 		// GET /tools/search
 		log.Info().Msg("register route GET /tools/search")
 		r.Get("/tools/search", a.routerHandler(a.toolSearchHandler))
+		// GET /tools/search/facets
+		log.Info().Msg("register route GET /tools/search/facets")
+		r.Get("/tools/search/facets", a.routerHandler(a.toolSearchFacetsHandler))
+		// GET /tools/map
+		log.Info().Msg("register route GET /tools/map")
+		r.Get("/tools/map", a.routerHandler(a.toolMapHandler))
+		// GET /tools/registry
+		log.Info().Msg("register route GET /tools/registry")
+		r.Get("/tools/registry", a.routerHandler(a.toolRegistryHandler))
+		// GET /tools/export
+		log.Info().Msg("register route GET /tools/export")
+		r.Get("/tools/export", a.routerHandler(a.exportToolsHandler))
 		// GET /tools/user/{id}
 		log.Info().Msg("register route GET /tools/user/{id}")
 		r.Get("/tools/user/{id}", a.routerHandler(a.userToolsHandler))
@@ -107,18 +680,93 @@ func (a *API) router() http.Handler {
 		r.Get("/tools/{id}", a.routerHandler(a.toolHandler))
 		// POST /tools
 		log.Info().Msg("register route POST /tools")
-		r.Post("/tools", a.routerHandler(a.addToolHandler))
+		r.Post("/tools", a.routerHandler(a.idempotent(a.addToolHandler)))
+		// POST /tools/import
+		log.Info().Msg("register route POST /tools/import")
+		r.Post("/tools/import", a.routerHandler(a.importToolsHandler))
 		// PUT /tools/{id}
 		log.Info().Msg("register route PUT /tools/{id}")
 		r.Put("/tools/{id}", a.routerHandler(a.editToolHandler))
 		// DELETE /tools/{id}
 		log.Info().Msg("register route DELETE /tools/{id}")
 		r.Delete("/tools/{id}", a.routerHandler(a.deleteToolHandler))
+		// POST /tools/{id}/media
+		log.Info().Msg("register route POST /tools/{id}/media")
+		r.Post("/tools/{id}/media", a.routerHandler(a.uploadToolMediaHandler))
+		// DELETE /tools/{id}/media/{hash}
+		log.Info().Msg("register route DELETE /tools/{id}/media/{hash}")
+		r.Delete("/tools/{id}/media/{hash}", a.routerHandler(a.deleteToolMediaHandler))
+		// GET /tools/{id}/suggested-dates
+		log.Info().Msg("register route GET /tools/{id}/suggested-dates")
+		r.Get("/tools/{id}/suggested-dates", a.routerHandler(a.suggestedDatesHandler))
+		// POST /tools/{id}/waitlist
+		log.Info().Msg("register route POST /tools/{id}/waitlist")
+		r.Post("/tools/{id}/waitlist", a.routerHandler(a.joinWaitlistHandler))
+		// DELETE /tools/{id}/waitlist
+		log.Info().Msg("register route DELETE /tools/{id}/waitlist")
+		r.Delete("/tools/{id}/waitlist", a.routerHandler(a.leaveWaitlistHandler))
+		// GET /tools/{id}/managers
+		log.Info().Msg("register route GET /tools/{id}/managers")
+		r.Get("/tools/{id}/managers", a.routerHandler(a.toolManagersHandler))
+		// POST /tools/{id}/managers
+		log.Info().Msg("register route POST /tools/{id}/managers")
+		r.Post("/tools/{id}/managers", a.routerHandler(a.addToolManagerHandler))
+		// DELETE /tools/{id}/managers/{userId}
+		log.Info().Msg("register route DELETE /tools/{id}/managers/{userId}")
+		r.Delete("/tools/{id}/managers/{userId}", a.routerHandler(a.removeToolManagerHandler))
+		// POST /tools/{id}/transfer
+		log.Info().Msg("register route POST /tools/{id}/transfer")
+		r.Post("/tools/{id}/transfer", a.routerHandler(a.transferToolHandler))
+		// GET /transfers
+		log.Info().Msg("register route GET /transfers")
+		r.Get("/transfers", a.routerHandler(a.transfersHandler))
+		// POST /transfers/{id}/accept
+		log.Info().Msg("register route POST /transfers/{id}/accept")
+		r.Post("/transfers/{id}/accept", a.routerHandler(a.acceptTransferHandler))
+		// POST /transfers/{id}/reject
+		log.Info().Msg("register route POST /transfers/{id}/reject")
+		r.Post("/transfers/{id}/reject", a.routerHandler(a.rejectTransferHandler))
+		// POST /transfers/{id}/cancel
+		log.Info().Msg("register route POST /transfers/{id}/cancel")
+		r.Post("/transfers/{id}/cancel", a.routerHandler(a.cancelTransferHandler))
+		// GET /tools/{id}/quote
+		log.Info().Msg("register route GET /tools/{id}/quote")
+		r.Get("/tools/{id}/quote", a.routerHandler(a.quoteHandler))
+		// GET /tools/{id}/maintenance
+		log.Info().Msg("register route GET /tools/{id}/maintenance")
+		r.Get("/tools/{id}/maintenance", a.routerHandler(a.maintenanceLogHandler))
+		// POST /tools/{id}/maintenance
+		log.Info().Msg("register route POST /tools/{id}/maintenance")
+		r.Post("/tools/{id}/maintenance", a.routerHandler(a.addMaintenanceHandler))
+		// DELETE /tools/{id}/maintenance
+		log.Info().Msg("register route DELETE /tools/{id}/maintenance")
+		r.Delete("/tools/{id}/maintenance", a.routerHandler(a.endMaintenanceHandler))
+		// GET /tools/{id}/valuations
+		log.Info().Msg("register route GET /tools/{id}/valuations")
+		r.Get("/tools/{id}/valuations", a.routerHandler(a.toolValuationsHandler))
+		// POST /tools/{id}/valuations/depreciate
+		log.Info().Msg("register route POST /tools/{id}/valuations/depreciate")
+		r.Post("/tools/{id}/valuations/depreciate", a.routerHandler(a.depreciateToolHandler))
+		// POST /tools/{id}/publish
+		log.Info().Msg("register route POST /tools/{id}/publish")
+		r.Post("/tools/{id}/publish", a.routerHandler(a.publishToolHandler))
+		// POST /tools/{id}/report
+		log.Info().Msg("register route POST /tools/{id}/report")
+		r.Post("/tools/{id}/report", a.routerHandler(a.reportToolHandler))
+		// DELETE /tools/{id}/report
+		log.Info().Msg("register route DELETE /tools/{id}/report")
+		r.Delete("/tools/{id}/report", a.routerHandler(a.recoverToolHandler))
+		// POST /tools/{id}/favorite
+		log.Info().Msg("register route POST /tools/{id}/favorite")
+		r.Post("/tools/{id}/favorite", a.routerHandler(a.addFavoriteHandler))
+		// DELETE /tools/{id}/favorite
+		log.Info().Msg("register route DELETE /tools/{id}/favorite")
+		r.Delete("/tools/{id}/favorite", a.routerHandler(a.removeFavoriteHandler))
 
 		// Bookings
 		// POST /bookings
 		log.Info().Msg("register route POST /bookings")
-		r.Post("/bookings", a.routerHandler(func(r *Request) (interface{}, error) {
+		r.Post("/bookings", a.routerHandler(a.idempotent(func(r *Request) (interface{}, error) {
 			if r.UserID == "" {
 				return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
 			}
@@ -141,52 +789,145 @@ func (a *API) router() http.Handler {
 			if tool == nil {
 				return nil, ErrToolNotFound.WithErr(fmt.Errorf("tool with id %d not found", toolID))
 			}
+			if db.IsValidReportStatus(tool.Status) {
+				return nil, ErrToolReported.WithErr(fmt.Errorf("tool with id %d is %s", toolID, tool.Status))
+			}
 
 			// Get user IDs from database
-			fromUser, err := a.getUserByID(r.UserID)
+			subject, err := a.subject(r.UserID)
 			if err != nil {
-				return nil, ErrUserNotFound.WithErr(err)
+				return nil, err
 			}
 
-			toUser, err := a.database.UserService.GetUserByID(r.Context.Request.Context(), tool.UserID)
+			// Verify the user is allowed to book the tool
+			toUser, err := a.authorizeToolBooking(subject, tool)
+			if err != nil {
+				return nil, err
+			}
+			origin, err := parseBookingOrigin(req.Origin)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkMaintenance(tool, time.Unix(req.StartDate, 0), time.Unix(req.EndDate, 0)); err != nil {
+				return nil, err
+			}
+			if err := checkAvailability(tool, time.Unix(req.StartDate, 0), time.Unix(req.EndDate, 0)); err != nil {
+				return nil, err
+			}
+			terms, err := acceptedTerms(tool, req.AcceptedTermsVersion)
 			if err != nil {
-				return nil, ErrUserNotFound.WithErr(fmt.Errorf("tool owner not found: %w", err))
+				return nil, err
+			}
+			price, err := bookingPrice(tool, time.Unix(req.StartDate, 0), time.Unix(req.EndDate, 0), req.Amount)
+			if err != nil {
+				return nil, err
 			}
 
 			// Convert tool ID to string
 			toolIDStr := fmt.Sprintf("%d", tool.ID)
 
+			// Only the renter and the owner, notified of the request, can be mentioned
+			commentRefs := a.messageRefs(r.Context.Request.Context(), req.Comments, subject, participant(subject.ID, toUser.ID))
+
 			// Create booking request
 			dbReq := &db.CreateBookingRequest{
-				ToolID:    toolIDStr,
-				StartDate: time.Unix(req.StartDate, 0),
-				EndDate:   time.Unix(req.EndDate, 0),
-				Contact:   req.Contact,
-				Comments:  req.Comments,
+				ToolID:        toolIDStr,
+				StartDate:     time.Unix(req.StartDate, 0),
+				EndDate:       time.Unix(req.EndDate, 0),
+				Contact:       req.Contact,
+				Comments:      req.Comments,
+				CommentRefs:   commentRefs,
+				Origin:        origin,
+				Community:     tool.Community,
+				AcceptedTerms: terms,
+				PricingMode:   tool.Pricing(),
+				Price:         &price,
+				// The renter agrees to the cancellation policy of the tool with the request
+				CancellationPolicy: tool.Cancellation(),
 			}
 
-			booking, err := a.database.BookingService.Create(r.Context.Request.Context(), dbReq, fromUser.ObjectID(), toUser.ID)
+			booking, err := a.database.BookingService.Create(r.Context.Request.Context(), dbReq, subject.ID, toUser.ID)
+			if err == db.ErrBookingDatesConflict {
+				return nil, ErrBookingDatesConflict.WithErr(fmt.Errorf("join the waitlist with POST /tools/%d/waitlist", tool.ID))
+			}
 			if err != nil {
 				return nil, err
 			}
+			// The requests matching the auto-accept rules of the tool are accepted right away, then
+			// the owner and the managers are informed of the booking instead of asked to answer it
+			notification := &db.Notification{
+				Type:      db.NotificationBookingRequest,
+				Message:   fmt.Sprintf("New booking request for %s", tool.Title),
+				ToolID:    tool.ID,
+				BookingID: booking.ID,
+			}
+			if a.autoAcceptBooking(r, tool, booking, subject) {
+				notification.Type = db.NotificationBookingStatus
+				notification.Message = fmt.Sprintf("New booking of %s accepted by its auto-accept rules", tool.Title)
+				if booking, err = a.database.BookingService.Get(r.Context.Request.Context(), booking.ID); err != nil {
+					return nil, ErrInternalServerError.WithErr(err)
+				}
+			}
+			// The managers of the tool can also answer the request
+			for _, userID := range append([]primitive.ObjectID{toUser.ID}, tool.Managers...) {
+				n := *notification
+				n.UserID = userID
+				a.notify(r.Context.Request.Context(), &n)
+			}
 
 			return convertBookingToResponse(booking), nil
-		}))
+		})))
 		// GET /bookings/requests
 		log.Info().Msg("register route GET /bookings/requests")
-		r.Get("/bookings/requests", a.routerHandler(a.HandleGetBookingRequests))
+		r.Get("/bookings/requests", a.routerHandler(versioned(a.HandleGetBookingRequests, map[int]ResponseAdapter{
+			APIVersion2: bookingListV2,
+		})))
 		// GET /bookings/petitions
 		log.Info().Msg("register route GET /bookings/petitions")
-		r.Get("/bookings/petitions", a.routerHandler(a.HandleGetBookingPetitions))
+		r.Get("/bookings/petitions", a.routerHandler(versioned(a.HandleGetBookingPetitions, map[int]ResponseAdapter{
+			APIVersion2: bookingListV2,
+		})))
+		// PUT /bookings/batch
+		log.Info().Msg("register route PUT /bookings/batch")
+		r.Put("/bookings/batch", a.routerHandler(a.HandleBatchBookings))
 		// GET /bookings/pendings
 		log.Info().Msg("register route GET /bookings/pendings")
 		r.Get("/bookings/pendings", a.routerHandler(a.HandleCountPendingActions))
 		// GET /bookings/{bookingId}
 		log.Info().Msg("register route GET /bookings/{bookingId}")
 		r.Get("/bookings/{bookingId}", a.routerHandler(a.HandleGetBooking))
+		// GET /bookings/{bookingId}/history
+		log.Info().Msg("register route GET /bookings/{bookingId}/history")
+		r.Get("/bookings/{bookingId}/history", a.routerHandler(a.HandleGetBookingHistory))
+		log.Info().Msg("register route GET /bookings/{bookingId}/messages")
+		r.Get("/bookings/{bookingId}/messages", a.routerHandler(a.bookingMessagesHandler))
 		// POST /bookings/{bookingId}/return
 		log.Info().Msg("register route POST /bookings/{bookingId}/return")
 		r.Post("/bookings/{bookingId}/return", a.routerHandler(a.HandleReturnBooking))
+		// POST /bookings/{bookingId}/disagreement
+		log.Info().Msg("register route POST /bookings/{bookingId}/disagreement")
+		r.Post("/bookings/{bookingId}/disagreement", a.routerHandler(a.HandleOpenDisagreement))
+		// POST /bookings/{bookingId}/disagreement/resolve
+		log.Info().Msg("register route POST /bookings/{bookingId}/disagreement/resolve")
+		r.Post("/bookings/{bookingId}/disagreement/resolve", a.routerHandler(a.HandleResolveDisagreement))
+		// POST /bookings/{bookingId}/archive
+		log.Info().Msg("register route POST /bookings/{bookingId}/archive")
+		r.Post("/bookings/{bookingId}/archive", a.routerHandler(a.HandleArchiveBooking))
+		// DELETE /bookings/{bookingId}/archive
+		log.Info().Msg("register route DELETE /bookings/{bookingId}/archive")
+		r.Delete("/bookings/{bookingId}/archive", a.routerHandler(a.HandleUnarchiveBooking))
+		// POST /bookings/archive
+		log.Info().Msg("register route POST /bookings/archive")
+		r.Post("/bookings/archive", a.routerHandler(a.HandleArchiveBookings))
+		// GET /bookings/{bookingId}/agreement.pdf
+		log.Info().Msg("register route GET /bookings/{bookingId}/agreement.pdf")
+		r.Get("/bookings/{bookingId}/agreement.pdf", a.routerHandler(a.bookingAgreementHandler))
+		// POST /bookings/{bookingId}/payment
+		log.Info().Msg("register route POST /bookings/{bookingId}/payment")
+		r.Post("/bookings/{bookingId}/payment", a.routerHandler(a.HandleCreatePayment))
+		// POST /bookings/{bookingId}/payment/paid
+		log.Info().Msg("register route POST /bookings/{bookingId}/payment/paid")
+		r.Post("/bookings/{bookingId}/payment/paid", a.routerHandler(a.HandleMarkPaymentPaid))
 		// GET /bookings/rates
 		log.Info().Msg("register route GET /bookings/rates")
 		r.Get("/bookings/rates", a.routerHandler(a.HandleGetPendingRatings))
@@ -195,7 +936,9 @@ func (a *API) router() http.Handler {
 		r.Post("/bookings/rates", a.routerHandler(a.HandleRateBooking))
 		// GET /bookings/user/{id}
 		log.Info().Msg("register route GET /bookings/user/{id}")
-		r.Get("/bookings/user/{id}", a.routerHandler(a.HandleGetUserBookings))
+		r.Get("/bookings/user/{id}", a.routerHandler(versioned(a.HandleGetUserBookings, map[int]ResponseAdapter{
+			APIVersion2: bookingPageV2,
+		})))
 
 		// New booking endpoints
 		// POST /bookings/petitions/{petitionId}/accept
@@ -207,6 +950,53 @@ func (a *API) router() http.Handler {
 		// POST /bookings/request/{petitionId}/cancel
 		log.Info().Msg("register route POST /bookings/request/{petitionId}/cancel")
 		r.Post("/bookings/request/{petitionId}/cancel", a.routerHandler(a.HandleCancelRequest))
+
+		// Admin
+		// GET /admin/tools
+		log.Info().Msg("register route GET /admin/tools")
+		r.Get("/admin/tools", a.routerHandler(a.adminToolsHandler))
+		// GET /admin/analytics/origins
+		log.Info().Msg("register route GET /admin/analytics/origins")
+		r.Get("/admin/analytics/origins", a.routerHandler(a.adminOriginAttributionHandler))
+		// GET /admin/images/usage
+		log.Info().Msg("register route GET /admin/images/usage")
+		r.Get("/admin/images/usage", a.routerHandler(a.adminImageUsageHandler))
+		// GET /admin/invites
+		log.Info().Msg("register route GET /admin/invites")
+		r.Get("/admin/invites", a.routerHandler(a.adminInviteTreeHandler))
+		// GET /admin/recoveries
+		log.Info().Msg("register route GET /admin/recoveries")
+		r.Get("/admin/recoveries", a.routerHandler(a.adminRecoveriesHandler))
+		// GET /admin/audit
+		log.Info().Msg("register route GET /admin/audit")
+		r.Get("/admin/audit", a.routerHandler(a.adminAuditLogHandler))
+		// GET /admin/audit/export
+		log.Info().Msg("register route GET /admin/audit/export")
+		r.Get("/admin/audit/export", a.routerHandler(a.adminAuditExportHandler))
+		// PUT /admin/users/{id}/role
+		log.Info().Msg("register route PUT /admin/users/{id}/role")
+		r.Put("/admin/users/{id}/role", a.routerHandler(a.adminSetRoleHandler))
+		// PUT /admin/users/{id}/blocked
+		log.Info().Msg("register route PUT /admin/users/{id}/blocked")
+		r.Put("/admin/users/{id}/blocked", a.routerHandler(a.adminBlockUserHandler))
+		// PUT /admin/users/{id}/community
+		log.Info().Msg("register route PUT /admin/users/{id}/community")
+		r.Put("/admin/users/{id}/community", a.routerHandler(a.adminSetCommunityHandler))
+		// GET /admin/terms
+		log.Info().Msg("register route GET /admin/terms")
+		r.Get("/admin/terms", a.routerHandler(a.adminTermsHandler))
+		// POST /admin/terms
+		log.Info().Msg("register route POST /admin/terms")
+		r.Post("/admin/terms", a.routerHandler(a.adminPublishTermsHandler))
+		// POST /admin/mail/test
+		log.Info().Msg("register route POST /admin/mail/test")
+		r.Post("/admin/mail/test", a.routerHandler(a.adminTestMailHandler))
+		// POST /admin/recoveries/{id}/approve
+		log.Info().Msg("register route POST /admin/recoveries/{id}/approve")
+		r.Post("/admin/recoveries/{id}/approve", a.routerHandler(a.approveRecoveryHandler))
+		// POST /admin/recoveries/{id}/reject
+		log.Info().Msg("register route POST /admin/recoveries/{id}/reject")
+		r.Post("/admin/recoveries/{id}/reject", a.routerHandler(a.rejectRecoveryHandler))
 	})
 
 	// Public routes
@@ -216,19 +1006,52 @@ func (a *API) router() http.Handler {
 				log.Error().Err(err).Msg("failed to write response")
 			}
 		})
+		log.Info().Msg("register route GET /healthz")
+		r.Get("/healthz", a.healthzHandler)
+		log.Info().Msg("register route GET /readyz")
+		r.Get("/readyz", a.readyzHandler)
 		log.Info().Msg("register route POST /login")
 		r.Post("/login", a.routerHandler(a.loginHandler))
 		log.Info().Msg("register route POST /register")
 		r.Post("/register", a.routerHandler(a.registerHandler))
+		log.Info().Msg("register route POST /recovery")
+		r.Post("/recovery", a.routerHandler(a.recoveryRequestHandler))
+		log.Info().Msg("register route POST /recovery/{id}/complete")
+		r.Post("/recovery/{id}/complete", a.routerHandler(a.recoveryCompleteHandler))
+		log.Info().Msg("register route GET /digest/unsubscribe")
+		r.Get("/digest/unsubscribe", a.routerHandler(a.digestUnsubscribeHandler))
+		log.Info().Msg("register route POST /telegram/webhook")
+		r.Post("/telegram/webhook", a.routerHandler(a.telegramWebhookHandler))
+		log.Info().Msg("register route POST /mail/inbound")
+		r.Post("/mail/inbound", a.routerHandler(a.inboundMailHandler))
+		log.Info().Msg("register route POST /payments/webhook")
+		r.Post("/payments/webhook", a.routerHandler(a.paymentWebhookHandler))
 		log.Info().Msg("register route GET /info")
 		r.Get("/info", a.routerHandler(a.infoHandler))
+		log.Info().Msg("register route GET /info/stats")
+		r.Get("/info/stats", a.routerHandler(a.publicStatsHandler))
+		log.Info().Msg("register route GET /info/password-policy")
+		r.Get("/info/password-policy", a.routerHandler(a.passwordPolicyHandler))
+		log.Info().Msg("register route GET /info/transports")
+		r.Get("/info/transports", a.routerHandler(a.transportsHandler))
+		log.Info().Msg("register route GET /info/terms")
+		r.Get("/info/terms", a.routerHandler(a.termsHandler))
+		// Avatars are public so they can be used as image sources
+		log.Info().Msg("register route GET /users/{id}/avatar")
+		r.Get("/users/{id}/avatar", a.routerHandler(a.avatarHandler))
+		log.Info().Msg("register route GET /federation/tools/search")
+		r.Get("/federation/tools/search", a.routerHandler(a.federationSearchHandler))
 	})
-
-	return r
 }
 
-// info handler returns the basic info about the API.
+// info handler returns the basic info about the API. It is cached for the info cache TTL,
+// and invalidated by the tool writes.
 func (a *API) infoHandler(r *Request) (interface{}, error) {
+	return a.infoCache.get(a.info)
+}
+
+// info computes the GET /info response.
+func (a *API) info() (*Info, error) {
 	ctx := context.Background()
 
 	// Get user count
@@ -258,10 +1081,51 @@ func (a *API) infoHandler(r *Request) (interface{}, error) {
 	// Get categories
 	categories := a.toolCategories()
 
+	// Get the current terms, nil if none was published
+	terms, err := a.database.TermsService.Current(ctx)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(fmt.Errorf("failed to get the terms: %w", err))
+	}
+
 	return &Info{
-		Users:      int(userCount),
-		Tools:      int(toolCount),
-		Categories: categories,
-		Transports: transportList,
+		Users:          int(userCount),
+		Tools:          int(toolCount),
+		Categories:     categories,
+		Transports:     transportList,
+		VAPIDPublicKey: a.vapidPublicKey,
+		Search: &SearchSettings{
+			MapCenter:     a.mapCenter,
+			DefaultRadius: a.searchRadius,
+			MaxRadius:     a.maxSearchRadius,
+		},
+		Features: &Features{
+			AdminRecovery:         a.adminRecovery,
+			CommunityToolApproval: a.toolApproval,
+			Geocoding:             a.geocoder != nil,
+			Federation:            len(a.federationPeers) > 0,
+			WebPush:               a.vapidPublicKey != "",
+			Telegram:              a.telegram != nil,
+			EmailReplies:          a.inboundAddress != "",
+			InactiveAccounts:      a.inactivityPeriod > 0,
+			Payments:              a.payments != nil,
+		},
+		Limits: &Limits{
+			MaxAvatarSize:     maxAvatarUploadSize,
+			MaxMediaSize:      maxMediaUploadSize,
+			MaxImageDimension: maxImageDimension,
+			MaxToolMedia:      maxToolMedia,
+			DefaultPageSize:   db.DefaultPageSize,
+			MaxPageSize:       db.MaxPageSize,
+			MaxBatchIDs:       maxBatchIDs,
+			MaxMessageLength:  maxMessageLength,
+			MaxSavedSearches:  maxSavedSearchesPerUser,
+		},
+		PasswordPolicy: &a.passwordPolicy,
+		Terms:          terms,
+		Version: &VersionInfo{
+			Server:      Version,
+			APIVersions: []int{APIVersion1, APIVersion2},
+			LatestAPI:   LatestAPIVersion,
+		},
 	}, nil
 }
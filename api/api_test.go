@@ -93,7 +93,7 @@ func testAPI(t *testing.T) *API {
 	err = database.CreateTables()
 	qt.Assert(t, err, qt.IsNil)
 
-	return New("secret", "authtoken", database)
+	return New("secret", "authtoken", database, nil)
 }
 
 func TestBookingDateConflicts(t *testing.T) {
@@ -141,7 +141,7 @@ func TestBookingDateConflicts(t *testing.T) {
 	qt.Assert(t, err, qt.IsNil)
 
 	// Accept first booking
-	err = a.database.BookingService.UpdateStatus(context.Background(), createdBooking1.ID, db.BookingStatusAccepted)
+	err = a.database.BookingService.UpdateStatus(context.Background(), createdBooking1.ID, db.BookingStatusAccepted, user1.ID, "")
 	qt.Assert(t, err, qt.IsNil)
 
 	// Try to create third booking for same dates (should fail since there's an accepted booking)
@@ -156,7 +156,7 @@ func TestBookingDateConflicts(t *testing.T) {
 	qt.Assert(t, err, qt.ErrorMatches, db.ErrBookingDatesConflict.Error())
 
 	// Verify the second booking can still be accepted or rejected
-	err = a.database.BookingService.UpdateStatus(context.Background(), createdBooking2.ID, db.BookingStatusRejected)
+	err = a.database.BookingService.UpdateStatus(context.Background(), createdBooking2.ID, db.BookingStatusRejected, user1.ID, "")
 	qt.Assert(t, err, qt.IsNil)
 }
 
@@ -199,18 +199,18 @@ func TestBookingStatusTransitions(t *testing.T) {
 	qt.Assert(t, createdBooking.ToolID, qt.Equals, toolIDStr)
 
 	// Get bookings through API endpoints to verify toolId in responses
-	bookings, err := a.database.BookingService.GetUserRequests(context.Background(), user1.ID)
+	bookings, err := a.database.BookingService.GetUserRequests(context.Background(), user1.ID, nil)
 	qt.Assert(t, err, qt.IsNil)
 	qt.Assert(t, len(bookings), qt.Equals, 1)
 	qt.Assert(t, bookings[0].ToolID, qt.Equals, toolIDStr)
 
-	bookings, err = a.database.BookingService.GetUserPetitions(context.Background(), user2.ID)
+	bookings, err = a.database.BookingService.GetUserPetitions(context.Background(), user2.ID, nil)
 	qt.Assert(t, err, qt.IsNil)
 	qt.Assert(t, len(bookings), qt.Equals, 1)
 	qt.Assert(t, bookings[0].ToolID, qt.Equals, toolIDStr)
 
 	// Test accepting a petition
-	err = a.database.BookingService.UpdateStatus(context.Background(), createdBooking.ID, db.BookingStatusAccepted)
+	err = a.database.BookingService.UpdateStatus(context.Background(), createdBooking.ID, db.BookingStatusAccepted, user1.ID, "")
 	qt.Assert(t, err, qt.IsNil)
 
 	// Verify booking status
@@ -230,7 +230,7 @@ func TestBookingStatusTransitions(t *testing.T) {
 	qt.Assert(t, err, qt.IsNil)
 
 	// Test denying a petition
-	err = a.database.BookingService.UpdateStatus(context.Background(), createdBooking2.ID, db.BookingStatusRejected)
+	err = a.database.BookingService.UpdateStatus(context.Background(), createdBooking2.ID, db.BookingStatusRejected, user1.ID, "")
 	qt.Assert(t, err, qt.IsNil)
 
 	// Verify booking status
@@ -250,7 +250,7 @@ func TestBookingStatusTransitions(t *testing.T) {
 	qt.Assert(t, err, qt.IsNil)
 
 	// Test canceling a request
-	err = a.database.BookingService.UpdateStatus(context.Background(), createdBooking3.ID, db.BookingStatusCancelled)
+	err = a.database.BookingService.UpdateStatus(context.Background(), createdBooking3.ID, db.BookingStatusCancelled, user2.ID, "")
 	qt.Assert(t, err, qt.IsNil)
 
 	// Verify booking status
@@ -263,8 +263,9 @@ func TestHTTPErrorWithErr(t *testing.T) {
 	c := qt.New(t)
 
 	baseErr := &HTTPError{
-		Code:    400,
-		Message: "base error",
+		Code:      400,
+		ErrorCode: "test.base",
+		Message:   "base error",
 	}
 
 	specificErr := fmt.Errorf("specific error details")
@@ -273,6 +274,24 @@ func TestHTTPErrorWithErr(t *testing.T) {
 
 	c.Assert(resultErr.Message, qt.Equals, "base error: specific error details")
 	c.Assert(resultErr.Code, qt.Equals, 400)
+	c.Assert(resultErr.ErrorCode, qt.Equals, "test.base")
+	c.Assert(baseErr.IsErr(resultErr), qt.IsTrue)
+	c.Assert(ErrInternalServerError.IsErr(resultErr), qt.IsFalse)
+}
+
+func TestLoginLockoutDuration(t *testing.T) {
+	c := qt.New(t)
+	a := &API{loginLockout: 5 * time.Minute}
+
+	c.Assert(a.loginLockoutDuration(0), qt.Equals, 5*time.Minute)
+	c.Assert(a.loginLockoutDuration(1), qt.Equals, 10*time.Minute)
+	c.Assert(a.loginLockoutDuration(3), qt.Equals, 40*time.Minute)
+	c.Assert(a.loginLockoutDuration(100), qt.Equals, maxLoginLockout)
+
+	// The details of the error are kept when appending a message
+	err := ErrLoginLocked.WithData(&LoginLocked{}).WithErr(fmt.Errorf("details"))
+	c.Assert(err.Data, qt.DeepEquals, &LoginLocked{})
+	c.Assert(ErrLoginLocked.Data, qt.IsNil)
 }
 
 func TestImageErrors(t *testing.T) {
@@ -304,3 +323,60 @@ func TestImage(t *testing.T) {
 	qt.Assert(t, err, qt.IsNil)
 	qt.Assert(t, image.Content, qt.DeepEquals, pngImageForTest())
 }
+
+func TestRetainInactiveAccounts(t *testing.T) {
+	a := testAPI(t)
+	a.inactivityPeriod = 24 * time.Hour
+	a.inactivityGrace = time.Hour
+	ctx := context.Background()
+	now := time.Now()
+
+	owner, renter := testUser1, testUser2
+	_, err := a.addUser(&owner)
+	qt.Assert(t, err, qt.IsNil)
+	user1, err := a.database.UserService.GetUserByEmail(ctx, owner.Email)
+	qt.Assert(t, err, qt.IsNil)
+	_, err = a.addUser(&renter)
+	qt.Assert(t, err, qt.IsNil)
+	user2, err := a.database.UserService.GetUserByEmail(ctx, renter.Email)
+	qt.Assert(t, err, qt.IsNil)
+	_, err = a.addTool(&testTool1, user1.ID.Hex())
+	qt.Assert(t, err, qt.IsNil)
+
+	qt.Assert(t, a.database.UserService.TouchActivity(ctx, user1.ID, now.Add(-48*time.Hour)), qt.IsNil)
+	qt.Assert(t, a.database.UserService.TouchActivity(ctx, user2.ID, now), qt.IsNil)
+
+	// The inactive user is warned first
+	qt.Assert(t, a.retainInactiveAccounts(ctx), qt.IsNil)
+	user1, err = a.database.UserService.GetUserByID(ctx, user1.ID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, user1.InactivityWarnedAt, qt.IsNotNil)
+	qt.Assert(t, user1.DeletedAt, qt.IsNil)
+	user2, err = a.database.UserService.GetUserByID(ctx, user2.ID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, user2.InactivityWarnedAt, qt.IsNil)
+
+	// Any activity cancels the warning
+	qt.Assert(t, a.database.UserService.TouchActivity(ctx, user1.ID, now), qt.IsNil)
+	user1, err = a.database.UserService.GetUserByID(ctx, user1.ID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, user1.InactivityWarnedAt, qt.IsNil)
+	rating := user1.Rating
+
+	// Once the grace period is over the account is anonymized, keeping its rating
+	qt.Assert(t, a.database.UserService.TouchActivity(ctx, user1.ID, now.Add(-48*time.Hour)), qt.IsNil)
+	qt.Assert(t, a.database.UserService.SetInactivityWarned(ctx, user1.ID, now.Add(-2*time.Hour)), qt.IsNil)
+	qt.Assert(t, a.retainInactiveAccounts(ctx), qt.IsNil)
+	user1, err = a.database.UserService.GetUserByID(ctx, user1.ID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, user1.DeletedAt, qt.IsNotNil)
+	qt.Assert(t, user1.Email, qt.Not(qt.Equals), owner.Email)
+	qt.Assert(t, user1.Rating, qt.Equals, rating)
+	tools, err := a.database.ToolService.GetToolsByUserID(ctx, user1.ID)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, tools, qt.HasLen, 0)
+	entries, total, err := a.database.AuditLogService.Query(ctx, db.AuditQuery{Action: db.AuditAccountAnonymize})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, total, qt.Equals, int64(1))
+	qt.Assert(t, entries[0].TargetID, qt.Equals, user1.ID.Hex())
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// audit appends the sensitive action of the request to the audit log. The actor defaults to
+// the authenticated user. A failure to record it is logged but does not fail the request.
+func (a *API) audit(r *Request, entry *db.AuditEntry) {
+	if entry.ActorID.IsZero() && r.UserID != "" {
+		if id, err := primitive.ObjectIDFromHex(r.UserID); err == nil {
+			entry.ActorID = id
+		}
+	}
+	entry.IP = clientIP(r.Context.Request.RemoteAddr)
+	if err := a.database.AuditLogService.Record(r.Context.Request.Context(), entry); err != nil {
+		log.Error().Err(err).Msgf("could not record %s in the audit log", entry.Action)
+	}
+}
+
+// clientIP returns the IP of a remote address. With the trustProxy option it is the client
+// address forwarded by the reverse proxy.
+func clientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// adminAuditLogHandler handles GET /admin/audit?actor=&action=&target=&from=&to=&page=&pageSize=
+// Returns a page of the audit log entries matching the filters, the newest first. The from and
+// to dates are unix timestamps.
+func (a *API) adminAuditLogHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	query, err := parseAuditQuery(r.Context)
+	if err != nil {
+		return nil, err
+	}
+	entries, total, err := a.database.AuditLogService.Query(r.Context.Request.Context(), *query)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &AuditLogWrapper{
+		Entries:  entries,
+		Total:    total,
+		Page:     query.Page,
+		PageSize: db.PageSize(query.PageSize),
+	}, nil
+}
+
+// adminAuditExportHandler handles GET /admin/audit/export?actor=&action=&target=&from=&to=
+// Returns every audit log entry matching the filters as JSON lines, the oldest first. The
+// export is itself recorded in the audit log.
+func (a *API) adminAuditExportHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	query, err := parseAuditQuery(r.Context)
+	if err != nil {
+		return nil, err
+	}
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	if err := a.database.AuditLogService.Export(r.Context.Request.Context(), *query, func(entry *db.AuditEntry) error {
+		return encoder.Encode(entry)
+	}); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.audit(r, &db.AuditEntry{Action: db.AuditLogExport, Details: r.Context.Request.URL.RawQuery})
+	return &RawResponse{
+		ContentType: "application/x-ndjson",
+		Filename:    "emprius-audit.jsonl",
+		Data:        data.Bytes(),
+	}, nil
+}
+
+// adminSetRoleHandler handles PUT /admin/users/{id}/role
+// Grants the admin role to the user, or revokes it with an empty role. Admins cannot revoke
+// their own role, so an instance is not left without admins by mistake.
+func (a *API) adminSetRoleHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	var req UserRoleRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	role := db.UserRole(req.Role)
+	if role != "" && role != db.UserRoleAdmin {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid role %q", req.Role))
+	}
+	user, err := a.getDBUserByID(chi.URLParam(r.Context.Request, "id"))
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrUserNotFound.WithErr(fmt.Errorf("user %s is deleted", user.ID.Hex()))
+	}
+	if user.ID.Hex() == r.UserID && role != db.UserRoleAdmin {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("admins cannot revoke their own role"))
+	}
+	if err := a.database.UserService.SetRole(r.Context.Request.Context(), user.ID, role); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.audit(r, &db.AuditEntry{
+		Action:     db.AuditRoleChange,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Details:    fmt.Sprintf("role %q -> %q", user.Role, role),
+	})
+	return nil, nil
+}
+
+// adminBlockUserHandler handles PUT /admin/users/{id}/blocked
+// The blocked users keep their account but are denied every action until unblocked. Admins
+// cannot block themselves.
+func (a *API) adminBlockUserHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	var req UserBlockRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	user, err := a.getDBUserByID(chi.URLParam(r.Context.Request, "id"))
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrUserNotFound.WithErr(fmt.Errorf("user %s is deleted", user.ID.Hex()))
+	}
+	if user.ID.Hex() == r.UserID && req.Blocked {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("admins cannot block themselves"))
+	}
+	if err := a.database.UserService.SetBlocked(r.Context.Request.Context(), user.ID, req.Blocked); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.audit(r, &db.AuditEntry{
+		Action:     db.AuditUserBlock,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Details:    fmt.Sprintf("blocked %t -> %t", user.Blocked, req.Blocked),
+	})
+	return nil, nil
+}
+
+// adminSetCommunityHandler handles PUT /admin/users/{id}/community
+// It moves the user to another community, or removes it from its community if empty. The
+// users cannot change their community themselves, only join one with an invite code.
+func (a *API) adminSetCommunityHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	var req UserCommunityRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	user, err := a.getDBUserByID(chi.URLParam(r.Context.Request, "id"))
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrUserNotFound.WithErr(fmt.Errorf("user %s is deleted", user.ID.Hex()))
+	}
+	community := strings.TrimSpace(req.Community)
+	if err := a.database.UserService.SetCommunity(r.Context.Request.Context(), user.ID, community); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.audit(r, &db.AuditEntry{
+		Action:     db.AuditCommunityChange,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Details:    fmt.Sprintf("community %q -> %q", user.Community, community),
+	})
+	return nil, nil
+}
+
+// parseAuditQuery parses the filters of the audit log endpoints.
+func parseAuditQuery(hc *HTTPContext) (*db.AuditQuery, error) {
+	query := &db.AuditQuery{}
+	var err error
+	if query.Page, err = hc.GetPage(); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if query.PageSize, err = hc.GetPageSize(); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if actor := hc.URLParam("actor"); actor != nil {
+		if query.ActorID, err = primitive.ObjectIDFromHex(actor[0]); err != nil {
+			return nil, ErrInvalidUserID.WithErr(err)
+		}
+	}
+	if action := hc.URLParam("action"); action != nil {
+		query.Action = db.AuditAction(action[0])
+	}
+	if target := hc.URLParam("target"); target != nil {
+		query.TargetID = target[0]
+	}
+	for name, t := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		param := hc.URLParam(name)
+		if param == nil {
+			continue
+		}
+		unix, err := strconv.ParseInt(param[0], 10, 64)
+		if err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid %s %q", name, param[0]))
+		}
+		*t = time.Unix(unix, 0)
+	}
+	return query, nil
+}
+
+// purgeAuditLog deletes the audit log entries older than the retention.
+func (a *API) purgeAuditLog(ctx context.Context) error {
+	deleted, err := a.database.AuditLogService.DeleteBefore(ctx, time.Now().Add(-a.auditRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Info().Msgf("deleted %d audit log entries older than %s", deleted, a.auditRetention)
+	}
+	return nil
+}
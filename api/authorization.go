@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// relationErrors are the errors returned when the user does not have the relation with
+// the resource required by the action.
+var relationErrors = map[policy.Action]*HTTPError{
+	policy.ToolView:          ErrNotCommunityMember,
+	policy.ToolEdit:          ErrToolNotOwnedByUser,
+	policy.ToolDelete:        ErrToolNotOwnedByUser,
+	policy.ToolReport:        ErrToolNotOwnedByUser,
+	policy.ToolManagers:      ErrToolNotOwnedByUser,
+	policy.ToolTransfer:      ErrToolNotOwnedByUser,
+	policy.BookingRead:       ErrUserNotInvolved,
+	policy.BookingAccept:     ErrOnlyOwnerCanAccept,
+	policy.BookingDeny:       ErrOnlyOwnerCanDeny,
+	policy.BookingCancel:     ErrOnlyRequesterCanCancel,
+	policy.BookingReturn:     ErrOnlyOwnerCanReturn,
+	policy.BookingRate:       ErrUserNotInvolved,
+	policy.BookingDisagree:   ErrUserNotInvolved,
+	policy.CommunityContent:  ErrNotCommunityMember,
+	policy.CommunityModerate: ErrNotCommunityMember,
+	policy.RecoveryApprove:   ErrNotCommunityMember,
+}
+
+// reasonErrors are the errors returned for the denials not related to the resource relation.
+var reasonErrors = map[policy.Reason]*HTTPError{
+	policy.ReasonBlocked:       ErrUserBlocked,
+	policy.ReasonInactive:      ErrUserInactive,
+	policy.ReasonOwnerInactive: ErrToolOwnerInactive,
+	policy.ReasonOwnResource:   ErrCannotBookOwnTool,
+	policy.ReasonNotAdmin:      ErrAdminRequired,
+	policy.ReasonSelfApproval:  ErrCannotApproveOwnRecovery,
+}
+
+// subject returns the policy subject of the user performing the request.
+func (a *API) subject(userID string) (policy.Subject, error) {
+	if userID == "" {
+		return policy.Subject{}, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return policy.Subject{}, ErrInvalidUserID.WithErr(err)
+	}
+	user, err := a.database.UserService.GetUserByID(context.Background(), id)
+	if err != nil {
+		return policy.Subject{}, ErrUserNotFound.WithErr(err)
+	}
+	if user.DeletedAt != nil {
+		return policy.Subject{}, ErrUserNotFound.WithErr(fmt.Errorf("user %s is deleted", userID))
+	}
+	return subjectFromDBUser(user), nil
+}
+
+// subjectFromDBUser returns the policy subject of a user.
+func subjectFromDBUser(user *db.User) policy.Subject {
+	return policy.Subject{
+		ID:        user.ID,
+		Active:    user.Active,
+		Blocked:   user.Blocked,
+		Admin:     user.IsAdmin(),
+		Community: user.Community,
+	}
+}
+
+// toolResource returns the policy resource of a tool.
+func toolResource(tool *db.Tool) policy.Resource {
+	return policy.Resource{OwnerID: tool.UserID, OwnerCommunity: tool.Community, Managers: tool.Managers}
+}
+
+// toolOwnerResource returns the policy resource of a tool given its owner, used when
+// the owner status matters (i.e. booking the tool).
+func toolOwnerResource(tool *db.Tool, owner *db.User) policy.Resource {
+	return policy.Resource{
+		OwnerID:        owner.ID,
+		OwnerInactive:  !owner.Active,
+		OwnerCommunity: tool.Community,
+	}
+}
+
+// bookingResource returns the policy resource of a booking. The owner of a booking is
+// the tool owner (the community admins for shared community tools) and the requester is
+// the user who asked for the tool. The managers of the tool are not set, see
+// bookingManagers.
+func bookingResource(booking *db.Booking) policy.Resource {
+	return policy.Resource{
+		OwnerID:        booking.ToUserID,
+		RequesterID:    booking.FromUserID,
+		OwnerCommunity: booking.Community,
+	}
+}
+
+// bookingManagers returns the managers of the booked tool, none if the tool was deleted.
+func (a *API) bookingManagers(ctx context.Context, booking *db.Booking) ([]primitive.ObjectID, error) {
+	id, err := strconv.ParseInt(booking.ToolID, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+	tool, err := a.database.ToolService.GetToolByID(ctx, id, "managers")
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return tool.Managers, nil
+}
+
+// authorize checks the subject can perform the action on the resource, returning
+// the matching API error if the policy denies it.
+func authorize(action policy.Action, subject policy.Subject, resource policy.Resource) error {
+	err := policy.Check(action, subject, resource)
+	if err == nil {
+		return nil
+	}
+	var denial *policy.Denial
+	if !errors.As(err, &denial) {
+		return ErrInternalServerError.WithErr(err)
+	}
+	if httpErr, ok := reasonErrors[denial.Reason]; ok {
+		return httpErr.WithErr(err)
+	}
+	if httpErr, ok := relationErrors[action]; ok {
+		return httpErr.WithErr(err)
+	}
+	return ErrActionNotAllowed.WithErr(err)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxAutoAcceptDays is the maximum duration of the bookings accepted by the auto-accept rules.
+	maxAutoAcceptDays = 365
+	// maxAutoAcceptCommunities is the maximum number of communities of the auto-accept rules.
+	maxAutoAcceptCommunities = 20
+)
+
+// autoAcceptFromTool returns the validated auto-accept rules of the tool, with the communities
+// trimmed and deduplicated. It returns nil if the tool has no rules or they are all empty.
+func autoAcceptFromTool(t *Tool) (*db.AutoAcceptRules, error) {
+	if t.AutoAccept == nil {
+		return nil, nil
+	}
+	rules := &db.AutoAcceptRules{MinRating: t.AutoAccept.MinRating, MaxDays: t.AutoAccept.MaxDays}
+	if rules.MinRating != 0 && (rules.MinRating < 1 || rules.MinRating > 5) {
+		return nil, ErrInvalidAutoAccept.WithErr(fmt.Errorf("minimum rating must be between 1 and 5"))
+	}
+	if rules.MaxDays < 0 || rules.MaxDays > maxAutoAcceptDays {
+		return nil, ErrInvalidAutoAccept.WithErr(fmt.Errorf("maximum days must be between 0 and %d", maxAutoAcceptDays))
+	}
+	for _, community := range t.AutoAccept.Communities {
+		if community = strings.TrimSpace(community); community != "" && !slices.Contains(rules.Communities, community) {
+			rules.Communities = append(rules.Communities, community)
+		}
+	}
+	if len(rules.Communities) > maxAutoAcceptCommunities {
+		return nil, ErrInvalidAutoAccept.WithErr(fmt.Errorf("more than %d communities", maxAutoAcceptCommunities))
+	}
+	if rules.IsEmpty() {
+		return nil, nil
+	}
+	return rules, nil
+}
+
+// autoAcceptRule returns the first auto-accept rule of the tool the booking request of the
+// renter matches, or an empty string if it matches none.
+func (a *API) autoAcceptRule(ctx context.Context, rules *db.AutoAcceptRules, booking *db.Booking,
+	renter policy.Subject,
+) string {
+	if rules.IsEmpty() {
+		return ""
+	}
+	if rules.MaxDays > 0 && bookingDays(booking.StartDate, booking.EndDate) <= uint64(rules.MaxDays) {
+		return "duration"
+	}
+	if renter.Community != "" && slices.Contains(rules.Communities, renter.Community) {
+		return "community"
+	}
+	if rules.MinRating > 0 {
+		stats, err := a.database.BookingService.GetUserBookingStats(ctx, renter.ID)
+		if err != nil {
+			log.Error().Err(err).Msgf("could not get the booking stats of user %s", renter.ID.Hex())
+			return ""
+		}
+		if stats.RenterRating != nil && *stats.RenterRating >= rules.MinRating {
+			return "rating"
+		}
+	}
+	return ""
+}
+
+// autoAcceptBooking accepts the new booking request on behalf of the tool owner if it matches
+// one of the auto-accept rules of the tool. It returns false if the request matches none or
+// could not be accepted (i.e. the renter has not enough tokens for a community tool), so it
+// waits for the owner answer.
+func (a *API) autoAcceptBooking(r *Request, tool *db.Tool, booking *db.Booking, renter policy.Subject) bool {
+	ctx := r.Context.Request.Context()
+	rule := a.autoAcceptRule(ctx, tool.AutoAccept, booking, renter)
+	if rule == "" {
+		return false
+	}
+	var err error
+	if booking.Community != "" {
+		err = a.acceptCommunityBooking(r, booking, booking.ToUserID)
+	} else {
+		err = a.transitionBooking(r, booking, booking.ToUserID, db.BookingStatusAccepted)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msgf("could not auto-accept booking %s of tool %d", booking.ID.Hex(), tool.ID)
+		return false
+	}
+	log.Info().Msgf("booking %s of tool %d auto-accepted by the %s rule", booking.ID.Hex(), tool.ID, rule)
+	return true
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestAutoAcceptFromTool(t *testing.T) {
+	c := qt.New(t)
+
+	rules, err := autoAcceptFromTool(&Tool{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(rules, qt.IsNil)
+
+	// The communities are trimmed and deduplicated
+	rules, err = autoAcceptFromTool(&Tool{AutoAccept: &db.AutoAcceptRules{
+		MinRating:   4.5,
+		Communities: []string{" valley", "valley", ""},
+		MaxDays:     2,
+	}})
+	c.Assert(err, qt.IsNil)
+	c.Assert(rules, qt.DeepEquals, &db.AutoAcceptRules{MinRating: 4.5, Communities: []string{"valley"}, MaxDays: 2})
+
+	// Empty rules are removed
+	rules, err = autoAcceptFromTool(&Tool{AutoAccept: &db.AutoAcceptRules{Communities: []string{" "}}})
+	c.Assert(err, qt.IsNil)
+	c.Assert(rules, qt.IsNil)
+
+	for _, invalid := range []*db.AutoAcceptRules{
+		{MinRating: 0.5},
+		{MinRating: 6},
+		{MaxDays: -1},
+		{MaxDays: maxAutoAcceptDays + 1},
+	} {
+		_, err := autoAcceptFromTool(&Tool{AutoAccept: invalid})
+		c.Assert(err, qt.ErrorMatches, ".*invalid auto-accept rules.*", qt.Commentf("rules %+v", invalid))
+	}
+}
+
+func TestAutoAcceptRule(t *testing.T) {
+	c := qt.New(t)
+	a := &API{}
+	start := time.Now()
+	booking := &db.Booking{StartDate: start, EndDate: start.Add(36 * time.Hour)}
+	renter := policy.Subject{Community: "valley"}
+
+	c.Assert(a.autoAcceptRule(context.Background(), nil, booking, renter), qt.Equals, "")
+	c.Assert(a.autoAcceptRule(context.Background(), &db.AutoAcceptRules{MaxDays: 2}, booking, renter), qt.Equals, "duration")
+	c.Assert(a.autoAcceptRule(context.Background(), &db.AutoAcceptRules{MaxDays: 1}, booking, renter), qt.Equals, "")
+	c.Assert(a.autoAcceptRule(context.Background(), &db.AutoAcceptRules{Communities: []string{"coast", "valley"}},
+		booking, renter), qt.Equals, "community")
+	c.Assert(a.autoAcceptRule(context.Background(), &db.AutoAcceptRules{Communities: []string{"coast"}},
+		booking, renter), qt.Equals, "")
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/types"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	maxAvatarUploadSize = 5 << 20 // bytes
+	maxAvatarDimension  = 8000    // pixels, larger images are rejected before decoding
+	avatarJPEGQuality   = 85
+	defaultAvatarSize   = "medium"
+	avatarCacheControl  = "public, max-age=3600"
+)
+
+// avatarSizes are the standard sizes (square, in pixels) the avatars are resized to.
+var avatarSizes = []struct {
+	Name   string
+	Pixels int
+}{
+	{"small", 64},
+	{"medium", 256},
+	{"large", 512},
+}
+
+// avatarURL returns the URL of the avatar of the user.
+func avatarURL(userID string) string {
+	return "/users/" + userID + "/avatar"
+}
+
+// uploadAvatarHandler handles PUT /profile/avatar
+// The body is a multipart form with the image in the "avatar" field. The image is cropped
+// to a square and resized to every standard size.
+func (a *API) uploadAvatarHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := avatarFromMultipart(r.Context.Request.Header.Get("Content-Type"), r.Data)
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	resized, err := resizeAvatar(data)
+	if err != nil {
+		return nil, ErrInvalidImageFormat.WithErr(err)
+	}
+
+	sizes := make(map[string]types.HexBytes, len(resized))
+	for name, content := range resized {
+		image, err := a.addProcessedImage(user.Name+"_avatar_"+name, content)
+		if err != nil {
+			return nil, err
+		}
+		sizes[name] = image.Hash
+	}
+	update := bson.M{
+		"avatarHash":  sizes[avatarSizes[len(avatarSizes)-1].Name],
+		"avatarSizes": sizes,
+	}
+	if _, err := a.database.UserService.UpdateUser(r.Context.Request.Context(), user.ID, update); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	log.Debug().Msgf("user %s uploaded a new avatar", user.ID.Hex())
+	return a.getUserByID(r.UserID)
+}
+
+// avatarHandler handles GET /users/{id}/avatar?size=
+// It serves the avatar image of the user in the given standard size (medium by default).
+// Avatars set before the standard sizes existed are served as uploaded.
+func (a *API) avatarHandler(r *Request) (interface{}, error) {
+	idParam := r.Context.URLParam("id")
+	if idParam == nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing id"))
+	}
+	size := defaultAvatarSize
+	if sizeParam := r.Context.URLParam("size"); sizeParam != nil {
+		size = sizeParam[0]
+	}
+	if !isAvatarSize(size) {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid avatar size %q", size))
+	}
+	user, err := a.getDBUserByID(idParam[0])
+	if err != nil {
+		return nil, err
+	}
+	hash := user.AvatarSizes[size]
+	if len(hash) == 0 {
+		hash = user.AvatarHash
+	}
+	if user.DeletedAt != nil || len(hash) == 0 {
+		return nil, ErrImageNotFound.WithErr(fmt.Errorf("user %s has no avatar", idParam[0]))
+	}
+	image, err := a.image(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &RawResponse{
+		ContentType:  http.DetectContentType(image.Content),
+		Data:         image.Content,
+		CacheControl: avatarCacheControl,
+		ETag:         fmt.Sprintf("%q", image.Hash.String()),
+		LastModified: image.CreatedAt,
+	}, nil
+}
+
+// avatarFromMultipart returns the content of the "avatar" field of a multipart form body.
+func avatarFromMultipart(contentType string, body []byte) ([]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, fmt.Errorf("expected a multipart/form-data body")
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("missing avatar field")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() != "avatar" {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(part, maxAvatarUploadSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxAvatarUploadSize {
+			return nil, fmt.Errorf("avatar larger than %d bytes", maxAvatarUploadSize)
+		}
+		return data, nil
+	}
+}
+
+// resizeAvatar crops the image, once upright, to a centered square and returns it as JPEG in
+// every standard size, keyed by the size name. Images are never upscaled.
+func resizeAvatar(data []byte) (map[string][]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width > maxAvatarDimension || config.Height > maxAvatarDimension {
+		return nil, fmt.Errorf("image larger than %dx%d pixels", maxAvatarDimension, maxAvatarDimension)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	src = orientImage(src, exifOrientation(data))
+	square := cropSquare(src)
+	resized := make(map[string][]byte, len(avatarSizes))
+	for _, size := range avatarSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, scaleDown(src, square, size.Pixels), &jpeg.Options{Quality: avatarJPEGQuality}); err != nil {
+			return nil, err
+		}
+		resized[size.Name] = buf.Bytes()
+	}
+	return resized, nil
+}
+
+// cropSquare returns the largest centered square of the image.
+func cropSquare(src image.Image) image.Rectangle {
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
+
+// scaleDown returns the square of the image scaled to side pixels, averaging the source
+// pixels covered by each destination pixel. If the square is smaller it is not scaled.
+// Transparent pixels are blended over white, as JPEG has no alpha channel.
+func scaleDown(src image.Image, square image.Rectangle, side int) image.Image {
+	side = min(side, square.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	for y := 0; y < side; y++ {
+		y0 := square.Min.Y + y*square.Dy()/side
+		y1 := max(square.Min.Y+(y+1)*square.Dy()/side, y0+1)
+		for x := 0; x < side; x++ {
+			x0 := square.Min.X + x*square.Dx()/side
+			x1 := max(square.Min.X+(x+1)*square.Dx()/side, x0+1)
+			var r, g, b, transparency, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b = r+uint64(cr), g+uint64(cg), b+uint64(cb)
+					transparency += 0xffff - uint64(ca)
+					n++
+				}
+			}
+			// The colors are premultiplied by alpha, so the white background adds the transparency
+			dst.Set(x, y, color.RGBA64{
+				R: uint16((r + transparency) / n),
+				G: uint16((g + transparency) / n),
+				B: uint16((b + transparency) / n),
+				A: 0xffff,
+			})
+		}
+	}
+	return dst
+}
+
+// isAvatarSize returns true if the name is a standard avatar size.
+func isAvatarSize(name string) bool {
+	for _, size := range avatarSizes {
+		if size.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// avatarImages returns the hashes of the avatar images of the user.
+func avatarImages(user *db.User) []types.HexBytes {
+	hashes := []types.HexBytes{}
+	if len(user.AvatarHash) > 0 {
+		hashes = append(hashes, user.AvatarHash)
+	}
+	for _, size := range avatarSizes {
+		if hash, ok := user.AvatarSizes[size.Name]; ok && !bytes.Equal(hash, user.AvatarHash) {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func testPNG(c *qt.C, width, height int, fill color.Color) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	c.Assert(png.Encode(&buf, img), qt.IsNil)
+	return buf.Bytes()
+}
+
+func TestResizeAvatar(t *testing.T) {
+	c := qt.New(t)
+
+	// Cropped to a square and resized to every standard size
+	resized, err := resizeAvatar(testPNG(c, 1000, 600, color.NRGBA{R: 200, A: 255}))
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized, qt.HasLen, len(avatarSizes))
+	for _, size := range avatarSizes {
+		img, err := jpeg.Decode(bytes.NewReader(resized[size.Name]))
+		c.Assert(err, qt.IsNil)
+		c.Assert(img.Bounds().Dx(), qt.Equals, size.Pixels)
+		c.Assert(img.Bounds().Dy(), qt.Equals, size.Pixels)
+	}
+
+	// Small images are not upscaled, and transparent pixels become white
+	resized, err = resizeAvatar(testPNG(c, 100, 100, color.NRGBA{}))
+	c.Assert(err, qt.IsNil)
+	img, err := jpeg.Decode(bytes.NewReader(resized["large"]))
+	c.Assert(err, qt.IsNil)
+	c.Assert(img.Bounds().Dx(), qt.Equals, 100)
+	r, g, b, _ := img.At(50, 50).RGBA()
+	c.Assert(r > 0xf000 && g > 0xf000 && b > 0xf000, qt.IsTrue)
+
+	_, err = resizeAvatar([]byte("not an image"))
+	c.Assert(err, qt.IsNotNil)
+}
+
+func TestAvatarFromMultipart(t *testing.T) {
+	c := qt.New(t)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	c.Assert(writer.WriteField("name", "ignored"), qt.IsNil)
+	part, err := writer.CreateFormFile("avatar", "avatar.png")
+	c.Assert(err, qt.IsNil)
+	_, err = part.Write([]byte("image data"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(writer.Close(), qt.IsNil)
+
+	data, err := avatarFromMultipart(writer.FormDataContentType(), body.Bytes())
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(data), qt.Equals, "image data")
+
+	_, err = avatarFromMultipart("application/json", body.Bytes())
+	c.Assert(err, qt.IsNotNil)
+
+	body.Reset()
+	writer = multipart.NewWriter(&body)
+	c.Assert(writer.WriteField("name", "ignored"), qt.IsNil)
+	c.Assert(writer.Close(), qt.IsNil)
+	_, err = avatarFromMultipart(writer.FormDataContentType(), body.Bytes())
+	c.Assert(err, qt.ErrorMatches, "missing avatar field")
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// badgesMaxAge is the time after which the badges of a user are recalculated.
+	badgesMaxAge = 24 * time.Hour
+	// badgesBatchSize is the maximum number of users whose badges are recalculated per job run.
+	badgesBatchSize = 500
+	// badgeLoans is the number of returned bookings lent to earn BadgeTenLoans.
+	badgeLoans = 10
+	// badgeLocalities is the number of localities of the borrowed tools to earn
+	// BadgeNomadicTraveler.
+	badgeLocalities = 3
+)
+
+// badgeInputs are the figures of a user the badges are computed from.
+type badgeInputs struct {
+	ToolsShared        int64
+	CompletedAsOwner   int64
+	Founder            bool
+	BorrowedLocalities int64
+}
+
+// earnedBadges returns the badges earned with the figures, in the order they are shown.
+func earnedBadges(in badgeInputs) []db.Badge {
+	badges := []db.Badge{}
+	if in.ToolsShared > 0 {
+		badges = append(badges, db.BadgeFirstTool)
+	}
+	if in.CompletedAsOwner >= badgeLoans {
+		badges = append(badges, db.BadgeTenLoans)
+	}
+	if in.Founder {
+		badges = append(badges, db.BadgeCommunityFounder)
+	}
+	if in.BorrowedLocalities >= badgeLocalities {
+		badges = append(badges, db.BadgeNomadicTraveler)
+	}
+	return badges
+}
+
+// awardBadges adds the earned badges the user did not have, awarded now. The badges already
+// awarded are kept, with their award time, even if they are no longer earned.
+func awardBadges(current []db.UserBadge, earned []db.Badge, now time.Time) []db.UserBadge {
+	badges := slices.Clone(current)
+	for _, badge := range earned {
+		if !slices.ContainsFunc(badges, func(b db.UserBadge) bool { return b.Badge == badge }) {
+			badges = append(badges, db.UserBadge{Badge: badge, AwardedAt: now})
+		}
+	}
+	return badges
+}
+
+// updateBadges recalculates the badges of the users whose badges are older than badgesMaxAge,
+// in batches so a large user base is spread over several job runs.
+func (a *API) updateBadges(ctx context.Context) error {
+	now := time.Now()
+	users, err := a.database.UserService.GetUsersForBadgeUpdate(ctx, now.Add(-badgesMaxAge), badgesBatchSize)
+	if err != nil {
+		return fmt.Errorf("could not get users for badge update: %w", err)
+	}
+	founders := make(map[string]primitive.ObjectID)
+	for _, user := range users {
+		in, err := a.userBadgeInputs(ctx, user, founders)
+		if err != nil {
+			log.Error().Err(err).Msgf("could not compute the badges of user %s", user.ID.Hex())
+			continue
+		}
+		badges := awardBadges(user.Badges, earnedBadges(in), now)
+		if err := a.database.UserService.SetBadges(ctx, user.ID, badges, now); err != nil {
+			log.Error().Err(err).Msgf("could not store the badges of user %s", user.ID.Hex())
+		}
+	}
+	return nil
+}
+
+// userBadgeInputs returns the figures of the user the badges are computed from. The founders of
+// the communities already looked up are kept in the map.
+func (a *API) userBadgeInputs(ctx context.Context, user *db.User, founders map[string]primitive.ObjectID) (badgeInputs, error) {
+	var in badgeInputs
+	var err error
+	if in.ToolsShared, err = a.database.ToolService.CountUserTools(ctx, user.ID); err != nil {
+		return in, err
+	}
+	stats, err := a.database.BookingService.GetUserBookingStats(ctx, user.ID)
+	if err != nil {
+		return in, err
+	}
+	in.CompletedAsOwner = stats.CompletedAsOwner
+	if in.BorrowedLocalities, err = a.database.BookingService.CountBorrowedLocalities(ctx, user.ID); err != nil {
+		return in, err
+	}
+	if user.Community != "" {
+		founder, ok := founders[user.Community]
+		if !ok {
+			if founder, err = a.database.UserService.GetCommunityFounder(ctx, user.Community); err != nil {
+				return in, err
+			}
+			founders[user.Community] = founder
+		}
+		in.Founder = founder == user.ID
+	}
+	return in, nil
+}
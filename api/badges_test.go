@@ -0,0 +1,39 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestEarnedBadges(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(earnedBadges(badgeInputs{}), qt.HasLen, 0)
+	c.Assert(earnedBadges(badgeInputs{ToolsShared: 1, CompletedAsOwner: 9, BorrowedLocalities: 2}),
+		qt.DeepEquals, []db.Badge{db.BadgeFirstTool})
+	c.Assert(earnedBadges(badgeInputs{ToolsShared: 2, CompletedAsOwner: 10, Founder: true, BorrowedLocalities: 3}),
+		qt.DeepEquals, []db.Badge{db.BadgeFirstTool, db.BadgeTenLoans, db.BadgeCommunityFounder, db.BadgeNomadicTraveler})
+}
+
+func TestAwardBadges(t *testing.T) {
+	c := qt.New(t)
+
+	earlier := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	now := earlier.Add(48 * time.Hour)
+	current := []db.UserBadge{{Badge: db.BadgeFirstTool, AwardedAt: earlier}}
+
+	// Nothing new earned
+	badges := awardBadges(current, []db.Badge{db.BadgeFirstTool}, now)
+	c.Assert(badges, qt.DeepEquals, current)
+
+	// The awarded badges are kept even if no longer earned, with their award time
+	badges = awardBadges(current, []db.Badge{db.BadgeTenLoans}, now)
+	c.Assert(badges, qt.DeepEquals, []db.UserBadge{
+		{Badge: db.BadgeFirstTool, AwardedAt: earlier},
+		{Badge: db.BadgeTenLoans, AwardedAt: now},
+	})
+	c.Assert(current, qt.HasLen, 1)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+)
+
+// HandleArchiveBooking handles POST /bookings/{bookingId}/archive
+// It archives the ended booking for the user, hidden from its booking lists unless they
+// include the archived bookings. The other party still lists it.
+func (a *API) HandleArchiveBooking(r *Request) (interface{}, error) {
+	booking, subject, err := a.authorizedBookingFromRequest(r, "bookingId", policy.BookingRead)
+	if err != nil {
+		return nil, err
+	}
+	if !booking.Ended() {
+		return nil, ErrBookingNotEnded.WithErr(fmt.Errorf("booking %s is %s", booking.ID.Hex(), booking.BookingStatus))
+	}
+	err = a.database.BookingService.SetArchived(r.Context.Request.Context(), booking.ID, subject.ID, true)
+	if err == db.ErrBookingStatusChanged {
+		return nil, ErrBookingStatusChanged.WithErr(err)
+	}
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// HandleUnarchiveBooking handles DELETE /bookings/{bookingId}/archive
+// It lists the archived booking again.
+func (a *API) HandleUnarchiveBooking(r *Request) (interface{}, error) {
+	booking, subject, err := a.authorizedBookingFromRequest(r, "bookingId", policy.BookingRead)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.database.BookingService.SetArchived(r.Context.Request.Context(), booking.ID, subject.ID, false); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// HandleArchiveBookings handles POST /bookings/archive
+// It archives for the user all its ended bookings, made or received, that ended before the
+// given date.
+func (a *API) HandleArchiveBookings(r *Request) (interface{}, error) {
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var req ArchiveBookingsRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if req.Before <= 0 {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing before date"))
+	}
+	archived, err := a.database.BookingService.ArchiveUserBookings(r.Context.Request.Context(), subject.ID,
+		time.Unix(req.Before, 0))
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &ArchivedBookings{Archived: archived}, nil
+}
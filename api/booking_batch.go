@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HandleBatchBookings handles PUT /bookings/batch
+// The owner accepts or denies several booking requests at once. Each booking is validated and
+// updated on its own, in the given order, as with the accept and deny endpoints, so a booking
+// overlapping a booking accepted before in the batch fails with a conflict. The response has
+// the result of every booking. The note of the request is recorded in the history of every
+// updated booking.
+func (a *API) HandleBatchBookings(r *Request) (interface{}, error) {
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var req BookingBatchRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > maxBatchIDs {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("between 1 and %d booking ids are required", maxBatchIDs))
+	}
+	if len(req.Note) > maxTransitionNoteLength {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("note longer than %d characters", maxTransitionNoteLength))
+	}
+	status := db.BookingStatus(strings.ToUpper(req.Status))
+	var action policy.Action
+	var transition func(*Request, *db.Booking, primitive.ObjectID) error
+	switch status {
+	case db.BookingStatusAccepted:
+		action, transition = policy.BookingAccept, a.acceptPetition
+	case db.BookingStatusRejected:
+		action, transition = policy.BookingDeny, a.denyPetition
+	default:
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid batch booking status %q", req.Status))
+	}
+
+	response := &BookingBatchResponse{Results: []*BookingBatchResult{}}
+	for _, id := range req.IDs {
+		result := &BookingBatchResult{ID: id}
+		if err := a.batchTransition(r, subject, id, action, transition); err != nil {
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) {
+				httpErr = ErrInternalServerError.WithErr(err)
+			}
+			result.ErrorCode, result.Error = httpErr.ErrorCode, httpErr.Message
+			response.Failed++
+		} else {
+			result.BookingStatus = string(status)
+			response.Updated++
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+// batchTransition applies the transition to the booking of a batch, if the subject is allowed
+// to perform the action on it.
+func (a *API) batchTransition(
+	r *Request,
+	subject policy.Subject,
+	id string,
+	action policy.Action,
+	transition func(*Request, *db.Booking, primitive.ObjectID) error,
+) error {
+	bookingID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrInvalidRequestBodyData.WithErr(err)
+	}
+	booking, err := a.authorizedBooking(r.Context.Request.Context(), subject, bookingID, action)
+	if err != nil {
+		return err
+	}
+	return transition(r, booking, subject.ID)
+}
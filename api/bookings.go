@@ -1,32 +1,173 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
 )
 
 // convertBookingToResponse converts a db.Booking to a BookingResponse
 func convertBookingToResponse(booking *db.Booking) BookingResponse {
-	return BookingResponse{
-		ID:            booking.ID.Hex(),
-		ToolID:        booking.ToolID,
-		FromUserID:    booking.FromUserID.Hex(),
-		ToUserID:      booking.ToUserID.Hex(),
-		StartDate:     booking.StartDate.Unix(),
-		EndDate:       booking.EndDate.Unix(),
-		Contact:       booking.Contact,
-		Comments:      booking.Comments,
-		BookingStatus: string(booking.BookingStatus),
-		CreatedAt:     booking.CreatedAt,
-		UpdatedAt:     booking.UpdatedAt,
+	response := BookingResponse{
+		ID:                  booking.ID.Hex(),
+		ToolID:              booking.ToolID,
+		FromUserID:          booking.FromUserID.Hex(),
+		ToUserID:            booking.ToUserID.Hex(),
+		FromAvatarURL:       avatarURL(booking.FromUserID.Hex()),
+		ToAvatarURL:         avatarURL(booking.ToUserID.Hex()),
+		StartDate:           booking.StartDate.Unix(),
+		EndDate:             booking.EndDate.Unix(),
+		Contact:             booking.Contact,
+		Comments:            booking.Comments,
+		CommentRefs:         booking.CommentRefs,
+		BookingStatus:       string(booking.BookingStatus),
+		CreatedAt:           booking.CreatedAt,
+		UpdatedAt:           booking.UpdatedAt,
+		ToolReported:        booking.ToolReported,
+		Origin:              string(booking.Origin),
+		Community:           booking.Community,
+		PricingMode:         string(booking.PricingMode),
+		Price:               booking.Price,
+		CancellationPolicy:  string(booking.CancellationPolicy),
+		CancellationPenalty: booking.CancellationPenalty,
+		CommunityFee:        booking.CommunityFee,
+	}
+	if booking.Disagreement != nil {
+		response.Disagreement = new(BookingDisagreement).FromDBBookingDisagreement(booking.Disagreement)
+	}
+	if booking.AcceptedTerms != nil {
+		response.AcceptedTerms = new(AcceptedTerms).FromDBAcceptedTerms(booking.AcceptedTerms)
+	}
+	if booking.Tool != nil {
+		response.Tool = new(BookingTool).FromDBBookingTool(booking.Tool)
+	}
+	if booking.FromUser != nil {
+		response.FromUser = new(BookingUser).FromDBBookingUser(booking.FromUser)
+	}
+	if booking.ToUser != nil {
+		response.ToUser = new(BookingUser).FromDBBookingUser(booking.ToUser)
+	}
+	if booking.Payment != nil {
+		response.Payment = new(BookingPayment).FromDBBookingPayment(booking.Payment)
+	}
+	return response
+}
+
+// authorizedBookingFromRequest returns the booking referenced by the param URL parameter,
+// ensuring the user performing the request is allowed to perform the action on it.
+func (a *API) authorizedBookingFromRequest(
+	r *Request,
+	param string,
+	action policy.Action,
+) (*db.Booking, policy.Subject, error) {
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, subject, err
+	}
+	bookingID, err := primitive.ObjectIDFromHex(chi.URLParam(r.Context.Request, param))
+	if err != nil {
+		return nil, subject, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	booking, err := a.authorizedBooking(r.Context.Request.Context(), subject, bookingID, action)
+	return booking, subject, err
+}
+
+// authorizedBooking returns the booking, ensuring the subject is allowed to perform the action
+// on it.
+func (a *API) authorizedBooking(
+	ctx context.Context,
+	subject policy.Subject,
+	bookingID primitive.ObjectID,
+	action policy.Action,
+) (*db.Booking, error) {
+	booking, err := a.database.BookingService.Get(ctx, bookingID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if booking == nil {
+		return nil, ErrBookingNotFound.WithErr(fmt.Errorf("booking with id %s not found", bookingID.Hex()))
+	}
+	resource := bookingResource(booking)
+	if resource.Managers, err = a.bookingManagers(ctx, booking); err != nil {
+		return nil, err
+	}
+	if err := authorize(action, subject, resource); err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+// parseBookingListOptions parses the filters and the sort of the booking lists: the status
+// (several statuses match any of them), the toolId, the user on the other side of the
+// bookings, the from and to dates (unix seconds) the bookings overlap, the sort date
+// (createdAt or startDate), the order (asc or desc) and if the archived bookings are included.
+func parseBookingListOptions(hc *HTTPContext) (*db.BookingListOptions, error) {
+	opts := &db.BookingListOptions{}
+	if includeArchived := hc.URLParam("includeArchived"); includeArchived != nil {
+		var err error
+		if opts.IncludeArchived, err = strconv.ParseBool(includeArchived[0]); err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(err)
+		}
+	}
+	for _, status := range hc.URLParam("status") {
+		status := db.BookingStatus(strings.ToUpper(status))
+		if !db.IsValidBookingStatus(status) {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid booking status %q", status))
+		}
+		opts.Statuses = append(opts.Statuses, status)
+	}
+	if toolID := hc.URLParam("toolId"); toolID != nil {
+		if _, err := strconv.ParseInt(toolID[0], 10, 64); err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid tool id %q", toolID[0]))
+		}
+		opts.ToolID = toolID[0]
+	}
+	if user := hc.URLParam("user"); user != nil {
+		var err error
+		if opts.Counterpart, err = primitive.ObjectIDFromHex(user[0]); err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid user id %q", user[0]))
+		}
+	}
+	for param, date := range map[string]*time.Time{"from": &opts.From, "to": &opts.To} {
+		if value := hc.URLParam(param); value != nil {
+			seconds, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid %s date %q", param, value[0]))
+			}
+			*date = time.Unix(seconds, 0)
+		}
+	}
+	if !opts.From.IsZero() && !opts.To.IsZero() && !opts.To.After(opts.From) {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("to date is not after the from date"))
+	}
+	if sort := hc.URLParam("sort"); sort != nil {
+		switch db.BookingSort(sort[0]) {
+		case db.BookingSortCreatedAt, db.BookingSortStartDate:
+			opts.SortBy = db.BookingSort(sort[0])
+		default:
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid sort %q", sort[0]))
+		}
 	}
+	if order := hc.URLParam("order"); order != nil {
+		switch order[0] {
+		case "asc":
+			opts.Ascending = true
+		case "desc":
+		default:
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid order %q", order[0]))
+		}
+	}
+	return opts, nil
 }
 
 // HandleGetBookingRequests handles GET /bookings/requests
@@ -41,7 +182,31 @@ func (a *API) HandleGetBookingRequests(r *Request) (interface{}, error) {
 		return nil, ErrUserNotFound.WithErr(err)
 	}
 
-	bookings, err := a.database.BookingService.GetUserRequests(r.Context.Request.Context(), user.ObjectID())
+	fields, err := parseFields(r.Context, bookingFields)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := parseBookingListOptions(r.Context)
+	if err != nil {
+		return nil, err
+	}
+	// The requests of the tools managed by the user are included
+	ctx := r.Context.Request.Context()
+	managed, err := a.database.ToolService.GetManagedToolIDs(ctx, user.ObjectID())
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	projection := fieldsProjection(fields, bookingFields, bookingRequiredFields)
+	var bookings []*db.Booking
+	if len(managed) == 0 {
+		bookings, err = a.database.BookingService.GetUserRequests(ctx, user.ObjectID(), opts, projection...)
+	} else {
+		toolIDs := make([]string, len(managed))
+		for i, id := range managed {
+			toolIDs[i] = strconv.FormatInt(id, 10)
+		}
+		bookings, err = a.database.BookingService.GetManagerRequests(ctx, user.ObjectID(), toolIDs, opts, projection...)
+	}
 	if err != nil {
 		return nil, ErrInternalServerError.WithErr(err)
 	}
@@ -49,7 +214,9 @@ func (a *API) HandleGetBookingRequests(r *Request) (interface{}, error) {
 	response := make([]BookingResponse, len(bookings))
 	for i, booking := range bookings {
 		response[i] = convertBookingToResponse(booking)
+		response[i].Archived = booking.ArchivedByUser(user.ObjectID())
 	}
+	selectBookingFields(response, fields)
 
 	return response, nil
 }
@@ -66,7 +233,16 @@ func (a *API) HandleGetBookingPetitions(r *Request) (interface{}, error) {
 		return nil, ErrUserNotFound.WithErr(err)
 	}
 
-	bookings, err := a.database.BookingService.GetUserPetitions(r.Context.Request.Context(), user.ObjectID())
+	fields, err := parseFields(r.Context, bookingFields)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := parseBookingListOptions(r.Context)
+	if err != nil {
+		return nil, err
+	}
+	bookings, err := a.database.BookingService.GetUserPetitions(r.Context.Request.Context(), user.ObjectID(), opts,
+		fieldsProjection(fields, bookingFields, bookingRequiredFields)...)
 	if err != nil {
 		return nil, ErrInternalServerError.WithErr(err)
 	}
@@ -74,15 +250,18 @@ func (a *API) HandleGetBookingPetitions(r *Request) (interface{}, error) {
 	response := make([]BookingResponse, len(bookings))
 	for i, booking := range bookings {
 		response[i] = convertBookingToResponse(booking)
+		response[i].Archived = booking.ArchivedByUser(user.ObjectID())
 	}
+	selectBookingFields(response, fields)
 
 	return response, nil
 }
 
 // HandleGetUserBookings handles GET /bookings/user/{id}
 func (a *API) HandleGetUserBookings(r *Request) (interface{}, error) {
-	if r.UserID == "" {
-		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get user ID from URL
@@ -90,6 +269,10 @@ func (a *API) HandleGetUserBookings(r *Request) (interface{}, error) {
 	if err != nil {
 		return nil, ErrInvalidRequestBodyData.WithErr(err)
 	}
+	// The bookings of a user are only listed to the user and the admins
+	if err := authorize(policy.UserBookings, subject, policy.Resource{OwnerID: userID}); err != nil {
+		return nil, err
+	}
 
 	// Get page number
 	page, err := r.Context.GetPage()
@@ -97,8 +280,14 @@ func (a *API) HandleGetUserBookings(r *Request) (interface{}, error) {
 		return nil, ErrInvalidRequestBodyData.WithErr(err)
 	}
 
+	fields, err := parseFields(r.Context, bookingFields)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get bookings
-	bookings, err := a.database.BookingService.GetUserBookings(r.Context.Request.Context(), userID, page)
+	bookings, err := a.database.BookingService.GetUserBookings(r.Context.Request.Context(), userID, page,
+		fieldsProjection(fields, bookingFields, bookingRequiredFields)...)
 	if err != nil {
 		return nil, ErrInternalServerError.WithErr(err)
 	}
@@ -108,193 +297,209 @@ func (a *API) HandleGetUserBookings(r *Request) (interface{}, error) {
 	for i, booking := range bookings {
 		response[i] = convertBookingToResponse(booking)
 	}
+	selectBookingFields(response, fields)
 
 	return response, nil
 }
 
 // HandleGetBooking handles GET /bookings/{bookingId}
 func (a *API) HandleGetBooking(r *Request) (interface{}, error) {
-	bookingID, err := primitive.ObjectIDFromHex(chi.URLParam(r.Context.Request, "bookingId"))
+	fields, err := parseFields(r.Context, bookingFields)
 	if err != nil {
-		return nil, ErrInvalidRequestBodyData.WithErr(err)
+		return nil, err
 	}
-
-	booking, err := a.database.BookingService.Get(r.Context.Request.Context(), bookingID)
+	booking, subject, err := a.authorizedBookingFromRequest(r, "bookingId", policy.BookingRead)
 	if err != nil {
-		return nil, ErrInternalServerError.WithErr(err)
-	}
-	if booking == nil {
-		return nil, ErrBookingNotFound.WithErr(fmt.Errorf("booking with id %s not found", bookingID.Hex()))
+		return nil, err
 	}
-
-	return convertBookingToResponse(booking), nil
+	response := convertBookingToResponse(booking)
+	response.Archived = booking.ArchivedByUser(subject.ID)
+	response.fields = fields
+	return response, nil
 }
 
 // HandleAcceptPetition handles POST /bookings/petitions/{petitionId}/accept
 func (a *API) HandleAcceptPetition(r *Request) (interface{}, error) {
-	if r.UserID == "" {
-		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
-	}
-
-	// Get user from database
-	user, err := a.getUserByID(r.UserID)
+	booking, subject, err := a.authorizedBookingFromRequest(r, "petitionId", policy.BookingAccept)
 	if err != nil {
-		return nil, ErrUserNotFound.WithErr(err)
+		return nil, err
 	}
+	return nil, a.acceptPetition(r, booking, subject.ID)
+}
 
-	petitionID, err := primitive.ObjectIDFromHex(chi.URLParam(r.Context.Request, "petitionId"))
-	if err != nil {
-		return nil, ErrInvalidRequestBodyData.WithErr(err)
+// acceptPetition accepts the pending booking on behalf of the user, unless the tool is under
+// maintenance on its dates. The bookings of shared community tools are paid when accepted.
+func (a *API) acceptPetition(r *Request, booking *db.Booking, by primitive.ObjectID) error {
+	// Verify booking is in PENDING state
+	if booking.BookingStatus != db.BookingStatusPending {
+		return ErrCanOnlyAcceptPending.WithErr(fmt.Errorf("booking status is %s", booking.BookingStatus))
 	}
-
-	booking, err := a.database.BookingService.Get(r.Context.Request.Context(), petitionID)
+	toolID, err := strconv.ParseInt(booking.ToolID, 10, 64)
 	if err != nil {
-		return nil, ErrInternalServerError.WithErr(err)
+		return ErrInternalServerError.WithErr(err)
 	}
-	if booking == nil {
-		return nil, ErrBookingNotFound.WithErr(fmt.Errorf("booking with id %s not found", petitionID.Hex()))
-	}
-
-	// Verify user is the tool owner
-	if booking.ToUserID != user.ObjectID() {
-		return nil, ErrOnlyOwnerCanAccept.WithErr(fmt.Errorf("user %s is not the owner", user.ID))
+	tool, err := a.toolFromDB(toolID)
+	if err != nil {
+		return err
 	}
-
-	// Verify booking is in PENDING state
-	if booking.BookingStatus != db.BookingStatusPending {
-		return nil, ErrCanOnlyAcceptPending.WithErr(fmt.Errorf("booking status is %s", booking.BookingStatus))
+	if err := checkMaintenance(tool, booking.StartDate, booking.EndDate); err != nil {
+		return err
 	}
-
-	err = a.database.BookingService.UpdateStatus(r.Context.Request.Context(), petitionID, db.BookingStatusAccepted)
-	if err != nil {
-		return nil, ErrInternalServerError.WithErr(err)
+	if booking.Community != "" {
+		return a.acceptCommunityBooking(r, booking, by)
 	}
 
-	return nil, nil
+	return a.transitionBooking(r, booking, by, db.BookingStatusAccepted)
 }
 
 // HandleDenyPetition handles POST /bookings/petitions/{petitionId}/deny
 func (a *API) HandleDenyPetition(r *Request) (interface{}, error) {
-	if r.UserID == "" {
-		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
-	}
-
-	// Get user from database
-	user, err := a.getUserByID(r.UserID)
-	if err != nil {
-		return nil, ErrUserNotFound.WithErr(err)
-	}
-
-	petitionID, err := primitive.ObjectIDFromHex(chi.URLParam(r.Context.Request, "petitionId"))
-	if err != nil {
-		return nil, ErrInvalidRequestBodyData.WithErr(err)
-	}
-
-	booking, err := a.database.BookingService.Get(r.Context.Request.Context(), petitionID)
+	booking, subject, err := a.authorizedBookingFromRequest(r, "petitionId", policy.BookingDeny)
 	if err != nil {
-		return nil, ErrInternalServerError.WithErr(err)
-	}
-	if booking == nil {
-		return nil, ErrBookingNotFound.WithErr(fmt.Errorf("booking with id %s not found", petitionID.Hex()))
-	}
-
-	// Verify user is the tool owner
-	if booking.ToUserID != user.ObjectID() {
-		return nil, ErrOnlyOwnerCanDeny.WithErr(fmt.Errorf("user %s is not the owner", user.ID))
+		return nil, err
 	}
+	return nil, a.denyPetition(r, booking, subject.ID)
+}
 
+// denyPetition rejects the pending booking on behalf of the user.
+func (a *API) denyPetition(r *Request, booking *db.Booking, by primitive.ObjectID) error {
 	// Verify booking is in PENDING state
 	if booking.BookingStatus != db.BookingStatusPending {
-		return nil, ErrCanOnlyDenyPending.WithErr(fmt.Errorf("booking status is %s", booking.BookingStatus))
-	}
-
-	err = a.database.BookingService.UpdateStatus(r.Context.Request.Context(), petitionID, db.BookingStatusRejected)
-	if err != nil {
-		return nil, ErrInternalServerError.WithErr(err)
+		return ErrCanOnlyDenyPending.WithErr(fmt.Errorf("booking status is %s", booking.BookingStatus))
 	}
 
-	return nil, nil
+	return a.transitionBooking(r, booking, by, db.BookingStatusRejected)
 }
 
 // HandleCancelRequest handles POST /bookings/request/{petitionId}/cancel
 func (a *API) HandleCancelRequest(r *Request) (interface{}, error) {
-	if r.UserID == "" {
-		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
-	}
-
-	// Get user from database
-	user, err := a.getUserByID(r.UserID)
+	booking, subject, err := a.authorizedBookingFromRequest(r, "petitionId", policy.BookingCancel)
 	if err != nil {
-		return nil, ErrUserNotFound.WithErr(err)
+		return nil, err
 	}
 
-	petitionID, err := primitive.ObjectIDFromHex(chi.URLParam(r.Context.Request, "petitionId"))
-	if err != nil {
-		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	// Pending requests can be cancelled, and accepted bookings until they start. The bookings
+	// of shared community tools are paid when accepted, so they cannot be cancelled then.
+	accepted := booking.BookingStatus == db.BookingStatusAccepted &&
+		booking.StartDate.After(time.Now()) && booking.Community == ""
+	if booking.BookingStatus != db.BookingStatusPending && !accepted {
+		return nil, ErrCanOnlyCancelPending.WithErr(fmt.Errorf("booking status is %s", booking.BookingStatus))
 	}
 
-	booking, err := a.database.BookingService.Get(r.Context.Request.Context(), petitionID)
-	if err != nil {
-		return nil, ErrInternalServerError.WithErr(err)
+	// Late cancellations of accepted bookings of strict tools pay a penalty to the owner
+	ctx := r.Context.Request.Context()
+	var penalty uint64
+	if accepted {
+		penalty = a.cancellationPenalty(booking, time.Now())
 	}
-	if booking == nil {
-		return nil, ErrBookingNotFound.WithErr(fmt.Errorf("booking with id %s not found", petitionID.Hex()))
+	if penalty > 0 {
+		if err := a.database.UserService.SpendTokens(ctx, booking.FromUserID, penalty); err != nil {
+			if err == db.ErrNotEnoughTokens {
+				return nil, ErrNotEnoughTokens.WithErr(fmt.Errorf("late cancellation costs %d tokens", penalty))
+			}
+			return nil, ErrInternalServerError.WithErr(err)
+		}
 	}
-
-	// Verify user is the requester
-	if booking.FromUserID != user.ObjectID() {
-		return nil, ErrOnlyRequesterCanCancel.WithErr(fmt.Errorf("user %s is not the requester", user.ID))
+	if err := a.transitionBooking(r, booking, subject.ID, db.BookingStatusCancelled); err != nil {
+		if penalty > 0 {
+			if err := a.database.UserService.AddTokens(ctx, booking.FromUserID, penalty); err != nil {
+				log.Error().Err(err).Msgf("could not refund %d tokens of booking %s", penalty, booking.ID.Hex())
+			}
+		}
+		return nil, err
 	}
-
-	// Verify booking is in PENDING state
-	if booking.BookingStatus != db.BookingStatusPending {
-		return nil, ErrCanOnlyCancelPending.WithErr(fmt.Errorf("booking status is %s", booking.BookingStatus))
+	if penalty > 0 {
+		if err := a.database.UserService.AddTokens(ctx, booking.ToUserID, penalty); err != nil {
+			log.Error().Err(err).Msgf("could not pay the %d tokens penalty of booking %s to the owner", penalty, booking.ID.Hex())
+		}
+		if err := a.database.BookingService.SetCancellationPenalty(ctx, booking.ID, penalty); err != nil {
+			log.Error().Err(err).Msgf("could not store the penalty of booking %s", booking.ID.Hex())
+		}
 	}
-
-	err = a.database.BookingService.UpdateStatus(r.Context.Request.Context(), petitionID, db.BookingStatusCancelled)
-	if err != nil {
-		return nil, ErrInternalServerError.WithErr(err)
+	// The dates of an accepted booking are released to the waitlist of the tool
+	if accepted {
+		a.processWaitlist(ctx, booking)
 	}
-
 	return nil, nil
 }
 
 // HandleReturnBooking handles POST /bookings/{bookingId}/return
 func (a *API) HandleReturnBooking(r *Request) (interface{}, error) {
-	if r.UserID == "" {
-		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
-	}
-
-	// Get user from database
-	user, err := a.getUserByID(r.UserID)
+	booking, subject, err := a.authorizedBookingFromRequest(r, "bookingId", policy.BookingReturn)
 	if err != nil {
-		return nil, ErrUserNotFound.WithErr(err)
+		return nil, err
 	}
 
-	bookingID, err := primitive.ObjectIDFromHex(chi.URLParam(r.Context.Request, "bookingId"))
-	if err != nil {
-		return nil, ErrInvalidRequestBodyData.WithErr(err)
-	}
+	return nil, a.transitionBooking(r, booking, subject.ID, db.BookingStatusReturned)
+}
 
-	booking, err := a.database.BookingService.Get(r.Context.Request.Context(), bookingID)
-	if err != nil {
-		return nil, ErrInternalServerError.WithErr(err)
+// transitionBooking moves the booking to the given status on behalf of the user, recording the
+// optional note of the request body in the booking history, and notifies the other party. The
+// accepted bookings start their payment and the returned ones pay the community fee.
+func (a *API) transitionBooking(r *Request, booking *db.Booking, by primitive.ObjectID, status db.BookingStatus) error {
+	var req BookingTransitionRequest
+	if len(r.Data) > 0 {
+		if err := json.Unmarshal(r.Data, &req); err != nil {
+			return ErrInvalidRequestBodyData.WithErr(err)
+		}
 	}
-	if booking == nil {
-		return nil, ErrBookingNotFound.WithErr(fmt.Errorf("booking with id %s not found", bookingID.Hex()))
-	}
-
-	// Verify user is the tool owner
-	if booking.ToUserID != user.ObjectID() {
-		return nil, ErrOnlyOwnerCanReturn.WithErr(fmt.Errorf("user %s is not the owner", user.ID))
+	if len(req.Note) > maxTransitionNoteLength {
+		return ErrInvalidRequestBodyData.WithErr(fmt.Errorf("note longer than %d characters", maxTransitionNoteLength))
 	}
+	ctx := r.Context.Request.Context()
+	if err := a.database.BookingService.UpdateStatus(ctx, booking.ID, status, by, req.Note); err != nil {
+		switch err {
+		case db.ErrBookingDatesConflict, db.ErrToolReservationBusy:
+			return ErrBookingAcceptConflict.WithErr(err)
+		case db.ErrBookingStatusChanged:
+			return ErrBookingStatusChanged.WithErr(err)
+		}
+		return ErrInternalServerError.WithErr(err)
+	}
+	switch status {
+	case db.BookingStatusAccepted:
+		a.startPayment(ctx, booking)
+	case db.BookingStatusReturned:
+		a.collectCommunityFee(ctx, booking)
+	}
+
+	// The owner side may be any admin of the community on shared community tools
+	recipient := booking.FromUserID
+	if by == booking.FromUserID {
+		recipient = booking.ToUserID
+	}
+	message := fmt.Sprintf("The booking of %s is now %s", a.bookingToolTitle(ctx, booking), strings.ToLower(string(status)))
+	if req.Note != "" {
+		message += ": " + req.Note
+	}
+	a.notify(ctx, &db.Notification{
+		UserID:    recipient,
+		Type:      db.NotificationBookingStatus,
+		Message:   message,
+		BookingID: booking.ID,
+	})
+	return nil
+}
 
-	err = a.database.BookingService.UpdateStatus(r.Context.Request.Context(), bookingID, db.BookingStatusReturned)
+// HandleGetBookingHistory handles GET /bookings/{bookingId}/history
+func (a *API) HandleGetBookingHistory(r *Request) (interface{}, error) {
+	booking, _, err := a.authorizedBookingFromRequest(r, "bookingId", policy.BookingRead)
 	if err != nil {
-		return nil, ErrInternalServerError.WithErr(err)
+		return nil, err
 	}
-
-	return nil, nil
+	history := make([]BookingTransition, len(booking.History))
+	for i, t := range booking.History {
+		history[i] = BookingTransition{
+			From: string(t.From),
+			To:   string(t.To),
+			At:   t.At.Unix(),
+			Note: t.Note,
+		}
+		if !t.By.IsZero() {
+			history[i].By = t.By.Hex()
+		}
+	}
+	return history, nil
 }
 
 // HandleGetPendingRatings handles GET /bookings/rates
@@ -328,71 +533,47 @@ type RateRequest struct {
 	BookingID string `json:"bookingId"`
 }
 
-// HandleCreateBooking handles POST /bookings
-func (a *API) HandleCreateBooking(r *Request) (interface{}, error) {
-	if r.UserID == "" {
-		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
-	}
-
-	// Get user from database
-	fromUser, err := a.getUserByID(r.UserID)
+// authorizeToolBooking checks the subject is allowed to book the tool, returning the tool owner.
+// The tools restricted to some communities can only be booked by their members.
+func (a *API) authorizeToolBooking(subject policy.Subject, tool *db.Tool) (*db.User, error) {
+	owner, err := a.database.UserService.GetUserByID(context.Background(), tool.UserID)
 	if err != nil {
-		return nil, ErrUserNotFound.WithErr(err)
+		return nil, ErrUserNotFound.WithErr(fmt.Errorf("tool owner not found: %w", err))
 	}
-
-	var req CreateBookingRequest
-	if err := json.Unmarshal(r.Data, &req); err != nil {
-		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	if err := authorize(policy.ToolBook, subject, toolOwnerResource(tool, owner)); err != nil {
+		return nil, err
 	}
-
-	toolID, err := strconv.ParseInt(req.ToolID, 10, 64)
-	if err != nil {
-		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	if isRestricted(tool) {
+		if err := authorize(policy.ToolView, subject, toolViewResource(tool, owner.Community)); err != nil {
+			return nil, err
+		}
 	}
-
-	// Get tool to verify it exists and get owner ID
-	tool, err := a.database.ToolService.GetToolByID(r.Context.Request.Context(), toolID)
-	if err != nil {
-		return nil, ErrBookingNotFound.WithErr(err)
+	if tool.PendingApproval {
+		return nil, ErrToolPendingApproval.WithErr(fmt.Errorf("tool %d is not approved yet", tool.ID))
 	}
-	if tool == nil {
-		return nil, ErrToolNotFound.WithErr(fmt.Errorf("tool with id %d not found", toolID))
-	}
-
-	toUser, err := a.database.UserService.GetUserByID(r.Context.Request.Context(), tool.UserID)
-	if err != nil {
-		return nil, ErrUserNotFound.WithErr(err)
+	if tool.Status == db.ToolStatusDraft {
+		return nil, ErrToolIsDraft.WithErr(fmt.Errorf("tool %d is not published yet", tool.ID))
 	}
+	return owner, nil
+}
 
-	// Create booking request
-	dbReq := &db.CreateBookingRequest{
-		ToolID:    fmt.Sprintf("%d", toolID),
-		StartDate: time.Unix(req.StartDate, 0),
-		EndDate:   time.Unix(req.EndDate, 0),
-		Contact:   req.Contact,
-		Comments:  req.Comments,
+// parseBookingOrigin validates the origin of a booking request. The origin is optional.
+func parseBookingOrigin(origin string) (db.BookingOrigin, error) {
+	if origin == "" {
+		return "", nil
 	}
-	booking, err := a.database.BookingService.Create(r.Context.Request.Context(), dbReq, fromUser.ObjectID(), toUser.ID)
-	if err != nil {
-		if err.Error() == "booking dates conflict with existing booking" {
-			return nil, ErrBookingDatesConflict.WithErr(err)
-		}
-		return nil, ErrInternalServerError.WithErr(err)
+	o := db.BookingOrigin(strings.ToUpper(strings.TrimSpace(origin)))
+	if !db.IsValidBookingOrigin(o) {
+		return "", ErrInvalidBookingOrigin.WithErr(fmt.Errorf("origin %q is not valid", origin))
 	}
-
-	return convertBookingToResponse(booking), nil
+	return o, nil
 }
 
 // HandleRateBooking handles POST /bookings/rates
 func (a *API) HandleRateBooking(r *Request) (interface{}, error) {
-	if r.UserID == "" {
-		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
-	}
-
-	// Get user from database
-	user, err := a.getUserByID(r.UserID)
+	subject, err := a.subject(r.UserID)
 	if err != nil {
-		return nil, ErrUserNotFound.WithErr(err)
+		return nil, err
 	}
 
 	var rateReq RateRequest
@@ -414,8 +595,8 @@ func (a *API) HandleRateBooking(r *Request) (interface{}, error) {
 	}
 
 	// Verify user is involved in the booking
-	if booking.FromUserID != user.ObjectID() && booking.ToUserID != user.ObjectID() {
-		return nil, ErrUserNotInvolved.WithErr(fmt.Errorf("user %s is neither the requester nor the owner", user.ID))
+	if err := authorize(policy.BookingRate, subject, bookingResource(booking)); err != nil {
+		return nil, err
 	}
 
 	// Verify rating value
@@ -423,9 +604,42 @@ func (a *API) HandleRateBooking(r *Request) (interface{}, error) {
 		return nil, ErrInvalidRating.WithErr(fmt.Errorf("rating value %d is not between 1 and 5", rateReq.Rating))
 	}
 
+	// The community admins rate the renter on behalf of the tool custodian
+	raterID := subject.ID
+	if booking.Community != "" && raterID != booking.FromUserID {
+		raterID = booking.ToUserID
+	}
+	err = a.database.BookingService.RateBooking(r.Context.Request.Context(), booking, raterID, rateReq.Rating)
+	if err == db.ErrAlreadyRated {
+		return nil, ErrBookingAlreadyRated.WithErr(err)
+	}
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	// The ratings of the renters make the aggregate rating of the tool
+	if raterID == booking.FromUserID {
+		a.addToolRating(r.Context.Request.Context(), booking.ToolID, rateReq.Rating)
+	}
 	return nil, nil
 }
 
+// addToolRating adds the rating to the aggregate rating of the tool. Errors are logged,
+// as the booking is already rated.
+func (a *API) addToolRating(ctx context.Context, toolID string, rating int) {
+	id, err := strconv.ParseInt(toolID, 10, 64)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid tool id %q", toolID)
+		return
+	}
+	if err := a.database.ToolService.AddRating(ctx, id, rating); err != nil {
+		log.Error().Err(err).Msgf("could not add rating to tool %d", id)
+		return
+	}
+	if tool, err := a.database.ToolService.GetToolByID(ctx, id); err == nil {
+		a.invalidateToolCaches(tool.Location)
+	}
+}
+
 // HandleCountPendingActions handles GET /bookings/pending
 func (a *API) HandleCountPendingActions(r *Request) (interface{}, error) {
 	if r.UserID == "" {
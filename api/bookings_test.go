@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseBookingListOptions(t *testing.T) {
+	c := qt.New(t)
+	parse := func(query string) (*db.BookingListOptions, error) {
+		hc := &HTTPContext{Request: httptest.NewRequest(http.MethodGet, "/bookings/requests"+query, nil)}
+		return parseBookingListOptions(hc)
+	}
+
+	opts, err := parse("")
+	c.Assert(err, qt.IsNil)
+	c.Assert(opts, qt.DeepEquals, &db.BookingListOptions{})
+
+	user := primitive.NewObjectID()
+	opts, err = parse("?status=pending&status=ACCEPTED&toolId=42&user=" + user.Hex() +
+		"&from=1700000000&to=1700086400&sort=startDate&order=asc&includeArchived=true")
+	c.Assert(err, qt.IsNil)
+	c.Assert(opts, qt.DeepEquals, &db.BookingListOptions{
+		Statuses:        []db.BookingStatus{db.BookingStatusPending, db.BookingStatusAccepted},
+		ToolID:          "42",
+		Counterpart:     user,
+		From:            time.Unix(1700000000, 0),
+		To:              time.Unix(1700086400, 0),
+		SortBy:          db.BookingSortStartDate,
+		Ascending:       true,
+		IncludeArchived: true,
+	})
+
+	for _, query := range []string{
+		"?status=LOST",
+		"?toolId=drill",
+		"?user=me",
+		"?from=yesterday",
+		"?from=1700086400&to=1700000000",
+		"?sort=endDate",
+		"?order=up",
+		"?includeArchived=maybe",
+	} {
+		_, err := parse(query)
+		c.Assert(err, qt.IsNotNil, qt.Commentf("query %s", query))
+	}
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxCommunityFee is the maximum fee a community charges on each returned booking.
+	maxCommunityFee = 10
+	// maxPayoutReasonLength is the maximum length of the reason of a payout of a community pool.
+	maxPayoutReasonLength = 500
+)
+
+// communityFeeHandler handles PUT /communities/{id}/pool/fee
+// A community admin sets the fee paid to the token pool of the community by the renter of each
+// returned booking of the tools of its members, 0 to charge no fee.
+func (a *API) communityFeeHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityModerate)
+	if err != nil {
+		return nil, err
+	}
+	var req CommunityFeeRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if req.Fee > maxCommunityFee {
+		return nil, ErrInvalidCommunityFee.WithErr(fmt.Errorf("fee of %d tokens", req.Fee))
+	}
+	ctx := r.Context.Request.Context()
+	if err := a.database.CommunityService.SetFee(ctx, community, req.Fee); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	pool, err := a.database.CommunityService.GetCommunity(ctx, community)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &CommunityPool{Community: community, Tokens: pool.Tokens, Fee: pool.Fee}, nil
+}
+
+// communityPayoutHandler handles POST /communities/{id}/pool/payouts
+// A community admin pays tokens of the pool to a member, i.e. to repair a shared tool, with the
+// reason of the payout. The admins cannot pay themselves.
+func (a *API) communityPayoutHandler(r *Request) (interface{}, error) {
+	subject, community, err := a.communityFromRequest(r, policy.CommunityModerate)
+	if err != nil {
+		return nil, err
+	}
+	var req PayoutRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if req.Amount == 0 || reason == "" {
+		return nil, ErrInvalidPayout.WithErr(fmt.Errorf("payout of %d tokens with reason %q", req.Amount, reason))
+	}
+	if len(reason) > maxPayoutReasonLength {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("reason longer than %d characters", maxPayoutReasonLength))
+	}
+	payeeID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if err := authorize(policy.CommunityModerate, subject, policy.Resource{Community: community, OwnerID: payeeID}); err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	payee, err := a.database.UserService.GetUserByID(ctx, payeeID)
+	if err != nil {
+		return nil, ErrUserNotFound.WithErr(err)
+	}
+	if payee.Community != community {
+		return nil, ErrNotCommunityMember.WithErr(fmt.Errorf("user %s is not a member of community %s", payeeID.Hex(), community))
+	}
+
+	if err := a.database.CommunityService.SpendTokens(ctx, community, req.Amount); err != nil {
+		if err == db.ErrNotEnoughTokens {
+			return nil, ErrPoolNotEnoughTokens.WithErr(fmt.Errorf("payout of %d tokens", req.Amount))
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if err := a.database.UserService.AddTokens(ctx, payeeID, req.Amount); err != nil {
+		if err := a.database.CommunityService.AddTokens(ctx, community, req.Amount); err != nil {
+			log.Error().Err(err).Msgf("could not refund %d tokens to community %s", req.Amount, community)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	movement := &db.PoolMovement{
+		Community: community,
+		Kind:      db.PoolMovementPayout,
+		Amount:    req.Amount,
+		UserID:    payeeID,
+		CreatedBy: subject.ID,
+		Reason:    db.SanitizeString(reason),
+	}
+	if err := a.database.PoolService.InsertMovement(ctx, movement); err != nil {
+		log.Error().Err(err).Msgf("could not record the payout of %d tokens of community %s", req.Amount, community)
+	}
+	a.notify(ctx, &db.Notification{
+		UserID:  payeeID,
+		Type:    db.NotificationPoolPayout,
+		Message: fmt.Sprintf("The %s community paid you %d tokens: %s", community, req.Amount, movement.Reason),
+	})
+	return new(PoolMovement).FromDBPoolMovement(movement), nil
+}
+
+// communityPoolMovementsHandler handles GET /communities/{id}/pool/movements?kind=&page=
+// Returns the fees paid to the token pool of the community and its payouts, newest first, only
+// those of the kind (FEE or PAYOUT) if given, visible to its members.
+func (a *API) communityPoolMovementsHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	kind := db.PoolMovementKind(strings.ToUpper(r.Context.Request.URL.Query().Get("kind")))
+	switch kind {
+	case "", db.PoolMovementFee, db.PoolMovementPayout:
+	default:
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid pool movement kind %q", kind))
+	}
+	movements, err := a.database.PoolService.GetMovements(r.Context.Request.Context(), community, kind, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := []*PoolMovement{}
+	for _, m := range movements {
+		result = append(result, new(PoolMovement).FromDBPoolMovement(m))
+	}
+	return result, nil
+}
+
+// collectCommunityFee charges the renter of the returned booking the fee of the community of
+// the owner, paid to its token pool. The shared community tools are not charged, their price
+// already goes to the pool. A failure is logged, the booking is returned anyway, and the fee
+// is not collected if the renter has not enough tokens.
+func (a *API) collectCommunityFee(ctx context.Context, booking *db.Booking) {
+	if booking.Community != "" {
+		return
+	}
+	owner, err := a.database.UserService.GetUserByID(ctx, booking.ToUserID)
+	if err != nil || owner.Community == "" {
+		return
+	}
+	pool, err := a.database.CommunityService.GetCommunity(ctx, owner.Community)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not get the fee of community %s", owner.Community)
+		return
+	}
+	if pool.Fee == 0 {
+		return
+	}
+	if err := a.database.UserService.SpendTokens(ctx, booking.FromUserID, pool.Fee); err != nil {
+		log.Warn().Err(err).Msgf("could not charge the %d tokens fee of booking %s", pool.Fee, booking.ID.Hex())
+		return
+	}
+	if err := a.database.CommunityService.AddTokens(ctx, pool.ID, pool.Fee); err != nil {
+		log.Error().Err(err).Msgf("could not add the %d tokens fee of booking %s to community %s",
+			pool.Fee, booking.ID.Hex(), pool.ID)
+		return
+	}
+	if err := a.database.BookingService.SetCommunityFee(ctx, booking.ID, pool.Fee); err != nil {
+		log.Error().Err(err).Msgf("could not store the fee of booking %s", booking.ID.Hex())
+	}
+	if err := a.database.PoolService.InsertMovement(ctx, &db.PoolMovement{
+		Community: pool.ID,
+		Kind:      db.PoolMovementFee,
+		Amount:    pool.Fee,
+		UserID:    booking.FromUserID,
+		BookingID: booking.ID,
+	}); err != nil {
+		log.Error().Err(err).Msgf("could not record the fee of booking %s", booking.ID.Hex())
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxRejectReasonLength is the maximum length of the reason a community tool is rejected.
+const maxRejectReasonLength = 500
+
+// communityPoolHandler handles GET /communities/{id}/pool
+// Returns the tokens collected by the shared tools of the community and the fees of the
+// bookings of its members, with the fee it charges, visible to its members.
+func (a *API) communityPoolHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := a.database.CommunityService.GetCommunity(r.Context.Request.Context(), community)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &CommunityPool{Community: community, Tokens: pool.Tokens, Fee: pool.Fee}, nil
+}
+
+// communityBookingsHandler handles GET /communities/{id}/bookings?page=
+// Returns the bookings of the shared tools of the community, newest first, so any of its
+// admins can manage them.
+func (a *API) communityBookingsHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityModerate)
+	if err != nil {
+		return nil, err
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	bookings, err := a.database.BookingService.GetCommunityBookings(r.Context.Request.Context(), community, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	response := make([]BookingResponse, len(bookings))
+	for i, booking := range bookings {
+		response[i] = convertBookingToResponse(booking)
+	}
+	return response, nil
+}
+
+// acceptCommunityBooking accepts a booking of a shared community tool. The renter pays the
+// price of the booking to the token pool of the community.
+func (a *API) acceptCommunityBooking(r *Request, booking *db.Booking, by primitive.ObjectID) error {
+	ctx := r.Context.Request.Context()
+	cost, err := a.communityBookingCost(ctx, booking)
+	if err != nil {
+		return err
+	}
+	if cost > 0 {
+		if err := a.database.UserService.SpendTokens(ctx, booking.FromUserID, cost); err != nil {
+			if err == db.ErrNotEnoughTokens {
+				return ErrNotEnoughTokens.WithErr(fmt.Errorf("booking costs %d tokens", cost))
+			}
+			return ErrInternalServerError.WithErr(err)
+		}
+	}
+	if err := a.transitionBooking(r, booking, by, db.BookingStatusAccepted); err != nil {
+		if cost > 0 {
+			if err := a.database.UserService.AddTokens(ctx, booking.FromUserID, cost); err != nil {
+				log.Error().Err(err).Msgf("could not refund %d tokens of booking %s", cost, booking.ID.Hex())
+			}
+		}
+		return err
+	}
+	if cost > 0 {
+		if err := a.database.CommunityService.AddTokens(ctx, booking.Community, cost); err != nil {
+			log.Error().Err(err).Msgf("could not add %d tokens of booking %s to community %s",
+				cost, booking.ID.Hex(), booking.Community)
+		}
+	}
+	return nil
+}
+
+// communityBookingCost returns the tokens a booking costs: its price, or for the bookings
+// requested before the pricing modes the cost of the tool for each started day of the
+// booking. Bookings of deleted tools cost nothing.
+func (a *API) communityBookingCost(ctx context.Context, booking *db.Booking) (uint64, error) {
+	if booking.Price != nil {
+		return *booking.Price, nil
+	}
+	id, err := strconv.ParseInt(booking.ToolID, 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+	tool, err := a.database.ToolService.GetToolByID(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, ErrInternalServerError.WithErr(err)
+	}
+	return tool.Cost * bookingDays(booking.StartDate, booking.EndDate), nil
+}
+
+// pendingCommunityToolsHandler handles GET /communities/{id}/tools/pending?page=
+// Returns the tools shared by the members of the community waiting for the approval of its
+// admins, the oldest first.
+func (a *API) pendingCommunityToolsHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityModerate)
+	if err != nil {
+		return nil, err
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	tools, err := a.database.ToolService.GetPendingCommunityTools(r.Context.Request.Context(), community, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := []*Tool{}
+	for _, tool := range tools {
+		result = append(result, new(Tool).FromDBTool(tool))
+	}
+	showToolIdentifiers(result...)
+	return result, nil
+}
+
+// approveCommunityToolHandler handles PUT /communities/{id}/tools/{toolId}/approve
+// A community admin lists a tool shared by a member in the community catalog.
+func (a *API) approveCommunityToolHandler(r *Request) (interface{}, error) {
+	tool, community, err := a.pendingCommunityToolFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	approved, err := a.database.ToolService.ApproveTool(ctx, tool.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if !approved {
+		return nil, ErrToolNotPendingApproval.WithErr(fmt.Errorf("tool %d is not pending approval", tool.ID))
+	}
+	a.invalidateToolCaches(tool.Location)
+	a.notify(ctx, &db.Notification{
+		UserID:  tool.UserID,
+		Type:    db.NotificationToolApproval,
+		Message: fmt.Sprintf("%s has been approved and is now shared with the %s community", tool.Title, community),
+		ToolID:  tool.ID,
+	})
+	return nil, nil
+}
+
+// rejectCommunityToolHandler handles PUT /communities/{id}/tools/{toolId}/reject
+// A community admin rejects a tool shared by a member, with an optional reason. The tool goes
+// back to the member as one of their own tools, unavailable.
+func (a *API) rejectCommunityToolHandler(r *Request) (interface{}, error) {
+	var req RejectCommunityToolRequest
+	if len(r.Data) > 0 {
+		if err := json.Unmarshal(r.Data, &req); err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(err)
+		}
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > maxRejectReasonLength {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("reason longer than %d characters", maxRejectReasonLength))
+	}
+	tool, community, err := a.pendingCommunityToolFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	rejected, err := a.database.ToolService.RejectTool(ctx, tool.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if !rejected {
+		return nil, ErrToolNotPendingApproval.WithErr(fmt.Errorf("tool %d is not pending approval", tool.ID))
+	}
+	message := fmt.Sprintf("%s has not been approved by the %s community admins", tool.Title, community)
+	if reason != "" {
+		message += ": " + reason
+	}
+	a.notify(ctx, &db.Notification{
+		UserID:  tool.UserID,
+		Type:    db.NotificationToolApproval,
+		Message: message,
+		ToolID:  tool.ID,
+	})
+	return nil, nil
+}
+
+// pendingCommunityToolFromRequest returns the tool of the {toolId} URL parameter, which must
+// be pending approval in the community of the {id} URL parameter, if the user is an admin of
+// the community.
+func (a *API) pendingCommunityToolFromRequest(r *Request) (*db.Tool, string, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityModerate)
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r.Context.Request, "toolId"), 10, 64)
+	if err != nil {
+		return nil, "", ErrInvalidRequestBodyData.WithErr(err)
+	}
+	tool, err := a.toolFromDB(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if tool.Community != community {
+		return nil, "", ErrToolNotFound.WithErr(fmt.Errorf("tool %d is not shared with community %s", id, community))
+	}
+	if !tool.PendingApproval {
+		return nil, "", ErrToolNotPendingApproval.WithErr(fmt.Errorf("tool %d is not pending approval", id))
+	}
+	return tool, community, nil
+}
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// crowdfundFromRequest returns the crowdfund of the URL, which must belong to the community.
+func (a *API) crowdfundFromRequest(r *Request, community string) (*db.Crowdfund, error) {
+	crowdfundParam := r.Context.URLParam("crowdfundId")
+	if crowdfundParam == nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing crowdfund id"))
+	}
+	id, err := primitive.ObjectIDFromHex(crowdfundParam[0])
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	crowdfund, err := a.database.CrowdfundService.GetCrowdfund(r.Context.Request.Context(), community, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCrowdfundNotFound.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return crowdfund, nil
+}
+
+// createCrowdfundHandler handles POST /communities/{id}/crowdfunds
+// Any member can start a crowdfund to buy a tool for the community, giving the tokens to
+// collect.
+func (a *API) createCrowdfundHandler(r *Request) (interface{}, error) {
+	subject, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	var req CrowdfundRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	title, description := strings.TrimSpace(req.Title), strings.TrimSpace(req.Description)
+	if title == "" || description == "" {
+		return nil, ErrEmptyTitleOrDescription.WithErr(fmt.Errorf("crowdfund without title or description"))
+	}
+	if len(title) > maxPostTitleLength || len(description) > maxPostBodyLength {
+		return nil, ErrInvalidRequestBodyData.WithErr(
+			fmt.Errorf("title or description longer than %d and %d characters", maxPostTitleLength, maxPostBodyLength))
+	}
+	if req.Goal == 0 {
+		return nil, ErrInvalidCrowdfundGoal.WithErr(fmt.Errorf("crowdfund without goal"))
+	}
+	if req.ToolCategory != 0 && !a.validToolCategory(req.ToolCategory) {
+		return nil, ErrInvalidToolCategory.WithErr(fmt.Errorf("category %d is not valid", req.ToolCategory))
+	}
+
+	crowdfund := &db.Crowdfund{
+		Community:      community,
+		CreatedBy:      subject.ID,
+		Title:          db.SanitizeString(title),
+		Description:    description,
+		ToolCategory:   req.ToolCategory,
+		EstimatedValue: req.EstimatedValue,
+		Goal:           req.Goal,
+	}
+	if err := a.database.CrowdfundService.InsertCrowdfund(r.Context.Request.Context(), crowdfund); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	return new(Crowdfund).FromDBCrowdfund(crowdfund), nil
+}
+
+// crowdfundsHandler handles GET /communities/{id}/crowdfunds?status=&page=
+// Returns the crowdfunds of the community, newest first, only those with the status (OPEN,
+// COMPLETED or CANCELLED) if given.
+func (a *API) crowdfundsHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	status := db.CrowdfundStatus(strings.ToUpper(r.Context.Request.URL.Query().Get("status")))
+	switch status {
+	case "", db.CrowdfundOpen, db.CrowdfundCompleted, db.CrowdfundCancelled:
+	default:
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid crowdfund status %q", status))
+	}
+	crowdfunds, err := a.database.CrowdfundService.GetCommunityCrowdfunds(r.Context.Request.Context(), community, status, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := &CrowdfundsWrapper{Crowdfunds: []*Crowdfund{}}
+	for _, c := range crowdfunds {
+		result.Crowdfunds = append(result.Crowdfunds, new(Crowdfund).FromDBCrowdfund(c))
+	}
+	return result, nil
+}
+
+// crowdfundHandler handles GET /communities/{id}/crowdfunds/{crowdfundId}
+func (a *API) crowdfundHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	crowdfund, err := a.crowdfundFromRequest(r, community)
+	if err != nil {
+		return nil, err
+	}
+	return new(Crowdfund).FromDBCrowdfund(crowdfund), nil
+}
+
+// pledgeCrowdfundHandler handles POST /communities/{id}/crowdfunds/{crowdfundId}/pledge
+// A member pledges tokens to an open crowdfund, up to the tokens left to reach its goal. The
+// tokens are taken from the member, and given back if the crowdfund is cancelled or the
+// member withdraws the pledge.
+func (a *API) pledgeCrowdfundHandler(r *Request) (interface{}, error) {
+	subject, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	crowdfund, err := a.crowdfundFromRequest(r, community)
+	if err != nil {
+		return nil, err
+	}
+	var req PledgeRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if req.Amount == 0 {
+		return nil, ErrInvalidPledge.WithErr(fmt.Errorf("pledge without amount"))
+	}
+	if crowdfund.Status != db.CrowdfundOpen || crowdfund.Pledged+req.Amount > crowdfund.Goal {
+		return nil, ErrCrowdfundConflict.WithErr(
+			fmt.Errorf("crowdfund %s is %s with %d of %d tokens", crowdfund.ID.Hex(), crowdfund.Status, crowdfund.Pledged, crowdfund.Goal))
+	}
+
+	ctx := r.Context.Request.Context()
+	if err := a.database.UserService.SpendTokens(ctx, subject.ID, req.Amount); err != nil {
+		if err == db.ErrNotEnoughTokens {
+			return nil, ErrNotEnoughTokens.WithErr(fmt.Errorf("pledge of %d tokens", req.Amount))
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	updated, err := a.database.CrowdfundService.Pledge(ctx, crowdfund.ID, subject.ID, req.Amount)
+	if err != nil {
+		if err := a.database.UserService.AddTokens(ctx, subject.ID, req.Amount); err != nil {
+			log.Error().Err(err).Msgf("could not refund %d tokens pledged to crowdfund %s", req.Amount, crowdfund.ID.Hex())
+		}
+		if errors.Is(err, db.ErrCrowdfundConflict) {
+			return nil, ErrCrowdfundConflict.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return new(Crowdfund).FromDBCrowdfund(updated), nil
+}
+
+// withdrawCrowdfundHandler handles DELETE /communities/{id}/crowdfunds/{crowdfundId}/pledge
+// A member withdraws the pledges to an open crowdfund, getting the tokens back.
+func (a *API) withdrawCrowdfundHandler(r *Request) (interface{}, error) {
+	subject, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	crowdfund, err := a.crowdfundFromRequest(r, community)
+	if err != nil {
+		return nil, err
+	}
+	if crowdfund.Status != db.CrowdfundOpen {
+		return nil, ErrCrowdfundConflict.WithErr(fmt.Errorf("crowdfund %s is %s", crowdfund.ID.Hex(), crowdfund.Status))
+	}
+
+	ctx := r.Context.Request.Context()
+	amount, err := a.database.CrowdfundService.Withdraw(ctx, crowdfund, subject.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrCrowdfundConflict) {
+			return nil, ErrCrowdfundConflict.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if amount > 0 {
+		if err := a.database.UserService.AddTokens(ctx, subject.ID, amount); err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
+		}
+	}
+	updated, err := a.database.CrowdfundService.GetCrowdfund(ctx, community, crowdfund.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return new(Crowdfund).FromDBCrowdfund(updated), nil
+}
+
+// completeCrowdfundHandler handles POST /communities/{id}/crowdfunds/{crowdfundId}/complete
+// Once the goal is reached and the tool bought, a community admin registers it as a shared
+// tool of the community. The body is the tool, its title, description, category and estimated
+// value default to those of the crowdfund. The pledged tokens go to the token pool of the
+// community and the contributors are recorded in the tool.
+func (a *API) completeCrowdfundHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityModerate)
+	if err != nil {
+		return nil, err
+	}
+	crowdfund, err := a.crowdfundFromRequest(r, community)
+	if err != nil {
+		return nil, err
+	}
+	t := Tool{}
+	if err := json.Unmarshal(r.Data, &t); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if crowdfund.Status != db.CrowdfundOpen {
+		return nil, ErrCrowdfundConflict.WithErr(fmt.Errorf("crowdfund %s is %s", crowdfund.ID.Hex(), crowdfund.Status))
+	}
+	if crowdfund.Pledged < crowdfund.Goal {
+		return nil, ErrCrowdfundGoalNotReached.WithErr(
+			fmt.Errorf("crowdfund %s has %d of %d tokens", crowdfund.ID.Hex(), crowdfund.Pledged, crowdfund.Goal))
+	}
+	if t.Title == "" {
+		t.Title = crowdfund.Title
+	}
+	if t.Description == "" {
+		t.Description = crowdfund.Description
+	}
+	if t.Category == 0 {
+		t.Category = crowdfund.ToolCategory
+	}
+	if t.EstimatedValue == 0 {
+		t.EstimatedValue = crowdfund.EstimatedValue
+	}
+	t.Community = community
+
+	ctx := r.Context.Request.Context()
+	// The crowdfund is closed first, so no pledge is withdrawn while the tool is registered
+	completed, err := a.database.CrowdfundService.Complete(ctx, crowdfund.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrCrowdfundConflict) {
+			return nil, ErrCrowdfundConflict.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	toolID, err := a.addTool(&t, r.UserID)
+	if err != nil {
+		if err := a.database.CrowdfundService.Reopen(ctx, crowdfund.ID); err != nil {
+			log.Error().Err(err).Msgf("could not reopen crowdfund %s", crowdfund.ID.Hex())
+		}
+		return nil, err
+	}
+	if err := a.database.CrowdfundService.SetTool(ctx, completed.ID, toolID); err != nil {
+		log.Error().Err(err).Msgf("could not set tool %d of crowdfund %s", toolID, completed.ID.Hex())
+	}
+	completed.ToolID = toolID
+	contributors := crowdfundContributors(completed)
+	if err := a.database.ToolService.UpdateToolFields(ctx, toolID, map[string]interface{}{
+		"contributors": contributors,
+	}); err != nil {
+		log.Error().Err(err).Msgf("could not set the contributors of tool %d", toolID)
+	}
+	if err := a.database.CommunityService.AddTokens(ctx, community, completed.Pledged); err != nil {
+		log.Error().Err(err).Msgf("could not add %d tokens of crowdfund %s to community %s",
+			completed.Pledged, completed.ID.Hex(), community)
+	}
+	a.notifyContributors(ctx, completed, contributors,
+		fmt.Sprintf("The crowdfund %s is completed, the tool is now shared by the community", completed.Title))
+	return new(Crowdfund).FromDBCrowdfund(completed), nil
+}
+
+// cancelCrowdfundHandler handles POST /communities/{id}/crowdfunds/{crowdfundId}/cancel
+// The member who started an open crowdfund, or a community admin, cancels it. The pledged
+// tokens are given back to the contributors.
+func (a *API) cancelCrowdfundHandler(r *Request) (interface{}, error) {
+	subject, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	crowdfund, err := a.crowdfundFromRequest(r, community)
+	if err != nil {
+		return nil, err
+	}
+	if crowdfund.CreatedBy != subject.ID {
+		if err := authorize(policy.CommunityModerate, subject, policy.Resource{Community: community}); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := r.Context.Request.Context()
+	cancelled, err := a.database.CrowdfundService.Cancel(ctx, crowdfund.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrCrowdfundConflict) {
+			return nil, ErrCrowdfundConflict.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	contributors := crowdfundContributors(cancelled)
+	for _, c := range contributors {
+		if err := a.database.UserService.AddTokens(ctx, c.UserID, c.Amount); err != nil {
+			log.Error().Err(err).Msgf("could not refund %d tokens of crowdfund %s to user %s",
+				c.Amount, cancelled.ID.Hex(), c.UserID.Hex())
+		}
+	}
+	a.notifyContributors(ctx, cancelled, contributors,
+		fmt.Sprintf("The crowdfund %s was cancelled, your pledge has been given back", cancelled.Title))
+	return new(Crowdfund).FromDBCrowdfund(cancelled), nil
+}
+
+// crowdfundContributors returns the contributors of the crowdfund with the sum of their
+// pledges, in the order they first pledged.
+func crowdfundContributors(crowdfund *db.Crowdfund) []db.ToolContributor {
+	contributors := []db.ToolContributor{}
+	index := make(map[primitive.ObjectID]int)
+	for _, c := range crowdfund.Contributions {
+		i, ok := index[c.UserID]
+		if !ok {
+			i = len(contributors)
+			index[c.UserID] = i
+			contributors = append(contributors, db.ToolContributor{UserID: c.UserID})
+		}
+		contributors[i].Amount += c.Amount
+	}
+	return contributors
+}
+
+// notifyContributors notifies the contributors of the crowdfund about its completion or
+// cancellation.
+func (a *API) notifyContributors(ctx context.Context, crowdfund *db.Crowdfund, contributors []db.ToolContributor,
+	message string,
+) {
+	for _, c := range contributors {
+		a.notify(ctx, &db.Notification{
+			UserID:  c.UserID,
+			Type:    db.NotificationCrowdfund,
+			Message: message,
+			ToolID:  crowdfund.ToolID,
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/push"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxDevicesPerUser is the maximum number of devices a user can register.
+	maxDevicesPerUser = 10
+	// maxDeviceTokenLength is the maximum length of a device token or subscription endpoint.
+	maxDeviceTokenLength = 2048
+)
+
+// registerDeviceHandler handles POST /profile/devices
+// It registers a device of the user to receive push notifications, with an FCM registration
+// token or a Web Push subscription.
+func (a *API) registerDeviceHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	var req DeviceRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	platform := push.Platform(strings.ToLower(req.Platform))
+	if !push.IsValidPlatform(platform) {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid platform %q", req.Platform))
+	}
+	if req.Token == "" || len(req.Token) > maxDeviceTokenLength {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid token"))
+	}
+	if platform == push.PlatformWebPush {
+		endpoint, err := url.Parse(req.Token)
+		if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid web push endpoint"))
+		}
+		if req.P256dh == "" || req.Auth == "" {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing web push subscription keys"))
+		}
+	}
+
+	ctx := r.Context.Request.Context()
+	devices, err := a.database.DeviceService.GetUserDevices(ctx, userID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	known := false
+	for _, d := range devices {
+		known = known || d.Token == req.Token
+	}
+	if !known && len(devices) >= maxDevicesPerUser {
+		return nil, ErrTooManyDevices.WithErr(fmt.Errorf("user %s has %d devices", userID.Hex(), len(devices)))
+	}
+
+	device := &db.Device{
+		UserID:   userID,
+		Platform: string(platform),
+		Token:    req.Token,
+		P256dh:   req.P256dh,
+		Auth:     req.Auth,
+	}
+	if err := a.database.DeviceService.RegisterDevice(ctx, device); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	return new(Device).FromDBDevice(device), nil
+}
+
+// devicesHandler handles GET /profile/devices
+func (a *API) devicesHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	devices, err := a.database.DeviceService.GetUserDevices(r.Context.Request.Context(), userID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := []*Device{}
+	for _, d := range devices {
+		result = append(result, new(Device).FromDBDevice(d))
+	}
+	return result, nil
+}
+
+// deleteDeviceHandler handles DELETE /profile/devices/{id}
+func (a *API) deleteDeviceHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	idParam := r.Context.URLParam("id")
+	if idParam == nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing device id"))
+	}
+	id, err := primitive.ObjectIDFromHex(idParam[0])
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if err := a.database.DeviceService.DeleteDevice(r.Context.Request.Context(), userID, id); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrDeviceNotFound.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
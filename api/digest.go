@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// digestInterval is the time between two digests of a user.
+	digestInterval = 7 * 24 * time.Hour
+	// digestDefaultRadius is the radius in meters of the digests if none is given.
+	digestDefaultRadius = 10000
+	// digestMaxRadius is the maximum radius in meters of the digests.
+	digestMaxRadius = 100000
+	// digestMaxTools is the maximum number of tools listed in a digest.
+	digestMaxTools = 10
+)
+
+// digestPreferencesHandler handles GET /profile/digest
+// Returns the settings of the weekly digest of new nearby tools.
+func (a *API) digestPreferencesHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return digestPreferences(user.Digest), nil
+}
+
+// updateDigestPreferencesHandler handles PUT /profile/digest
+// Enables or disables the weekly digest and sets its radius and whether it includes the tools
+// of the community of the user.
+func (a *API) updateDigestPreferencesHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var req DigestPreferences
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if req.Radius == 0 {
+		req.Radius = digestDefaultRadius
+	}
+	if req.Radius < 0 || req.Radius > digestMaxRadius {
+		return nil, ErrInvalidRequestBodyData.WithErr(
+			fmt.Errorf("radius must be between 1 and %d meters", digestMaxRadius))
+	}
+	digest := user.Digest
+	if digest == nil {
+		digest = &db.DigestPreferences{}
+	}
+	// The token is kept so the links of the digests already sent keep working
+	if digest.UnsubscribeToken == "" {
+		if digest.UnsubscribeToken, err = newUnsubscribeToken(); err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
+		}
+	}
+	digest.Enabled = req.Enabled
+	digest.Radius = req.Radius
+	digest.Community = req.Community
+	if err := a.database.UserService.SetDigestPreferences(r.Context.Request.Context(), user.ID, digest); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return digestPreferences(digest), nil
+}
+
+// digestUnsubscribeHandler handles GET /digest/unsubscribe?token=
+// Disables the digest of the user with the unsubscribe token of the digest emails, without
+// logging in.
+func (a *API) digestUnsubscribeHandler(r *Request) (interface{}, error) {
+	token := r.Context.URLParam("token")
+	if token == nil || token[0] == "" {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing token"))
+	}
+	err := a.database.UserService.UnsubscribeDigest(r.Context.Request.Context(), token[0])
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrUnsubscribeTokenNotFound
+	}
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// digestPreferences returns the digest settings of a user, the defaults if never set.
+func digestPreferences(digest *db.DigestPreferences) *DigestPreferences {
+	if digest == nil {
+		return &DigestPreferences{Radius: digestDefaultRadius}
+	}
+	return &DigestPreferences{
+		Enabled:    digest.Enabled,
+		Radius:     digest.Radius,
+		Community:  digest.Community,
+		LastSentAt: digest.LastSentAt,
+	}
+}
+
+// newUnsubscribeToken returns a random digest unsubscribe token.
+func newUnsubscribeToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// sendDigests emails the digest of the new tools to the users that enabled it and did not
+// receive one in the last digestInterval. The users without new tools get no email.
+func (a *API) sendDigests(ctx context.Context) error {
+	now := time.Now()
+	users, err := a.database.UserService.GetDigestSubscribers(ctx, now.Add(-digestInterval))
+	if err != nil {
+		return fmt.Errorf("could not get the digest subscribers: %w", err)
+	}
+	members := make(map[string][]primitive.ObjectID)
+	for _, user := range users {
+		opts := db.NewToolsOptions{
+			Since:         now.Add(-digestInterval),
+			Location:      user.Location,
+			Radius:        user.Digest.Radius,
+			ExcludeUserID: user.ID,
+			Limit:         digestMaxTools,
+		}
+		if user.Digest.LastSentAt != nil {
+			opts.Since = *user.Digest.LastSentAt
+		}
+		if user.Community != "" {
+			if _, ok := members[user.Community]; !ok {
+				ids, err := a.database.UserService.GetCommunityMemberIDs(ctx, user.Community)
+				if err != nil {
+					log.Error().Err(err).Msgf("could not get the members of community %s", user.Community)
+					continue
+				}
+				members[user.Community] = ids
+			}
+			// The tools restricted to the community of the user are also listed
+			opts.Viewer = &db.ToolViewer{Community: user.Community, Members: members[user.Community]}
+			if user.Digest.Community {
+				opts.Community, opts.Members = user.Community, members[user.Community]
+			}
+		}
+		tools, total, err := a.database.ToolService.GetNewTools(ctx, opts)
+		if err != nil {
+			log.Error().Err(err).Msgf("could not get the new tools for the digest of user %s", user.ID.Hex())
+			continue
+		}
+		if len(tools) > 0 {
+			a.sendDigest(ctx, user, tools, int(total))
+		}
+		if err := a.database.UserService.SetDigestSent(ctx, user.ID, now); err != nil {
+			log.Error().Err(err).Msgf("could not store the digest of user %s", user.ID.Hex())
+		}
+	}
+	return nil
+}
+
+// sendDigest emails the digest of the given new tools, out of total, to the user.
+func (a *API) sendDigest(ctx context.Context, user *db.User, tools []*db.Tool, total int) {
+	digest := &mail.Digest{
+		AppName: a.branding.AppName,
+		Name:    user.Name,
+		Tools:   make([]mail.DigestTool, len(tools)),
+		More:    total - len(tools),
+	}
+	for i, tool := range tools {
+		digest.Tools[i] = mail.DigestTool{
+			Title:    tool.Title,
+			Locality: tool.Locality,
+			Cost:     tool.Cost,
+		}
+	}
+	if a.publicURL != "" {
+		digest.UnsubscribeURL = strings.TrimSuffix(a.publicURL, "/") +
+			"/digest/unsubscribe?token=" + url.QueryEscape(user.Digest.UnsubscribeToken)
+	}
+	msg, err := digest.Message(user.Email)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not create the digest of user %s", user.ID.Hex())
+		return
+	}
+	a.sendMail(ctx, msg)
+}
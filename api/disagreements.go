@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// otherParty returns the booking party that is not the given user.
+func otherParty(booking *db.Booking, userID primitive.ObjectID) primitive.ObjectID {
+	if booking.FromUserID == userID {
+		return booking.ToUserID
+	}
+	return booking.FromUserID
+}
+
+// HandleOpenDisagreement handles POST /bookings/{bookingId}/disagreement
+// Any party of a returned booking can disagree with the condition the tool was returned in,
+// providing a description and optional photo evidence.
+func (a *API) HandleOpenDisagreement(r *Request) (interface{}, error) {
+	booking, subject, err := a.authorizedBookingFromRequest(r, "bookingId", policy.BookingDisagree)
+	if err != nil {
+		return nil, err
+	}
+	userID := subject.ID
+	var req BookingDisagreementRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if strings.TrimSpace(req.Description) == "" {
+		return nil, ErrEmptyDisagreementDescription.WithErr(fmt.Errorf("description is empty"))
+	}
+	images, err := a.imageListFromSlice(req.Images)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	disagreement := &db.BookingDisagreement{
+		OpenedBy:    userID,
+		Description: req.Description,
+		Images:      images,
+		OpenedAt:    now,
+		Deadline:    now.Add(a.disagreementPeriod),
+	}
+	ctx := r.Context.Request.Context()
+	if err := a.database.BookingService.OpenDisagreement(ctx, booking.ID, disagreement); err != nil {
+		if err == db.ErrDisagreementConflict {
+			return nil, ErrDisagreementConflict.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.notify(ctx, &db.Notification{
+		UserID: otherParty(booking, userID),
+		Type:   db.NotificationDisagreement,
+		Message: fmt.Sprintf("The return condition of a booking has been disputed, resolve it before %s",
+			disagreement.Deadline.Format(time.DateOnly)),
+		BookingID: booking.ID,
+	})
+
+	booking.Disagreement = disagreement
+	return convertBookingToResponse(booking), nil
+}
+
+// HandleResolveDisagreement handles POST /bookings/{bookingId}/disagreement/resolve
+// Only the party that opened the disagreement can mark it as resolved before it is escalated,
+// the other party cannot close a complaint against it.
+func (a *API) HandleResolveDisagreement(r *Request) (interface{}, error) {
+	booking, subject, err := a.authorizedBookingFromRequest(r, "bookingId", policy.BookingDisagree)
+	if err != nil {
+		return nil, err
+	}
+	userID := subject.ID
+	if booking.Disagreement != nil && booking.Disagreement.OpenedBy != userID {
+		return nil, ErrOnlyOpenerCanResolve
+	}
+	ctx := r.Context.Request.Context()
+	if err := a.database.BookingService.ResolveDisagreement(ctx, booking.ID, userID); err != nil {
+		if err == db.ErrDisagreementConflict {
+			return nil, ErrDisagreementConflict.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.notify(ctx, &db.Notification{
+		UserID:    otherParty(booking, userID),
+		Type:      db.NotificationDisagreement,
+		Message:   "The return condition disagreement of a booking has been resolved",
+		BookingID: booking.ID,
+	})
+	return nil, nil
+}
+
+// escalateOverdueDisagreements escalates the disagreements not resolved before their deadline
+// to disputes, notifying both parties and the admins of the tool owner community.
+func (a *API) escalateOverdueDisagreements(ctx context.Context) error {
+	escalated, err := a.database.BookingService.EscalateOverdueDisagreements(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, booking := range escalated {
+		log.Info().Msgf("booking %s disagreement escalated to dispute", booking.ID.Hex())
+		for _, party := range []primitive.ObjectID{booking.FromUserID, booking.ToUserID} {
+			a.notify(ctx, &db.Notification{
+				UserID:    party,
+				Type:      db.NotificationDispute,
+				Message:   "The return condition disagreement was not resolved in time and has been escalated to the community admins",
+				BookingID: booking.ID,
+			})
+		}
+		admins, err := a.disputeAdmins(ctx, booking)
+		if err != nil {
+			log.Error().Err(err).Msgf("could not get admins for booking %s dispute", booking.ID.Hex())
+			continue
+		}
+		for _, admin := range admins {
+			a.notify(ctx, &db.Notification{
+				UserID:    admin.ID,
+				Type:      db.NotificationDispute,
+				Message:   "A booking return condition disagreement requires your mediation",
+				BookingID: booking.ID,
+			})
+		}
+	}
+	return nil
+}
+
+// disputeAdmins returns the admins of the tool owner community, falling back to every admin
+// if the community has none.
+func (a *API) disputeAdmins(ctx context.Context, booking *db.Booking) ([]*db.User, error) {
+	owner, err := a.database.UserService.GetUserByID(ctx, booking.ToUserID)
+	if err != nil {
+		return nil, err
+	}
+	return a.communityAdmins(ctx, owner.Community)
+}
@@ -5,10 +5,17 @@ import (
 	"strings"
 )
 
-// HTTPError represents an error with an HTTP status code
+// HTTPError represents an error with an HTTP status code and a stable machine-readable error
+// code, returned to the clients in the errorCode field of the response header. The error codes
+// are dotted lowercase identifiers (e.g. booking.conflict) that never change once released, so
+// clients can rely on them instead of the messages. They are documented in the ErrorCode
+// schema of docs/swagger.yaml. Data holds the optional details of the error returned in the
+// data field of the response (e.g. the end of a lockout).
 type HTTPError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code      int    `json:"code"`
+	ErrorCode string `json:"errorCode"`
+	Message   string `json:"message"`
+	Data      any    `json:"data,omitempty"`
 }
 
 func (e *HTTPError) Error() string {
@@ -16,12 +23,15 @@ func (e *HTTPError) Error() string {
 }
 
 // IsErr checks if the HTTPError is the same as the given error.
-// It compares the error code and the base error message, without taking into account the additional error details
-// introduced by WithErr.
+// It compares the error codes, or the base error messages if the given error is not an HTTPError, without taking
+// into account the additional error details introduced by WithErr.
 func (e *HTTPError) IsErr(err error) bool {
 	if err == nil {
 		return false
 	}
+	if httpErr, ok := err.(*HTTPError); ok && e.ErrorCode != "" && httpErr.ErrorCode != "" {
+		return e.ErrorCode == httpErr.ErrorCode
+	}
 	return strings.Split(e.Error(), ":")[0] == strings.Split(err.Error(), ":")[0]
 }
 
@@ -29,179 +39,889 @@ func (e *HTTPError) IsErr(err error) bool {
 // Returns a copy of the HTTPError with the appended error message.
 func (e *HTTPError) WithErr(err error) *HTTPError {
 	return &HTTPError{
-		Code:    e.Code,
-		Message: e.Message + ": " + err.Error(),
+		Code:      e.Code,
+		ErrorCode: e.ErrorCode,
+		Message:   e.Message + ": " + err.Error(),
+		Data:      e.Data,
+	}
+}
+
+// WithData returns a copy of the HTTPError with the given details of the error.
+func (e *HTTPError) WithData(data any) *HTTPError {
+	return &HTTPError{
+		Code:      e.Code,
+		ErrorCode: e.ErrorCode,
+		Message:   e.Message,
+		Data:      data,
 	}
 }
 
 // Authentication errors
 var (
 	ErrUnauthorized = &HTTPError{
-		Code:    http.StatusUnauthorized,
-		Message: "unauthorized access",
+		Code:      http.StatusUnauthorized,
+		ErrorCode: "auth.unauthorized",
+		Message:   "unauthorized access",
 	}
 	ErrInvalidRegisterAuthToken = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "invalid registration token",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "auth.invalid_register_token",
+		Message:   "invalid registration token",
+	}
+	ErrSessionNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "auth.session_not_found",
+		Message:   "session not found",
 	}
 	ErrWrongLogin = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "invalid credentials",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "auth.invalid_credentials",
+		Message:   "invalid credentials",
+	}
+	ErrWeakPassword = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "auth.weak_password",
+		Message:   "the password does not follow the password policy",
+	}
+	ErrLoginLocked = &HTTPError{
+		Code:      http.StatusTooManyRequests,
+		ErrorCode: "auth.login_locked",
+		Message:   "too many failed logins, try again later",
 	}
 )
 
 // Request validation errors
 var (
 	ErrInvalidRequestBodyData = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "invalid request body data",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "request.invalid_data",
+		Message:   "invalid request body data",
 	}
 	ErrInvalidJSON = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "invalid JSON body",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "request.invalid_json",
+		Message:   "invalid JSON body",
+	}
+	ErrVersionRequired = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "request.version_required",
+		Message:   "the version of the object being changed is required",
+	}
+	ErrInvalidIdempotencyKey = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "request.invalid_idempotency_key",
+		Message:   "the idempotency key must have at most 255 characters",
 	}
 	ErrInvalidImageFormat = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "invalid image format",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "image.invalid_format",
+		Message:   "invalid image format",
 	}
 	ErrInvalidHash = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "invalid hash",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "image.invalid_hash",
+		Message:   "invalid hash",
 	}
 	ErrInvalidBookingDates = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "invalid booking dates",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "booking.invalid_dates",
+		Message:   "invalid booking dates",
 	}
 	ErrInvalidRating = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "invalid rating value (must be between 1 and 5)",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "booking.invalid_rating",
+		Message:   "invalid rating value (must be between 1 and 5)",
 	}
 )
 
 // Resource not found errors
 var (
 	ErrImageNotFound = &HTTPError{
-		Code:    http.StatusNotFound,
-		Message: "image not found",
+		Code:      http.StatusNotFound,
+		ErrorCode: "image.not_found",
+		Message:   "image not found",
 	}
 	ErrToolNotFound = &HTTPError{
-		Code:    http.StatusNotFound,
-		Message: "tool not found",
+		Code:      http.StatusNotFound,
+		ErrorCode: "tool.not_found",
+		Message:   "tool not found",
 	}
 	ErrBookingNotFound = &HTTPError{
-		Code:    http.StatusNotFound,
-		Message: "booking not found",
+		Code:      http.StatusNotFound,
+		ErrorCode: "booking.not_found",
+		Message:   "booking not found",
 	}
 	ErrUserNotFound = &HTTPError{
-		Code:    http.StatusNotFound,
-		Message: "user not found",
+		Code:      http.StatusNotFound,
+		ErrorCode: "user.not_found",
+		Message:   "user not found",
 	}
 	ErrInvalidUserID = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "invalid user id format",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "user.invalid_id",
+		Message:   "invalid user id format",
+	}
+	ErrSavedSearchNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "saved_search.not_found",
+		Message:   "saved search not found",
+	}
+	ErrInviteNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "invite.not_found",
+		Message:   "unused invite code not found",
+	}
+	ErrNotificationNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "notification.not_found",
+		Message:   "notification not found",
+	}
+	ErrRecoveryNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "recovery.not_found",
+		Message:   "account recovery request not found",
+	}
+	ErrAccountRecoveryDisabled = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "recovery.disabled",
+		Message:   "account recovery by admins is not enabled",
+	}
+	ErrFavoriteNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "favorite.not_found",
+		Message:   "tool is not a favorite",
+	}
+	ErrDeviceNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "device.not_found",
+		Message:   "device not found",
+	}
+	ErrPostNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "post.not_found",
+		Message:   "post not found",
+	}
+	ErrWaitlistEntryNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "waitlist.not_found",
+		Message:   "user is not in the waitlist of the tool",
+	}
+	ErrMediaNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "media.not_found",
+		Message:   "media not found",
 	}
 )
 
 // Permission errors
 var (
 	ErrToolNotOwnedByUser = &HTTPError{
-		Code:    http.StatusForbidden,
-		Message: "tool not owned by user",
+		Code:      http.StatusForbidden,
+		ErrorCode: "tool.not_owned",
+		Message:   "tool not owned by user",
 	}
 	ErrOnlyOwnerCanReturn = &HTTPError{
-		Code:    http.StatusForbidden,
-		Message: "only tool owner can mark as returned",
+		Code:      http.StatusForbidden,
+		ErrorCode: "booking.owner_only_return",
+		Message:   "only tool owner can mark as returned",
 	}
 	ErrOnlyOwnerCanAccept = &HTTPError{
-		Code:    http.StatusForbidden,
-		Message: "only tool owner can accept petitions",
+		Code:      http.StatusForbidden,
+		ErrorCode: "booking.owner_only_accept",
+		Message:   "only tool owner can accept petitions",
 	}
 	ErrOnlyOwnerCanDeny = &HTTPError{
-		Code:    http.StatusForbidden,
-		Message: "only tool owner can deny petitions",
+		Code:      http.StatusForbidden,
+		ErrorCode: "booking.owner_only_deny",
+		Message:   "only tool owner can deny petitions",
 	}
 	ErrOnlyRequesterCanCancel = &HTTPError{
-		Code:    http.StatusForbidden,
-		Message: "only requester can cancel their requests",
+		Code:      http.StatusForbidden,
+		ErrorCode: "booking.requester_only_cancel",
+		Message:   "only requester can cancel their requests",
 	}
 	ErrUserNotInvolved = &HTTPError{
-		Code:    http.StatusForbidden,
-		Message: "user not involved in booking",
+		Code:      http.StatusForbidden,
+		ErrorCode: "booking.not_involved",
+		Message:   "user not involved in booking",
+	}
+	ErrUserBlocked = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "user.blocked",
+		Message:   "user is blocked",
+	}
+	ErrUserInactive = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "user.inactive",
+		Message:   "user is inactive",
+	}
+	ErrToolOwnerInactive = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "tool.owner_inactive",
+		Message:   "tool owner is inactive",
+	}
+	ErrCannotBookOwnTool = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "booking.own_tool",
+		Message:   "users cannot book their own tools",
+	}
+	ErrNotCommunityMember = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "community.not_member",
+		Message:   "user is not a member of the community",
+	}
+	ErrCommunityChangeNotAllowed = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "community.change_not_allowed",
+		Message:   "the community is only joined with an invite or changed by an admin",
+	}
+	ErrActionNotAllowed = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "request.not_allowed",
+		Message:   "action not allowed",
+	}
+	ErrAdminRequired = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "auth.admin_required",
+		Message:   "admin role required",
+	}
+	ErrCannotApproveOwnRecovery = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "recovery.self_approval",
+		Message:   "cannot approve your own account recovery",
 	}
 )
 
 // Conflict errors
 var (
 	ErrBookingDatesConflict = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "booking dates conflict with existing booking",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "booking.conflict",
+		Message:   "booking dates conflict with existing booking",
+	}
+	ErrBookingAcceptConflict = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "booking.accept_conflict",
+		Message:   "another booking of the tool was accepted for overlapping dates",
+	}
+	ErrBookingStatusChanged = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "booking.status_changed",
+		Message:   "the booking status changed meanwhile",
+	}
+	ErrVersionConflict = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "request.version_conflict",
+		Message:   "the object was changed meanwhile, merge the changes into its current version",
+	}
+	ErrIdempotencyKeyInProgress = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "request.idempotency_key_in_progress",
+		Message:   "a request with the same idempotency key is in progress",
+	}
+	ErrIdempotencyKeyReused = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "request.idempotency_key_reused",
+		Message:   "the idempotency key was used by a different request",
 	}
 	ErrBookingAlreadyReturned = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "booking already marked as returned",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "booking.already_returned",
+		Message:   "booking already marked as returned",
 	}
 	ErrBookingAlreadyRated = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "booking already rated",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "booking.already_rated",
+		Message:   "booking already rated",
 	}
 	ErrCanOnlyAcceptPending = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "can only accept pending petitions",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "booking.accept_not_pending",
+		Message:   "can only accept pending petitions",
 	}
 	ErrCanOnlyDenyPending = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "can only deny pending petitions",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "booking.deny_not_pending",
+		Message:   "can only deny pending petitions",
 	}
 	ErrCanOnlyCancelPending = &HTTPError{
-		Code:    http.StatusBadRequest,
-		Message: "can only cancel pending requests",
+		Code:      http.StatusBadRequest,
+		ErrorCode: "booking.cancel_not_allowed",
+		Message:   "can only cancel pending requests or accepted bookings not started yet",
+	}
+	ErrBookingWithoutAgreement = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "booking.no_agreement",
+		Message:   "only the accepted or returned bookings have a loan agreement",
+	}
+	ErrBookingNotEnded = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "booking.not_ended",
+		Message:   "only the rejected, cancelled, returned or expired bookings can be archived",
+	}
+	ErrToolAlreadyReported = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "tool.already_reported",
+		Message:   "tool already reported as lost or stolen",
+	}
+	ErrToolNotReported = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "tool.not_reported",
+		Message:   "tool is not reported as lost or stolen",
+	}
+	ErrDuplicateSerialNumber = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "tool.duplicate_serial_number",
+		Message:   "serial number already used by another of your tools",
+	}
+	ErrDuplicateAssetTag = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "tool.duplicate_asset_tag",
+		Message:   "asset tag already used by another of your tools",
+	}
+	ErrDisagreementConflict = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "booking.disagreement_conflict",
+		Message:   "disagreements can only be opened once on returned bookings and resolved while open",
+	}
+	ErrOnlyOpenerCanResolve = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "booking.disagreement_not_opener",
+		Message:   "only the party that opened the disagreement can resolve it",
+	}
+	ErrToolReported = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "tool.reported",
+		Message:   "tool is reported as lost or stolen",
+	}
+	ErrRecoveryNotPending = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "recovery.not_pending",
+		Message:   "recovery request is not pending or was already approved by this admin",
+	}
+	ErrInvalidRecoveryCode = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "recovery.invalid_code",
+		Message:   "invalid or expired recovery code",
+	}
+	ErrToolTransferConflict = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "tool.transfer_conflict",
+		Message:   "the recipient already has a tool with the same title",
+	}
+	ErrEmailAlreadyRegistered = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "user.email_registered",
+		Message:   "email already registered",
+	}
+	ErrNotEnoughTokens = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "booking.not_enough_tokens",
+		Message:   "the requester does not have enough tokens",
+	}
+	ErrAlreadyWaitlisted = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "waitlist.already_joined",
+		Message:   "user already in the waitlist of the tool",
+	}
+	ErrDatesAvailable = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "waitlist.dates_available",
+		Message:   "the dates are available, book the tool instead",
+	}
+	ErrTooManyInviteCodes = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "invite.too_many",
+		Message:   "maximum number of unused invite codes reached",
+	}
+	ErrInviteCodeCooldown = &HTTPError{
+		Code:      http.StatusTooManyRequests,
+		ErrorCode: "invite.cooldown",
+		Message:   "too soon to create another invite code",
+	}
+	ErrToolInMaintenance = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "tool.in_maintenance",
+		Message:   "tool is in maintenance during the requested dates",
+	}
+	ErrOutsideAvailability = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "booking.outside_availability",
+		Message:   "tool is not available on some of the requested dates",
+	}
+	ErrUsageTermsNotAccepted = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "booking.terms_not_accepted",
+		Message:   "the current usage terms of the tool must be accepted",
+	}
+	ErrToolNotInMaintenance = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "tool.not_in_maintenance",
+		Message:   "tool is not in maintenance",
+	}
+	ErrNoDepreciation = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "tool.no_depreciation",
+		Message:   "tool valuation has no depreciation to apply yet",
+	}
+	ErrImageProcessing = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "image.processing",
+		Message:   "the image is being processed, retry later",
+	}
+	ErrToolPendingApproval = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "tool.pending_approval",
+		Message:   "the tool is pending the approval of the community admins",
+	}
+	ErrToolNotPendingApproval = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "tool.not_pending_approval",
+		Message:   "the tool is not pending approval",
+	}
+	ErrToolIsDraft = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "tool.draft",
+		Message:   "the tool is a draft not published yet",
+	}
+	ErrToolNotDraft = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "tool.not_draft",
+		Message:   "the tool is already published",
+	}
+	ErrToolIncomplete = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "tool.incomplete",
+		Message:   "the tool is not complete to be published",
+	}
+)
+
+// Telegram errors
+var (
+	ErrTelegramDisabled = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "telegram.disabled",
+		Message:   "telegram notifications are not enabled",
 	}
 )
 
 // Server errors
 var (
 	ErrCouldNotInsertToDatabase = &HTTPError{
-		Code:    http.StatusInternalServerError,
-		Message: "could not insert to database",
+		Code:      http.StatusInternalServerError,
+		ErrorCode: "server.database",
+		Message:   "could not insert to database",
 	}
 	ErrInternalServerError = &HTTPError{
-		Code:    http.StatusInternalServerError,
-		Message: "internal server error",
+		Code:      http.StatusInternalServerError,
+		ErrorCode: "server.internal",
+		Message:   "internal server error",
+	}
+	ErrGeocodingUnavailable = &HTTPError{
+		Code:      http.StatusBadGateway,
+		ErrorCode: "geocoding.unavailable",
+		Message:   "geocoding service unavailable",
+	}
+	ErrMailNotSent = &HTTPError{
+		Code:      http.StatusBadGateway,
+		ErrorCode: "mail.not_sent",
+		Message:   "the email could not be sent",
 	}
 )
 
 // Tool validation errors
 var (
 	ErrEmptyTitleOrDescription = &HTTPError{
-		Code:    http.StatusUnprocessableEntity,
-		Message: "title and description must not be empty",
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.empty_title_or_description",
+		Message:   "title and description must not be empty",
 	}
 	ErrInvalidEstimatedValue = &HTTPError{
-		Code:    http.StatusUnprocessableEntity,
-		Message: "estimated value must be greater than 0",
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.invalid_estimated_value",
+		Message:   "estimated value must be greater than 0",
 	}
 	ErrMayBeFreeRequired = &HTTPError{
-		Code:    http.StatusUnprocessableEntity,
-		Message: "may be free must not be nil",
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.may_be_free_required",
+		Message:   "may be free must not be nil",
 	}
 	ErrAskWithFeeRequired = &HTTPError{
-		Code:    http.StatusUnprocessableEntity,
-		Message: "ask with fee must not be nil",
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.ask_with_fee_required",
+		Message:   "ask with fee must not be nil",
 	}
 	ErrCostRequired = &HTTPError{
-		Code:    http.StatusUnprocessableEntity,
-		Message: "cost must not be nil",
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.cost_required",
+		Message:   "cost must not be nil",
 	}
 	ErrToolLocationTooFar = &HTTPError{
-		Code:    http.StatusUnprocessableEntity,
-		Message: "tool location is too far away",
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.location_too_far",
+		Message:   "tool location is too far away",
 	}
 	ErrInvalidToolCategory = &HTTPError{
-		Code:    http.StatusUnprocessableEntity,
-		Message: "invalid tool category",
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.invalid_category",
+		Message:   "invalid tool category",
 	}
 	ErrInvalidTransportOption = &HTTPError{
-		Code:    http.StatusUnprocessableEntity,
-		Message: "invalid transport option",
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.invalid_transport_option",
+		Message:   "invalid transport option",
+	}
+	ErrInvalidReportStatus = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool_report.invalid_status",
+		Message:   "invalid report status (must be LOST or STOLEN)",
+	}
+	ErrEmptyReportDescription = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool_report.empty_description",
+		Message:   "incident description must not be empty",
+	}
+	ErrInvalidBookingOrigin = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "booking.invalid_origin",
+		Message:   "invalid booking origin (must be SEARCH, COMMUNITY_PAGE, SHARE_LINK or NEED_MATCH)",
+	}
+	ErrEmptyDisagreementDescription = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "booking.empty_disagreement",
+		Message:   "disagreement description must not be empty",
+	}
+	ErrUsageTermsTooLong = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.usage_terms_too_long",
+		Message:   "usage terms are too long",
+	}
+	ErrEmptyMaintenanceNote = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "maintenance.empty_note",
+		Message:   "maintenance note must not be empty",
+	}
+	ErrInvalidMaintenanceDates = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "maintenance.invalid_dates",
+		Message:   "maintenance end date must be after its start date",
+	}
+	ErrInvalidPricingMode = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.invalid_pricing_mode",
+		Message:   "invalid pricing mode (must be fixed, free or payWhatYouWant)",
+	}
+	ErrInvalidCancellationPolicy = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.invalid_cancellation_policy",
+		Message:   "invalid cancellation policy (must be flexible or strict)",
+	}
+	ErrManagerIsOwner = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.manager_is_owner",
+		Message:   "the owner of the tool cannot be one of its managers",
+	}
+	ErrTooManyToolManagers = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.too_many_managers",
+		Message:   "maximum number of tool managers reached",
+	}
+	ErrAmountNotAllowed = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "booking.amount_not_allowed",
+		Message:   "only pay what you want tools accept a proposed amount",
+	}
+	ErrInvalidMediaType = &HTTPError{
+		Code:      http.StatusUnsupportedMediaType,
+		ErrorCode: "media.invalid_type",
+		Message:   "the media must be a MP4 or WebM video or a PDF document",
+	}
+	ErrMediaTooLarge = &HTTPError{
+		Code:      http.StatusRequestEntityTooLarge,
+		ErrorCode: "media.too_large",
+		Message:   "media larger than the maximum size of its type",
+	}
+	ErrTooManyToolMedia = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.too_many_media",
+		Message:   "maximum number of tool media reached",
+	}
+	ErrInvalidToolSpecs = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.invalid_specs",
+		Message:   "invalid tool specs",
+	}
+	ErrInvalidDimensions = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.invalid_dimensions",
+		Message:   "invalid tool dimensions",
+	}
+	ErrInvalidToolVisibility = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.invalid_visibility",
+		Message:   "invalid tool visibility",
+	}
+	ErrInvalidAutoAccept = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.invalid_auto_accept",
+		Message:   "invalid auto-accept rules",
+	}
+	ErrInvalidAvailability = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "tool.invalid_availability",
+		Message:   "invalid availability rules",
+	}
+)
+
+// Saved search validation errors
+var (
+	ErrTooManySavedSearches = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "saved_search.too_many",
+		Message:   "maximum number of saved searches reached",
+	}
+	ErrTooManyDevices = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "device.too_many",
+		Message:   "maximum number of devices reached",
+	}
+	ErrEmptySavedSearch = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "saved_search.empty",
+		Message:   "saved search must define at least one filter",
+	}
+)
+
+// Account recovery validation errors
+var (
+	ErrInvalidRecoveryRequest = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "recovery.invalid_request",
+		Message:   "email, new email and message must not be empty",
+	}
+)
+
+// Location validation errors
+var (
+	ErrGeocodingDisabled = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "geocoding.disabled",
+		Message:   "geocoding is not enabled, location coordinates are required",
+	}
+	ErrAddressNotFound = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "geocoding.address_not_found",
+		Message:   "address not found",
+	}
+	ErrLocationRequired = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "search.location_required",
+		Message:   "the user location is required to search by distance",
+	}
+)
+
+// Digest errors
+var (
+	ErrUnsubscribeTokenNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "digest.token_not_found",
+		Message:   "unsubscribe token not found",
+	}
+)
+
+// Tool transfer errors
+var (
+	ErrTransferNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "transfer.not_found",
+		Message:   "transfer not found",
+	}
+	ErrTransferPending = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "transfer.pending",
+		Message:   "the tool already has a pending transfer",
+	}
+	ErrTransferNotPending = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "transfer.not_pending",
+		Message:   "the transfer is no longer pending",
+	}
+	ErrTransferOpenBookings = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "transfer.open_bookings",
+		Message:   "the tool has pending or accepted bookings",
+	}
+	ErrTransferToSelf = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "transfer.self",
+		Message:   "cannot transfer a tool to its owner",
+	}
+	ErrCommunityToolTransfer = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "transfer.community_tool",
+		Message:   "shared community tools cannot be transferred",
+	}
+	ErrOnlyRecipientCanAnswer = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "transfer.only_recipient",
+		Message:   "only the recipient can accept or reject the transfer",
+	}
+	ErrOnlySenderCanCancel = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "transfer.only_sender",
+		Message:   "only the owner that offered the transfer can cancel it",
+	}
+)
+
+// Community library errors
+var (
+	ErrLibraryToolNotCheckedOut = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "library.not_checked_out",
+		Message:   "the tool is not checked out",
+	}
+)
+
+// Direct message errors
+var (
+	ErrMessageNotAllowed = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "message.not_allowed",
+		Message:   "users can only message the users they share a community or a booking with",
+	}
+	ErrMessageBlocked = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "message.blocked",
+		Message:   "one of the users blocked the other",
+	}
+	ErrInvalidMessage = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "message.invalid",
+		Message:   "invalid message text",
+	}
+	ErrTooManyMessages = &HTTPError{
+		Code:      http.StatusTooManyRequests,
+		ErrorCode: "message.too_many",
+		Message:   "too many messages sent, try again later",
+	}
+	ErrUserNotBlocked = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "user.not_blocked",
+		Message:   "user is not blocked",
+	}
+)
+
+// Terms of service errors
+var (
+	ErrTermsNotAccepted = &HTTPError{
+		Code:      http.StatusForbidden,
+		ErrorCode: "terms.not_accepted",
+		Message:   "the current terms of service must be accepted",
+	}
+	ErrTermsOutdated = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "terms.outdated",
+		Message:   "the accepted terms version is not the current one",
+	}
+	ErrTermsNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "terms.not_found",
+		Message:   "no terms of service published",
+	}
+	ErrInvalidTerms = &HTTPError{
+		Code:      http.StatusUnprocessableEntity,
+		ErrorCode: "terms.invalid",
+		Message:   "invalid terms of service",
+	}
+)
+
+// Tenant errors
+var (
+	ErrTenantNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "tenant.not_found",
+		Message:   "no instance is served at this address",
+	}
+)
+
+// Payment errors
+var (
+	ErrPaymentsDisabled = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "payment.disabled",
+		Message:   "the bookings are not paid in money in this instance",
+	}
+	ErrBookingNotPayable = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "payment.not_payable",
+		Message:   "only the accepted bookings with a price can be paid",
+	}
+	ErrPaymentConflict = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "payment.conflict",
+		Message:   "the booking payment is already pending or paid",
+	}
+	ErrPaymentNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "payment.not_found",
+		Message:   "the booking has no payment",
+	}
+	ErrPaymentProvider = &HTTPError{
+		Code:      http.StatusBadGateway,
+		ErrorCode: "payment.provider_error",
+		Message:   "the payment provider could not create the payment",
+	}
+	ErrInvalidPaymentWebhook = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "payment.invalid_webhook",
+		Message:   "invalid payment webhook notification",
+	}
+)
+
+// Crowdfund errors
+var (
+	ErrCrowdfundNotFound = &HTTPError{
+		Code:      http.StatusNotFound,
+		ErrorCode: "crowdfund.not_found",
+		Message:   "crowdfund not found",
+	}
+	ErrInvalidCrowdfundGoal = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "crowdfund.invalid_goal",
+		Message:   "the crowdfund goal must be greater than 0",
+	}
+	ErrInvalidPledge = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "crowdfund.invalid_pledge",
+		Message:   "the pledged amount must be greater than 0",
+	}
+	ErrCrowdfundConflict = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "crowdfund.conflict",
+		Message:   "the crowdfund is closed or the pledge exceeds the tokens left to reach its goal",
+	}
+	ErrCrowdfundGoalNotReached = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "crowdfund.goal_not_reached",
+		Message:   "the crowdfund has not reached its goal",
+	}
+)
+
+// Community pool errors
+var (
+	ErrInvalidCommunityFee = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "pool.invalid_fee",
+		Message:   "the community fee cannot be greater than 10 tokens",
+	}
+	ErrInvalidPayout = &HTTPError{
+		Code:      http.StatusBadRequest,
+		ErrorCode: "pool.invalid_payout",
+		Message:   "the payout must be greater than 0 and have a reason",
+	}
+	ErrPoolNotEnoughTokens = &HTTPError{
+		Code:      http.StatusConflict,
+		ErrorCode: "pool.not_enough_tokens",
+		Message:   "the community pool does not have enough tokens",
 	}
 )
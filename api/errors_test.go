@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// errorCodes returns the error code of every HTTPError declared in errors.go.
+func errorCodes(c *qt.C) map[string]string {
+	file, err := parser.ParseFile(token.NewFileSet(), "errors.go", nil, 0)
+	c.Assert(err, qt.IsNil)
+	codes := make(map[string]string)
+	ast.Inspect(file, func(node ast.Node) bool {
+		spec, ok := node.(*ast.ValueSpec)
+		if !ok {
+			return true
+		}
+		for i, value := range spec.Values {
+			lit, ok := value.(*ast.UnaryExpr)
+			if !ok {
+				continue
+			}
+			composite, ok := lit.X.(*ast.CompositeLit)
+			if !ok || composite.Type.(*ast.Ident).Name != "HTTPError" {
+				continue
+			}
+			codes[spec.Names[i].Name] = ""
+			for _, elt := range composite.Elts {
+				kv := elt.(*ast.KeyValueExpr)
+				if kv.Key.(*ast.Ident).Name != "ErrorCode" {
+					continue
+				}
+				code, err := strconv.Unquote(kv.Value.(*ast.BasicLit).Value)
+				c.Assert(err, qt.IsNil)
+				codes[spec.Names[i].Name] = code
+			}
+		}
+		return true
+	})
+	return codes
+}
+
+func TestErrorCodes(t *testing.T) {
+	c := qt.New(t)
+
+	// The documented codes are the enum of the ErrorCode schema
+	data, err := os.ReadFile("../docs/swagger.yaml")
+	c.Assert(err, qt.IsNil)
+	_, schema, ok := strings.Cut(string(data), "\n    ErrorCode:\n")
+	c.Assert(ok, qt.IsTrue)
+	_, enum, ok := strings.Cut(schema, "\n      enum:\n")
+	c.Assert(ok, qt.IsTrue)
+	documented := make(map[string]bool)
+	for _, line := range strings.Split(enum, "\n") {
+		code, ok := strings.CutPrefix(line, "        - ")
+		if !ok {
+			break
+		}
+		documented[code] = true
+	}
+
+	// Every error has a unique, well formed and documented code
+	format := regexp.MustCompile(`^[a-z_]+(\.[a-z_]+)+$`)
+	codes := errorCodes(c)
+	c.Assert(codes, qt.Not(qt.HasLen), 0)
+	used := make(map[string]string)
+	for name, code := range codes {
+		c.Assert(format.MatchString(code), qt.IsTrue, qt.Commentf("%s has invalid error code %q", name, code))
+		c.Assert(used[code], qt.Equals, "", qt.Commentf("%s repeats the error code of %s", name, used[code]))
+		used[code] = name
+		c.Assert(documented[code], qt.IsTrue, qt.Commentf("error code %s is not documented", code))
+	}
+	c.Assert(documented, qt.HasLen, len(codes))
+}
+
+func TestErrorResponses(t *testing.T) {
+	c := qt.New(t)
+	a := New("secret", "token", nil, nil)
+
+	for _, test := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{ErrBookingDatesConflict.WithErr(errors.New("taken")), http.StatusBadRequest, "booking.conflict"},
+		{ErrUserInactive, http.StatusForbidden, "user.inactive"},
+		{errors.New("unexpected"), http.StatusInternalServerError, "server.internal"},
+	} {
+		rec := httptest.NewRecorder()
+		a.routerHandler(func(*Request) (interface{}, error) {
+			return nil, test.err
+		})(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		c.Assert(rec.Code, qt.Equals, test.status)
+		var resp Response
+		c.Assert(json.Unmarshal(rec.Body.Bytes(), &resp), qt.IsNil)
+		c.Assert(resp.Header.Success, qt.IsFalse)
+		c.Assert(resp.Header.ErrorCode, qt.Equals, test.code)
+	}
+
+	// The requests without a valid token are rejected before reaching the handlers
+	rec := httptest.NewRecorder()
+	a.router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/profile", nil))
+	c.Assert(rec.Code, qt.Equals, http.StatusUnauthorized)
+	var resp Response
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &resp), qt.IsNil)
+	c.Assert(resp.Header.ErrorCode, qt.Equals, "auth.unauthorized")
+}
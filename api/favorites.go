@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// withFavorites returns a copy of the tools with IsFavorite set for the user.
+// Tools are copied since they might be shared (i.e. cached search results).
+func (a *API) withFavorites(userID string, tools []*Tool) ([]*Tool, error) {
+	result := make([]*Tool, len(tools))
+	if len(tools) == 0 {
+		return result, nil
+	}
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	ids := make([]int64, len(tools))
+	for i, t := range tools {
+		ids[i] = t.ID
+	}
+	favorites, err := a.database.FavoriteService.FavoriteToolIDs(context.Background(), uid, ids)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	for i, t := range tools {
+		tool := *t
+		tool.IsFavorite = favorites[t.ID]
+		result[i] = &tool
+	}
+	return result, nil
+}
+
+// addFavoriteHandler handles POST /tools/{id}/favorite
+func (a *API) addFavoriteHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	idParam := r.Context.URLParam("id")
+	if idParam == nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing tool id"))
+	}
+	id, err := strconv.ParseInt(idParam[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if _, err := a.readableToolFromDB(r, id); err != nil {
+		return nil, err
+	}
+	if err := a.database.FavoriteService.AddFavorite(r.Context.Request.Context(), userID, id); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	return nil, nil
+}
+
+// removeFavoriteHandler handles DELETE /tools/{id}/favorite
+func (a *API) removeFavoriteHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	idParam := r.Context.URLParam("id")
+	if idParam == nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing tool id"))
+	}
+	id, err := strconv.ParseInt(idParam[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if err := a.database.FavoriteService.RemoveFavorite(r.Context.Request.Context(), userID, id); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrFavoriteNotFound.WithErr(fmt.Errorf("tool %d is not a favorite", id))
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// favoritesHandler handles GET /profile/favorites?page=
+func (a *API) favoritesHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+
+	ctx := r.Context.Request.Context()
+	ids, err := a.database.FavoriteService.GetUserFavorites(ctx, userID, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	tools, err := a.database.ToolService.GetToolsByIDs(ctx, ids)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	// The favorite tools the user can no longer see are skipped
+	if tools, err = a.readableTools(ctx, r.UserID, tools); err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*db.Tool, len(tools))
+	for _, t := range tools {
+		byID[t.ID] = t
+	}
+	// Keep the favorites order (most recent first)
+	result := &ToolsWrapper{Tools: []*Tool{}}
+	for _, id := range ids {
+		if t, ok := byID[id]; ok {
+			tool := new(Tool).FromDBTool(t)
+			tool.IsFavorite = true
+			result.Tools = append(result.Tools, tool)
+		}
+	}
+	a.hideToolLocations(result.Tools...)
+	a.setBreadcrumbs(result.Tools...)
+	return result, nil
+}
+
+// notifyFavoriteAvailable notifies the users that have the tool as favorite that it is available again.
+func (a *API) notifyFavoriteAvailable(tool *db.Tool) {
+	ctx := context.Background()
+	users, err := a.database.FavoriteService.GetToolFavoriters(ctx, tool.ID)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not get favoriters of tool %d", tool.ID)
+		return
+	}
+	for _, userID := range users {
+		if userID == tool.UserID {
+			continue
+		}
+		a.notify(ctx, &db.Notification{
+			UserID:  userID,
+			Type:    db.NotificationFavoriteAvailable,
+			Message: fmt.Sprintf("Your favorite tool is available again: %s", tool.Title),
+			ToolID:  tool.ID,
+		})
+	}
+}
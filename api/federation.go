@@ -0,0 +1,249 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// federationTokenHeader is the header carrying the federation token on peer requests.
+	federationTokenHeader = "X-Federation-Token"
+	// federationTimeout is the maximum duration of a search request to a peer.
+	federationTimeout = 5 * time.Second
+	// federationCacheTTL is the time the search results of a peer are cached.
+	federationCacheTTL = 2 * time.Minute
+	// federationCacheMaxEntries is the maximum number of cached peer search results.
+	federationCacheMaxEntries = 1024
+	// federationLocationPrecision is the grid, in microdegrees, the user location is rounded
+	// to before being sent to the peers (~1 kilometer).
+	federationLocationPrecision = 10000
+)
+
+// peerCacheEntry is a cached search result of a peer.
+type peerCacheEntry struct {
+	result  *ToolSearchResponse
+	expires time.Time
+}
+
+// peerCache caches the search results of the peer instances by peer and query.
+type peerCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*peerCacheEntry
+}
+
+// newPeerCache creates a new peer cache with the given TTL.
+func newPeerCache(ttl time.Duration) *peerCache {
+	return &peerCache{
+		ttl:     ttl,
+		entries: make(map[string]*peerCacheEntry),
+	}
+}
+
+// get returns the cached result for the key, if it has not expired.
+func (c *peerCache) get(key string) (*ToolSearchResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.result, true
+}
+
+// set caches the result for the key. Expired entries are removed when the cache is full,
+// and if it is still full the whole cache is reset.
+func (c *peerCache) set(key string, result *ToolSearchResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= federationCacheMaxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= federationCacheMaxEntries {
+			c.entries = make(map[string]*peerCacheEntry)
+		}
+	}
+	c.entries[key] = &peerCacheEntry{result: result, expires: now.Add(c.ttl)}
+}
+
+// federationSearchHandler handles GET /federation/tools/search?latitude=&longitude=&...
+// It is called by the peer instances with the federation token and returns the local
+// search results around the given location (in microdegrees). The results are never
+// forwarded to other peers.
+func (a *API) federationSearchHandler(r *Request) (interface{}, error) {
+	token := r.Context.Request.Header.Get(federationTokenHeader)
+	if a.federationToken == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(a.federationToken)) != 1 {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("invalid federation token"))
+	}
+	query, err := parseToolSearch(r.Context)
+	if err != nil {
+		return nil, err
+	}
+	var location Location
+	for name, value := range map[string]*int64{"latitude": &location.Latitude, "longitude": &location.Longitude} {
+		param := r.Context.URLParam(name)
+		if param == nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing %s", name))
+		}
+		if *value, err = strconv.ParseInt(param[0], 10, 64); err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid %s %q", name, param[0]))
+		}
+	}
+	// The peers only find the public tools
+	return a.toolSearch(query, &location, nil)
+}
+
+// addPeerResults adds to the response the results of the same search on the peer instances,
+// with their source, sorted by distance or rating. Each peer contributes the same page of its own results
+// and its total. Peers that fail or time out are skipped.
+func (a *API) addPeerResults(ctx context.Context, response *ToolSearchResponse, params url.Values, location *Location) {
+	if len(a.federationPeers) == 0 {
+		return
+	}
+	query := url.Values{}
+	for key, values := range params {
+		// The fields are selected once the results are merged, as they are sorted by distance
+		if key != "federated" && key != "fields" {
+			query[key] = values
+		}
+	}
+	// The exact location of the user is not shared with the peers
+	query.Set("latitude", strconv.FormatInt(roundToGrid(location.Latitude), 10))
+	query.Set("longitude", strconv.FormatInt(roundToGrid(location.Longitude), 10))
+
+	results := make([]*ToolSearchResponse, len(a.federationPeers))
+	var wg sync.WaitGroup
+	for i, peer := range a.federationPeers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := a.searchPeer(ctx, peer, query)
+			if err != nil {
+				log.Warn().Err(err).Msgf("federated search on peer %s failed", peer)
+				return
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	tools := slices.Clone(response.Tools)
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		tools = append(tools, result.Tools...)
+		response.Total += result.Total
+	}
+	// The popularity is not comparable between instances, the tools of the peers follow the
+	// local ones
+	if params.Get("sort") == ToolSearchSortPopular {
+		response.Tools = tools
+		return
+	}
+	slices.SortStableFunc(tools, func(x, y *Tool) int {
+		if params.Get("sort") == ToolSearchSortRating {
+			if c := compareRating(x, y); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(distanceOrMax(x), distanceOrMax(y))
+	})
+	response.Tools = tools
+}
+
+// searchPeer returns the search result of the peer for the query, from the cache if possible.
+// The tools of the result have the peer as source.
+func (a *API) searchPeer(ctx context.Context, peer string, query url.Values) (*ToolSearchResponse, error) {
+	key := peer + "?" + query.Encode()
+	if cached, ok := a.peerCache.get(key); ok {
+		return cached, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, federationTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(peer, "/")+"/federation/tools/search?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(federationTokenHeader, a.federationToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Warn().Err(err).Msg("could not close peer response body")
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var body struct {
+		Data *ToolSearchResponse `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.Data == nil {
+		return nil, fmt.Errorf("empty peer response")
+	}
+	for _, t := range body.Data.Tools {
+		t.Source = peer
+		t.IsFavorite = false
+		// The avatars are served by the peer
+		if strings.HasPrefix(t.OwnerAvatarURL, "/") {
+			t.OwnerAvatarURL = strings.TrimSuffix(peer, "/") + t.OwnerAvatarURL
+		}
+	}
+	a.peerCache.set(key, body.Data)
+	return body.Data, nil
+}
+
+// roundToGrid rounds a coordinate in microdegrees to the federation location grid.
+func roundToGrid(coordinate int64) int64 {
+	return int64(math.Round(float64(coordinate)/federationLocationPrecision)) * federationLocationPrecision
+}
+
+// compareRating orders the tools by rating, highest first, and then by number of ratings.
+// The tools without rating go last.
+func compareRating(x, y *Tool) int {
+	switch {
+	case x.Rating == nil && y.Rating == nil:
+		return 0
+	case x.Rating == nil:
+		return 1
+	case y.Rating == nil:
+		return -1
+	}
+	if c := cmp.Compare(*y.Rating, *x.Rating); c != 0 {
+		return c
+	}
+	return cmp.Compare(y.RatingCount, x.RatingCount)
+}
+
+// distanceOrMax returns the distance of the tool, or the maximum distance if unknown.
+func distanceOrMax(t *Tool) int64 {
+	if t.Distance == nil {
+		return math.MaxInt32
+	}
+	return *t.Distance
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestAddPeerResults(t *testing.T) {
+	c := qt.New(t)
+
+	requests := 0
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		c.Check(r.URL.Path, qt.Equals, "/federation/tools/search")
+		c.Check(r.Header.Get(federationTokenHeader), qt.Equals, "network-token")
+		c.Check(r.URL.Query().Get("term"), qt.Equals, "drill")
+		c.Check(r.URL.Query().Has("federated"), qt.IsFalse)
+		// The location is rounded before being sent
+		c.Check(r.URL.Query().Get("latitude"), qt.Equals, "41690000")
+		c.Check(r.URL.Query().Get("longitude"), qt.Equals, "2490000")
+		distance := int64(1500)
+		c.Check(json.NewEncoder(w).Encode(&Response{Data: &ToolSearchResponse{
+			Tools: []*Tool{{ID: 2, Title: "Peer drill", Distance: &distance}},
+			Total: 1,
+		}}), qt.IsNil)
+	}))
+	defer peer.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer failing.Close()
+
+	a := &API{
+		federationPeers: []string{peer.URL, failing.URL},
+		federationToken: "network-token",
+		peerCache:       newPeerCache(time.Minute),
+	}
+	params := url.Values{"term": {"drill"}, "federated": {"true"}}
+	location := &Location{Latitude: 41688407, Longitude: 2491027}
+	near, far := int64(500), int64(3000)
+	newResponse := func() *ToolSearchResponse {
+		return &ToolSearchResponse{
+			Tools: []*Tool{{ID: 1, Distance: &near}, {ID: 3, Distance: &far}},
+			Total: 2,
+		}
+	}
+
+	response := newResponse()
+	a.addPeerResults(context.Background(), response, params, location)
+	c.Assert(response.Total, qt.Equals, int64(3))
+	c.Assert(response.Tools, qt.HasLen, 3)
+	// Merged by distance, with the peer as source of its tools
+	c.Assert(response.Tools[0].ID, qt.Equals, int64(1))
+	c.Assert(response.Tools[0].Source, qt.Equals, "")
+	c.Assert(response.Tools[1].ID, qt.Equals, int64(2))
+	c.Assert(response.Tools[1].Source, qt.Equals, peer.URL)
+	c.Assert(response.Tools[2].ID, qt.Equals, int64(3))
+
+	// The peer results are cached
+	response = newResponse()
+	a.addPeerResults(context.Background(), response, params, location)
+	c.Assert(response.Tools, qt.HasLen, 3)
+	c.Assert(requests, qt.Equals, 1)
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// toolFields maps the fields of the tools that can be selected with the fields parameter to
+// the document fields they are built from. Computed fields need no document field.
+var toolFields = map[string][]string{
+	"id":                  {"_id"},
+	"userId":              {"userId"},
+	"title":               {"title"},
+	"description":         {"description"},
+	"isAvailable":         {"isAvailable"},
+	"mayBeFree":           {"mayBeFree"},
+	"askWithFee":          {"askWithFee"},
+	"cost":                {"cost"},
+	"images":              {"images"},
+	"transportOptions":    {"transportOptions"},
+	"transports":          {"transportOptions"},
+	"toolCategory":        {"toolCategory"},
+	"categoryBreadcrumbs": {"toolCategory"},
+	"location":            {"location"},
+	"locality":            {"locality"},
+	"estimatedValue":      {"estimatedValue"},
+	"height":              {"dimensions"},
+	"weight":              {"dimensions"},
+	"reservedDates":       {"reservedDates"},
+	"status":              {"status"},
+	"distance":            {},
+	"serialNumber":        {"serialNumber"},
+	"assetTag":            {"assetTag"},
+	"isFavorite":          {},
+	"ownerTrustScore":     {"ownerTrustScore"},
+	"rating":              {"ratingAverage"},
+	"ratingCount":         {"ratingCount"},
+	"ownerAvatarUrl":      {"userId"},
+	"community":           {"community"},
+	"pendingApproval":     {"pendingApproval"},
+	"visibility":          {"visibility", "community"},
+	"visibleTo":           {"visibleTo"},
+	"usageTerms":          {"usageTerms", "usageTermsVersion"},
+	"usageTermsVersion":   {"usageTerms", "usageTermsVersion"},
+	"maintenance":         {"maintenance"},
+	"media":               {"media"},
+	"specs":               {"specs"},
+	"dimensions":          {"dimensions"},
+	"autoAccept":          {"autoAccept"},
+	"availability":        {"availability"},
+	"source":              {},
+	"updatedAt":           {"updatedAt"},
+	"viewCount":           {"viewCount"},
+	"quality":             qualityFields,
+	"pricingMode":         {"pricingMode", "cost"},
+	"suggestedAmount":     {"pricingMode", "suggestedAmount"},
+	"cancellationPolicy":  {"cancellationPolicy"},
+	"managers":            {"managers"},
+	"updatedBy":           {"updatedBy"},
+	"version":             {"version"},
+	"contributors":        {"contributors"},
+}
+
+// toolRequiredFields are the document fields always retrieved, needed to check the permissions
+// and to compute the caching headers.
+var toolRequiredFields = []string{"_id", "userId", "updatedAt", "community", "visibility", "visibleTo", "managers", "status"}
+
+// bookingFields maps the fields of the bookings that can be selected with the fields parameter
+// to the document fields they are built from.
+var bookingFields = map[string][]string{
+	"id":                  {"_id"},
+	"toolId":              {"toolId"},
+	"fromUserId":          {"fromUserId"},
+	"toUserId":            {"toUserId"},
+	"fromAvatarUrl":       {"fromUserId"},
+	"toAvatarUrl":         {"toUserId"},
+	"startDate":           {"startDate"},
+	"endDate":             {"endDate"},
+	"contact":             {"contact"},
+	"comments":            {"comments"},
+	"commentRefs":         {"commentRefs"},
+	"bookingStatus":       {"bookingStatus"},
+	"createdAt":           {"createdAt"},
+	"updatedAt":           {"updatedAt"},
+	"toolReported":        {"toolReported"},
+	"origin":              {"origin"},
+	"community":           {"community"},
+	"disagreement":        {"disagreement"},
+	"acceptedTerms":       {"acceptedTerms"},
+	"pricingMode":         {"pricingMode"},
+	"price":               {"price"},
+	"cancellationPolicy":  {"cancellationPolicy"},
+	"cancellationPenalty": {"cancellationPenalty"},
+	"payment":             {"payment"},
+	"archived":            {"archivedBy"},
+	// The summaries are looked up only when selected
+	"tool":     {"toolId", "tool"},
+	"fromUser": {"fromUserId", "fromUser"},
+	"toUser":   {"toUserId", "toUser"},
+}
+
+// bookingRequiredFields are the document fields of the bookings always retrieved.
+var bookingRequiredFields = []string{"_id", "fromUserId", "toUserId"}
+
+// parseFields parses the fields parameter (i.e. fields=title,cost,location), the fields of
+// the response to include. It returns nil if the parameter is not present, so all the fields
+// are included. The id is always included.
+func parseFields(hc *HTTPContext, selectable map[string][]string) ([]string, error) {
+	param := hc.URLParam("fields")
+	if param == nil {
+		return nil, nil
+	}
+	fields := []string{"id"}
+	for _, value := range param {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" || slices.Contains(fields, field) {
+				continue
+			}
+			if _, ok := selectable[field]; !ok {
+				return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("unknown field %q", field))
+			}
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// fieldSelected returns true if the field is included in the response, as all of them are when
+// no fields are selected.
+func fieldSelected(fields []string, field string) bool {
+	return len(fields) == 0 || slices.Contains(fields, field)
+}
+
+// fieldsProjection returns the document fields needed to build the selected fields, or nil
+// if all the fields are selected.
+func fieldsProjection(fields []string, selectable map[string][]string, required []string) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+	projection := slices.Clone(required)
+	for _, field := range fields {
+		for _, docField := range selectable[field] {
+			if !slices.Contains(projection, docField) {
+				projection = append(projection, docField)
+			}
+		}
+	}
+	return projection
+}
+
+// marshalFields encodes v as a JSON object with only the given fields, or with all of them if
+// there are none.
+func marshalFields(v interface{}, fields []string) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(fields) == 0 {
+		return data, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return json.Marshal(selected)
+}
+
+// MarshalJSON encodes the tool with only its selected fields, if any.
+func (t Tool) MarshalJSON() ([]byte, error) {
+	type tool Tool
+	return marshalFields(tool(t), t.fields)
+}
+
+// MarshalJSON encodes the booking with only its selected fields, if any.
+func (b BookingResponse) MarshalJSON() ([]byte, error) {
+	type booking BookingResponse
+	return marshalFields(booking(b), b.fields)
+}
+
+// selectToolFields makes the tools encode only the given fields.
+func selectToolFields(tools []*Tool, fields []string) {
+	for _, t := range tools {
+		t.fields = fields
+	}
+}
+
+// selectBookingFields makes the bookings encode only the given fields.
+func selectBookingFields(bookings []BookingResponse, fields []string) {
+	for i := range bookings {
+		bookings[i].fields = fields
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParseFields(t *testing.T) {
+	c := qt.New(t)
+	parse := func(query string) ([]string, error) {
+		req := httptest.NewRequest(http.MethodGet, "/tools?"+query, nil)
+		return parseFields(&HTTPContext{Request: req}, toolFields)
+	}
+
+	fields, err := parse("")
+	c.Assert(err, qt.IsNil)
+	c.Assert(fields, qt.IsNil)
+
+	// The id is always included, and duplicates are ignored
+	fields, err = parse("fields=title,cost,%20location,title")
+	c.Assert(err, qt.IsNil)
+	c.Assert(fields, qt.DeepEquals, []string{"id", "title", "cost", "location"})
+	fields, err = parse("fields[]=title&fields[]=rating")
+	c.Assert(err, qt.IsNil)
+	c.Assert(fields, qt.DeepEquals, []string{"id", "title", "rating"})
+
+	_, err = parse("fields=title,password")
+	c.Assert(err, qt.ErrorMatches, `.*unknown field "password"`)
+
+	c.Assert(fieldSelected(nil, "quality"), qt.IsTrue)
+	c.Assert(fieldSelected([]string{"id", "quality"}, "quality"), qt.IsTrue)
+	c.Assert(fieldSelected([]string{"id", "title"}, "quality"), qt.IsFalse)
+}
+
+func TestFieldsProjection(t *testing.T) {
+	c := qt.New(t)
+	c.Assert(fieldsProjection(nil, toolFields, toolRequiredFields), qt.IsNil)
+	c.Assert(fieldsProjection([]string{"id", "rating", "ownerAvatarUrl", "isFavorite", "usageTerms"},
+		toolFields, toolRequiredFields), qt.DeepEquals,
+		[]string{
+			"_id", "userId", "updatedAt", "community", "visibility", "visibleTo", "managers", "status",
+			"ratingAverage", "usageTerms", "usageTermsVersion",
+		})
+	c.Assert(fieldsProjection([]string{"id", "startDate"}, bookingFields, bookingRequiredFields), qt.DeepEquals,
+		[]string{"_id", "fromUserId", "toUserId", "startDate"})
+}
+
+func TestMarshalFields(t *testing.T) {
+	c := qt.New(t)
+	cost := uint64(10)
+	tools := []*Tool{{ID: 1, Title: "Drill", Description: "Cordless", Cost: &cost}}
+
+	data, err := json.Marshal(&ToolsWrapper{Tools: tools})
+	c.Assert(err, qt.IsNil)
+	var all struct {
+		Tools []map[string]interface{} `json:"tools"`
+	}
+	c.Assert(json.Unmarshal(data, &all), qt.IsNil)
+	c.Assert(all.Tools[0]["description"], qt.Equals, "Cordless")
+
+	selectToolFields(tools, []string{"id", "title", "cost", "rating"})
+	data, err = json.Marshal(&ToolsWrapper{Tools: tools})
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(data), qt.Equals, `{"tools":[{"cost":10,"id":1,"title":"Drill"}]}`)
+
+	bookings := []BookingResponse{{ID: "b1", Contact: "me@example.com", StartDate: 100}}
+	selectBookingFields(bookings, []string{"id", "startDate"})
+	data, err = json.Marshal(bookings)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(data), qt.Equals, `[{"id":"b1","startDate":100}]`)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/geocoding"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// localityPrecision is the microdegrees grid used to cache reverse lookups (about 1 km),
+// so nearby locations share the same cached locality.
+const localityPrecision = 10000
+
+// resolveLocation returns the location and locality for the given coordinates or, if the
+// location is empty, for the given address. It returns nil if neither is provided.
+func (a *API) resolveLocation(ctx context.Context, location *Location, address string) (*db.DBLocation, string, error) {
+	if location != nil && (location.Latitude != 0 || location.Longitude != 0) {
+		dbLocation := location.ToDBLocation()
+		return &dbLocation, a.locality(ctx, location.Latitude, location.Longitude), nil
+	}
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return nil, "", nil
+	}
+	place, err := a.geocode(ctx, address)
+	if err != nil {
+		return nil, "", err
+	}
+	dbLocation := db.NewLocation(place.Latitude, place.Longitude)
+	return &dbLocation, place.Locality, nil
+}
+
+// geocode resolves the address to a place, using the lookups cached in the database.
+func (a *API) geocode(ctx context.Context, address string) (*geocoding.Place, error) {
+	if a.geocoder == nil {
+		return nil, ErrGeocodingDisabled
+	}
+	key := "geocode:" + strings.ToLower(strings.Join(strings.Fields(address), " "))
+	place, err := a.cachedLookup(ctx, key, func() (*geocoding.Place, error) {
+		return a.geocoder.Geocode(ctx, address)
+	})
+	if err != nil {
+		return nil, ErrGeocodingUnavailable.WithErr(err)
+	}
+	if place == nil {
+		return nil, ErrAddressNotFound.WithErr(fmt.Errorf("no place matches %q", address))
+	}
+	return place, nil
+}
+
+// locality returns the human-readable locality of the coordinates (in microdegrees), or an
+// empty string if geocoding is disabled or the lookup fails.
+func (a *API) locality(ctx context.Context, latitude, longitude int64) string {
+	if a.geocoder == nil {
+		return ""
+	}
+	latitude = latitude / localityPrecision * localityPrecision
+	longitude = longitude / localityPrecision * localityPrecision
+	key := fmt.Sprintf("reverse:%d,%d", latitude, longitude)
+	place, err := a.cachedLookup(ctx, key, func() (*geocoding.Place, error) {
+		return a.geocoder.Reverse(ctx, latitude, longitude)
+	})
+	if err != nil {
+		log.Warn().Err(err).Msgf("could not get the locality of %d,%d", latitude, longitude)
+		return ""
+	}
+	if place == nil {
+		return ""
+	}
+	return place.Locality
+}
+
+// cachedLookup returns the cached result of the lookup or runs it and caches the result.
+// A nil place means the lookup did not match any place. Provider errors are not cached.
+func (a *API) cachedLookup(
+	ctx context.Context,
+	key string,
+	lookup func() (*geocoding.Place, error),
+) (*geocoding.Place, error) {
+	entry, err := a.database.GeocodeCache.Get(ctx, key)
+	if err == nil {
+		if !entry.Found {
+			return nil, nil
+		}
+		return &geocoding.Place{Latitude: entry.Latitude, Longitude: entry.Longitude, Locality: entry.Locality}, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Warn().Err(err).Msgf("could not read geocode cache %q", key)
+	}
+
+	place, err := lookup()
+	if err != nil && !errors.Is(err, geocoding.ErrNotFound) {
+		return nil, err
+	}
+	entry = &db.GeocodeCacheEntry{Key: key}
+	if place != nil {
+		entry.Found = true
+		entry.Latitude = place.Latitude
+		entry.Longitude = place.Longitude
+		entry.Locality = place.Locality
+	}
+	if err := a.database.GeocodeCache.Set(ctx, entry); err != nil {
+		log.Warn().Err(err).Msgf("could not write geocode cache %q", key)
+	}
+	return place, nil
+}
@@ -1,12 +1,16 @@
 package api
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
@@ -18,11 +22,92 @@ type RouterHandlerFn = func(r *Request) (interface{}, error)
 // Request represents an HTTP request to the API.
 // It contains the request Body data, the URL path and the HTTP context.
 // The context can be used for obtaining URL parameters and sending responses.
+// Version is the API version of the route, 1 for the unversioned routes.
 type Request struct {
 	Data    []byte
 	Path    []string
 	Context *HTTPContext
 	UserID  string
+	// SessionID is the session of the token, empty for the tokens issued before the sessions.
+	SessionID string
+	Version   int
+}
+
+// RawResponse can be returned by a handler to reply with a non JSON body, i.e. a file download.
+type RawResponse struct {
+	ContentType string
+	// Filename, if set, makes the client download the body as an attachment.
+	Filename string
+	Data     []byte
+	// CacheControl, if set, is sent as the Cache-Control header.
+	CacheControl string
+	// ETag, if set, is sent as the ETag header. Requests with a matching If-None-Match
+	// header get a 304 Not Modified reply without body.
+	ETag string
+	// LastModified, if set, is sent as the Last-Modified header and checked against the
+	// If-Modified-Since header.
+	LastModified *time.Time
+	// Ranges enables the range requests, which reply the requested parts of the body.
+	Ranges bool
+}
+
+// CachedResponse can be returned by a handler to reply with a JSON body that supports conditional
+// requests. Requests with a matching If-None-Match header, or without it and with an
+// If-Modified-Since header not older than LastModified, get a 304 Not Modified reply without body.
+type CachedResponse struct {
+	Data interface{}
+	// ETag, if set, is used instead of the hash of the body, i.e. for immutable resources.
+	ETag string
+	// LastModified, if set, is sent as the Last-Modified header. It must change with the body.
+	LastModified *time.Time
+	// CacheControl is sent as the Cache-Control header, by default the clients must revalidate.
+	CacheControl string
+}
+
+// defaultCacheControl lets the clients keep the private responses but revalidate them on each use.
+const defaultCacheControl = "private, no-cache"
+
+// setHeaders sets the caching headers of the response with the given body, and returns true if
+// the client copy is still valid.
+func (c *CachedResponse) setHeaders(w http.ResponseWriter, req *http.Request, body []byte) bool {
+	etag := c.ETag
+	if etag == "" {
+		hash := sha256.Sum256(body)
+		etag = fmt.Sprintf("%q", hex.EncodeToString(hash[:16]))
+	}
+	cacheControl := c.CacheControl
+	if cacheControl == "" {
+		cacheControl = defaultCacheControl
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	if c.LastModified != nil {
+		w.Header().Set("Last-Modified", c.LastModified.UTC().Format(http.TimeFormat))
+	}
+	return notModified(req, etag, c.LastModified)
+}
+
+// notModified returns true if the conditional headers of the request match the ETag or the last
+// modification time of the resource. If-Modified-Since is ignored if If-None-Match is present.
+func notModified(req *http.Request, etag string, lastModified *time.Time) bool {
+	if header := req.Header.Get("If-None-Match"); header != "" {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || (etag != "" && candidate == etag) {
+				return true
+			}
+		}
+		return false
+	}
+	if lastModified == nil {
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// The header has a precision of seconds
+	return !lastModified.Truncate(time.Second).After(since)
 }
 
 // HTTPContext is the Context for an HTTP request.
@@ -48,6 +133,53 @@ func (h *HTTPContext) GetPage() (int, error) {
 	return 0, nil
 }
 
+// GetPageSize returns the page size from the query parameters.
+// If the pageSize parameter is not present, it returns 0 (use the default page size).
+// If the pageSize parameter is invalid or less than 1, it returns an error.
+func (h *HTTPContext) GetPageSize() (int, error) {
+	if sizeParam := h.URLParam("pageSize"); sizeParam != nil {
+		size, err := strconv.Atoi(sizeParam[0])
+		if err != nil {
+			return 0, fmt.Errorf("invalid page size")
+		}
+		if size < 1 {
+			return 0, fmt.Errorf("page size must be greater than 0")
+		}
+		return size, nil
+	}
+	return 0, nil
+}
+
+// maxBatchIDs is the maximum number of objects requested at once with the ids parameter.
+const maxBatchIDs = 100
+
+// GetIDs returns the comma separated IDs of the ids query parameter, without duplicates, to
+// retrieve several objects at once. If the parameter is not present, it returns nil. If it has
+// no IDs or more than maxBatchIDs, it returns an error.
+func (h *HTTPContext) GetIDs() ([]string, error) {
+	param := h.URLParam("ids")
+	if param == nil {
+		return nil, nil
+	}
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, value := range param {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no ids given")
+	}
+	if len(ids) > maxBatchIDs {
+		return nil, fmt.Errorf("at most %d ids can be requested at once", maxBatchIDs)
+	}
+	return ids, nil
+}
+
 // URLParam gets a URL parameter. For path parameters (specified in the path pattern as {key}),
 // it uses chi.URLParam. For query parameters (?key=value and ?key[]=value), it uses URL.Query().
 // If the key is not found, it returns nil. Else it returns a slice of values with at least one element.
@@ -111,34 +243,12 @@ func (a *API) routerHandler(handlerFunc RouterHandlerFn) func(w http.ResponseWri
 			body, err = io.ReadAll(req.Body)
 			if err != nil {
 				log.Warn().Err(err).Msg("failed to read request body")
-				resp := &Response{
-					Header: ResponseHeader{
-						Success: false,
-						Message: err.Error(),
-					},
-				}
-				msg, _ := json.Marshal(resp)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusBadRequest)
-				if _, err := w.Write(msg); err != nil {
-					log.Error().Err(err).Msg("failed to write response")
-				}
+				sendError(w, ErrInvalidRequestBodyData.WithErr(err))
 				return
 			}
 			if err := req.Body.Close(); err != nil {
 				log.Warn().Err(err).Msg("failed to close request body")
-				resp := &Response{
-					Header: ResponseHeader{
-						Success: false,
-						Message: err.Error(),
-					},
-				}
-				msg, _ := json.Marshal(resp)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError)
-				if _, err := w.Write(msg); err != nil {
-					log.Error().Err(err).Msg("failed to write response")
-				}
+				sendError(w, ErrInternalServerError.WithErr(err))
 				return
 			}
 			if len(body) > 0 {
@@ -152,68 +262,104 @@ func (a *API) routerHandler(handlerFunc RouterHandlerFn) func(w http.ResponseWri
 		}
 		// Create request object with user ID from JWT
 		request := &Request{
-			Data:    body,
-			Context: hc,
-			Path:    strings.Split(req.URL.Path, "/")[1:],
-			UserID:  req.Header.Get("X-User-ID"),
+			Data:      body,
+			Context:   hc,
+			Path:      strings.Split(req.URL.Path, "/")[1:],
+			UserID:    req.Header.Get("X-User-ID"),
+			SessionID: req.Header.Get("X-Session-ID"),
+			Version:   requestAPIVersion(req),
 		}
 
 		handlerResp, err := handlerFunc(request)
 		resp := new(Response)
 		if err != nil {
 			log.Warn().Err(err).Msg("failed request")
-			resp.Header.Success = false
 
 			// Convert error to HTTPError if it isn't one already
-			var httpErr *HTTPError
-			if e, ok := err.(*HTTPError); ok {
-				httpErr = e
-			} else {
+			httpErr, ok := err.(*HTTPError)
+			if !ok {
 				httpErr = ErrInternalServerError.WithErr(err)
 			}
-
-			resp.Header.Message = httpErr.Error()
-			msg, marshalErr := json.Marshal(resp)
-			if marshalErr != nil {
-				log.Error().Err(marshalErr).Msg("failed to marshal response")
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError)
-				if _, err := w.Write([]byte(`{"header":{"success":false,"message":"internal server error"}}`)); err != nil {
-					log.Error().Err(err).Msg("failed to write response")
+			sendError(w, httpErr)
+			return
+		}
+		if raw, ok := handlerResp.(*RawResponse); ok {
+			w.Header().Set("Content-Type", raw.ContentType)
+			if raw.Filename != "" {
+				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", raw.Filename))
+			}
+			if raw.CacheControl != "" {
+				w.Header().Set("Cache-Control", raw.CacheControl)
+			}
+			if raw.ETag != "" {
+				w.Header().Set("ETag", raw.ETag)
+			}
+			if raw.LastModified != nil {
+				w.Header().Set("Last-Modified", raw.LastModified.UTC().Format(http.TimeFormat))
+			}
+			if raw.Ranges {
+				// ServeContent checks the conditional requests too, with the headers already set
+				var modified time.Time
+				if raw.LastModified != nil {
+					modified = *raw.LastModified
 				}
+				http.ServeContent(w, req, "", modified, bytes.NewReader(raw.Data))
 				return
 			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(httpErr.Code)
-			if _, err := w.Write(msg); err != nil {
+			if (raw.ETag != "" || raw.LastModified != nil) && notModified(req, raw.ETag, raw.LastModified) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write(raw.Data); err != nil {
 				log.Error().Err(err).Msg("failed to write response")
 			}
 			return
 		}
+		cached, isCached := handlerResp.(*CachedResponse)
+		if isCached {
+			handlerResp = cached.Data
+		}
 		resp.Header.Success = true
 		resp.Data = handlerResp
 		data, err := json.Marshal(resp)
 		if err != nil {
 			log.Error().Err(err).Msg("failed to marshal response")
-			resp := &Response{
-				Header: ResponseHeader{
-					Success: false,
-					Message: err.Error(),
-				},
-			}
-			msg, _ := json.Marshal(resp)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			if _, err := w.Write(msg); err != nil {
-				log.Error().Err(err).Msg("failed to write response")
-			}
+			sendError(w, ErrInternalServerError.WithErr(err))
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
+		if isCached && cached.setHeaders(w, req, data) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		if _, err := w.Write(data); err != nil {
 			log.Error().Err(err).Msg("failed to write response")
 		}
 	}
 }
+
+// sendError replies the error as a JSON response with its HTTP status code, its error code
+// and its message in the response header.
+func sendError(w http.ResponseWriter, httpErr *HTTPError) {
+	msg, err := json.Marshal(&Response{
+		Header: ResponseHeader{
+			Success:   false,
+			Message:   httpErr.Error(),
+			ErrorCode: httpErr.ErrorCode,
+		},
+		Data: httpErr.Data,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		msg = []byte(`{"header":{"success":false,"message":"internal server error","errorCode":"server.internal"}}`)
+	} else {
+		w.WriteHeader(httpErr.Code)
+	}
+	if _, err := w.Write(msg); err != nil {
+		log.Error().Err(err).Msg("failed to write response")
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestNotModified(t *testing.T) {
+	c := qt.New(t)
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 500, time.UTC)
+	request := func(header, value string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/tools/1", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		return req
+	}
+
+	c.Assert(notModified(request("", ""), `"abc"`, &modified), qt.IsFalse)
+	c.Assert(notModified(request("If-None-Match", `"abc"`), `"abc"`, nil), qt.IsTrue)
+	c.Assert(notModified(request("If-None-Match", `"xyz", W/"abc"`), `"abc"`, nil), qt.IsTrue)
+	c.Assert(notModified(request("If-None-Match", "*"), `"abc"`, nil), qt.IsTrue)
+	c.Assert(notModified(request("If-None-Match", `"xyz"`), `"abc"`, nil), qt.IsFalse)
+
+	// The modification time is compared with a precision of seconds
+	since := modified.Format(http.TimeFormat)
+	c.Assert(notModified(request("If-Modified-Since", since), `"abc"`, &modified), qt.IsTrue)
+	before := modified.Add(-time.Second).Format(http.TimeFormat)
+	c.Assert(notModified(request("If-Modified-Since", before), `"abc"`, &modified), qt.IsFalse)
+	c.Assert(notModified(request("If-Modified-Since", since), `"abc"`, nil), qt.IsFalse)
+	c.Assert(notModified(request("If-Modified-Since", "yesterday"), `"abc"`, &modified), qt.IsFalse)
+}
+
+func TestCachedResponseHeaders(t *testing.T) {
+	c := qt.New(t)
+	body := []byte(`{"data":1}`)
+
+	w := httptest.NewRecorder()
+	response := &CachedResponse{Data: 1}
+	c.Assert(response.setHeaders(w, httptest.NewRequest(http.MethodGet, "/tools", nil), body), qt.IsFalse)
+	etag := w.Header().Get("ETag")
+	c.Assert(etag, qt.Matches, `"[0-9a-f]{32}"`)
+	c.Assert(w.Header().Get("Cache-Control"), qt.Equals, defaultCacheControl)
+	c.Assert(w.Header().Get("Last-Modified"), qt.Equals, "")
+
+	// The same body has the same ETag
+	req := httptest.NewRequest(http.MethodGet, "/tools", nil)
+	req.Header.Set("If-None-Match", etag)
+	c.Assert(response.setHeaders(httptest.NewRecorder(), req, body), qt.IsTrue)
+	c.Assert(response.setHeaders(httptest.NewRecorder(), req, []byte(`{"data":2}`)), qt.IsFalse)
+}
+
+func TestGetIDs(t *testing.T) {
+	c := qt.New(t)
+	ids := func(query string) ([]string, error) {
+		hc := &HTTPContext{Request: httptest.NewRequest(http.MethodGet, "/tools"+query, nil)}
+		return hc.GetIDs()
+	}
+
+	result, err := ids("")
+	c.Assert(err, qt.IsNil)
+	c.Assert(result, qt.IsNil)
+	result, err = ids("?ids=3,1,%203,2")
+	c.Assert(err, qt.IsNil)
+	c.Assert(result, qt.DeepEquals, []string{"3", "1", "2"})
+	result, err = ids("?ids=1&ids=4")
+	c.Assert(err, qt.IsNil)
+	c.Assert(result, qt.DeepEquals, []string{"1", "4"})
+	_, err = ids("?ids=,")
+	c.Assert(err, qt.IsNotNil)
+	many := "?ids=0"
+	for i := 1; i <= maxBatchIDs; i++ {
+		many += "," + strconv.Itoa(i)
+	}
+	_, err = ids(many)
+	c.Assert(err, qt.IsNotNil)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const (
+	healthStatusOK          = "ok"
+	healthStatusError       = "error"
+	healthStatusUnavailable = "unavailable"
+	// readinessTimeout is the time each dependency has to answer the readiness checks.
+	readinessTimeout = 5 * time.Second
+)
+
+// healthDependency is a dependency checked by the readiness endpoint.
+type healthDependency struct {
+	name     string
+	optional bool
+	check    func(ctx context.Context) error
+}
+
+// healthzHandler handles GET /healthz
+// It only tells the process is alive, without checking its dependencies.
+func (a *API) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	sendHealth(&HTTPContext{Writer: w, Request: r}, &HealthResponse{Status: healthStatusOK}, http.StatusOK)
+}
+
+// readyzHandler handles GET /readyz
+// It checks the dependencies of the service: the database connection, the database indexes
+// and, if configured, the SMTP server (optional). It replies 503 if a required one fails, so
+// no traffic is sent to the instance until it is ready.
+func (a *API) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	dependencies := []healthDependency{
+		{name: "mongodb", check: func(ctx context.Context) error {
+			return a.database.Client.Ping(ctx, readpref.Primary())
+		}},
+		{name: "indexes", check: func(ctx context.Context) error {
+			missing, err := db.MissingIndexes(ctx, a.database)
+			if err != nil {
+				return err
+			}
+			if len(missing) > 0 {
+				return fmt.Errorf("%d indexes missing: %v", len(missing), missing)
+			}
+			return nil
+		}},
+	}
+	if checker, ok := a.mailer.(mail.Checker); ok {
+		dependencies = append(dependencies, healthDependency{name: "smtp", optional: true, check: checker.Check})
+	}
+
+	result := checkHealth(r.Context(), dependencies)
+	status := http.StatusOK
+	if result.Status != healthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	sendHealth(&HTTPContext{Writer: w, Request: r}, result, status)
+}
+
+// checkHealth checks the dependencies concurrently. The result status is ok unless a required
+// dependency failed.
+func checkHealth(ctx context.Context, dependencies []healthDependency) *HealthResponse {
+	result := &HealthResponse{Status: healthStatusOK, Checks: make(map[string]*HealthCheck, len(dependencies))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, dependency := range dependencies {
+		wg.Add(1)
+		go func(dependency healthDependency) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+			defer cancel()
+			start := time.Now()
+			err := dependency.check(ctx)
+			check := &HealthCheck{
+				Status:    healthStatusOK,
+				Optional:  dependency.optional,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Warn().Err(err).Msgf("readiness check %s failed", dependency.name)
+				check.Status, check.Error = healthStatusError, err.Error()
+				if !dependency.optional {
+					result.Status = healthStatusUnavailable
+				}
+			}
+			result.Checks[dependency.name] = check
+		}(dependency)
+	}
+	wg.Wait()
+	return result
+}
+
+// sendHealth replies with the health response, not wrapped as the other responses so the
+// probes can read it directly.
+func sendHealth(hc *HTTPContext, result *HealthResponse, status int) {
+	hc.Writer.Header().Set("Cache-Control", "no-store")
+	msg, err := json.Marshal(result)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal health response")
+		return
+	}
+	if err := hc.Send(msg, status); err != nil {
+		log.Warn().Err(err).Msg("failed to send health response")
+	}
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestCheckHealth(t *testing.T) {
+	c := qt.New(t)
+	ok := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return fmt.Errorf("unreachable") }
+
+	result := checkHealth(context.Background(), []healthDependency{
+		{name: "mongodb", check: ok},
+		{name: "smtp", optional: true, check: fail},
+	})
+	c.Assert(result.Status, qt.Equals, healthStatusOK)
+	c.Assert(result.Checks["mongodb"].Status, qt.Equals, healthStatusOK)
+	c.Assert(result.Checks["smtp"].Status, qt.Equals, healthStatusError)
+	c.Assert(result.Checks["smtp"].Optional, qt.IsTrue)
+	c.Assert(result.Checks["smtp"].Error, qt.Equals, "unreachable")
+
+	// A failed required dependency makes the service unavailable
+	result = checkHealth(context.Background(), []healthDependency{
+		{name: "mongodb", check: fail},
+		{name: "indexes", check: ok},
+	})
+	c.Assert(result.Status, qt.Equals, healthStatusUnavailable)
+	c.Assert(result.Checks["mongodb"].Error, qt.Equals, "unreachable")
+	c.Assert(result.Checks["indexes"].Status, qt.Equals, healthStatusOK)
+}
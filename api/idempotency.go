@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// idempotencyKeyHeader is the header with the key the clients send to retry a request safely.
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyReplayedHeader is set on the responses replayed to a retry.
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	// idempotencyKeyTTL is the time the response of a request is replayed to its retries.
+	idempotencyKeyTTL = 24 * time.Hour
+	// idempotencyLockTTL is the time a request in progress blocks its retries, in case the
+	// instance processing it stops before completing it.
+	idempotencyLockTTL = time.Minute
+	// maxIdempotencyKeyLength is the maximum length of an idempotency key.
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotent wraps a handler creating a resource so the requests with an Idempotency-Key header
+// are processed once. The response of the first request with a key is replayed to the requests
+// of the same user with the same key for idempotencyKeyTTL, with the Idempotent-Replayed header.
+// A key reused with a different endpoint or body is rejected. Failed requests are not stored, so
+// they can be retried with the same key.
+func (a *API) idempotent(handler RouterHandlerFn) RouterHandlerFn {
+	return func(r *Request) (interface{}, error) {
+		req := r.Context.Request
+		key := req.Header.Get(idempotencyKeyHeader)
+		if key == "" || r.UserID == "" {
+			return handler(r)
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return nil, ErrInvalidIdempotencyKey
+		}
+		hash := sha256.Sum256(r.Data)
+		now := time.Now()
+		record := &db.IdempotencyKey{
+			ID:          r.UserID + ":" + key,
+			UserID:      r.UserID,
+			Endpoint:    req.Method + " " + req.URL.Path,
+			RequestHash: hex.EncodeToString(hash[:]),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(idempotencyLockTTL),
+		}
+		stored, err := a.database.IdempotencyService.Start(req.Context(), record, now)
+		if err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
+		}
+		if stored != nil {
+			if stored.Endpoint != record.Endpoint || stored.RequestHash != record.RequestHash {
+				return nil, ErrIdempotencyKeyReused
+			}
+			if !stored.Completed {
+				return nil, ErrIdempotencyKeyInProgress
+			}
+			r.Context.Writer.Header().Set(idempotencyReplayedHeader, "true")
+			return json.RawMessage(stored.Response), nil
+		}
+
+		// The client may be gone when the request completes, which is when its retries matter
+		ctx := context.Background()
+		resp, err := handler(r)
+		if err != nil {
+			if err := a.database.IdempotencyService.Release(ctx, record.ID); err != nil {
+				log.Error().Err(err).Msgf("could not release idempotency key %s", record.ID)
+			}
+			return nil, err
+		}
+		data, err := json.Marshal(resp)
+		if err == nil {
+			err = a.database.IdempotencyService.Complete(ctx, record.ID, data, time.Now().Add(idempotencyKeyTTL))
+		}
+		if err != nil {
+			log.Error().Err(err).Msgf("could not store the response of idempotency key %s", record.ID)
+		}
+		return resp, nil
+	}
+}
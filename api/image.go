@@ -1,16 +1,15 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"image"
 	_ "image/gif"  // Import image decoders for supported formats
 	_ "image/jpeg" // JPEG support
 	_ "image/png"  // PNG support
+	"time"
 
 	"github.com/emprius/emprius-app-backend/db"
 	"github.com/emprius/emprius-app-backend/types"
@@ -18,58 +17,107 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// checkIfDataIsAnImage checks if the given data is an image.
-func checkIfDataIsAnImage(data []byte) error {
-	if len(data) == 0 {
-		return ErrInvalidImageFormat.WithErr(fmt.Errorf("empty image data"))
-	}
-
-	// Create a reader from the byte slice
-	reader := bytes.NewReader(data)
-
-	// Decode the image
-	_, format, err := image.Decode(reader)
-	if err != nil {
-		return ErrInvalidImageFormat.WithErr(err)
-	}
-
-	// Ensure the format is not empty
-	if format == "" {
-		return ErrInvalidImageFormat.WithErr(fmt.Errorf("unknown image format"))
-	}
-
-	return nil
-}
+const (
+	// imageCacheControl lets the clients keep the images, as they never change.
+	imageCacheControl = "private, max-age=31536000, immutable"
+	// imageGracePeriod is the time an uploaded image is kept without being referenced, so it
+	// can be referenced by the tool or profile being edited.
+	imageGracePeriod = 24 * time.Hour
+	// imageGCInterval is the time between two collections of the unreferenced images.
+	imageGCInterval = 24 * time.Hour
+)
 
 // addImage returns the corresponding db.Image to the data content.
 // If the image is not in the database, it will be added.
 // If the image is already in the database, it will be returned.
+//
+// The added images are normalized (see normalizeImage): the images larger than imageAsyncSize
+// are stored pending and processed in the background, the others before being stored.
 func (a *API) addImage(name string, data []byte) (*db.Image, error) {
-	if err := checkIfDataIsAnImage(data); err != nil {
-		log.Debug().Err(err).Msg("invalid image format")
-		return nil, err
+	return a.storeImage(name, data, true)
+}
+
+// addProcessedImage is addImage for the images generated by the server, which are stored as
+// they are.
+func (a *API) addProcessedImage(name string, data []byte) (*db.Image, error) {
+	return a.storeImage(name, data, false)
+}
+
+// storeImage adds the image, normalizing it first if normalize is true. The image is addressed
+// by the hash of the data, so an image uploaded again is found without processing it again.
+func (a *API) storeImage(name string, data []byte, normalize bool) (*db.Image, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidImageFormat.WithErr(fmt.Errorf("empty image data"))
 	}
 	hash := sha256.Sum256(data)
 	image, err := a.database.ImageService.GetImage(context.Background(), hash[:])
-	if err == mongo.ErrNoDocuments {
-		image := &db.Image{
-			Hash:    hash[:],
-			Content: data,
-			Name:    name,
-		}
-		_, err := a.database.ImageService.InsertImage(context.Background(), image)
-		if err != nil {
-			return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	if err == nil {
+		// Uploaded again, so it must not be collected before it is referenced
+		if err := a.database.ImageService.TouchImage(context.Background(), hash[:], time.Now()); err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
 		}
-		log.Debug().Msgf("added image %s", image.Hash.String())
 		return image, nil
 	}
-	if err != nil {
+	if err != mongo.ErrNoDocuments {
 		return nil, ErrInternalServerError.WithErr(err)
 	}
+
+	image = &db.Image{
+		Hash:    hash[:],
+		Content: data,
+		Name:    name,
+	}
+	switch {
+	case !normalize:
+		if err := checkImageDimensions(data); err != nil {
+			return nil, ErrInvalidImageFormat.WithErr(err)
+		}
+	case len(data) > imageAsyncSize:
+		if err := checkImageDimensions(data); err != nil {
+			log.Debug().Err(err).Msg("invalid image format")
+			return nil, ErrInvalidImageFormat.WithErr(err)
+		}
+		image.Pending = true
+	default:
+		content, err := normalizeImage(data)
+		if err != nil {
+			log.Debug().Err(err).Msg("invalid image format")
+			return nil, ErrInvalidImageFormat.WithErr(err)
+		}
+		image.Content = content
+	}
+	if _, err := a.database.ImageService.InsertImage(context.Background(), image); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	if image.Pending {
+		a.enqueueImage(image.Hash)
+	}
+	log.Debug().Msgf("added image %s", image.Hash.String())
 	return image, nil
 }
 
+// collectOrphanImages deletes the images not referenced by any tool, booking or avatar, and the
+// media not attached to any tool, once per imageGCInterval. The images and media uploaded in the
+// last imageGracePeriod are kept.
+func (a *API) collectOrphanImages(ctx context.Context) error {
+	now := time.Now()
+	if now.Sub(a.imageGCAt) < imageGCInterval {
+		return nil
+	}
+	deleted, err := a.database.DeleteOrphanImages(ctx, now.Add(-imageGracePeriod))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Info().Msgf("deleted %d unreferenced images", deleted)
+	}
+	if err := a.collectOrphanMedia(ctx, now); err != nil {
+		return err
+	}
+	a.imageGCAt = now
+	return nil
+}
+
 func (a *API) image(hash []byte) (*db.Image, error) {
 	image, err := a.database.ImageService.GetImage(context.Background(), hash)
 	if err != nil {
@@ -78,6 +126,9 @@ func (a *API) image(hash []byte) (*db.Image, error) {
 		}
 		return nil, ErrInternalServerError.WithErr(err)
 	}
+	if image.Pending {
+		return nil, ErrImageProcessing.WithErr(fmt.Errorf("image with hash %x is being processed", hash))
+	}
 	return image, nil
 }
 
@@ -140,5 +191,11 @@ func (a *API) imageHandler(r *Request) (interface{}, error) {
 		return nil, err
 	}
 
-	return image, nil
+	// Images are addressed by the hash of their content, so they never change
+	return &CachedResponse{
+		Data:         image,
+		ETag:         fmt.Sprintf("%q", image.Hash.String()),
+		LastModified: image.CreatedAt,
+		CacheControl: imageCacheControl,
+	}, nil
 }
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// imageJPEGQuality is the quality the opaque images are re-encoded with.
+	imageJPEGQuality = 85
+	// maxImageDimension is the maximum width and height of the uploaded images, larger images
+	// are rejected before decoding.
+	maxImageDimension = 8000
+	// imageAsyncSize is the size from which the uploaded images are processed in the background.
+	imageAsyncSize = 1 << 20 // bytes
+	// imageQueueSize is the number of images waiting to be processed in the background. The
+	// images that do not fit are processed by the next run of the jobs.
+	imageQueueSize = 64
+	// pendingImagesBatchSize is the maximum number of pending images processed per job run.
+	pendingImagesBatchSize = 20
+)
+
+// normalizeImage re-encodes the uploaded image so it renders upright and leaks no metadata: the
+// EXIF orientation is applied, and the image is encoded without its metadata (i.e. the GPS
+// location of the photos), as JPEG or, if it has transparent pixels, as PNG. Animated GIFs
+// keep their first frame.
+func normalizeImage(data []byte) ([]byte, error) {
+	if err := checkImageDimensions(data); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	img := orientImage(src, exifOrientation(data))
+	var buf bytes.Buffer
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: imageJPEGQuality})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkImageDimensions returns an error if the data is not an image or it is larger than
+// maxImageDimension, only decoding its header.
+func checkImageDimensions(data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if config.Width > maxImageDimension || config.Height > maxImageDimension {
+		return fmt.Errorf("image larger than %dx%d pixels", maxImageDimension, maxImageDimension)
+	}
+	return nil
+}
+
+// exifOrientation returns the orientation (1 to 8) of the EXIF metadata of a JPEG image, or 1
+// if it has none.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		// The image data starts with the start of scan segment, after the metadata
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation returns the orientation tag of the first IFD of the TIFF structure of the EXIF
+// metadata, or 1 if it has none.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// The orientation is a SHORT, stored in the first bytes of the value
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orientImage returns the image transformed as the EXIF orientation requires to render it
+// upright: flipped and/or rotated. Orientations 5 to 8 swap the width and the height.
+func orientImage(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	var dst *image.NRGBA
+	if orientation >= 5 {
+		dst = image.NewNRGBA(image.Rect(0, 0, h, w))
+	} else {
+		dst = image.NewNRGBA(image.Rect(0, 0, w, h))
+	}
+	for y := 0; y < dst.Rect.Dy(); y++ {
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flip horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotate 180 degrees
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip vertically
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90 degrees clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90 degrees counterclockwise
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, color.NRGBAModel.Convert(src.At(b.Min.X+sx, b.Min.Y+sy)))
+		}
+	}
+	return dst
+}
+
+// enqueueImage queues the pending image with the given hash to be processed in the background.
+// If the queue is full, it is processed by the next run of the jobs.
+func (a *API) enqueueImage(hash []byte) {
+	select {
+	case a.imageQueue <- hash:
+	default:
+		log.Warn().Msgf("image queue full, image %x processed by the next jobs run", hash)
+	}
+}
+
+// processQueuedImages processes the images of the queue, until it is closed.
+func (a *API) processQueuedImages() {
+	for hash := range a.imageQueue {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := a.processImage(ctx, hash); err != nil {
+			log.Error().Err(err).Msgf("could not process image %x", hash)
+		}
+		cancel()
+	}
+}
+
+// processPendingImages processes the pending images not processed from the queue, i.e. because
+// it was full or the server stopped.
+func (a *API) processPendingImages(ctx context.Context) error {
+	images, err := a.database.ImageService.GetPendingImages(ctx, pendingImagesBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		if err := a.processImage(ctx, image.Hash); err != nil {
+			log.Error().Err(err).Msgf("could not process image %x", []byte(image.Hash))
+		}
+	}
+	return nil
+}
+
+// processImage normalizes the content of the pending image with the given hash. Images that
+// cannot be processed are deleted, so their original content is never served.
+func (a *API) processImage(ctx context.Context, hash []byte) error {
+	image, err := a.database.ImageService.GetImage(ctx, hash)
+	if err != nil {
+		return err
+	}
+	if !image.Pending {
+		return nil
+	}
+	content, err := normalizeImage(image.Content)
+	if err != nil {
+		log.Warn().Err(err).Msgf("deleting image %x, it cannot be processed", hash)
+		return a.database.ImageService.DeletePendingImage(ctx, hash)
+	}
+	return a.database.ImageService.SetProcessedContent(ctx, hash, content)
+}
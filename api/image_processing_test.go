@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// testJPEGWithOrientation returns a 40x20 JPEG, red on the left half and blue on the right
+// one, with EXIF metadata setting the orientation and a GPS location.
+func testJPEGWithOrientation(c *qt.C, orientation uint16) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 20 {
+				img.Set(x, y, color.NRGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.NRGBA{B: 255, A: 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	c.Assert(jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}), qt.IsNil)
+	data := buf.Bytes()
+
+	// A big endian TIFF structure with an IFD with the orientation entry
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01")
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, []byte("GPS 41.3851N 2.1734E")...)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	withExif := append([]byte{}, data[:2]...)
+	withExif = append(withExif, app1...)
+	return append(withExif, data[2:]...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	c := qt.New(t)
+
+	for orientation := uint16(1); orientation <= 8; orientation++ {
+		c.Assert(exifOrientation(testJPEGWithOrientation(c, orientation)), qt.Equals, int(orientation))
+	}
+	// Invalid orientations and images without EXIF metadata are upright
+	c.Assert(exifOrientation(testJPEGWithOrientation(c, 9)), qt.Equals, 1)
+	c.Assert(exifOrientation(testPNG(c, 10, 10, color.White)), qt.Equals, 1)
+	c.Assert(exifOrientation([]byte{0xFF, 0xD8, 0xFF}), qt.Equals, 1)
+}
+
+func TestOrientImage(t *testing.T) {
+	c := qt.New(t)
+
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	src.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	for orientation, want := range map[int]image.Point{
+		1: {0, 0},
+		2: {2, 0},
+		3: {2, 1},
+		4: {0, 1},
+		5: {0, 0},
+		6: {1, 0},
+		7: {1, 2},
+		8: {0, 2},
+	} {
+		dst := orientImage(src, orientation)
+		if orientation >= 5 {
+			c.Assert(dst.Bounds().Size(), qt.Equals, image.Pt(2, 3))
+		} else {
+			c.Assert(dst.Bounds().Size(), qt.Equals, image.Pt(3, 2))
+		}
+		r, _, _, _ := dst.At(want.X, want.Y).RGBA()
+		c.Assert(r, qt.Equals, uint32(0xffff), qt.Commentf("orientation %d", orientation))
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	c := qt.New(t)
+
+	// Rotated 90 degrees clockwise, without the metadata
+	normalized, err := normalizeImage(testJPEGWithOrientation(c, 6))
+	c.Assert(err, qt.IsNil)
+	c.Assert(bytes.Contains(normalized, []byte("Exif")), qt.IsFalse)
+	c.Assert(bytes.Contains(normalized, []byte("GPS")), qt.IsFalse)
+	img, err := jpeg.Decode(bytes.NewReader(normalized))
+	c.Assert(err, qt.IsNil)
+	c.Assert(img.Bounds().Size(), qt.Equals, image.Pt(20, 40))
+	r, _, b, _ := img.At(10, 5).RGBA()
+	c.Assert(r > 0xf000 && b < 0x1000, qt.IsTrue)
+	r, _, b, _ = img.At(10, 35).RGBA()
+	c.Assert(r < 0x1000 && b > 0xf000, qt.IsTrue)
+
+	// Transparent images are kept as PNG
+	normalized, err = normalizeImage(testPNG(c, 10, 10, color.NRGBA{}))
+	c.Assert(err, qt.IsNil)
+	_, err = png.Decode(bytes.NewReader(normalized))
+	c.Assert(err, qt.IsNil)
+
+	_, err = normalizeImage([]byte("not an image"))
+	c.Assert(err, qt.IsNotNil)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/rs/zerolog/log"
+)
+
+// inactiveAccountsBatch is the maximum number of inactive accounts warned, and anonymized, by
+// each run of the jobs.
+const inactiveAccountsBatch = 100
+
+// retainInactiveAccounts applies the retention policy of the inactive accounts: the users not
+// active for the inactivity period are warned, and their accounts anonymized if they are still
+// inactive after the grace period. Disabled if the inactivity period is zero.
+func (a *API) retainInactiveAccounts(ctx context.Context) error {
+	if a.inactivityPeriod <= 0 {
+		return nil
+	}
+	now := time.Now()
+	users, err := a.database.UserService.GetUsersToAnonymize(ctx, now.Add(-a.inactivityGrace), inactiveAccountsBatch)
+	if err != nil {
+		return fmt.Errorf("could not get the inactive accounts to anonymize: %w", err)
+	}
+	for _, user := range users {
+		if err := a.anonymizeInactiveAccount(ctx, user); err != nil {
+			log.Error().Err(err).Msgf("could not anonymize the inactive account of user %s", user.ID.Hex())
+		}
+	}
+
+	users, err = a.database.UserService.GetInactiveUsers(ctx, now.Add(-a.inactivityPeriod), inactiveAccountsBatch)
+	if err != nil {
+		return fmt.Errorf("could not get the inactive accounts: %w", err)
+	}
+	for _, user := range users {
+		a.sendInactivityWarning(ctx, user, now.Add(a.inactivityGrace))
+		if err := a.database.UserService.SetInactivityWarned(ctx, user.ID, now); err != nil {
+			log.Error().Err(err).Msgf("could not store the inactivity warning of user %s", user.ID.Hex())
+		}
+	}
+	return nil
+}
+
+// anonymizeInactiveAccount deletes the account of an inactive user as if the user deleted it:
+// the open bookings are cancelled, the tools deleted and the personal data anonymized. The
+// bookings and the ratings are kept, without the personal data.
+func (a *API) anonymizeInactiveAccount(ctx context.Context, user *db.User) error {
+	tools, cancelled, err := a.deleteAccount(ctx, user, nil,
+		"A booking was cancelled because the account of the other user was closed for inactivity")
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("inactive user %s anonymized, %d tools deleted, %d bookings cancelled", user.ID.Hex(), tools, cancelled)
+	if err := a.database.AuditLogService.Record(ctx, &db.AuditEntry{
+		Action:     db.AuditAccountAnonymize,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Details:    fmt.Sprintf("inactive since %s", lastActivity(user).Format(time.DateOnly)),
+	}); err != nil {
+		log.Error().Err(err).Msgf("could not record %s in the audit log", db.AuditAccountAnonymize)
+	}
+
+	a.sendMail(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Account closed for inactivity",
+		Body: fmt.Sprintf("Hi %s,\n\nYour %s account was not used for a long time, it has been closed and its "+
+			"personal data deleted.", user.Name, a.branding.AppName),
+	})
+	return nil
+}
+
+// sendInactivityWarning emails the inactive user that the account will be anonymized at the
+// given time unless the user logs in before.
+func (a *API) sendInactivityWarning(ctx context.Context, user *db.User, anonymizeAt time.Time) {
+	a.sendMail(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Your account will be closed for inactivity",
+		Body: fmt.Sprintf("Hi %s,\n\nYour %s account has not been used since %s. If you do not log in before %s, "+
+			"it will be closed: your tools will be deleted and your personal data anonymized. The history of "+
+			"your bookings and your ratings are kept without your personal data.\n\n"+
+			"To keep your account, just log in.",
+			user.Name, a.branding.AppName, lastActivity(user).Format(time.DateOnly), anonymizeAt.Format(time.DateOnly)),
+	})
+}
+
+// lastActivity returns the time of the last activity of the user, its registration if it was
+// not active since the activity is tracked.
+func lastActivity(user *db.User) time.Time {
+	if user.LastActiveAt != nil {
+		return *user.LastActiveAt
+	}
+	return user.ID.Timestamp()
+}
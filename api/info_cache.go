@@ -0,0 +1,64 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+// defaultInfoCacheTTL is the default time the GET /info response is cached.
+const defaultInfoCacheTTL = time.Minute
+
+// infoCache caches the GET /info response, computed at most once per TTL. It is invalidated
+// when a tool is created, updated or deleted, when a user registers or is deleted and when new
+// terms are published, so the response does not lag behind the writes. A nil cache computes the response on each request.
+type infoCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	info    *Info
+	expires time.Time
+}
+
+// newInfoCache creates a new info cache with the given TTL, or returns nil if it is not positive.
+func newInfoCache(ttl time.Duration) *infoCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &infoCache{ttl: ttl}
+}
+
+// get returns the cached info, computing it with compute if it expired or was invalidated.
+func (c *infoCache) get(compute func() (*Info, error)) (*Info, error) {
+	if c == nil {
+		return compute()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.info != nil && time.Now().Before(c.expires) {
+		return c.info, nil
+	}
+	info, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	c.info, c.expires = info, time.Now().Add(c.ttl)
+	return info, nil
+}
+
+// invalidate drops the cached info.
+func (c *infoCache) invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.info = nil
+}
+
+// invalidateToolCaches drops the cached responses that may include a tool written at the given
+// locations: the searches around them and the info.
+func (a *API) invalidateToolCaches(locations ...db.DBLocation) {
+	a.searchCache.invalidate(locations...)
+	a.infoCache.invalidate()
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestInfoCache(t *testing.T) {
+	c := qt.New(t)
+	cache := newInfoCache(time.Hour)
+	calls := 0
+	compute := func() (*Info, error) {
+		calls++
+		if calls == 1 {
+			return nil, fmt.Errorf("database down")
+		}
+		return &Info{Tools: calls}, nil
+	}
+
+	// Errors are not cached
+	_, err := cache.get(compute)
+	c.Assert(err, qt.ErrorMatches, "database down")
+	info, err := cache.get(compute)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Tools, qt.Equals, 2)
+	info, err = cache.get(compute)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Tools, qt.Equals, 2)
+
+	// The info is computed again once invalidated or expired
+	cache.invalidate()
+	info, err = cache.get(compute)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Tools, qt.Equals, 3)
+	cache.expires = time.Now().Add(-time.Second)
+	info, err = cache.get(compute)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Tools, qt.Equals, 4)
+
+	// A disabled cache always computes the info
+	cache = newInfoCache(0)
+	c.Assert(cache, qt.IsNil)
+	info, err = cache.get(compute)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Tools, qt.Equals, 5)
+	cache.invalidate()
+}
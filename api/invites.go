@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// invitesHandler handles GET /profile/invites
+// It returns the invite codes of the user, newest first, with the users registered with them
+// and how many of them became active.
+func (a *API) invitesHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	invites, err := a.database.InviteService.GetUserInvites(ctx, user.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	names, err := a.inviteeNames(ctx, invites)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	active, err := a.activeInvitees(ctx, invites)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := &InvitesWrapper{Invites: []*Invite{}}
+	for _, i := range invites {
+		invite := new(Invite).FromDBInviteCode(i)
+		if i.UsedBy != nil {
+			invite.UsedByName = names[*i.UsedBy]
+			invite.UsedByActive = active[*i.UsedBy]
+			result.Referrals.Invited++
+			if invite.UsedByActive {
+				result.Referrals.Active++
+			}
+		}
+		result.Invites = append(result.Invites, invite)
+	}
+	if next := a.nextInviteAt(invites); time.Now().Before(next) {
+		result.NextInviteAt = &next
+	}
+	return result, nil
+}
+
+// createInviteHandler handles POST /profile/invites
+// A user can have up to maxInviteCodes unused codes, and must wait the invite cooldown
+// between two codes. The code can carry the community of the user, joined by the invitee.
+func (a *API) createInviteHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var req CreateInviteRequest
+	if len(r.Data) > 0 {
+		if err := json.Unmarshal(r.Data, &req); err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(err)
+		}
+	}
+	if req.Community && user.Community == "" {
+		return nil, ErrNotCommunityMember.WithErr(fmt.Errorf("user %s has no community", user.ID.Hex()))
+	}
+	ctx := r.Context.Request.Context()
+	invites, err := a.database.InviteService.GetUserInvites(ctx, user.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if next := a.nextInviteAt(invites); time.Now().Before(next) {
+		return nil, ErrInviteCodeCooldown.WithErr(fmt.Errorf("next invite code allowed at %s", next.Format(time.RFC3339)))
+	}
+	unused := 0
+	for _, i := range invites {
+		if i.Status() == db.InviteStatusUnused {
+			unused++
+		}
+	}
+	if unused >= a.maxInviteCodes {
+		return nil, ErrTooManyInviteCodes.WithErr(fmt.Errorf("user %s has %d unused invite codes", user.ID.Hex(), unused))
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	invite := &db.InviteCode{Code: code, UserID: user.ID}
+	if req.Community {
+		invite.Community = user.Community
+	}
+	if err := a.database.InviteService.InsertInvite(ctx, invite); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	return new(Invite).FromDBInviteCode(invite), nil
+}
+
+// revokeInviteHandler handles DELETE /profile/invites/{code}
+// Only unused codes can be revoked.
+func (a *API) revokeInviteHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	codeParam := r.Context.URLParam("code")
+	if codeParam == nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing invite code"))
+	}
+	code := normalizeInviteCode(codeParam[0])
+	if err := a.database.InviteService.RevokeInvite(r.Context.Request.Context(), user.ID, code); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInviteNotFound.WithErr(fmt.Errorf("no unused invite code %s", code))
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// adminInviteTreeHandler handles GET /admin/invites?user=
+// It returns who invited whom, to detect invite abuse. The tree starts at the users not invited
+// by another user, or at the given user.
+func (a *API) adminInviteTreeHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	var root *db.User
+	if param := r.Context.URLParam("user"); param != nil {
+		var err error
+		if root, err = a.getDBUserByID(param[0]); err != nil {
+			return nil, err
+		}
+	}
+	ctx := r.Context.Request.Context()
+	invites, err := a.database.InviteService.GetUsedInvites(ctx)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+
+	nodes := make(map[primitive.ObjectID]*InviteTreeNode)
+	node := func(id primitive.ObjectID) *InviteTreeNode {
+		if n, ok := nodes[id]; ok {
+			return n
+		}
+		n := &InviteTreeNode{UserID: id.Hex(), Invited: []*InviteTreeNode{}}
+		nodes[id] = n
+		return n
+	}
+	invited := make(map[primitive.ObjectID]bool)
+	for _, i := range invites {
+		child := node(*i.UsedBy)
+		child.InvitedAt = i.UsedAt
+		invited[*i.UsedBy] = true
+		parent := node(i.UserID)
+		parent.Invited = append(parent.Invited, child)
+	}
+	ids := make([]primitive.ObjectID, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	users, err := a.database.UserService.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	for _, u := range users {
+		node(u.ID).Name = u.Name
+	}
+
+	result := &InviteTreeResponse{Roots: []*InviteTreeNode{}}
+	if root != nil {
+		n := node(root.ID)
+		n.Name = root.Name
+		result.Roots = append(result.Roots, n)
+		return result, nil
+	}
+	// The users are added to the roots in the order of their first invite
+	for _, i := range invites {
+		if !invited[i.UserID] {
+			result.Roots = append(result.Roots, nodes[i.UserID])
+			invited[i.UserID] = true
+		}
+	}
+	return result, nil
+}
+
+// nextInviteAt returns the time the user can create the next invite code, given its codes
+// newest first.
+func (a *API) nextInviteAt(invites []*db.InviteCode) time.Time {
+	if len(invites) == 0 {
+		return time.Time{}
+	}
+	return invites[0].CreatedAt.Add(a.inviteCooldown)
+}
+
+// inviteeNames returns the names of the users registered with the invite codes.
+func (a *API) inviteeNames(ctx context.Context, invites []*db.InviteCode) (map[primitive.ObjectID]string, error) {
+	names := make(map[primitive.ObjectID]string)
+	ids := []primitive.ObjectID{}
+	for _, i := range invites {
+		if i.UsedBy != nil {
+			ids = append(ids, *i.UsedBy)
+		}
+	}
+	if len(ids) == 0 {
+		return names, nil
+	}
+	users, err := a.database.UserService.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		names[u.ID] = u.Name
+	}
+	return names, nil
+}
+
+// activeInvitees returns the users registered with the invite codes who shared a tool or
+// completed a booking.
+func (a *API) activeInvitees(ctx context.Context, invites []*db.InviteCode) (map[primitive.ObjectID]bool, error) {
+	ids := []primitive.ObjectID{}
+	for _, i := range invites {
+		if i.UsedBy != nil {
+			ids = append(ids, *i.UsedBy)
+		}
+	}
+	active := make(map[primitive.ObjectID]bool)
+	if len(ids) == 0 {
+		return active, nil
+	}
+	owners, err := a.database.ToolService.GetToolOwners(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	bookers, err := a.database.BookingService.GetUsersWithReturnedBookings(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		active[id] = owners[id] || bookers[id]
+	}
+	return active, nil
+}
+
+// useInviteCode marks the invite code as used by the new user. It returns nil if the code is
+// not a valid unused invite code.
+func (a *API) useInviteCode(ctx context.Context, code string, userID primitive.ObjectID) (*db.InviteCode, error) {
+	invite, err := a.database.InviteService.UseInvite(ctx, normalizeInviteCode(code), userID)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return invite, err
+}
+
+// releaseInviteCode makes the invite code claimed by a registration that failed usable again.
+func (a *API) releaseInviteCode(ctx context.Context, invite *db.InviteCode, userID primitive.ObjectID) {
+	if err := a.database.InviteService.ReleaseInvite(ctx, invite.Code, userID); err != nil {
+		log.Error().Err(err).Msgf("could not release invite code %s", invite.Code)
+	}
+}
+
+// newInviteCode returns a random invite code.
+func newInviteCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(b)), nil
+}
+
+// notifyInviteUsed tells the inviter that a new user registered with the invite code.
+func (a *API) notifyInviteUsed(ctx context.Context, invite *db.InviteCode, user *db.User) {
+	message := fmt.Sprintf("%s registered with your invite code %s", user.Name, invite.Code)
+	if invite.Community != "" {
+		message = fmt.Sprintf("%s registered with your invite code %s and joined %s", user.Name, invite.Code, invite.Community)
+	}
+	a.notify(ctx, &db.Notification{
+		UserID:  invite.UserID,
+		Type:    db.NotificationInviteUsed,
+		Message: message,
+	})
+}
+
+// normalizeInviteCode returns the invite code as stored, codes are case insensitive.
+func normalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
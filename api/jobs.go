@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// jobsInterval is the time between runs of the background jobs.
+const jobsInterval = 10 * time.Minute
+
+// startJobs runs the periodic background jobs (non blocking).
+func (a *API) startJobs() {
+	go a.processQueuedImages()
+	go func() {
+		ticker := time.NewTicker(jobsInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			a.runJobs()
+		}
+	}()
+}
+
+// runJobs runs every background job once. A failing job does not prevent the others from running.
+func (a *API) runJobs() {
+	ctx, cancel := context.WithTimeout(context.Background(), jobsInterval/2)
+	defer cancel()
+	if err := a.escalateOverdueDisagreements(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to escalate overdue disagreements")
+	}
+	if err := a.expirePendingBookings(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to expire pending bookings")
+	}
+	if err := a.sendBookingReminders(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to send booking reminders")
+	}
+	if err := a.updateTrustScores(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to update trust scores")
+	}
+	if err := a.updateBadges(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to update badges")
+	}
+	if err := a.updateCommunityStats(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to update community stats")
+	}
+	if err := a.updateToolPopularity(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to update tool popularity")
+	}
+	if err := a.sendDigests(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to send digests")
+	}
+	if err := a.purgeAuditLog(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to purge the audit log")
+	}
+	if err := a.retainInactiveAccounts(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to anonymize the inactive accounts")
+	}
+	if err := a.collectOrphanImages(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to collect the unreferenced images")
+	}
+	if err := a.processPendingImages(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to process the pending images")
+	}
+}
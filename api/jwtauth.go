@@ -3,53 +3,83 @@ package api
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/emprius/emprius-app-backend/password"
 	"github.com/go-chi/jwtauth/v5"
 	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // authHandler is a handler that authenticates the user and returns a JWT token.
 // If successful, the user identifier is added to the HTTP header as `X-User-Id`,
-// so that it can be used by the next handlers.
+// so that it can be used by the next handlers. The tokens with a session must belong
+// to an open session, whose identifier is added as `X-Session-Id`. The tokens issued
+// before the sessions existed have none and are valid until they expire.
 func (a *API) authenticator(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, claims, err := jwtauth.FromContext(r.Context())
 		if err != nil || token == nil {
-			http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+			sendError(w, ErrUnauthorized)
 			return
 		}
 
 		// Get userId from claims
 		userId, ok := claims["userId"].(string)
 		if !ok {
-			http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+			sendError(w, ErrUnauthorized)
 			return
 		}
 
 		// Validate userId format
-		if err := validateObjectID(userId); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if _, err := primitive.ObjectIDFromHex(userId); err != nil {
+			sendError(w, ErrInvalidUserID.WithErr(err))
 			return
 		}
 
-		// Add validated userId to header
-		r.Header.Add("X-User-Id", userId)
+		// The tokens of a tenant are not valid for the others, the secret is shared
+		if tenant, _ := claims["tenant"].(string); tenant != a.tenant {
+			sendError(w, ErrUnauthorized.WithErr(fmt.Errorf("token issued for tenant %q", tenant)))
+			return
+		}
+
+		sessionID, _ := claims["sid"].(string)
+		if sessionID != "" {
+			if err := a.checkSession(r, sessionID, userId); err != nil {
+				sendError(w, err)
+				return
+			}
+		}
+
+		// Add validated userId and sessionId to header, replacing any sent by the client
+		r.Header.Set("X-User-Id", userId)
+		r.Header.Set("X-Session-Id", sessionID)
 		// Token is authenticated, pass it through
 		next.ServeHTTP(w, r)
 	})
 }
 
-// makeToken creates a JWT token for the given user identifier.
+// makeToken creates a JWT token for the given user and session identifiers.
 // The token is signed with the API secret, following the JWT specification.
 // The token is valid for the period specified on jwtExpiration constant.
-func (a *API) makeToken(id string) (*LoginResponse, error) {
+func (a *API) makeToken(id, sessionID string) (*LoginResponse, error) {
 	j := jwt.New()
 	if err := j.Set("userId", id); err != nil {
 		return nil, ErrInternalServerError.WithErr(fmt.Errorf("failed to set userId claim: %w", err))
 	}
+	if sessionID != "" {
+		if err := j.Set("sid", sessionID); err != nil {
+			return nil, ErrInternalServerError.WithErr(fmt.Errorf("failed to set sid claim: %w", err))
+		}
+	}
+	if a.tenant != "" {
+		if err := j.Set("tenant", a.tenant); err != nil {
+			return nil, ErrInternalServerError.WithErr(fmt.Errorf("failed to set tenant claim: %w", err))
+		}
+	}
 	if err := j.Set(jwt.ExpirationKey, time.Now().Add(jwtExpiration).Unix()); err != nil {
 		return nil, ErrInternalServerError.WithErr(fmt.Errorf("failed to set expiration claim: %w", err))
 	}
@@ -63,6 +93,22 @@ func (a *API) makeToken(id string) (*LoginResponse, error) {
 	return &lr, nil
 }
 
-func hashPassword(password string) []byte {
-	return sha256.New().Sum([]byte(passwordSalt + password))
+// hashPassword returns the Argon2id hash of the password with the parameters of the instance.
+func (a *API) hashPassword(pw string) ([]byte, error) {
+	return a.argon2.Hash(pw)
+}
+
+// verifyPassword returns whether the password matches the stored hash, and whether the hash
+// must be replaced, being of the legacy scheme or made with other Argon2id parameters.
+func (a *API) verifyPassword(pw string, hash []byte) (match, rehash bool) {
+	if password.IsArgon2id(hash) {
+		return a.argon2.Verify(pw, hash)
+	}
+	return subtle.ConstantTimeCompare(hash, legacyHashPassword(pw)) == 1, true
+}
+
+// legacyHashPassword returns the hash of the password of the scheme used before Argon2id. The
+// hashes of this scheme are replaced on the next successful login.
+func legacyHashPassword(pw string) []byte {
+	return sha256.New().Sum([]byte(passwordSalt + pw))
 }
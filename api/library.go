@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// libraryDefaultLoan is the duration of a library check-out if no end date is given.
+const libraryDefaultLoan = 7 * 24 * time.Hour
+
+// libraryTagHandler handles POST /communities/{id}/library/tags
+// The community admins register the asset tag (i.e. a barcode label) of a shared tool of the
+// community, unique in the community, or remove it with an empty tag.
+func (a *API) libraryTagHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityModerate)
+	if err != nil {
+		return nil, err
+	}
+	var req LibraryTagRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	tool, err := a.toolFromDB(req.ToolID)
+	if err != nil {
+		return nil, err
+	}
+	if tool.Community != community {
+		return nil, ErrToolNotFound.WithErr(fmt.Errorf("tool %d is not shared by community %s", tool.ID, community))
+	}
+	assetTag := strings.TrimSpace(req.AssetTag)
+	err = a.database.ToolService.SetAssetTag(r.Context.Request.Context(), tool.ID, assetTag)
+	if err == db.ErrDuplicateAssetTag {
+		return nil, ErrDuplicateAssetTag.WithErr(fmt.Errorf("asset tag %q", assetTag))
+	}
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// libraryToolHandler handles GET /communities/{id}/library/tags/{tag}
+// Returns the shared tool of the community with the scanned asset tag, for its members. The
+// identifiers of the tool are only shown to the community admins, and its exact location to
+// the owner and to renters with an accepted booking.
+func (a *API) libraryToolHandler(r *Request) (interface{}, error) {
+	subject, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	tool, err := a.libraryTool(ctx, community, chi.URLParam(r.Context.Request, "tag"))
+	if err != nil {
+		return nil, err
+	}
+	result := new(Tool).FromDBTool(tool)
+	if !a.canSeeExactLocation(ctx, r.UserID, tool.UserID, strconv.FormatInt(tool.ID, 10)) {
+		a.hideToolLocations(result)
+	}
+	if canSeeToolIdentifiers(subject, tool) ||
+		policy.Check(policy.CommunityModerate, subject, policy.Resource{Community: community}) == nil {
+		showToolIdentifiers(result)
+	}
+	a.setBreadcrumbs(result)
+	return result, nil
+}
+
+// libraryCheckoutHandler handles POST /communities/{id}/library/checkout
+// The scanning member checks out the tool with the asset tag: a booking from now until the end
+// date is created and accepted at once, paying its price to the community pool.
+func (a *API) libraryCheckoutHandler(r *Request) (interface{}, error) {
+	subject, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	var req LibraryCheckoutRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	ctx := r.Context.Request.Context()
+	tool, err := a.libraryTool(ctx, community, req.AssetTag)
+	if err != nil {
+		return nil, err
+	}
+	if db.IsValidReportStatus(tool.Status) {
+		return nil, ErrToolReported.WithErr(fmt.Errorf("tool with id %d is %s", tool.ID, tool.Status))
+	}
+	toUser, err := a.authorizeToolBooking(subject, tool)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	end := start.Add(libraryDefaultLoan)
+	if req.EndDate != 0 {
+		end = time.Unix(req.EndDate, 0)
+	}
+	if !end.After(start) {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("endDate must be in the future"))
+	}
+	if err := checkMaintenance(tool, start, end); err != nil {
+		return nil, err
+	}
+	terms, err := acceptedTerms(tool, req.AcceptedTermsVersion)
+	if err != nil {
+		return nil, err
+	}
+	price, err := bookingPrice(tool, start, end, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	booking, err := a.database.BookingService.Create(ctx, &db.CreateBookingRequest{
+		ToolID:             strconv.FormatInt(tool.ID, 10),
+		StartDate:          start,
+		EndDate:            end,
+		Origin:             db.BookingOriginLibrary,
+		Community:          tool.Community,
+		AcceptedTerms:      terms,
+		PricingMode:        tool.Pricing(),
+		Price:              &price,
+		CancellationPolicy: tool.Cancellation(),
+	}, subject.ID, toUser.ID)
+	if err == db.ErrBookingDatesConflict {
+		return nil, ErrBookingDatesConflict.WithErr(fmt.Errorf("tool %d is checked out or reserved", tool.ID))
+	}
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if err := a.acceptCommunityBooking(r, booking, subject.ID); err != nil {
+		// The check-out failed (i.e. not enough tokens), the booking is not left pending
+		if cancelErr := a.database.BookingService.UpdateStatus(ctx, booking.ID, db.BookingStatusCancelled,
+			subject.ID, "library check-out failed"); cancelErr != nil {
+			log.Error().Err(cancelErr).Msgf("could not cancel the failed check-out %s", booking.ID.Hex())
+		}
+		return nil, err
+	}
+	booking, err = a.database.BookingService.Get(ctx, booking.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return convertBookingToResponse(booking), nil
+}
+
+// libraryCheckinHandler handles POST /communities/{id}/library/checkin
+// Returns the checked out tool with the asset tag. The member who checked it out or any admin
+// of the community can check it in.
+func (a *API) libraryCheckinHandler(r *Request) (interface{}, error) {
+	subject, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	var req LibraryCheckinRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	ctx := r.Context.Request.Context()
+	tool, err := a.libraryTool(ctx, community, req.AssetTag)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	bookings, err := a.database.BookingService.GetToolAcceptedBookings(ctx, strconv.FormatInt(tool.ID, 10), time.Time{})
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	// The first started booking, the later ones are reservations
+	var booking *db.Booking
+	for _, b := range bookings {
+		if !b.StartDate.After(now) {
+			booking = b
+			break
+		}
+	}
+	if booking == nil {
+		return nil, ErrLibraryToolNotCheckedOut.WithErr(fmt.Errorf("tool %d has no started booking", tool.ID))
+	}
+	if subject.ID != booking.FromUserID {
+		if err := authorize(policy.BookingReturn, subject, bookingResource(booking)); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.transitionBooking(r, booking, subject.ID, db.BookingStatusReturned); err != nil {
+		return nil, err
+	}
+	booking, err = a.database.BookingService.Get(ctx, booking.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return convertBookingToResponse(booking), nil
+}
+
+// libraryTool returns the shared tool of the community with the asset tag.
+func (a *API) libraryTool(ctx context.Context, community, assetTag string) (*db.Tool, error) {
+	assetTag = strings.TrimSpace(assetTag)
+	if assetTag == "" {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing assetTag"))
+	}
+	tool, err := a.database.ToolService.GetCommunityToolByAssetTag(ctx, community, assetTag)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrToolNotFound.WithErr(fmt.Errorf("no tool of community %s with asset tag %q", community, assetTag))
+	}
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return tool, nil
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// locationFuzzRadius is the maximum distance in meters between the exact location of a
+	// tool or user and the approximate location shown to other users.
+	locationFuzzRadius = 500
+	// metersPerDegree is the approximate length of a latitude degree.
+	metersPerDegree = 111320.0
+)
+
+// newLocationKey derives the key used to fuzz the public locations from the API secret,
+// so the offsets are stable while the secret does not change.
+func newLocationKey(secret string) []byte {
+	h := sha256.Sum256([]byte("location:" + secret))
+	return h[:]
+}
+
+// fuzzLocation returns a point at most locationFuzzRadius meters away from the location.
+// The offset is derived from the key, the id and the location itself, so the same
+// location always gets the same point and it cannot be averaged out across requests.
+func fuzzLocation(key []byte, id string, l Location) Location {
+	if l.Latitude == 0 && l.Longitude == 0 {
+		return l
+	}
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s:%d:%d", id, l.Latitude, l.Longitude)
+	sum := mac.Sum(nil)
+	u1 := float64(binary.BigEndian.Uint64(sum[0:8])) / math.MaxUint64
+	u2 := float64(binary.BigEndian.Uint64(sum[8:16])) / math.MaxUint64
+
+	// Uniform point in the disc around the location
+	distance := locationFuzzRadius * math.Sqrt(u1)
+	angle := 2 * math.Pi * u2
+	latitude, longitude := l.degrees()
+	dLat := distance * math.Cos(angle) / metersPerDegree
+	dLon := distance * math.Sin(angle) / (metersPerDegree * math.Max(math.Cos(latitude*math.Pi/180), 0.01))
+	return Location{
+		Latitude:  int64(math.Round(math.Max(-90, math.Min(90, latitude+dLat)) * 1e6)),
+		Longitude: int64(math.Round(wrapLongitude(longitude+dLon) * 1e6)),
+	}
+}
+
+// wrapLongitude normalizes the longitude to the [-180, 180] range.
+func wrapLongitude(longitude float64) float64 {
+	if longitude > 180 {
+		return longitude - 360
+	}
+	if longitude < -180 {
+		return longitude + 360
+	}
+	return longitude
+}
+
+// roundDistance rounds a distance in meters to the fuzz radius, so the distance to the
+// exact location does not reveal more than the approximate location.
+func roundDistance(meters float64) int64 {
+	return int64(math.Round(meters/locationFuzzRadius)) * locationFuzzRadius
+}
+
+// hideToolLocations replaces the exact location of the tools by their approximate location.
+func (a *API) hideToolLocations(tools ...*Tool) {
+	for _, t := range tools {
+		t.Location = fuzzLocation(a.locationKey, fmt.Sprintf("tool:%d", t.ID), t.Location)
+	}
+}
+
+// hidePrivateUserData prepares users to be seen by others: the exact location is replaced by
+// the approximate location and the community is removed if the user hides it.
+func (a *API) hidePrivateUserData(users ...*User) {
+	for _, u := range users {
+		u.Location = fuzzLocation(a.locationKey, "user:"+u.ID, u.Location)
+		if u.HideCommunity {
+			u.Community = ""
+		}
+	}
+}
+
+// canSeeExactLocation returns true if the user is the owner or a renter with an accepted
+// booking from the owner. If toolID is not empty, the booking must be for that tool.
+func (a *API) canSeeExactLocation(ctx context.Context, userID string, ownerID primitive.ObjectID, toolID string) bool {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false
+	}
+	if uid == ownerID {
+		return true
+	}
+	accepted, err := a.database.BookingService.HasAcceptedBooking(ctx, uid, ownerID, toolID)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not check the accepted bookings of user %s", userID)
+		return false
+	}
+	return accepted
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+func TestFuzzLocation(t *testing.T) {
+	c := qt.New(t)
+	key := newLocationKey("secret")
+	exact := Location{Latitude: 41695384, Longitude: 2492793}
+
+	fuzzed := fuzzLocation(key, "tool:1", exact)
+	c.Assert(fuzzed, qt.Not(qt.Equals), exact)
+	// The approximate location is within the fuzz radius
+	c.Assert(db.WithinCircumference(exact.ToDBLocation(), fuzzed.ToDBLocation(), locationFuzzRadius), qt.IsTrue)
+
+	// The offset is stable, so it cannot be averaged out across requests
+	c.Assert(fuzzLocation(key, "tool:1", exact), qt.Equals, fuzzed)
+	// Different ids and keys produce different offsets
+	c.Assert(fuzzLocation(key, "tool:2", exact), qt.Not(qt.Equals), fuzzed)
+	c.Assert(fuzzLocation(newLocationKey("other"), "tool:1", exact), qt.Not(qt.Equals), fuzzed)
+
+	// Unset locations are kept as they are
+	c.Assert(fuzzLocation(key, "tool:1", Location{}), qt.Equals, Location{})
+
+	// Locations near the antimeridian stay in range
+	edge := fuzzLocation(key, "tool:1", Location{Latitude: 0, Longitude: 179999999})
+	c.Assert(edge.Longitude >= -180000000 && edge.Longitude <= 180000000, qt.IsTrue)
+}
+
+func TestRoundDistance(t *testing.T) {
+	c := qt.New(t)
+	c.Assert(roundDistance(0), qt.Equals, int64(0))
+	c.Assert(roundDistance(240), qt.Equals, int64(0))
+	c.Assert(roundDistance(260), qt.Equals, int64(500))
+	c.Assert(roundDistance(9876), qt.Equals, int64(10000))
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxLoginLockout is the maximum duration of a lockout, however many failures follow it.
+	maxLoginLockout = 24 * time.Hour
+	// loginAttemptsWindow is the time without failures after which the failures are forgotten.
+	loginAttemptsWindow = 24 * time.Hour
+	// ipLoginAttemptsFactor multiplies the failures allowed from an IP, shared by many users
+	// behind the same NAT.
+	ipLoginAttemptsFactor = 4
+)
+
+// loginAttemptKeys returns the keys of the failed login counters of the email and the IP.
+func loginAttemptKeys(email, ip string) (account, address string) {
+	return "email:" + strings.ToLower(strings.TrimSpace(email)), "ip:" + ip
+}
+
+// checkLoginLockout returns ErrLoginLocked, with the end of the lockout, if the logins of the
+// email or the IP are locked.
+func (a *API) checkLoginLockout(ctx context.Context, email, ip string) error {
+	account, address := loginAttemptKeys(email, ip)
+	until, err := a.database.LoginAttemptService.LockedUntil(ctx, time.Now(), account, address)
+	if err != nil {
+		return ErrInternalServerError.WithErr(err)
+	}
+	if !until.IsZero() {
+		return ErrLoginLocked.WithData(&LoginLocked{LockedUntil: until})
+	}
+	return nil
+}
+
+// loginFailed counts a failed login of the email from the IP, and locks them once they reach the
+// maximum failures. The user of the email, if any, is emailed when the account is locked. It
+// returns ErrLoginLocked if the failure locked the logins, ErrWrongLogin otherwise.
+func (a *API) loginFailed(r *Request, email string, user *db.User) error {
+	ctx := r.Context.Request.Context()
+	ip := clientIP(r.Context.Request.RemoteAddr)
+	account, address := loginAttemptKeys(email, ip)
+	now := time.Now()
+	var lockedUntil time.Time
+	for _, counter := range []struct {
+		key         string
+		maxFailures int
+	}{
+		{account, a.loginMaxAttempts},
+		{address, a.loginMaxAttempts * ipLoginAttemptsFactor},
+	} {
+		failures, err := a.database.LoginAttemptService.RecordFailure(ctx, counter.key, now, now.Add(loginAttemptsWindow))
+		if err != nil {
+			log.Error().Err(err).Msgf("could not record the failed login of %s", counter.key)
+			continue
+		}
+		if failures < counter.maxFailures {
+			continue
+		}
+		until := now.Add(a.loginLockoutDuration(failures - counter.maxFailures))
+		if err := a.database.LoginAttemptService.Lock(ctx, counter.key, until, until.Add(loginAttemptsWindow)); err != nil {
+			log.Error().Err(err).Msgf("could not lock the logins of %s", counter.key)
+			continue
+		}
+		log.Warn().Msgf("logins of %s locked until %s after %d failures", counter.key, until.Format(time.RFC3339), failures)
+		if until.After(lockedUntil) {
+			lockedUntil = until
+		}
+		if counter.key == account && user != nil {
+			a.audit(r, &db.AuditEntry{
+				ActorID:    user.ID,
+				Action:     db.AuditLoginLocked,
+				TargetType: "user",
+				TargetID:   user.ID.Hex(),
+				Details:    fmt.Sprintf("%d failures, locked until %s", failures, until.Format(time.RFC3339)),
+			})
+			a.sendLockoutAlert(ctx, user, ip, until)
+		}
+	}
+	if !lockedUntil.IsZero() {
+		return ErrLoginLocked.WithData(&LoginLocked{LockedUntil: lockedUntil})
+	}
+	return ErrWrongLogin
+}
+
+// loginSucceeded resets the failed logins of the email. The failures of the IP are kept, so an
+// attacker cannot reset them logging into their own account.
+func (a *API) loginSucceeded(ctx context.Context, email string) {
+	account, _ := loginAttemptKeys(email, "")
+	if err := a.database.LoginAttemptService.Reset(ctx, account); err != nil {
+		log.Warn().Err(err).Msgf("could not reset the failed logins of %s", account)
+	}
+}
+
+// loginLockoutDuration returns the duration of a lockout, doubled for each failure after the one
+// that first locked the logins, up to maxLoginLockout.
+func (a *API) loginLockoutDuration(extraFailures int) time.Duration {
+	lockout := a.loginLockout
+	for i := 0; i < extraFailures && lockout < maxLoginLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, maxLoginLockout)
+}
+
+// sendLockoutAlert emails the user about the lockout of the account after too many failed logins.
+func (a *API) sendLockoutAlert(ctx context.Context, user *db.User, ip string, until time.Time) {
+	a.sendMail(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Your account has been temporarily locked",
+		Body: fmt.Sprintf("Hi %s,\n\nThere were too many failed attempts to log into your %s account, the last one "+
+			"from %s. The logins are locked until %s.\n\n"+
+			"If it was not you, someone may be trying to guess your password. Consider changing it once you can log in.",
+			user.Name, a.branding.AppName, ip, until.UTC().Format(time.RFC1123)),
+	})
+}
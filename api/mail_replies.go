@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// inboundMailTokenHeader is the header carrying the inbound mail token on the webhook
+	// requests. Providers that cannot set headers send it as the token URL parameter.
+	inboundMailTokenHeader = "X-Inbound-Token"
+	// maxInboundMailSize is the maximum size of the form of an inbound mail kept in memory,
+	// the attachments beyond it are ignored.
+	maxInboundMailSize = 1 << 20
+	// replyTokenMACSize is the size of the signature of the reply tokens.
+	replyTokenMACSize = 6
+)
+
+// replyTokenEncoding encodes the reply tokens in the local part of the reply addresses, which
+// mail servers may not preserve the case of.
+var replyTokenEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// newReplyKey derives the key used to sign the reply tokens from the API secret, so the tokens
+// of the emails already sent are valid while the secret does not change.
+func newReplyKey(secret string) []byte {
+	h := sha256.Sum256([]byte("reply:" + secret))
+	return h[:]
+}
+
+// replyToken returns the token of the reply address of the notification emails of the booking
+// sent to the user: the booking and user identifiers signed with the key.
+func replyToken(key []byte, bookingID, userID primitive.ObjectID) string {
+	payload := append(bookingID[:], userID[:]...)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return replyTokenEncoding.EncodeToString(append(payload, mac.Sum(nil)[:replyTokenMACSize]...))
+}
+
+// parseReplyToken returns the booking and user identifiers of the reply token, if its signature
+// is valid.
+func parseReplyToken(key []byte, token string) (primitive.ObjectID, primitive.ObjectID, error) {
+	var bookingID, userID primitive.ObjectID
+	data, err := replyTokenEncoding.DecodeString(strings.ToLower(token))
+	if err != nil || len(data) != len(bookingID)+len(userID)+replyTokenMACSize {
+		return bookingID, userID, fmt.Errorf("malformed reply token %q", token)
+	}
+	payload := data[:len(bookingID)+len(userID)]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(data[len(payload):], mac.Sum(nil)[:replyTokenMACSize]) {
+		return bookingID, userID, fmt.Errorf("invalid signature of reply token %q", token)
+	}
+	copy(bookingID[:], payload)
+	copy(userID[:], payload[len(bookingID):])
+	return bookingID, userID, nil
+}
+
+// bookingReplyTo returns the reply address of the notification emails of the booking sent to
+// the user, or an empty string if the inbound mail is not configured.
+func (a *API) bookingReplyTo(bookingID, userID primitive.ObjectID) string {
+	if a.inboundAddress == "" {
+		return ""
+	}
+	address, err := mail.PlusAddress(a.inboundAddress, replyToken(a.replyKey, bookingID, userID))
+	if err != nil {
+		log.Error().Err(err).Msg("could not build the reply address")
+		return ""
+	}
+	return address
+}
+
+// inboundMailFromRequest returns the inbound mail of the webhook request: a JSON body, or the
+// form sent by the mail providers, with the usual names of their fields.
+func inboundMailFromRequest(r *Request) (*InboundMail, error) {
+	contentType := r.Context.Request.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/json" {
+		var inbound InboundMail
+		if err := json.Unmarshal(r.Data, &inbound); err != nil {
+			return nil, err
+		}
+		return &inbound, nil
+	}
+	req := r.Context.Request.Clone(r.Context.Request.Context())
+	req.Body = io.NopCloser(bytes.NewReader(r.Data))
+	if err := req.ParseMultipartForm(maxInboundMailSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, err
+	}
+	field := func(names ...string) string {
+		for _, name := range names {
+			if value := req.PostForm.Get(name); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	return &InboundMail{
+		From: field("from", "sender"),
+		To:   field("recipient", "to"),
+		Text: field("text", "body-plain"),
+	}, nil
+}
+
+// inboundMailHandler handles POST /mail/inbound
+// Receives the emails sent to the reply addresses from the mail provider, authenticated with
+// the inbound mail token. A reply to a booking notification, sent from the address of the
+// user it was sent to, is appended without the quoted text to the booking thread as a message
+// to the other user of the booking. The other emails are ignored, and acknowledged so the
+// provider does not retry them.
+func (a *API) inboundMailHandler(r *Request) (interface{}, error) {
+	token := r.Context.Request.Header.Get(inboundMailTokenHeader)
+	if param := r.Context.URLParam("token"); token == "" && param != nil {
+		token = param[0]
+	}
+	if a.inboundToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.inboundToken)) != 1 {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("invalid inbound mail token"))
+	}
+	inbound, err := inboundMailFromRequest(r)
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+
+	bookingID, userID, err := parseReplyToken(a.replyKey, mail.AddressTag(inbound.To))
+	if err != nil {
+		log.Warn().Err(err).Msgf("ignoring inbound email to %s", inbound.To)
+		return nil, nil
+	}
+	ctx := r.Context.Request.Context()
+	user, err := a.database.UserService.GetUserByID(ctx, userID)
+	if err != nil || user.DeletedAt != nil || mail.AddressOf(inbound.From) != strings.ToLower(user.Email) {
+		log.Warn().Msgf("ignoring reply to booking %s not sent by its recipient", bookingID.Hex())
+		return nil, nil
+	}
+	booking, err := a.database.BookingService.Get(ctx, bookingID)
+	if err != nil || booking == nil || (booking.FromUserID != userID && booking.ToUserID != userID) {
+		log.Warn().Msgf("ignoring reply of user %s to booking %s", userID.Hex(), bookingID.Hex())
+		return nil, nil
+	}
+	otherID := booking.ToUserID
+	if otherID == userID {
+		otherID = booking.FromUserID
+	}
+	other, err := a.database.UserService.GetUserByID(ctx, otherID)
+	if err != nil || other.DeletedAt != nil {
+		log.Warn().Msgf("ignoring reply to booking %s, the other user is deleted", bookingID.Hex())
+		return nil, nil
+	}
+
+	text := mail.ReplyText(inbound.Text)
+	if len(text) > maxMessageLength {
+		text = strings.ToValidUTF8(text[:maxMessageLength], "")
+	}
+	if text == "" {
+		return nil, nil
+	}
+	if err := a.authorizeMessage(ctx, user, other); err != nil {
+		log.Warn().Err(err).Msgf("ignoring reply of user %s to booking %s", userID.Hex(), bookingID.Hex())
+		return nil, nil
+	}
+	message := &db.Message{Text: text, BookingID: &bookingID, ViaEmail: true}
+	if err := a.deliverMessage(ctx, user, other, message); err != nil {
+		log.Warn().Err(err).Msgf("could not append the reply of user %s to booking %s", userID.Hex(), bookingID.Hex())
+		return nil, nil
+	}
+	return new(Message).FromDBMessage(message), nil
+}
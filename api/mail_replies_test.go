@@ -0,0 +1,39 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReplyToken(t *testing.T) {
+	c := qt.New(t)
+
+	key := newReplyKey("secret")
+	bookingID, userID := primitive.NewObjectID(), primitive.NewObjectID()
+	token := replyToken(key, bookingID, userID)
+	// The token fits in the local part of an address, which is at most 64 characters
+	c.Assert(len(token) <= 48, qt.IsTrue)
+	c.Assert(token, qt.Equals, strings.ToLower(token))
+
+	parsedBooking, parsedUser, err := parseReplyToken(key, token)
+	c.Assert(err, qt.IsNil)
+	c.Assert(parsedBooking, qt.Equals, bookingID)
+	c.Assert(parsedUser, qt.Equals, userID)
+	// Mail servers may change the case of the address
+	_, _, err = parseReplyToken(key, strings.ToUpper(token))
+	c.Assert(err, qt.IsNil)
+
+	// The tokens of another key, tampered or malformed are rejected
+	_, _, err = parseReplyToken(newReplyKey("other"), token)
+	c.Assert(err, qt.IsNotNil)
+	tampered := replyToken(key, primitive.NewObjectID(), userID)[:39] + token[39:]
+	_, _, err = parseReplyToken(key, tampered)
+	c.Assert(err, qt.IsNotNil)
+	_, _, err = parseReplyToken(key, "not-a-token")
+	c.Assert(err, qt.IsNotNil)
+	_, _, err = parseReplyToken(key, "")
+	c.Assert(err, qt.IsNotNil)
+}
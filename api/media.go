@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/emprius/emprius-app-backend/types"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxToolMedia is the maximum number of media attached to a tool.
+	maxToolMedia = 5
+	// maxMediaNameLength is the maximum length of the name of a media.
+	maxMediaNameLength = 100
+	// maxMediaUploadSize is the maximum size of any media, see mediaTypes for the size of each
+	// type. The media are stored in a single document, limited to 16 MB.
+	maxMediaUploadSize = 15 << 20 // bytes
+)
+
+// mediaTypes are the accepted mime types of the media, detected from their content, with the
+// media type they are stored as and their maximum size.
+var mediaTypes = map[string]struct {
+	Type    db.MediaType
+	MaxSize int
+}{
+	"video/mp4":       {db.MediaVideo, maxMediaUploadSize},
+	"video/webm":      {db.MediaVideo, maxMediaUploadSize},
+	"application/pdf": {db.MediaDocument, 10 << 20},
+}
+
+// mediaURL returns the URL the media with the given hash is downloaded from.
+func mediaURL(hash types.HexBytes) string {
+	return "/media/" + hash.String()
+}
+
+// uploadToolMediaHandler handles POST /tools/{id}/media
+// The body is a multipart form with the video or document in the "file" field and an
+// optional "name" field, by default the file name. The media is attached to the tool.
+func (a *API) uploadToolMediaHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolEdit)
+	if err != nil {
+		return nil, err
+	}
+	if len(tool.Media) >= maxToolMedia {
+		return nil, ErrTooManyToolMedia.WithErr(fmt.Errorf("tool %d has %d media", tool.ID, len(tool.Media)))
+	}
+	data, name, err := mediaFromMultipart(r.Context.Request.Header.Get("Content-Type"), r.Data)
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if len(data) > maxMediaUploadSize {
+		return nil, ErrMediaTooLarge.WithErr(fmt.Errorf("media larger than %d bytes", maxMediaUploadSize))
+	}
+	// The type is detected from the content, the one declared by the client is not trusted
+	mimeType := http.DetectContentType(data)
+	mediaType, ok := mediaTypes[mimeType]
+	if !ok {
+		return nil, ErrInvalidMediaType.WithErr(fmt.Errorf("unsupported media type %s", mimeType))
+	}
+	if len(data) > mediaType.MaxSize {
+		return nil, ErrMediaTooLarge.WithErr(fmt.Errorf("%s larger than %d bytes", mediaType.Type, mediaType.MaxSize))
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = string(mediaType.Type)
+	}
+	if len(name) > maxMediaNameLength {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("name longer than %d characters", maxMediaNameLength))
+	}
+
+	ctx := r.Context.Request.Context()
+	hash := sha256.Sum256(data)
+	media := &db.Media{
+		Hash:     hash[:],
+		Type:     mediaType.Type,
+		MimeType: mimeType,
+		Size:     int64(len(data)),
+		Content:  data,
+	}
+	if _, err := a.database.MediaService.GetMedia(ctx, hash[:]); err == mongo.ErrNoDocuments {
+		if err := a.database.MediaService.InsertMedia(ctx, media); err != nil {
+			return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+		}
+	} else if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	toolMedia := &db.ToolMedia{
+		Hash:     media.Hash,
+		Name:     name,
+		Type:     media.Type,
+		MimeType: media.MimeType,
+		Size:     media.Size,
+	}
+	if err := a.database.ToolService.AddMedia(ctx, tool.ID, toolMedia); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.invalidateToolCaches(tool.Location)
+	log.Debug().Msgf("added %s %s to tool %d", media.Type, media.Hash.String(), tool.ID)
+	return new(ToolMedia).FromDBToolMedia(toolMedia), nil
+}
+
+// deleteToolMediaHandler handles DELETE /tools/{id}/media/{hash}
+// It detaches the media from the tool. Its content is deleted by the next collection of the
+// unreferenced images and media.
+func (a *API) deleteToolMediaHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolEdit)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hex.DecodeString(r.Context.URLParam("hash")[0])
+	if err != nil {
+		return nil, ErrInvalidHash.WithErr(err)
+	}
+	removed, err := a.database.ToolService.RemoveMedia(r.Context.Request.Context(), tool.ID, hash)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if !removed {
+		return nil, ErrMediaNotFound.WithErr(fmt.Errorf("tool %d has no media %x", tool.ID, hash))
+	}
+	a.invalidateToolCaches(tool.Location)
+	return nil, nil
+}
+
+// mediaHandler handles GET /media/{hash}
+// It serves the content of the media, with support for range requests so the videos can be
+// streamed and the downloads resumed.
+func (a *API) mediaHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	hash, err := hex.DecodeString(r.Context.URLParam("hash")[0])
+	if err != nil {
+		return nil, ErrInvalidHash.WithErr(err)
+	}
+	media, err := a.database.MediaService.GetMedia(r.Context.Request.Context(), hash)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrMediaNotFound.WithErr(fmt.Errorf("media with hash %x not found", hash))
+	}
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &RawResponse{
+		ContentType:  media.MimeType,
+		Data:         media.Content,
+		CacheControl: imageCacheControl,
+		ETag:         fmt.Sprintf("%q", media.Hash.String()),
+		LastModified: &media.CreatedAt,
+		Ranges:       true,
+	}, nil
+}
+
+// collectOrphanMedia deletes the media not attached to any tool, keeping the ones uploaded
+// in the last imageGracePeriod. It runs with the collection of the unreferenced images.
+func (a *API) collectOrphanMedia(ctx context.Context, now time.Time) error {
+	deleted, err := a.database.DeleteOrphanMedia(ctx, now.Add(-imageGracePeriod))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Info().Msgf("deleted %d unreferenced media", deleted)
+	}
+	return nil
+}
+
+// mediaFromMultipart returns the content of the "file" field of a multipart form body and
+// the "name" field, or the file name if there is none.
+func mediaFromMultipart(contentType string, body []byte) ([]byte, string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, "", fmt.Errorf("expected a multipart/form-data body")
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	var data []byte
+	var name, filename string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		switch part.FormName() {
+		case "file":
+			filename = part.FileName()
+			// One byte more than the maximum, to reject the larger files
+			if data, err = io.ReadAll(io.LimitReader(part, maxMediaUploadSize+1)); err != nil {
+				return nil, "", err
+			}
+		case "name":
+			value, err := io.ReadAll(io.LimitReader(part, maxMediaNameLength+1))
+			if err != nil {
+				return nil, "", err
+			}
+			name = string(value)
+		}
+	}
+	if data == nil {
+		return nil, "", fmt.Errorf("missing file field")
+	}
+	if strings.TrimSpace(name) == "" {
+		name = filename
+	}
+	return data, name, nil
+}
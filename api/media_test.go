@@ -0,0 +1,49 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestMediaFromMultipart(t *testing.T) {
+	c := qt.New(t)
+
+	form := func(name string) ([]byte, string) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "manual.pdf")
+		c.Assert(err, qt.IsNil)
+		_, err = part.Write([]byte("%PDF-1.4"))
+		c.Assert(err, qt.IsNil)
+		if name != "" {
+			c.Assert(writer.WriteField("name", name), qt.IsNil)
+		}
+		c.Assert(writer.Close(), qt.IsNil)
+		return body.Bytes(), writer.FormDataContentType()
+	}
+
+	// The name defaults to the file name
+	body, contentType := form("")
+	data, name, err := mediaFromMultipart(contentType, body)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(data), qt.Equals, "%PDF-1.4")
+	c.Assert(name, qt.Equals, "manual.pdf")
+
+	body, contentType = form("User manual")
+	_, name, err = mediaFromMultipart(contentType, body)
+	c.Assert(err, qt.IsNil)
+	c.Assert(name, qt.Equals, "User manual")
+
+	_, _, err = mediaFromMultipart("application/json", body)
+	c.Assert(err, qt.IsNotNil)
+
+	var empty bytes.Buffer
+	writer := multipart.NewWriter(&empty)
+	c.Assert(writer.WriteField("name", "no file"), qt.IsNil)
+	c.Assert(writer.Close(), qt.IsNil)
+	_, _, err = mediaFromMultipart(writer.FormDataContentType(), empty.Bytes())
+	c.Assert(err, qt.ErrorMatches, "missing file field")
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxMessageRefs is the maximum number of references resolved in a message, the next ones
+// are left as plain text.
+const maxMessageRefs = 20
+
+// refRegexp matches the references to tools and bookings, #tool:123 or #booking:<id>, and the
+// mentions of users by their name, @name.
+var refRegexp = regexp.MustCompile(`#(tool|booking):([0-9a-zA-Z]+)|@([\p{L}\p{N}_.\-]+)`)
+
+// messageRefs returns the references of the text resolved for its author: the tools the
+// author can see, the bookings the author is involved in and the users accepted by
+// mentionable. The references that cannot be resolved are left as plain text.
+func (a *API) messageRefs(
+	ctx context.Context,
+	text string,
+	author policy.Subject,
+	mentionable func(*db.User) bool,
+) []db.EntityRef {
+	matches := refMatches(text)
+	var names []string
+	for _, match := range matches {
+		if match[3] != "" {
+			names = append(names, match[3])
+		}
+	}
+	users := map[string]*db.User{}
+	if len(names) > 0 {
+		found, err := a.database.UserService.GetUsersByNames(ctx, names)
+		if err != nil {
+			log.Error().Err(err).Msg("could not resolve the mentions of a message")
+		}
+		for _, user := range found {
+			if mentionable(user) {
+				users[user.Name] = user
+			}
+		}
+	}
+
+	refs := []db.EntityRef{}
+	for _, match := range matches {
+		var ref *db.EntityRef
+		switch {
+		case match[1] == string(db.EntityTool):
+			ref = a.toolRef(ctx, match[2], author)
+		case match[1] == string(db.EntityBooking):
+			ref = a.bookingRef(ctx, match[2], author)
+		case users[match[3]] != nil:
+			user := users[match[3]]
+			ref = &db.EntityRef{Type: db.EntityUser, ID: user.ID.Hex(), Label: user.Name}
+		}
+		if ref != nil {
+			ref.Text = match[0]
+			refs = append(refs, *ref)
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	return refs
+}
+
+// refMatches returns the submatches of refRegexp in the text, without repeated references and
+// up to maxMessageRefs.
+func refMatches(text string) [][]string {
+	var matches [][]string
+	for _, match := range refRegexp.FindAllStringSubmatch(text, -1) {
+		// The dots and dashes ending a sentence are not part of the name
+		if match[3] != "" {
+			match[3] = strings.TrimRight(match[3], ".-")
+			match[0] = "@" + match[3]
+		}
+		if match[0] == "@" || slices.ContainsFunc(matches, func(m []string) bool { return m[0] == match[0] }) {
+			continue
+		}
+		if matches = append(matches, match); len(matches) == maxMessageRefs {
+			break
+		}
+	}
+	return matches
+}
+
+// toolRef returns the reference to the tool if the author can see it, or nil.
+func (a *API) toolRef(ctx context.Context, id string, author policy.Subject) *db.EntityRef {
+	toolID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil
+	}
+	tool, err := a.database.ToolService.GetToolByID(ctx, toolID)
+	if err != nil || a.authorizeToolView(ctx, author, tool) != nil {
+		return nil
+	}
+	return &db.EntityRef{Type: db.EntityTool, ID: id, Label: tool.Title}
+}
+
+// bookingRef returns the reference to the booking if the author is its requester or owner,
+// or nil.
+func (a *API) bookingRef(ctx context.Context, id string, author policy.Subject) *db.EntityRef {
+	bookingID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil
+	}
+	booking, err := a.database.BookingService.Get(ctx, bookingID)
+	if err != nil || (booking.FromUserID != author.ID && booking.ToUserID != author.ID) {
+		return nil
+	}
+	return &db.EntityRef{Type: db.EntityBooking, ID: id}
+}
+
+// communityMember returns a mentionable function accepting the members of the community.
+func communityMember(community string) func(*db.User) bool {
+	return func(user *db.User) bool {
+		return user.Community == community
+	}
+}
+
+// participant returns a mentionable function accepting the given users.
+func participant(ids ...primitive.ObjectID) func(*db.User) bool {
+	return func(user *db.User) bool {
+		return slices.Contains(ids, user.ID)
+	}
+}
+
+// notifyMentions notifies the users mentioned by the references, except the given users: the
+// author and the users already notified of the message.
+func (a *API) notifyMentions(ctx context.Context, refs []db.EntityRef, notification *db.Notification,
+	except ...primitive.ObjectID,
+) {
+	for _, ref := range refs {
+		if ref.Type != db.EntityUser {
+			continue
+		}
+		userID, err := primitive.ObjectIDFromHex(ref.ID)
+		if err != nil || slices.Contains(except, userID) {
+			continue
+		}
+		n := *notification
+		n.UserID = userID
+		n.Type = db.NotificationMention
+		a.notify(ctx, &n)
+	}
+}
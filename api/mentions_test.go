@@ -0,0 +1,35 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestRefMatches(t *testing.T) {
+	c := qt.New(t)
+
+	refs := func(text string) []string {
+		var matches []string
+		for _, match := range refMatches(text) {
+			matches = append(matches, match[0])
+		}
+		return matches
+	}
+
+	c.Assert(refs("Can I borrow #tool:123? Ask @maria_f."), qt.DeepEquals, []string{"#tool:123", "@maria_f"})
+	c.Assert(refs("See #booking:65f0c2a1b2c3d4e5f6a7b8c9 with @Jürgen-"), qt.DeepEquals,
+		[]string{"#booking:65f0c2a1b2c3d4e5f6a7b8c9", "@Jürgen"})
+	// Repeated references are resolved once
+	c.Assert(refs("@ana @ana #tool:1 #tool:1"), qt.DeepEquals, []string{"@ana", "#tool:1"})
+	// Unknown entities and lone signs are plain text
+	c.Assert(refs("#user:1 # @ @. mail@"), qt.IsNil)
+
+	var many []string
+	for i := 0; i < maxMessageRefs+5; i++ {
+		many = append(many, fmt.Sprintf("#tool:%d", i))
+	}
+	c.Assert(refMatches(strings.Join(many, " ")), qt.HasLen, maxMessageRefs)
+}
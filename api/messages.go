@@ -0,0 +1,319 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxMessageLength is the maximum length of a direct message.
+	maxMessageLength = 2000
+	// messagesPerHour is the maximum number of direct messages a user can send per hour.
+	messagesPerHour = 30
+)
+
+// contactFromRequest returns the user of the request and the other user of the URL parameter,
+// which must be an existing user.
+func (a *API) contactFromRequest(r *Request, param string) (*db.User, *db.User, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	idParam := r.Context.URLParam(param)
+	if idParam == nil {
+		return nil, nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing user id"))
+	}
+	other, err := a.getDBUserByID(idParam[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if other.DeletedAt != nil {
+		return nil, nil, ErrUserNotFound.WithErr(fmt.Errorf("user %s is deleted", other.ID.Hex()))
+	}
+	return user, other, nil
+}
+
+// isBlocked returns true if any of the two users blocked the other.
+func isBlocked(user, other *db.User) bool {
+	return slices.Contains(user.BlockedUsers, other.ID) || slices.Contains(other.BlockedUsers, user.ID)
+}
+
+// authorizeMessage checks the user can message the other user: none of them blocked the other
+// and they share a community or any of them requested a booking from the other.
+func (a *API) authorizeMessage(ctx context.Context, user, other *db.User) error {
+	if user.ID == other.ID {
+		return ErrMessageNotAllowed.WithErr(fmt.Errorf("cannot message yourself"))
+	}
+	if isBlocked(user, other) {
+		return ErrMessageBlocked
+	}
+	if !other.Active {
+		return ErrUserInactive
+	}
+	if user.Community != "" && user.Community == other.Community {
+		return nil
+	}
+	booked, err := a.database.BookingService.HasBookingBetween(ctx, user.ID, other.ID)
+	if err != nil {
+		return ErrInternalServerError.WithErr(err)
+	}
+	if !booked {
+		return ErrMessageNotAllowed
+	}
+	return nil
+}
+
+// sendMessageHandler handles POST /messages/{userId}
+// Sends a direct message to a user sharing a community or a booking with the user, in the
+// thread of one of their bookings if given. The recipient is notified of the first message it
+// did not read yet.
+func (a *API) sendMessageHandler(r *Request) (interface{}, error) {
+	user, other, err := a.contactFromRequest(r, "userId")
+	if err != nil {
+		return nil, err
+	}
+	var req MessageRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	text := strings.TrimSpace(req.Text)
+	if text == "" || len(text) > maxMessageLength {
+		return nil, ErrInvalidMessage.WithErr(fmt.Errorf("message must have between 1 and %d characters", maxMessageLength))
+	}
+
+	ctx := r.Context.Request.Context()
+	if err := a.authorizeMessage(ctx, user, other); err != nil {
+		return nil, err
+	}
+	message := &db.Message{Text: text}
+	if req.BookingID != "" {
+		id, err := primitive.ObjectIDFromHex(req.BookingID)
+		if err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(err)
+		}
+		booking, err := a.database.BookingService.Get(ctx, id)
+		if err != nil || !isBookingParty(booking, user.ID, other.ID) {
+			return nil, ErrMessageNotAllowed.WithErr(fmt.Errorf("booking %s is not between the users", req.BookingID))
+		}
+		message.BookingID = &id
+	}
+	if err := a.deliverMessage(ctx, user, other, message); err != nil {
+		return nil, err
+	}
+	return new(Message).FromDBMessage(message), nil
+}
+
+// isBookingParty returns true if the booking was requested by one of the users to the other.
+func isBookingParty(booking *db.Booking, user, other primitive.ObjectID) bool {
+	return booking != nil && ((booking.FromUserID == user && booking.ToUserID == other) ||
+		(booking.FromUserID == other && booking.ToUserID == user))
+}
+
+// deliverMessage stores the message of the user to the other user, within the rate limit of
+// the user, and notifies the recipient of the first message it did not read yet. The messages
+// of a booking thread are all notified with their text, so the users following the bookings
+// by email can read and answer them. The users must be allowed to message each other.
+func (a *API) deliverMessage(ctx context.Context, user, other *db.User, message *db.Message) error {
+	recent, err := a.database.MessageService.CountRecentMessages(ctx, user.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		return ErrInternalServerError.WithErr(err)
+	}
+	if recent >= messagesPerHour {
+		return ErrTooManyMessages
+	}
+	unread, err := a.database.MessageService.HasUnreadMessages(ctx, other.ID, user.ID)
+	if err != nil {
+		return ErrInternalServerError.WithErr(err)
+	}
+
+	// Only the two users can be mentioned, the recipient is already notified of the message
+	message.FromUserID = user.ID
+	message.ToUserID = other.ID
+	message.Refs = a.messageRefs(ctx, message.Text, subjectFromDBUser(user), participant(user.ID, other.ID))
+	if err := a.database.MessageService.InsertMessage(ctx, message); err != nil {
+		return ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	switch {
+	case message.BookingID != nil:
+		a.notify(ctx, &db.Notification{
+			UserID:    other.ID,
+			Type:      db.NotificationDirectMessage,
+			Message:   fmt.Sprintf("New message from %s about your booking:\n\n%s", user.Name, message.Text),
+			BookingID: *message.BookingID,
+		})
+	case !unread:
+		a.notify(ctx, &db.Notification{
+			UserID:  other.ID,
+			Type:    db.NotificationDirectMessage,
+			Message: fmt.Sprintf("New message from %s", user.Name),
+		})
+	}
+	return nil
+}
+
+// conversationsHandler handles GET /messages?page=
+// Returns the conversations of the user, the one with the most recent message first, and the
+// number of messages not read yet.
+func (a *API) conversationsHandler(r *Request) (interface{}, error) {
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	ctx := r.Context.Request.Context()
+	conversations, err := a.database.MessageService.GetConversations(ctx, userID, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	unread, err := a.database.MessageService.CountUnread(ctx, userID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+
+	ids := make([]primitive.ObjectID, len(conversations))
+	for i, conversation := range conversations {
+		ids[i] = conversation.UserID
+	}
+	users, err := a.database.UserService.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	names := make(map[primitive.ObjectID]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Name
+	}
+
+	result := &ConversationsWrapper{Conversations: make([]*Conversation, len(conversations)), Unread: unread}
+	for i, conversation := range conversations {
+		result.Conversations[i] = &Conversation{
+			User: &Contact{
+				ID:        conversation.UserID.Hex(),
+				Name:      names[conversation.UserID],
+				AvatarURL: avatarURL(conversation.UserID.Hex()),
+			},
+			LastMessage: new(Message).FromDBMessage(conversation.LastMessage),
+			Unread:      conversation.Unread,
+		}
+	}
+	return result, nil
+}
+
+// messagesHandler handles GET /messages/{userId}?page=
+// Returns the messages between the user and the other user, newest first, and marks the
+// messages received as read.
+func (a *API) messagesHandler(r *Request) (interface{}, error) {
+	user, other, err := a.contactFromRequest(r, "userId")
+	if err != nil {
+		return nil, err
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	ctx := r.Context.Request.Context()
+	messages, err := a.database.MessageService.GetMessages(ctx, user.ID, other.ID, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if _, err := a.database.MessageService.MarkRead(ctx, user.ID, other.ID); err != nil {
+		log.Error().Err(err).Msgf("could not mark the messages of user %s as read", other.ID.Hex())
+	}
+	result := &MessagesWrapper{Messages: make([]*Message, len(messages))}
+	for i, message := range messages {
+		result.Messages[i] = new(Message).FromDBMessage(message)
+	}
+	return result, nil
+}
+
+// bookingMessagesHandler handles GET /bookings/{bookingId}/messages?page=
+// Returns the messages of the thread of the booking, newest first, including the replies to
+// its notification emails.
+func (a *API) bookingMessagesHandler(r *Request) (interface{}, error) {
+	booking, _, err := a.authorizedBookingFromRequest(r, "bookingId", policy.BookingRead)
+	if err != nil {
+		return nil, err
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	messages, err := a.database.MessageService.GetBookingMessages(r.Context.Request.Context(), booking.ID, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := &MessagesWrapper{Messages: make([]*Message, len(messages))}
+	for i, message := range messages {
+		result.Messages[i] = new(Message).FromDBMessage(message)
+	}
+	return result, nil
+}
+
+// blockUserHandler handles POST /users/{id}/block
+// Blocks the user, so none of the two users can message the other.
+func (a *API) blockUserHandler(r *Request) (interface{}, error) {
+	user, other, err := a.contactFromRequest(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == other.ID {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("cannot block yourself"))
+	}
+	if err := a.database.UserService.BlockUser(r.Context.Request.Context(), user.ID, other.ID); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// unblockUserHandler handles DELETE /users/{id}/block
+func (a *API) unblockUserHandler(r *Request) (interface{}, error) {
+	user, other, err := a.contactFromRequest(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	if err := a.database.UserService.UnblockUser(r.Context.Request.Context(), user.ID, other.ID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotBlocked.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// blockedUsersHandler handles GET /profile/blocked
+// Returns the users blocked by the user.
+func (a *API) blockedUsersHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	result := &ContactsWrapper{Users: []*Contact{}}
+	if len(user.BlockedUsers) == 0 {
+		return result, nil
+	}
+	users, err := a.database.UserService.GetUsersByIDs(r.Context.Request.Context(), user.BlockedUsers)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result.Users = make([]*Contact, len(users))
+	for i, blocked := range users {
+		result.Users[i] = &Contact{
+			ID:        blocked.ID.Hex(),
+			Name:      blocked.Name,
+			AvatarURL: avatarURL(blocked.ID.Hex()),
+		}
+	}
+	return result, nil
+}
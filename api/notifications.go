@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/emprius/emprius-app-backend/push"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// pushTimeout is the maximum duration of the delivery of a notification to the devices of a user.
+const pushTimeout = 30 * time.Second
+
+// notify delivers a notification to the user through the channels chosen in the preferences
+// of the user: it is stored as an in-app notification, pushed in the background to the devices
+// of the user and sent by email. Errors are logged but not returned, a failed notification must
+// never break the operation that triggered it.
+func (a *API) notify(ctx context.Context, n *db.Notification) {
+	user, err := a.database.UserService.GetUserByID(ctx, n.UserID)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not get user %s to notify", n.UserID.Hex())
+		return
+	}
+	if user.DeletedAt != nil {
+		return
+	}
+	channels := user.NotificationChannels(n.Type)
+	if channels.InApp {
+		if _, err := a.database.NotificationService.InsertNotification(ctx, n); err != nil {
+			log.Error().Err(err).Msgf("could not notify user %s", n.UserID.Hex())
+		}
+	}
+	if channels.Push {
+		go a.pushNotification(n)
+	}
+	if channels.Telegram && a.telegram != nil && user.Telegram != nil && user.Telegram.ChatID != 0 {
+		go a.telegramNotification(user, n)
+	}
+	if channels.Email {
+		// The replies to the booking notifications are appended to the booking thread
+		msg := &mail.Message{
+			To:      user.Email,
+			Subject: a.notificationSubject(n.Type),
+			Body:    n.Message,
+		}
+		if !n.BookingID.IsZero() {
+			msg.ReplyTo = a.bookingReplyTo(n.BookingID, user.ID)
+		}
+		a.sendMail(ctx, msg)
+	}
+}
+
+// notificationSubject returns the email subject of a notification type.
+func (a *API) notificationSubject(t db.NotificationType) string {
+	switch t {
+	case db.NotificationBookingReminder:
+		return "Booking reminder"
+	case db.NotificationRatingReminder:
+		return "Rate your booking"
+	case db.NotificationBookingRequest:
+		return "New booking request"
+	default:
+		return a.branding.AppName + " notification"
+	}
+}
+
+// pushNotification sends the notification to every device registered by the user. Devices
+// whose token is rejected by the push service are removed.
+func (a *API) pushNotification(n *db.Notification) {
+	ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+	devices, err := a.database.DeviceService.GetUserDevices(ctx, n.UserID)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not get the devices of user %s", n.UserID.Hex())
+		return
+	}
+	msg := &push.Message{
+		Title: a.branding.AppName,
+		Body:  n.Message,
+		Data:  map[string]string{"type": string(n.Type)},
+	}
+	if !n.ID.IsZero() {
+		msg.Data["notificationId"] = n.ID.Hex()
+	}
+	if n.ToolID != 0 {
+		msg.Data["toolId"] = strconv.FormatInt(n.ToolID, 10)
+	}
+	if !n.BookingID.IsZero() {
+		msg.Data["bookingId"] = n.BookingID.Hex()
+	}
+	if !n.PostID.IsZero() {
+		msg.Data["postId"] = n.PostID.Hex()
+	}
+	for _, d := range devices {
+		err := a.push.Send(ctx, &push.Target{
+			Platform: push.Platform(d.Platform),
+			Token:    d.Token,
+			P256dh:   d.P256dh,
+			Auth:     d.Auth,
+		}, msg)
+		switch {
+		case errors.Is(err, push.ErrInvalidToken):
+			if err := a.database.DeviceService.DeleteDeviceByToken(ctx, d.Token); err != nil {
+				log.Warn().Err(err).Msgf("could not delete invalid device %s", d.ID.Hex())
+			}
+		case err != nil:
+			log.Warn().Err(err).Msgf("could not push notification to device %s", d.ID.Hex())
+		}
+	}
+}
+
+// notificationsHandler handles GET /profile/notifications?page=&unread=
+func (a *API) notificationsHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	unreadOnly := false
+	if unread := r.Context.URLParam("unread"); unread != nil {
+		unreadOnly = unread[0] == "true"
+	}
+
+	ctx := r.Context.Request.Context()
+	notifications, err := a.database.NotificationService.GetUserNotifications(ctx, userID, page, unreadOnly)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	unread, err := a.database.NotificationService.CountUnread(ctx, userID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := &NotificationsWrapper{Notifications: []*Notification{}, Unread: unread}
+	for _, n := range notifications {
+		result.Notifications = append(result.Notifications, new(Notification).FromDBNotification(n))
+	}
+	return result, nil
+}
+
+// readNotificationHandler handles POST /profile/notifications/{id}/read
+func (a *API) readNotificationHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	idParam := r.Context.URLParam("id")
+	if idParam == nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing notification id"))
+	}
+	id, err := primitive.ObjectIDFromHex(idParam[0])
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if err := a.database.NotificationService.MarkAsRead(r.Context.Request.Context(), userID, id); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotificationNotFound.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// readAllNotificationsHandler handles POST /profile/notifications/read
+func (a *API) readAllNotificationsHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	if err := a.database.NotificationService.MarkAllAsRead(r.Context.Request.Context(), userID); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// notificationPreferencesHandler handles GET /profile/notification-preferences
+// It returns the channels of every notification type, including the default ones.
+func (a *API) notificationPreferencesHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return notificationPreferences(user), nil
+}
+
+// updateNotificationPreferencesHandler handles PUT /profile/notification-preferences
+// The body maps notification types to their channels. The types not included are not modified.
+func (a *API) updateNotificationPreferencesHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var req NotificationPreferences
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	for t := range req {
+		if !db.IsValidNotificationType(t) {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid notification type %q", t))
+		}
+	}
+	ctx := r.Context.Request.Context()
+	if err := a.database.UserService.SetNotificationPreferences(ctx, user.ID, req); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if user.NotificationPreferences == nil {
+		user.NotificationPreferences = make(map[db.NotificationType]db.NotificationChannels, len(req))
+	}
+	for t, channels := range req {
+		user.NotificationPreferences[t] = channels
+	}
+	return notificationPreferences(user), nil
+}
+
+// notificationPreferences returns the channels of every notification type for the user.
+func notificationPreferences(user *db.User) NotificationPreferences {
+	preferences := make(NotificationPreferences, len(db.NotificationTypes))
+	for _, t := range db.NotificationTypes {
+		preferences[t] = user.NotificationChannels(t)
+	}
+	return preferences
+}
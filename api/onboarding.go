@@ -0,0 +1,56 @@
+package api
+
+import (
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+// The steps of the onboarding checklist, in the order they are shown.
+const (
+	onboardingVerifiedEmail = "verifiedEmail"
+	onboardingLocation      = "location"
+	onboardingAvatar        = "avatar"
+	onboardingFirstTool     = "firstTool"
+	onboardingCommunity     = "community"
+	onboardingFirstBooking  = "firstBooking"
+)
+
+// onboardingHandler handles GET /profile/onboarding
+// Returns the onboarding checklist of the user: whether the email is verified, the location
+// and the avatar are set, the first tool is published, the user joined a community and
+// completed a first booking, renting or lending a tool.
+func (a *API) onboardingHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	tools, err := a.database.ToolService.CountUserTools(ctx, user.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	booked, err := a.database.BookingService.HasReturnedBooking(ctx, user.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return onboardingChecklist(user, tools > 0, booked), nil
+}
+
+// onboardingChecklist returns the onboarding checklist of the user, given whether it published
+// a tool and completed a booking.
+func onboardingChecklist(user *db.User, published, booked bool) *Onboarding {
+	steps := []*OnboardingStep{
+		{Step: onboardingVerifiedEmail, Completed: user.Verified},
+		{Step: onboardingLocation, Completed: user.Location.Type != ""},
+		{Step: onboardingAvatar, Completed: len(user.AvatarHash) > 0},
+		{Step: onboardingFirstTool, Completed: published},
+		{Step: onboardingCommunity, Completed: user.Community != ""},
+		{Step: onboardingFirstBooking, Completed: booked},
+	}
+	onboarding := &Onboarding{Steps: steps, Total: len(steps)}
+	for _, step := range steps {
+		if step.Completed {
+			onboarding.Completed++
+		}
+	}
+	return onboarding
+}
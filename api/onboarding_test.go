@@ -0,0 +1,44 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/emprius/emprius-app-backend/db"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestOnboardingChecklist(t *testing.T) {
+	c := qt.New(t)
+
+	completed := func(o *Onboarding) []string {
+		steps := []string{}
+		for _, step := range o.Steps {
+			if step.Completed {
+				steps = append(steps, step.Step)
+			}
+		}
+		return steps
+	}
+
+	// A new user without location nor community has nothing done
+	onboarding := onboardingChecklist(&db.User{}, false, false)
+	c.Assert(onboarding.Total, qt.Equals, 6)
+	c.Assert(onboarding.Completed, qt.Equals, 0)
+	c.Assert(completed(onboarding), qt.DeepEquals, []string{})
+
+	user := &db.User{
+		Community:  "valley",
+		Location:   db.NewLocation(41695384, 2492793),
+		AvatarHash: []byte{1, 2, 3},
+	}
+	onboarding = onboardingChecklist(user, true, false)
+	c.Assert(onboarding.Completed, qt.Equals, 4)
+	c.Assert(completed(onboarding), qt.DeepEquals,
+		[]string{onboardingLocation, onboardingAvatar, onboardingFirstTool, onboardingCommunity})
+
+	user.Verified = true
+	onboarding = onboardingChecklist(user, true, true)
+	c.Assert(onboarding.Completed, qt.Equals, onboarding.Total)
+	c.Assert(onboarding.Steps[0].Step, qt.Equals, onboardingVerifiedEmail)
+	c.Assert(onboarding.Steps[5].Step, qt.Equals, onboardingFirstBooking)
+}
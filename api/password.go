@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// checkPassword returns ErrWeakPassword, with the violations, if the password does not follow the
+// password policy of the instance. The personal data of the user (i.e. the email and name) and
+// the name of the instance are the first words tried to guess it.
+func (a *API) checkPassword(pw string, personal ...string) error {
+	violations := a.passwordPolicy.Check(pw, append(personal, a.branding.AppName)...)
+	if len(violations) == 0 {
+		return nil
+	}
+	return ErrWeakPassword.WithData(&PasswordViolations{Violations: violations}).
+		WithErr(fmt.Errorf("%d policy violations", len(violations)))
+}
+
+// passwordPolicyHandler handles GET /info/password-policy
+// Returns the password policy of the instance, so the clients can check the passwords before
+// sending them.
+func (a *API) passwordPolicyHandler(_ *Request) (interface{}, error) {
+	return &a.passwordPolicy, nil
+}
+
+// rehashPassword replaces the stored hash of the password of the user, after a successful login
+// with a hash of the legacy scheme or made with other Argon2id parameters. A failure is logged,
+// and the hash is replaced on another login.
+func (a *API) rehashPassword(ctx context.Context, user *db.User, pw string) {
+	hash, err := a.hashPassword(pw)
+	if err == nil {
+		_, err = a.database.UserService.UpdateUser(ctx, user.ID, bson.M{"password": hash})
+	}
+	if err != nil {
+		log.Warn().Err(err).Msgf("could not rehash the password of user %s", user.ID.Hex())
+		return
+	}
+	log.Info().Msgf("rehashed the password of user %s", user.ID.Hex())
+}
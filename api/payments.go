@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/payment"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+)
+
+// startPayment creates the payment of a booking just accepted, if the payments are enabled and
+// the booking has a price. A failure is logged, the renter can create the payment again.
+func (a *API) startPayment(ctx context.Context, booking *db.Booking) {
+	if a.payments == nil || booking.Price == nil || *booking.Price == 0 {
+		return
+	}
+	if _, err := a.createPayment(ctx, booking); err != nil {
+		log.Error().Err(err).Msgf("could not create the payment of booking %s", booking.ID.Hex())
+	}
+}
+
+// createPayment creates a pending payment of the price of the accepted booking in the payment
+// provider, and stores it in the booking.
+func (a *API) createPayment(ctx context.Context, booking *db.Booking) (*db.BookingPayment, error) {
+	var email string
+	if renter, err := a.database.UserService.GetUserByID(ctx, booking.FromUserID); err == nil {
+		email = renter.Email
+	}
+	amount := int64(*booking.Price) * a.tokenValue
+	intent, err := a.payments.Create(ctx, &payment.Request{
+		Reference:   booking.ID.Hex(),
+		Amount:      amount,
+		Currency:    a.paymentCurrency,
+		Description: "Booking of " + a.bookingToolTitle(ctx, booking),
+		Email:       email,
+		ReturnURL:   strings.ReplaceAll(a.paymentReturnURL, "{booking}", booking.ID.Hex()),
+	})
+	if err != nil {
+		return nil, ErrPaymentProvider.WithErr(err)
+	}
+	now := time.Now()
+	p := &db.BookingPayment{
+		Provider:  a.payments.Name(),
+		ID:        intent.ID,
+		Status:    string(payment.StatusPending),
+		Amount:    amount,
+		Currency:  a.paymentCurrency,
+		URL:       intent.URL,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := a.database.BookingService.SetPayment(ctx, booking.ID, p); err != nil {
+		if err == db.ErrPaymentConflict {
+			return nil, ErrPaymentConflict.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return p, nil
+}
+
+// HandleCreatePayment handles POST /bookings/{bookingId}/payment
+// The renter creates the payment of an accepted booking again, if the one created on its
+// acceptance could not be created, failed or expired.
+func (a *API) HandleCreatePayment(r *Request) (interface{}, error) {
+	booking, _, err := a.authorizedBookingFromRequest(r, "bookingId", policy.BookingPay)
+	if err != nil {
+		return nil, err
+	}
+	if a.payments == nil {
+		return nil, ErrPaymentsDisabled
+	}
+	if booking.BookingStatus != db.BookingStatusAccepted || booking.Price == nil || *booking.Price == 0 {
+		return nil, ErrBookingNotPayable.WithErr(fmt.Errorf("booking %s is %s", booking.ID.Hex(), booking.BookingStatus))
+	}
+	if booking.Payment != nil && (booking.Payment.Status == string(payment.StatusPending) ||
+		booking.Payment.Status == string(payment.StatusPaid)) {
+		return nil, ErrPaymentConflict.WithErr(fmt.Errorf("payment of booking %s is %s", booking.ID.Hex(), booking.Payment.Status))
+	}
+	booking.Payment, err = a.createPayment(r.Context.Request.Context(), booking)
+	if err != nil {
+		return nil, err
+	}
+	return convertBookingToResponse(booking), nil
+}
+
+// HandleMarkPaymentPaid handles POST /bookings/{bookingId}/payment/paid
+// The owner marks the payment of the booking as paid, collected outside the payment provider
+// (i.e. in cash).
+func (a *API) HandleMarkPaymentPaid(r *Request) (interface{}, error) {
+	booking, _, err := a.authorizedBookingFromRequest(r, "bookingId", policy.BookingMarkPaid)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	updated, err := a.database.BookingService.MarkPaymentPaid(ctx, booking.ID)
+	switch {
+	case errors.Is(err, db.ErrBookingNotFound):
+		return nil, ErrPaymentNotFound.WithErr(err)
+	case errors.Is(err, db.ErrPaymentConflict):
+		return nil, ErrPaymentConflict.WithErr(err)
+	case err != nil:
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.notify(ctx, &db.Notification{
+		UserID:    updated.FromUserID,
+		Type:      db.NotificationBookingStatus,
+		Message:   fmt.Sprintf("The payment of the booking of %s has been received", a.bookingToolTitle(ctx, updated)),
+		BookingID: updated.ID,
+	})
+	return convertBookingToResponse(updated), nil
+}
+
+// paymentWebhookHandler handles POST /payments/webhook
+// The payment provider notifies the changes of the status of the payments. The notifications
+// of unknown or already paid payments are acknowledged, so the provider does not retry them.
+func (a *API) paymentWebhookHandler(r *Request) (interface{}, error) {
+	if a.payments == nil {
+		return nil, ErrPaymentsDisabled
+	}
+	event, err := a.payments.Webhook(r.Data, r.Context.Request.Header)
+	if errors.Is(err, payment.ErrIgnoredEvent) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrInvalidPaymentWebhook.WithErr(err)
+	}
+	ctx := r.Context.Request.Context()
+	booking, err := a.database.BookingService.UpdatePaymentStatus(ctx, a.payments.Name(), event.PaymentID, string(event.Status))
+	switch {
+	case errors.Is(err, db.ErrBookingNotFound), errors.Is(err, db.ErrPaymentConflict):
+		log.Warn().Err(err).Msgf("ignoring %s notification of payment %s", event.Status, event.PaymentID)
+		return nil, nil
+	case err != nil:
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	title := a.bookingToolTitle(ctx, booking)
+	switch event.Status {
+	case payment.StatusPaid:
+		a.notify(ctx, &db.Notification{
+			UserID:    booking.ToUserID,
+			Type:      db.NotificationBookingStatus,
+			Message:   fmt.Sprintf("The booking of %s has been paid", title),
+			BookingID: booking.ID,
+		})
+	case payment.StatusFailed, payment.StatusExpired:
+		a.notify(ctx, &db.Notification{
+			UserID:    booking.FromUserID,
+			Type:      db.NotificationBookingStatus,
+			Message:   fmt.Sprintf("The payment of the booking of %s is %s, pay it again from the booking", title, event.Status),
+			BookingID: booking.ID,
+		})
+	}
+	return nil, nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+const (
+	// popularityWindow is the time of the recent views and completed bookings taken into
+	// account to rank the tools by popularity.
+	popularityWindow = db.ToolViewTTL
+	// popularityBookingWeight is the number of views a completed booking is worth.
+	popularityBookingWeight = 5
+)
+
+// updateToolPopularity recalculates the popularity of the tools, the number of views in the
+// popularity window plus the completed bookings weighted by popularityBookingWeight, boosted
+// by the quality of their listing.
+func (a *API) updateToolPopularity(ctx context.Context) error {
+	since := time.Now().Add(-popularityWindow)
+	views, err := a.database.ToolViewService.CountViewsSince(ctx, since)
+	if err != nil {
+		return fmt.Errorf("could not count tool views: %w", err)
+	}
+	bookings, err := a.database.BookingService.GetReturnedBookingsByTool(ctx, &since)
+	if err != nil {
+		return fmt.Errorf("could not count returned bookings: %w", err)
+	}
+	popularity := make(map[int64]float64, len(views))
+	for _, count := range views {
+		popularity[count.ToolID] += float64(count.Views)
+	}
+	for _, count := range bookings {
+		id, err := strconv.ParseInt(count.ToolID, 10, 64)
+		if err != nil {
+			continue
+		}
+		popularity[id] += float64(count.Bookings * popularityBookingWeight)
+	}
+	if err := a.qualityBoost(ctx, popularity); err != nil {
+		return fmt.Errorf("could not get the listing quality of the tools: %w", err)
+	}
+	return a.database.ToolService.SetPopularity(ctx, popularity)
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxPostTitleLength is the maximum length of the title of a community post.
+	maxPostTitleLength = 120
+	// maxPostBodyLength is the maximum length of the body of a community post.
+	maxPostBodyLength = 5000
+	// maxCommentLength is the maximum length of a comment on a community post.
+	maxCommentLength = 2000
+)
+
+// communityFromRequest returns the subject of the request and the community of the URL,
+// checking the subject is allowed to perform the action on it.
+func (a *API) communityFromRequest(r *Request, action policy.Action) (policy.Subject, string, error) {
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return policy.Subject{}, "", err
+	}
+	communityParam := r.Context.URLParam("id")
+	if communityParam == nil || communityParam[0] == "" {
+		return policy.Subject{}, "", ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing community id"))
+	}
+	community := communityParam[0]
+	if err := authorize(action, subject, policy.Resource{Community: community}); err != nil {
+		return policy.Subject{}, "", err
+	}
+	return subject, community, nil
+}
+
+// postFromRequest returns the post of the URL, which must belong to the community.
+func (a *API) postFromRequest(r *Request, community string) (*db.Post, error) {
+	postParam := r.Context.URLParam("postId")
+	if postParam == nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing post id"))
+	}
+	id, err := primitive.ObjectIDFromHex(postParam[0])
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	post, err := a.database.PostService.GetPost(r.Context.Request.Context(), community, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPostNotFound.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return post, nil
+}
+
+// createPostHandler handles POST /communities/{id}/posts
+// Any member can post on the board of the community. Announcements can only be posted by the
+// community admins and are notified to every member.
+func (a *API) createPostHandler(r *Request) (interface{}, error) {
+	subject, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	var req PostRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	title, body := strings.TrimSpace(req.Title), strings.TrimSpace(req.Body)
+	if title == "" || body == "" {
+		return nil, ErrEmptyTitleOrDescription.WithErr(fmt.Errorf("post without title or body"))
+	}
+	if len(title) > maxPostTitleLength || len(body) > maxPostBodyLength {
+		return nil, ErrInvalidRequestBodyData.WithErr(
+			fmt.Errorf("title or body longer than %d and %d characters", maxPostTitleLength, maxPostBodyLength))
+	}
+	if req.Announcement {
+		if err := authorize(policy.CommunityModerate, subject, policy.Resource{Community: community}); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := r.Context.Request.Context()
+	post := &db.Post{
+		Community:    community,
+		AuthorID:     subject.ID,
+		Title:        title,
+		Body:         body,
+		Announcement: req.Announcement,
+		Refs:         a.messageRefs(ctx, body, subject, communityMember(community)),
+	}
+	if err := a.database.PostService.InsertPost(ctx, post); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	// The announcements are notified to every member, mentioned or not
+	if post.Announcement {
+		go a.notifyAnnouncement(post)
+	} else {
+		a.notifyMentions(ctx, post.Refs, &db.Notification{
+			Message: fmt.Sprintf("You were mentioned in the post %s", post.Title),
+			PostID:  post.ID,
+		}, subject.ID)
+	}
+	return new(Post).FromDBPost(post), nil
+}
+
+// postsHandler handles GET /communities/{id}/posts?page=
+// The pinned posts are listed first, then the newest.
+func (a *API) postsHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	posts, err := a.database.PostService.GetCommunityPosts(r.Context.Request.Context(), community, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := &PostsWrapper{Posts: []*Post{}}
+	for _, p := range posts {
+		result.Posts = append(result.Posts, new(Post).FromDBPost(p))
+	}
+	return result, nil
+}
+
+// postHandler handles GET /communities/{id}/posts/{postId}
+func (a *API) postHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	post, err := a.postFromRequest(r, community)
+	if err != nil {
+		return nil, err
+	}
+	return new(Post).FromDBPost(post), nil
+}
+
+// pinPostHandler handles POST /communities/{id}/posts/{postId}/pin
+func (a *API) pinPostHandler(r *Request) (interface{}, error) {
+	return nil, a.setPostPinned(r, true)
+}
+
+// unpinPostHandler handles DELETE /communities/{id}/posts/{postId}/pin
+func (a *API) unpinPostHandler(r *Request) (interface{}, error) {
+	return nil, a.setPostPinned(r, false)
+}
+
+// setPostPinned pins or unpins the post of the request. Only the community admins can pin posts.
+func (a *API) setPostPinned(r *Request, pinned bool) error {
+	_, community, err := a.communityFromRequest(r, policy.CommunityModerate)
+	if err != nil {
+		return err
+	}
+	post, err := a.postFromRequest(r, community)
+	if err != nil {
+		return err
+	}
+	if err := a.database.PostService.SetPinned(r.Context.Request.Context(), community, post.ID, pinned); err != nil {
+		return ErrInternalServerError.WithErr(err)
+	}
+	return nil
+}
+
+// createCommentHandler handles POST /communities/{id}/posts/{postId}/comments
+// The author of the post is notified of the new comments.
+func (a *API) createCommentHandler(r *Request) (interface{}, error) {
+	subject, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	post, err := a.postFromRequest(r, community)
+	if err != nil {
+		return nil, err
+	}
+	var req CommentRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" || len(body) > maxCommentLength {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("comment must have between 1 and %d characters", maxCommentLength))
+	}
+
+	ctx := r.Context.Request.Context()
+	comment := &db.PostComment{
+		PostID:   post.ID,
+		AuthorID: subject.ID,
+		Body:     body,
+		Refs:     a.messageRefs(ctx, body, subject, communityMember(community)),
+	}
+	if err := a.database.PostService.InsertComment(ctx, comment); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	if post.AuthorID != subject.ID {
+		a.notify(ctx, &db.Notification{
+			UserID:  post.AuthorID,
+			Type:    db.NotificationPostComment,
+			Message: fmt.Sprintf("New comment on your post %s", post.Title),
+			PostID:  post.ID,
+		})
+	}
+	// The author of the post is already notified of the comment
+	a.notifyMentions(ctx, comment.Refs, &db.Notification{
+		Message: fmt.Sprintf("You were mentioned in a comment on the post %s", post.Title),
+		PostID:  post.ID,
+	}, subject.ID, post.AuthorID)
+	return new(PostComment).FromDBPostComment(comment), nil
+}
+
+// commentsHandler handles GET /communities/{id}/posts/{postId}/comments?page=
+// The comments are listed oldest first.
+func (a *API) commentsHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	post, err := a.postFromRequest(r, community)
+	if err != nil {
+		return nil, err
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	comments, err := a.database.PostService.GetPostComments(r.Context.Request.Context(), post.ID, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := &PostCommentsWrapper{Comments: []*PostComment{}}
+	for _, c := range comments {
+		result.Comments = append(result.Comments, new(PostComment).FromDBPostComment(c))
+	}
+	return result, nil
+}
+
+// notifyAnnouncement notifies the members of the community, except its author, of a new announcement.
+func (a *API) notifyAnnouncement(post *db.Post) {
+	ctx := context.Background()
+	members, err := a.database.UserService.GetCommunityMemberIDs(ctx, post.Community)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not get the members of community %s", post.Community)
+		return
+	}
+	for _, member := range members {
+		if member == post.AuthorID {
+			continue
+		}
+		a.notify(ctx, &db.Notification{
+			UserID:  member,
+			Type:    db.NotificationCommunityAnnouncement,
+			Message: fmt.Sprintf("New announcement in your community: %s", post.Title),
+			PostID:  post.ID,
+		})
+	}
+}
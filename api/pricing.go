@@ -0,0 +1,154 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+// pricingFromTool returns the pricing mode and suggested amount of the tool. An empty mode is
+// kept empty, so the pricing of the tool follows its cost.
+func pricingFromTool(t *Tool) (db.PricingMode, uint64, error) {
+	mode := db.PricingMode(t.PricingMode)
+	if mode == "" {
+		return "", 0, nil
+	}
+	if !db.IsValidPricingMode(mode) {
+		return "", 0, ErrInvalidPricingMode.WithErr(fmt.Errorf("pricing mode %q is not valid", t.PricingMode))
+	}
+	if mode != db.PricingPayWhatYouWant || t.SuggestedAmount == nil {
+		return mode, 0, nil
+	}
+	return mode, *t.SuggestedAmount, nil
+}
+
+// cancellationPolicyFromTool returns the cancellation policy of the tool, empty if not set.
+func cancellationPolicyFromTool(t *Tool) (db.CancellationPolicy, error) {
+	policy := db.CancellationPolicy(t.CancellationPolicy)
+	if policy != "" && !db.IsValidCancellationPolicy(policy) {
+		return "", ErrInvalidCancellationPolicy.WithErr(fmt.Errorf("cancellation policy %q is not valid", t.CancellationPolicy))
+	}
+	return policy, nil
+}
+
+// cancellationPenalty returns the tokens the renter pays to the owner for cancelling the
+// accepted booking at the given time. Only the bookings of strict tools cancelled less than
+// the cancellation window before they start have a penalty, a percentage of their price.
+func (a *API) cancellationPenalty(booking *db.Booking, now time.Time) uint64 {
+	if booking.CancellationPolicy != db.CancellationStrict || booking.Price == nil {
+		return 0
+	}
+	if booking.StartDate.Sub(now) > a.cancelWindow {
+		return 0
+	}
+	return a.lateCancellationFee(*booking.Price)
+}
+
+// lateCancellationFee returns the penalty of the late cancellation of a booking with the price.
+func (a *API) lateCancellationFee(price uint64) uint64 {
+	return price * a.cancelFee / 100
+}
+
+// bookingDays returns the number of started days between the dates, at least one.
+func bookingDays(start, end time.Time) uint64 {
+	days := uint64((end.Sub(start) + 24*time.Hour - 1) / (24 * time.Hour))
+	if days == 0 {
+		days = 1
+	}
+	return days
+}
+
+// bookingPrice returns the tokens a booking of the tool between the dates costs. The amount
+// proposed by the renter is only accepted for pay what you want tools, which cost the
+// suggested amount for each day if none is proposed.
+func bookingPrice(tool *db.Tool, start, end time.Time, amount *uint64) (uint64, error) {
+	mode := tool.Pricing()
+	if amount != nil && mode != db.PricingPayWhatYouWant {
+		return 0, ErrAmountNotAllowed.WithErr(fmt.Errorf("tool %d pricing mode is %s", tool.ID, mode))
+	}
+	switch mode {
+	case db.PricingFree:
+		return 0, nil
+	case db.PricingPayWhatYouWant:
+		if amount != nil {
+			return *amount, nil
+		}
+		return tool.SuggestedAmount * bookingDays(start, end), nil
+	default:
+		return tool.Cost * bookingDays(start, end), nil
+	}
+}
+
+// quoteHandler handles GET /tools/{id}/quote?startDate=&endDate=&amount=&transport=
+// Returns the price of a booking of the tool between the UNIX timestamps, with the optional
+// amount proposed for pay what you want tools, and its cancellation policy. With a transport
+// option of the tool, the quote includes its delivery fee.
+func (a *API) quoteHandler(r *Request) (interface{}, error) {
+	tool, err := a.toolFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	param := func(key string) (*uint64, error) {
+		value := r.Context.URLParam(key)
+		if value == nil {
+			return nil, nil
+		}
+		n, err := strconv.ParseUint(value[0], 10, 64)
+		if err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid %s %q", key, value[0]))
+		}
+		return &n, nil
+	}
+	startDate, err := param("startDate")
+	if err != nil {
+		return nil, err
+	}
+	endDate, err := param("endDate")
+	if err != nil {
+		return nil, err
+	}
+	amount, err := param("amount")
+	if err != nil {
+		return nil, err
+	}
+	transport, err := param("transport")
+	if err != nil {
+		return nil, err
+	}
+	if startDate == nil || endDate == nil || *endDate <= *startDate {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("startDate and endDate are required, endDate after startDate"))
+	}
+	start, end := time.Unix(int64(*startDate), 0), time.Unix(int64(*endDate), 0)
+	price, err := bookingPrice(tool, start, end, amount)
+	if err != nil {
+		return nil, err
+	}
+	quote := &Quote{
+		ToolID:             tool.ID,
+		PricingMode:        string(tool.Pricing()),
+		Days:               bookingDays(start, end),
+		Price:              price,
+		CancellationPolicy: string(tool.Cancellation()),
+	}
+	if tool.Cancellation() == db.CancellationStrict {
+		quote.CancellationWindow = int64(a.cancelWindow.Seconds())
+		quote.CancellationPenalty = a.lateCancellationFee(price)
+	}
+	switch tool.Pricing() {
+	case db.PricingFixed:
+		quote.CostPerDay = &tool.Cost
+	case db.PricingPayWhatYouWant:
+		quote.SuggestedAmount = &tool.SuggestedAmount
+	}
+	if transport != nil {
+		option := transportOption(tool, int64(*transport))
+		if option == nil {
+			return nil, ErrInvalidTransportOption.WithErr(fmt.Errorf("tool %d does not offer transport option %d", tool.ID, *transport))
+		}
+		quote.Transport = option.ID
+		quote.DeliveryFee = option.DeliveryFee
+	}
+	return quote, nil
+}
@@ -0,0 +1,329 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// recoveryApprovals is the number of distinct admins that must approve a recovery.
+	recoveryApprovals = 2
+	// recoveryRequestsPerDay is the maximum number of recovery requests per user in 24 hours.
+	recoveryRequestsPerDay = 3
+	// recoveryCodeExpiration is the time the user has to complete an approved recovery.
+	recoveryCodeExpiration = 72 * time.Hour
+)
+
+// recoveryRequestHandler handles POST /recovery
+// It creates an account recovery request to re-bind the account to a new email. The response
+// is always the same, not revealing whether the email is registered, the new one taken or the
+// user limited, so those requests are only logged. The old address is always warned.
+func (a *API) recoveryRequestHandler(r *Request) (interface{}, error) {
+	if !a.adminRecovery {
+		return nil, ErrAccountRecoveryDisabled
+	}
+	var req AccountRecoveryRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	req.NewEmail = strings.TrimSpace(req.NewEmail)
+	if req.Email == "" || req.NewEmail == "" || strings.TrimSpace(req.Message) == "" {
+		return nil, ErrInvalidRecoveryRequest.WithErr(fmt.Errorf("missing fields"))
+	}
+
+	ctx := r.Context.Request.Context()
+	user, err := a.database.UserService.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		log.Debug().Msgf("account recovery requested for unknown email %q", req.Email)
+		return nil, nil
+	}
+	if _, err := a.database.UserService.GetUserByEmail(ctx, req.NewEmail); err == nil {
+		log.Info().Msgf("account recovery of user %s refused, email %q is taken", user.ID.Hex(), req.NewEmail)
+		return nil, nil
+	}
+	recent, err := a.database.RecoveryService.CountRecentRecoveries(ctx, user.ID, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	open, err := a.database.RecoveryService.HasOpenRecovery(ctx, user.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if recent >= recoveryRequestsPerDay || open {
+		log.Warn().Msgf("account recovery of user %s refused, %d requests in a day (open: %t)", user.ID.Hex(), recent, open)
+		return nil, nil
+	}
+
+	recovery := &db.AccountRecovery{
+		UserID:    user.ID,
+		Community: user.Community,
+		OldEmail:  user.Email,
+		NewEmail:  req.NewEmail,
+		Message:   req.Message,
+	}
+	if _, err := a.database.RecoveryService.InsertRecovery(ctx, recovery); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	log.Info().Msgf("account recovery %s requested for user %s", recovery.ID.Hex(), user.ID.Hex())
+
+	a.sendMail(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Account recovery requested",
+		Body: fmt.Sprintf("A request to move your %s account to the email %s has been sent "+
+			"to your community admins. If you did not request it, contact them as soon as possible.",
+			a.branding.AppName, req.NewEmail),
+	})
+	admins, err := a.communityAdmins(ctx, user.Community)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not get the admins of community %q", user.Community)
+	}
+	for _, admin := range admins {
+		if admin.ID == user.ID {
+			continue
+		}
+		a.notify(ctx, &db.Notification{
+			UserID:  admin.ID,
+			Type:    db.NotificationAccountRecovery,
+			Message: fmt.Sprintf("%s requested to recover the account %s", req.NewEmail, user.Email),
+		})
+	}
+	return nil, nil
+}
+
+// recoveryCompleteHandler handles POST /recovery/{id}/complete
+// It re-binds the account to the new email of an approved recovery and sets a new password,
+// using the one time code delivered by the admins.
+func (a *API) recoveryCompleteHandler(r *Request) (interface{}, error) {
+	if !a.adminRecovery {
+		return nil, ErrAccountRecoveryDisabled
+	}
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r.Context.Request, "id"))
+	if err != nil {
+		return nil, ErrRecoveryNotFound.WithErr(err)
+	}
+	var req AccountRecoveryComplete
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if req.Code == "" || req.Password == "" {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing code or password"))
+	}
+
+	ctx := r.Context.Request.Context()
+	recovery, err := a.database.RecoveryService.GetRecovery(ctx, id)
+	if err != nil {
+		return nil, ErrRecoveryNotFound.WithErr(err)
+	}
+	if _, err := a.database.UserService.GetUserByEmail(ctx, recovery.NewEmail); err == nil {
+		return nil, ErrEmailAlreadyRegistered.WithErr(fmt.Errorf("email %q is taken", recovery.NewEmail))
+	}
+	if err := a.checkPassword(req.Password, recovery.NewEmail, recovery.OldEmail); err != nil {
+		return nil, err
+	}
+	hash, err := a.hashPassword(req.Password)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if err := a.database.RecoveryService.CompleteRecovery(ctx, id, hashRecoveryCode(req.Code)); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalidRecoveryCode.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if _, err := a.database.UserService.UpdateUser(ctx, recovery.UserID, bson.M{
+		"email":    recovery.NewEmail,
+		"password": hash,
+	}); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	log.Info().Msgf("account recovery %s completed for user %s", id.Hex(), recovery.UserID.Hex())
+	a.audit(r, &db.AuditEntry{
+		ActorID:    recovery.UserID,
+		Action:     db.AuditAccountRecovered,
+		TargetType: "user",
+		TargetID:   recovery.UserID.Hex(),
+		Details:    fmt.Sprintf("recovery %s, new email and password", id.Hex()),
+	})
+
+	a.sendMail(ctx, &mail.Message{
+		To:      recovery.OldEmail,
+		Subject: "Account email changed",
+		Body: fmt.Sprintf("Your %s account has been recovered with the approval of your community "+
+			"admins and is now bound to the email %s. This address can no longer be used to log in.",
+			a.branding.AppName, recovery.NewEmail),
+	})
+
+	// The sessions opened before the recovery, maybe by someone else, are closed
+	if err := a.database.SessionService.DeleteUserSessions(ctx, recovery.UserID); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	user, err := a.database.UserService.GetUserByID(ctx, recovery.UserID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	token, err := a.startSession(r, user, false)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// adminRecoveriesHandler handles GET /admin/recoveries
+// It returns the pending recoveries of the admin community (all of them for admins without one).
+func (a *API) adminRecoveriesHandler(r *Request) (interface{}, error) {
+	if !a.adminRecovery {
+		return nil, ErrAccountRecoveryDisabled
+	}
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(policy.AdminAccess, subject, policy.Resource{}); err != nil {
+		return nil, err
+	}
+	recoveries, err := a.database.RecoveryService.GetPendingRecoveries(r.Context.Request.Context(), subject.Community)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := []*AccountRecovery{}
+	for _, recovery := range recoveries {
+		result = append(result, new(AccountRecovery).FromDBAccountRecovery(recovery))
+	}
+	return &AccountRecoveriesWrapper{Recoveries: result}, nil
+}
+
+// approveRecoveryHandler handles POST /admin/recoveries/{id}/approve
+// When the last required approval is given, the one time code to complete the recovery is
+// returned to the approving admin.
+func (a *API) approveRecoveryHandler(r *Request) (interface{}, error) {
+	recovery, subject, err := a.authorizedRecoveryFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	code, err := newRecoveryCode()
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+
+	ctx := r.Context.Request.Context()
+	updated, err := a.database.RecoveryService.AddApproval(ctx, recovery.ID, subject.ID,
+		recoveryApprovals, hashRecoveryCode(code), recoveryCodeExpiration)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrRecoveryNotPending.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	log.Info().Msgf("account recovery %s approved by admin %s", recovery.ID.Hex(), subject.ID.Hex())
+	a.audit(r, &db.AuditEntry{
+		Action:     db.AuditRecoveryApprove,
+		TargetType: "user",
+		TargetID:   recovery.UserID.Hex(),
+		Details:    fmt.Sprintf("recovery %s, status %s", recovery.ID.Hex(), updated.Status),
+	})
+
+	response := new(AccountRecovery).FromDBAccountRecovery(updated)
+	if updated.Status == db.RecoveryStatusApproved {
+		response.Code = code
+	}
+	return response, nil
+}
+
+// rejectRecoveryHandler handles POST /admin/recoveries/{id}/reject
+func (a *API) rejectRecoveryHandler(r *Request) (interface{}, error) {
+	recovery, subject, err := a.authorizedRecoveryFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	if err := a.database.RecoveryService.RejectRecovery(ctx, recovery.ID, subject.ID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrRecoveryNotPending.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	log.Info().Msgf("account recovery %s rejected by admin %s", recovery.ID.Hex(), subject.ID.Hex())
+	a.audit(r, &db.AuditEntry{
+		Action:     db.AuditRecoveryReject,
+		TargetType: "user",
+		TargetID:   recovery.UserID.Hex(),
+		Details:    fmt.Sprintf("recovery %s", recovery.ID.Hex()),
+	})
+
+	a.sendMail(ctx, &mail.Message{
+		To:      recovery.OldEmail,
+		Subject: "Account recovery rejected",
+		Body: fmt.Sprintf("The request to move your %s account to the email %s has been "+
+			"rejected by your community admins.", a.branding.AppName, recovery.NewEmail),
+	})
+	return nil, nil
+}
+
+// authorizedRecoveryFromRequest returns the recovery of the {id} URL parameter if the user
+// is allowed to approve it, together with the user policy subject.
+func (a *API) authorizedRecoveryFromRequest(r *Request) (*db.AccountRecovery, policy.Subject, error) {
+	if !a.adminRecovery {
+		return nil, policy.Subject{}, ErrAccountRecoveryDisabled
+	}
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, policy.Subject{}, err
+	}
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r.Context.Request, "id"))
+	if err != nil {
+		return nil, policy.Subject{}, ErrRecoveryNotFound.WithErr(err)
+	}
+	recovery, err := a.database.RecoveryService.GetRecovery(r.Context.Request.Context(), id)
+	if err != nil {
+		return nil, policy.Subject{}, ErrRecoveryNotFound.WithErr(err)
+	}
+	resource := policy.Resource{OwnerID: recovery.UserID, Community: recovery.Community}
+	if err := authorize(policy.RecoveryApprove, subject, resource); err != nil {
+		return nil, policy.Subject{}, err
+	}
+	return recovery, subject, nil
+}
+
+// sendMail sends an email to the user. Errors are logged but not returned. The notifications are
+// mailed by notify according to the preferences of the user, sendMail is only called directly
+// for the account security emails, which cannot be disabled, and for the digests, which have
+// their own settings.
+func (a *API) sendMail(ctx context.Context, msg *mail.Message) {
+	if err := a.branding.Apply(msg); err != nil {
+		log.Error().Err(err).Msgf("could not brand the email to %s", msg.To)
+	}
+	if err := a.mailer.Send(ctx, msg); err != nil {
+		log.Error().Err(err).Msgf("could not send email to %s", msg.To)
+	}
+}
+
+// newRecoveryCode returns a random one time code to complete a recovery.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashRecoveryCode returns the hash of a recovery code as stored in the database.
+func hashRecoveryCode(code string) []byte {
+	h := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	return h[:]
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// reminderRecipient is a party of a booking receiving a reminder.
+type reminderRecipient struct {
+	userID  primitive.ObjectID
+	message string
+}
+
+// sendBookingReminders sends the due pickup, return and rating reminders. Each reminder is
+// recorded before being sent, so it is sent at most once per booking.
+func (a *API) sendBookingReminders(ctx context.Context) error {
+	now := time.Now()
+	for _, reminder := range []db.BookingReminder{
+		db.BookingReminderPickup,
+		db.BookingReminderReturn,
+		db.BookingReminderRating,
+	} {
+		bookings, err := a.database.BookingService.GetDueReminders(ctx, reminder, now)
+		if err != nil {
+			return fmt.Errorf("could not get due %s reminders: %w", reminder, err)
+		}
+		for _, booking := range bookings {
+			claimed, err := a.database.BookingService.MarkReminderSent(ctx, booking.ID, reminder)
+			if err != nil {
+				log.Error().Err(err).Msgf("could not mark %s reminder of booking %s", reminder, booking.ID.Hex())
+				continue
+			}
+			if !claimed {
+				continue
+			}
+			for _, recipient := range a.reminderRecipients(ctx, reminder, booking) {
+				a.remind(ctx, reminder, recipient, booking)
+			}
+		}
+	}
+	return nil
+}
+
+// reminderRecipients returns the parties of the booking to remind and their message.
+func (a *API) reminderRecipients(ctx context.Context, reminder db.BookingReminder, booking *db.Booking) []reminderRecipient {
+	title := a.bookingToolTitle(ctx, booking)
+	switch reminder {
+	case db.BookingReminderPickup:
+		return []reminderRecipient{
+			{booking.FromUserID, fmt.Sprintf("Your booking of %s starts tomorrow, remember to pick it up", title)},
+			{booking.ToUserID, fmt.Sprintf("Your tool %s will be picked up tomorrow", title)},
+		}
+	case db.BookingReminderReturn:
+		return []reminderRecipient{
+			{booking.FromUserID, fmt.Sprintf("Your booking of %s ends today, remember to return it", title)},
+			{booking.ToUserID, fmt.Sprintf("Your tool %s should be returned today", title)},
+		}
+	case db.BookingReminderRating:
+		return []reminderRecipient{
+			{booking.FromUserID, fmt.Sprintf("How was your experience with %s? Rate the booking", title)},
+			{booking.ToUserID, fmt.Sprintf("How was the loan of your tool %s? Rate the booking", title)},
+		}
+	}
+	return nil
+}
+
+// remind sends the reminder to the user. The rating reminders have their own type, so they can
+// be disabled independently of the pickup and return reminders.
+func (a *API) remind(ctx context.Context, reminder db.BookingReminder, recipient reminderRecipient, booking *db.Booking) {
+	notificationType := db.NotificationBookingReminder
+	if reminder == db.BookingReminderRating {
+		notificationType = db.NotificationRatingReminder
+	}
+	a.notify(ctx, &db.Notification{
+		UserID:    recipient.userID,
+		Type:      notificationType,
+		Message:   recipient.message,
+		BookingID: booking.ID,
+	})
+}
+
+// bookingToolTitle returns the title of the booked tool, or a generic name if it no longer exists.
+func (a *API) bookingToolTitle(ctx context.Context, booking *db.Booking) string {
+	id, err := strconv.ParseInt(booking.ToolID, 10, 64)
+	if err != nil {
+		return "the tool"
+	}
+	tool, err := a.database.ToolService.GetToolByID(ctx, id)
+	if err != nil || tool == nil {
+		return "the tool"
+	}
+	return tool.Title
+}
+
+// expirePendingBookings expires the booking requests left unanswered for too long or whose
+// start date has passed, notifying both parties.
+func (a *API) expirePendingBookings(ctx context.Context) error {
+	expired, err := a.database.BookingService.ExpirePendingBookings(ctx, time.Now(), a.pendingBookingTTL)
+	if err != nil {
+		return err
+	}
+	for _, booking := range expired {
+		log.Info().Msgf("booking %s expired without an answer", booking.ID.Hex())
+		title := a.bookingToolTitle(ctx, booking)
+		for _, recipient := range []reminderRecipient{
+			{booking.FromUserID, fmt.Sprintf("Your booking request for %s expired without an answer", title)},
+			{booking.ToUserID, fmt.Sprintf("A booking request for your tool %s expired without an answer", title)},
+		} {
+			a.notify(ctx, &db.Notification{
+				UserID:    recipient.userID,
+				Type:      db.NotificationBookingExpired,
+				Message:   recipient.message,
+				BookingID: booking.ID,
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxSavedSearchesPerUser is the maximum number of saved searches a user can have.
+const maxSavedSearchesPerUser = 20
+
+// addSavedSearchHandler handles POST /profile/searches
+// The search is centered on the location of the user at the time it is saved.
+func (a *API) addSavedSearchHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	var req SavedSearchRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if req.Distance < 0 {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid distance value: %d", req.Distance))
+	}
+	searchTerm := db.SanitizeString(req.SearchTerm)
+	if searchTerm == "" && len(req.Categories) == 0 && req.Distance == 0 &&
+		(req.MaxCost == nil || *req.MaxCost == 0) && req.MayBeFree == nil && len(req.TransportOptions) == 0 {
+		return nil, ErrEmptySavedSearch.WithErr(fmt.Errorf("no filters defined"))
+	}
+	for _, c := range req.Categories {
+		if !a.validToolCategory(c) {
+			return nil, ErrInvalidToolCategory.WithErr(fmt.Errorf("category %d is not valid", c))
+		}
+	}
+
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	count, err := a.database.SavedSearchService.CountUserSavedSearches(ctx, user.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if count >= maxSavedSearchesPerUser {
+		return nil, ErrTooManySavedSearches.WithErr(fmt.Errorf("user %s has %d saved searches", user.ID.Hex(), count))
+	}
+
+	search := &db.SavedSearch{
+		UserID:           user.ID,
+		SearchTerm:       searchTerm,
+		Categories:       req.Categories,
+		Distance:         a.limitSearchRadius(req.Distance),
+		MaxCost:          req.MaxCost,
+		MayBeFree:        req.MayBeFree,
+		TransportOptions: req.TransportOptions,
+		Location:         user.Location,
+	}
+	if _, err := a.database.SavedSearchService.InsertSavedSearch(ctx, search); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	return new(SavedSearch).FromDBSavedSearch(search), nil
+}
+
+// savedSearchesHandler handles GET /profile/searches
+func (a *API) savedSearchesHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	searches, err := a.database.SavedSearchService.GetUserSavedSearches(r.Context.Request.Context(), userID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := &SavedSearchesWrapper{Searches: []*SavedSearch{}}
+	for _, s := range searches {
+		result.Searches = append(result.Searches, new(SavedSearch).FromDBSavedSearch(s))
+	}
+	return result, nil
+}
+
+// deleteSavedSearchHandler handles DELETE /profile/searches/{id}
+func (a *API) deleteSavedSearchHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	idParam := r.Context.URLParam("id")
+	if idParam == nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing saved search id"))
+	}
+	id, err := primitive.ObjectIDFromHex(idParam[0])
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if err := a.database.SavedSearchService.DeleteSavedSearch(r.Context.Request.Context(), userID, id); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSavedSearchNotFound.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// notifySavedSearches notifies the owners of the saved searches matching a newly
+// published or updated tool. Each saved search is notified at most once per tool.
+func (a *API) notifySavedSearches(tool *db.Tool) {
+	ctx := context.Background()
+	categories := a.categoryTree().Ancestors(tool.ToolCategory)
+	matches, err := a.database.SavedSearchService.FindMatches(ctx, tool, categories)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not match saved searches for tool %d", tool.ID)
+		return
+	}
+	for _, search := range matches {
+		if !a.canViewTool(ctx, search.UserID, tool) {
+			continue
+		}
+		if err := a.database.SavedSearchService.MarkNotified(ctx, search.ID, tool.ID); err != nil {
+			log.Error().Err(err).Msgf("could not mark saved search %s as notified", search.ID.Hex())
+			continue
+		}
+		a.notify(ctx, &db.Notification{
+			UserID:  search.UserID,
+			Type:    db.NotificationSavedSearchMatch,
+			Message: fmt.Sprintf("A new tool matches your saved search: %s", tool.Title),
+			ToolID:  tool.ID,
+		})
+	}
+}
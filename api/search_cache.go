@@ -0,0 +1,205 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/geohash"
+)
+
+const (
+	// searchCacheTTL is the time a cached search result is considered valid.
+	searchCacheTTL = 30 * time.Second
+	// searchCacheMaxEntries is the maximum number of cached search results.
+	searchCacheMaxEntries = 1024
+	// searchCacheKeyPrecision is the geohash precision used to normalize the search
+	// location on the cache key (~38x19 meters).
+	searchCacheKeyPrecision = 8
+	// searchCacheCellPrecision is the geohash precision of the cells covered by a
+	// cached search, used for invalidation (~39x19 kilometers).
+	searchCacheCellPrecision = 4
+	// searchCacheMaxCells is the maximum number of cells tracked per cached search.
+	// Searches covering more cells are invalidated by any tool write.
+	searchCacheMaxCells = 64
+	// metersInDegree is the approximate length of a latitude degree.
+	metersInDegree = 111000.0
+)
+
+// searchCacheEntry is a cached first page of search results.
+type searchCacheEntry struct {
+	result  *ToolSearchResponse
+	expires time.Time
+	cells   map[string]bool
+	global  bool
+}
+
+// searchCache caches the first page (and total count) of tool searches keyed by the
+// normalized filter combination. Entries expire after a short TTL and are invalidated
+// when a tool is written inside one of the geohash cells covered by the search.
+type searchCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*searchCacheEntry
+}
+
+// newSearchCache creates a new search cache with the given TTL.
+func newSearchCache(ttl time.Duration) *searchCache {
+	return &searchCache{
+		ttl:     ttl,
+		entries: make(map[string]*searchCacheEntry),
+	}
+}
+
+// searchCacheKey returns the normalized cache key of a search by a member of the community,
+// which finds the tools restricted to it. It returns an empty string if the search is not
+// cacheable (only first pages are cached).
+func searchCacheKey(query *ToolSearch, location *Location, community string) string {
+	if query.Page != 0 {
+		return ""
+	}
+	categories := slices.Clone(query.Categories)
+	slices.Sort(categories)
+	categories = slices.Compact(categories)
+	transports := slices.Clone(query.TransportOptions)
+	slices.Sort(transports)
+	transports = slices.Compact(transports)
+	conditions := slices.Clone(query.Conditions)
+	slices.Sort(conditions)
+	conditions = slices.Compact(conditions)
+	powerTypes := slices.Clone(query.PowerTypes)
+	slices.Sort(powerTypes)
+	powerTypes = slices.Compact(powerTypes)
+	fields := slices.Clone(query.Fields)
+	slices.Sort(fields)
+	maxCost := "-"
+	if query.MaxCost != nil && *query.MaxCost > 0 {
+		maxCost = fmt.Sprintf("%d", *query.MaxCost)
+	}
+	mayBeFree := "-"
+	if query.MayBeFree != nil {
+		mayBeFree = fmt.Sprintf("%t", *query.MayBeFree)
+	}
+	lat, lon := location.degrees()
+	return strings.Join([]string{
+		geohash.Encode(lat, lon, searchCacheKeyPrecision),
+		strings.ToLower(strings.TrimSpace(query.SearchTerm)),
+		fmt.Sprint(categories),
+		fmt.Sprint(transports),
+		fmt.Sprintf("%t", query.Delivery),
+		fmt.Sprint(conditions),
+		fmt.Sprint(powerTypes),
+		strings.ToLower(strings.TrimSpace(query.Brand)),
+		fmt.Sprint(query.MaxWeight, query.MaxHeight, query.MaxWidth, query.MaxLength),
+		maxCost,
+		mayBeFree,
+		fmt.Sprintf("%d", query.Distance),
+		query.Sort,
+		strings.Join(fields, ","),
+		fmt.Sprintf("%d", db.PageSize(query.PageSize)),
+		community,
+	}, "|")
+}
+
+// get returns the cached result for the key, if any and not expired.
+func (c *searchCache) get(key string) (*ToolSearchResponse, bool) {
+	if c == nil || key == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.result, true
+}
+
+// set stores the result of a search, tracking the geohash cells covered by the search circle.
+func (c *searchCache) set(key string, query *ToolSearch, location *Location, result *ToolSearchResponse) {
+	if c == nil || key == "" {
+		return
+	}
+	entry := &searchCacheEntry{
+		result:  result,
+		expires: time.Now().Add(c.ttl),
+		global:  true,
+	}
+	if query.Distance > 0 {
+		lat, lon := location.degrees()
+		dLat := float64(query.Distance) / metersInDegree
+		dLon := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+		cells, ok := geohash.Cover(lat-dLat, lon-dLon, lat+dLat, lon+dLon,
+			searchCacheCellPrecision, searchCacheMaxCells)
+		if ok {
+			entry.global = false
+			entry.cells = make(map[string]bool, len(cells))
+			for _, cell := range cells {
+				entry.cells[cell] = true
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= searchCacheMaxEntries {
+		c.evictExpired()
+	}
+	if len(c.entries) >= searchCacheMaxEntries {
+		// Still full, drop everything rather than tracking usage
+		c.entries = make(map[string]*searchCacheEntry)
+	}
+	c.entries[key] = entry
+}
+
+// invalidate removes the cached searches that may include a tool at the given locations.
+func (c *searchCache) invalidate(locations ...db.DBLocation) {
+	if c == nil {
+		return
+	}
+	cells := make([]string, 0, len(locations))
+	for _, l := range locations {
+		if len(l.Coordinates) != 2 {
+			continue
+		}
+		cells = append(cells, geohash.Encode(l.Coordinates[1], l.Coordinates[0], searchCacheCellPrecision))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if entry.global {
+			delete(c.entries, key)
+			continue
+		}
+		for _, cell := range cells {
+			if entry.cells[cell] {
+				delete(c.entries, key)
+				break
+			}
+		}
+	}
+}
+
+// evictExpired removes the expired entries. The caller must hold the lock.
+func (c *searchCache) evictExpired() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// degrees returns the location latitude and longitude in degrees.
+func (l *Location) degrees() (latitude, longitude float64) {
+	return float64(l.Latitude) / 1e6, float64(l.Longitude) / 1e6
+}
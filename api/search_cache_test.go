@@ -0,0 +1,82 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+func TestSearchCacheKey(t *testing.T) {
+	c := qt.New(t)
+	location := &Location{Latitude: 41695384, Longitude: 2492793}
+
+	// Filter order, duplicates and term case are normalized
+	key1 := searchCacheKey(&ToolSearch{
+		SearchTerm: "Drill",
+		Categories: []int{2, 1, 2},
+		Distance:   10000,
+	}, location, "")
+	key2 := searchCacheKey(&ToolSearch{
+		SearchTerm: "drill ",
+		Categories: []int{1, 2},
+		Distance:   10000,
+	}, location, "")
+	c.Assert(key1, qt.Equals, key2)
+
+	// Different filters produce different keys
+	key3 := searchCacheKey(&ToolSearch{SearchTerm: "drill", Categories: []int{1}, Distance: 10000}, location, "")
+	c.Assert(key3, qt.Not(qt.Equals), key1)
+	key4 := searchCacheKey(&ToolSearch{
+		SearchTerm: "drill",
+		Categories: []int{1, 2},
+		Distance:   10000,
+		Sort:       ToolSearchSortRating,
+	}, location, "")
+	c.Assert(key4, qt.Not(qt.Equals), key1)
+	// The members of a community also find the tools restricted to it
+	key5 := searchCacheKey(&ToolSearch{SearchTerm: "drill", Categories: []int{1, 2}, Distance: 10000}, location, "valley")
+	c.Assert(key5, qt.Not(qt.Equals), key1)
+
+	// Only the first page is cacheable
+	c.Assert(searchCacheKey(&ToolSearch{Page: 1}, location, ""), qt.Equals, "")
+}
+
+func TestSearchCacheInvalidation(t *testing.T) {
+	c := qt.New(t)
+	cache := newSearchCache(time.Minute)
+	center := &Location{Latitude: 41695384, Longitude: 2492793}
+	result := &ToolSearchResponse{Total: 1}
+
+	local := &ToolSearch{Distance: 5000}
+	localKey := searchCacheKey(local, center, "")
+	cache.set(localKey, local, center, result)
+
+	unbounded := &ToolSearch{}
+	unboundedKey := searchCacheKey(unbounded, center, "")
+	cache.set(unboundedKey, unbounded, center, result)
+
+	cached, ok := cache.get(localKey)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(cached, qt.Equals, result)
+
+	// A write far away only invalidates the unbounded search
+	cache.invalidate(db.NewLocation(48856614, 2352222)) // Paris
+	_, ok = cache.get(localKey)
+	c.Assert(ok, qt.IsTrue)
+	_, ok = cache.get(unboundedKey)
+	c.Assert(ok, qt.IsFalse)
+
+	// A write nearby invalidates the local search
+	cache.invalidate(db.NewLocation(41705384, 2492793))
+	_, ok = cache.get(localKey)
+	c.Assert(ok, qt.IsFalse)
+
+	// Entries expire
+	expiring := newSearchCache(-time.Second)
+	expiring.set(localKey, local, center, result)
+	_, ok = expiring.get(localKey)
+	c.Assert(ok, qt.IsFalse)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+var (
+	// searchFacetPrices are the lower boundaries of the price ranges of the search facets, in
+	// tokens per day.
+	searchFacetPrices = []int64{0, 1, 10, 25, 50, 100}
+	// searchFacetDistances are the lower boundaries of the distance ranges of the search
+	// facets, in meters.
+	searchFacetDistances = []int64{0, 1000, 5000, 10000, 25000, 50000}
+)
+
+// toolSearchFacetsHandler handles GET /tools/search/facets
+// It takes the same filters as the tool search and returns the number of matching tools by
+// category, price, distance and availability.
+func (a *API) toolSearchFacetsHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized
+	}
+	query, err := parseToolSearch(r.Context)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, ErrUserNotFound.WithErr(err)
+	}
+	ctx, cancel := context.WithTimeout(r.Context.Request.Context(), time.Second*15)
+	defer cancel()
+	viewer, err := a.toolViewer(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	query.Distance = a.limitSearchRadius(query.Distance)
+	location := new(Location).FromDBLocation(user.Location)
+	searchLocation := db.NewLocation(location.Latitude, location.Longitude)
+	distances := distanceBands(query.Distance)
+	opts := a.searchToolsOptions(query, &searchLocation, viewer)
+	facets, err := a.database.ToolService.SearchToolFacets(ctx, opts, searchFacetPrices, distances)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+
+	response := &ToolSearchFacets{
+		Total:         facets.Total,
+		Categories:    make([]*CategoryFacet, len(facets.Categories)),
+		Prices:        rangeFacets(facets.Prices),
+		Distances:     rangeFacets(facets.Distances),
+		Available:     facets.Available,
+		InMaintenance: facets.InMaintenance,
+	}
+	for i, c := range facets.Categories {
+		response.Categories[i] = &CategoryFacet{ID: c.ID, Count: c.Count}
+	}
+	return response, nil
+}
+
+// distanceBands returns the lower boundaries of the distance ranges of the search facets
+// within the search distance, all of them if the distance is not limited.
+func distanceBands(distance int) []int64 {
+	if distance <= 0 {
+		return searchFacetDistances
+	}
+	bands := []int64{}
+	for _, band := range searchFacetDistances {
+		if band < int64(distance) {
+			bands = append(bands, band)
+		}
+	}
+	return bands
+}
+
+// rangeFacets converts the buckets to ranges ending at the next bucket.
+func rangeFacets(buckets []*db.FacetBucket) []*RangeFacet {
+	ranges := make([]*RangeFacet, len(buckets))
+	for i, b := range buckets {
+		ranges[i] = &RangeFacet{Min: b.Min, Count: b.Count}
+		if i+1 < len(buckets) {
+			ranges[i].Max = &buckets[i+1].Min
+		}
+	}
+	return ranges
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/emprius/emprius-app-backend/db"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDistanceBands(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(distanceBands(0), qt.DeepEquals, searchFacetDistances)
+	c.Assert(distanceBands(7000), qt.DeepEquals, []int64{0, 1000, 5000})
+	c.Assert(distanceBands(1000), qt.DeepEquals, []int64{0})
+}
+
+func TestRangeFacets(t *testing.T) {
+	c := qt.New(t)
+
+	ranges := rangeFacets([]*db.FacetBucket{{Min: 0, Count: 2}, {Min: 10, Count: 0}, {Min: 25, Count: 3}})
+	c.Assert(ranges, qt.HasLen, 3)
+	c.Assert(*ranges[0], qt.DeepEquals, RangeFacet{Min: 0, Max: &[]int64{10}[0], Count: 2})
+	c.Assert(*ranges[1].Max, qt.Equals, int64(25))
+	c.Assert(ranges[2].Max, qt.IsNil)
+	c.Assert(ranges[2].Count, qt.Equals, int64(3))
+	c.Assert(rangeFacets(nil), qt.HasLen, 0)
+}
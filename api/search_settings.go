@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseLocation parses a "latitude,longitude" location in degrees, i.e. "41.695384,2.492793".
+func ParseLocation(s string) (*Location, error) {
+	latStr, lonStr, found := strings.Cut(s, ",")
+	if !found {
+		return nil, fmt.Errorf("invalid location %q, expected latitude,longitude", s)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("invalid latitude %q", latStr)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("invalid longitude %q", lonStr)
+	}
+	return &Location{Latitude: int64(math.Round(lat * 1e6)), Longitude: int64(math.Round(lon * 1e6))}, nil
+}
+
+// limitSearchRadius returns the radius of a search with the given distance in meters: the
+// default radius if none is given, and at most the maximum radius. Zero is not limited.
+func (a *API) limitSearchRadius(distance int) int {
+	if distance <= 0 {
+		distance = a.searchRadius
+	}
+	if a.maxSearchRadius > 0 && (distance <= 0 || distance > a.maxSearchRadius) {
+		distance = a.maxSearchRadius
+	}
+	return distance
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParseLocation(t *testing.T) {
+	c := qt.New(t)
+
+	location, err := ParseLocation("41.695384, 2.492793")
+	c.Assert(err, qt.IsNil)
+	c.Assert(*location, qt.Equals, Location{Latitude: 41695384, Longitude: 2492793})
+	location, err = ParseLocation("-33.8688,151.2093")
+	c.Assert(err, qt.IsNil)
+	c.Assert(*location, qt.Equals, Location{Latitude: -33868800, Longitude: 151209300})
+
+	for _, s := range []string{"", "41.69", "91,2", "41,181", "north,east"} {
+		_, err := ParseLocation(s)
+		c.Assert(err, qt.IsNotNil, qt.Commentf("location %q", s))
+	}
+}
+
+func TestLimitSearchRadius(t *testing.T) {
+	c := qt.New(t)
+
+	// Not limited by default
+	a := New("secret", "token", nil, nil)
+	c.Assert(a.limitSearchRadius(0), qt.Equals, 0)
+	c.Assert(a.limitSearchRadius(500000), qt.Equals, 500000)
+
+	a = New("secret", "token", nil, &Options{DefaultSearchRadius: 10000, MaxSearchRadius: 50000})
+	c.Assert(a.limitSearchRadius(0), qt.Equals, 10000)
+	c.Assert(a.limitSearchRadius(20000), qt.Equals, 20000)
+	c.Assert(a.limitSearchRadius(500000), qt.Equals, 50000)
+
+	// Without default radius the searches without distance get the maximum radius
+	a = New("secret", "token", nil, &Options{MaxSearchRadius: 50000})
+	c.Assert(a.limitSearchRadius(0), qt.Equals, 50000)
+
+	// The default radius is at most the maximum
+	a = New("secret", "token", nil, &Options{DefaultSearchRadius: 100000, MaxSearchRadius: 50000})
+	c.Assert(a.limitSearchRadius(0), qt.Equals, 50000)
+}
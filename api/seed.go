@@ -0,0 +1,354 @@
+package api
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/password"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultSeedPassword is the password of the users generated by Seed if none is given.
+const DefaultSeedPassword = "emprius-demo"
+
+// seedRadius is the maximum distance (in degrees) of the generated users to the center of
+// their locality, around 5 km.
+const seedRadius = 0.05
+
+// SeedOptions are the options of the demo data generated by Seed.
+type SeedOptions struct {
+	Users    int
+	Tools    int
+	Bookings int
+	// Seed makes the generated data deterministic, the same seed generates the same data with
+	// the dates relative to Now.
+	Seed int64
+	// Locale selects the names, localities and tools of the generated data, one of SeedLocales.
+	Locale   string
+	Password string
+	Now      time.Time
+}
+
+// seedLocale are the names, localities and tool titles used to generate the demo data.
+type seedLocale struct {
+	FirstNames []string
+	LastNames  []string
+	Localities []seedLocality
+	Tools      []string
+}
+
+type seedLocality struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+// seedLocales are the locales of the demo data.
+var seedLocales = map[string]*seedLocale{
+	"en": {
+		FirstNames: []string{"Alice", "Ben", "Chloe", "Daniel", "Emma", "Frank", "Grace", "Harry", "Isla", "Jack"},
+		LastNames:  []string{"Smith", "Jones", "Taylor", "Brown", "Wilson", "Evans", "Walker", "Wright"},
+		Localities: []seedLocality{
+			{"Bristol", 51.4545, -2.5879},
+			{"Bath", 51.3811, -2.3590},
+			{"Stroud", 51.7457, -2.2178},
+			{"Frome", 51.2279, -2.3215},
+		},
+		Tools: []string{
+			"Cordless drill", "Lawn mower", "Ladder", "Pressure washer", "Hedge trimmer", "Wheelbarrow",
+			"Circular saw", "Tile cutter", "Cargo trailer", "Camping tent", "Chainsaw", "Sewing machine",
+		},
+	},
+	"es": {
+		FirstNames: []string{"Lucía", "Hugo", "Martina", "Pablo", "Sofía", "Álvaro", "Elena", "Javier", "Carmen", "Diego"},
+		LastNames:  []string{"García", "Fernández", "López", "Martínez", "Sánchez", "Romero", "Navarro", "Torres"},
+		Localities: []seedLocality{
+			{"Madrid", 40.4168, -3.7038},
+			{"Segovia", 40.9429, -4.1088},
+			{"Toledo", 39.8628, -4.0273},
+			{"Guadalajara", 40.6329, -3.1672},
+		},
+		Tools: []string{
+			"Taladro", "Cortacésped", "Escalera", "Hidrolimpiadora", "Cortasetos", "Carretilla",
+			"Sierra circular", "Cortadora de azulejos", "Remolque", "Tienda de campaña", "Motosierra", "Máquina de coser",
+		},
+	},
+	"ca": {
+		FirstNames: []string{"Marta", "Jordi", "Núria", "Pau", "Laia", "Arnau", "Montse", "Oriol", "Mireia", "Joan"},
+		LastNames:  []string{"Puig", "Soler", "Vila", "Ferrer", "Serra", "Roca", "Pujol", "Casals"},
+		Localities: []seedLocality{
+			{"Barcelona", 41.3874, 2.1686},
+			{"Vic", 41.9301, 2.2549},
+			{"Girona", 41.9794, 2.8214},
+			{"Manresa", 41.7252, 1.8266},
+		},
+		Tools: []string{
+			"Trepant", "Tallagespa", "Escala", "Hidronetejadora", "Tallabardisses", "Carretó",
+			"Serra circular", "Talladora de rajoles", "Remolc", "Tenda de campanya", "Motoserra", "Màquina de cosir",
+		},
+	},
+}
+
+// SeedLocales returns the locales of the demo data.
+func SeedLocales() []string {
+	locales := make([]string, 0, len(seedLocales))
+	for locale := range seedLocales {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// seedData is the generated demo data.
+type seedData struct {
+	Users    []*db.User
+	Tools    []*db.Tool
+	Bookings []*db.Booking
+}
+
+// Seed fills an empty database with demo users, tools and bookings, inserting them directly
+// in the database. All the users have the same password. The categories and transports must
+// have been initialized.
+func Seed(ctx context.Context, database *db.Database, opts SeedOptions) error {
+	for _, collection := range []string{"users", "tools", "bookings"} {
+		count, err := database.Database.Collection(collection).EstimatedDocumentCount(ctx)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("the database is not empty, %s has %d documents", collection, count)
+		}
+	}
+	categories, err := database.ToolCategoryService.GetAllToolCategories(ctx)
+	if err != nil {
+		return err
+	}
+	transports, err := database.TransportService.GetAllTransports(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := generateSeed(opts, categories, transports)
+	if err != nil {
+		return err
+	}
+
+	insert := func(collection string, docs []interface{}) error {
+		if len(docs) == 0 {
+			return nil
+		}
+		if _, err := database.Database.Collection(collection).InsertMany(ctx, docs); err != nil {
+			return fmt.Errorf("could not insert the %s: %w", collection, err)
+		}
+		return nil
+	}
+	if err := insert("users", toInterfaces(data.Users)); err != nil {
+		return err
+	}
+	if err := insert("tools", toInterfaces(data.Tools)); err != nil {
+		return err
+	}
+	return insert("bookings", toInterfaces(data.Bookings))
+}
+
+// generateSeed generates the demo data. The result only depends on the options.
+func generateSeed(opts SeedOptions, categories []*db.ToolCategory, transports []*db.Transport) (*seedData, error) {
+	locale, ok := seedLocales[opts.Locale]
+	if !ok {
+		return nil, fmt.Errorf("unknown locale %q, expected one of %v", opts.Locale, SeedLocales())
+	}
+	if opts.Users < 2 && (opts.Tools > 0 || opts.Bookings > 0) {
+		return nil, fmt.Errorf("at least 2 users are needed to generate tools and bookings")
+	}
+	if opts.Tools == 0 && opts.Bookings > 0 {
+		return nil, fmt.Errorf("at least 1 tool is needed to generate bookings")
+	}
+	if len(categories) == 0 {
+		return nil, fmt.Errorf("no tool categories")
+	}
+	if opts.Password == "" {
+		opts.Password = DefaultSeedPassword
+	}
+	rng := rand.New(rand.NewPCG(uint64(opts.Seed), uint64(opts.Seed)))
+	now := opts.Now
+	pick := func(values []string) string { return values[rng.IntN(len(values))] }
+	daysAgo := func(max int) time.Time { return now.Add(-time.Duration(rng.IntN(max)+1) * 24 * time.Hour) }
+	data := &seedData{}
+
+	// The salt of the password hash comes from the seed too, so the same seed generates the same data
+	salt := make([]byte, 16)
+	for i := range salt {
+		salt[i] = byte(rng.Uint32())
+	}
+	hash := password.DefaultArgon2.HashWithSalt(opts.Password, salt)
+	localities := make(map[primitive.ObjectID]seedLocality, opts.Users)
+	for i := 0; i < opts.Users; i++ {
+		locality := locale.Localities[rng.IntN(len(locale.Localities))]
+		user := &db.User{
+			ID:       seedObjectID(rng, daysAgo(365)),
+			Email:    fmt.Sprintf("user%d@example.com", i+1),
+			Name:     fmt.Sprintf("%s %s %d", pick(locale.FirstNames), pick(locale.LastNames), i+1),
+			Password: hash,
+			Tokens:   1000,
+			Active:   true,
+			Rating:   50,
+			Verified: true,
+			Location: seedLocation(rng, locality),
+			Locality: locality.Name,
+		}
+		localities[user.ID] = locality
+		data.Users = append(data.Users, user)
+	}
+
+	ids := make(map[int64]bool, opts.Tools)
+	for i := 0; i < opts.Tools; i++ {
+		owner := data.Users[rng.IntN(len(data.Users))]
+		base := pick(locale.Tools)
+		// The id depends on the owner and the title, so the repeated titles are numbered
+		title, id := base, toolID(owner.ID.Hex(), base)
+		for n := 2; ids[id]; n++ {
+			title = fmt.Sprintf("%s %d", base, n)
+			id = toolID(owner.ID.Hex(), title)
+		}
+		ids[id] = true
+		options := []db.Transport{}
+		for _, t := range transports {
+			if rng.IntN(3) == 0 {
+				options = append(options, db.Transport{ID: t.ID, Kind: t.Kind})
+			}
+		}
+		value := uint64(rng.IntN(50)+1) * 10
+		updatedAt := daysAgo(180)
+		data.Tools = append(data.Tools, &db.Tool{
+			ID:               id,
+			Title:            title,
+			Description:      fmt.Sprintf("%s, %s", title, localities[owner.ID].Name),
+			IsAvailable:      true,
+			MayBeFree:        rng.IntN(2) == 0,
+			AskWithFee:       rng.IntN(2) == 0,
+			Cost:             value / 50,
+			UserID:           owner.ID,
+			Images:           []db.Image{},
+			TransportOptions: options,
+			ToolCategory:     categories[rng.IntN(len(categories))].ID,
+			Location:         owner.Location,
+			Locality:         owner.Locality,
+			Rating:           50,
+			EstimatedValue:   value,
+			Dimensions: &db.Dimensions{
+				HeightCm: float64(rng.IntN(200) + 10),
+				WeightKg: float64(rng.IntN(50) + 1),
+			},
+			ReservedDates: []db.DateRange{},
+			UpdatedAt:     &updatedAt,
+		})
+	}
+
+	for i := 0; i < opts.Bookings; i++ {
+		tool := data.Tools[rng.IntN(len(data.Tools))]
+		renter := data.Users[rng.IntN(len(data.Users))]
+		for renter.ID == tool.UserID {
+			renter = data.Users[rng.IntN(len(data.Users))]
+		}
+		start := now.Add(time.Duration(rng.IntN(150)-90) * 24 * time.Hour)
+		end := start.Add(time.Duration(rng.IntN(7)+1) * 24 * time.Hour)
+		createdAt := start.Add(-time.Duration(rng.IntN(14)+1) * 24 * time.Hour)
+		if createdAt.After(now) {
+			createdAt = now
+		}
+		booking := &db.Booking{
+			ID:            seedObjectID(rng, createdAt),
+			ToolID:        strconv.FormatInt(tool.ID, 10),
+			FromUserID:    renter.ID,
+			ToUserID:      tool.UserID,
+			StartDate:     start,
+			EndDate:       end,
+			Comments:      fmt.Sprintf("%s %d", tool.Title, i+1),
+			BookingStatus: seedBookingStatus(rng, tool, start, end, now),
+			CreatedAt:     createdAt,
+			UpdatedAt:     createdAt,
+			History:       []db.BookingTransition{{To: db.BookingStatusPending, By: renter.ID, At: createdAt}},
+		}
+		if booking.BookingStatus != db.BookingStatusPending {
+			respondedAt := createdAt.Add(time.Duration(rng.IntN(48)+1) * time.Hour)
+			booking.RespondedAt = &respondedAt
+			booking.UpdatedAt = respondedAt
+			booking.History = append(booking.History, db.BookingTransition{
+				From: db.BookingStatusPending, To: booking.BookingStatus, By: tool.UserID, At: respondedAt,
+			})
+		}
+		switch booking.BookingStatus {
+		case db.BookingStatusAccepted:
+			tool.ReservedDates = append(tool.ReservedDates, db.DateRange{
+				From: uint32(start.Unix()),
+				To:   uint32(end.Unix()),
+			})
+		case db.BookingStatusReturned:
+			ownerRating, renterRating := rng.IntN(3)+3, rng.IntN(3)+3
+			booking.OwnerRating, booking.RenterRating = &ownerRating, &renterRating
+			booking.ReturnedAt = &end
+			booking.UpdatedAt = end
+			tool.RatingCount++
+			tool.RatingSum += int64(ownerRating)
+			average := float64(tool.RatingSum) / float64(tool.RatingCount)
+			tool.RatingAverage = &average
+		}
+		data.Bookings = append(data.Bookings, booking)
+	}
+	return data, nil
+}
+
+// seedBookingStatus returns a status for a booking of the tool: the past bookings were returned,
+// rejected or cancelled, and the future ones are pending or accepted if the tool is not
+// reserved for those dates.
+func seedBookingStatus(rng *rand.Rand, tool *db.Tool, start, end, now time.Time) db.BookingStatus {
+	if end.Before(now) {
+		return []db.BookingStatus{
+			db.BookingStatusReturned, db.BookingStatusReturned, db.BookingStatusReturned,
+			db.BookingStatusRejected, db.BookingStatusCancelled,
+		}[rng.IntN(5)]
+	}
+	if rng.IntN(2) == 0 {
+		return db.BookingStatusPending
+	}
+	for _, reserved := range tool.ReservedDates {
+		if int64(reserved.From) <= end.Unix() && int64(reserved.To) >= start.Unix() {
+			return db.BookingStatusPending
+		}
+	}
+	return db.BookingStatusAccepted
+}
+
+// seedObjectID returns an ObjectID with the given time and random bytes from rng, so the ids
+// are deterministic.
+func seedObjectID(rng *rand.Rand, t time.Time) primitive.ObjectID {
+	var id primitive.ObjectID
+	binary.BigEndian.PutUint32(id[0:4], uint32(t.Unix()))
+	binary.BigEndian.PutUint64(id[4:12], rng.Uint64())
+	return id
+}
+
+// seedLocation returns a random location around the center of the locality.
+func seedLocation(rng *rand.Rand, locality seedLocality) db.DBLocation {
+	angle := rng.Float64() * 2 * math.Pi
+	distance := math.Sqrt(rng.Float64()) * seedRadius
+	return db.NewLocation(
+		int64((locality.Latitude+distance*math.Sin(angle))*1e6),
+		int64((locality.Longitude+distance*math.Cos(angle))*1e6),
+	)
+}
+
+// toInterfaces returns the values as a slice of interfaces, as needed by InsertMany.
+func toInterfaces[T any](values []T) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/password"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestGenerateSeed(t *testing.T) {
+	c := qt.New(t)
+
+	categories := []*db.ToolCategory{{ID: 1, Name: "other"}, {ID: 2, Name: "transport"}}
+	transports := []*db.Transport{{ID: 1, Name: "Car"}, {ID: 2, Name: "Van"}}
+	opts := SeedOptions{
+		Users:    20,
+		Tools:    60,
+		Bookings: 200,
+		Seed:     42,
+		Locale:   "ca",
+		Now:      time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+	data, err := generateSeed(opts, categories, transports)
+	c.Assert(err, qt.IsNil)
+	c.Assert(data.Users, qt.HasLen, 20)
+	c.Assert(data.Tools, qt.HasLen, 60)
+	c.Assert(data.Bookings, qt.HasLen, 200)
+
+	// The same seed generates the same data, and another seed different data
+	again, err := generateSeed(opts, categories, transports)
+	c.Assert(err, qt.IsNil)
+	c.Assert(again, qt.DeepEquals, data)
+	opts.Seed = 43
+	other, err := generateSeed(opts, categories, transports)
+	c.Assert(err, qt.IsNil)
+	c.Assert(other.Users[0].ID, qt.Not(qt.Equals), data.Users[0].ID)
+
+	match, _ := password.DefaultArgon2.Verify(DefaultSeedPassword, data.Users[0].Password)
+	c.Assert(match, qt.IsTrue)
+	names := make(map[string]bool)
+	for _, u := range data.Users {
+		c.Assert(names[u.Name], qt.IsFalse, qt.Commentf("repeated name %s", u.Name))
+		names[u.Name] = true
+		c.Assert(u.Password, qt.DeepEquals, data.Users[0].Password)
+	}
+	tools := make(map[string]*db.Tool)
+	for _, tool := range data.Tools {
+		id := tool.UserID.Hex()
+		c.Assert(tool.ID, qt.Equals, toolID(id, tool.Title))
+		c.Assert(tools[tool.Title+id], qt.IsNil, qt.Commentf("repeated tool %s", tool.Title))
+		tools[tool.Title+id] = tool
+	}
+
+	// The accepted bookings of a tool never overlap, and nobody books its own tools
+	accepted := make(map[string][]*db.Booking)
+	for _, b := range data.Bookings {
+		c.Assert(b.FromUserID, qt.Not(qt.Equals), b.ToUserID)
+		c.Assert(b.EndDate.After(b.StartDate), qt.IsTrue)
+		c.Assert(b.CreatedAt.After(opts.Now), qt.IsFalse)
+		if b.EndDate.Before(opts.Now) {
+			c.Assert(b.BookingStatus, qt.Not(qt.Equals), db.BookingStatusAccepted)
+		}
+		if b.BookingStatus != db.BookingStatusAccepted {
+			continue
+		}
+		for _, other := range accepted[b.ToolID] {
+			overlap := !other.StartDate.After(b.EndDate) && !other.EndDate.Before(b.StartDate)
+			c.Assert(overlap, qt.IsFalse, qt.Commentf("bookings %s and %s overlap", b.ID.Hex(), other.ID.Hex()))
+		}
+		accepted[b.ToolID] = append(accepted[b.ToolID], b)
+	}
+
+	_, err = generateSeed(SeedOptions{Users: 2, Locale: "xx"}, categories, transports)
+	c.Assert(err, qt.ErrorMatches, `unknown locale "xx", expected one of \[ca en es\]`)
+	_, err = generateSeed(SeedOptions{Users: 2, Bookings: 1, Locale: "en"}, categories, transports)
+	c.Assert(err, qt.ErrorMatches, "at least 1 tool is needed to generate bookings")
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// sessionTouchInterval is the minimum time between two updates of the last use of a session.
+	sessionTouchInterval = 5 * time.Minute
+	// maxUserAgentLength is the maximum length of the user agent stored in a session.
+	maxUserAgentLength = 256
+)
+
+// startSession creates the session of a login or registration and returns its token. With
+// newLoginAlert, the user is emailed if the login comes from a device or country never used
+// in the other sessions.
+func (a *API) startSession(r *Request, user *db.User, newLoginAlert bool) (*LoginResponse, error) {
+	ctx := r.Context.Request.Context()
+	req := r.Context.Request
+	userAgent := req.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	country := ""
+	if a.countryHeader != "" {
+		country = strings.ToUpper(strings.TrimSpace(req.Header.Get(a.countryHeader)))
+	}
+	if newLoginAlert {
+		hasSessions, knownDevice, knownCountry, err := a.database.SessionService.KnownLogin(ctx, user.ID, userAgent, country)
+		if err != nil {
+			log.Error().Err(err).Msgf("could not check the sessions of user %s", user.ID.Hex())
+		} else if hasSessions && (!knownDevice || !knownCountry) {
+			a.sendNewLoginAlert(ctx, user, req, country)
+		}
+	}
+	session := &db.Session{
+		UserID:    user.ID,
+		IP:        clientIP(req.RemoteAddr),
+		UserAgent: userAgent,
+		Country:   country,
+		ExpiresAt: time.Now().Add(jwtExpiration),
+	}
+	if err := a.database.SessionService.CreateSession(ctx, session); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if err := a.database.UserService.TouchActivity(ctx, user.ID, time.Now()); err != nil {
+		log.Warn().Err(err).Msgf("could not update the activity of user %s", user.ID.Hex())
+	}
+	token, err := a.makeToken(user.ID.Hex(), session.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	token.TermsVersion = a.pendingTermsVersion(ctx, user)
+	return token, nil
+}
+
+// sendNewLoginAlert emails the user about a login from a new device or country.
+func (a *API) sendNewLoginAlert(ctx context.Context, user *db.User, req *http.Request, country string) {
+	from := clientIP(req.RemoteAddr)
+	if country != "" {
+		from += ", " + country
+	}
+	device := req.UserAgent()
+	if device == "" {
+		device = "unknown device"
+	}
+	a.sendMail(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "New login to your account",
+		Body: fmt.Sprintf("Hi %s,\n\nYour %s account was accessed from a new device or location:\n\n%s\n%s\n%s\n\n"+
+			"If it was not you, change your password and close the session from your profile.",
+			user.Name, a.branding.AppName, device, from, time.Now().UTC().Format(time.RFC1123)),
+	})
+}
+
+// checkSession returns an error if the session of a token was closed or belongs to another user.
+// The last use of the session, and the last activity of the user, are updated at most every
+// sessionTouchInterval.
+func (a *API) checkSession(req *http.Request, sessionID, userID string) *HTTPError {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return ErrUnauthorized.WithErr(err)
+	}
+	ctx := req.Context()
+	session, err := a.database.SessionService.GetSession(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		return ErrUnauthorized.WithErr(fmt.Errorf("session %s closed", sessionID))
+	}
+	if err != nil {
+		return ErrInternalServerError.WithErr(err)
+	}
+	now := time.Now()
+	if session.UserID.Hex() != userID || !session.ExpiresAt.After(now) {
+		return ErrUnauthorized.WithErr(fmt.Errorf("invalid session %s", sessionID))
+	}
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		if err := a.database.SessionService.Touch(ctx, id, clientIP(req.RemoteAddr), now); err != nil {
+			log.Warn().Err(err).Msgf("could not update session %s", sessionID)
+		}
+		if err := a.database.UserService.TouchActivity(ctx, session.UserID, now); err != nil {
+			log.Warn().Err(err).Msgf("could not update the activity of user %s", userID)
+		}
+	}
+	return nil
+}
+
+// sessionsHandler handles GET /profile/sessions
+// Returns the open sessions of the user, the most recently used first.
+func (a *API) sessionsHandler(r *Request) (interface{}, error) {
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	sessions, err := a.database.SessionService.GetUserSessions(r.Context.Request.Context(), userID, time.Now())
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := &SessionsWrapper{Sessions: []*Session{}}
+	for _, session := range sessions {
+		s := new(Session).FromDBSession(session)
+		s.Current = s.ID == r.SessionID
+		result.Sessions = append(result.Sessions, s)
+	}
+	return result, nil
+}
+
+// deleteSessionHandler handles DELETE /profile/sessions/{id}
+// Closes the session, its token is no longer accepted. Closing the current session logs out.
+func (a *API) deleteSessionHandler(r *Request) (interface{}, error) {
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r.Context.Request, "id"))
+	if err != nil {
+		return nil, ErrSessionNotFound.WithErr(err)
+	}
+	err = a.database.SessionService.DeleteSession(r.Context.Request.Context(), id, userID)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.audit(r, &db.AuditEntry{Action: db.AuditSessionClose, TargetType: "session", TargetID: id.Hex()})
+	return nil, nil
+}
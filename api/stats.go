@@ -0,0 +1,326 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// ownerTopTools is the number of most requested tools returned in the owner stats.
+	ownerTopTools = 5
+	// communityTopMembers is the number of most active members in the community stats.
+	communityTopMembers = 5
+	// communityStatsMaxAge is the time after which the stats of a community are recalculated.
+	communityStatsMaxAge = time.Hour
+	// publicStatsTTL is the time the public stats are cached.
+	publicStatsTTL = 5 * time.Minute
+	// publicStatsCacheControl lets the clients and shared caches keep the public stats
+	// as long as the server does.
+	publicStatsCacheControl = "public, max-age=300"
+)
+
+// dateRange returns the optional from and to query parameters, as UNIX timestamps.
+func dateRange(r *Request) (from, to *time.Time, err error) {
+	parse := func(key string) (*time.Time, error) {
+		param := r.Context.URLParam(key)
+		if param == nil {
+			return nil, nil
+		}
+		timestamp, err := strconv.ParseInt(param[0], 10, 64)
+		if err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid %s %q", key, param[0]))
+		}
+		t := time.Unix(timestamp, 0)
+		return &t, nil
+	}
+	if from, err = parse("from"); err != nil {
+		return nil, nil, err
+	}
+	if to, err = parse("to"); err != nil {
+		return nil, nil, err
+	}
+	if from != nil && to != nil && !to.After(*from) {
+		return nil, nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("to must be after from"))
+	}
+	return from, to, nil
+}
+
+// ownerStatsHandler handles GET /profile/stats?from=&to=
+// It returns the analytics of the booking requests received by the user for its tools,
+// created between the optional from and to UNIX timestamps.
+func (a *API) ownerStatsHandler(r *Request) (interface{}, error) {
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	from, to, err := dateRange(r)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	stats, err := a.database.BookingService.GetOwnerStats(ctx, userID, from, to)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+
+	response := &OwnerStatsResponse{
+		Requests: stats.Requests,
+		Accepted: stats.Accepted,
+		Rejected: stats.Rejected,
+		Months:   make([]*OwnerMonthStats, len(stats.Months)),
+		TopTools: []*OwnerToolStats{},
+	}
+	if from != nil {
+		unix := from.Unix()
+		response.From = &unix
+	}
+	if to != nil {
+		unix := to.Unix()
+		response.To = &unix
+	}
+	if answered := stats.Accepted + stats.Rejected; answered > 0 {
+		rate := float64(stats.Accepted) / float64(answered)
+		response.AcceptanceRate = &rate
+	}
+	for i, month := range stats.Months {
+		response.Months[i] = &OwnerMonthStats{
+			Month:    month.Month,
+			Requests: month.Requests,
+			Returned: month.Returned,
+			Rating:   month.Rating,
+			Ratings:  month.Ratings,
+		}
+	}
+
+	// The tokens earned are computed with the current cost of the tools, the bookings of
+	// deleted tools are not taken into account.
+	ids := make([]int64, 0, len(stats.Tools))
+	for _, tool := range stats.Tools {
+		if id, err := strconv.ParseInt(tool.ToolID, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	tools, err := a.database.ToolService.GetToolsByIDs(ctx, ids)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	byID := make(map[string]*db.Tool, len(tools))
+	for _, tool := range tools {
+		byID[strconv.FormatInt(tool.ID, 10)] = tool
+	}
+	for _, toolStats := range stats.Tools {
+		tool, ok := byID[toolStats.ToolID]
+		if !ok {
+			continue
+		}
+		tokens := tool.Cost * uint64(toolStats.ReturnedDays)
+		response.TokensEarned += tokens
+		if len(response.TopTools) < ownerTopTools {
+			response.TopTools = append(response.TopTools, &OwnerToolStats{
+				ToolID:       tool.ID,
+				Title:        tool.Title,
+				Requests:     toolStats.Requests,
+				TokensEarned: tokens,
+			})
+		}
+	}
+	return response, nil
+}
+
+// communityStatsHandler handles GET /communities/{id}/stats
+// Returns the stats of the community, visible to its members. The stats are recalculated
+// periodically by a background job, and on the first request if they were never computed.
+func (a *API) communityStatsHandler(r *Request) (interface{}, error) {
+	_, community, err := a.communityFromRequest(r, policy.CommunityContent)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	doc, err := a.database.CommunityService.GetCommunity(ctx, community)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	stats := doc.Stats
+	if stats == nil {
+		if stats, err = a.refreshCommunityStats(ctx, community, time.Now()); err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
+		}
+	}
+
+	response := &CommunityStatsResponse{
+		Community:         community,
+		Members:           stats.Members,
+		MemberGrowth:      stats.MemberGrowth,
+		ToolsShared:       stats.ToolsShared,
+		BookingsCompleted: stats.BookingsCompleted,
+		MostActive:        []*ActiveMember{},
+		EstimatedSavings:  stats.EstimatedSavings,
+		UpdatedAt:         stats.UpdatedAt,
+	}
+	ids := make([]primitive.ObjectID, len(stats.MostActive))
+	for i, member := range stats.MostActive {
+		ids[i] = member.UserID
+	}
+	users, err := a.database.UserService.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	names := make(map[primitive.ObjectID]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Name
+	}
+	for _, member := range stats.MostActive {
+		name, ok := names[member.UserID]
+		if !ok {
+			continue
+		}
+		response.MostActive = append(response.MostActive, &ActiveMember{
+			ID:       member.UserID.Hex(),
+			Name:     name,
+			Bookings: member.Bookings,
+		})
+	}
+	return response, nil
+}
+
+// updateCommunityStats recalculates the stats of the communities whose stats are older than
+// communityStatsMaxAge.
+func (a *API) updateCommunityStats(ctx context.Context) error {
+	communities, err := a.database.UserService.GetCommunities(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get communities: %w", err)
+	}
+	now := time.Now()
+	for _, community := range communities {
+		doc, err := a.database.CommunityService.GetCommunity(ctx, community)
+		if err != nil {
+			return fmt.Errorf("could not get community %s: %w", community, err)
+		}
+		if doc.Stats != nil && now.Sub(doc.Stats.UpdatedAt) < communityStatsMaxAge {
+			continue
+		}
+		if _, err := a.refreshCommunityStats(ctx, community, now); err != nil {
+			log.Error().Err(err).Msgf("could not update the stats of community %s", community)
+		}
+	}
+	return nil
+}
+
+// refreshCommunityStats computes and stores the stats of the community.
+func (a *API) refreshCommunityStats(ctx context.Context, community string, now time.Time) (*db.CommunityStats, error) {
+	members, err := a.database.UserService.GetCommunityMemberIDs(ctx, community)
+	if err != nil {
+		return nil, err
+	}
+	stats := &db.CommunityStats{Members: int64(len(members)), UpdatedAt: now}
+	if stats.MemberGrowth, err = a.database.UserService.GetMemberGrowth(ctx, community); err != nil {
+		return nil, err
+	}
+	if stats.ToolsShared, err = a.database.ToolService.CountCommunityTools(ctx, community, members); err != nil {
+		return nil, err
+	}
+	bookings, err := a.database.BookingService.GetCommunityBookingStats(ctx, community, members, communityTopMembers)
+	if err != nil {
+		return nil, err
+	}
+	stats.BookingsCompleted = bookings.Completed
+	stats.MostActive = bookings.Members
+	if stats.EstimatedSavings, err = a.bookedValue(ctx, bookings.Tools); err != nil {
+		return nil, err
+	}
+
+	if err := a.database.CommunityService.SetStats(ctx, community, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// bookedValue returns the sum of the estimated value of the tools of each booking. It is
+// computed with the current estimated value of the tools, the bookings of deleted tools are
+// not taken into account.
+func (a *API) bookedValue(ctx context.Context, counts []*db.ToolBookingCount) (uint64, error) {
+	ids := make([]int64, 0, len(counts))
+	for _, count := range counts {
+		if id, err := strconv.ParseInt(count.ToolID, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	tools, err := a.database.ToolService.GetToolsByIDs(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	values := make(map[string]uint64, len(tools))
+	for _, tool := range tools {
+		values[strconv.FormatInt(tool.ID, 10)] = tool.EstimatedValue
+	}
+	var total uint64
+	for _, count := range counts {
+		total += values[count.ToolID] * uint64(count.Bookings)
+	}
+	return total, nil
+}
+
+// publicStatsCache caches the public stats, computed at most once per TTL. Concurrent
+// requests wait for the running computation instead of starting their own.
+type publicStatsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	stats   *PublicStats
+	expires time.Time
+}
+
+// get returns the cached stats, computing them with compute if they expired.
+func (c *publicStatsCache) get(compute func() (*PublicStats, error)) (*PublicStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stats != nil && time.Now().Before(c.expires) {
+		return c.stats, nil
+	}
+	stats, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	c.stats, c.expires = stats, time.Now().Add(c.ttl)
+	return stats, nil
+}
+
+// publicStatsHandler handles GET /info/stats
+// Returns anonymous aggregate numbers of the platform, for public landing pages. The stats
+// are cached for publicStatsTTL.
+func (a *API) publicStatsHandler(r *Request) (interface{}, error) {
+	ctx := r.Context.Request.Context()
+	stats, err := a.publicStats.get(func() (*PublicStats, error) {
+		users, err := a.database.UserService.CountUsers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count users: %w", err)
+		}
+		tools, err := a.database.ToolService.CountTools(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count tools: %w", err)
+		}
+		counts, err := a.database.BookingService.GetReturnedBookingsByTool(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		stats := &PublicStats{Users: users, Tools: tools, UpdatedAt: time.Now()}
+		for _, count := range counts {
+			stats.CompletedBookings += count.Bookings
+		}
+		if stats.EstimatedValueShared, err = a.bookedValue(ctx, counts); err != nil {
+			return nil, err
+		}
+		return stats, nil
+	})
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &CachedResponse{Data: stats, CacheControl: publicStatsCacheControl}, nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDateRange(t *testing.T) {
+	c := qt.New(t)
+	request := func(query string) *Request {
+		return &Request{Context: &HTTPContext{Request: httptest.NewRequest(http.MethodGet, "/profile/stats"+query, nil)}}
+	}
+
+	from, to, err := dateRange(request(""))
+	c.Assert(err, qt.IsNil)
+	c.Assert(from, qt.IsNil)
+	c.Assert(to, qt.IsNil)
+
+	from, to, err = dateRange(request("?from=1700000000&to=1710000000"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(from.Equal(time.Unix(1700000000, 0)), qt.IsTrue)
+	c.Assert(to.Equal(time.Unix(1710000000, 0)), qt.IsTrue)
+
+	_, _, err = dateRange(request("?to=yesterday"))
+	c.Assert(ErrInvalidRequestBodyData.IsErr(err), qt.IsTrue)
+	_, _, err = dateRange(request("?from=20&to=10"))
+	c.Assert(err, qt.ErrorMatches, "invalid request body data: to must be after from")
+}
+
+func TestPublicStatsCache(t *testing.T) {
+	c := qt.New(t)
+	cache := &publicStatsCache{ttl: time.Hour}
+	calls := 0
+	compute := func() (*PublicStats, error) {
+		calls++
+		if calls == 1 {
+			return nil, fmt.Errorf("database down")
+		}
+		return &PublicStats{Users: int64(calls)}, nil
+	}
+
+	// Errors are not cached
+	_, err := cache.get(compute)
+	c.Assert(err, qt.ErrorMatches, "database down")
+	stats, err := cache.get(compute)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stats.Users, qt.Equals, int64(2))
+	stats, err = cache.get(compute)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stats.Users, qt.Equals, int64(2))
+	c.Assert(calls, qt.Equals, 2)
+
+	// The stats are computed again once expired
+	cache.expires = time.Now().Add(-time.Second)
+	stats, err = cache.get(compute)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stats.Users, qt.Equals, int64(3))
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+const (
+	// defaultSuggestedDates is the number of free windows suggested if no count is given.
+	defaultSuggestedDates = 3
+	// maxSuggestedDates is the maximum number of free windows suggested.
+	maxSuggestedDates = 10
+	// maxSuggestedDuration is the maximum duration, in days, of the suggested windows.
+	maxSuggestedDuration = 90
+	// suggestionHorizon is how far in the future free windows are searched.
+	suggestionHorizon = 365 * dayDuration
+	dayDuration       = 24 * time.Hour
+)
+
+// busyPeriod is a period a tool cannot be booked.
+type busyPeriod struct {
+	From, To time.Time
+}
+
+// suggestedDatesHandler handles GET /tools/{id}/suggested-dates?duration=&count=
+// It returns the nearest free windows of the tool of the given duration in days, starting on
+// different days from tomorrow on, skipping the accepted bookings, the reserved dates, the
+// maintenance of the tool and the days its availability rules do not allow.
+func (a *API) suggestedDatesHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	tool, err := a.toolFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := intParam(r, "duration", 0, 1, maxSuggestedDuration)
+	if err != nil {
+		return nil, err
+	}
+	count, err := intParam(r, "count", defaultSuggestedDates, 1, maxSuggestedDates)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	bookings, err := a.database.BookingService.GetToolAcceptedBookings(r.Context.Request.Context(),
+		strconv.FormatInt(tool.ID, 10), now)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	busy := make([]busyPeriod, 0, len(bookings)+len(tool.ReservedDates))
+	for _, b := range bookings {
+		busy = append(busy, busyPeriod{From: b.StartDate, To: b.EndDate})
+	}
+	for _, reserved := range tool.ReservedDates {
+		busy = append(busy, busyPeriod{
+			From: time.Unix(int64(reserved.From), 0),
+			To:   time.Unix(int64(reserved.To), 0),
+		})
+	}
+	if m := tool.Maintenance; !m.Ended(now) {
+		// An open ended maintenance blocks every date after its start
+		end := now.Add(suggestionHorizon + maxSuggestedDuration*dayDuration)
+		if m.EndDate != nil {
+			end = *m.EndDate
+		}
+		busy = append(busy, busyPeriod{From: m.StartDate, To: end})
+	}
+
+	response := &SuggestedDatesResponse{Duration: duration, Suggestions: []*DateWindow{}}
+	for _, window := range suggestDates(busy, tool.Availability, now, duration, count) {
+		response.Suggestions = append(response.Suggestions, &DateWindow{
+			StartDate: window.From.Unix(),
+			EndDate:   window.To.Unix(),
+		})
+	}
+	return response, nil
+}
+
+// suggestDates returns up to count free windows of the given days, each starting at midnight
+// (UTC) of a different dayDuration after now, the nearest first. A window is free if it does not
+// overlap any busy period and the rules allow all its days. Windows are searched up to the
+// suggestion horizon.
+func suggestDates(busy []busyPeriod, rules *db.AvailabilityRules, now time.Time, days, count int) []busyPeriod {
+	length := time.Duration(days) * dayDuration
+	horizon := now.Add(suggestionHorizon)
+	windows := []busyPeriod{}
+	start := now.UTC().Truncate(dayDuration).Add(dayDuration)
+	for len(windows) < count && start.Before(horizon) {
+		end := start.Add(length)
+		next := start.Add(dayDuration)
+		free := rules.FirstUnavailableDay(start, end) == nil
+		for _, b := range busy {
+			if start.Before(b.To) && b.From.Before(end) {
+				free = false
+				// Skip to the first dayDuration after the busy period
+				if after := ceilDay(b.To); after.After(next) {
+					next = after
+				}
+			}
+		}
+		if free {
+			windows = append(windows, busyPeriod{From: start, To: end})
+		}
+		start = next
+	}
+	return windows
+}
+
+// ceilDay returns the time rounded up to midnight (UTC).
+func ceilDay(t time.Time) time.Time {
+	truncated := t.UTC().Truncate(dayDuration)
+	if truncated.Equal(t) {
+		return truncated
+	}
+	return truncated.Add(dayDuration)
+}
+
+// intParam returns the integer URL parameter, which must be between min and max. If the
+// parameter is missing, it returns the default value, or an error if the default is 0.
+func intParam(r *Request, name string, defaultValue, minValue, maxValue int) (int, error) {
+	param := r.Context.URLParam(name)
+	if param == nil {
+		if defaultValue == 0 {
+			return 0, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing %s", name))
+		}
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(param[0])
+	if err != nil || value < minValue || value > maxValue {
+		return 0, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("%s must be between %d and %d", name, minValue, maxValue))
+	}
+	return value, nil
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestSuggestDates(t *testing.T) {
+	c := qt.New(t)
+
+	now := time.Date(2024, 5, 10, 15, 30, 0, 0, time.UTC)
+	date := func(d int) time.Time {
+		return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	// Without bookings, windows start every day from tomorrow
+	windows := suggestDates(nil, nil, now, 3, 2)
+	c.Assert(windows, qt.DeepEquals, []busyPeriod{
+		{From: date(11), To: date(14)},
+		{From: date(12), To: date(15)},
+	})
+
+	// Windows skip the busy periods, which may end in the middle of a day
+	busy := []busyPeriod{
+		{From: date(13), To: date(15).Add(12 * time.Hour)},
+		{From: date(20), To: date(21)},
+	}
+	windows = suggestDates(busy, nil, now, 2, 4)
+	c.Assert(windows, qt.DeepEquals, []busyPeriod{
+		{From: date(11), To: date(13)},
+		{From: date(16), To: date(18)},
+		{From: date(17), To: date(19)},
+		{From: date(18), To: date(20)},
+	})
+
+	// Longer windows only fit after the busy periods
+	windows = suggestDates(busy, nil, now, 5, 1)
+	c.Assert(windows, qt.DeepEquals, []busyPeriod{{From: date(21), To: date(26)}})
+
+	// No window within the horizon
+	windows = suggestDates([]busyPeriod{{From: date(1), To: date(1).AddDate(2, 0, 0)}}, nil, now, 1, 3)
+	c.Assert(windows, qt.HasLen, 0)
+
+	// Windows only cover the days allowed by the availability rules, weekends here
+	weekends := &db.AvailabilityRules{Weekdays: []int{0, 6}}
+	windows = suggestDates(nil, weekends, now, 2, 2)
+	c.Assert(windows, qt.DeepEquals, []busyPeriod{
+		{From: date(11), To: date(13)},
+		{From: date(18), To: date(20)},
+	})
+	windows = suggestDates(nil, &db.AvailabilityRules{ExcludedMonths: []int{5}}, now, 1, 1)
+	c.Assert(windows, qt.DeepEquals, []busyPeriod{
+		{From: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)},
+	})
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/emprius/emprius-app-backend/telegram"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// telegramTimeout is the maximum duration of the delivery of a notification to Telegram.
+const telegramTimeout = 30 * time.Second
+
+// telegramHandler handles GET /profile/telegram
+// Returns whether the user linked a Telegram account to receive the notifications.
+func (a *API) telegramHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	status := &TelegramStatus{Enabled: a.telegram != nil}
+	if a.telegram != nil {
+		status.BotUsername = a.telegram.Username
+	}
+	if user.Telegram != nil && user.Telegram.ChatID != 0 {
+		status.Linked = true
+		status.LinkedAt = user.Telegram.LinkedAt
+	}
+	return status, nil
+}
+
+// telegramLinkHandler handles POST /profile/telegram/link
+// Returns the deep link of the bot that links the Telegram account of the user when opened.
+// A previously linked account keeps receiving the notifications until the new one is linked.
+func (a *API) telegramLinkHandler(r *Request) (interface{}, error) {
+	if a.telegram == nil {
+		return nil, ErrTelegramDisabled
+	}
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newTelegramLinkToken()
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if err := a.database.UserService.SetTelegramLinkToken(r.Context.Request.Context(), user.ID, token); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &TelegramLink{URL: a.telegram.DeepLink(token)}, nil
+}
+
+// telegramUnlinkHandler handles DELETE /profile/telegram
+// Stops sending the notifications of the user to Telegram.
+func (a *API) telegramUnlinkHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.database.UserService.UnlinkTelegram(r.Context.Request.Context(), user.ID); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// telegramWebhookHandler handles POST /telegram/webhook
+// Receives the updates of the bot, authenticated with its webhook secret. A /start command with
+// the token of a deep link links the chat to the user of the token. The other updates are
+// ignored, and the valid ones are always acknowledged so Telegram does not retry them.
+func (a *API) telegramWebhookHandler(r *Request) (interface{}, error) {
+	if a.telegram == nil {
+		return nil, ErrTelegramDisabled
+	}
+	secret := r.Context.Request.Header.Get(telegram.SecretHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(a.telegram.WebhookSecret())) != 1 {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("invalid telegram webhook secret"))
+	}
+	var update telegram.Update
+	if err := json.Unmarshal(r.Data, &update); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	token, chatID, ok := update.StartToken()
+	if !ok {
+		return nil, nil
+	}
+	ctx := r.Context.Request.Context()
+	reply := fmt.Sprintf("Your %s notifications will be sent to this chat.", a.branding.AppName)
+	user, err := a.database.UserService.LinkTelegram(ctx, token, chatID)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		reply = fmt.Sprintf("This link has expired, create a new one from your %s profile.", a.branding.AppName)
+	case err != nil:
+		return nil, ErrInternalServerError.WithErr(err)
+	default:
+		log.Info().Msgf("user %s linked telegram", user.ID.Hex())
+	}
+	if err := a.telegram.Send(ctx, &mail.Message{To: strconv.FormatInt(chatID, 10), Body: reply}); err != nil {
+		log.Warn().Err(err).Msg("could not answer the telegram link")
+	}
+	return nil, nil
+}
+
+// newTelegramLinkToken returns a random token of the deep link that links a Telegram account.
+func newTelegramLinkToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// telegramNotification sends the notification to the Telegram chat linked by the user.
+func (a *API) telegramNotification(user *db.User, n *db.Notification) {
+	ctx, cancel := context.WithTimeout(context.Background(), telegramTimeout)
+	defer cancel()
+	if err := a.telegram.Send(ctx, &mail.Message{
+		To:      strconv.FormatInt(user.Telegram.ChatID, 10),
+		Subject: a.notificationSubject(n.Type),
+		Body:    n.Message,
+	}); err != nil {
+		log.Error().Err(err).Msgf("could not send the telegram notification of user %s", user.ID.Hex())
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// tenantPathPrefix is the path prefix of the requests to a tenant, followed by its id, for the
+// tenants not selected by hostname.
+const tenantPathPrefix = "/t/"
+
+// Tenant is a logical instance of a multi-tenant deployment, with its own API and data.
+type Tenant struct {
+	// ID identifies the tenant, its requests can be sent under the /t/{id} path prefix.
+	ID string
+	// Hosts are the hostnames the requests to the tenant are sent to, without port.
+	Hosts []string
+	API   *API
+}
+
+// StartTenants starts the HTTP server of a multi-tenant deployment and the background jobs of
+// every tenant (non blocking). The requests are dispatched to the tenant of their hostname or
+// of their path prefix.
+func StartTenants(host string, port int, tenants []*Tenant) error {
+	routers := make(map[string]http.Handler, len(tenants))
+	hosts := make(map[string]string)
+	for _, tenant := range tenants {
+		if _, ok := routers[tenant.ID]; ok {
+			return fmt.Errorf("duplicated tenant %q", tenant.ID)
+		}
+		routers[tenant.ID] = tenant.API.router()
+		for _, h := range tenant.Hosts {
+			h = strings.ToLower(h)
+			if other, ok := hosts[h]; ok {
+				return fmt.Errorf("host %s of tenant %q is also used by tenant %q", h, tenant.ID, other)
+			}
+			hosts[h] = tenant.ID
+		}
+	}
+	go func() {
+		if err := http.ListenAndServe(fmt.Sprintf("%s:%d", host, port), tenantRouter(routers, hosts)); err != nil {
+			log.Fatal().Err(err).Msg("failed to start api router")
+		}
+	}()
+	for _, tenant := range tenants {
+		tenant.API.startJobs()
+	}
+	return nil
+}
+
+// tenantRouter returns the handler dispatching the requests to the router of the tenant of
+// their hostname, or else of their /t/{id} path prefix, which is removed. The requests of no
+// tenant are rejected.
+func tenantRouter(routers map[string]http.Handler, hosts map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := hosts[requestHostname(r)]; ok {
+			routers[id].ServeHTTP(w, r)
+			return
+		}
+		if rest, found := strings.CutPrefix(r.URL.Path, tenantPathPrefix); found {
+			id, path, _ := strings.Cut(rest, "/")
+			if router, ok := routers[id]; ok {
+				r2 := r.Clone(r.Context())
+				r2.URL.Path = "/" + path
+				r2.URL.RawPath = ""
+				router.ServeHTTP(w, r2)
+				return
+			}
+		}
+		sendError(w, ErrTenantNotFound.WithErr(fmt.Errorf("no tenant for %s%s", r.Host, r.URL.Path)))
+	})
+}
+
+// requestHostname returns the hostname of the request in lower case, without port.
+func requestHostname(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return strings.ToLower(host)
+}
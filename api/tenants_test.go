@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/go-chi/jwtauth/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTenantRouter(t *testing.T) {
+	c := qt.New(t)
+
+	tenantHandler := func(id string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Tenant", id)
+			w.Header().Set("X-Path", r.URL.Path)
+		})
+	}
+	router := tenantRouter(
+		map[string]http.Handler{"coop": tenantHandler("coop"), "ateneu": tenantHandler("ateneu")},
+		map[string]string{"tools.coop.example": "coop"},
+	)
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// By hostname, with any port and case
+	w := serve("http://Tools.Coop.Example:8080/v2/tools")
+	c.Assert(w.Header().Get("X-Tenant"), qt.Equals, "coop")
+	c.Assert(w.Header().Get("X-Path"), qt.Equals, "/v2/tools")
+
+	// By path prefix, which is removed
+	w = serve("http://api.example/t/ateneu/v2/tools")
+	c.Assert(w.Header().Get("X-Tenant"), qt.Equals, "ateneu")
+	c.Assert(w.Header().Get("X-Path"), qt.Equals, "/v2/tools")
+	w = serve("http://api.example/t/ateneu")
+	c.Assert(w.Header().Get("X-Path"), qt.Equals, "/")
+
+	// The hostname takes precedence over the path prefix
+	w = serve("http://tools.coop.example/t/ateneu/tools")
+	c.Assert(w.Header().Get("X-Tenant"), qt.Equals, "coop")
+
+	w = serve("http://api.example/t/other/tools")
+	c.Assert(w.Code, qt.Equals, http.StatusNotFound)
+	w = serve("http://api.example/tools")
+	c.Assert(w.Code, qt.Equals, http.StatusNotFound)
+}
+
+func TestTenantToken(t *testing.T) {
+	c := qt.New(t)
+
+	tenantA := New("secret", "token", nil, &Options{Tenant: "a"})
+	tenantB := New("secret", "token", nil, &Options{Tenant: "b"})
+	single := New("secret", "token", nil, nil)
+	authenticate := func(a *API, token string) int {
+		handler := jwtauth.Verifier(a.auth)(a.authenticator(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	userID := primitive.NewObjectID().Hex()
+	token, err := tenantA.makeToken(userID, "")
+	c.Assert(err, qt.IsNil)
+	c.Assert(authenticate(tenantA, token.Token), qt.Equals, http.StatusOK)
+	// The tokens signed with the shared secret are only valid for their tenant
+	c.Assert(authenticate(tenantB, token.Token), qt.Equals, http.StatusUnauthorized)
+	c.Assert(authenticate(single, token.Token), qt.Equals, http.StatusUnauthorized)
+
+	token, err = single.makeToken(userID, "")
+	c.Assert(err, qt.IsNil)
+	c.Assert(authenticate(single, token.Token), qt.Equals, http.StatusOK)
+	c.Assert(authenticate(tenantA, token.Token), qt.Equals, http.StatusUnauthorized)
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxTermsSummaryLength is the maximum length of the summary of the changes of a terms version.
+const maxTermsSummaryLength = 2000
+
+// termsExemptRoutes are the writes the users can make without accepting the current terms:
+// accepting them, deleting their account and closing their sessions. The admins can also
+// publish a new version, i.e. to fix the one just published.
+var termsExemptRoutes = []string{
+	"POST /profile/accept-terms",
+	"POST /admin/terms",
+	"DELETE /profile",
+	"DELETE /profile/sessions/{id}",
+}
+
+// apiVersionPrefix matches the API version prefix of the route patterns.
+var apiVersionPrefix = regexp.MustCompile(`^/v\d+`)
+
+// requireTerms rejects the writes of the users that did not accept the current terms, once
+// any terms version is published. The reads are always allowed, so the clients can show the
+// terms and the data of the user.
+func (a *API) requireTerms(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		pattern := apiVersionPrefix.ReplaceAllString(chi.RouteContext(r.Context()).RoutePattern(), "")
+		if slices.Contains(termsExemptRoutes, r.Method+" "+pattern) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := a.checkTerms(r.Context(), r.Header.Get("X-User-Id")); err != nil {
+			sendError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkTerms returns an error with the current terms if the user did not accept them.
+func (a *API) checkTerms(ctx context.Context, userID string) *HTTPError {
+	terms, err := a.database.TermsService.Current(ctx)
+	if err != nil {
+		return ErrInternalServerError.WithErr(err)
+	}
+	if terms == nil {
+		return nil
+	}
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrInvalidUserID.WithErr(err)
+	}
+	user, err := a.database.UserService.GetUserByID(ctx, id)
+	if err != nil {
+		return ErrUserNotFound.WithErr(err)
+	}
+	if user.AcceptedTermsVersion() < terms.Version {
+		return ErrTermsNotAccepted.WithData(terms)
+	}
+	return nil
+}
+
+// pendingTermsVersion returns the current terms version if the user did not accept it, or 0.
+func (a *API) pendingTermsVersion(ctx context.Context, user *db.User) int {
+	terms, err := a.database.TermsService.Current(ctx)
+	if err != nil || terms == nil || user.AcceptedTermsVersion() >= terms.Version {
+		return 0
+	}
+	return terms.Version
+}
+
+// termsHandler handles GET /info/terms
+// Returns the current terms, so they can be shown before registering.
+func (a *API) termsHandler(r *Request) (interface{}, error) {
+	terms, err := a.database.TermsService.Current(r.Context.Request.Context())
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if terms == nil {
+		return nil, ErrTermsNotFound
+	}
+	return terms, nil
+}
+
+// profileTermsHandler handles GET /profile/terms
+// Returns the current terms and the terms versions accepted by the user, and whether the user
+// must accept the current ones.
+func (a *API) profileTermsHandler(r *Request) (interface{}, error) {
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	terms, err := a.database.TermsService.Current(r.Context.Request.Context())
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return termsStatus(user, terms), nil
+}
+
+// acceptTermsHandler handles POST /profile/accept-terms
+// Records the acceptance of the current terms by the user. The version read by the user must
+// be the current one, so a version published meanwhile is not accepted unread.
+func (a *API) acceptTermsHandler(r *Request) (interface{}, error) {
+	var req AcceptTermsRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	terms, err := a.database.TermsService.Current(ctx)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if terms == nil {
+		return nil, ErrTermsNotFound
+	}
+	if req.Version != terms.Version {
+		return nil, ErrTermsOutdated.WithData(terms)
+	}
+	if user.AcceptedTermsVersion() != terms.Version {
+		acceptance, err := a.database.UserService.AcceptTerms(ctx, user.ID, terms.Version)
+		if err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
+		}
+		user.TermsAcceptances = append(user.TermsAcceptances, *acceptance)
+	}
+	return termsStatus(user, terms), nil
+}
+
+// termsStatus returns the terms acceptance status of the user for the current terms, which
+// may be nil.
+func termsStatus(user *db.User, terms *db.TermsVersion) *TermsStatus {
+	status := &TermsStatus{
+		Current:         terms,
+		AcceptedVersion: user.AcceptedTermsVersion(),
+		Acceptances:     user.TermsAcceptances,
+	}
+	if status.Acceptances == nil {
+		status.Acceptances = []db.TermsAcceptance{}
+	}
+	status.AcceptanceRequired = terms != nil && status.AcceptedVersion < terms.Version
+	return status
+}
+
+// adminTermsHandler handles GET /admin/terms
+// Returns every published terms version, the latest first.
+func (a *API) adminTermsHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	versions, err := a.database.TermsService.List(r.Context.Request.Context())
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return versions, nil
+}
+
+// adminPublishTermsHandler handles POST /admin/terms
+// Publishes a new terms version, which every user must accept before writing again.
+func (a *API) adminPublishTermsHandler(r *Request) (interface{}, error) {
+	if err := a.requireAdmin(r); err != nil {
+		return nil, err
+	}
+	var req TermsRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	terms := &db.TermsVersion{
+		URL:        strings.TrimSpace(req.URL),
+		PrivacyURL: strings.TrimSpace(req.PrivacyURL),
+		Summary:    strings.TrimSpace(req.Summary),
+	}
+	if !isTermsURL(terms.URL) || (terms.PrivacyURL != "" && !isTermsURL(terms.PrivacyURL)) {
+		return nil, ErrInvalidTerms.WithErr(fmt.Errorf("the terms and privacy policy must be http(s) URLs"))
+	}
+	if len(terms.Summary) > maxTermsSummaryLength {
+		return nil, ErrInvalidTerms.WithErr(fmt.Errorf("summary longer than %d characters", maxTermsSummaryLength))
+	}
+	var err error
+	if terms.PublishedBy, err = primitive.ObjectIDFromHex(r.UserID); err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	if err := a.database.TermsService.Publish(r.Context.Request.Context(), terms); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.infoCache.invalidate()
+	a.audit(r, &db.AuditEntry{Action: db.AuditTermsPublish, Details: fmt.Sprintf("version %d", terms.Version)})
+	return terms, nil
+}
+
+// isTermsURL returns true if the string is an absolute http(s) URL.
+func isTermsURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+// availabilityFromTool returns the validated availability rules of the tool, with the weekdays
+// and months sorted and deduplicated. It returns nil if the tool has no rules or they are all
+// empty.
+func availabilityFromTool(t *Tool) (*db.AvailabilityRules, error) {
+	if t.Availability == nil {
+		return nil, nil
+	}
+	rules := &db.AvailabilityRules{}
+	for _, weekday := range t.Availability.Weekdays {
+		if weekday < 0 || weekday > 6 {
+			return nil, ErrInvalidAvailability.WithErr(fmt.Errorf("weekdays must be between 0 (Sunday) and 6 (Saturday)"))
+		}
+		if !slices.Contains(rules.Weekdays, weekday) {
+			rules.Weekdays = append(rules.Weekdays, weekday)
+		}
+	}
+	for _, month := range t.Availability.ExcludedMonths {
+		if month < 1 || month > 12 {
+			return nil, ErrInvalidAvailability.WithErr(fmt.Errorf("months must be between 1 (January) and 12 (December)"))
+		}
+		if !slices.Contains(rules.ExcludedMonths, month) {
+			rules.ExcludedMonths = append(rules.ExcludedMonths, month)
+		}
+	}
+	if len(rules.ExcludedMonths) == 12 {
+		return nil, ErrInvalidAvailability.WithErr(fmt.Errorf("cannot exclude every month"))
+	}
+	if rules.IsEmpty() {
+		return nil, nil
+	}
+	slices.Sort(rules.Weekdays)
+	slices.Sort(rules.ExcludedMonths)
+	return rules, nil
+}
+
+// checkAvailability returns an error if the availability rules of the tool do not allow any
+// day of the dates.
+func checkAvailability(tool *db.Tool, start, end time.Time) error {
+	if day := tool.Availability.FirstUnavailableDay(start, end); day != nil {
+		return ErrOutsideAvailability.WithErr(fmt.Errorf("tool %d is not available on %s",
+			tool.ID, day.Format(time.DateOnly)))
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxImportRows is the maximum number of tools imported in a single CSV file.
+const maxImportRows = 500
+
+// toolCSVColumns are the columns of the tool import and export CSV files. The import requires
+// them in the header, in any order, and ignores any other column. The location is either
+// "latitude,longitude" in decimal degrees or, if geocoding is enabled, an address.
+var toolCSVColumns = []string{"title", "description", "category", "valuation", "location"}
+
+// toolCSVRow is a parsed row of an import CSV file. Err is set if the row is not valid.
+type toolCSVRow struct {
+	Line int
+	Tool *Tool
+	Err  error
+}
+
+// importToolsHandler handles POST /tools/import
+// The body is a CSV file with a header row. Each row is validated and added independently,
+// and the result of every row is returned.
+func (a *API) importToolsHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	rows, err := parseToolCSV(r.Data)
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+
+	response := &ToolImportResponse{Results: []*ToolImportResult{}}
+	for _, row := range rows {
+		result := &ToolImportResult{Row: row.Line}
+		if row.Err == nil {
+			result.ID, row.Err = a.addTool(row.Tool, r.UserID)
+		}
+		if row.Err != nil {
+			result.Error = row.Err.Error()
+			response.Failed++
+		} else {
+			response.Imported++
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+// exportToolsHandler handles GET /tools/export
+// Returns the tools of the user as a CSV file that can be imported again.
+func (a *API) exportToolsHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	tools, err := a.toolsByUserID(r.UserID, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := writeToolCSV(tools)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &RawResponse{
+		ContentType: "text/csv",
+		Filename:    "emprius-tools.csv",
+		Data:        data,
+	}, nil
+}
+
+// parseToolCSV parses an import CSV file. It fails if the file cannot be read, the header
+// misses a column or there are too many rows. Invalid rows are returned with their error.
+func parseToolCSV(data []byte) ([]*toolCSVRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("empty csv file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range toolCSVColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	rows := []*toolCSVRow{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("too many rows, the maximum is %d", maxImportRows)
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			rows = append(rows, &toolCSVRow{Line: parseErr.StartLine, Err: err})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			if i := columns[name]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		tool, err := toolFromCSV(field)
+		rows = append(rows, &toolCSVRow{Line: line, Tool: tool, Err: err})
+	}
+	return rows, nil
+}
+
+// toolFromCSV builds the tool of an import row. The tools may be free and have no cost.
+func toolFromCSV(field func(name string) string) (*Tool, error) {
+	category, err := strconv.Atoi(field("category"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid category %q", field("category"))
+	}
+	valuation, err := strconv.ParseUint(field("valuation"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid valuation %q", field("valuation"))
+	}
+	mayBeFree, askWithFee, cost := true, false, uint64(0)
+	tool := &Tool{
+		Title:          field("title"),
+		Description:    field("description"),
+		Category:       category,
+		EstimatedValue: valuation,
+		MayBeFree:      &mayBeFree,
+		AskWithFee:     &askWithFee,
+		Cost:           &cost,
+	}
+	location := field("location")
+	if location == "" {
+		return nil, fmt.Errorf("missing location")
+	}
+	if l, ok := parseCSVLocation(location); ok {
+		tool.Location = l
+	} else {
+		tool.Address = location
+	}
+	return tool, nil
+}
+
+// parseCSVLocation parses a "latitude,longitude" location in decimal degrees.
+func parseCSVLocation(s string) (Location, bool) {
+	lat, lon, found := strings.Cut(s, ",")
+	if !found {
+		return Location{}, false
+	}
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	if err != nil || math.Abs(latitude) > 90 {
+		return Location{}, false
+	}
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	if err != nil || math.Abs(longitude) > 180 {
+		return Location{}, false
+	}
+	return Location{
+		Latitude:  int64(math.Round(latitude * 1e6)),
+		Longitude: int64(math.Round(longitude * 1e6)),
+	}, true
+}
+
+// writeToolCSV writes the tools in the import CSV format, preceded by their id.
+func writeToolCSV(tools []*Tool) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(append([]string{"id"}, toolCSVColumns...)); err != nil {
+		return nil, err
+	}
+	for _, t := range tools {
+		latitude, longitude := t.Location.degrees()
+		if err := writer.Write([]string{
+			strconv.FormatInt(t.ID, 10),
+			t.Title,
+			t.Description,
+			strconv.Itoa(t.Category),
+			strconv.FormatUint(t.EstimatedValue, 10),
+			strconv.FormatFloat(latitude, 'f', 6, 64) + "," + strconv.FormatFloat(longitude, 'f', 6, 64),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParseToolCSV(t *testing.T) {
+	c := qt.New(t)
+
+	rows, err := parseToolCSV([]byte(`Title,Description,Category,Valuation,Location,Notes
+Drill,Cordless drill,2,120,"41.695384,2.492793",extra column
+Saw,Hand saw,abc,30,"41.69,2.49"
+Ladder,Aluminium ladder,3,80,"Carrer Major 1, Girona"
+Shovel,Garden shovel,4,20,
+`))
+	c.Assert(err, qt.IsNil)
+	c.Assert(rows, qt.HasLen, 4)
+
+	c.Assert(rows[0].Err, qt.IsNil)
+	c.Assert(rows[0].Line, qt.Equals, 2)
+	c.Assert(rows[0].Tool.Title, qt.Equals, "Drill")
+	c.Assert(rows[0].Tool.Category, qt.Equals, 2)
+	c.Assert(rows[0].Tool.EstimatedValue, qt.Equals, uint64(120))
+	c.Assert(rows[0].Tool.Location, qt.Equals, Location{Latitude: 41695384, Longitude: 2492793})
+	c.Assert(*rows[0].Tool.MayBeFree, qt.IsTrue)
+
+	c.Assert(rows[1].Err, qt.ErrorMatches, `invalid category "abc"`)
+	c.Assert(rows[1].Line, qt.Equals, 3)
+
+	// Locations that are not coordinates are geocoded as addresses
+	c.Assert(rows[2].Err, qt.IsNil)
+	c.Assert(rows[2].Tool.Address, qt.Equals, "Carrer Major 1, Girona")
+
+	c.Assert(rows[3].Err, qt.ErrorMatches, "missing location")
+
+	_, err = parseToolCSV([]byte("title,description,category\n"))
+	c.Assert(err, qt.ErrorMatches, `missing column "valuation"`)
+	_, err = parseToolCSV(nil)
+	c.Assert(err, qt.ErrorMatches, "empty csv file")
+	_, err = parseToolCSV([]byte("title,description,category,valuation,location\n" +
+		strings.Repeat("a,b,1,1,\"1,1\"\n", maxImportRows+1)))
+	c.Assert(err, qt.ErrorMatches, "too many rows.*")
+}
+
+func TestWriteToolCSV(t *testing.T) {
+	c := qt.New(t)
+
+	data, err := writeToolCSV([]*Tool{{
+		ID:             7,
+		Title:          "Drill",
+		Description:    "Cordless drill, with case",
+		Category:       2,
+		EstimatedValue: 120,
+		Location:       Location{Latitude: 41695384, Longitude: 2492793},
+	}})
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(data), qt.Equals, "id,title,description,category,valuation,location\n"+
+		"7,Drill,\"Cordless drill, with case\",2,120,\"41.695384,2.492793\"\n")
+
+	// The export can be imported again
+	rows, err := parseToolCSV(data)
+	c.Assert(err, qt.IsNil)
+	c.Assert(rows, qt.HasLen, 1)
+	c.Assert(rows[0].Err, qt.IsNil)
+	c.Assert(rows[0].Tool.Description, qt.Equals, "Cordless drill, with case")
+	c.Assert(rows[0].Tool.Location, qt.Equals, Location{Latitude: 41695384, Longitude: 2492793})
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+const (
+	// maxToolLengthCm is the maximum height, width and length of a tool.
+	maxToolLengthCm = 10000
+	// maxToolWeightKg is the maximum weight of a tool.
+	maxToolWeightKg = 50000
+)
+
+// lengthUnits are the accepted length units, in centimeters.
+var lengthUnits = map[string]float64{"mm": 0.1, "cm": 1, "m": 100, "in": 2.54, "ft": 30.48}
+
+// weightUnits are the accepted weight units, in kilograms.
+var weightUnits = map[string]float64{"g": 0.001, "kg": 1, "lb": 0.45359237}
+
+// measureRegexp matches a measure of the search parameters, a number optionally followed by
+// its unit, i.e. 120cm or 1.2m.
+var measureRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-z]*)$`)
+
+// toolDimensionsFromTool returns the dimensions of the tool in centimeters and kilograms,
+// converted from the units of the request. Without dimensions, the height and weight without
+// units of the older clients are taken as centimeters and kilograms and change the current
+// dimensions. It returns nil if no dimension is known.
+func toolDimensionsFromTool(t *Tool, current *db.Dimensions) (*db.Dimensions, error) {
+	var dimensions db.Dimensions
+	if t.Dimensions == nil {
+		if current != nil {
+			dimensions = *current
+		}
+		if t.Height != 0 {
+			dimensions.HeightCm = float64(t.Height)
+		}
+		if t.Weight != 0 {
+			dimensions.WeightKg = float64(t.Weight)
+		}
+	} else {
+		lengthUnit, weightUnit := t.Dimensions.LengthUnit, t.Dimensions.WeightUnit
+		if lengthUnit == "" {
+			lengthUnit = "cm"
+		}
+		if weightUnit == "" {
+			weightUnit = "kg"
+		}
+		toCm, ok := lengthUnits[lengthUnit]
+		if !ok {
+			return nil, ErrInvalidDimensions.WithErr(fmt.Errorf("unknown length unit %q", lengthUnit))
+		}
+		toKg, ok := weightUnits[weightUnit]
+		if !ok {
+			return nil, ErrInvalidDimensions.WithErr(fmt.Errorf("unknown weight unit %q", weightUnit))
+		}
+		dimensions = db.Dimensions{
+			HeightCm: roundCm(t.Dimensions.Height * toCm),
+			WidthCm:  roundCm(t.Dimensions.Width * toCm),
+			LengthCm: roundCm(t.Dimensions.Length * toCm),
+			WeightKg: roundKg(t.Dimensions.Weight * toKg),
+		}
+	}
+	for _, cm := range []float64{dimensions.HeightCm, dimensions.WidthCm, dimensions.LengthCm} {
+		if cm < 0 || cm > maxToolLengthCm || math.IsNaN(cm) {
+			return nil, ErrInvalidDimensions.WithErr(fmt.Errorf("size must be between 0 and %d cm", maxToolLengthCm))
+		}
+	}
+	if dimensions.WeightKg < 0 || dimensions.WeightKg > maxToolWeightKg || math.IsNaN(dimensions.WeightKg) {
+		return nil, ErrInvalidDimensions.WithErr(fmt.Errorf("weight must be between 0 and %d kg", maxToolWeightKg))
+	}
+	if dimensions.IsEmpty() {
+		return nil, nil
+	}
+	return &dimensions, nil
+}
+
+// parseMeasure parses a measure of the search parameters with one of the units, or the
+// default unit if it has none, and returns it in the base unit of the units.
+func parseMeasure(value string, units map[string]float64, defaultUnit string) (float64, error) {
+	match := measureRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(value)))
+	if match == nil {
+		return 0, fmt.Errorf("invalid measure %q", value)
+	}
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	unit := match[2]
+	if unit == "" {
+		unit = defaultUnit
+	}
+	factor, ok := units[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", unit)
+	}
+	return number * factor, nil
+}
+
+// roundCm rounds the centimeters to millimeters.
+func roundCm(cm float64) float64 {
+	return math.Round(cm*10) / 10
+}
+
+// roundKg rounds the kilograms to grams.
+func roundKg(kg float64) float64 {
+	return math.Round(kg*1000) / 1000
+}
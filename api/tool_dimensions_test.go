@@ -0,0 +1,73 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/emprius/emprius-app-backend/db"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestToolDimensionsFromTool(t *testing.T) {
+	c := qt.New(t)
+
+	// Converted to centimeters and kilograms
+	dimensions, err := toolDimensionsFromTool(&Tool{Dimensions: &Dimensions{
+		Height:     1.2,
+		Width:      0.35,
+		Weight:     2500,
+		LengthUnit: "m",
+		WeightUnit: "g",
+	}}, nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dimensions, qt.DeepEquals, &db.Dimensions{HeightCm: 120, WidthCm: 35, WeightKg: 2.5})
+	dimensions, err = toolDimensionsFromTool(&Tool{Dimensions: &Dimensions{Length: 10, Weight: 10, LengthUnit: "in",
+		WeightUnit: "lb"}}, nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dimensions, qt.DeepEquals, &db.Dimensions{LengthCm: 25.4, WeightKg: 4.536})
+
+	// The height and weight without units are centimeters and kilograms, changing the current ones
+	current := &db.Dimensions{HeightCm: 50, WidthCm: 20, WeightKg: 3}
+	dimensions, err = toolDimensionsFromTool(&Tool{Weight: 4}, current)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dimensions, qt.DeepEquals, &db.Dimensions{HeightCm: 50, WidthCm: 20, WeightKg: 4})
+	c.Assert(current.WeightKg, qt.Equals, 3.0)
+	dimensions, err = toolDimensionsFromTool(&Tool{}, nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dimensions, qt.IsNil)
+
+	for _, invalid := range []*Dimensions{
+		{Height: -1},
+		{Weight: maxToolWeightKg + 1},
+		{Length: 101, LengthUnit: "m"},
+		{Height: 1, LengthUnit: "yards"},
+		{Weight: 1, WeightUnit: "stone"},
+	} {
+		_, err := toolDimensionsFromTool(&Tool{Dimensions: invalid}, nil)
+		c.Assert(err, qt.ErrorMatches, "invalid tool dimensions.*", qt.Commentf("dimensions %+v", invalid))
+	}
+}
+
+func TestParseMeasure(t *testing.T) {
+	c := qt.New(t)
+
+	for value, want := range map[string]float64{
+		"120":     120,
+		"120cm":   120,
+		"1.5 m":   150,
+		"1.5M":    150,
+		"10in":    25.4,
+		"1000 mm": 100,
+	} {
+		cm, err := parseMeasure(value, lengthUnits, "cm")
+		c.Assert(err, qt.IsNil)
+		c.Assert(roundCm(cm), qt.Equals, want, qt.Commentf("value %q", value))
+	}
+	kg, err := parseMeasure("500g", weightUnits, "kg")
+	c.Assert(err, qt.IsNil)
+	c.Assert(kg, qt.Equals, 0.5)
+
+	for _, invalid := range []string{"", "-1", "1e3", "cm", "10 kg"} {
+		_, err := parseMeasure(invalid, lengthUnits, "cm")
+		c.Assert(err, qt.IsNotNil, qt.Commentf("value %q", invalid))
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+)
+
+// missingToolFields returns the fields the tool needs to be published: an image, its location
+// and its estimated value.
+func missingToolFields(tool *db.Tool) []string {
+	missing := []string{}
+	if len(tool.Images) == 0 {
+		missing = append(missing, "images")
+	}
+	if c := tool.Location.Coordinates; len(c) < 2 || (c[0] == 0 && c[1] == 0) {
+		missing = append(missing, "location")
+	}
+	if tool.EstimatedValue == 0 {
+		missing = append(missing, "estimatedValue")
+	}
+	return missing
+}
+
+// authorizeDraftView returns ErrToolNotFound if the tool is a draft the subject cannot edit,
+// the drafts being only visible to their owner and managers.
+func authorizeDraftView(subject policy.Subject, tool *db.Tool) error {
+	if tool.Status != db.ToolStatusDraft {
+		return nil
+	}
+	if err := authorize(policy.ToolEdit, subject, toolResource(tool)); err != nil {
+		return ErrToolNotFound.WithErr(fmt.Errorf("tool %d is a draft: %w", tool.ID, err))
+	}
+	return nil
+}
+
+// publishToolHandler handles POST /tools/{id}/publish
+// It publishes the draft tool, listed in the search results from then on, once it has an
+// image, its location and its estimated value.
+func (a *API) publishToolHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolEdit)
+	if err != nil {
+		return nil, err
+	}
+	if tool.Status != db.ToolStatusDraft {
+		return nil, ErrToolNotDraft.WithErr(fmt.Errorf("tool %d is not a draft", tool.ID))
+	}
+	if missing := missingToolFields(tool); len(missing) > 0 {
+		return nil, ErrToolIncomplete.WithErr(fmt.Errorf("tool %d misses %v", tool.ID, missing)).
+			WithData(&IncompleteTool{Missing: missing})
+	}
+	now := time.Now()
+	if err := a.database.ToolService.PublishTool(r.Context.Request.Context(), tool.ID, tool.Version, now); err != nil {
+		return nil, a.toolVersionError(tool.ID, err)
+	}
+	tool.Status, tool.CreatedAt = "", &now
+	a.invalidateToolCaches(tool.Location)
+	go a.notifySavedSearches(tool)
+	log.Info().Msgf("tool %d published", tool.ID)
+	return &ToolID{ID: tool.ID}, nil
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/emprius/emprius-app-backend/db"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestMissingToolFields(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(missingToolFields(&db.Tool{}), qt.DeepEquals, []string{"images", "location", "estimatedValue"})
+	c.Assert(missingToolFields(&db.Tool{Location: db.NewLocation(0, 0)}), qt.DeepEquals,
+		[]string{"images", "location", "estimatedValue"})
+
+	complete := &db.Tool{
+		Images:         []db.Image{{Name: "drill"}},
+		Location:       db.NewLocation(41695384, 2492793),
+		EstimatedValue: 50,
+	}
+	c.Assert(missingToolFields(complete), qt.DeepEquals, []string{})
+	complete.EstimatedValue = 0
+	c.Assert(missingToolFields(complete), qt.DeepEquals, []string{"estimatedValue"})
+}
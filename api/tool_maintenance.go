@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+)
+
+// addMaintenanceHandler handles POST /tools/{id}/maintenance
+// It records a repair or service of the tool in its maintenance log. If the entry has not
+// ended, the tool is taken offline during its dates and the overlapping bookings are rejected.
+func (a *API) addMaintenanceHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolEdit)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var req MaintenanceRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	note := strings.TrimSpace(req.Note)
+	if note == "" {
+		return nil, ErrEmptyMaintenanceNote.WithErr(fmt.Errorf("note is empty"))
+	}
+	if len(note) > maxTransitionNoteLength {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("note longer than %d characters", maxTransitionNoteLength))
+	}
+
+	now := time.Now()
+	entry := &db.MaintenanceLogEntry{
+		ToolID:    tool.ID,
+		UserID:    subject.ID,
+		StartDate: now,
+		Note:      note,
+		Cost:      req.Cost,
+		Public:    req.Public,
+	}
+	if req.StartDate != 0 {
+		entry.StartDate = time.Unix(req.StartDate, 0)
+	}
+	if req.EndDate != 0 {
+		end := time.Unix(req.EndDate, 0)
+		if !end.After(entry.StartDate) {
+			return nil, ErrInvalidMaintenanceDates.WithErr(fmt.Errorf("end %d is not after start %d", req.EndDate, req.StartDate))
+		}
+		entry.EndDate = &end
+	}
+
+	ctx := r.Context.Request.Context()
+	if err := a.database.MaintenanceService.InsertEntry(ctx, entry); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	maintenance := &db.ToolMaintenance{StartDate: entry.StartDate, EndDate: entry.EndDate, Note: note}
+	if !maintenance.Ended(now) {
+		if err := a.database.ToolService.SetMaintenance(ctx, tool.ID, maintenance); err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
+		}
+		log.Info().Msgf("tool %d in maintenance from %s", tool.ID, entry.StartDate.Format(time.RFC3339))
+	}
+	return new(MaintenanceLogEntry).FromDBMaintenanceLogEntry(entry), nil
+}
+
+// endMaintenanceHandler handles DELETE /tools/{id}/maintenance
+// It ends the maintenance of the tool, which can be booked again.
+func (a *API) endMaintenanceHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolEdit)
+	if err != nil {
+		return nil, err
+	}
+	if tool.Maintenance.Ended(time.Now()) {
+		return nil, ErrToolNotInMaintenance.WithErr(fmt.Errorf("tool %d is not in maintenance", tool.ID))
+	}
+	if err := a.database.ToolService.SetMaintenance(r.Context.Request.Context(), tool.ID, nil); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// maintenanceLogHandler handles GET /tools/{id}/maintenance?page=
+// The owner gets the whole maintenance log, the other users only the public entries.
+func (a *API) maintenanceLogHandler(r *Request) (interface{}, error) {
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	tool, err := a.toolFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	publicOnly := authorize(policy.ToolEdit, subject, toolResource(tool)) != nil
+	entries, err := a.database.MaintenanceService.GetToolEntries(r.Context.Request.Context(), tool.ID, publicOnly, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	response := make([]*MaintenanceLogEntry, len(entries))
+	for i, e := range entries {
+		response[i] = new(MaintenanceLogEntry).FromDBMaintenanceLogEntry(e)
+	}
+	return response, nil
+}
+
+// checkMaintenance returns an error if the maintenance window of the tool overlaps the dates.
+func checkMaintenance(tool *db.Tool, start, end time.Time) error {
+	if tool.Maintenance.Overlaps(start, end) {
+		return ErrToolInMaintenance.WithErr(fmt.Errorf("tool %d is in maintenance since %s",
+			tool.ID, tool.Maintenance.StartDate.Format(time.RFC3339)))
+	}
+	return nil
+}
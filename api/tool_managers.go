@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxToolManagers is the maximum number of managers of a tool.
+const maxToolManagers = 5
+
+// toolManagersHandler handles GET /tools/{id}/managers
+// Returns the managers of the tool, visible to its owner and managers.
+func (a *API) toolManagersHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolEdit)
+	if err != nil {
+		return nil, err
+	}
+	users, err := a.database.UserService.GetUsersByIDs(r.Context.Request.Context(), tool.Managers)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	response := &ToolManagersWrapper{Managers: make([]*ToolManager, len(users))}
+	for i, user := range users {
+		response.Managers[i] = &ToolManager{
+			ID:        user.ID.Hex(),
+			Name:      user.Name,
+			AvatarURL: avatarURL(user.ID.Hex()),
+		}
+	}
+	return response, nil
+}
+
+// addToolManagerHandler handles POST /tools/{id}/managers
+// The owner grants a user the management of the tool: editing it and answering its booking
+// requests. The new manager is notified.
+func (a *API) addToolManagerHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolManagers)
+	if err != nil {
+		return nil, err
+	}
+	var req ToolManagerRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	manager, err := a.getDBUserByID(req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if manager.DeletedAt != nil {
+		return nil, ErrUserNotFound.WithErr(fmt.Errorf("user %s is deleted", req.UserID))
+	}
+	if manager.ID == tool.UserID {
+		return nil, ErrManagerIsOwner
+	}
+	if tool.IsManager(manager.ID) {
+		return nil, nil
+	}
+	if len(tool.Managers) >= maxToolManagers {
+		return nil, ErrTooManyToolManagers.WithErr(fmt.Errorf("tool %d has %d managers", tool.ID, len(tool.Managers)))
+	}
+	ctx := r.Context.Request.Context()
+	if err := a.database.ToolService.AddManager(ctx, tool.ID, manager.ID); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.notify(ctx, &db.Notification{
+		UserID:  manager.ID,
+		Type:    db.NotificationToolManager,
+		Message: fmt.Sprintf("You can now manage %s", tool.Title),
+		ToolID:  tool.ID,
+	})
+	return nil, nil
+}
+
+// removeToolManagerHandler handles DELETE /tools/{id}/managers/{userId}
+// The owner revokes the management of the tool from a user, or a manager stops managing it.
+func (a *API) removeToolManagerHandler(r *Request) (interface{}, error) {
+	managerID, err := primitive.ObjectIDFromHex(chi.URLParam(r.Context.Request, "userId"))
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	action := policy.ToolManagers
+	if r.UserID == managerID.Hex() {
+		action = policy.ToolEdit
+	}
+	tool, err := a.authorizedToolFromRequest(r, action)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.database.ToolService.RemoveManager(r.Context.Request.Context(), tool.ID, managerID); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
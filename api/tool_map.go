@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/geohash"
+)
+
+const (
+	// mapMaxZoom is the highest zoom level accepted by the map endpoint.
+	mapMaxZoom = 22
+	// mapClusterMaxZoom is the highest zoom level at which tools are clustered.
+	// Above it the individual tools are returned.
+	mapClusterMaxZoom = 14
+	// mapMaxTools is the maximum number of individual tools returned by the map endpoint.
+	mapMaxTools = 500
+)
+
+// toolMapHandler handles GET /tools/map?bbox=west,south,east,north&zoom=&categories=
+// The bounding box is expressed in microdegrees. At low zoom levels the tools are returned
+// as clusters of geohash cells with their count, at high zoom levels as individual tools.
+func (a *API) toolMapHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized
+	}
+	bboxParam := r.Context.URLParam("bbox")
+	if bboxParam == nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing bbox"))
+	}
+	box, err := parseBoundingBox(bboxParam[0])
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	zoom := 0
+	if zoomParam := r.Context.URLParam("zoom"); zoomParam != nil {
+		if zoom, err = strconv.Atoi(zoomParam[0]); err != nil || zoom < 0 || zoom > mapMaxZoom {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid zoom %q", zoomParam[0]))
+		}
+	}
+	var categories []int
+	for _, cat := range r.Context.URLParam("categories") {
+		val, err := strconv.Atoi(cat)
+		if err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(err)
+		}
+		categories = append(categories, val)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context.Request.Context(), time.Second*15)
+	defer cancel()
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := a.toolViewer(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	opts := db.SearchToolsOptions{Categories: a.categoryTree().Descendants(categories), Viewer: viewer}
+	response := &ToolMapResponse{
+		Zoom:     zoom,
+		Clusters: []*ToolMapCluster{},
+		Tools:    []*Tool{},
+	}
+
+	if zoom <= mapClusterMaxZoom {
+		precision := mapGeohashPrecision(zoom)
+		clusters, err := a.database.ToolService.ClusterTools(ctx, opts, box, precision)
+		if err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
+		}
+		response.Clustered = true
+		response.Precision = precision
+		for _, c := range clusters {
+			cluster := &ToolMapCluster{
+				Geohash: c.Geohash,
+				Count:   c.Count,
+				Location: Location{
+					Latitude:  int64(math.Round(c.Latitude * 1e6)),
+					Longitude: int64(math.Round(c.Longitude * 1e6)),
+				},
+				ToolID: c.ToolID,
+			}
+			// The centroid of a single tool cluster is the tool location
+			if c.ToolID != 0 {
+				cluster.Location = fuzzLocation(a.locationKey, fmt.Sprintf("tool:%d", c.ToolID), cluster.Location)
+			}
+			response.Clusters = append(response.Clusters, cluster)
+		}
+		return response, nil
+	}
+
+	tools, truncated, err := a.database.ToolService.GetToolsInBox(ctx, opts, box, mapMaxTools)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	response.Truncated = truncated
+	for _, t := range tools {
+		response.Tools = append(response.Tools, new(Tool).FromDBTool(t))
+	}
+	a.hideToolLocations(response.Tools...)
+	a.setBreadcrumbs(response.Tools...)
+	if response.Tools, err = a.withFavorites(r.UserID, response.Tools); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// mapGeohashPrecision returns the geohash precision used to cluster the tools at the zoom
+// level, so a map viewport shows around a dozen cells across.
+func mapGeohashPrecision(zoom int) int {
+	precision := int(math.Round(float64(2*(zoom+2)) / 5))
+	return max(1, min(precision, geohash.MaxPrecision))
+}
+
+// parseBoundingBox parses a "west,south,east,north" bounding box in microdegrees.
+// West can be greater than east if the box crosses the antimeridian.
+func parseBoundingBox(bbox string) (db.BoundingBox, error) {
+	parts := strings.Split(bbox, ",")
+	if len(parts) != 4 {
+		return db.BoundingBox{}, fmt.Errorf("bbox must be west,south,east,north")
+	}
+	var values [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return db.BoundingBox{}, fmt.Errorf("invalid bbox coordinate %q", part)
+		}
+		values[i] = float64(v) / 1e6
+	}
+	box := db.BoundingBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	if box.MinLat > box.MaxLat || box.MinLat < -90 || box.MaxLat > 90 ||
+		math.Abs(box.MinLon) > 180 || math.Abs(box.MaxLon) > 180 {
+		return db.BoundingBox{}, fmt.Errorf("bbox out of range")
+	}
+	return box, nil
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+func TestParseBoundingBox(t *testing.T) {
+	c := qt.New(t)
+
+	box, err := parseBoundingBox("2100000,41300000,2200000,41400000")
+	c.Assert(err, qt.IsNil)
+	c.Assert(box, qt.Equals, db.BoundingBox{MinLat: 41.3, MinLon: 2.1, MaxLat: 41.4, MaxLon: 2.2})
+
+	// Boxes crossing the antimeridian are accepted
+	box, err = parseBoundingBox("170000000,-10000000,-170000000,10000000")
+	c.Assert(err, qt.IsNil)
+	c.Assert(box.MinLon > box.MaxLon, qt.IsTrue)
+
+	for _, bbox := range []string{
+		"",
+		"1,2,3",
+		"a,2,3,4",
+		"2.1,41.3,2.2,41.4",                 // degrees instead of microdegrees
+		"2100000,41400000,2200000,41300000", // south above north
+		"2100000,-91000000,2200000,41300000",
+		"181000000,41300000,2200000,41400000",
+	} {
+		_, err := parseBoundingBox(bbox)
+		c.Assert(err, qt.Not(qt.IsNil), qt.Commentf("bbox %q", bbox))
+	}
+}
+
+func TestMapGeohashPrecision(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(mapGeohashPrecision(0), qt.Equals, 1)
+	c.Assert(mapGeohashPrecision(8), qt.Equals, 4)
+	c.Assert(mapGeohashPrecision(mapClusterMaxZoom), qt.Equals, 6)
+	// Precision never decreases when zooming in
+	for zoom := 1; zoom <= mapMaxZoom; zoom++ {
+		c.Assert(mapGeohashPrecision(zoom) >= mapGeohashPrecision(zoom-1), qt.IsTrue)
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+const (
+	// qualityDescriptionLength is the length of a detailed tool description.
+	qualityDescriptionLength = 200
+	// qualityActivityAge is the time after which a tool not updated nor booked is not active.
+	qualityActivityAge = 90 * 24 * time.Hour
+)
+
+// The hints of the listing quality, the actions improving the listing of a tool.
+const (
+	qualityHintPhotos      = "addPhotos"
+	qualityHintDescription = "extendDescription"
+	qualityHintDimensions  = "addDimensions"
+	qualityHintActivity    = "updateListing"
+)
+
+// qualityFields are the tool fields the listing quality is computed from.
+var qualityFields = []string{"images", "description", "dimensions", "updatedAt"}
+
+// listingQuality returns the quality score (0 to 100) of the listing of the tool, a quarter for
+// each of its photos, a detailed description, its dimensions and a recent activity, with the
+// hints for those it misses. The accepted bookings update the tool, so the update time is also
+// its last booking.
+func listingQuality(tool *db.Tool, now time.Time) *ListingQuality {
+	quality := &ListingQuality{Hints: []string{}}
+	checks := []struct {
+		ok   bool
+		hint string
+	}{
+		{len(tool.Images) > 0, qualityHintPhotos},
+		{len(strings.TrimSpace(tool.Description)) >= qualityDescriptionLength, qualityHintDescription},
+		{!tool.Dimensions.IsEmpty(), qualityHintDimensions},
+		{tool.UpdatedAt != nil && now.Sub(*tool.UpdatedAt) <= qualityActivityAge, qualityHintActivity},
+	}
+	for _, check := range checks {
+		if check.ok {
+			quality.Score += 100 / len(checks)
+		} else {
+			quality.Hints = append(quality.Hints, check.hint)
+		}
+	}
+	return quality
+}
+
+// qualityBoost weights the popularity of the tools by the quality of their listing, up to
+// twice as popular for a complete listing.
+func (a *API) qualityBoost(ctx context.Context, popularity map[int64]float64) error {
+	ids := make([]int64, 0, len(popularity))
+	for id := range popularity {
+		ids = append(ids, id)
+	}
+	tools, err := a.database.ToolService.GetToolsByIDs(ctx, ids, qualityFields...)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, tool := range tools {
+		popularity[tool.ID] *= 1 + float64(listingQuality(tool, now).Score)/100
+	}
+	return nil
+}
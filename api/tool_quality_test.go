@@ -0,0 +1,33 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestListingQuality(t *testing.T) {
+	c := qt.New(t)
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	c.Assert(listingQuality(&db.Tool{Description: "Drill"}, now), qt.DeepEquals, &ListingQuality{
+		Score: 0,
+		Hints: []string{qualityHintPhotos, qualityHintDescription, qualityHintDimensions, qualityHintActivity},
+	})
+
+	updated := now.Add(-30 * 24 * time.Hour)
+	tool := &db.Tool{
+		Images:      []db.Image{{Name: "drill"}},
+		Description: strings.Repeat("a", qualityDescriptionLength),
+		Dimensions:  &db.Dimensions{WeightKg: 2},
+		UpdatedAt:   &updated,
+	}
+	c.Assert(listingQuality(tool, now), qt.DeepEquals, &ListingQuality{Score: 100, Hints: []string{}})
+
+	// A tool not updated nor booked for a while is not active
+	c.Assert(listingQuality(tool, updated.Add(qualityActivityAge+time.Hour)), qt.DeepEquals,
+		&ListingQuality{Score: 75, Hints: []string{qualityHintActivity}})
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// reportToolHandler handles POST /tools/{id}/report
+// It marks the tool as lost or stolen, hiding it from search and flagging its ongoing bookings.
+func (a *API) reportToolHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolReport)
+	if err != nil {
+		return nil, err
+	}
+	if db.IsValidReportStatus(tool.Status) {
+		return nil, ErrToolAlreadyReported.WithErr(fmt.Errorf("tool %d has status %s", tool.ID, tool.Status))
+	}
+	if tool.Status == db.ToolStatusDraft {
+		return nil, ErrToolIsDraft.WithErr(fmt.Errorf("tool %d is not published yet", tool.ID))
+	}
+
+	var req ToolReportRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	status := db.ToolStatus(strings.ToUpper(req.Status))
+	if !db.IsValidReportStatus(status) {
+		return nil, ErrInvalidReportStatus.WithErr(fmt.Errorf("status %q is not valid", req.Status))
+	}
+	if strings.TrimSpace(req.Description) == "" {
+		return nil, ErrEmptyReportDescription.WithErr(fmt.Errorf("description is empty"))
+	}
+
+	// Fall back to the serial number registered on the tool
+	serialNumber := strings.TrimSpace(req.SerialNumber)
+	if serialNumber == "" {
+		serialNumber = tool.SerialNumber
+	}
+
+	ctx := r.Context.Request.Context()
+	report := &db.ToolReport{
+		ToolID:       tool.ID,
+		UserID:       tool.UserID,
+		Status:       status,
+		Description:  req.Description,
+		SerialNumber: serialNumber,
+		ToolTitle:    tool.Title,
+	}
+	if _, err := a.database.ToolReportService.InsertReport(ctx, report); err != nil {
+		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
+	}
+	if _, err := a.database.ToolService.UpdateTool(ctx, tool.ID, bson.M{"status": status}); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	flagged, err := a.database.BookingService.FlagToolBookings(ctx, fmt.Sprintf("%d", tool.ID))
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	log.Info().Msgf("tool %d reported as %s, %d bookings flagged", tool.ID, status, flagged)
+	a.invalidateToolCaches(tool.Location)
+
+	return new(ToolReport).FromDBToolReport(report), nil
+}
+
+// recoverToolHandler handles DELETE /tools/{id}/report
+// It clears the lost or stolen status of a tool, resolves its registry entries and clears the
+// report flag of its bookings.
+func (a *API) recoverToolHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolReport)
+	if err != nil {
+		return nil, err
+	}
+	if !db.IsValidReportStatus(tool.Status) {
+		return nil, ErrToolNotReported.WithErr(fmt.Errorf("tool %d is not reported", tool.ID))
+	}
+
+	ctx := r.Context.Request.Context()
+	if _, err := a.database.ToolReportService.ResolveToolReports(ctx, tool.ID); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if _, err := a.database.ToolService.Collection.UpdateOne(ctx,
+		bson.M{"_id": tool.ID}, bson.M{
+			"$unset":       bson.M{"status": ""},
+			"$currentDate": bson.M{"updatedAt": true},
+		}); err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	unflagged, err := a.database.BookingService.UnflagToolBookings(ctx, fmt.Sprintf("%d", tool.ID))
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	log.Info().Msgf("tool %d recovered, %d bookings unflagged", tool.ID, unflagged)
+	a.invalidateToolCaches(tool.Location)
+	if tool.IsAvailable {
+		go a.notifyFavoriteAvailable(tool)
+	}
+	return nil, nil
+}
+
+// toolRegistryHandler handles GET /tools/registry?serialNumber=
+// It returns the lost or stolen tools matching the given serial number.
+func (a *API) toolRegistryHandler(r *Request) (interface{}, error) {
+	if r.UserID == "" {
+		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	}
+	serial := r.Context.URLParam("serialNumber")
+	if serial == nil || strings.TrimSpace(serial[0]) == "" {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing serialNumber"))
+	}
+
+	reports, err := a.database.ToolReportService.SearchBySerialNumber(
+		r.Context.Request.Context(), strings.TrimSpace(serial[0]))
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	result := []*ToolReport{}
+	for _, report := range reports {
+		result = append(result, new(ToolReport).FromDBToolReport(report))
+	}
+	return &ToolReportsWrapper{Reports: result}, nil
+}
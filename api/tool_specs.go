@@ -0,0 +1,94 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+const (
+	// maxSpecLength is the maximum length of the brand, the model and each accessory and
+	// consumable of a tool.
+	maxSpecLength = 100
+	// maxSpecItems is the maximum number of accessories and of consumables of a tool.
+	maxSpecItems = 20
+	// minSpecYear is the oldest year a tool can be from.
+	minSpecYear = 1900
+)
+
+// toolSpecsFromTool returns the validated specs of the tool, with the texts trimmed and the
+// empty items removed. It returns nil if the tool has no specs or they are all empty.
+func toolSpecsFromTool(t *Tool) (*db.ToolSpecs, error) {
+	if t.Specs == nil {
+		return nil, nil
+	}
+	specs := &db.ToolSpecs{
+		Condition: t.Specs.Condition,
+		Brand:     strings.TrimSpace(t.Specs.Brand),
+		Model:     strings.TrimSpace(t.Specs.Model),
+		Year:      t.Specs.Year,
+		PowerType: t.Specs.PowerType,
+	}
+	if specs.Condition != "" && !db.IsValidToolCondition(specs.Condition) {
+		return nil, ErrInvalidToolSpecs.WithErr(fmt.Errorf("condition %q is not valid", specs.Condition))
+	}
+	if specs.PowerType != "" && !db.IsValidPowerType(specs.PowerType) {
+		return nil, ErrInvalidToolSpecs.WithErr(fmt.Errorf("power type %q is not valid", specs.PowerType))
+	}
+	if len(specs.Brand) > maxSpecLength || len(specs.Model) > maxSpecLength {
+		return nil, ErrInvalidToolSpecs.WithErr(fmt.Errorf("brand or model longer than %d characters", maxSpecLength))
+	}
+	if specs.Year != 0 && (specs.Year < minSpecYear || specs.Year > time.Now().Year()+1) {
+		return nil, ErrInvalidToolSpecs.WithErr(fmt.Errorf("year %d is not valid", specs.Year))
+	}
+	var err error
+	if specs.Accessories, err = specItems("accessories", t.Specs.Accessories); err != nil {
+		return nil, err
+	}
+	if specs.Consumables, err = specItems("consumables", t.Specs.Consumables); err != nil {
+		return nil, err
+	}
+	if specs.IsEmpty() {
+		return nil, nil
+	}
+	return specs, nil
+}
+
+// specItems returns the trimmed non empty items of a list of the specs.
+func specItems(name string, items []string) ([]string, error) {
+	var result []string
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if len(item) > maxSpecLength {
+			return nil, ErrInvalidToolSpecs.WithErr(fmt.Errorf("%s longer than %d characters", name, maxSpecLength))
+		}
+		result = append(result, item)
+	}
+	if len(result) > maxSpecItems {
+		return nil, ErrInvalidToolSpecs.WithErr(fmt.Errorf("more than %d %s", maxSpecItems, name))
+	}
+	return result, nil
+}
+
+// conditions returns the conditions of the tools searched.
+func (q *ToolSearch) conditions() []db.ToolCondition {
+	var conditions []db.ToolCondition
+	for _, condition := range q.Conditions {
+		conditions = append(conditions, db.ToolCondition(condition))
+	}
+	return conditions
+}
+
+// powerTypes returns the power types of the tools searched.
+func (q *ToolSearch) powerTypes() []db.PowerType {
+	var powerTypes []db.PowerType
+	for _, powerType := range q.PowerTypes {
+		powerTypes = append(powerTypes, db.PowerType(powerType))
+	}
+	return powerTypes
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emprius/emprius-app-backend/db"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestToolSpecsFromTool(t *testing.T) {
+	c := qt.New(t)
+
+	specs, err := toolSpecsFromTool(&Tool{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(specs, qt.IsNil)
+
+	// The texts are trimmed and the empty items removed
+	specs, err = toolSpecsFromTool(&Tool{Specs: &db.ToolSpecs{
+		Condition:   db.ConditionGood,
+		Brand:       " Makita ",
+		Year:        2019,
+		PowerType:   db.PowerBattery,
+		Accessories: []string{"case", " ", " 2 batteries"},
+	}})
+	c.Assert(err, qt.IsNil)
+	c.Assert(specs, qt.DeepEquals, &db.ToolSpecs{
+		Condition:   db.ConditionGood,
+		Brand:       "Makita",
+		Year:        2019,
+		PowerType:   db.PowerBattery,
+		Accessories: []string{"case", "2 batteries"},
+	})
+
+	// Empty specs are removed
+	specs, err = toolSpecsFromTool(&Tool{Specs: &db.ToolSpecs{Brand: " ", Consumables: []string{""}}})
+	c.Assert(err, qt.IsNil)
+	c.Assert(specs, qt.IsNil)
+
+	for _, invalid := range []*db.ToolSpecs{
+		{Condition: "broken"},
+		{PowerType: "nuclear"},
+		{Year: 1800},
+		{Year: 3000},
+		{Model: strings.Repeat("x", maxSpecLength+1)},
+		{Accessories: strings.Split(strings.Repeat("a,", maxSpecItems+1), ",")},
+	} {
+		_, err := toolSpecsFromTool(&Tool{Specs: invalid})
+		c.Assert(err, qt.ErrorMatches, "invalid tool specs.*", qt.Commentf("specs %+v", invalid))
+	}
+
+	// The specs filters are part of the search cache key
+	location := &Location{Latitude: 41695384, Longitude: 2492793}
+	battery := searchCacheKey(&ToolSearch{PowerTypes: []string{"battery"}}, location, "")
+	c.Assert(battery, qt.Not(qt.Equals), searchCacheKey(&ToolSearch{}, location, ""))
+	c.Assert(searchCacheKey(&ToolSearch{Brand: "Makita"}, location, ""), qt.Equals,
+		searchCacheKey(&ToolSearch{Brand: " makita"}, location, ""))
+}
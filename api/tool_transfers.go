@@ -0,0 +1,262 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxTransferMessageLength is the maximum length of the message of a tool transfer.
+const maxTransferMessageLength = 500
+
+// transferToolHandler handles POST /tools/{id}/transfer
+// The owner offers the tool to another user, who becomes its owner when accepting it. The
+// recipient is notified.
+func (a *API) transferToolHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolTransfer)
+	if err != nil {
+		return nil, err
+	}
+	var req ToolTransferRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if len(req.Message) > maxTransferMessageLength {
+		return nil, ErrInvalidRequestBodyData.WithErr(
+			fmt.Errorf("message must be at most %d characters", maxTransferMessageLength))
+	}
+	if tool.Community != "" {
+		return nil, ErrCommunityToolTransfer
+	}
+	recipient, err := a.getDBUserByID(req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if recipient.DeletedAt != nil {
+		return nil, ErrUserNotFound.WithErr(fmt.Errorf("user %s is deleted", req.UserID))
+	}
+	if recipient.ID == tool.UserID {
+		return nil, ErrTransferToSelf
+	}
+	ctx := r.Context.Request.Context()
+	if err := a.checkNoOpenBookings(ctx, tool.ID); err != nil {
+		return nil, err
+	}
+
+	transfer := &db.ToolTransfer{
+		ToolID:     tool.ID,
+		ToolTitle:  tool.Title,
+		FromUserID: tool.UserID,
+		ToUserID:   recipient.ID,
+		Message:    req.Message,
+	}
+	if err := a.database.TransferService.CreateTransfer(ctx, transfer); err != nil {
+		if err == db.ErrTransferPending {
+			return nil, ErrTransferPending
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	a.notify(ctx, &db.Notification{
+		UserID:  recipient.ID,
+		Type:    db.NotificationToolTransfer,
+		Message: fmt.Sprintf("You have been offered %s", tool.Title),
+		ToolID:  tool.ID,
+	})
+	return new(ToolTransfer).FromDBToolTransfer(transfer), nil
+}
+
+// transfersHandler handles GET /transfers
+// Returns the pending transfers offered by and to the user.
+func (a *API) transfersHandler(r *Request) (interface{}, error) {
+	userID, err := primitive.ObjectIDFromHex(r.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserID.WithErr(err)
+	}
+	transfers, err := a.database.TransferService.GetUserTransfers(r.Context.Request.Context(), userID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	response := &ToolTransfersWrapper{Sent: []*ToolTransfer{}, Received: []*ToolTransfer{}}
+	for _, transfer := range transfers {
+		if transfer.FromUserID == userID {
+			response.Sent = append(response.Sent, new(ToolTransfer).FromDBToolTransfer(transfer))
+		} else {
+			response.Received = append(response.Received, new(ToolTransfer).FromDBToolTransfer(transfer))
+		}
+	}
+	return response, nil
+}
+
+// acceptTransferHandler handles POST /transfers/{id}/accept
+// The recipient becomes the owner of the tool. The booking history and ratings of the tool
+// are kept, and the admins of the communities of both users are notified.
+func (a *API) acceptTransferHandler(r *Request) (interface{}, error) {
+	transfer, err := a.transferFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.ToUserID.Hex() != r.UserID {
+		return nil, ErrOnlyRecipientCanAnswer
+	}
+	ctx := r.Context.Request.Context()
+	tool, err := a.toolFromDB(transfer.ToolID)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkNoOpenBookings(ctx, tool.ID); err != nil {
+		return nil, err
+	}
+	if err := a.setTransferStatus(ctx, transfer, db.TransferStatusAccepted); err != nil {
+		return nil, err
+	}
+	newID, err := a.moveTool(tool, transfer.ToUserID)
+	if err != nil {
+		if reopenErr := a.database.TransferService.Reopen(ctx, transfer.ID); reopenErr != nil {
+			log.Error().Err(reopenErr).Msgf("could not reopen transfer %s", transfer.ID.Hex())
+		}
+		return nil, err
+	}
+	if err := a.database.TransferService.SetNewToolID(ctx, transfer.ID, newID); err != nil {
+		log.Error().Err(err).Msgf("could not store the new tool ID of transfer %s", transfer.ID.Hex())
+	}
+	transfer.NewToolID = newID
+
+	recipient, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	a.notify(ctx, &db.Notification{
+		UserID:  transfer.FromUserID,
+		Type:    db.NotificationToolTransfer,
+		Message: fmt.Sprintf("%s accepted %s", recipient.Name, tool.Title),
+		ToolID:  newID,
+	})
+	a.notifyTransferCommunities(ctx, transfer, recipient)
+	return &ToolID{ID: newID}, nil
+}
+
+// rejectTransferHandler handles POST /transfers/{id}/reject
+// The recipient declines the tool, the owner is notified.
+func (a *API) rejectTransferHandler(r *Request) (interface{}, error) {
+	transfer, err := a.transferFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.ToUserID.Hex() != r.UserID {
+		return nil, ErrOnlyRecipientCanAnswer
+	}
+	ctx := r.Context.Request.Context()
+	if err := a.setTransferStatus(ctx, transfer, db.TransferStatusRejected); err != nil {
+		return nil, err
+	}
+	a.notify(ctx, &db.Notification{
+		UserID:  transfer.FromUserID,
+		Type:    db.NotificationToolTransfer,
+		Message: fmt.Sprintf("Your transfer of %s was declined", transfer.ToolTitle),
+		ToolID:  transfer.ToolID,
+	})
+	return nil, nil
+}
+
+// cancelTransferHandler handles POST /transfers/{id}/cancel
+// The owner withdraws the offer of the tool.
+func (a *API) cancelTransferHandler(r *Request) (interface{}, error) {
+	transfer, err := a.transferFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.FromUserID.Hex() != r.UserID {
+		return nil, ErrOnlySenderCanCancel
+	}
+	return nil, a.setTransferStatus(r.Context.Request.Context(), transfer, db.TransferStatusCancelled)
+}
+
+// transferFromRequest returns the pending transfer of the URL, if the user is its sender or
+// recipient.
+func (a *API) transferFromRequest(r *Request) (*db.ToolTransfer, error) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r.Context.Request, "id"))
+	if err != nil {
+		return nil, ErrTransferNotFound.WithErr(err)
+	}
+	transfer, err := a.database.TransferService.GetTransfer(r.Context.Request.Context(), id)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrTransferNotFound
+	}
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if transfer.FromUserID.Hex() != r.UserID && transfer.ToUserID.Hex() != r.UserID {
+		return nil, ErrTransferNotFound
+	}
+	if transfer.Status != db.TransferStatusPending {
+		return nil, ErrTransferNotPending
+	}
+	return transfer, nil
+}
+
+// setTransferStatus answers a pending transfer, failing if it was answered in the meantime.
+func (a *API) setTransferStatus(ctx context.Context, transfer *db.ToolTransfer, status db.TransferStatus) error {
+	err := a.database.TransferService.SetStatus(ctx, transfer.ID, status)
+	if err == mongo.ErrNoDocuments {
+		return ErrTransferNotPending
+	}
+	if err != nil {
+		return ErrInternalServerError.WithErr(err)
+	}
+	transfer.Status = status
+	return nil
+}
+
+// checkNoOpenBookings fails if the tool has pending or accepted bookings, which would be
+// answered or returned to the wrong owner once transferred.
+func (a *API) checkNoOpenBookings(ctx context.Context, toolID int64) error {
+	open, err := a.database.BookingService.HasOpenBookings(ctx, strconv.FormatInt(toolID, 10))
+	if err != nil {
+		return ErrInternalServerError.WithErr(err)
+	}
+	if open {
+		return ErrTransferOpenBookings
+	}
+	return nil
+}
+
+// notifyTransferCommunities notifies the admins of the communities the tool was and is now
+// shared in that it changed owner.
+func (a *API) notifyTransferCommunities(ctx context.Context, transfer *db.ToolTransfer, recipient *db.User) {
+	sender, err := a.database.UserService.GetUserByID(ctx, transfer.FromUserID)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not get the sender of transfer %s", transfer.ID.Hex())
+		return
+	}
+	notified := map[primitive.ObjectID]bool{sender.ID: true, recipient.ID: true}
+	for _, community := range []string{sender.Community, recipient.Community} {
+		if community == "" {
+			continue
+		}
+		admins, err := a.database.UserService.GetAdmins(ctx, community)
+		if err != nil {
+			log.Error().Err(err).Msgf("could not get the admins of community %s", community)
+			continue
+		}
+		for _, admin := range admins {
+			if notified[admin.ID] {
+				continue
+			}
+			notified[admin.ID] = true
+			a.notify(ctx, &db.Notification{
+				UserID:  admin.ID,
+				Type:    db.NotificationToolTransfer,
+				Message: fmt.Sprintf("%s gave %s to %s", sender.Name, transfer.ToolTitle, recipient.Name),
+				ToolID:  transfer.NewToolID,
+			})
+		}
+	}
+}
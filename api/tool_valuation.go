@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"github.com/rs/zerolog/log"
+)
+
+// depreciationYear is the period after which a valuation is depreciated.
+const depreciationYear = 365 * 24 * time.Hour
+
+// depreciatedValue returns the value depreciated by the yearly rate for each full year since
+// the date, at least 1. It returns false if no full year has passed or the value does not
+// change.
+func depreciatedValue(value, rate uint64, since, now time.Time) (uint64, bool) {
+	years := now.Sub(since) / depreciationYear
+	depreciated := value
+	for i := time.Duration(0); i < years && depreciated > 1; i++ {
+		depreciated = depreciated * (100 - rate) / 100
+	}
+	if depreciated == 0 {
+		depreciated = 1
+	}
+	return depreciated, depreciated < value
+}
+
+// suggestedValuation returns the yearly depreciation of the estimated value of the tool since
+// its last valuation, or nil if there is nothing to depreciate yet. The tools published before
+// the valuation history was introduced are depreciated since their publication.
+func (a *API) suggestedValuation(ctx context.Context, tool *db.Tool) (*uint64, error) {
+	last, err := a.database.ValuationService.LastValuation(ctx, tool.ID)
+	if err != nil {
+		return nil, err
+	}
+	var since time.Time
+	switch {
+	case last != nil:
+		since = last.CreatedAt
+	case tool.CreatedAt != nil:
+		since = *tool.CreatedAt
+	default:
+		return nil, nil
+	}
+	value, ok := depreciatedValue(tool.EstimatedValue, a.depreciationRate, since, time.Now())
+	if !ok {
+		return nil, nil
+	}
+	return &value, nil
+}
+
+// recordValuation adds the valuation to the history of the tool. The errors are only logged,
+// the valuation of the tool being its estimated value.
+func (a *API) recordValuation(valuation *db.ToolValuation) {
+	if err := a.database.ValuationService.InsertValuation(context.Background(), valuation); err != nil {
+		log.Error().Err(err).Msgf("could not record the valuation of tool %d", valuation.ToolID)
+	}
+}
+
+// recordValuationChange records the estimated value of the edited tool if it changed.
+func (a *API) recordValuationChange(old, updated *db.Tool) {
+	if old.EstimatedValue == updated.EstimatedValue {
+		return
+	}
+	userID := updated.UserID
+	if updated.UpdatedBy != nil {
+		userID = *updated.UpdatedBy
+	}
+	a.recordValuation(&db.ToolValuation{
+		ToolID:   updated.ID,
+		UserID:   userID,
+		Value:    updated.EstimatedValue,
+		Previous: old.EstimatedValue,
+		Source:   db.ValuationEdited,
+	})
+}
+
+// toolValuationsHandler handles GET /tools/{id}/valuations?page=
+// Returns the estimated value of the tool and its valuation history, newest first. The
+// editors of the tool also get the suggested yearly depreciation of the value.
+func (a *API) toolValuationsHandler(r *Request) (interface{}, error) {
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	tool, err := a.toolFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	ctx := r.Context.Request.Context()
+	valuations, err := a.database.ValuationService.GetToolValuations(ctx, tool.ID, page)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	response := &ToolValuations{
+		EstimatedValue: tool.EstimatedValue,
+		History:        make([]*ToolValuation, len(valuations)),
+	}
+	for i, v := range valuations {
+		response.History[i] = new(ToolValuation).FromDBToolValuation(v)
+	}
+	if authorize(policy.ToolEdit, subject, toolResource(tool)) == nil {
+		if response.SuggestedValue, err = a.suggestedValuation(ctx, tool); err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
+		}
+	}
+	return response, nil
+}
+
+// depreciateToolHandler handles POST /tools/{id}/valuations/depreciate
+// It applies the suggested yearly depreciation to the estimated value of the tool.
+func (a *API) depreciateToolHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolEdit)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	value, err := a.suggestedValuation(ctx, tool)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if value == nil {
+		return nil, ErrNoDepreciation.WithErr(fmt.Errorf("tool %d was valued less than a year ago", tool.ID))
+	}
+	updates := map[string]interface{}{"estimatedValue": *value, "updatedBy": subject.ID}
+	if err := a.database.ToolService.UpdateToolVersion(ctx, tool.ID, tool.Version, updates); err != nil {
+		return nil, a.toolVersionError(tool.ID, err)
+	}
+	valuation := &db.ToolValuation{
+		ToolID:   tool.ID,
+		UserID:   subject.ID,
+		Value:    *value,
+		Previous: tool.EstimatedValue,
+		Source:   db.ValuationDepreciation,
+	}
+	a.recordValuation(valuation)
+	a.invalidateToolCaches(tool.Location)
+	log.Info().Msgf("tool %d depreciated from %d to %d", tool.ID, tool.EstimatedValue, *value)
+	return new(ToolValuation).FromDBToolValuation(valuation), nil
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDepreciatedValue(t *testing.T) {
+	c := qt.New(t)
+
+	since := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Nothing to depreciate before a full year
+	value, ok := depreciatedValue(200, 10, since, since.Add(364*24*time.Hour))
+	c.Assert(ok, qt.IsFalse)
+	c.Assert(value, qt.Equals, uint64(200))
+
+	// Each full year loses the rate of the previous value
+	value, ok = depreciatedValue(200, 10, since, since.Add(depreciationYear))
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(value, qt.Equals, uint64(180))
+	value, ok = depreciatedValue(200, 10, since, since.Add(2*depreciationYear+time.Hour))
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(value, qt.Equals, uint64(162))
+
+	// The value is at least 1
+	value, ok = depreciatedValue(3, 50, since, since.Add(10*depreciationYear))
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(value, qt.Equals, uint64(1))
+	_, ok = depreciatedValue(1, 50, since, since.Add(10*depreciationYear))
+	c.Assert(ok, qt.IsFalse)
+
+	// A full rate leaves the minimum value
+	value, ok = depreciatedValue(500, 100, since, since.Add(depreciationYear))
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(value, qt.Equals, uint64(1))
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxVisibleCommunities is the maximum number of communities a tool can be visible to.
+const maxVisibleCommunities = 20
+
+// toolVisibilityFromTool returns the validated visibility of the tool and the communities it
+// is visible to. Without visibility, the community tools are visible to their community and
+// the personal tools are public. The owner community is the audience of the personal tools
+// visible to the community, so the owner must belong to one.
+func toolVisibilityFromTool(t *Tool, community, ownerCommunity string) (db.ToolVisibility, []string, error) {
+	visibility := db.ToolVisibility(t.Visibility)
+	if visibility == "" {
+		visibility = db.VisibilityPublic
+		if community != "" {
+			visibility = db.VisibilityCommunity
+		}
+	}
+	if !db.IsValidToolVisibility(visibility) {
+		return "", nil, ErrInvalidToolVisibility.WithErr(fmt.Errorf("visibility %q is not valid", t.Visibility))
+	}
+	switch visibility {
+	case db.VisibilityCommunity:
+		if community == "" && ownerCommunity == "" {
+			return "", nil, ErrInvalidToolVisibility.WithErr(fmt.Errorf("the owner does not belong to a community"))
+		}
+	case db.VisibilityCommunities:
+		var visibleTo []string
+		for _, c := range t.VisibleTo {
+			if c = strings.TrimSpace(c); c != "" && !slices.Contains(visibleTo, c) {
+				visibleTo = append(visibleTo, c)
+			}
+		}
+		if len(visibleTo) == 0 || len(visibleTo) > maxVisibleCommunities {
+			return "", nil, ErrInvalidToolVisibility.WithErr(
+				fmt.Errorf("the tool must be visible to between 1 and %d communities", maxVisibleCommunities))
+		}
+		return visibility, visibleTo, nil
+	}
+	return visibility, nil, nil
+}
+
+// toolVisibility returns the visibility of the tool, for the tools not migrated yet the
+// visibility they had before it was introduced.
+func toolVisibility(tool *db.Tool) db.ToolVisibility {
+	if tool.Visibility == "" && tool.Community != "" {
+		return db.VisibilityCommunity
+	}
+	if tool.Visibility == "" {
+		return db.VisibilityPublic
+	}
+	return tool.Visibility
+}
+
+// isRestricted returns true if the tool is not visible to every user.
+func isRestricted(tool *db.Tool) bool {
+	return toolVisibility(tool) != db.VisibilityPublic
+}
+
+// toolViewResource returns the policy resource of the visibility of a tool, given the
+// community of its owner.
+func toolViewResource(tool *db.Tool, ownerCommunity string) policy.Resource {
+	resource := toolResource(tool)
+	switch toolVisibility(tool) {
+	case db.VisibilityCommunity:
+		resource.Restricted = true
+		if tool.Community != "" {
+			resource.Audience = []string{tool.Community}
+		} else if ownerCommunity != "" {
+			resource.Audience = []string{ownerCommunity}
+		}
+	case db.VisibilityCommunities:
+		resource.Restricted, resource.Audience = true, tool.VisibleTo
+	}
+	return resource
+}
+
+// authorizeToolView checks the subject can see the tool, loading its owner only if the
+// tool is restricted.
+func (a *API) authorizeToolView(ctx context.Context, subject policy.Subject, tool *db.Tool) error {
+	if !isRestricted(tool) {
+		return nil
+	}
+	owner, err := a.database.UserService.GetUserByID(ctx, tool.UserID)
+	if err != nil {
+		return ErrUserNotFound.WithErr(fmt.Errorf("tool owner not found: %w", err))
+	}
+	return authorize(policy.ToolView, subject, toolViewResource(tool, owner.Community))
+}
+
+// authorizeToolRead returns ErrToolNotFound if the subject cannot see the tool, as if it did
+// not exist: the tools restricted to other communities and the drafts the subject cannot edit.
+func (a *API) authorizeToolRead(ctx context.Context, subject policy.Subject, tool *db.Tool) error {
+	if err := a.authorizeToolView(ctx, subject, tool); err != nil {
+		return ErrToolNotFound.WithErr(err)
+	}
+	return authorizeDraftView(subject, tool)
+}
+
+// canSeeToolIdentifiers returns true if the subject can see the serial number and the asset tag
+// of the tool: those who can edit it (the owner or the community admins of shared tools, and the
+// managers) and the admins.
+func canSeeToolIdentifiers(subject policy.Subject, tool *db.Tool) bool {
+	return subject.Admin || policy.Check(policy.ToolEdit, subject, toolResource(tool)) == nil
+}
+
+// readableTools returns the tools the user can see, in the same order. The user is only
+// loaded if some tool is restricted or a draft.
+func (a *API) readableTools(ctx context.Context, userID string, tools []*db.Tool) ([]*db.Tool, error) {
+	readable := []*db.Tool{}
+	var subject *policy.Subject
+	for _, tool := range tools {
+		if isRestricted(tool) || tool.Status == db.ToolStatusDraft {
+			if subject == nil {
+				s, err := a.subject(userID)
+				if err != nil {
+					return nil, err
+				}
+				subject = &s
+			}
+			if a.authorizeToolRead(ctx, *subject, tool) != nil {
+				continue
+			}
+		}
+		readable = append(readable, tool)
+	}
+	return readable, nil
+}
+
+// toolViewer returns the viewer of the tools searched by the user, that also finds the tools
+// restricted to its community.
+func (a *API) toolViewer(ctx context.Context, user *db.User) (*db.ToolViewer, error) {
+	if user.Community == "" {
+		return nil, nil
+	}
+	members, err := a.database.UserService.GetCommunityMemberIDs(ctx, user.Community)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return &db.ToolViewer{Community: user.Community, Members: members}, nil
+}
+
+// visibleTools returns the tools the subject can see, given the community of their owner.
+func visibleTools(subject policy.Subject, ownerCommunity string, tools []*db.Tool) []*db.Tool {
+	visible := []*db.Tool{}
+	for _, tool := range tools {
+		if isRestricted(tool) && policy.Check(policy.ToolView, subject, toolViewResource(tool, ownerCommunity)) != nil {
+			continue
+		}
+		visible = append(visible, tool)
+	}
+	return visible
+}
+
+// canViewTool returns true if the user can see the tool, used to skip the notifications
+// about tools the user cannot see.
+func (a *API) canViewTool(ctx context.Context, userID primitive.ObjectID, tool *db.Tool) bool {
+	if !isRestricted(tool) {
+		return true
+	}
+	user, err := a.database.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return false
+	}
+	return a.authorizeToolView(ctx, subjectFromDBUser(user), tool) == nil
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"cmp"
 	"context"
 	"crypto/sha256"
 	"encoding/binary"
@@ -8,11 +9,14 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/policy"
 	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -28,6 +32,32 @@ func (a *API) toolCategories() []db.ToolCategory {
 	return result
 }
 
+// categoryTree returns the hierarchy of the tool categories.
+func (a *API) categoryTree() db.CategoryTree {
+	categories, err := a.database.ToolCategoryService.GetAllToolCategories(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	return db.NewCategoryTree(categories)
+}
+
+// validToolCategory returns true if the category exists. Zero means no category.
+func (a *API) validToolCategory(id int) bool {
+	if id == 0 {
+		return true
+	}
+	_, ok := a.categoryTree()[id]
+	return ok
+}
+
+// setBreadcrumbs sets the category path of the tools.
+func (a *API) setBreadcrumbs(tools ...*Tool) {
+	tree := a.categoryTree()
+	for _, t := range tools {
+		t.Breadcrumbs = tree.Breadcrumbs(t.Category)
+	}
+}
+
 func (a *API) addTool(t *Tool, userID string) (int64, error) {
 	// check if images are in database
 	images, err := a.imageListFromSlice(t.Images)
@@ -45,7 +75,9 @@ func (a *API) addTool(t *Tool, userID string) (int64, error) {
 	if t.Title == "" || t.Description == "" {
 		return 0, ErrEmptyTitleOrDescription.WithErr(fmt.Errorf("title or description is empty"))
 	}
-	if t.EstimatedValue == 0 {
+	// The drafts can be incomplete, they are validated when published
+	draft := db.ToolStatus(strings.ToUpper(t.Status)) == db.ToolStatusDraft
+	if t.EstimatedValue == 0 && !draft {
 		return 0, ErrInvalidEstimatedValue.WithErr(fmt.Errorf("estimated value must be greater than 0"))
 	}
 	if t.MayBeFree == nil {
@@ -57,49 +89,132 @@ func (a *API) addTool(t *Tool, userID string) (int64, error) {
 	if t.Cost == nil {
 		return 0, ErrCostRequired.WithErr(fmt.Errorf("cost field is required"))
 	}
+	usageTerms, err := usageTermsFromTool(t)
+	if err != nil {
+		return 0, err
+	}
+	pricingMode, suggestedAmount, err := pricingFromTool(t)
+	if err != nil {
+		return 0, err
+	}
+	cancellationPolicy, err := cancellationPolicyFromTool(t)
+	if err != nil {
+		return 0, err
+	}
+	specs, err := toolSpecsFromTool(t)
+	if err != nil {
+		return 0, err
+	}
+	dimensions, err := toolDimensionsFromTool(t, nil)
+	if err != nil {
+		return 0, err
+	}
+	autoAccept, err := autoAcceptFromTool(t)
+	if err != nil {
+		return 0, err
+	}
+	availability, err := availabilityFromTool(t)
+	if err != nil {
+		return 0, err
+	}
 	user, err := a.getUserByID(userID)
 	if err != nil {
 		return 0, ErrUserNotFound.WithErr(err)
 	}
-	if t.Category < 0 || t.Category >= len(a.toolCategories()) {
+	// Shared community tools are registered by the admins of the community. With the tool
+	// approval enabled, the members can also share tools, listed once an admin approves them.
+	community := strings.TrimSpace(t.Community)
+	pendingApproval := false
+	if community != "" {
+		subject, err := a.subject(userID)
+		if err != nil {
+			return 0, err
+		}
+		if err := authorize(policy.CommunityModerate, subject, policy.Resource{Community: community}); err != nil {
+			if !a.toolApproval {
+				return 0, err
+			}
+			if err := authorize(policy.CommunityContent, subject, policy.Resource{Community: community}); err != nil {
+				return 0, err
+			}
+			pendingApproval = true
+		}
+		if subject.Community != community {
+			return 0, ErrNotCommunityMember.WithErr(fmt.Errorf("user is not a member of community %s", community))
+		}
+	}
+	visibility, visibleTo, err := toolVisibilityFromTool(t, community, user.Community)
+	if err != nil {
+		return 0, err
+	}
+	if !a.validToolCategory(t.Category) {
 		return 0, ErrInvalidToolCategory.WithErr(fmt.Errorf("category %d is not valid", t.Category))
 	}
 
 	// Validate and convert transport options
-	transports, err := a.database.TransportService.GetAllTransports(context.Background())
+	transportOptions, err := a.transportOptionsFromTool(t)
 	if err != nil {
-		return 0, ErrInternalServerError.WithErr(err)
+		return 0, err
 	}
-	validTransportIDs := make(map[int64]bool)
-	for _, t := range transports {
-		validTransportIDs[t.ID] = true
+
+	location, locality, err := a.resolveLocation(context.Background(), &t.Location, t.Address)
+	if err != nil {
+		return 0, err
+	}
+	if location == nil {
+		l := t.Location.ToDBLocation()
+		location = &l
 	}
 
-	transportOptions := make([]db.Transport, len(t.TransportOptions))
-	for i, id := range t.TransportOptions {
-		if !validTransportIDs[int64(id)] {
-			return 0, ErrInvalidTransportOption.WithErr(fmt.Errorf("transport option %d is not valid", id))
-		}
-		transportOptions[i] = db.Transport{ID: int64(id)}
+	newToolID := toolID(userID, t.Title)
+	var serialNumber, assetTag string
+	if t.SerialNumber != nil {
+		serialNumber = strings.TrimSpace(*t.SerialNumber)
+	}
+	if t.AssetTag != nil {
+		assetTag = strings.TrimSpace(*t.AssetTag)
+	}
+	if err := a.checkToolIdentifiers(user.ObjectID(), newToolID, serialNumber, assetTag); err != nil {
+		return 0, err
 	}
 
 	dbTool := db.Tool{
-		ID:               toolID(userID, t.Title),
-		UserID:           user.ObjectID(),
-		Title:            db.SanitizeString(t.Title),
-		Description:      t.Description,
-		IsAvailable:      true,
-		MayBeFree:        *t.MayBeFree,
-		AskWithFee:       *t.AskWithFee,
-		Cost:             *t.Cost,
-		ToolCategory:     t.Category,
-		Rating:           50,
-		EstimatedValue:   t.EstimatedValue,
-		Height:           t.Height,
-		Weight:           t.Weight,
-		Images:           dbImages,
-		Location:         t.Location.ToDBLocation(),
-		TransportOptions: transportOptions,
+		ID:                 newToolID,
+		UserID:             user.ObjectID(),
+		Title:              db.SanitizeString(t.Title),
+		Description:        t.Description,
+		IsAvailable:        true,
+		MayBeFree:          *t.MayBeFree,
+		AskWithFee:         *t.AskWithFee,
+		Cost:               *t.Cost,
+		ToolCategory:       t.Category,
+		Rating:             50,
+		EstimatedValue:     t.EstimatedValue,
+		Images:             dbImages,
+		Location:           *location,
+		Locality:           locality,
+		TransportOptions:   transportOptions,
+		SerialNumber:       serialNumber,
+		AssetTag:           assetTag,
+		OwnerTrustScore:    user.TrustScore,
+		Community:          community,
+		PendingApproval:    pendingApproval,
+		Visibility:         visibility,
+		VisibleTo:          visibleTo,
+		UsageTerms:         usageTerms,
+		PricingMode:        pricingMode,
+		SuggestedAmount:    suggestedAmount,
+		CancellationPolicy: cancellationPolicy,
+		Specs:              specs,
+		Dimensions:         dimensions,
+		AutoAccept:         autoAccept,
+		Availability:       availability,
+	}
+	if usageTerms != "" {
+		dbTool.UsageTermsVersion = 1
+	}
+	if draft {
+		dbTool.Status = db.ToolStatusDraft
 	}
 	log.Info().Msgf("adding tool to database, title: %s, user: %s, id: %d", t.Title, userID, dbTool.ID)
 
@@ -107,10 +222,47 @@ func (a *API) addTool(t *Tool, userID string) (int64, error) {
 	if err != nil {
 		return 0, ErrCouldNotInsertToDatabase.WithErr(err)
 	}
+	if dbTool.EstimatedValue > 0 {
+		a.recordValuation(&db.ToolValuation{
+			ToolID: dbTool.ID,
+			UserID: dbTool.UserID,
+			Value:  dbTool.EstimatedValue,
+			Source: db.ValuationCreated,
+		})
+	}
+	if !draft {
+		a.invalidateToolCaches(dbTool.Location)
+		go a.notifySavedSearches(&dbTool)
+	}
 
 	return dbTool.ID, nil
 }
 
+// checkToolIdentifiers verifies the serial number and asset tag of a tool are not used by
+// any other tool of the same owner. Empty identifiers are not checked.
+func (a *API) checkToolIdentifiers(ownerID primitive.ObjectID, id int64, serialNumber, assetTag string) error {
+	ctx := context.Background()
+	if serialNumber != "" {
+		taken, err := a.database.ToolService.IsIdentifierTaken(ctx, ownerID, "serialNumber", serialNumber, id)
+		if err != nil {
+			return ErrInternalServerError.WithErr(err)
+		}
+		if taken {
+			return ErrDuplicateSerialNumber.WithErr(fmt.Errorf("serial number %q", serialNumber))
+		}
+	}
+	if assetTag != "" {
+		taken, err := a.database.ToolService.IsIdentifierTaken(ctx, ownerID, "assetTag", assetTag, id)
+		if err != nil {
+			return ErrInternalServerError.WithErr(err)
+		}
+		if taken {
+			return ErrDuplicateAssetTag.WithErr(fmt.Errorf("asset tag %q", assetTag))
+		}
+	}
+	return nil
+}
+
 func toolID(ownerID string, title string) int64 {
 	hasher := sha256.New()
 	hasher.Write([]byte(fmt.Sprintf("%s-%s", ownerID, title)))
@@ -119,8 +271,57 @@ func toolID(ownerID string, title string) int64 {
 	return int64(math.Abs(float64(int64(binary.BigEndian.Uint32(hash[:4])))))
 }
 
-func (a *API) toolFromDB(id int64) (*db.Tool, error) {
-	tool, err := a.database.ToolService.GetToolByID(context.Background(), id)
+// moveTool assigns the tool to a new owner. The tool ID depends on the owner, so the tool
+// is replaced by a copy with the new ID and its favorites are moved. It returns the new ID.
+func (a *API) moveTool(tool *db.Tool, newOwner primitive.ObjectID) (int64, error) {
+	ctx := context.Background()
+	moved := *tool
+	moved.ID = toolID(newOwner.Hex(), tool.Title)
+	moved.UserID = newOwner
+	// The managers were chosen by the previous owner
+	moved.Managers = nil
+	if existing, err := a.database.ToolService.GetToolByID(ctx, moved.ID); err == nil && existing != nil {
+		return 0, ErrToolTransferConflict.WithErr(fmt.Errorf("tool %q already exists", tool.Title))
+	}
+	if err := a.checkToolIdentifiers(newOwner, moved.ID, moved.SerialNumber, moved.AssetTag); err != nil {
+		return 0, err
+	}
+
+	if err := a.deleteTool(tool.ID); err != nil {
+		return 0, err
+	}
+	if _, err := a.database.ToolService.InsertTool(ctx, &moved); err != nil {
+		if _, restoreErr := a.database.ToolService.InsertTool(ctx, tool); restoreErr != nil {
+			log.Error().Err(restoreErr).Msg("failed to restore tool after move failure")
+		}
+		return 0, ErrInternalServerError.WithErr(err)
+	}
+	if err := a.database.FavoriteService.UpdateToolID(ctx, tool.ID, moved.ID); err != nil {
+		log.Error().Err(err).Msgf("could not move favorites of tool %d to %d", tool.ID, moved.ID)
+	}
+	if err := a.database.MaintenanceService.UpdateToolID(ctx, tool.ID, moved.ID); err != nil {
+		log.Error().Err(err).Msgf("could not move the maintenance log of tool %d to %d", tool.ID, moved.ID)
+	}
+	if err := a.database.ToolViewService.UpdateToolID(ctx, tool.ID, moved.ID); err != nil {
+		log.Error().Err(err).Msgf("could not move the views of tool %d to %d", tool.ID, moved.ID)
+	}
+	if err := a.database.ValuationService.UpdateToolID(ctx, tool.ID, moved.ID); err != nil {
+		log.Error().Err(err).Msgf("could not move the valuation history of tool %d to %d", tool.ID, moved.ID)
+	}
+	// The bookings keep their owner, so the ratings of the previous owner are kept too
+	oldID, newID := strconv.FormatInt(tool.ID, 10), strconv.FormatInt(moved.ID, 10)
+	if err := a.database.BookingService.UpdateToolID(ctx, oldID, newID); err != nil {
+		log.Error().Err(err).Msgf("could not move the bookings of tool %d to %d", tool.ID, moved.ID)
+	}
+	if err := a.database.TransferService.CancelToolTransfers(ctx, tool.ID); err != nil {
+		log.Error().Err(err).Msgf("could not cancel the transfers of tool %d", tool.ID)
+	}
+	a.invalidateToolCaches(tool.Location)
+	return moved.ID, nil
+}
+
+func (a *API) toolFromDB(id int64, fields ...string) (*db.Tool, error) {
+	tool, err := a.database.ToolService.GetToolByID(context.Background(), id, fields...)
 	if err == mongo.ErrNoDocuments {
 		return nil, ErrToolNotFound.WithErr(fmt.Errorf("tool with id %d not found", id))
 	}
@@ -130,27 +331,33 @@ func (a *API) toolFromDB(id int64) (*db.Tool, error) {
 	return tool, nil
 }
 
-func (a *API) tool(id int64) (*Tool, error) {
-	tool, err := a.toolFromDB(id)
-	if err != nil {
-		return nil, err
-	}
-	return new(Tool).FromDBTool(tool), nil
-}
-
-func (a *API) toolsByUserID(userID string) ([]*Tool, error) {
+// toolsByUserID returns the tools of the user, only those the viewer can see if set. The
+// identifiers of the tools are only shown to the viewer if it can see them.
+func (a *API) toolsByUserID(userID string, viewer *policy.Subject, fields ...string) ([]*Tool, error) {
 	user, err := a.getUserByID(userID)
 	if err != nil {
 		return nil, ErrUserNotFound.WithErr(err)
 	}
-	tools, err := a.database.ToolService.GetToolsByUserID(context.Background(), user.ObjectID())
+	tools, err := a.database.ToolService.GetToolsByUserID(context.Background(), user.ObjectID(), fields...)
 	if err != nil {
 		return nil, ErrInternalServerError.WithErr(err)
 	}
+	if viewer != nil {
+		tools = visibleTools(*viewer, user.Community, tools)
+	}
 	result := []*Tool{}
 	for _, t := range tools {
-		result = append(result, new(Tool).FromDBTool(t))
+		// The drafts are only listed to their owner
+		if viewer != nil && t.Status == db.ToolStatusDraft {
+			continue
+		}
+		tool := new(Tool).FromDBTool(t)
+		if viewer == nil || canSeeToolIdentifiers(*viewer, t) {
+			showToolIdentifiers(tool)
+		}
+		result = append(result, tool)
 	}
+	a.setBreadcrumbs(result...)
 	return result, nil
 }
 
@@ -162,6 +369,13 @@ func (a *API) editTool(id int64, newTool *Tool, userID string) (int64, error) {
 	if tool == nil {
 		return 0, ErrToolNotFound.WithErr(fmt.Errorf("tool with id %d not found", id))
 	}
+	if newTool.Version == nil {
+		return 0, ErrVersionRequired
+	}
+	version := *newTool.Version
+	if version != tool.Version {
+		return 0, ErrVersionConflict.WithData(&VersionConflict{Version: tool.Version})
+	}
 
 	// Create a copy of the tool for potential restoration
 	oldTool := *tool
@@ -169,8 +383,8 @@ func (a *API) editTool(id int64, newTool *Tool, userID string) (int64, error) {
 	// Update all provided fields
 	if newTool.Title != "" {
 		tool.Title = db.SanitizeString(newTool.Title)
-		// Calculate new ID based on new title
-		tool.ID = toolID(userID, tool.Title)
+		// Calculate new ID based on new title, the editor may be a manager of the tool
+		tool.ID = toolID(tool.UserID.Hex(), tool.Title)
 	}
 	if newTool.Description != "" {
 		tool.Description = newTool.Description
@@ -187,24 +401,90 @@ func (a *API) editTool(id int64, newTool *Tool, userID string) (int64, error) {
 	if newTool.EstimatedValue != 0 {
 		tool.EstimatedValue = newTool.EstimatedValue
 	}
-	if newTool.Height != 0 {
-		tool.Height = newTool.Height
-	}
-	if newTool.Weight != 0 {
-		tool.Weight = newTool.Weight
+	if tool.Dimensions, err = toolDimensionsFromTool(newTool, tool.Dimensions); err != nil {
+		return 0, err
 	}
 	if newTool.Category != 0 {
-		if newTool.Category < 0 || newTool.Category >= len(a.toolCategories()) {
+		if !a.validToolCategory(newTool.Category) {
 			return 0, ErrInvalidToolCategory.WithErr(fmt.Errorf("category %d is not valid", newTool.Category))
 		}
 		tool.ToolCategory = newTool.Category
 	}
-	if newTool.Location.Latitude != 0 || newTool.Location.Longitude != 0 {
-		tool.Location = newTool.Location.ToDBLocation()
+	location, locality, err := a.resolveLocation(context.Background(), &newTool.Location, newTool.Address)
+	if err != nil {
+		return 0, err
+	}
+	if location != nil {
+		tool.Location = *location
+		tool.Locality = locality
 	}
 	if newTool.IsAvailable != nil {
 		tool.IsAvailable = *newTool.IsAvailable
 	}
+	if newTool.SerialNumber != nil {
+		tool.SerialNumber = strings.TrimSpace(*newTool.SerialNumber)
+	}
+	if newTool.AssetTag != nil {
+		tool.AssetTag = strings.TrimSpace(*newTool.AssetTag)
+	}
+	if newTool.UsageTerms != nil {
+		usageTerms, err := usageTermsFromTool(newTool)
+		if err != nil {
+			return 0, err
+		}
+		// Renters accept a specific version, so any change makes a new one
+		if usageTerms != tool.UsageTerms {
+			tool.UsageTerms = usageTerms
+			tool.UsageTermsVersion++
+		}
+	}
+	if newTool.PricingMode != "" {
+		if tool.PricingMode, _, err = pricingFromTool(newTool); err != nil {
+			return 0, err
+		}
+	}
+	if newTool.CancellationPolicy != "" {
+		if tool.CancellationPolicy, err = cancellationPolicyFromTool(newTool); err != nil {
+			return 0, err
+		}
+	}
+	if newTool.Specs != nil {
+		if tool.Specs, err = toolSpecsFromTool(newTool); err != nil {
+			return 0, err
+		}
+	}
+	if newTool.AutoAccept != nil {
+		if tool.AutoAccept, err = autoAcceptFromTool(newTool); err != nil {
+			return 0, err
+		}
+	}
+	if newTool.Availability != nil {
+		if tool.Availability, err = availabilityFromTool(newTool); err != nil {
+			return 0, err
+		}
+	}
+	// The tools not migrated yet keep the visibility they had
+	tool.Visibility = toolVisibility(tool)
+	if newTool.Visibility != "" || newTool.VisibleTo != nil {
+		// The visible communities can be changed alone, keeping the visibility
+		requested := &Tool{Visibility: cmp.Or(newTool.Visibility, string(tool.Visibility)), VisibleTo: newTool.VisibleTo}
+		owner, err := a.database.UserService.GetUserByID(context.Background(), tool.UserID)
+		if err != nil {
+			return 0, ErrUserNotFound.WithErr(err)
+		}
+		if tool.Visibility, tool.VisibleTo, err = toolVisibilityFromTool(requested, tool.Community, owner.Community); err != nil {
+			return 0, err
+		}
+	}
+	// Only pay what you want tools have a suggested amount, kept unless a new one is given
+	if tool.Pricing() != db.PricingPayWhatYouWant {
+		tool.SuggestedAmount = 0
+	} else if newTool.SuggestedAmount != nil {
+		tool.SuggestedAmount = *newTool.SuggestedAmount
+	}
+	if err := a.checkToolIdentifiers(tool.UserID, oldTool.ID, tool.SerialNumber, tool.AssetTag); err != nil {
+		return 0, err
+	}
 	if len(newTool.Images) > 0 {
 		images, err := a.imageListFromSlice(newTool.Images)
 		if err != nil {
@@ -219,29 +499,26 @@ func (a *API) editTool(id int64, newTool *Tool, userID string) (int64, error) {
 		}
 		tool.Images = dbImages
 	}
-	if len(newTool.TransportOptions) > 0 {
+	if len(newTool.TransportOptions) > 0 || newTool.Transports != nil {
 		// Validate and convert transport options
-		transports, err := a.database.TransportService.GetAllTransports(context.Background())
-		if err != nil {
-			return 0, ErrInternalServerError.WithErr(err)
-		}
-		validTransportIDs := make(map[int64]bool)
-		for _, t := range transports {
-			validTransportIDs[t.ID] = true
+		if tool.TransportOptions, err = a.transportOptionsFromTool(newTool); err != nil {
+			return 0, err
 		}
+	}
 
-		transportOptions := make([]db.Transport, len(newTool.TransportOptions))
-		for i, id := range newTool.TransportOptions {
-			if !validTransportIDs[int64(id)] {
-				return 0, ErrInvalidTransportOption.WithErr(fmt.Errorf("transport option %d is not valid", id))
-			}
-			transportOptions[i] = db.Transport{ID: int64(id)}
-		}
-		tool.TransportOptions = transportOptions
+	if editor, err := primitive.ObjectIDFromHex(userID); err == nil {
+		tool.UpdatedBy = &editor
 	}
 
 	// If title changed, we need to handle the tool replacement
 	if newTool.Title != "" {
+		// Take the version first, so a concurrent edit cannot be replaced
+		if err := a.database.ToolService.UpdateToolVersion(context.Background(), oldTool.ID, version,
+			map[string]interface{}{"updatedBy": tool.UpdatedBy}); err != nil {
+			return 0, a.toolVersionError(oldTool.ID, err)
+		}
+		tool.Version = version + 1
+		oldTool.Version = version + 1
 		// Delete the old tool first
 		if err := a.deleteTool(oldTool.ID); err != nil {
 			return 0, err
@@ -258,55 +535,173 @@ func (a *API) editTool(id int64, newTool *Tool, userID string) (int64, error) {
 			}
 			return 0, ErrInternalServerError.WithErr(err)
 		}
+		if err := a.database.FavoriteService.UpdateToolID(context.Background(), oldTool.ID, tool.ID); err != nil {
+			log.Error().Err(err).Msgf("could not move favorites of tool %d to %d", oldTool.ID, tool.ID)
+		}
+		if err := a.database.MaintenanceService.UpdateToolID(context.Background(), oldTool.ID, tool.ID); err != nil {
+			log.Error().Err(err).Msgf("could not move the maintenance log of tool %d to %d", oldTool.ID, tool.ID)
+		}
+		if err := a.database.ToolViewService.UpdateToolID(context.Background(), oldTool.ID, tool.ID); err != nil {
+			log.Error().Err(err).Msgf("could not move the views of tool %d to %d", oldTool.ID, tool.ID)
+		}
+		if err := a.database.ValuationService.UpdateToolID(context.Background(), oldTool.ID, tool.ID); err != nil {
+			log.Error().Err(err).Msgf("could not move the valuation history of tool %d to %d", oldTool.ID, tool.ID)
+		}
+		if err := a.database.TransferService.UpdateToolID(context.Background(), oldTool.ID, tool.ID); err != nil {
+			log.Error().Err(err).Msgf("could not move the transfers of tool %d to %d", oldTool.ID, tool.ID)
+		}
+		oldID, newID := strconv.FormatInt(oldTool.ID, 10), strconv.FormatInt(tool.ID, 10)
+		if err := a.database.BookingService.UpdateToolID(context.Background(), oldID, newID); err != nil {
+			log.Error().Err(err).Msgf("could not move the bookings of tool %d to %d", oldTool.ID, tool.ID)
+		}
+		a.recordValuationChange(&oldTool, tool)
+		a.invalidateToolCaches(oldTool.Location, tool.Location)
+		go a.notifySavedSearches(tool)
+		if !oldTool.IsAvailable && tool.IsAvailable {
+			go a.notifyFavoriteAvailable(tool)
+		}
 		return tool.ID, nil
 	}
 
 	// For updates without title change, just update the fields
 	updates := map[string]interface{}{
-		"title":            tool.Title,
-		"description":      tool.Description,
-		"isAvailable":      tool.IsAvailable,
-		"mayBeFree":        tool.MayBeFree,
-		"askWithFee":       tool.AskWithFee,
-		"cost":             tool.Cost,
-		"toolCategory":     tool.ToolCategory,
-		"estimatedValue":   tool.EstimatedValue,
-		"height":           tool.Height,
-		"weight":           tool.Weight,
-		"images":           tool.Images,
-		"location":         tool.Location,
-		"transportOptions": tool.TransportOptions,
-	}
-	err = a.database.ToolService.UpdateToolFields(context.Background(), id, updates)
-	if err != nil {
-		return 0, ErrInternalServerError.WithErr(err)
+		"title":              tool.Title,
+		"description":        tool.Description,
+		"isAvailable":        tool.IsAvailable,
+		"mayBeFree":          tool.MayBeFree,
+		"askWithFee":         tool.AskWithFee,
+		"cost":               tool.Cost,
+		"toolCategory":       tool.ToolCategory,
+		"estimatedValue":     tool.EstimatedValue,
+		"dimensions":         tool.Dimensions,
+		"images":             tool.Images,
+		"location":           tool.Location,
+		"locality":           tool.Locality,
+		"transportOptions":   tool.TransportOptions,
+		"usageTerms":         tool.UsageTerms,
+		"usageTermsVersion":  tool.UsageTermsVersion,
+		"pricingMode":        tool.PricingMode,
+		"suggestedAmount":    tool.SuggestedAmount,
+		"cancellationPolicy": tool.CancellationPolicy,
+		"specs":              tool.Specs,
+		"visibility":         tool.Visibility,
+		"visibleTo":          tool.VisibleTo,
+		"autoAccept":         tool.AutoAccept,
+		"availability":       tool.Availability,
+		"updatedBy":          tool.UpdatedBy,
+	}
+	// Empty identifiers are removed, empty strings would collide on the per-owner unique indexes
+	var unset []string
+	if tool.SerialNumber != "" {
+		updates["serialNumber"] = tool.SerialNumber
+	} else {
+		unset = append(unset, "serialNumber")
+	}
+	if tool.AssetTag != "" {
+		updates["assetTag"] = tool.AssetTag
+	} else {
+		unset = append(unset, "assetTag")
+	}
+	if err := a.database.ToolService.UpdateToolVersion(context.Background(), id, version, updates, unset...); err != nil {
+		return 0, a.toolVersionError(id, err)
+	}
+	a.recordValuationChange(&oldTool, tool)
+	a.invalidateToolCaches(oldTool.Location, tool.Location)
+	go a.notifySavedSearches(tool)
+	if !oldTool.IsAvailable && tool.IsAvailable {
+		go a.notifyFavoriteAvailable(tool)
 	}
 	return id, nil
 }
 
-func (a *API) toolSearch(query *ToolSearch, userLocation *Location) ([]*Tool, error) {
-	// Convert user location to GeoJSON format for MongoDB
-	searchLocation := db.NewLocation(userLocation.Latitude, userLocation.Longitude)
+// toolVersionError returns the API error of a failed versioned update of the tool. A version
+// conflict includes the current version of the tool.
+func (a *API) toolVersionError(id int64, err error) error {
+	switch err {
+	case mongo.ErrNoDocuments:
+		return ErrToolNotFound.WithErr(fmt.Errorf("tool with id %d not found", id))
+	case db.ErrVersionConflict:
+		tool, err := a.database.ToolService.GetToolByID(context.Background(), id, "version")
+		if err != nil {
+			return ErrInternalServerError.WithErr(err)
+		}
+		return ErrVersionConflict.WithData(&VersionConflict{Version: tool.Version})
+	default:
+		return ErrInternalServerError.WithErr(err)
+	}
+}
 
-	opts := db.SearchToolsOptions{
+// searchToolsOptions returns the database options of the filters of the tool search.
+func (a *API) searchToolsOptions(query *ToolSearch, location *db.DBLocation, viewer *db.ToolViewer) db.SearchToolsOptions {
+	return db.SearchToolsOptions{
 		SearchTerm:       query.SearchTerm,
-		Categories:       query.Categories,
+		Categories:       a.categoryTree().Descendants(query.Categories),
 		MayBeFree:        query.MayBeFree,
 		MaxCost:          query.MaxCost,
 		Distance:         query.Distance,
-		Location:         &searchLocation,
+		Location:         location,
 		TransportOptions: query.TransportOptions,
+		Delivery:         query.Delivery,
+		Conditions:       query.conditions(),
+		PowerTypes:       query.powerTypes(),
+		Brand:            query.Brand,
+		MaxWeightKg:      query.MaxWeight,
+		MaxHeightCm:      query.MaxHeight,
+		MaxWidthCm:       query.MaxWidth,
+		MaxLengthCm:      query.MaxLength,
+		Viewer:           viewer,
 	}
+}
+
+// toolSearch searches the tools near the location visible to the viewer, only the public tools
+// if the viewer is nil.
+func (a *API) toolSearch(query *ToolSearch, userLocation *Location, viewer *db.ToolViewer) (*ToolSearchResponse, error) {
+	query.Distance = a.limitSearchRadius(query.Distance)
+	// Convert user location to GeoJSON format for MongoDB
+	searchLocation := db.NewLocation(userLocation.Latitude, userLocation.Longitude)
+
+	community := ""
+	if viewer != nil {
+		community = viewer.Community
+	}
+	cacheKey := searchCacheKey(query, userLocation, community)
+	if cached, ok := a.searchCache.get(cacheKey); ok {
+		return cached, nil
+	}
+
+	// The ratings are needed to merge the results of the peers sorted by rating
+	fields := fieldsProjection(query.Fields, toolFields, toolRequiredFields)
+	if fields != nil && query.Sort == ToolSearchSortRating {
+		fields = append(fields, "ratingAverage", "ratingCount")
+	}
+	opts := a.searchToolsOptions(query, &searchLocation, viewer)
+	opts.SortByRating = query.Sort == ToolSearchSortRating
+	opts.SortByPopularity = query.Sort == ToolSearchSortPopular
+	opts.Fields = fields
+	opts.Page = query.Page
+	opts.PageSize = query.PageSize
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
-	tools, err := a.database.ToolService.SearchTools(ctx, opts)
+	tools, total, err := a.database.ToolService.SearchTools(ctx, opts)
 	if err != nil {
 		return nil, ErrInternalServerError.WithErr(err)
 	}
-	result := []*Tool{}
-	for _, t := range tools {
-		result = append(result, new(Tool).FromDBTool(t))
+	result := &ToolSearchResponse{
+		Tools:    []*Tool{},
+		Total:    total,
+		Page:     query.Page,
+		PageSize: db.PageSize(query.PageSize),
 	}
+	for _, t := range tools {
+		tool := new(Tool).FromDBTool(&t.Tool)
+		distance := roundDistance(t.Distance)
+		tool.Distance = &distance
+		result.Tools = append(result.Tools, tool)
+	}
+	// Search results are cached and shared between users, so they never include exact locations
+	a.hideToolLocations(result.Tools...)
+	a.setBreadcrumbs(result.Tools...)
+	a.searchCache.set(cacheKey, query, userLocation, result)
 	return result, nil
 }
 
@@ -319,6 +714,9 @@ func (a *API) deleteTool(id int64) error {
 	if result.DeletedCount == 0 {
 		return ErrToolNotFound.WithErr(fmt.Errorf("tool with id %d not found", id))
 	}
+	if err := a.database.WaitlistService.DeleteToolWaitlist(context.Background(), id); err != nil {
+		log.Error().Err(err).Msgf("could not delete the waitlist of tool %d", id)
+	}
 	return nil
 }
 
@@ -326,27 +724,145 @@ func (a *API) ownToolsHandler(r *Request) (interface{}, error) {
 	if r.UserID == "" {
 		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
 	}
-	tools, err := a.toolsByUserID(r.UserID)
+	ids, err := r.Context.GetIDs()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if ids != nil {
+		return a.toolsByIDs(r, ids)
+	}
+	fields, err := parseFields(r.Context, toolFields)
+	if err != nil {
+		return nil, err
+	}
+	tools, err := a.toolsByUserID(r.UserID, nil, fieldsProjection(fields, toolFields, toolRequiredFields)...)
 	if err != nil {
 		return nil, err
 	}
-	return &ToolsWrapper{Tools: tools}, nil
+	if tools, err = a.withFavorites(r.UserID, tools); err != nil {
+		return nil, err
+	}
+	showViewCount(tools...)
+	selectToolFields(tools, fields)
+	return &CachedResponse{Data: &ToolsWrapper{Tools: tools}}, nil
+}
+
+// toolsByIDs handles GET /tools?ids=1,2,3
+// Returns the tools with the given IDs in the same order, skipping the missing ones and those
+// the user cannot see, as seen by the user: the exact locations are only shown to the owner and to renters with an accepted
+// booking, the view counts to the owner and the identifiers to those who can edit the tools and to the admins. The views of
+// the tools are not recorded.
+func (a *API) toolsByIDs(r *Request, ids []string) (interface{}, error) {
+	toolIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		var err error
+		if toolIDs[i], err = strconv.ParseInt(id, 10, 64); err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid tool id %q", id))
+		}
+	}
+	fields, err := parseFields(r.Context, toolFields)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	dbTools, err := a.database.ToolService.GetToolsByIDs(ctx, toolIDs, fieldsProjection(fields, toolFields, toolRequiredFields)...)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	// The tools the user cannot see are skipped as the missing ones
+	if dbTools, err = a.readableTools(ctx, r.UserID, dbTools); err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*db.Tool, len(dbTools))
+	for _, tool := range dbTools {
+		byID[tool.ID] = tool
+	}
+	tools := []*Tool{}
+	var subject *policy.Subject
+	for _, id := range toolIDs {
+		dbTool, ok := byID[id]
+		if !ok {
+			continue
+		}
+		tool := new(Tool).FromDBTool(dbTool)
+		if tool.UserID == r.UserID {
+			showViewCount(tool)
+			showToolIdentifiers(tool)
+			tools = append(tools, tool)
+			continue
+		}
+		if !a.canSeeExactLocation(ctx, r.UserID, dbTool.UserID, strconv.FormatInt(id, 10)) {
+			a.hideToolLocations(tool)
+		}
+		if subject == nil {
+			s, err := a.subject(r.UserID)
+			if err != nil {
+				return nil, err
+			}
+			subject = &s
+		}
+		if canSeeToolIdentifiers(*subject, dbTool) {
+			showToolIdentifiers(tool)
+		}
+		tools = append(tools, tool)
+	}
+	a.setBreadcrumbs(tools...)
+	if tools, err = a.withFavorites(r.UserID, tools); err != nil {
+		return nil, err
+	}
+	selectToolFields(tools, fields)
+	return &CachedResponse{Data: &ToolsWrapper{Tools: tools}}, nil
 }
 
 func (a *API) toolHandler(r *Request) (interface{}, error) {
-	idParam := r.Context.URLParam("id")
-	if idParam == nil {
-		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing tool id"))
+	fields, err := parseFields(r.Context, toolFields)
+	if err != nil {
+		return nil, err
 	}
-	id, err := strconv.ParseInt(idParam[0], 10, 64)
+	// The tools restricted to some communities are not found by the other users, nor the
+	// drafts by those who cannot edit them
+	dbTool, err := a.toolFromRequest(r, fieldsProjection(fields, toolFields, toolRequiredFields)...)
 	if err != nil {
-		return nil, ErrInvalidRequestBodyData.WithErr(err)
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	tool := new(Tool).FromDBTool(dbTool)
+	a.setBreadcrumbs(tool)
+	// The owner gets the quality of the listing, when selected the projection has all the
+	// fields it is computed from
+	if r.UserID == tool.UserID && fieldSelected(fields, "quality") {
+		tool.Quality = listingQuality(dbTool, time.Now())
+	}
+	// The identifiers are only shown to those who can edit the tool and to the admins
+	if r.UserID == tool.UserID {
+		showToolIdentifiers(tool)
+	} else if subject, err := a.subject(r.UserID); err != nil {
+		return nil, err
+	} else if canSeeToolIdentifiers(subject, dbTool) {
+		showToolIdentifiers(tool)
 	}
-	tool, err := a.tool(id)
+	// The exact location is only shown to the owner and to renters with an accepted booking
+	ownerID, _ := primitive.ObjectIDFromHex(tool.UserID)
+	if !a.canSeeExactLocation(ctx, r.UserID, ownerID, strconv.FormatInt(tool.ID, 10)) {
+		a.hideToolLocations(tool)
+	}
+	tools, err := a.withFavorites(r.UserID, []*Tool{tool})
 	if err != nil {
 		return nil, err
 	}
-	return tool, nil
+	selectToolFields(tools, fields)
+	// The views of the owner are not counted. The view count is not a change of the tool, its
+	// updates are only revealed by the ETag
+	if r.UserID == tool.UserID {
+		showViewCount(tool)
+	} else if userID, err := primitive.ObjectIDFromHex(r.UserID); err == nil {
+		if _, err := a.database.ToolViewService.RecordView(ctx, tool.ID, userID, time.Now()); err != nil {
+			log.Error().Err(err).Msgf("could not record the view of tool %d", tool.ID)
+		}
+	}
+	// The body depends on the viewer (i.e. the favorite flag and the exact location), so the
+	// update time of the tool cannot validate it, only the hash of the body
+	return &CachedResponse{Data: tools[0]}, nil
 }
 
 func (a *API) userToolsHandler(r *Request) (interface{}, error) {
@@ -359,11 +875,33 @@ func (a *API) userToolsHandler(r *Request) (interface{}, error) {
 		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing user id"))
 	}
 
-	tools, err := a.toolsByUserID(id[0])
+	fields, err := parseFields(r.Context, toolFields)
 	if err != nil {
 		return nil, err
 	}
-	return &ToolsWrapper{Tools: tools}, nil
+	// The tools restricted to some communities are only listed to their audience
+	var viewer *policy.Subject
+	if id[0] != r.UserID {
+		subject, err := a.subject(r.UserID)
+		if err != nil {
+			return nil, err
+		}
+		viewer = &subject
+	}
+	tools, err := a.toolsByUserID(id[0], viewer, fieldsProjection(fields, toolFields, toolRequiredFields)...)
+	if err != nil {
+		return nil, err
+	}
+	if id[0] != r.UserID {
+		a.hideToolLocations(tools...)
+	} else {
+		showViewCount(tools...)
+	}
+	if tools, err = a.withFavorites(r.UserID, tools); err != nil {
+		return nil, err
+	}
+	selectToolFields(tools, fields)
+	return &CachedResponse{Data: &ToolsWrapper{Tools: tools}}, nil
 }
 
 func (a *API) toolSearchHandler(r *Request) (interface{}, error) {
@@ -375,12 +913,48 @@ func (a *API) toolSearchHandler(r *Request) (interface{}, error) {
 		Str("query", r.Context.Request.URL.RawQuery).
 		Msg("received search request")
 
-	searchTermStr := r.Context.URLParam("term")
-	distanceStr := r.Context.URLParam("distance")
-	maxCostStr := r.Context.URLParam("maxCost")
-	mayBeFreeStr := r.Context.URLParam("maybeFree")
-	categoriesStr := r.Context.URLParam("categories")
-	transportsStr := r.Context.URLParam("transports")
+	query, err := parseToolSearch(r.Context)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.getDBUserByID(r.UserID)
+	if err != nil {
+		return nil, ErrUserNotFound.WithErr(err)
+	}
+	viewer, err := a.toolViewer(r.Context.Request.Context(), user)
+	if err != nil {
+		return nil, err
+	}
+	location := new(Location).FromDBLocation(user.Location)
+	result, err := a.toolSearch(query, location, viewer)
+	if err != nil {
+		return nil, err
+	}
+	// The search result might be cached and shared, so the favorites are set on a copy
+	response := *result
+	if federated := r.Context.URLParam("federated"); federated != nil && federated[0] == "true" {
+		a.addPeerResults(r.Context.Request.Context(), &response, r.Context.Request.URL.Query(), location)
+	}
+	if response.Tools, err = a.withFavorites(r.UserID, response.Tools); err != nil {
+		return nil, err
+	}
+	selectToolFields(response.Tools, query.Fields)
+	return &CachedResponse{Data: &response}, nil
+}
+
+// parseToolSearch parses the tool search query parameters.
+func parseToolSearch(hc *HTTPContext) (*ToolSearch, error) {
+	searchTermStr := hc.URLParam("term")
+	distanceStr := hc.URLParam("distance")
+	maxCostStr := hc.URLParam("maxCost")
+	mayBeFreeStr := hc.URLParam("maybeFree")
+	categoriesStr := hc.URLParam("categories")
+	transportsStr := hc.URLParam("transports")
+	conditionsStr := hc.URLParam("condition")
+	powerTypesStr := hc.URLParam("powerType")
+	brandStr := hc.URLParam("brand")
+	deliveryStr := hc.URLParam("delivery")
+	sortStr := hc.URLParam("sort")
 
 	// Parse search term
 	searchTerm := ""
@@ -437,24 +1011,92 @@ func (a *API) toolSearchHandler(r *Request) (interface{}, error) {
 		}
 		transportOptions = append(transportOptions, val)
 	}
+	var delivery bool
+	if deliveryStr != nil {
+		var err error
+		if delivery, err = strconv.ParseBool(deliveryStr[0]); err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(err)
+		}
+	}
+
+	// Parse the specs filters, several conditions and power types match any of them
+	for _, condition := range conditionsStr {
+		if !db.IsValidToolCondition(db.ToolCondition(condition)) {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid condition value: %s", condition))
+		}
+	}
+	for _, powerType := range powerTypesStr {
+		if !db.IsValidPowerType(db.PowerType(powerType)) {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid power type value: %s", powerType))
+		}
+	}
+	brand := ""
+	if brandStr != nil {
+		brand = strings.TrimSpace(brandStr[0])
+	}
+
+	// Parse the maximum dimensions, with their unit or in kilograms and centimeters
+	maxWeight, maxSizes := 0.0, make([]float64, 3)
+	if maxWeightStr := hc.URLParam("maxWeight"); maxWeightStr != nil {
+		var err error
+		if maxWeight, err = parseMeasure(maxWeightStr[0], weightUnits, "kg"); err != nil {
+			return nil, ErrInvalidRequestBodyData.WithErr(err)
+		}
+	}
+	for i, param := range []string{"maxHeight", "maxWidth", "maxLength"} {
+		if value := hc.URLParam(param); value != nil {
+			var err error
+			if maxSizes[i], err = parseMeasure(value[0], lengthUnits, "cm"); err != nil {
+				return nil, ErrInvalidRequestBodyData.WithErr(err)
+			}
+		}
+	}
+
+	// Parse sort parameter, the results are sorted by distance by default
+	var sort string
+	if sortStr != nil && sortStr[0] != "distance" {
+		if sortStr[0] != ToolSearchSortRating && sortStr[0] != ToolSearchSortPopular {
+			return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid sort value: %s", sortStr[0]))
+		}
+		sort = sortStr[0]
+	}
+
+	// Parse the fields of the results to include
+	fields, err := parseFields(hc, toolFields)
+	if err != nil {
+		return nil, err
+	}
 
-	query := ToolSearch{
+	// Parse pagination parameters
+	page, err := hc.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	pageSize, err := hc.GetPageSize()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+
+	return &ToolSearch{
 		SearchTerm:       searchTerm,
 		Categories:       categories,
 		MaxCost:          maxCost,
 		MayBeFree:        mayBeFree,
 		Distance:         distance,
 		TransportOptions: transportOptions,
-	}
-	user, err := a.getUserByID(r.UserID)
-	if err != nil {
-		return nil, ErrUserNotFound.WithErr(err)
-	}
-	tools, err := a.toolSearch(&query, &user.Location)
-	if err != nil {
-		return nil, err
-	}
-	return &ToolsWrapper{Tools: tools}, nil
+		Delivery:         delivery,
+		Conditions:       conditionsStr,
+		PowerTypes:       powerTypesStr,
+		Brand:            brand,
+		MaxWeight:        maxWeight,
+		MaxHeight:        maxSizes[0],
+		MaxWidth:         maxSizes[1],
+		MaxLength:        maxSizes[2],
+		Sort:             sort,
+		Fields:           fields,
+		Page:             page,
+		PageSize:         pageSize,
+	}, nil
 }
 
 func (a *API) addToolHandler(r *Request) (interface{}, error) {
@@ -474,39 +1116,123 @@ func (a *API) addToolHandler(r *Request) (interface{}, error) {
 }
 
 func (a *API) deleteToolHandler(r *Request) (interface{}, error) {
-	if r.UserID == "" {
-		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolDelete)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.deleteTool(tool.ID); err != nil {
+		return nil, err
+	}
+	if err := a.database.FavoriteService.DeleteToolFavorites(context.Background(), tool.ID); err != nil {
+		log.Error().Err(err).Msgf("could not delete favorites of tool %d", tool.ID)
+	}
+	if err := a.database.MaintenanceService.DeleteToolEntries(context.Background(), tool.ID); err != nil {
+		log.Error().Err(err).Msgf("could not delete the maintenance log of tool %d", tool.ID)
+	}
+	if err := a.database.ToolViewService.DeleteToolViews(context.Background(), tool.ID); err != nil {
+		log.Error().Err(err).Msgf("could not delete the views of tool %d", tool.ID)
+	}
+	if err := a.database.ValuationService.DeleteToolValuations(context.Background(), tool.ID); err != nil {
+		log.Error().Err(err).Msgf("could not delete the valuation history of tool %d", tool.ID)
+	}
+	if err := a.database.TransferService.CancelToolTransfers(context.Background(), tool.ID); err != nil {
+		log.Error().Err(err).Msgf("could not cancel the transfers of tool %d", tool.ID)
+	}
+	a.invalidateToolCaches(tool.Location)
+	a.audit(r, &db.AuditEntry{
+		Action:     db.AuditToolDelete,
+		TargetType: "tool",
+		TargetID:   strconv.FormatInt(tool.ID, 10),
+		Details:    tool.Title,
+	})
+	return nil, nil
+}
+
+func (a *API) editToolHandler(r *Request) (interface{}, error) {
+	tool, err := a.authorizedToolFromRequest(r, policy.ToolEdit)
+	if err != nil {
+		return nil, err
 	}
+	t := Tool{}
+	if err := json.Unmarshal(r.Data, &t); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	newID, err := a.editTool(tool.ID, &t, r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &ToolID{ID: newID}, nil
+}
+
+// usageTermsFromTool returns the trimmed usage terms of the tool, if set and not too long.
+func usageTermsFromTool(t *Tool) (string, error) {
+	if t.UsageTerms == nil {
+		return "", nil
+	}
+	usageTerms := strings.TrimSpace(*t.UsageTerms)
+	if len(usageTerms) > maxUsageTermsLength {
+		return "", ErrUsageTermsTooLong.WithErr(fmt.Errorf("usage terms longer than %d characters", maxUsageTermsLength))
+	}
+	return usageTerms, nil
+}
+
+// acceptedTerms returns the usage terms of the tool accepted by the renter, or nil if the tool
+// has none. The renter must accept the current version of the terms.
+func acceptedTerms(tool *db.Tool, version int) (*db.AcceptedTerms, error) {
+	if tool.UsageTerms == "" {
+		return nil, nil
+	}
+	if version != tool.UsageTermsVersion {
+		return nil, ErrUsageTermsNotAccepted.WithErr(fmt.Errorf("accepted version %d, current version is %d",
+			version, tool.UsageTermsVersion))
+	}
+	return &db.AcceptedTerms{
+		Text:       tool.UsageTerms,
+		Version:    tool.UsageTermsVersion,
+		AcceptedAt: time.Now(),
+	}, nil
+}
+
+// toolFromRequest returns the tool referenced by the {id} URL parameter, with only the given
+// fields if any, not found if the user performing the request cannot see it.
+func (a *API) toolFromRequest(r *Request, fields ...string) (*db.Tool, error) {
 	idParam := r.Context.URLParam("id")
 	if idParam == nil {
 		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing tool id"))
 	}
-
 	id, err := strconv.ParseInt(idParam[0], 10, 64)
 	if err != nil {
 		return nil, ErrInvalidRequestBodyData.WithErr(err)
 	}
-	// check the tool is owned by the user
-	tool, err := a.toolFromDB(id)
+	return a.readableToolFromDB(r, id, fields...)
+}
+
+// readableToolFromDB returns the tool with the given id, not found if the user performing the
+// request cannot see it. The user is only loaded if the tool is restricted or a draft.
+func (a *API) readableToolFromDB(r *Request, id int64, fields ...string) (*db.Tool, error) {
+	tool, err := a.toolFromDB(id, fields...)
 	if err != nil {
 		return nil, err
 	}
-	user, err := a.getUserByID(r.UserID)
-	if err != nil {
-		return nil, ErrUserNotFound.WithErr(err)
+	if !isRestricted(tool) && tool.Status != db.ToolStatusDraft {
+		return tool, nil
 	}
-	if tool.UserID != user.ObjectID() {
-		return nil, ErrToolNotOwnedByUser.WithErr(fmt.Errorf("tool with id %d is not owned by user %s", id, user.ID))
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
 	}
-	if err := a.deleteTool(id); err != nil {
+	if err := a.authorizeToolRead(r.Context.Request.Context(), subject, tool); err != nil {
 		return nil, err
 	}
-	return nil, nil
+	return tool, nil
 }
 
-func (a *API) editToolHandler(r *Request) (interface{}, error) {
-	if r.UserID == "" {
-		return nil, ErrUnauthorized.WithErr(fmt.Errorf("user not authenticated"))
+// authorizedToolFromRequest returns the tool referenced by the {id} URL parameter,
+// ensuring the user performing the request is allowed to perform the action on it.
+func (a *API) authorizedToolFromRequest(r *Request, action policy.Action) (*db.Tool, error) {
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
 	}
 	idParam := r.Context.URLParam("id")
 	if idParam == nil {
@@ -516,25 +1242,12 @@ func (a *API) editToolHandler(r *Request) (interface{}, error) {
 	if err != nil {
 		return nil, ErrInvalidRequestBodyData.WithErr(err)
 	}
-	// check the tool is owned by the user
 	tool, err := a.toolFromDB(id)
 	if err != nil {
 		return nil, err
 	}
-	user, err := a.getUserByID(r.UserID)
-	if err != nil {
-		return nil, ErrUserNotFound.WithErr(err)
-	}
-	if tool.UserID != user.ObjectID() {
-		return nil, ErrToolNotOwnedByUser.WithErr(fmt.Errorf("tool with id %d is not owned by user %s", id, user.ID))
-	}
-	t := Tool{}
-	if err := json.Unmarshal(r.Data, &t); err != nil {
-		return nil, ErrInvalidRequestBodyData.WithErr(err)
-	}
-	newID, err := a.editTool(id, &t, r.UserID)
-	if err != nil {
+	if err := authorize(action, subject, toolResource(tool)); err != nil {
 		return nil, err
 	}
-	return &ToolID{ID: newID}, nil
+	return tool, nil
 }
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+// maxDeliveryDistanceKm is the maximum distance an owner can deliver a tool to.
+const maxDeliveryDistanceKm = 500
+
+// transportsHandler handles GET /info/transports
+// Returns the catalog of transport options the owners can offer for their tools.
+func (a *API) transportsHandler(r *Request) (interface{}, error) {
+	transports, err := a.database.TransportService.GetAllTransports(context.Background())
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(fmt.Errorf("failed to get transports: %w", err))
+	}
+	if transports == nil {
+		transports = []*db.Transport{}
+	}
+	return transports, nil
+}
+
+// transportOptionsFromTool returns the validated transport options of the tool, from its
+// transports with the delivery terms or, for the older clients, its transport option IDs.
+// Only the delivery options can have a maximum distance and a fee.
+func (a *API) transportOptionsFromTool(t *Tool) ([]db.Transport, error) {
+	transports := t.Transports
+	if transports == nil {
+		for _, id := range t.TransportOptions {
+			transports = append(transports, ToolTransport{ID: int64(id)})
+		}
+	}
+	catalog, err := a.database.TransportService.GetAllTransports(context.Background())
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	kinds := make(map[int64]db.TransportKind, len(catalog))
+	for _, transport := range catalog {
+		kinds[transport.ID] = transport.Kind
+	}
+
+	options := make([]db.Transport, 0, len(transports))
+	seen := make(map[int64]bool, len(transports))
+	for _, transport := range transports {
+		kind, ok := kinds[transport.ID]
+		if !ok {
+			return nil, ErrInvalidTransportOption.WithErr(fmt.Errorf("transport option %d is not valid", transport.ID))
+		}
+		if seen[transport.ID] {
+			return nil, ErrInvalidTransportOption.WithErr(fmt.Errorf("transport option %d is repeated", transport.ID))
+		}
+		seen[transport.ID] = true
+		if kind != db.TransportDelivery && (transport.MaxDistanceKm != 0 || transport.DeliveryFee != 0) {
+			return nil, ErrInvalidTransportOption.WithErr(
+				fmt.Errorf("transport option %d is not a delivery, it has no distance or fee", transport.ID))
+		}
+		if transport.MaxDistanceKm < 0 || transport.MaxDistanceKm > maxDeliveryDistanceKm {
+			return nil, ErrInvalidTransportOption.WithErr(
+				fmt.Errorf("delivery distance must be between 0 and %d km", maxDeliveryDistanceKm))
+		}
+		options = append(options, db.Transport{
+			ID:            transport.ID,
+			Kind:          kind,
+			MaxDistanceKm: transport.MaxDistanceKm,
+			DeliveryFee:   transport.DeliveryFee,
+		})
+	}
+	return options, nil
+}
+
+// transportOption returns the transport option of the tool with the ID, or nil if the tool does
+// not offer it.
+func transportOption(tool *db.Tool, id int64) *db.Transport {
+	for i := range tool.TransportOptions {
+		if tool.TransportOptions[i].ID == id {
+			return &tool.TransportOptions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/trust"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// trustScoreMaxAge is the time after which the trust score of a user is recalculated.
+	trustScoreMaxAge = 24 * time.Hour
+	// trustScoreBatchSize is the maximum number of trust scores recalculated per job run.
+	trustScoreBatchSize = 500
+)
+
+// updateTrustScores recalculates the trust score of the users whose score is older than
+// trustScoreMaxAge, in batches so a large user base is spread over several job runs.
+func (a *API) updateTrustScores(ctx context.Context) error {
+	now := time.Now()
+	users, err := a.database.UserService.GetUsersForTrustUpdate(ctx, now.Add(-trustScoreMaxAge), trustScoreBatchSize)
+	if err != nil {
+		return fmt.Errorf("could not get users for trust update: %w", err)
+	}
+	for _, user := range users {
+		score, err := a.trustScore(ctx, user, now)
+		if err != nil {
+			log.Error().Err(err).Msgf("could not compute the trust score of user %s", user.ID.Hex())
+			continue
+		}
+		if err := a.database.UserService.SetTrustScore(ctx, user.ID, score, now); err != nil {
+			log.Error().Err(err).Msgf("could not store the trust score of user %s", user.ID.Hex())
+		}
+	}
+	return nil
+}
+
+// trustScore computes the trust score of the user from its booking stats.
+func (a *API) trustScore(ctx context.Context, user *db.User, now time.Time) (int, error) {
+	stats, err := a.database.BookingService.GetUserBookingStats(ctx, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	in := trust.Inputs{
+		CompletedBookings: stats.CompletedAsOwner + stats.CompletedAsRenter,
+		Rating:            averageRating(stats),
+		AccountAge:        now.Sub(user.ID.Timestamp()),
+		Disputes:          stats.Disputes,
+	}
+	if stats.ResponseTime != nil {
+		responseTime := time.Duration(*stats.ResponseTime) * time.Millisecond
+		in.ResponseTime = &responseTime
+	}
+	return trust.Score(in, a.trustWeights), nil
+}
+
+// averageRating returns the average of the ratings received as owner and as renter,
+// or nil if the user was never rated.
+func averageRating(stats *db.UserBookingStats) *float64 {
+	var sum float64
+	if stats.OwnerRating != nil {
+		sum += *stats.OwnerRating * float64(stats.OwnerRatings)
+	}
+	if stats.RenterRating != nil {
+		sum += *stats.RenterRating * float64(stats.RenterRatings)
+	}
+	count := stats.OwnerRatings + stats.RenterRatings
+	if count == 0 {
+		return nil
+	}
+	avg := sum / float64(count)
+	return &avg
+}
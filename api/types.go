@@ -1,9 +1,11 @@
 package api
 
 import (
+	"math"
 	"time"
 
 	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/password"
 	"github.com/emprius/emprius-app-backend/types"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -14,17 +16,20 @@ type Response struct {
 	Data   any            `json:"data,omitempty"`
 }
 
-// ResponseHeader is the header of the response
+// ResponseHeader is the header of the response. ErrorCode is the machine-readable code of the
+// error of the failed requests, see HTTPError.
 type ResponseHeader struct {
 	Success   bool   `json:"success"`
 	Message   string `json:"message,omitempty"`
-	ErrorCode int    `json:"errorCode,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
 }
 
 type Register struct {
 	UserEmail         string `json:"email"`
 	RegisterAuthToken string `json:"invitationToken"`
 	UserProfile
+	// AcceptedTermsVersion is the version of the terms accepted on registration, if published
+	AcceptedTermsVersion int `json:"acceptedTermsVersion,omitempty"`
 }
 
 type Login struct {
@@ -35,6 +40,8 @@ type Login struct {
 type LoginResponse struct {
 	Token    string    `json:"token"`
 	Expirity time.Time `json:"expirity"`
+	// TermsVersion is the current terms version when the user must accept it before writing
+	TermsVersion int `json:"termsVersion,omitempty"`
 }
 
 // Location represents a geographical location
@@ -63,12 +70,19 @@ func (l *Location) FromDBLocation(dbloc db.DBLocation) *Location {
 }
 
 type UserProfile struct {
-	Name      string    `json:"name"`
+	Name string `json:"name"`
+	// Community is only joined with an invite code on registration or changed by an admin, the
+	// profile updates must keep it
 	Community string    `json:"community"`
 	Location  *Location `json:"location,omitempty"`
+	Address   string    `json:"address,omitempty"` // Geocoded when no location is given
 	Active    *bool     `json:"active,omitempty"`
 	Avatar    []byte    `json:"avatar,omitempty"`
 	Password  string    `json:"password,omitempty"`
+	// HideCommunity hides the community from the public profile
+	HideCommunity *bool `json:"hideCommunity,omitempty"`
+	// Version is the version of the profile the update changes, required
+	Version *int64 `json:"version,omitempty"`
 }
 
 // User represents the user type
@@ -82,7 +96,19 @@ type User struct {
 	Rating     int            `json:"rating"`
 	AvatarHash types.HexBytes `json:"avatarHash"`
 	Location   Location       `json:"location"`
+	Locality   string         `json:"locality,omitempty"`
 	Verified   bool           `json:"verified"`
+	Role       string         `json:"role,omitempty"`
+	// AvatarURL serves the avatar in the standard sizes, omitted if the user has no avatar
+	AvatarURL string `json:"avatarUrl,omitempty"`
+	// HideCommunity is the privacy setting of the public profile
+	HideCommunity bool `json:"hideCommunity,omitempty"`
+	// TrustScore is the 0 to 100 trust score, omitted until first computed
+	TrustScore *int `json:"trustScore,omitempty"`
+	// Distance is the distance (in meters) to the user searching, only set by the user search
+	Distance *int64 `json:"distance,omitempty"`
+	// Version is increased by each update of the profile
+	Version int64 `json:"version"`
 }
 
 // FromDBUser converts a DB User to an API User
@@ -95,11 +121,48 @@ func (u *User) FromDBUser(dbu *db.User) *User {
 	u.Active = dbu.Active
 	u.Rating = int(dbu.Rating)
 	u.AvatarHash = dbu.AvatarHash
+	if len(dbu.AvatarHash) > 0 {
+		u.AvatarURL = avatarURL(u.ID)
+	}
 	u.Location.FromDBLocation(dbu.Location)
+	u.Locality = dbu.Locality
 	u.Verified = dbu.Verified
+	u.Role = string(dbu.Role)
+	u.HideCommunity = dbu.HideCommunity
+	u.TrustScore = dbu.TrustScore
+	u.Version = dbu.Version
 	return u
 }
 
+// PublicProfileStats are the aggregated activity figures of a user
+type PublicProfileStats struct {
+	ToolsShared       int64 `json:"toolsShared"`
+	CompletedAsOwner  int64 `json:"completedAsOwner"`
+	CompletedAsRenter int64 `json:"completedAsRenter"`
+	// OwnerRating is the average rating (1 to 5) received as owner, omitted if never rated
+	OwnerRating  *float64 `json:"ownerRating,omitempty"`
+	OwnerRatings int64    `json:"ownerRatings"`
+	// RenterRating is the average rating (1 to 5) received as renter, omitted if never rated
+	RenterRating  *float64 `json:"renterRating,omitempty"`
+	RenterRatings int64    `json:"renterRatings"`
+}
+
+// PublicProfile is the public information of a user together with its activity stats
+type PublicProfile struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	AvatarHash  types.HexBytes     `json:"avatarHash,omitempty"`
+	Community   string             `json:"community,omitempty"`
+	Locality    string             `json:"locality,omitempty"`
+	Rating      int                `json:"rating"`
+	Verified    bool               `json:"verified"`
+	TrustScore  *int               `json:"trustScore,omitempty"`
+	MemberSince time.Time          `json:"memberSince"`
+	Stats       PublicProfileStats `json:"stats"`
+	// Badges are the badges awarded to the user, recalculated periodically
+	Badges []db.UserBadge `json:"badges"`
+}
+
 // ObjectID returns the ObjectID of the user, or a nil ObjectID if the ID is not a valid ObjectID.
 // This is useful for converting the ID to an ObjectID for use in database queries.
 func (u *User) ObjectID() primitive.ObjectID {
@@ -111,7 +174,10 @@ func (u *User) ObjectID() primitive.ObjectID {
 }
 
 type UsersWrapper struct {
-	Users []*User `json:"users"`
+	Users    []*User `json:"users"`
+	Total    int64   `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"pageSize"`
 }
 
 // Tool is the type of the tool
@@ -126,12 +192,116 @@ type Tool struct {
 	Cost             *uint64          `json:"cost"`
 	Images           []types.HexBytes `json:"images"`
 	TransportOptions []int            `json:"transportOptions"`
-	Category         int              `json:"toolCategory"`
-	Location         Location         `json:"location"`
-	EstimatedValue   uint64           `json:"estimatedValue"`
-	Height           uint32           `json:"height"`
-	Weight           uint32           `json:"weight"`
-	ReserverDates    []db.DateRange   `json:"reservedDates"`
+	// Transports are the transport options with the delivery terms, replacing TransportOptions
+	Transports     []ToolTransport   `json:"transports,omitempty"`
+	Category       int               `json:"toolCategory"`
+	Breadcrumbs    []db.ToolCategory `json:"categoryBreadcrumbs"`
+	Location       Location          `json:"location"`
+	Address        string            `json:"address,omitempty"` // Geocoded when no location is given
+	Locality       string            `json:"locality,omitempty"`
+	EstimatedValue uint64            `json:"estimatedValue"`
+	// Height and Weight are the rounded height (in centimeters) and weight (in kilograms) of
+	// the tool, kept for the older clients. Dimensions have the exact ones
+	Height        uint32         `json:"height"`
+	Weight        uint32         `json:"weight"`
+	ReserverDates []db.DateRange `json:"reservedDates"`
+	Status        string         `json:"status,omitempty"`
+	Distance      *int64         `json:"distance,omitempty"`
+	// SerialNumber and AssetTag identify the tool among the owner ones, an empty string on
+	// edit removes them. They are only shown to those who can edit the tool and to the admins
+	SerialNumber    *string `json:"serialNumber,omitempty"`
+	AssetTag        *string `json:"assetTag,omitempty"`
+	IsFavorite      bool    `json:"isFavorite"`
+	OwnerTrustScore *int    `json:"ownerTrustScore,omitempty"`
+	// Rating is the average rating (1 to 5) given by the renters, unset until first rated
+	Rating      *float64 `json:"rating,omitempty"`
+	RatingCount int64    `json:"ratingCount"`
+	// OwnerAvatarURL serves the avatar of the owner, not found if the owner has no avatar
+	OwnerAvatarURL string `json:"ownerAvatarUrl"`
+	// Community is set on shared tools owned by a community instead of the user
+	Community string `json:"community,omitempty"`
+	// PendingApproval is set on the community tools shared by a member until an admin of the
+	// community approves them
+	PendingApproval bool `json:"pendingApproval,omitempty"`
+	// Visibility is public, community (the members of the tool community, or of the owner
+	// community on personal tools) or communities (the members of the VisibleTo communities)
+	Visibility string   `json:"visibility,omitempty"`
+	VisibleTo  []string `json:"visibleTo,omitempty"`
+	// UsageTerms are the optional terms the renters must accept to book the tool. Each change
+	// increases the version, an empty string removes them
+	UsageTerms        *string `json:"usageTerms,omitempty"`
+	UsageTermsVersion int     `json:"usageTermsVersion,omitempty"`
+	// Maintenance is set while the owner has the tool offline for repairs
+	Maintenance *ToolMaintenance `json:"maintenance,omitempty"`
+	// Media are the video and document attachments of the tool
+	Media []*ToolMedia `json:"media,omitempty"`
+	// Specs are the structured attributes of the tool. On edit, they replace the current ones
+	// and an empty object removes them
+	Specs *db.ToolSpecs `json:"specs,omitempty"`
+	// Dimensions are the size and weight of the tool. On edit, they replace the current ones
+	Dimensions *Dimensions `json:"dimensions,omitempty"`
+	// AutoAccept are the rules accepting the booking requests on behalf of the owner. On edit,
+	// they replace the current ones and an empty object removes them
+	AutoAccept *db.AutoAcceptRules `json:"autoAccept,omitempty"`
+	// Availability are the recurring periods the tool can be booked in. On edit, they replace
+	// the current ones and an empty object removes them
+	Availability *db.AvailabilityRules `json:"availability,omitempty"`
+	// Source is the URL of the peer instance of the tools found by a federated search
+	Source string `json:"source,omitempty"`
+	// UpdatedAt is the time of the last change of the tool, if known
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	// ViewCount is the number of views of the tool details, only shown to the owner
+	ViewCount *int64 `json:"viewCount,omitempty"`
+	// Quality is the listing quality score with the hints to improve it, only shown to the owner
+	Quality *ListingQuality `json:"quality,omitempty"`
+	// PricingMode is fixed (the cost per day), free or payWhatYouWant. SuggestedAmount is the
+	// amount per day suggested to the renters of pay what you want tools
+	PricingMode     string  `json:"pricingMode,omitempty"`
+	SuggestedAmount *uint64 `json:"suggestedAmount,omitempty"`
+	// CancellationPolicy is flexible (free cancellations until the booking starts) or strict
+	CancellationPolicy string `json:"cancellationPolicy,omitempty"`
+	// Managers are the users the owner granted the management of the tool, and UpdatedBy the
+	// user who last edited it
+	Managers  []string `json:"managers,omitempty"`
+	UpdatedBy string   `json:"updatedBy,omitempty"`
+	// Version is increased by each edit, which must give the version of the tool it changes
+	Version *int64 `json:"version,omitempty"`
+	// Contributors are the members who funded the community tools bought through a crowdfund
+	Contributors []ToolContributor `json:"contributors,omitempty"`
+	// fields, if set, are the only fields encoded
+	fields []string
+	// viewCount is the view count of the tool, set as ViewCount by showViewCount
+	viewCount int64
+	// serialNumber and assetTag are the identifiers of the tool, set as SerialNumber and
+	// AssetTag by showToolIdentifiers
+	serialNumber string
+	assetTag     string
+}
+
+// ListingQuality is the quality score (0 to 100) of the listing of a tool, with the hints of the
+// actions improving it: addPhotos, extendDescription, addDimensions and updateListing
+type ListingQuality struct {
+	Score int      `json:"score"`
+	Hints []string `json:"hints"`
+}
+
+// showViewCount includes the view count in the tools, for their owner.
+func showViewCount(tools ...*Tool) {
+	for _, t := range tools {
+		t.ViewCount = &t.viewCount
+	}
+}
+
+// showToolIdentifiers includes the serial number and the asset tag in the tools, if set.
+func showToolIdentifiers(tools ...*Tool) {
+	for _, t := range tools {
+		if t.serialNumber != "" {
+			t.SerialNumber = &t.serialNumber
+		}
+		if t.assetTag != "" {
+			t.AssetTag = &t.assetTag
+		}
+	}
 }
 
 // FromDBTool converts a DB Tool to an API Tool.
@@ -149,16 +319,138 @@ func (t *Tool) FromDBTool(dbt *db.Tool) *Tool {
 	}
 	for i := range dbt.TransportOptions {
 		t.TransportOptions = append(t.TransportOptions, int(dbt.TransportOptions[i].ID))
+		t.Transports = append(t.Transports, ToolTransport{
+			ID:            dbt.TransportOptions[i].ID,
+			Kind:          string(dbt.TransportOptions[i].Kind),
+			MaxDistanceKm: dbt.TransportOptions[i].MaxDistanceKm,
+			DeliveryFee:   dbt.TransportOptions[i].DeliveryFee,
+		})
 	}
 	t.Category = dbt.ToolCategory
 	t.Location.FromDBLocation(dbt.Location)
+	t.Locality = dbt.Locality
 	t.EstimatedValue = dbt.EstimatedValue
-	t.Height = dbt.Height
-	t.Weight = dbt.Weight
+	if !dbt.Dimensions.IsEmpty() {
+		t.Dimensions = new(Dimensions).FromDBDimensions(dbt.Dimensions)
+		t.Height = uint32(math.Round(dbt.Dimensions.HeightCm))
+		t.Weight = uint32(math.Round(dbt.Dimensions.WeightKg))
+	}
 	t.ReserverDates = dbt.ReservedDates
+	t.Status = string(dbt.Status)
+	t.serialNumber = dbt.SerialNumber
+	t.assetTag = dbt.AssetTag
+	t.OwnerTrustScore = dbt.OwnerTrustScore
+	t.Rating = dbt.RatingAverage
+	t.RatingCount = dbt.RatingCount
+	t.UpdatedAt = dbt.UpdatedAt
+	t.viewCount = dbt.ViewCount
+	t.OwnerAvatarURL = avatarURL(t.UserID)
+	t.Community = dbt.Community
+	t.PendingApproval = dbt.PendingApproval
+	t.Visibility = string(toolVisibility(dbt))
+	t.VisibleTo = dbt.VisibleTo
+	t.AutoAccept = dbt.AutoAccept
+	t.Availability = dbt.Availability
+	t.PricingMode = string(dbt.Pricing())
+	t.CancellationPolicy = string(dbt.Cancellation())
+	for _, manager := range dbt.Managers {
+		t.Managers = append(t.Managers, manager.Hex())
+	}
+	if dbt.UpdatedBy != nil {
+		t.UpdatedBy = dbt.UpdatedBy.Hex()
+	}
+	t.Version = &dbt.Version
+	if dbt.Pricing() == db.PricingPayWhatYouWant {
+		t.SuggestedAmount = &dbt.SuggestedAmount
+	}
+	if dbt.UsageTerms != "" {
+		t.UsageTerms = &dbt.UsageTerms
+		t.UsageTermsVersion = dbt.UsageTermsVersion
+	}
+	// A past maintenance window is left on the tool until the owner sets another one
+	if !dbt.Maintenance.Ended(time.Now()) {
+		t.Maintenance = new(ToolMaintenance).FromDBToolMaintenance(dbt.Maintenance)
+	}
+	t.Specs = dbt.Specs
+	for i := range dbt.Media {
+		t.Media = append(t.Media, new(ToolMedia).FromDBToolMedia(&dbt.Media[i]))
+	}
+	for _, c := range dbt.Contributors {
+		t.Contributors = append(t.Contributors, ToolContributor{UserID: c.UserID.Hex(), Amount: c.Amount})
+	}
 	return t
 }
 
+// ToolContributor is a member who funded the purchase of a community tool, with the tokens
+// contributed
+type ToolContributor struct {
+	UserID string `json:"userId"`
+	Amount uint64 `json:"amount"`
+}
+
+// VersionConflict is the data of the version conflict errors, with the current version of the
+// object the client must merge its changes into
+type VersionConflict struct {
+	Version int64 `json:"version"`
+}
+
+// ToolManagerRequest grants a user the management of a tool
+type ToolManagerRequest struct {
+	UserID string `json:"userId"`
+}
+
+// ToolManager is a user managing a tool of another user
+type ToolManager struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatarUrl"`
+}
+
+type ToolManagersWrapper struct {
+	Managers []*ToolManager `json:"managers"`
+}
+
+// ToolTransferRequest offers a tool to another user, with an optional message
+type ToolTransferRequest struct {
+	UserID  string `json:"userId"`
+	Message string `json:"message,omitempty"`
+}
+
+// ToolTransfer is the offer of a tool to a user, who becomes its owner when accepted
+type ToolTransfer struct {
+	ID          string     `json:"id"`
+	ToolID      int64      `json:"toolId"`
+	ToolTitle   string     `json:"toolTitle"`
+	FromUserID  string     `json:"fromUserId"`
+	ToUserID    string     `json:"toUserId"`
+	Message     string     `json:"message,omitempty"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty"`
+	NewToolID   int64      `json:"newToolId,omitempty"`
+}
+
+// FromDBToolTransfer converts a DB ToolTransfer to an API ToolTransfer.
+func (t *ToolTransfer) FromDBToolTransfer(dbt *db.ToolTransfer) *ToolTransfer {
+	t.ID = dbt.ID.Hex()
+	t.ToolID = dbt.ToolID
+	t.ToolTitle = dbt.ToolTitle
+	t.FromUserID = dbt.FromUserID.Hex()
+	t.ToUserID = dbt.ToUserID.Hex()
+	t.Message = dbt.Message
+	t.Status = string(dbt.Status)
+	t.CreatedAt = dbt.CreatedAt
+	t.RespondedAt = dbt.RespondedAt
+	t.NewToolID = dbt.NewToolID
+	return t
+}
+
+// ToolTransfersWrapper are the pending transfers offered by and to the user
+type ToolTransfersWrapper struct {
+	Sent     []*ToolTransfer `json:"sent"`
+	Received []*ToolTransfer `json:"received"`
+}
+
 type ToolID struct {
 	ID int64 `json:"id"`
 }
@@ -167,22 +459,181 @@ type ToolsWrapper struct {
 	Tools []*Tool `json:"tools"`
 }
 
+// ToolSearchResponse is a page of tool search results. Each tool includes its
+// distance (in meters) to the user location.
+type ToolSearchResponse struct {
+	Tools    []*Tool `json:"tools"`
+	Total    int64   `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"pageSize"`
+}
+
+// ToolSearchFacets are the counts of the tools matching a search, for the clients to render
+// the search filters without running a search for each one.
+type ToolSearchFacets struct {
+	Total      int64            `json:"total"`
+	Categories []*CategoryFacet `json:"categories"`
+	Prices     []*RangeFacet    `json:"prices"`    // By cost per day
+	Distances  []*RangeFacet    `json:"distances"` // In meters
+	// Available tools can be booked now, the others are in maintenance
+	Available     int64 `json:"available"`
+	InMaintenance int64 `json:"inMaintenance"`
+}
+
+// CategoryFacet is the number of tools of a category matching a search
+type CategoryFacet struct {
+	ID    int   `json:"id"`
+	Count int64 `json:"count"`
+}
+
+// RangeFacet is the number of tools matching a search with a value from Min up to Max
+// (excluded), Max being unset for the last range
+type RangeFacet struct {
+	Min   int64  `json:"min"`
+	Max   *int64 `json:"max,omitempty"`
+	Count int64  `json:"count"`
+}
+
+// ToolMapCluster is a group of tools in the same geohash cell of the map
+type ToolMapCluster struct {
+	Geohash  string   `json:"geohash"`
+	Count    int64    `json:"count"`
+	Location Location `json:"location"`         // Centroid of the tools
+	ToolID   int64    `json:"toolId,omitempty"` // Only set for single tool clusters
+}
+
+// IncompleteTool is returned with the tool.incomplete error, with the fields the draft needs
+// to be published
+type IncompleteTool struct {
+	Missing []string `json:"missing"`
+}
+
+// ToolImportResult is the result of a row of a tool import CSV file. Row is the line number.
+type ToolImportResult struct {
+	Row   int    `json:"row"`
+	ID    int64  `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ToolImportResponse is the response of a tool import with the result of every row
+type ToolImportResponse struct {
+	Imported int                 `json:"imported"`
+	Failed   int                 `json:"failed"`
+	Results  []*ToolImportResult `json:"results"`
+}
+
+// ToolMapResponse represents the tools of a map viewport, either clustered or individual
+type ToolMapResponse struct {
+	Zoom      int               `json:"zoom"`
+	Clustered bool              `json:"clustered"`
+	Precision int               `json:"precision,omitempty"`
+	Clusters  []*ToolMapCluster `json:"clusters"`
+	Tools     []*Tool           `json:"tools"`
+	Truncated bool              `json:"truncated,omitempty"`
+}
+
 // ToolSearch is the type of the tool search
 type ToolSearch struct {
-	SearchTerm       string  `json:"searchTerm"`
-	Categories       []int   `json:"categories"`
-	Distance         int     `json:"distance"`
-	MaxCost          *uint64 `json:"maxCost"`
-	MayBeFree        *bool   `json:"mayBeFree"`
-	AvailableFrom    int     `json:"availableFrom"`
-	TransportOptions []int   `json:"transportOptions"`
+	SearchTerm       string   `json:"searchTerm"`
+	Categories       []int    `json:"categories"`
+	Distance         int      `json:"distance"`
+	MaxCost          *uint64  `json:"maxCost"`
+	MayBeFree        *bool    `json:"mayBeFree"`
+	AvailableFrom    int      `json:"availableFrom"`
+	TransportOptions []int    `json:"transportOptions"`
+	Delivery         bool     `json:"delivery"`
+	Conditions       []string `json:"conditions"`
+	PowerTypes       []string `json:"powerTypes"`
+	Brand            string   `json:"brand"`
+	// MaxWeight (in kilograms), MaxHeight, MaxWidth and MaxLength (in centimeters) are the
+	// maximum dimensions of the tools, zero if not limited
+	MaxWeight float64  `json:"maxWeight"`
+	MaxHeight float64  `json:"maxHeight"`
+	MaxWidth  float64  `json:"maxWidth"`
+	MaxLength float64  `json:"maxLength"`
+	Sort      string   `json:"sort"`
+	Fields    []string `json:"fields"`
+	Page      int      `json:"page"`
+	PageSize  int      `json:"pageSize"`
 }
 
+const (
+	// ToolSearchSortRating sorts the tool search results by rating instead of distance.
+	ToolSearchSortRating = "rating"
+	// ToolSearchSortPopular sorts the tool search results by their recent views and
+	// completed bookings instead of distance.
+	ToolSearchSortPopular = "popular"
+)
+
 type Info struct {
 	Users      int               `json:"users"`
 	Tools      int               `json:"tools"`
 	Categories []db.ToolCategory `json:"categories"`
 	Transports []db.Transport    `json:"transports"`
+	// VAPIDPublicKey is the applicationServerKey the browsers subscribe to Web Push with.
+	VAPIDPublicKey string `json:"vapidPublicKey,omitempty"`
+	// Search are the map and search defaults of the instance.
+	Search *SearchSettings `json:"search"`
+	// Features, Limits, PasswordPolicy, Terms and Version let the clients bootstrap with a
+	// single request. Terms is the current terms version, omitted if none was published.
+	Features       *Features        `json:"features"`
+	Limits         *Limits          `json:"limits"`
+	PasswordPolicy *password.Policy `json:"passwordPolicy"`
+	Terms          *db.TermsVersion `json:"terms,omitempty"`
+	Version        *VersionInfo     `json:"version"`
+}
+
+// Features are the optional features enabled in the instance.
+type Features struct {
+	AdminRecovery         bool `json:"adminRecovery"`
+	CommunityToolApproval bool `json:"communityToolApproval"`
+	Geocoding             bool `json:"geocoding"`
+	Federation            bool `json:"federation"`
+	WebPush               bool `json:"webPush"`
+	Telegram              bool `json:"telegram"`
+	EmailReplies          bool `json:"emailReplies"`
+	InactiveAccounts      bool `json:"inactiveAccounts"`
+	Payments              bool `json:"payments"`
+}
+
+// Limits are the limits of the requests of the clients. The sizes are in bytes and the
+// dimensions in pixels.
+type Limits struct {
+	MaxAvatarSize     int `json:"maxAvatarSize"`
+	MaxMediaSize      int `json:"maxMediaSize"`
+	MaxImageDimension int `json:"maxImageDimension"`
+	MaxToolMedia      int `json:"maxToolMedia"`
+	DefaultPageSize   int `json:"defaultPageSize"`
+	MaxPageSize       int `json:"maxPageSize"`
+	MaxBatchIDs       int `json:"maxBatchIds"`
+	MaxMessageLength  int `json:"maxMessageLength"`
+	MaxSavedSearches  int `json:"maxSavedSearches"`
+}
+
+// VersionInfo is the version of the server and the API versions it serves.
+type VersionInfo struct {
+	Server      string `json:"server"`
+	APIVersions []int  `json:"apiVersions"`
+	LatestAPI   int    `json:"latestApi"`
+}
+
+// SearchSettings are the default map center and search radius of the instance, and the maximum
+// radius of the tool searches. The radiuses are in meters, zero if not limited.
+type SearchSettings struct {
+	MapCenter     Location `json:"mapCenter"`
+	DefaultRadius int      `json:"defaultRadius"`
+	MaxRadius     int      `json:"maxRadius"`
+}
+
+// PublicStats are the anonymous aggregate numbers of the platform.
+type PublicStats struct {
+	Users             int64 `json:"users"`
+	Tools             int64 `json:"tools"`
+	CompletedBookings int64 `json:"completedBookings"`
+	// EstimatedValueShared is the sum of the estimated value of the tools of each completed
+	// booking.
+	EstimatedValueShared uint64    `json:"estimatedValueShared"`
+	UpdatedAt            time.Time `json:"updatedAt"`
 }
 
 // CreateBookingRequest represents the request to create a new booking
@@ -192,6 +643,100 @@ type CreateBookingRequest struct {
 	EndDate   int64  `json:"endDate"`
 	Contact   string `json:"contact"`
 	Comments  string `json:"comments"`
+	// Origin is the surface the booking was created from (SEARCH, COMMUNITY_PAGE, SHARE_LINK or NEED_MATCH)
+	Origin string `json:"origin,omitempty"`
+	// AcceptedTermsVersion is the version of the tool usage terms accepted by the renter,
+	// required if the tool has usage terms
+	AcceptedTermsVersion int `json:"acceptedTermsVersion,omitempty"`
+	// Amount is the total amount of tokens proposed by the renter, only for pay what you want
+	// tools. The suggested amount of the tool for each booked day is proposed if not set
+	Amount *uint64 `json:"amount,omitempty"`
+}
+
+// LibraryTagRequest registers the asset tag of a shared tool of a community library. An
+// empty tag removes it
+type LibraryTagRequest struct {
+	ToolID   int64  `json:"toolId"`
+	AssetTag string `json:"assetTag"`
+}
+
+// LibraryCheckoutRequest checks out the library tool with the scanned asset tag until the
+// optional end date (UNIX timestamp)
+type LibraryCheckoutRequest struct {
+	AssetTag             string  `json:"assetTag"`
+	EndDate              int64   `json:"endDate,omitempty"`
+	AcceptedTermsVersion int     `json:"acceptedTermsVersion,omitempty"`
+	Amount               *uint64 `json:"amount,omitempty"`
+}
+
+// LibraryCheckinRequest returns the library tool with the scanned asset tag
+type LibraryCheckinRequest struct {
+	AssetTag string `json:"assetTag"`
+}
+
+// ToolTransport is a transport option offered for a tool
+type ToolTransport struct {
+	ID   int64  `json:"id"`
+	Kind string `json:"kind,omitempty"`
+	// MaxDistanceKm and DeliveryFee (in tokens) are the delivery terms of the owner, only for
+	// the delivery options
+	MaxDistanceKm int    `json:"maxDistanceKm,omitempty"`
+	DeliveryFee   uint64 `json:"deliveryFee,omitempty"`
+}
+
+// Quote is the price of a booking of a tool, in tokens
+type Quote struct {
+	ToolID      int64  `json:"toolId"`
+	PricingMode string `json:"pricingMode"`
+	Days        uint64 `json:"days"`
+	// CostPerDay is set for fixed tools, SuggestedAmount (per day) for pay what you want tools
+	CostPerDay      *uint64 `json:"costPerDay,omitempty"`
+	SuggestedAmount *uint64 `json:"suggestedAmount,omitempty"`
+	Price           uint64  `json:"price"`
+	// CancellationPenalty is paid by the renter for cancelling the booking less than
+	// CancellationWindow seconds before it starts, only for strict tools
+	CancellationPolicy  string `json:"cancellationPolicy"`
+	CancellationWindow  int64  `json:"cancellationWindow,omitempty"`
+	CancellationPenalty uint64 `json:"cancellationPenalty,omitempty"`
+	// DeliveryFee is paid by the renter on top of the price if the owner delivers the tool
+	// with the Transport option
+	Transport   int64  `json:"transport,omitempty"`
+	DeliveryFee uint64 `json:"deliveryFee,omitempty"`
+}
+
+// ArchiveBookingsRequest is the body of the bulk archive of the bookings: the ended bookings
+// of the user that ended before the date (unix seconds) are archived
+type ArchiveBookingsRequest struct {
+	Before int64 `json:"before"`
+}
+
+// ArchivedBookings is the number of bookings archived at once
+type ArchivedBookings struct {
+	Archived int64 `json:"archived"`
+}
+
+// BookingBatchRequest is the body of the batch update of the booking requests: the bookings
+// are moved to the status, ACCEPTED or REJECTED, with the optional note
+type BookingBatchRequest struct {
+	IDs    []string `json:"ids"`
+	Status string   `json:"status"`
+	Note   string   `json:"note,omitempty"`
+}
+
+// BookingBatchResult is the result of a booking of a batch update, with the error code and
+// message if it failed
+type BookingBatchResult struct {
+	ID            string `json:"id"`
+	BookingStatus string `json:"bookingStatus,omitempty"`
+	ErrorCode     string `json:"errorCode,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// BookingBatchResponse is the response of a batch update with the result of every booking
+type BookingBatchResponse struct {
+	Updated int                   `json:"updated"`
+	Failed  int                   `json:"failed"`
+	Results []*BookingBatchResult `json:"results"`
 }
 
 // BookingResponse represents the API response for a booking
@@ -200,6 +745,8 @@ type BookingResponse struct {
 	ToolID        string    `json:"toolId"`
 	FromUserID    string    `json:"fromUserId"`
 	ToUserID      string    `json:"toUserId"`
+	FromAvatarURL string    `json:"fromAvatarUrl"`
+	ToAvatarURL   string    `json:"toAvatarUrl"`
 	StartDate     int64     `json:"startDate"`
 	EndDate       int64     `json:"endDate"`
 	Contact       string    `json:"contact"`
@@ -207,4 +754,1102 @@ type BookingResponse struct {
 	BookingStatus string    `json:"bookingStatus"`
 	CreatedAt     time.Time `json:"createdAt"`
 	UpdatedAt     time.Time `json:"updatedAt"`
+	ToolReported  bool      `json:"toolReported,omitempty"`
+	Origin        string    `json:"origin,omitempty"`
+	// Community is the community owning the tool, if it is a shared community tool
+	Community string `json:"community,omitempty"`
+	// CommentRefs are the tools, bookings and users referenced by the comments
+	CommentRefs []db.EntityRef `json:"commentRefs,omitempty"`
+	// Disagreement is the return condition disagreement, including its resolution deadline
+	Disagreement *BookingDisagreement `json:"disagreement,omitempty"`
+	// AcceptedTerms are the usage terms of the tool accepted by the renter, if it had any
+	AcceptedTerms *AcceptedTerms `json:"acceptedTerms,omitempty"`
+	// PricingMode is the pricing mode of the tool when the booking was requested, and Price
+	// the tokens the booking costs, the amount proposed by the renter for pay what you want tools
+	PricingMode string  `json:"pricingMode,omitempty"`
+	Price       *uint64 `json:"price,omitempty"`
+	// CancellationPolicy is the cancellation policy of the tool when the booking was requested,
+	// and CancellationPenalty the tokens paid by the renter for cancelling it late
+	CancellationPolicy  string `json:"cancellationPolicy,omitempty"`
+	CancellationPenalty uint64 `json:"cancellationPenalty,omitempty"`
+	// CommunityFee is the fee paid by the renter to the token pool of the community of the
+	// owner when the booking was returned
+	CommunityFee uint64 `json:"communityFee,omitempty"`
+	// Tool, FromUser and ToUser are the summaries of the tool and the parties of the booking,
+	// only included in the booking lists
+	Tool     *BookingTool `json:"tool,omitempty"`
+	FromUser *BookingUser `json:"fromUser,omitempty"`
+	ToUser   *BookingUser `json:"toUser,omitempty"`
+	// Payment is the payment in money of the price of the accepted booking, if the payments
+	// are enabled
+	Payment *BookingPayment `json:"payment,omitempty"`
+	// Archived is true if the user archived the ended booking, hidden from its lists
+	Archived bool `json:"archived,omitempty"`
+	// fields, if set, are the only fields encoded
+	fields []string
+}
+
+// BookingPayment is the payment of the price of a booking in money. URL is the page the
+// renter pays at, empty if the payment is collected by hand.
+type BookingPayment struct {
+	Provider  string     `json:"provider"`
+	Status    string     `json:"status"`
+	Amount    int64      `json:"amount"`
+	Currency  string     `json:"currency"`
+	URL       string     `json:"url,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	PaidAt    *time.Time `json:"paidAt,omitempty"`
+}
+
+// FromDBBookingPayment converts a DB BookingPayment to an API BookingPayment.
+func (p *BookingPayment) FromDBBookingPayment(dbp *db.BookingPayment) *BookingPayment {
+	p.Provider = dbp.Provider
+	p.Status = dbp.Status
+	p.Amount = dbp.Amount
+	p.Currency = dbp.Currency
+	p.URL = dbp.URL
+	p.CreatedAt = dbp.CreatedAt
+	p.PaidAt = dbp.PaidAt
+	return p
+}
+
+// BookingTool is the summary of the tool of a booking
+type BookingTool struct {
+	Title     string         `json:"title"`
+	ImageHash types.HexBytes `json:"imageHash,omitempty"`
+}
+
+// FromDBBookingTool converts a DB BookingTool to an API BookingTool.
+func (t *BookingTool) FromDBBookingTool(dbt *db.BookingTool) *BookingTool {
+	t.Title = dbt.Title
+	t.ImageHash = dbt.ImageHash
+	return t
+}
+
+// BookingUser is the summary of a party of a booking
+type BookingUser struct {
+	Name       string         `json:"name"`
+	AvatarHash types.HexBytes `json:"avatarHash,omitempty"`
+	Rating     int            `json:"rating"`
+}
+
+// FromDBBookingUser converts a DB BookingUser to an API BookingUser.
+func (u *BookingUser) FromDBBookingUser(dbu *db.BookingUser) *BookingUser {
+	u.Name = dbu.Name
+	u.AvatarHash = dbu.AvatarHash
+	u.Rating = int(dbu.Rating)
+	return u
+}
+
+// AcceptedTerms are the usage terms of a tool accepted by the renter of a booking
+type AcceptedTerms struct {
+	Text       string    `json:"text"`
+	Version    int       `json:"version"`
+	AcceptedAt time.Time `json:"acceptedAt"`
+}
+
+// FromDBAcceptedTerms converts DB AcceptedTerms to API AcceptedTerms.
+func (t *AcceptedTerms) FromDBAcceptedTerms(dbt *db.AcceptedTerms) *AcceptedTerms {
+	t.Text = dbt.Text
+	t.Version = dbt.Version
+	t.AcceptedAt = dbt.AcceptedAt
+	return t
+}
+
+// WaitlistEntry is a booking request waiting for dates taken by an accepted booking
+type WaitlistEntry struct {
+	ID        string    `json:"id"`
+	ToolID    int64     `json:"toolId"`
+	StartDate int64     `json:"startDate"`
+	EndDate   int64     `json:"endDate"`
+	Contact   string    `json:"contact"`
+	Comments  string    `json:"comments"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FromDBWaitlistEntry converts a DB WaitlistEntry to an API WaitlistEntry.
+func (e *WaitlistEntry) FromDBWaitlistEntry(dbe *db.WaitlistEntry) *WaitlistEntry {
+	e.ID = dbe.ID.Hex()
+	e.ToolID = dbe.ToolID
+	e.StartDate = dbe.StartDate.Unix()
+	e.EndDate = dbe.EndDate.Unix()
+	e.Contact = dbe.Contact
+	e.Comments = dbe.Comments
+	e.CreatedAt = dbe.CreatedAt
+	return e
+}
+
+// DateWindow is a period of time, with the dates as unix timestamps
+type DateWindow struct {
+	StartDate int64 `json:"startDate"`
+	EndDate   int64 `json:"endDate"`
+}
+
+// SuggestedDatesResponse are the nearest free windows of the requested duration of a tool
+type SuggestedDatesResponse struct {
+	Duration    int           `json:"duration"`
+	Suggestions []*DateWindow `json:"suggestions"`
+}
+
+// CommunityPool is the token pool of a community, collected by its shared tools and the fees
+// of the returned bookings of the tools of its members
+type CommunityPool struct {
+	Community string `json:"community"`
+	Tokens    uint64 `json:"tokens"`
+	Fee       uint64 `json:"fee"`
+}
+
+// CommunityFeeRequest is the fee a community charges on each returned booking of the tools of
+// its members, 0 to charge no fee
+type CommunityFeeRequest struct {
+	Fee uint64 `json:"fee"`
+}
+
+// PayoutRequest is a payout of the token pool of a community to one of its members
+type PayoutRequest struct {
+	UserID string `json:"userId"`
+	Amount uint64 `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+// PoolMovement is a fee paid to the token pool of a community or a payout of the pool
+type PoolMovement struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Amount    uint64    `json:"amount"`
+	UserID    string    `json:"userId"`
+	BookingID string    `json:"bookingId,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FromDBPoolMovement converts a DB PoolMovement to an API PoolMovement.
+func (m *PoolMovement) FromDBPoolMovement(dbm *db.PoolMovement) *PoolMovement {
+	m.ID = dbm.ID.Hex()
+	m.Kind = string(dbm.Kind)
+	m.Amount = dbm.Amount
+	m.UserID = dbm.UserID.Hex()
+	if !dbm.BookingID.IsZero() {
+		m.BookingID = dbm.BookingID.Hex()
+	}
+	if !dbm.CreatedBy.IsZero() {
+		m.CreatedBy = dbm.CreatedBy.Hex()
+	}
+	m.Reason = dbm.Reason
+	m.CreatedAt = dbm.CreatedAt
+	return m
+}
+
+// RejectCommunityToolRequest is the optional reason a community admin rejects a tool shared by
+// a member
+type RejectCommunityToolRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ToolMaintenance is the maintenance window of a tool, with the dates as unix timestamps.
+// Without end date the tool stays in maintenance until the owner ends it.
+type ToolMaintenance struct {
+	StartDate int64  `json:"startDate"`
+	EndDate   int64  `json:"endDate,omitempty"`
+	Note      string `json:"note,omitempty"`
+}
+
+// Dimensions are the size and weight of a tool. The tools are returned in centimeters and
+// kilograms, and can be given in other units, converted by the server
+type Dimensions struct {
+	Height float64 `json:"height,omitempty"`
+	Width  float64 `json:"width,omitempty"`
+	Length float64 `json:"length,omitempty"`
+	Weight float64 `json:"weight,omitempty"`
+	// LengthUnit is mm, cm (the default), m, in or ft
+	LengthUnit string `json:"lengthUnit,omitempty"`
+	// WeightUnit is g, kg (the default) or lb
+	WeightUnit string `json:"weightUnit,omitempty"`
+}
+
+// FromDBDimensions converts DB Dimensions to API Dimensions.
+func (d *Dimensions) FromDBDimensions(dbd *db.Dimensions) *Dimensions {
+	d.Height = dbd.HeightCm
+	d.Width = dbd.WidthCm
+	d.Length = dbd.LengthCm
+	d.Weight = dbd.WeightKg
+	d.LengthUnit = "cm"
+	d.WeightUnit = "kg"
+	return d
+}
+
+// ToolMedia is a video or document attached to a tool, downloaded from its URL
+type ToolMedia struct {
+	Hash     types.HexBytes `json:"hash"`
+	Name     string         `json:"name"`
+	Type     string         `json:"type"`
+	MimeType string         `json:"mimeType"`
+	Size     int64          `json:"size"`
+	URL      string         `json:"url"`
+}
+
+// FromDBToolMedia converts a DB ToolMedia to an API ToolMedia.
+func (m *ToolMedia) FromDBToolMedia(dbm *db.ToolMedia) *ToolMedia {
+	m.Hash = dbm.Hash
+	m.Name = dbm.Name
+	m.Type = string(dbm.Type)
+	m.MimeType = dbm.MimeType
+	m.Size = dbm.Size
+	m.URL = mediaURL(dbm.Hash)
+	return m
+}
+
+// FromDBToolMaintenance converts a DB ToolMaintenance to an API ToolMaintenance.
+func (m *ToolMaintenance) FromDBToolMaintenance(dbm *db.ToolMaintenance) *ToolMaintenance {
+	m.StartDate = dbm.StartDate.Unix()
+	if dbm.EndDate != nil {
+		m.EndDate = dbm.EndDate.Unix()
+	}
+	m.Note = dbm.Note
+	return m
+}
+
+// MaintenanceRequest is the body of the tool maintenance log requests. An entry
+// that has not ended takes the tool offline during its dates.
+type MaintenanceRequest struct {
+	StartDate int64  `json:"startDate,omitempty"` // Defaults to now
+	EndDate   int64  `json:"endDate,omitempty"`   // Open ended if not set
+	Note      string `json:"note"`
+	Cost      uint64 `json:"cost"`
+	Public    bool   `json:"public"` // Shown in the tool history to the other users
+}
+
+// MaintenanceLogEntry is a repair or service of a tool
+type MaintenanceLogEntry struct {
+	ID        string    `json:"id"`
+	ToolID    int64     `json:"toolId"`
+	StartDate int64     `json:"startDate"`
+	EndDate   int64     `json:"endDate,omitempty"`
+	Note      string    `json:"note"`
+	Cost      uint64    `json:"cost"`
+	Public    bool      `json:"public"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FromDBMaintenanceLogEntry converts a DB MaintenanceLogEntry to an API MaintenanceLogEntry.
+func (e *MaintenanceLogEntry) FromDBMaintenanceLogEntry(dbe *db.MaintenanceLogEntry) *MaintenanceLogEntry {
+	e.ID = dbe.ID.Hex()
+	e.ToolID = dbe.ToolID
+	e.StartDate = dbe.StartDate.Unix()
+	if dbe.EndDate != nil {
+		e.EndDate = dbe.EndDate.Unix()
+	}
+	e.Note = dbe.Note
+	e.Cost = dbe.Cost
+	e.Public = dbe.Public
+	e.CreatedAt = dbe.CreatedAt
+	return e
+}
+
+// ToolValuation is a change of the estimated value of a tool
+type ToolValuation struct {
+	ID     string `json:"id"`
+	ToolID int64  `json:"toolId"`
+	UserID string `json:"userId"`
+	Value  uint64 `json:"value"`
+	// Previous is the estimated value before the change, 0 for the first valuation
+	Previous  uint64    `json:"previous,omitempty"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FromDBToolValuation converts a DB ToolValuation to an API ToolValuation.
+func (v *ToolValuation) FromDBToolValuation(dbv *db.ToolValuation) *ToolValuation {
+	v.ID = dbv.ID.Hex()
+	v.ToolID = dbv.ToolID
+	v.UserID = dbv.UserID.Hex()
+	v.Value = dbv.Value
+	v.Previous = dbv.Previous
+	v.Source = string(dbv.Source)
+	v.CreatedAt = dbv.CreatedAt
+	return v
+}
+
+// ToolValuations is the current valuation of a tool with its history, newest first. The
+// suggested value is the yearly depreciation of the current valuation, only shown to the
+// editors of the tool once a year has passed since the last valuation.
+type ToolValuations struct {
+	EstimatedValue uint64           `json:"estimatedValue"`
+	SuggestedValue *uint64          `json:"suggestedValue,omitempty"`
+	History        []*ToolValuation `json:"history"`
+}
+
+// maxUsageTermsLength is the maximum length of the usage terms of a tool
+const maxUsageTermsLength = 5000
+
+// maxTransitionNoteLength is the maximum length of the note of a booking status transition
+const maxTransitionNoteLength = 500
+
+// BookingTransitionRequest is the optional body of the booking status change requests
+type BookingTransitionRequest struct {
+	Note string `json:"note"`
+}
+
+// BookingTransition represents a status change of a booking. By is empty for the changes
+// made by the system, such as expirations.
+type BookingTransition struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	By   string `json:"by,omitempty"`
+	At   int64  `json:"at"`
+	Note string `json:"note,omitempty"`
+}
+
+// BookingDisagreementRequest represents the request to open a return condition disagreement
+type BookingDisagreementRequest struct {
+	Description string           `json:"description"`
+	Images      []types.HexBytes `json:"images"`
+}
+
+// BookingDisagreement represents a return condition disagreement of a booking
+type BookingDisagreement struct {
+	Status      string           `json:"status"`
+	OpenedBy    string           `json:"openedBy"`
+	Description string           `json:"description"`
+	Images      []types.HexBytes `json:"images,omitempty"`
+	OpenedAt    int64            `json:"openedAt"`
+	Deadline    int64            `json:"deadline"`
+	ResolvedAt  int64            `json:"resolvedAt,omitempty"`
+	EscalatedAt int64            `json:"escalatedAt,omitempty"`
+}
+
+// FromDBBookingDisagreement converts a DB BookingDisagreement to an API BookingDisagreement.
+func (d *BookingDisagreement) FromDBBookingDisagreement(dbd *db.BookingDisagreement) *BookingDisagreement {
+	d.Status = string(dbd.Status)
+	d.OpenedBy = dbd.OpenedBy.Hex()
+	d.Description = dbd.Description
+	for i := range dbd.Images {
+		d.Images = append(d.Images, dbd.Images[i].Hash)
+	}
+	d.OpenedAt = dbd.OpenedAt.Unix()
+	d.Deadline = dbd.Deadline.Unix()
+	if dbd.ResolvedAt != nil {
+		d.ResolvedAt = dbd.ResolvedAt.Unix()
+	}
+	if dbd.EscalatedAt != nil {
+		d.EscalatedAt = dbd.EscalatedAt.Unix()
+	}
+	return d
+}
+
+// ToolReportRequest represents the request to report a tool as lost or stolen
+type ToolReportRequest struct {
+	Status       string `json:"status"`
+	Description  string `json:"description"`
+	SerialNumber string `json:"serialNumber"`
+}
+
+// ToolReport represents a lost or stolen tool entry of the registry
+type ToolReport struct {
+	ID           string    `json:"id"`
+	ToolID       int64     `json:"toolId"`
+	UserID       string    `json:"userId"`
+	ToolTitle    string    `json:"toolTitle"`
+	Status       string    `json:"status"`
+	Description  string    `json:"description"`
+	SerialNumber string    `json:"serialNumber,omitempty"`
+	ReportedAt   time.Time `json:"reportedAt"`
+}
+
+// FromDBToolReport converts a DB ToolReport to an API ToolReport.
+func (r *ToolReport) FromDBToolReport(dbr *db.ToolReport) *ToolReport {
+	r.ID = dbr.ID.Hex()
+	r.ToolID = dbr.ToolID
+	r.UserID = dbr.UserID.Hex()
+	r.ToolTitle = dbr.ToolTitle
+	r.Status = string(dbr.Status)
+	r.Description = dbr.Description
+	r.SerialNumber = dbr.SerialNumber
+	r.ReportedAt = dbr.ReportedAt
+	return r
+}
+
+type ToolReportsWrapper struct {
+	Reports []*ToolReport `json:"reports"`
+}
+
+// SavedSearchRequest represents the request to save a tool search
+type SavedSearchRequest struct {
+	SearchTerm       string  `json:"term"`
+	Categories       []int   `json:"categories"`
+	Distance         int     `json:"distance"`
+	MaxCost          *uint64 `json:"maxCost"`
+	MayBeFree        *bool   `json:"maybeFree"`
+	TransportOptions []int   `json:"transports"`
+}
+
+// SavedSearch represents a saved tool search
+type SavedSearch struct {
+	ID               string    `json:"id"`
+	SearchTerm       string    `json:"term,omitempty"`
+	Categories       []int     `json:"categories,omitempty"`
+	Distance         int       `json:"distance"`
+	MaxCost          *uint64   `json:"maxCost,omitempty"`
+	MayBeFree        *bool     `json:"maybeFree,omitempty"`
+	TransportOptions []int     `json:"transports,omitempty"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+// FromDBSavedSearch converts a DB SavedSearch to an API SavedSearch.
+func (s *SavedSearch) FromDBSavedSearch(dbs *db.SavedSearch) *SavedSearch {
+	s.ID = dbs.ID.Hex()
+	s.SearchTerm = dbs.SearchTerm
+	s.Categories = dbs.Categories
+	s.Distance = dbs.Distance
+	s.MaxCost = dbs.MaxCost
+	s.MayBeFree = dbs.MayBeFree
+	s.TransportOptions = dbs.TransportOptions
+	s.CreatedAt = dbs.CreatedAt
+	return s
+}
+
+type SavedSearchesWrapper struct {
+	Searches []*SavedSearch `json:"searches"`
+}
+
+// Invite is an invite code created by the user, with the user registered with it if used
+type Invite struct {
+	Code       string     `json:"code"`
+	Status     string     `json:"status"`
+	Community  string     `json:"community,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UsedBy     string     `json:"usedBy,omitempty"`
+	UsedByName string     `json:"usedByName,omitempty"`
+	UsedAt     *time.Time `json:"usedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	// UsedByActive is true if the invitee shared a tool or completed a booking
+	UsedByActive bool `json:"usedByActive,omitempty"`
+}
+
+// FromDBInviteCode converts a DB InviteCode to an API Invite.
+func (i *Invite) FromDBInviteCode(dbi *db.InviteCode) *Invite {
+	i.Code = dbi.Code
+	i.Status = string(dbi.Status())
+	i.Community = dbi.Community
+	i.CreatedAt = dbi.CreatedAt
+	if dbi.UsedBy != nil {
+		i.UsedBy = dbi.UsedBy.Hex()
+	}
+	i.UsedAt = dbi.UsedAt
+	i.RevokedAt = dbi.RevokedAt
+	return i
+}
+
+// CreateInviteRequest is the optional body of a new invite code. If Community is true the
+// users registered with the code join the community of the inviter.
+type CreateInviteRequest struct {
+	Community bool `json:"community"`
+}
+
+// InvitesWrapper are the invite codes of the user. NextInviteAt is set while the user
+// cannot create a new code because of the cooldown
+type InvitesWrapper struct {
+	Invites      []*Invite     `json:"invites"`
+	NextInviteAt *time.Time    `json:"nextInviteAt,omitempty"`
+	Referrals    ReferralStats `json:"referrals"`
+}
+
+// ReferralStats are the number of users registered with the invite codes of the user, and how
+// many of them became active, sharing a tool or completing a booking
+type ReferralStats struct {
+	Invited int `json:"invited"`
+	Active  int `json:"active"`
+}
+
+// InviteTreeNode is a user of the invite tree, with the users registered with its invite codes
+type InviteTreeNode struct {
+	UserID    string            `json:"userId"`
+	Name      string            `json:"name"`
+	InvitedAt *time.Time        `json:"invitedAt,omitempty"`
+	Invited   []*InviteTreeNode `json:"invited"`
+}
+
+// InviteTreeResponse are the roots of the invite tree, the users not invited by another user
+type InviteTreeResponse struct {
+	Roots []*InviteTreeNode `json:"roots"`
+}
+
+// Notification represents an in-app notification
+type Notification struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	ToolID    int64     `json:"toolId,omitempty"`
+	BookingID string    `json:"bookingId,omitempty"`
+	PostID    string    `json:"postId,omitempty"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FromDBNotification converts a DB Notification to an API Notification.
+func (n *Notification) FromDBNotification(dbn *db.Notification) *Notification {
+	n.ID = dbn.ID.Hex()
+	n.Type = string(dbn.Type)
+	n.Message = dbn.Message
+	n.ToolID = dbn.ToolID
+	if !dbn.BookingID.IsZero() {
+		n.BookingID = dbn.BookingID.Hex()
+	}
+	if !dbn.PostID.IsZero() {
+		n.PostID = dbn.PostID.Hex()
+	}
+	n.Read = dbn.Read
+	n.CreatedAt = dbn.CreatedAt
+	return n
+}
+
+type NotificationsWrapper struct {
+	Notifications []*Notification `json:"notifications"`
+	Unread        int64           `json:"unread"`
+}
+
+// PostRequest is the body of a new community post.
+type PostRequest struct {
+	Title        string `json:"title"`
+	Body         string `json:"body"`
+	Announcement bool   `json:"announcement,omitempty"`
+}
+
+// Post is a post of a community board.
+type Post struct {
+	ID           string    `json:"id"`
+	Community    string    `json:"community"`
+	AuthorID     string    `json:"authorId"`
+	Title        string    `json:"title"`
+	Body         string    `json:"body"`
+	Announcement bool      `json:"announcement"`
+	Pinned       bool      `json:"pinned"`
+	Comments     int64     `json:"comments"`
+	CreatedAt    time.Time `json:"createdAt"`
+	// Refs are the tools, bookings and users referenced by the body
+	Refs []db.EntityRef `json:"refs,omitempty"`
+}
+
+// FromDBPost converts a DB Post to an API Post.
+func (p *Post) FromDBPost(dbp *db.Post) *Post {
+	p.ID = dbp.ID.Hex()
+	p.Community = dbp.Community
+	p.AuthorID = dbp.AuthorID.Hex()
+	p.Title = dbp.Title
+	p.Body = dbp.Body
+	p.Announcement = dbp.Announcement
+	p.Pinned = dbp.Pinned
+	p.Comments = dbp.Comments
+	p.CreatedAt = dbp.CreatedAt
+	p.Refs = dbp.Refs
+	return p
+}
+
+type PostsWrapper struct {
+	Posts []*Post `json:"posts"`
+}
+
+// CommentRequest is the body of a new comment on a community post.
+type CommentRequest struct {
+	Body string `json:"body"`
+}
+
+// PostComment is a comment on a community post.
+type PostComment struct {
+	ID        string    `json:"id"`
+	PostID    string    `json:"postId"`
+	AuthorID  string    `json:"authorId"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Refs are the tools, bookings and users referenced by the body
+	Refs []db.EntityRef `json:"refs,omitempty"`
+}
+
+// FromDBPostComment converts a DB PostComment to an API PostComment.
+func (c *PostComment) FromDBPostComment(dbc *db.PostComment) *PostComment {
+	c.ID = dbc.ID.Hex()
+	c.PostID = dbc.PostID.Hex()
+	c.AuthorID = dbc.AuthorID.Hex()
+	c.Body = dbc.Body
+	c.CreatedAt = dbc.CreatedAt
+	c.Refs = dbc.Refs
+	return c
+}
+
+type PostCommentsWrapper struct {
+	Comments []*PostComment `json:"comments"`
+}
+
+// CrowdfundRequest is the body of a new crowdfund, the joint purchase of a tool by the members
+// of a community.
+type CrowdfundRequest struct {
+	Title          string `json:"title"`
+	Description    string `json:"description"`
+	ToolCategory   int    `json:"toolCategory"`
+	EstimatedValue uint64 `json:"estimatedValue"`
+	Goal           uint64 `json:"goal"`
+}
+
+// PledgeRequest is the tokens a member pledges to a crowdfund.
+type PledgeRequest struct {
+	Amount uint64 `json:"amount"`
+}
+
+// Crowdfund is the joint purchase of a tool by the members of a community.
+type Crowdfund struct {
+	ID             string                   `json:"id"`
+	Community      string                   `json:"community"`
+	CreatedBy      string                   `json:"createdBy"`
+	Title          string                   `json:"title"`
+	Description    string                   `json:"description"`
+	ToolCategory   int                      `json:"toolCategory"`
+	EstimatedValue uint64                   `json:"estimatedValue"`
+	Goal           uint64                   `json:"goal"`
+	Pledged        uint64                   `json:"pledged"`
+	Contributions  []*CrowdfundContribution `json:"contributions"`
+	Status         string                   `json:"status"`
+	CreatedAt      time.Time                `json:"createdAt"`
+	ClosedAt       *time.Time               `json:"closedAt,omitempty"`
+	// ToolID is the community tool registered when the crowdfund is completed
+	ToolID int64 `json:"toolId,omitempty"`
+}
+
+// FromDBCrowdfund converts a DB Crowdfund to an API Crowdfund.
+func (c *Crowdfund) FromDBCrowdfund(dbc *db.Crowdfund) *Crowdfund {
+	c.ID = dbc.ID.Hex()
+	c.Community = dbc.Community
+	c.CreatedBy = dbc.CreatedBy.Hex()
+	c.Title = dbc.Title
+	c.Description = dbc.Description
+	c.ToolCategory = dbc.ToolCategory
+	c.EstimatedValue = dbc.EstimatedValue
+	c.Goal = dbc.Goal
+	c.Pledged = dbc.Pledged
+	c.Contributions = make([]*CrowdfundContribution, len(dbc.Contributions))
+	for i, contribution := range dbc.Contributions {
+		c.Contributions[i] = &CrowdfundContribution{
+			UserID:    contribution.UserID.Hex(),
+			Amount:    contribution.Amount,
+			PledgedAt: contribution.PledgedAt,
+		}
+	}
+	c.Status = string(dbc.Status)
+	c.CreatedAt = dbc.CreatedAt
+	c.ClosedAt = dbc.ClosedAt
+	c.ToolID = dbc.ToolID
+	return c
+}
+
+// CrowdfundContribution are the tokens pledged by a member to a crowdfund.
+type CrowdfundContribution struct {
+	UserID    string    `json:"userId"`
+	Amount    uint64    `json:"amount"`
+	PledgedAt time.Time `json:"pledgedAt"`
+}
+
+type CrowdfundsWrapper struct {
+	Crowdfunds []*Crowdfund `json:"crowdfunds"`
+}
+
+// NotificationPreferences maps each notification type to the channels it is delivered through.
+type NotificationPreferences map[db.NotificationType]db.NotificationChannels
+
+// MessageRequest is the body of a new direct message.
+type MessageRequest struct {
+	Text string `json:"text"`
+	// BookingID is the booking between the two users the message is about, if any
+	BookingID string `json:"bookingId,omitempty"`
+}
+
+// Message is a direct message between two users
+type Message struct {
+	ID         string     `json:"id"`
+	FromUserID string     `json:"fromUserId"`
+	ToUserID   string     `json:"toUserId"`
+	Text       string     `json:"text"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ReadAt     *time.Time `json:"readAt,omitempty"`
+	// Refs are the tools, bookings and users referenced by the text
+	Refs []db.EntityRef `json:"refs,omitempty"`
+	// BookingID is the booking of the thread the message was sent in, if any
+	BookingID string `json:"bookingId,omitempty"`
+	// ViaEmail is true if the message is a reply to a notification email
+	ViaEmail bool `json:"viaEmail,omitempty"`
+}
+
+// FromDBMessage converts a DB Message to an API Message.
+func (m *Message) FromDBMessage(dbm *db.Message) *Message {
+	m.ID = dbm.ID.Hex()
+	m.FromUserID = dbm.FromUserID.Hex()
+	m.ToUserID = dbm.ToUserID.Hex()
+	m.Text = dbm.Text
+	m.CreatedAt = dbm.CreatedAt
+	m.ReadAt = dbm.ReadAt
+	m.Refs = dbm.Refs
+	if dbm.BookingID != nil {
+		m.BookingID = dbm.BookingID.Hex()
+	}
+	m.ViaEmail = dbm.ViaEmail
+	return m
+}
+
+type MessagesWrapper struct {
+	Messages []*Message `json:"messages"`
+}
+
+// Contact is another user the user messages or blocks
+type Contact struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatarUrl"`
+}
+
+// Conversation is the summary of the conversation of the user with another user
+type Conversation struct {
+	User        *Contact `json:"user"`
+	LastMessage *Message `json:"lastMessage"`
+	Unread      int64    `json:"unread"`
+}
+
+type ConversationsWrapper struct {
+	Conversations []*Conversation `json:"conversations"`
+	Unread        int64           `json:"unread"`
+}
+
+type ContactsWrapper struct {
+	Users []*Contact `json:"users"`
+}
+
+// DigestPreferences are the settings of the weekly email digest of new nearby tools. Radius
+// is in meters, and Community also includes the tools of the community at any distance.
+type DigestPreferences struct {
+	Enabled    bool       `json:"enabled"`
+	Radius     int        `json:"radius"`
+	Community  bool       `json:"community"`
+	LastSentAt *time.Time `json:"lastSentAt,omitempty"`
+}
+
+// Session is an open session of the user. Current is the session of the request.
+type Session struct {
+	ID         string    `json:"id"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	Current    bool      `json:"current"`
+}
+
+// FromDBSession converts a DB session to an API session.
+func (s *Session) FromDBSession(dbs *db.Session) *Session {
+	s.ID = dbs.ID.Hex()
+	s.IP = dbs.IP
+	s.UserAgent = dbs.UserAgent
+	s.Country = dbs.Country
+	s.CreatedAt = dbs.CreatedAt
+	s.LastSeenAt = dbs.LastSeenAt
+	return s
+}
+
+type SessionsWrapper struct {
+	Sessions []*Session `json:"sessions"`
+}
+
+// LoginLocked is the data of the ErrLoginLocked error, with the end of the lockout.
+type LoginLocked struct {
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// PasswordViolations is the data of the ErrWeakPassword error, with the rules of the password
+// policy the password does not follow.
+type PasswordViolations struct {
+	Violations []password.Violation `json:"violations"`
+}
+
+// AuditLogWrapper is a page of the audit log.
+type AuditLogWrapper struct {
+	Entries  []*db.AuditEntry `json:"entries"`
+	Total    int64            `json:"total"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"pageSize"`
+}
+
+// UserRoleRequest is the body of a role change, the role is "admin" or empty.
+type UserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// UserBlockRequest is the body of a block or unblock of a user by an admin.
+type UserBlockRequest struct {
+	Blocked bool `json:"blocked"`
+}
+
+// UserCommunityRequest is the body of a community change, an empty community removes the
+// user from its community.
+type UserCommunityRequest struct {
+	Community string `json:"community"`
+}
+
+// TelegramStatus is the Telegram account linked by the user. Enabled is false if the instance
+// has no Telegram bot.
+type TelegramStatus struct {
+	Enabled     bool       `json:"enabled"`
+	BotUsername string     `json:"botUsername,omitempty"`
+	Linked      bool       `json:"linked"`
+	LinkedAt    *time.Time `json:"linkedAt,omitempty"`
+}
+
+// TelegramLink is the deep link of the bot that links the Telegram account of the user.
+type TelegramLink struct {
+	URL string `json:"url"`
+}
+
+// DeviceRequest is the body of a device registration. Token is the FCM registration token or,
+// for webpush, the endpoint of the subscription, with its p256dh and auth keys.
+type DeviceRequest struct {
+	Platform string `json:"platform"`
+	Token    string `json:"token"`
+	P256dh   string `json:"p256dh,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// Device is a device registered to receive push notifications.
+type Device struct {
+	ID        string    `json:"id"`
+	Platform  string    `json:"platform"`
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FromDBDevice converts a DB Device to an API Device.
+func (d *Device) FromDBDevice(dbd *db.Device) *Device {
+	d.ID = dbd.ID.Hex()
+	d.Platform = dbd.Platform
+	d.Token = dbd.Token
+	d.CreatedAt = dbd.CreatedAt
+	return d
+}
+
+// AccountRecoveryRequest is the body of an account recovery request
+type AccountRecoveryRequest struct {
+	Email    string `json:"email"`
+	NewEmail string `json:"newEmail"`
+	Message  string `json:"message"`
+}
+
+// AccountRecoveryComplete is the body to complete an approved account recovery
+type AccountRecoveryComplete struct {
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+// AccountRecovery represents an account recovery request as seen by the admins
+type AccountRecovery struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	Community string    `json:"community,omitempty"`
+	OldEmail  string    `json:"oldEmail"`
+	NewEmail  string    `json:"newEmail"`
+	Message   string    `json:"message"`
+	Status    string    `json:"status"`
+	Approvals []string  `json:"approvals"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Code is the one time code to complete the recovery. It is only returned to the admin
+	// giving the last required approval, who must deliver it to the user out of band.
+	Code string `json:"code,omitempty"`
+}
+
+// FromDBAccountRecovery converts a DB AccountRecovery to an API AccountRecovery.
+func (ar *AccountRecovery) FromDBAccountRecovery(dbr *db.AccountRecovery) *AccountRecovery {
+	ar.ID = dbr.ID.Hex()
+	ar.UserID = dbr.UserID.Hex()
+	ar.Community = dbr.Community
+	ar.OldEmail = dbr.OldEmail
+	ar.NewEmail = dbr.NewEmail
+	ar.Message = dbr.Message
+	ar.Status = string(dbr.Status)
+	ar.Approvals = []string{}
+	for _, id := range dbr.Approvals {
+		ar.Approvals = append(ar.Approvals, id.Hex())
+	}
+	ar.CreatedAt = dbr.CreatedAt
+	return ar
+}
+
+type AccountRecoveriesWrapper struct {
+	Recoveries []*AccountRecovery `json:"recoveries"`
+}
+
+// OriginAttributionResponse is the booking attribution by origin since a date
+type OriginAttributionResponse struct {
+	Since   time.Time               `json:"since"`
+	Origins []*db.OriginAttribution `json:"origins"`
+}
+
+// ImageUsageResponse is the storage used by the images, in total and by the images of each user
+type ImageUsageResponse struct {
+	Images int64                `json:"images"`
+	Bytes  int64                `json:"bytes"`
+	Users  []*db.UserImageUsage `json:"users"`
+}
+
+// DeleteProfileRequest is the body to delete the account of the user
+type DeleteProfileRequest struct {
+	Password string `json:"password"`
+	// TransferToolsTo is the ID of the user receiving the tools. If empty, the tools are deleted.
+	TransferToolsTo string `json:"transferToolsTo,omitempty"`
+}
+
+// ExportedRating is a rating received by the user (ToolID is zero) or by one of its tools
+type ExportedRating struct {
+	ToolID int64 `json:"toolId,omitempty"`
+	Rating int   `json:"rating"`
+}
+
+// ProfileExport contains all the data of a user for portability
+type ProfileExport struct {
+	ExportedAt    time.Time         `json:"exportedAt"`
+	Profile       *User             `json:"profile"`
+	Tools         []*Tool           `json:"tools"`
+	Bookings      []BookingResponse `json:"bookings"`
+	Ratings       []ExportedRating  `json:"ratings"`
+	SavedSearches []*SavedSearch    `json:"savedSearches"`
+	Favorites     []int64           `json:"favorites"`
+	Images        []types.HexBytes  `json:"images"`
+	// TermsAcceptances are the terms versions accepted by the user and when
+	TermsAcceptances []db.TermsAcceptance `json:"termsAcceptances"`
+}
+
+// HealthResponse is the status of the service and of the dependencies it checked
+type HealthResponse struct {
+	Status string                  `json:"status"`
+	Checks map[string]*HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the result of checking a dependency. Optional dependencies do not make the
+// service unavailable when they fail.
+type HealthCheck struct {
+	Status    string `json:"status"`
+	Optional  bool   `json:"optional,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+// BookingList is a list of bookings (API version 2), a page of them if Page is set
+type BookingList struct {
+	Bookings []BookingResponse `json:"bookings"`
+	Page     *int              `json:"page,omitempty"`
+	PageSize int               `json:"pageSize,omitempty"`
+}
+
+// Onboarding is the onboarding checklist of a user, with the number of completed steps
+type Onboarding struct {
+	Steps     []*OnboardingStep `json:"steps"`
+	Completed int               `json:"completed"`
+	Total     int               `json:"total"`
+}
+
+// OnboardingStep is a step of the onboarding checklist: verifiedEmail, location, avatar,
+// firstTool, community or firstBooking
+type OnboardingStep struct {
+	Step      string `json:"step"`
+	Completed bool   `json:"completed"`
+}
+
+// OwnerStatsResponse are the analytics of the booking requests received by a tool owner in
+// the requested period.
+type OwnerStatsResponse struct {
+	From     *int64 `json:"from,omitempty"`
+	To       *int64 `json:"to,omitempty"`
+	Requests int64  `json:"requests"`
+	Accepted int64  `json:"accepted"`
+	Rejected int64  `json:"rejected"`
+	// AcceptanceRate is the ratio (0 to 1) of the answered requests that were accepted, omitted
+	// if no request was answered.
+	AcceptanceRate *float64 `json:"acceptanceRate,omitempty"`
+	// TokensEarned is the cost of the returned bookings, the tool cost for each booked day.
+	TokensEarned uint64 `json:"tokensEarned"`
+	// Months are the requests and ratings of each month, the oldest first.
+	Months []*OwnerMonthStats `json:"months"`
+	// TopTools are the most requested tools.
+	TopTools []*OwnerToolStats `json:"topTools"`
+}
+
+// OwnerMonthStats are the requests received by a tool owner in a month.
+type OwnerMonthStats struct {
+	// Month is formatted as YYYY-MM.
+	Month    string `json:"month"`
+	Requests int64  `json:"requests"`
+	Returned int64  `json:"returned"`
+	// Rating is the average rating (1 to 5) received for the bookings of the month, omitted
+	// if none was rated.
+	Rating  *float64 `json:"rating,omitempty"`
+	Ratings int64    `json:"ratings"`
+}
+
+// OwnerToolStats are the requests received for a tool.
+type OwnerToolStats struct {
+	ToolID       int64  `json:"toolId"`
+	Title        string `json:"title"`
+	Requests     int64  `json:"requests"`
+	TokensEarned uint64 `json:"tokensEarned"`
+}
+
+// CommunityStatsResponse are the stats of a community, recalculated periodically.
+type CommunityStatsResponse struct {
+	Community string `json:"community"`
+	Members   int64  `json:"members"`
+	// MemberGrowth is the number of members by the month they registered, the oldest first.
+	MemberGrowth      []*db.MonthlyCount `json:"memberGrowth"`
+	ToolsShared       int64              `json:"toolsShared"`
+	BookingsCompleted int64              `json:"bookingsCompleted"`
+	// MostActive are the members with most completed bookings, the most active first.
+	MostActive []*ActiveMember `json:"mostActive"`
+	// EstimatedSavings is the sum of the estimated value of the tools of each completed
+	// booking, what the renters would have spent buying the tools.
+	EstimatedSavings uint64    `json:"estimatedSavings"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// ActiveMember is a community member and its number of completed bookings.
+type ActiveMember struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Bookings int64  `json:"bookings"`
+}
+
+// InboundMail is an email received by the inbound mail webhook. The mail providers posting a
+// form send the same fields, or their usual names: sender, recipient and body-plain.
+type InboundMail struct {
+	// From is the sender of the email, i.e. "Maria <maria@example.com>"
+	From string `json:"from"`
+	// To is the recipient of the email, the reply address of a notification
+	To string `json:"to"`
+	// Text is the plain text body of the email
+	Text string `json:"text"`
+}
+
+// TermsRequest is the body of a new terms version.
+type TermsRequest struct {
+	// URL is the document of the terms of service
+	URL string `json:"url"`
+	// PrivacyURL is the document of the privacy policy, if not part of the terms
+	PrivacyURL string `json:"privacyUrl,omitempty"`
+	// Summary describes the changes from the previous version
+	Summary string `json:"summary,omitempty"`
+}
+
+// AcceptTermsRequest is the body of the acceptance of the current terms.
+type AcceptTermsRequest struct {
+	Version int `json:"version"`
+}
+
+// TermsStatus is the current terms and the terms versions accepted by the user.
+type TermsStatus struct {
+	// Current is the current terms, omitted if none was published
+	Current            *db.TermsVersion     `json:"current,omitempty"`
+	AcceptedVersion    int                  `json:"acceptedVersion"`
+	Acceptances        []db.TermsAcceptance `json:"acceptances"`
+	AcceptanceRequired bool                 `json:"acceptanceRequired"`
 }
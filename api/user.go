@@ -1,10 +1,12 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/emprius/emprius-app-backend/db"
 	"github.com/rs/zerolog/log"
@@ -18,17 +20,43 @@ func (a *API) registerHandler(r *Request) (interface{}, error) {
 	if err := json.Unmarshal(r.Data, &userInfo); err != nil {
 		return nil, ErrInvalidRequestBodyData.WithErr(err)
 	}
-	if userInfo.RegisterAuthToken != a.registerAuthToken {
-		return nil, ErrInvalidRegisterAuthToken
+	if err := a.checkPassword(userInfo.Password, userInfo.UserEmail, userInfo.Name); err != nil {
+		return nil, err
+	}
+	hash, err := a.hashPassword(userInfo.Password)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
 	}
 	user := db.User{
+		ID:       primitive.NewObjectID(),
 		Email:    userInfo.UserEmail,
-		Password: hashPassword(userInfo.Password),
+		Password: hash,
 		Name:     userInfo.Name,
 		Active:   true,
 		Rating:   50,
 		Tokens:   1000,
 	}
+	// Users register with the registration token of the instance or an invite code of another user
+	ctx := r.Context.Request.Context()
+	registered := false
+	var invite *db.InviteCode
+	if userInfo.RegisterAuthToken != a.registerAuthToken {
+		var err error
+		invite, err = a.useInviteCode(ctx, userInfo.RegisterAuthToken, user.ID)
+		if err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
+		}
+		if invite == nil {
+			return nil, ErrInvalidRegisterAuthToken
+		}
+		user.Community = invite.Community
+		// The code can be used again if the registration fails
+		defer func() {
+			if !registered {
+				a.releaseInviteCode(ctx, invite, user.ID)
+			}
+		}()
+	}
 	if userInfo.Avatar != nil {
 		image, err := a.addImage(userInfo.Name+"_avatar", userInfo.Avatar)
 		if err != nil {
@@ -36,18 +64,39 @@ func (a *API) registerHandler(r *Request) (interface{}, error) {
 		}
 		user.AvatarHash = image.Hash
 	}
-	if userInfo.Location != nil {
-		user.Location = userInfo.Location.ToDBLocation()
+	location, locality, err := a.resolveLocation(ctx, userInfo.Location, userInfo.Address)
+	if err != nil {
+		return nil, err
+	}
+	if location != nil {
+		user.Location = *location
+		user.Locality = locality
+	}
+	// The terms read by the user on registration must be the current ones, otherwise they are
+	// accepted afterwards
+	if userInfo.AcceptedTermsVersion != 0 {
+		terms, err := a.database.TermsService.Current(ctx)
+		if err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
+		}
+		if terms != nil && terms.Version == userInfo.AcceptedTermsVersion {
+			user.TermsAcceptances = []db.TermsAcceptance{{Version: terms.Version, AcceptedAt: time.Now()}}
+		}
 	}
 
 	id, err := a.addUser(&user)
 	if err != nil {
 		return nil, ErrInternalServerError.WithErr(err)
 	}
+	registered = true
+	if invite != nil {
+		a.notifyInviteUsed(ctx, invite, &user)
+	}
 	// Generate a new token with the user's ObjectID
-	token, err := a.makeToken(id.Hex())
+	user.ID = id
+	token, err := a.startSession(r, &user, false)
 	if err != nil {
-		return nil, ErrInternalServerError.WithErr(err)
+		return nil, err
 	}
 
 	return &token, nil
@@ -59,6 +108,7 @@ func (a *API) addUser(u *db.User) (primitive.ObjectID, error) {
 	if err != nil {
 		return [12]byte{}, fmt.Errorf("could not insert user to database: %w", err)
 	}
+	a.infoCache.invalidate()
 	return r.InsertedID.(primitive.ObjectID), nil
 }
 
@@ -69,18 +119,35 @@ func (a *API) loginHandler(r *Request) (interface{}, error) {
 	if err := json.Unmarshal(r.Data, &loginInfo); err != nil {
 		return nil, ErrInvalidRequestBodyData.WithErr(err)
 	}
+	// Locked logins are rejected before checking the password, so it cannot be guessed meanwhile
+	if err := a.checkLoginLockout(r.Context.Request.Context(), loginInfo.Email, clientIP(r.Context.Request.RemoteAddr)); err != nil {
+		return nil, err
+	}
 	user, err := a.database.UserService.GetUserByEmail(context.Background(), loginInfo.Email)
 	if err != nil {
-		return nil, ErrWrongLogin
-	}
-	if !bytes.Equal(user.Password, hashPassword(loginInfo.Password)) {
-		return nil, ErrWrongLogin
-	}
+		a.audit(r, &db.AuditEntry{Action: db.AuditLoginFailed, Details: loginInfo.Email})
+		return nil, a.loginFailed(r, loginInfo.Email, nil)
+	}
+	match, rehash := a.verifyPassword(loginInfo.Password, user.Password)
+	if !match {
+		a.audit(r, &db.AuditEntry{
+			ActorID:    user.ID,
+			Action:     db.AuditLoginFailed,
+			TargetType: "user",
+			TargetID:   user.ID.Hex(),
+		})
+		return nil, a.loginFailed(r, loginInfo.Email, user)
+	}
+	a.loginSucceeded(r.Context.Request.Context(), loginInfo.Email)
+	if rehash {
+		a.rehashPassword(r.Context.Request.Context(), user, loginInfo.Password)
+	}
+	a.audit(r, &db.AuditEntry{ActorID: user.ID, Action: db.AuditLogin, TargetType: "user", TargetID: user.ID.Hex()})
 
-	// Generate a new token with the user's ObjectID
-	token, err := a.makeToken(user.ID.Hex())
+	// Generate a new token with the user's ObjectID, in a new session
+	token, err := a.startSession(r, user, true)
 	if err != nil {
-		return nil, ErrInternalServerError.WithErr(fmt.Errorf("failed to generate token: %w", err))
+		return nil, err
 	}
 
 	return &token, nil
@@ -88,8 +155,18 @@ func (a *API) loginHandler(r *Request) (interface{}, error) {
 
 // refresh handles the refresh request. It returns a new JWT token.
 func (a *API) refreshHandler(r *Request) (interface{}, error) {
+	// The session of the token is kept open as long as its token is refreshed
+	if r.SessionID != "" {
+		id, err := primitive.ObjectIDFromHex(r.SessionID)
+		if err != nil {
+			return nil, ErrUnauthorized.WithErr(err)
+		}
+		if err := a.database.SessionService.Extend(r.Context.Request.Context(), id, time.Now().Add(jwtExpiration)); err != nil {
+			return nil, ErrUnauthorized.WithErr(err)
+		}
+	}
 	// Generate a new token with the user name as the subject
-	token, err := a.makeToken(r.UserID)
+	token, err := a.makeToken(r.UserID, r.SessionID)
 	if err != nil {
 		return nil, ErrInternalServerError.WithErr(err)
 	}
@@ -97,21 +174,137 @@ func (a *API) refreshHandler(r *Request) (interface{}, error) {
 	return &token, nil
 }
 
-// usersHandler list the existing users with pagination.
+// usersHandler handles GET /users?name=&community=&active=&minRating=&distance=&sort=&page=&pageSize=
+// It lists the users matching the filters with pagination. The users are sorted by distance
+// to the requester if a distance is given or sort is "distance".
 func (a *API) usersHandler(r *Request) (interface{}, error) {
-	page, err := r.Context.GetPage()
+	ids, err := r.Context.GetIDs()
 	if err != nil {
 		return nil, ErrInvalidRequestBodyData.WithErr(err)
 	}
-	users, err := a.database.UserService.GetAllUsers(r.Context.Request.Context(), page)
+	if ids != nil {
+		return a.usersByIDs(r, ids)
+	}
+	opts, sortByDistance, err := parseUserSearch(r.Context)
+	if err != nil {
+		return nil, err
+	}
+	if sortByDistance {
+		requester, err := a.getDBUserByID(r.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if requester.Location.Type == "" {
+			return nil, ErrLocationRequired.WithErr(fmt.Errorf("user %s has no location", r.UserID))
+		}
+		opts.Location = &requester.Location
+	}
+	users, total, err := a.database.UserService.SearchUsers(r.Context.Request.Context(), *opts)
 	if err != nil {
 		return nil, ErrInternalServerError.WithErr(err)
 	}
-	userList := []*User{}
+	result := &UsersWrapper{
+		Users:    []*User{},
+		Total:    total,
+		Page:     opts.Page,
+		PageSize: db.PageSize(opts.PageSize),
+	}
 	for _, u := range users {
-		userList = append(userList, new(User).FromDBUser(u))
+		user := new(User).FromDBUser(&u.User)
+		if sortByDistance {
+			distance := roundDistance(u.Distance)
+			user.Distance = &distance
+		}
+		if user.ID != r.UserID {
+			a.hidePrivateUserData(user)
+		}
+		result.Users = append(result.Users, user)
+	}
+	return result, nil
+}
+
+// usersByIDs handles GET /users?ids=
+// Returns the users with the given IDs in the same order, skipping the missing ones.
+// As in GET /users/{id}, the exact location is only shown to the user and to renters with an
+// accepted booking from the user, and the community is removed if the user hides it.
+func (a *API) usersByIDs(r *Request, ids []string) (interface{}, error) {
+	userIDs := make([]primitive.ObjectID, len(ids))
+	for i, id := range ids {
+		var err error
+		if userIDs[i], err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, ErrInvalidUserID.WithErr(fmt.Errorf("invalid user id %q", id))
+		}
+	}
+	ctx := r.Context.Request.Context()
+	dbUsers, err := a.database.UserService.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	byID := make(map[primitive.ObjectID]*db.User, len(dbUsers))
+	for _, user := range dbUsers {
+		byID[user.ID] = user
 	}
-	return &UsersWrapper{Users: userList}, nil
+	result := &UsersWrapper{Users: []*User{}}
+	for _, id := range userIDs {
+		dbUser, ok := byID[id]
+		if !ok {
+			continue
+		}
+		user := new(User).FromDBUser(dbUser)
+		if !a.canSeeExactLocation(ctx, r.UserID, dbUser.ID, "") {
+			a.hidePrivateUserData(user)
+		}
+		result.Users = append(result.Users, user)
+	}
+	result.Total = int64(len(result.Users))
+	result.PageSize = len(result.Users)
+	return result, nil
+}
+
+// parseUserSearch parses the user search query parameters. It returns true if the users
+// must be sorted by distance to the requester.
+func parseUserSearch(hc *HTTPContext) (*db.SearchUsersOptions, bool, error) {
+	opts := &db.SearchUsersOptions{}
+	var err error
+	if opts.Page, err = hc.GetPage(); err != nil {
+		return nil, false, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if opts.PageSize, err = hc.GetPageSize(); err != nil {
+		return nil, false, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	if name := hc.URLParam("name"); name != nil {
+		opts.Name = strings.TrimSpace(name[0])
+	}
+	if community := hc.URLParam("community"); community != nil {
+		opts.Community = community[0]
+	}
+	if activeStr := hc.URLParam("active"); activeStr != nil {
+		active, err := strconv.ParseBool(activeStr[0])
+		if err != nil {
+			return nil, false, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid active value: %s", activeStr[0]))
+		}
+		opts.Active = &active
+	}
+	if ratingStr := hc.URLParam("minRating"); ratingStr != nil {
+		rating, err := strconv.ParseInt(ratingStr[0], 10, 32)
+		if err != nil || rating < 0 || rating > 100 {
+			return nil, false, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid minRating value: %s", ratingStr[0]))
+		}
+		opts.MinRating = int32(rating)
+	}
+	if distanceStr := hc.URLParam("distance"); distanceStr != nil {
+		if opts.Distance, err = strconv.Atoi(distanceStr[0]); err != nil || opts.Distance < 0 {
+			return nil, false, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid distance value: %s", distanceStr[0]))
+		}
+	}
+	sortByDistance := opts.Distance > 0
+	if sort := hc.URLParam("sort"); sort != nil {
+		if sort[0] != "distance" {
+			return nil, false, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("invalid sort value: %s", sort[0]))
+		}
+		sortByDistance = true
+	}
+	return opts, sortByDistance, nil
 }
 
 // getUserHandler handles GET /users/{id}
@@ -130,7 +323,64 @@ func (a *API) getUserHandler(r *Request) (interface{}, error) {
 		return nil, ErrUserNotFound.WithErr(err)
 	}
 
-	return new(User).FromDBUser(user), nil
+	result := new(User).FromDBUser(user)
+	// The exact location is only shown to the user and to renters with an accepted booking
+	if !a.canSeeExactLocation(r.Context.Request.Context(), r.UserID, user.ID, "") {
+		a.hidePrivateUserData(result)
+	}
+	return result, nil
+}
+
+// publicProfileHandler handles GET /users/{id}/profile
+// It returns the public information of the user and the aggregated stats of its activity.
+// The community is omitted if the user hides it, except for the user itself.
+func (a *API) publicProfileHandler(r *Request) (interface{}, error) {
+	idParam := r.Context.URLParam("id")
+	if idParam == nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(fmt.Errorf("missing id"))
+	}
+	user, err := a.getDBUserByID(idParam[0])
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrUserNotFound.WithErr(fmt.Errorf("user %s is deleted", idParam[0]))
+	}
+
+	ctx := r.Context.Request.Context()
+	tools, err := a.database.ToolService.CountUserTools(ctx, user.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	stats, err := a.database.BookingService.GetUserBookingStats(ctx, user.ID)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	profile := &PublicProfile{
+		ID:          user.ID.Hex(),
+		Name:        user.Name,
+		AvatarHash:  user.AvatarHash,
+		Locality:    user.Locality,
+		Rating:      int(user.Rating),
+		Verified:    user.Verified,
+		TrustScore:  user.TrustScore,
+		MemberSince: user.ID.Timestamp(),
+		Stats: PublicProfileStats{
+			ToolsShared:       tools,
+			CompletedAsOwner:  stats.CompletedAsOwner,
+			CompletedAsRenter: stats.CompletedAsRenter,
+			OwnerRating:       stats.OwnerRating,
+			OwnerRatings:      stats.OwnerRatings,
+			RenterRating:      stats.RenterRating,
+			RenterRatings:     stats.RenterRatings,
+		},
+		Badges: []db.UserBadge{},
+	}
+	profile.Badges = append(profile.Badges, user.Badges...)
+	if !user.HideCommunity || user.ID.Hex() == r.UserID {
+		profile.Community = user.Community
+	}
+	return profile, nil
 }
 
 // validateObjectID checks if a string is a valid MongoDB ObjectID
@@ -178,11 +428,18 @@ func (a *API) userProfileUpdateHandler(r *Request) (interface{}, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to query user profile: %w", err)
 	}
+	if newUserInfo.Version == nil {
+		return nil, ErrVersionRequired
+	}
+	if *newUserInfo.Version != user.Version {
+		return nil, ErrVersionConflict.WithData(&VersionConflict{Version: user.Version})
+	}
 	if newUserInfo.Name != "" {
 		user.Name = newUserInfo.Name
 	}
-	if newUserInfo.Community != "" {
-		user.Community = newUserInfo.Community
+	if newUserInfo.Community != "" && newUserInfo.Community != user.Community {
+		return nil, ErrCommunityChangeNotAllowed.WithErr(
+			fmt.Errorf("user %s cannot change its community to %q", user.ID.Hex(), newUserInfo.Community))
 	}
 	var avatar *db.Image
 	if len(newUserInfo.Avatar) > 0 {
@@ -191,28 +448,55 @@ func (a *API) userProfileUpdateHandler(r *Request) (interface{}, error) {
 			return nil, fmt.Errorf("could not add image: %w", err)
 		}
 		user.AvatarHash = avatar.Hash
+		// The resized images of the previous avatar are no longer served
+		user.AvatarSizes = nil
+	}
+	location, locality, err := a.resolveLocation(r.Context.Request.Context(), newUserInfo.Location, newUserInfo.Address)
+	if err != nil {
+		return nil, err
 	}
-	if newUserInfo.Location != nil {
-		user.Location = newUserInfo.Location.ToDBLocation()
+	if location != nil {
+		user.Location = *location
+		user.Locality = locality
 	}
 	if newUserInfo.Active != nil {
 		user.Active = *newUserInfo.Active
 	}
 	if newUserInfo.Password != "" {
-		user.Password = hashPassword(newUserInfo.Password)
+		if err := a.checkPassword(newUserInfo.Password, user.Email, user.Name); err != nil {
+			return nil, err
+		}
+		if user.Password, err = a.hashPassword(newUserInfo.Password); err != nil {
+			return nil, ErrInternalServerError.WithErr(err)
+		}
+	}
+	if newUserInfo.HideCommunity != nil {
+		user.HideCommunity = *newUserInfo.HideCommunity
 	}
 	update := bson.M{
-		"name":       user.Name,
-		"avatarHash": user.AvatarHash,
-		"location":   user.Location,
-		"active":     user.Active,
-		"password":   user.Password,
-		"community":  user.Community,
+		"name":          user.Name,
+		"avatarHash":    user.AvatarHash,
+		"avatarSizes":   user.AvatarSizes,
+		"location":      user.Location,
+		"locality":      user.Locality,
+		"active":        user.Active,
+		"password":      user.Password,
+		"hideCommunity": user.HideCommunity,
+	}
+	err = a.database.UserService.UpdateUserVersion(context.Background(), user.ID, user.Version, update)
+	if err == db.ErrVersionConflict {
+		current, err := a.getDBUserByID(r.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrVersionConflict.WithData(&VersionConflict{Version: current.Version})
 	}
-	_, err = a.database.UserService.UpdateUser(context.Background(), user.ID, update)
 	if err != nil {
 		return nil, ErrCouldNotInsertToDatabase.WithErr(err)
 	}
+	if newUserInfo.Password != "" {
+		a.audit(r, &db.AuditEntry{Action: db.AuditPasswordChange, TargetType: "user", TargetID: user.ID.Hex()})
+	}
 	newUser, err := a.getUserByID(r.UserID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query user profile: %w", err)
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/emprius/emprius-app-backend/db"
+)
+
+const (
+	// APIVersion1 is the original API, also served without version prefix.
+	APIVersion1 = 1
+	// APIVersion2 serves the images as binary data, and the booking lists as objects with
+	// the pagination of the list.
+	APIVersion2 = 2
+	// LatestAPIVersion is the newest version of the API.
+	LatestAPIVersion = APIVersion2
+)
+
+// Version is the version of the server, set at build time with
+// -ldflags "-X github.com/emprius/emprius-app-backend/api.Version=<version>".
+var Version = "dev"
+
+// apiVersionKey is the request context key of the API version.
+type apiVersionKey struct{}
+
+// withAPIVersion returns a middleware that sets the API version of the requests, also
+// returned in the API-Version header.
+func withAPIVersion(version int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("API-Version", strconv.Itoa(version))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+		})
+	}
+}
+
+// requestAPIVersion returns the API version of the request, version 1 for the unversioned
+// routes.
+func requestAPIVersion(r *http.Request) int {
+	if version, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return version
+	}
+	return APIVersion1
+}
+
+// ResponseAdapter converts the response of a handler to the format of an API version.
+type ResponseAdapter func(r *Request, resp interface{}) (interface{}, error)
+
+// versioned returns a handler that runs the shared handler core and then converts its
+// response with the adapter of the request API version, if there is one. The versions
+// without an adapter return the response as is.
+func versioned(handler RouterHandlerFn, adapters map[int]ResponseAdapter) RouterHandlerFn {
+	return func(r *Request) (interface{}, error) {
+		resp, err := handler(r)
+		if err != nil {
+			return nil, err
+		}
+		adapter, ok := adapters[r.Version]
+		if !ok {
+			return resp, nil
+		}
+		return adapter(r, resp)
+	}
+}
+
+// binaryImageV2 replies the image with its content as body instead of JSON, keeping the
+// caching headers.
+func binaryImageV2(_ *Request, resp interface{}) (interface{}, error) {
+	cached, ok := resp.(*CachedResponse)
+	if !ok {
+		return nil, ErrInternalServerError.WithErr(fmt.Errorf("unexpected image response %T", resp))
+	}
+	image, ok := cached.Data.(*db.Image)
+	if !ok {
+		return nil, ErrInternalServerError.WithErr(fmt.Errorf("unexpected image data %T", cached.Data))
+	}
+	return &RawResponse{
+		ContentType:  http.DetectContentType(image.Content),
+		Data:         image.Content,
+		CacheControl: cached.CacheControl,
+		ETag:         cached.ETag,
+		LastModified: cached.LastModified,
+	}, nil
+}
+
+// bookingListV2 replies the bookings as an object instead of an array.
+func bookingListV2(_ *Request, resp interface{}) (interface{}, error) {
+	bookings, ok := resp.([]BookingResponse)
+	if !ok {
+		return nil, ErrInternalServerError.WithErr(fmt.Errorf("unexpected bookings response %T", resp))
+	}
+	return &BookingList{Bookings: bookings}, nil
+}
+
+// bookingPageV2 replies the page of bookings as an object with the page and its size.
+func bookingPageV2(r *Request, resp interface{}) (interface{}, error) {
+	bookings, ok := resp.([]BookingResponse)
+	if !ok {
+		return nil, ErrInternalServerError.WithErr(fmt.Errorf("unexpected bookings response %T", resp))
+	}
+	page, err := r.Context.GetPage()
+	if err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	return &BookingList{Bookings: bookings, Page: &page, PageSize: db.PageSize(0)}, nil
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emprius/emprius-app-backend/db"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestVersionedRoutes(t *testing.T) {
+	c := qt.New(t)
+	router := New("secret", "token", nil, nil).router()
+
+	for path, version := range map[string]string{"/ping": "", "/v1/ping": "1", "/v2/ping": "2"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		c.Assert(rec.Code, qt.Equals, http.StatusOK, qt.Commentf(path))
+		c.Assert(rec.Header().Get("API-Version"), qt.Equals, version, qt.Commentf(path))
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v3/ping", nil))
+	c.Assert(rec.Code, qt.Equals, http.StatusNotFound)
+}
+
+func TestVersioned(t *testing.T) {
+	c := qt.New(t)
+	bookings := []BookingResponse{{ID: "1"}, {ID: "2"}}
+	handler := versioned(func(*Request) (interface{}, error) {
+		return bookings, nil
+	}, map[int]ResponseAdapter{APIVersion2: bookingPageV2})
+
+	// Version 1 responses are not adapted
+	resp, err := handler(&Request{Version: APIVersion1})
+	c.Assert(err, qt.IsNil)
+	c.Assert(resp, qt.HasLen, 2)
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/bookings/user/1?page=2", nil)
+	resp, err = handler(&Request{Version: APIVersion2, Context: &HTTPContext{Request: req}})
+	c.Assert(err, qt.IsNil)
+	list := resp.(*BookingList)
+	c.Assert(list.Bookings, qt.HasLen, 2)
+	c.Assert(*list.Page, qt.Equals, 2)
+	c.Assert(list.PageSize, qt.Equals, db.PageSize(0))
+
+	// The images are returned as binary data with the same caching headers
+	image := &db.Image{Content: []byte("\x89PNG\r\n\x1a\n")}
+	raw, err := binaryImageV2(nil, &CachedResponse{Data: image, ETag: `"abc"`, CacheControl: imageCacheControl})
+	c.Assert(err, qt.IsNil)
+	c.Assert(raw, qt.DeepEquals, &RawResponse{
+		ContentType:  "image/png",
+		Data:         image.Content,
+		ETag:         `"abc"`,
+		CacheControl: imageCacheControl,
+	})
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// joinWaitlistHandler handles POST /tools/{id}/waitlist
+// It is a booking request for dates taken by an accepted booking. If that booking is cancelled,
+// the waiting requests are sent to the owner in the order they joined the waitlist.
+func (a *API) joinWaitlistHandler(r *Request) (interface{}, error) {
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	tool, err := a.toolFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if db.IsValidReportStatus(tool.Status) {
+		return nil, ErrToolReported.WithErr(fmt.Errorf("tool with id %d is %s", tool.ID, tool.Status))
+	}
+	if _, err := a.authorizeToolBooking(subject, tool); err != nil {
+		return nil, err
+	}
+	var req CreateBookingRequest
+	if err := json.Unmarshal(r.Data, &req); err != nil {
+		return nil, ErrInvalidRequestBodyData.WithErr(err)
+	}
+	start, end := time.Unix(req.StartDate, 0), time.Unix(req.EndDate, 0)
+	if !end.After(start) || !start.After(time.Now()) {
+		return nil, ErrInvalidBookingDates.WithErr(fmt.Errorf("dates must be in the future and end after the start"))
+	}
+	origin, err := parseBookingOrigin(req.Origin)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMaintenance(tool, start, end); err != nil {
+		return nil, err
+	}
+	if err := checkAvailability(tool, start, end); err != nil {
+		return nil, err
+	}
+	terms, err := acceptedTerms(tool, req.AcceptedTermsVersion)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context.Request.Context()
+	conflict, err := a.database.BookingService.HasDateConflicts(ctx, strconv.FormatInt(tool.ID, 10), start, end)
+	if err != nil {
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	if !conflict {
+		return nil, ErrDatesAvailable.WithErr(fmt.Errorf("no accepted booking of tool %d overlaps the dates", tool.ID))
+	}
+
+	entry := &db.WaitlistEntry{
+		ToolID:        tool.ID,
+		UserID:        subject.ID,
+		StartDate:     start,
+		EndDate:       end,
+		Contact:       req.Contact,
+		Comments:      req.Comments,
+		Origin:        origin,
+		AcceptedTerms: terms,
+	}
+	if err := a.database.WaitlistService.JoinWaitlist(ctx, entry); err != nil {
+		if err == db.ErrAlreadyWaitlisted {
+			return nil, ErrAlreadyWaitlisted.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return new(WaitlistEntry).FromDBWaitlistEntry(entry), nil
+}
+
+// leaveWaitlistHandler handles DELETE /tools/{id}/waitlist
+func (a *API) leaveWaitlistHandler(r *Request) (interface{}, error) {
+	subject, err := a.subject(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	tool, err := a.toolFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.database.WaitlistService.LeaveWaitlist(r.Context.Request.Context(), tool.ID, subject.ID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrWaitlistEntryNotFound.WithErr(err)
+		}
+		return nil, ErrInternalServerError.WithErr(err)
+	}
+	return nil, nil
+}
+
+// processWaitlist converts the waitlist entries overlapping the dates of a cancelled booking
+// into booking requests, in the order they joined the waitlist. The entries still conflicting
+// with another accepted booking or the tool maintenance keep waiting. The entries of users no
+// longer allowed to book the tool, or that accepted outdated usage terms, are dropped.
+func (a *API) processWaitlist(ctx context.Context, cancelled *db.Booking) {
+	toolID, err := strconv.ParseInt(cancelled.ToolID, 10, 64)
+	if err != nil {
+		return
+	}
+	tool, err := a.database.ToolService.GetToolByID(ctx, toolID)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Error().Err(err).Msgf("could not get tool %d to process its waitlist", toolID)
+		}
+		return
+	}
+	if db.IsValidReportStatus(tool.Status) {
+		return
+	}
+	entries, err := a.database.WaitlistService.GetToolWaitlist(ctx, toolID, cancelled.StartDate, cancelled.EndDate)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not get the waitlist of tool %d", toolID)
+		return
+	}
+	for _, entry := range entries {
+		subject, err := a.subject(entry.UserID.Hex())
+		if err == nil {
+			_, err = a.authorizeToolBooking(subject, tool)
+		}
+		if err == nil && tool.UsageTerms != "" &&
+			(entry.AcceptedTerms == nil || entry.AcceptedTerms.Version != tool.UsageTermsVersion) {
+			err = fmt.Errorf("usage terms changed")
+		}
+		if err != nil {
+			log.Info().Err(err).Msgf("dropping waitlist entry %s of tool %d", entry.ID.Hex(), toolID)
+			a.deleteWaitlistEntry(ctx, entry)
+			continue
+		}
+		if tool.Maintenance.Overlaps(entry.StartDate, entry.EndDate) {
+			continue
+		}
+		booking, err := a.database.BookingService.Create(ctx, &db.CreateBookingRequest{
+			ToolID:        cancelled.ToolID,
+			StartDate:     entry.StartDate,
+			EndDate:       entry.EndDate,
+			Contact:       entry.Contact,
+			Comments:      entry.Comments,
+			Origin:        entry.Origin,
+			Community:     tool.Community,
+			AcceptedTerms: entry.AcceptedTerms,
+		}, entry.UserID, tool.UserID)
+		if err == db.ErrBookingDatesConflict {
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Msgf("could not create the booking of waitlist entry %s", entry.ID.Hex())
+			continue
+		}
+		a.deleteWaitlistEntry(ctx, entry)
+		a.notify(ctx, &db.Notification{
+			UserID:    entry.UserID,
+			Type:      db.NotificationWaitlist,
+			Message:   fmt.Sprintf("The dates you were waiting for %s are available, your booking request was sent", tool.Title),
+			ToolID:    tool.ID,
+			BookingID: booking.ID,
+		})
+		a.notify(ctx, &db.Notification{
+			UserID:    tool.UserID,
+			Type:      db.NotificationBookingRequest,
+			Message:   fmt.Sprintf("New booking request for %s from the waitlist", tool.Title),
+			ToolID:    tool.ID,
+			BookingID: booking.ID,
+		})
+	}
+}
+
+// deleteWaitlistEntry removes a processed waitlist entry, logging any error.
+func (a *API) deleteWaitlistEntry(ctx context.Context, entry *db.WaitlistEntry) {
+	if err := a.database.WaitlistService.DeleteEntry(ctx, entry.ID); err != nil {
+		log.Error().Err(err).Msgf("could not delete waitlist entry %s", entry.ID.Hex())
+	}
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RecoveryStatus represents the state of an account recovery request
+type RecoveryStatus string
+
+const (
+	RecoveryStatusPending   RecoveryStatus = "PENDING"
+	RecoveryStatusApproved  RecoveryStatus = "APPROVED"
+	RecoveryStatusRejected  RecoveryStatus = "REJECTED"
+	RecoveryStatusCompleted RecoveryStatus = "COMPLETED"
+)
+
+// RecoveryEvent is an audit record of an account recovery request.
+type RecoveryEvent struct {
+	Action  string             `bson:"action" json:"action"`
+	ActorID primitive.ObjectID `bson:"actorId,omitempty" json:"actorId,omitempty"`
+	At      time.Time          `bson:"at" json:"at"`
+}
+
+// AccountRecovery represents the schema for the "account_recoveries" collection. A recovery
+// request re-binds an account to a new email once approved by the community admins.
+type AccountRecovery struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    primitive.ObjectID   `bson:"userId" json:"userId"`
+	Community string               `bson:"community,omitempty" json:"community,omitempty"`
+	OldEmail  string               `bson:"oldEmail" json:"oldEmail"`
+	NewEmail  string               `bson:"newEmail" json:"newEmail"`
+	Message   string               `bson:"message" json:"message"`
+	Status    RecoveryStatus       `bson:"status" json:"status"`
+	Approvals []primitive.ObjectID `bson:"approvals" json:"approvals"`
+	CodeHash  []byte               `bson:"codeHash,omitempty" json:"-"`
+	ExpiresAt time.Time            `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	History   []RecoveryEvent      `bson:"history" json:"history"`
+	CreatedAt time.Time            `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time            `bson:"updatedAt" json:"updatedAt"`
+}
+
+// AccountRecoveryService provides methods to interact with the "account_recoveries" collection.
+type AccountRecoveryService struct {
+	Collection *mongo.Collection
+}
+
+// NewAccountRecoveryService creates a new AccountRecoveryService.
+func NewAccountRecoveryService(db *Database) *AccountRecoveryService {
+	return &AccountRecoveryService{
+		Collection: db.Database.Collection("account_recoveries"),
+	}
+}
+
+// InsertRecovery inserts a new pending AccountRecovery document.
+func (s *AccountRecoveryService) InsertRecovery(
+	ctx context.Context,
+	recovery *AccountRecovery,
+) (*mongo.InsertOneResult, error) {
+	now := time.Now()
+	recovery.Status = RecoveryStatusPending
+	recovery.Approvals = []primitive.ObjectID{}
+	recovery.History = []RecoveryEvent{{Action: "requested", At: now}}
+	recovery.CreatedAt = now
+	recovery.UpdatedAt = now
+	result, err := s.Collection.InsertOne(ctx, recovery)
+	if err != nil {
+		return nil, err
+	}
+	recovery.ID = result.InsertedID.(primitive.ObjectID)
+	return result, nil
+}
+
+// GetRecovery retrieves an AccountRecovery by its ID.
+func (s *AccountRecoveryService) GetRecovery(ctx context.Context, id primitive.ObjectID) (*AccountRecovery, error) {
+	var recovery AccountRecovery
+	if err := s.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(&recovery); err != nil {
+		return nil, err
+	}
+	return &recovery, nil
+}
+
+// CountRecentRecoveries returns the number of recovery requests of the user created after since.
+func (s *AccountRecoveryService) CountRecentRecoveries(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	since time.Time,
+) (int64, error) {
+	return s.Collection.CountDocuments(ctx, bson.M{
+		"userId":    userID,
+		"createdAt": bson.M{"$gte": since},
+	})
+}
+
+// HasOpenRecovery returns true if the user has a pending or approved (not completed) recovery.
+func (s *AccountRecoveryService) HasOpenRecovery(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	count, err := s.Collection.CountDocuments(ctx, bson.M{
+		"userId": userID,
+		"status": bson.M{"$in": []RecoveryStatus{RecoveryStatusPending, RecoveryStatusApproved}},
+	})
+	return count > 0, err
+}
+
+// GetPendingRecoveries retrieves the pending recoveries, oldest first. If community is
+// not empty only the recoveries of that community are returned.
+func (s *AccountRecoveryService) GetPendingRecoveries(ctx context.Context, community string) ([]*AccountRecovery, error) {
+	filter := bson.M{"status": RecoveryStatusPending}
+	if community != "" {
+		filter["community"] = community
+	}
+	cursor, err := s.Collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	recoveries := []*AccountRecovery{}
+	if err := cursor.All(ctx, &recoveries); err != nil {
+		return nil, err
+	}
+	return recoveries, nil
+}
+
+// AddApproval records the approval of an admin on a pending recovery. Each admin can only
+// approve once. When the number of approvals reaches required, the recovery is approved and
+// the hash of the one time code to complete it is stored. It returns the updated recovery, or
+// mongo.ErrNoDocuments if the recovery is not pending or the admin already approved it.
+func (s *AccountRecoveryService) AddApproval(
+	ctx context.Context,
+	id, adminID primitive.ObjectID,
+	required int,
+	codeHash []byte,
+	codeExpiration time.Duration,
+) (*AccountRecovery, error) {
+	now := time.Now()
+	var recovery AccountRecovery
+	err := s.Collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": RecoveryStatusPending, "approvals": bson.M{"$ne": adminID}},
+		bson.M{
+			"$push": bson.M{
+				"approvals": adminID,
+				"history":   RecoveryEvent{Action: "approved", ActorID: adminID, At: now},
+			},
+			"$set": bson.M{"updatedAt": now},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&recovery)
+	if err != nil {
+		return nil, err
+	}
+	if len(recovery.Approvals) < required {
+		return &recovery, nil
+	}
+
+	expiresAt := now.Add(codeExpiration)
+	result, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": RecoveryStatusPending},
+		bson.M{"$set": bson.M{
+			"status":    RecoveryStatusApproved,
+			"codeHash":  codeHash,
+			"expiresAt": expiresAt,
+		}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.ModifiedCount > 0 {
+		recovery.Status = RecoveryStatusApproved
+		recovery.CodeHash = codeHash
+		recovery.ExpiresAt = expiresAt
+	}
+	return &recovery, nil
+}
+
+// RejectRecovery rejects a pending recovery. It returns mongo.ErrNoDocuments if the recovery
+// is not pending.
+func (s *AccountRecoveryService) RejectRecovery(ctx context.Context, id, adminID primitive.ObjectID) error {
+	return s.transition(ctx, id, RecoveryStatusPending, RecoveryStatusRejected,
+		RecoveryEvent{Action: "rejected", ActorID: adminID, At: time.Now()}, bson.M{})
+}
+
+// CompleteRecovery marks an approved recovery as completed if the code hash matches and the
+// code has not expired. It returns mongo.ErrNoDocuments otherwise.
+func (s *AccountRecoveryService) CompleteRecovery(ctx context.Context, id primitive.ObjectID, codeHash []byte) error {
+	now := time.Now()
+	return s.transition(ctx, id, RecoveryStatusApproved, RecoveryStatusCompleted,
+		RecoveryEvent{Action: "completed", At: now},
+		bson.M{"codeHash": codeHash, "expiresAt": bson.M{"$gt": now}})
+}
+
+// DeleteUserRecoveries deletes the recovery requests of a user, which include its email addresses.
+func (s *AccountRecoveryService) DeleteUserRecoveries(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
+
+// transition moves a recovery from one status to another, recording the event.
+func (s *AccountRecoveryService) transition(
+	ctx context.Context,
+	id primitive.ObjectID,
+	from, to RecoveryStatus,
+	event RecoveryEvent,
+	extraFilter bson.M,
+) error {
+	filter := bson.M{"_id": id, "status": from}
+	for k, v := range extraFilter {
+		filter[k] = v
+	}
+	result, err := s.Collection.UpdateOne(ctx, filter, bson.M{
+		"$set":   bson.M{"status": to, "updatedAt": event.At},
+		"$push":  bson.M{"history": event},
+		"$unset": bson.M{"codeHash": ""},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
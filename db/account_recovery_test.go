@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestAccountRecoveryService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	database := client.Database(dbName)
+
+	// Initialize AccountRecoveryService
+	recoveryService := NewAccountRecoveryService(&Database{
+		Client:   client,
+		Database: database,
+	})
+
+	userID := primitive.NewObjectID()
+	adminA := primitive.NewObjectID()
+	adminB := primitive.NewObjectID()
+	code := []byte("code-hash")
+
+	recovery := &AccountRecovery{
+		UserID:    userID,
+		Community: "valley",
+		OldEmail:  "old@example.com",
+		NewEmail:  "new@example.com",
+		Message:   "I lost access to my mailbox",
+	}
+
+	c.Run("Insert And Rate Limit Counters", func(c *qt.C) {
+		_, err := recoveryService.InsertRecovery(ctx, recovery)
+		c.Assert(err, qt.IsNil)
+		c.Assert(recovery.Status, qt.Equals, RecoveryStatusPending)
+
+		count, err := recoveryService.CountRecentRecoveries(ctx, userID, time.Now().Add(-time.Hour))
+		c.Assert(err, qt.IsNil)
+		c.Assert(count, qt.Equals, int64(1))
+		open, err := recoveryService.HasOpenRecovery(ctx, userID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(open, qt.IsTrue)
+
+		pending, err := recoveryService.GetPendingRecoveries(ctx, "valley")
+		c.Assert(err, qt.IsNil)
+		c.Assert(pending, qt.HasLen, 1)
+		pending, err = recoveryService.GetPendingRecoveries(ctx, "coast")
+		c.Assert(err, qt.IsNil)
+		c.Assert(pending, qt.HasLen, 0)
+	})
+
+	c.Run("Two Distinct Approvals", func(c *qt.C) {
+		updated, err := recoveryService.AddApproval(ctx, recovery.ID, adminA, 2, code, time.Hour)
+		c.Assert(err, qt.IsNil)
+		c.Assert(updated.Status, qt.Equals, RecoveryStatusPending)
+
+		// The same admin cannot approve twice
+		_, err = recoveryService.AddApproval(ctx, recovery.ID, adminA, 2, code, time.Hour)
+		c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+
+		updated, err = recoveryService.AddApproval(ctx, recovery.ID, adminB, 2, code, time.Hour)
+		c.Assert(err, qt.IsNil)
+		c.Assert(updated.Status, qt.Equals, RecoveryStatusApproved)
+		c.Assert(updated.Approvals, qt.DeepEquals, []primitive.ObjectID{adminA, adminB})
+
+		// Approved recoveries can no longer be rejected
+		c.Assert(recoveryService.RejectRecovery(ctx, recovery.ID, adminA), qt.Equals, mongo.ErrNoDocuments)
+	})
+
+	c.Run("Complete", func(c *qt.C) {
+		c.Assert(recoveryService.CompleteRecovery(ctx, recovery.ID, []byte("wrong")), qt.Equals, mongo.ErrNoDocuments)
+		c.Assert(recoveryService.CompleteRecovery(ctx, recovery.ID, code), qt.IsNil)
+		// The code can only be used once
+		c.Assert(recoveryService.CompleteRecovery(ctx, recovery.ID, code), qt.Equals, mongo.ErrNoDocuments)
+
+		stored, err := recoveryService.GetRecovery(ctx, recovery.ID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(stored.Status, qt.Equals, RecoveryStatusCompleted)
+		c.Assert(stored.History, qt.HasLen, 4)
+		open, err := recoveryService.HasOpenRecovery(ctx, userID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(open, qt.IsFalse)
+	})
+
+	c.Run("Reject", func(c *qt.C) {
+		rejected := &AccountRecovery{UserID: userID, OldEmail: "old@example.com", NewEmail: "other@example.com"}
+		_, err := recoveryService.InsertRecovery(ctx, rejected)
+		c.Assert(err, qt.IsNil)
+		c.Assert(recoveryService.RejectRecovery(ctx, rejected.ID, adminA), qt.IsNil)
+		_, err = recoveryService.AddApproval(ctx, rejected.ID, adminB, 2, code, time.Hour)
+		c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+	})
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditAction identifies a sensitive action recorded in the audit log.
+type AuditAction string
+
+const (
+	AuditLogin            AuditAction = "auth.login"
+	AuditLoginFailed      AuditAction = "auth.login_failed"
+	AuditSessionClose     AuditAction = "auth.session_close"
+	AuditLoginLocked      AuditAction = "auth.login_locked"
+	AuditPasswordChange   AuditAction = "user.password_change"
+	AuditRoleChange       AuditAction = "user.role_change"
+	AuditCommunityChange  AuditAction = "user.community_change"
+	AuditUserBlock        AuditAction = "user.block"
+	AuditAccountDelete    AuditAction = "user.delete"
+	AuditAccountAnonymize AuditAction = "user.anonymize"
+	AuditAccountRecovered AuditAction = "user.recovered"
+	AuditToolDelete       AuditAction = "tool.delete"
+	AuditRecoveryApprove  AuditAction = "admin.recovery_approve"
+	AuditRecoveryReject   AuditAction = "admin.recovery_reject"
+	AuditTestMail         AuditAction = "admin.test_mail"
+	AuditLogExport        AuditAction = "admin.audit_export"
+	AuditTermsPublish     AuditAction = "admin.terms_publish"
+)
+
+// AuditEntry represents the schema for the "audit_log" collection. The entries are never
+// updated, and only deleted once older than the retention of the instance.
+type AuditEntry struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	// ActorID is the user performing the action, empty if unknown (i.e. a failed login).
+	ActorID primitive.ObjectID `bson:"actorId,omitempty" json:"actorId,omitempty"`
+	Action  AuditAction        `bson:"action" json:"action"`
+	// TargetType and TargetID identify the object of the action, i.e. "user" and its ID.
+	TargetType string    `bson:"targetType,omitempty" json:"targetType,omitempty"`
+	TargetID   string    `bson:"targetId,omitempty" json:"targetId,omitempty"`
+	IP         string    `bson:"ip,omitempty" json:"ip,omitempty"`
+	Details    string    `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// AuditQuery filters the audit log entries. The empty fields match every entry.
+type AuditQuery struct {
+	ActorID  primitive.ObjectID
+	Action   AuditAction
+	TargetID string
+	From     time.Time
+	To       time.Time
+	Page     int
+	PageSize int
+}
+
+// filter returns the MongoDB filter of the query.
+func (q *AuditQuery) filter() bson.M {
+	filter := bson.M{}
+	if !q.ActorID.IsZero() {
+		filter["actorId"] = q.ActorID
+	}
+	if q.Action != "" {
+		filter["action"] = q.Action
+	}
+	if q.TargetID != "" {
+		filter["targetId"] = q.TargetID
+	}
+	createdAt := bson.M{}
+	if !q.From.IsZero() {
+		createdAt["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		createdAt["$lt"] = q.To
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+	return filter
+}
+
+// AuditLogService provides methods to interact with the "audit_log" collection.
+type AuditLogService struct {
+	Collection *mongo.Collection
+}
+
+// NewAuditLogService creates a new AuditLogService.
+func NewAuditLogService(db *Database) *AuditLogService {
+	return &AuditLogService{
+		Collection: db.Database.Collection("audit_log"),
+	}
+}
+
+// Record appends an entry to the audit log.
+func (s *AuditLogService) Record(ctx context.Context, entry *AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	result, err := s.Collection.InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// Query returns a page of the entries matching the query, the newest first, and the total
+// number of matching entries.
+func (s *AuditLogService) Query(ctx context.Context, q AuditQuery) ([]*AuditEntry, int64, error) {
+	if q.Page < 0 {
+		q.Page = 0
+	}
+	q.PageSize = PageSize(q.PageSize)
+	filter := q.filter()
+	total, err := s.Collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(q.Page * q.PageSize)).
+		SetLimit(int64(q.PageSize))
+	entries, err := s.find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// Export calls fn with every entry matching the query, ignoring its pagination, the oldest
+// first. It stops at the first error of fn.
+func (s *AuditLogService) Export(ctx context.Context, q AuditQuery, fn func(*AuditEntry) error) error {
+	cursor, err := s.Collection.Find(ctx, q.filter(),
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+	for cursor.Next(ctx) {
+		var entry AuditEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// DeleteBefore deletes the entries older than the given time, and returns how many.
+func (s *AuditLogService) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.Collection.DeleteMany(ctx, bson.M{"createdAt": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// find returns the entries matching the filter.
+func (s *AuditLogService) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]*AuditEntry, error) {
+	cursor, err := s.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+	entries := []*AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
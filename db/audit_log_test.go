@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestAuditLogService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	service := NewAuditLogService(database)
+
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	admin, user := primitive.NewObjectID(), primitive.NewObjectID()
+	for i, entry := range []*AuditEntry{
+		{ActorID: user, Action: AuditLogin, TargetID: user.Hex(), IP: "10.0.0.1"},
+		{Action: AuditLoginFailed, Details: "unknown@example.com"},
+		{ActorID: admin, Action: AuditRoleChange, TargetType: "user", TargetID: user.Hex()},
+	} {
+		entry.CreatedAt = now.Add(time.Duration(i) * time.Hour)
+		c.Assert(service.Record(ctx, entry), qt.IsNil)
+		c.Assert(entry.ID.IsZero(), qt.IsFalse)
+	}
+
+	// The newest entries first
+	entries, total, err := service.Query(ctx, AuditQuery{TargetID: user.Hex()})
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(2))
+	c.Assert(entries[0].Action, qt.Equals, AuditRoleChange)
+	c.Assert(entries[1].Action, qt.Equals, AuditLogin)
+
+	entries, total, err = service.Query(ctx, AuditQuery{From: now.Add(30 * time.Minute), To: now.Add(90 * time.Minute)})
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(1))
+	c.Assert(entries[0].Action, qt.Equals, AuditLoginFailed)
+
+	entries, _, err = service.Query(ctx, AuditQuery{ActorID: admin, Action: AuditRoleChange})
+	c.Assert(err, qt.IsNil)
+	c.Assert(entries, qt.HasLen, 1)
+
+	// The export ignores the pagination, the oldest entries first
+	var exported []AuditAction
+	c.Assert(service.Export(ctx, AuditQuery{PageSize: 1}, func(entry *AuditEntry) error {
+		exported = append(exported, entry.Action)
+		return nil
+	}), qt.IsNil)
+	c.Assert(exported, qt.DeepEquals, []AuditAction{AuditLogin, AuditLoginFailed, AuditRoleChange})
+
+	deleted, err := service.DeleteBefore(ctx, now.Add(time.Hour))
+	c.Assert(err, qt.IsNil)
+	c.Assert(deleted, qt.Equals, int64(1))
+	_, total, err = service.Query(ctx, AuditQuery{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(2))
+}
@@ -0,0 +1,345 @@
+package db
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// BackupVersion is the version of the backup format. Backups of other versions can not
+	// be restored.
+	BackupVersion = 1
+	// backupManifestName is the name of the manifest entry, the last one of the archive.
+	backupManifestName = "manifest.json"
+	// backupChunkSize is the size (in bytes) after which the documents of a collection are
+	// split in a new archive entry, so the backup is streamed without keeping the collections
+	// in memory.
+	backupChunkSize = 8 << 20
+	// maxBackupLine is the maximum size (in bytes) of a document in extended JSON, larger than
+	// the maximum BSON document size as binary data is base64 encoded.
+	maxBackupLine = 32 << 20
+	// restoreBatchSize is the maximum number of documents inserted at once.
+	restoreBatchSize = 500
+)
+
+// backupImagesCollections are the collections only included in the backups if requested, as
+// they have the content of all the images and media.
+var backupImagesCollections = []string{"images", "media"}
+
+// backupSkippedCollections are the collections never included in the backups, as their
+// documents can be recreated.
+var backupSkippedCollections = []string{"geocode_cache"}
+
+// BackupManifest describes the content of a backup.
+type BackupManifest struct {
+	Version     int              `json:"version"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	Database    string           `json:"database"`
+	Images      bool             `json:"images"`
+	Snapshot    bool             `json:"snapshot"`
+	Collections map[string]int64 `json:"collections"`
+}
+
+// Backup streams a tar.gz export of all the collections (images and media only if requested)
+// to w.
+// Each collection is exported as MongoDB extended JSON, one document per line, in entries
+// named collection/NNNNNN.jsonl. The manifest is the last entry. If the database is a replica
+// set all the collections are read from the same snapshot.
+func (db *Database) Backup(ctx context.Context, w io.Writer, images bool) (*BackupManifest, error) {
+	names, err := db.Database.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+
+	manifest := &BackupManifest{
+		Version:     BackupVersion,
+		CreatedAt:   time.Now(),
+		Database:    db.Database.Name(),
+		Images:      images,
+		Collections: make(map[string]int64),
+	}
+	if manifest.Snapshot, err = db.supportsSnapshots(ctx); err != nil {
+		return nil, err
+	}
+	if manifest.Snapshot {
+		session, err := db.Client.StartSession(options.Session().SetSnapshot(true))
+		if err != nil {
+			return nil, err
+		}
+		defer session.EndSession(ctx)
+		ctx = mongo.NewSessionContext(ctx, session)
+	} else {
+		log.Warn().Msg("the database is not a replica set, the backup is not a point in time snapshot")
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	for _, name := range names {
+		if strings.HasPrefix(name, "system.") || slices.Contains(backupSkippedCollections, name) ||
+			(slices.Contains(backupImagesCollections, name) && !images) {
+			continue
+		}
+		count, err := backupCollection(ctx, archive, db.Database.Collection(name), manifest.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not back up %s: %w", name, err)
+		}
+		manifest.Collections[name] = count
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBackupEntry(archive, backupManifestName, data, manifest.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
+
+// WriteBackup writes the backup to the file at path. The file is only replaced once the
+// backup is complete.
+func (db *Database) WriteBackup(ctx context.Context, path string, images bool) (*BackupManifest, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.Remove(file.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn().Err(err).Msgf("could not remove %s", file.Name())
+		}
+	}()
+	manifest, err := db.Backup(ctx, file, images)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, os.Rename(file.Name(), path)
+}
+
+// ReadBackup reads the whole backup, checking that it can be restored: its version must be
+// BackupVersion and every document must be valid and be counted in the manifest.
+func ReadBackup(r io.Reader) (*BackupManifest, error) {
+	counts := make(map[string]int64)
+	manifest, err := readBackup(r, func(collection string, docs []bson.D) error {
+		counts[collection] += int64(len(docs))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, count := range counts {
+		if _, ok := manifest.Collections[name]; !ok {
+			return nil, fmt.Errorf("backup has documents of %s, missing in its manifest", name)
+		}
+		if manifest.Collections[name] != count {
+			return nil, fmt.Errorf("backup has %d documents of %s, expected %d", count, name, manifest.Collections[name])
+		}
+	}
+	for name, count := range manifest.Collections {
+		if counts[name] != count {
+			return nil, fmt.Errorf("backup has %d documents of %s, expected %d", counts[name], name, count)
+		}
+	}
+	return manifest, nil
+}
+
+// RestoreBackup restores the backup in the file at path, replacing the collections it has.
+// The backup is fully read and checked with ReadBackup before anything is replaced. The
+// collections not in the backup (i.e. the images if they were not included) are kept. The
+// API must not be running during the restore.
+func (db *Database) RestoreBackup(ctx context.Context, path string) (*BackupManifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := ReadBackup(file)
+	_ = file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup: %w", err)
+	}
+
+	for name := range manifest.Collections {
+		if err := db.Database.Collection(name).Drop(ctx); err != nil {
+			return nil, fmt.Errorf("could not drop %s: %w", name, err)
+		}
+	}
+	if file, err = os.Open(path); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warn().Err(err).Msgf("could not close %s", path)
+		}
+	}()
+	if _, err := readBackup(file, func(collection string, docs []bson.D) error {
+		for start := 0; start < len(docs); start += restoreBatchSize {
+			batch := docs[start:min(start+restoreBatchSize, len(docs))]
+			insert := make([]interface{}, len(batch))
+			for i, doc := range batch {
+				insert[i] = doc
+			}
+			if _, err := db.Database.Collection(collection).InsertMany(ctx, insert); err != nil {
+				return fmt.Errorf("could not restore %s: %w", collection, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return manifest, EnsureIndexes(ctx, db)
+}
+
+// supportsSnapshots returns true if the database can read all the collections from the same
+// snapshot, which requires a replica set or a sharded cluster.
+func (db *Database) supportsSnapshots(ctx context.Context) (bool, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := db.Client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, err
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid", nil
+}
+
+// backupCollection writes the documents of the collection to the archive, and returns how
+// many were written.
+func backupCollection(ctx context.Context, archive *tar.Writer, collection *mongo.Collection, modTime time.Time) (int64, error) {
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var count int64
+	var chunk bytes.Buffer
+	chunks := 0
+	flush := func() error {
+		if chunk.Len() == 0 {
+			return nil
+		}
+		chunks++
+		name := fmt.Sprintf("%s/%06d.jsonl", collection.Name(), chunks)
+		if err := writeBackupEntry(archive, name, chunk.Bytes(), modTime); err != nil {
+			return err
+		}
+		chunk.Reset()
+		return nil
+	}
+	for cursor.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			return 0, err
+		}
+		chunk.Write(line)
+		chunk.WriteByte('\n')
+		count++
+		if chunk.Len() >= backupChunkSize {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+	return count, flush()
+}
+
+// writeBackupEntry writes a file entry to the archive.
+func writeBackupEntry(archive *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := archive.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := archive.Write(data)
+	return err
+}
+
+// readBackup reads the backup archive, calling restore with the documents of each entry, and
+// returns its manifest. The version of the backup is checked when the manifest is read.
+func readBackup(r io.Reader, restore func(collection string, docs []bson.D) error) (*BackupManifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	archive := tar.NewReader(gz)
+	var manifest *BackupManifest
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if manifest != nil {
+			return nil, fmt.Errorf("unexpected entry %s after the manifest", header.Name)
+		}
+		if header.Name == backupManifestName {
+			manifest = &BackupManifest{}
+			if err := json.NewDecoder(archive).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			if manifest.Version != BackupVersion {
+				return nil, fmt.Errorf("unsupported backup version %d, expected %d", manifest.Version, BackupVersion)
+			}
+			continue
+		}
+		collection, _, ok := strings.Cut(header.Name, "/")
+		if !ok || collection == "" {
+			return nil, fmt.Errorf("unexpected entry %s", header.Name)
+		}
+		docs := []bson.D{}
+		scanner := bufio.NewScanner(archive)
+		scanner.Buffer(nil, maxBackupLine)
+		for scanner.Scan() {
+			var doc bson.D
+			if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc); err != nil {
+				return nil, fmt.Errorf("invalid document in %s: %w", header.Name, err)
+			}
+			docs = append(docs, doc)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", header.Name, err)
+		}
+		if err := restore(collection, docs); err != nil {
+			return nil, err
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("missing %s", backupManifestName)
+	}
+	return manifest, nil
+}
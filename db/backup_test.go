@@ -0,0 +1,143 @@
+package db
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/types"
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testBackup returns a backup archive with the given entries, in order.
+func testBackup(c *qt.C, entries ...[2]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for _, entry := range entries {
+		c.Assert(writeBackupEntry(archive, entry[0], []byte(entry[1]), time.Now()), qt.IsNil)
+	}
+	c.Assert(archive.Close(), qt.IsNil)
+	c.Assert(gz.Close(), qt.IsNil)
+	return buf.Bytes()
+}
+
+func TestReadBackup(t *testing.T) {
+	c := qt.New(t)
+
+	doc := `{"_id":{"$numberLong":"1"},"name":"Car"}` + "\n"
+	manifest, err := ReadBackup(bytes.NewReader(testBackup(c,
+		[2]string{"transports/000001.jsonl", doc},
+		[2]string{backupManifestName, `{"version":1,"collections":{"transports":1,"users":0}}`},
+	)))
+	c.Assert(err, qt.IsNil)
+	c.Assert(manifest.Collections, qt.DeepEquals, map[string]int64{"transports": 1, "users": 0})
+
+	_, err = ReadBackup(bytes.NewReader(testBackup(c,
+		[2]string{backupManifestName, `{"version":2,"collections":{}}`},
+	)))
+	c.Assert(err, qt.ErrorMatches, "unsupported backup version 2, expected 1")
+
+	_, err = ReadBackup(bytes.NewReader(testBackup(c,
+		[2]string{"transports/000001.jsonl", doc},
+		[2]string{backupManifestName, `{"version":1,"collections":{"transports":2}}`},
+	)))
+	c.Assert(err, qt.ErrorMatches, "backup has 1 documents of transports, expected 2")
+
+	_, err = ReadBackup(bytes.NewReader(testBackup(c,
+		[2]string{"transports/000001.jsonl", "not json\n"},
+		[2]string{backupManifestName, `{"version":1,"collections":{"transports":1}}`},
+	)))
+	c.Assert(err, qt.ErrorMatches, "invalid document in transports/000001.jsonl: .*")
+
+	_, err = ReadBackup(bytes.NewReader(testBackup(c, [2]string{"transports/000001.jsonl", doc})))
+	c.Assert(err, qt.ErrorMatches, "missing manifest.json")
+}
+
+func TestBackupRestore(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	c.Assert(EnsureIndexes(ctx, database), qt.IsNil)
+	userID := primitive.NewObjectID()
+	_, err = database.Database.Collection("users").InsertOne(ctx, bson.M{
+		"_id": userID, "email": "backup@example.com", "name": "backup", "createdAt": time.Now().UTC().Truncate(time.Millisecond),
+	})
+	c.Assert(err, qt.IsNil)
+	_, err = NewImageService(database).InsertImage(ctx, &Image{Hash: types.HexBytes{1, 2}, Name: "photo", Content: []byte{0, 1, 2}})
+	c.Assert(err, qt.IsNil)
+	_, err = database.Database.Collection("geocode_cache").InsertOne(ctx, bson.M{"query": "somewhere"})
+	c.Assert(err, qt.IsNil)
+
+	// The images are only included if requested, the cache never
+	path := filepath.Join(c.TempDir(), "backup.tar.gz")
+	manifest, err := database.WriteBackup(ctx, path, false)
+	c.Assert(err, qt.IsNil)
+	c.Assert(manifest.Version, qt.Equals, BackupVersion)
+	c.Assert(manifest.Collections["users"], qt.Equals, int64(1))
+	c.Assert(manifest.Collections, qt.Not(qt.Contains), "images")
+	c.Assert(manifest.Collections, qt.Not(qt.Contains), "geocode_cache")
+
+	withImages := filepath.Join(c.TempDir(), "images.tar.gz")
+	manifest, err = database.WriteBackup(ctx, withImages, true)
+	c.Assert(err, qt.IsNil)
+	c.Assert(manifest.Collections["images"], qt.Equals, int64(1))
+	file, err := os.Open(withImages)
+	c.Assert(err, qt.IsNil)
+	read, err := ReadBackup(file)
+	c.Assert(err, qt.IsNil)
+	c.Assert(file.Close(), qt.IsNil)
+	c.Assert(read.Collections, qt.DeepEquals, manifest.Collections)
+
+	// Restoring replaces the collections in the backup and keeps the others
+	_, err = database.Database.Collection("users").InsertOne(ctx, bson.M{"email": "new@example.com", "name": "new"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(database.Database.Collection("images").Drop(ctx), qt.IsNil)
+	_, err = database.RestoreBackup(ctx, withImages)
+	c.Assert(err, qt.IsNil)
+	users, err := database.Database.Collection("users").CountDocuments(ctx, bson.M{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(users, qt.Equals, int64(1))
+	image, err := NewImageService(database).GetImage(ctx, types.HexBytes{1, 2})
+	c.Assert(err, qt.IsNil)
+	c.Assert(image.Content, qt.DeepEquals, []byte{0, 1, 2})
+
+	_, err = database.RestoreBackup(ctx, path)
+	c.Assert(err, qt.IsNil)
+	var user bson.M
+	c.Assert(database.Database.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user), qt.IsNil)
+	c.Assert(user["email"], qt.Equals, "backup@example.com")
+	missing, err := MissingIndexes(ctx, database)
+	c.Assert(err, qt.IsNil)
+	c.Assert(missing, qt.HasLen, 0)
+	images, err := database.Database.Collection("images").CountDocuments(ctx, bson.M{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(images, qt.Equals, int64(1))
+}
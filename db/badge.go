@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Badge is an achievement shown on the public profile of a user.
+type Badge string
+
+const (
+	// BadgeFirstTool is awarded for sharing a first tool.
+	BadgeFirstTool Badge = "FIRST_TOOL"
+	// BadgeTenLoans is awarded for lending tools in 10 returned bookings.
+	BadgeTenLoans Badge = "TEN_LOANS"
+	// BadgeCommunityFounder is awarded to the first member of a community.
+	BadgeCommunityFounder Badge = "COMMUNITY_FOUNDER"
+	// BadgeNomadicTraveler is awarded for borrowing tools in 3 different localities.
+	BadgeNomadicTraveler Badge = "NOMADIC_TRAVELER"
+)
+
+// UserBadge is a badge awarded to a user. Once awarded, a badge is kept.
+type UserBadge struct {
+	Badge     Badge     `bson:"badge" json:"badge"`
+	AwardedAt time.Time `bson:"awardedAt" json:"awardedAt"`
+}
+
+// GetUsersForBadgeUpdate returns up to limit users, excluding the deleted users, whose badges
+// were never computed or were computed before the given time, the oldest first.
+func (s *UserService) GetUsersForBadgeUpdate(ctx context.Context, before time.Time, limit int) ([]*User, error) {
+	filter := bson.M{
+		"deletedAt": bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"badgesUpdatedAt": bson.M{"$exists": false}},
+			{"badgesUpdatedAt": bson.M{"$lt": before}},
+		},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "badgesUpdatedAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := s.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var users []*User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SetBadges stores the badges of the user.
+func (s *UserService) SetBadges(ctx context.Context, id primitive.ObjectID, badges []UserBadge, now time.Time) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"badges": badges, "badgesUpdatedAt": now},
+	})
+	return err
+}
+
+// GetCommunityFounder returns the first registered member of the community who was not
+// deleted, or the nil ObjectID if the community has no member.
+func (s *UserService) GetCommunityFounder(ctx context.Context, community string) (primitive.ObjectID, error) {
+	var founder struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err := s.Collection.FindOne(ctx,
+		bson.M{"community": community, "deletedAt": bson.M{"$exists": false}},
+		options.FindOne().SetSort(bson.D{{Key: "_id", Value: 1}}).SetProjection(bson.M{"_id": 1}),
+	).Decode(&founder)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, nil
+	}
+	return founder.ID, err
+}
+
+// CountBorrowedLocalities returns the number of different localities of the tools the user
+// borrowed in returned bookings. The deleted tools and those without locality are not counted.
+func (s *BookingService) CountBorrowedLocalities(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	// The tool IDs of the bookings are strings
+	toolID := bson.M{"$convert": bson.M{"input": "$toolId", "to": "long", "onError": nil, "onNull": nil}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"fromUserId": userID, "bookingStatus": BookingStatusReturned}}},
+	}
+	pipeline = append(pipeline, summaryLookup("tools", "tool", toolID, bson.M{"_id": 0, "locality": 1})...)
+	pipeline = append(pipeline,
+		bson.D{{Key: "$match", Value: bson.M{"tool.locality": bson.M{"$nin": bson.A{nil, ""}}}}},
+		bson.D{{Key: "$group", Value: bson.M{"_id": "$tool.locality"}}},
+		bson.D{{Key: "$count", Value: "count"}},
+	)
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var results []struct {
+		Count int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return results[0].Count, nil
+}
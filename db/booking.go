@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -21,23 +22,198 @@ const (
 	BookingStatusRejected  BookingStatus = "REJECTED"
 	BookingStatusCancelled BookingStatus = "CANCELLED"
 	BookingStatusReturned  BookingStatus = "RETURNED"
+	BookingStatusExpired   BookingStatus = "EXPIRED"
 )
 
+// IsValidBookingStatus returns true if the status is one of the booking statuses.
+func IsValidBookingStatus(status BookingStatus) bool {
+	switch status {
+	case BookingStatusPending, BookingStatusAccepted, BookingStatusRejected, BookingStatusCancelled,
+		BookingStatusReturned, BookingStatusExpired:
+		return true
+	}
+	return false
+}
+
+// BookingOrigin is the surface of the app the booking was created from, used to learn
+// which discovery paths produce loans.
+type BookingOrigin string
+
+const (
+	BookingOriginSearch        BookingOrigin = "SEARCH"
+	BookingOriginCommunityPage BookingOrigin = "COMMUNITY_PAGE"
+	BookingOriginShareLink     BookingOrigin = "SHARE_LINK"
+	BookingOriginNeedMatch     BookingOrigin = "NEED_MATCH"
+	// BookingOriginLibrary is set on the check-outs of the community libraries, it cannot be
+	// given by the clients.
+	BookingOriginLibrary BookingOrigin = "LIBRARY"
+)
+
+// IsValidBookingOrigin returns true if the origin is one of the known booking origins.
+func IsValidBookingOrigin(origin BookingOrigin) bool {
+	switch origin {
+	case BookingOriginSearch, BookingOriginCommunityPage, BookingOriginShareLink, BookingOriginNeedMatch:
+		return true
+	}
+	return false
+}
+
+// BookingReminder identifies a reminder sent to the parties of a booking.
+type BookingReminder string
+
+const (
+	// BookingReminderPickup is sent the day before the booking starts.
+	BookingReminderPickup BookingReminder = "PICKUP"
+	// BookingReminderReturn is sent on the booking end date.
+	BookingReminderReturn BookingReminder = "RETURN"
+	// BookingReminderRating is sent two days after the tool is returned.
+	BookingReminderRating BookingReminder = "RATING"
+)
+
+// DisagreementStatus represents the state of a return condition disagreement
+type DisagreementStatus string
+
+const (
+	DisagreementStatusOpen      DisagreementStatus = "OPEN"
+	DisagreementStatusResolved  DisagreementStatus = "RESOLVED"
+	DisagreementStatusEscalated DisagreementStatus = "ESCALATED"
+)
+
+// BookingDisagreement is opened by a party when it disagrees with the condition the tool
+// was returned in. If it is not resolved before the deadline it is escalated to a dispute.
+type BookingDisagreement struct {
+	Status      DisagreementStatus `bson:"status" json:"status"`
+	OpenedBy    primitive.ObjectID `bson:"openedBy" json:"openedBy"`
+	Description string             `bson:"description" json:"description"`
+	Images      []Image            `bson:"images,omitempty" json:"images,omitempty"`
+	OpenedAt    time.Time          `bson:"openedAt" json:"openedAt"`
+	Deadline    time.Time          `bson:"deadline" json:"deadline"`
+	ResolvedAt  *time.Time         `bson:"resolvedAt,omitempty" json:"resolvedAt,omitempty"`
+	EscalatedAt *time.Time         `bson:"escalatedAt,omitempty" json:"escalatedAt,omitempty"`
+}
+
+// BookingTransition is a status change of a booking. By is nil for the transitions made
+// by the system, such as expirations.
+type BookingTransition struct {
+	From BookingStatus      `bson:"from,omitempty" json:"from,omitempty"`
+	To   BookingStatus      `bson:"to" json:"to"`
+	By   primitive.ObjectID `bson:"by,omitempty" json:"by,omitempty"`
+	At   time.Time          `bson:"at" json:"at"`
+	Note string             `bson:"note,omitempty" json:"note,omitempty"`
+}
+
 // Booking represents a tool booking in the system
 type Booking struct {
-	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	ToolID        string             `bson:"toolId" json:"toolId"`
-	FromUserID    primitive.ObjectID `bson:"fromUserId" json:"fromUserId"`
-	ToUserID      primitive.ObjectID `bson:"toUserId" json:"toUserId"`
-	StartDate     time.Time          `bson:"startDate" json:"startDate"`
-	EndDate       time.Time          `bson:"endDate" json:"endDate"`
-	Contact       string             `bson:"contact" json:"contact"`
-	Comments      string             `bson:"comments" json:"comments"`
-	BookingStatus BookingStatus      `bson:"bookingStatus" json:"bookingStatus"`
-	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt     time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ID            primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	ToolID        string               `bson:"toolId" json:"toolId"`
+	FromUserID    primitive.ObjectID   `bson:"fromUserId" json:"fromUserId"`
+	ToUserID      primitive.ObjectID   `bson:"toUserId" json:"toUserId"`
+	StartDate     time.Time            `bson:"startDate" json:"startDate"`
+	EndDate       time.Time            `bson:"endDate" json:"endDate"`
+	Contact       string               `bson:"contact" json:"contact"`
+	Comments      string               `bson:"comments" json:"comments"`
+	BookingStatus BookingStatus        `bson:"bookingStatus" json:"bookingStatus"`
+	CreatedAt     time.Time            `bson:"createdAt" json:"createdAt"`
+	UpdatedAt     time.Time            `bson:"updatedAt" json:"updatedAt"`
+	ToolReported  bool                 `bson:"toolReported,omitempty" json:"toolReported,omitempty"`
+	Disagreement  *BookingDisagreement `bson:"disagreement,omitempty" json:"disagreement,omitempty"`
+	Origin        BookingOrigin        `bson:"origin,omitempty" json:"origin,omitempty"`
+	Community     string               `bson:"community,omitempty" json:"community,omitempty"`
+	ReturnedAt    *time.Time           `bson:"returnedAt,omitempty" json:"returnedAt,omitempty"`
+	// RespondedAt is the time the owner accepted or rejected the request.
+	RespondedAt   *time.Time        `bson:"respondedAt,omitempty" json:"respondedAt,omitempty"`
+	RemindersSent []BookingReminder `bson:"remindersSent,omitempty" json:"-"`
+	// OwnerRating is the rating given by the renter to the owner, and RenterRating the
+	// rating given by the owner to the renter.
+	OwnerRating  *int `bson:"ownerRating,omitempty" json:"ownerRating,omitempty"`
+	RenterRating *int `bson:"renterRating,omitempty" json:"renterRating,omitempty"`
+	// History are the status transitions of the booking, the oldest first.
+	History []BookingTransition `bson:"history,omitempty" json:"history,omitempty"`
+	// AcceptedTerms are the usage terms of the tool accepted by the renter, if it had any.
+	AcceptedTerms *AcceptedTerms `bson:"acceptedTerms,omitempty" json:"acceptedTerms,omitempty"`
+	// PricingMode is the pricing mode of the tool when the booking was requested, and Price
+	// the tokens the booking costs. For pay what you want tools the price is the amount
+	// proposed by the renter, accepted by the owner with the booking.
+	PricingMode PricingMode `bson:"pricingMode,omitempty" json:"pricingMode,omitempty"`
+	Price       *uint64     `bson:"price,omitempty" json:"price,omitempty"`
+	// CancellationPolicy is the cancellation policy of the tool when the booking was requested,
+	// and CancellationPenalty the tokens paid by the renter to the owner for cancelling it late.
+	CancellationPolicy  CancellationPolicy `bson:"cancellationPolicy,omitempty" json:"cancellationPolicy,omitempty"`
+	CancellationPenalty uint64             `bson:"cancellationPenalty,omitempty" json:"cancellationPenalty,omitempty"`
+	// CommunityFee is the fee paid by the renter to the token pool of the community of the owner
+	// when the booking was returned.
+	CommunityFee uint64 `bson:"communityFee,omitempty" json:"communityFee,omitempty"`
+	// Tool, FromUser and ToUser are the summaries of the tool and the parties of the booking,
+	// only set on the booking lists. They are looked up, never stored.
+	Tool     *BookingTool `bson:"tool,omitempty" json:"-"`
+	FromUser *BookingUser `bson:"fromUser,omitempty" json:"-"`
+	ToUser   *BookingUser `bson:"toUser,omitempty" json:"-"`
+	// CommentRefs are the tools, bookings and users referenced by the comments.
+	CommentRefs []EntityRef `bson:"commentRefs,omitempty" json:"commentRefs,omitempty"`
+	// Payment is the payment in money of the price of the accepted booking, if the payments
+	// are enabled.
+	Payment *BookingPayment `bson:"payment,omitempty" json:"payment,omitempty"`
+	// ArchivedBy are the parties that archived the ended booking, hidden from their lists.
+	ArchivedBy []primitive.ObjectID `bson:"archivedBy,omitempty" json:"-"`
+}
+
+// Ended returns true if the booking is in a final status: rejected, cancelled, returned or
+// expired.
+func (b *Booking) Ended() bool {
+	return slices.Contains(endedBookingStatuses, b.BookingStatus)
+}
+
+// ArchivedByUser returns true if the user archived the booking.
+func (b *Booking) ArchivedByUser(userID primitive.ObjectID) bool {
+	return slices.Contains(b.ArchivedBy, userID)
+}
+
+// endedBookingStatuses are the final statuses of the bookings, the only ones that can be
+// archived.
+var endedBookingStatuses = []BookingStatus{
+	BookingStatusRejected,
+	BookingStatusCancelled,
+	BookingStatusReturned,
+	BookingStatusExpired,
+}
+
+// BookingPayment is the payment of the price of a booking in money, through a payment
+// provider. The provider and status are those of the payment package.
+type BookingPayment struct {
+	Provider string `bson:"provider" json:"provider"`
+	ID       string `bson:"id" json:"id"`
+	Status   string `bson:"status" json:"status"`
+	// Amount is in the minor unit of the currency (i.e. cents).
+	Amount   int64  `bson:"amount" json:"amount"`
+	Currency string `bson:"currency" json:"currency"`
+	// URL is the page the renter pays at, empty if the payment is collected by hand.
+	URL       string     `bson:"url,omitempty" json:"url,omitempty"`
+	CreatedAt time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time  `bson:"updatedAt" json:"updatedAt"`
+	PaidAt    *time.Time `bson:"paidAt,omitempty" json:"paidAt,omitempty"`
+}
+
+// AcceptedTerms are the usage terms of a tool accepted by a renter, copied so both parties
+// can refer to them even if the owner changes them later.
+type AcceptedTerms struct {
+	Text       string    `bson:"text" json:"text"`
+	Version    int       `bson:"version" json:"version"`
+	AcceptedAt time.Time `bson:"acceptedAt" json:"acceptedAt"`
 }
 
+const (
+	// reservationTTL is the time after which a tool reservation not released can be taken over.
+	reservationTTL = 30 * time.Second
+	// reservationWait is the maximum time to wait for the reservation of a tool.
+	reservationWait = 2 * time.Second
+	// reservationRetry is the time between two attempts to take the reservation of a tool.
+	reservationRetry = 20 * time.Millisecond
+	// paymentPending and paymentPaid are the statuses of the pending and paid payments, the
+	// pending payments cannot be replaced and the paid ones cannot be changed.
+	paymentPending = "pending"
+	paymentPaid    = "paid"
+)
+
 // BookingService handles all booking related database operations
 type BookingService struct {
 	collection *mongo.Collection
@@ -48,34 +224,6 @@ type BookingService struct {
 func NewBookingService(db *mongo.Database) *BookingService {
 	collection := db.Collection("bookings")
 
-	// Create indexes
-	indexes := []mongo.IndexModel{
-		{
-			Keys: bson.D{
-				{Key: "toolId", Value: 1},
-				{Key: "startDate", Value: 1},
-				{Key: "endDate", Value: 1},
-			},
-		},
-		{
-			Keys: bson.D{
-				{Key: "fromUserId", Value: 1},
-				{Key: "createdAt", Value: -1}, // For efficient sorting by date
-			},
-		},
-		{
-			Keys: bson.D{
-				{Key: "toUserId", Value: 1},
-				{Key: "createdAt", Value: -1}, // For efficient sorting by date
-			},
-		},
-	}
-
-	_, err := collection.Indexes().CreateMany(context.Background(), indexes)
-	if err != nil {
-		panic(err)
-	}
-
 	return &BookingService{
 		collection: collection,
 		database:   db,
@@ -89,6 +237,19 @@ type CreateBookingRequest struct {
 	EndDate   time.Time `bson:"endDate" json:"endDate"`
 	Contact   string    `bson:"contact" json:"contact"`
 	Comments  string    `bson:"comments" json:"comments"`
+	// CommentRefs are the references of the comments, see Booking.
+	CommentRefs []EntityRef `bson:"commentRefs,omitempty" json:"-"`
+	// Origin is optional, bookings without origin are attributed as unknown
+	Origin BookingOrigin `bson:"origin,omitempty" json:"origin,omitempty"`
+	// Community is the community owning the tool, if it is a shared community tool.
+	Community string `bson:"community,omitempty" json:"-"`
+	// AcceptedTerms are the usage terms of the tool accepted by the renter.
+	AcceptedTerms *AcceptedTerms `bson:"acceptedTerms,omitempty" json:"-"`
+	// PricingMode and Price are the pricing of the booking, see Booking.
+	PricingMode PricingMode `bson:"pricingMode,omitempty" json:"-"`
+	Price       *uint64     `bson:"price,omitempty" json:"-"`
+	// CancellationPolicy is the cancellation policy of the tool.
+	CancellationPolicy CancellationPolicy `bson:"cancellationPolicy,omitempty" json:"-"`
 }
 
 // Create creates a new booking
@@ -101,16 +262,28 @@ func (s *BookingService) Create(
 	now := time.Now()
 
 	booking := &Booking{
-		ToolID:        req.ToolID,
-		FromUserID:    fromUserID,
-		ToUserID:      toUserID,
-		StartDate:     req.StartDate,
-		EndDate:       req.EndDate,
-		Contact:       req.Contact,
-		Comments:      req.Comments,
-		BookingStatus: BookingStatusPending,
-		CreatedAt:     now,
-		UpdatedAt:     now,
+		ToolID:             req.ToolID,
+		FromUserID:         fromUserID,
+		ToUserID:           toUserID,
+		StartDate:          req.StartDate,
+		EndDate:            req.EndDate,
+		Contact:            req.Contact,
+		Comments:           req.Comments,
+		CommentRefs:        req.CommentRefs,
+		BookingStatus:      BookingStatusPending,
+		Origin:             req.Origin,
+		Community:          req.Community,
+		AcceptedTerms:      req.AcceptedTerms,
+		PricingMode:        req.PricingMode,
+		Price:              req.Price,
+		CancellationPolicy: req.CancellationPolicy,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+		History: []BookingTransition{{
+			To: BookingStatusPending,
+			By: fromUserID,
+			At: now,
+		}},
 	}
 
 	// Check for date conflicts
@@ -141,27 +314,503 @@ func (s *BookingService) Get(ctx context.Context, id primitive.ObjectID) (*Booki
 	return &booking, err
 }
 
-// GetUserBookings gets paginated bookings for a user (both requests and petitions)
-func (s *BookingService) GetUserBookings(ctx context.Context, userID primitive.ObjectID, page int) ([]*Booking, error) {
+// GetUserBookings gets paginated bookings for a user (both requests and petitions), with
+// the summaries of their tool and users. If fields are given, only those document fields are
+// retrieved.
+func (s *BookingService) GetUserBookings(ctx context.Context, userID primitive.ObjectID, page int,
+	fields ...string,
+) ([]*Booking, error) {
 	if page < 0 {
 		page = 0
 	}
 
-	skip := page * defaultPageSize
-
 	// Find bookings where user is either the requester or owner
-	cursor, err := s.collection.Find(ctx,
+	return s.findBookings(ctx,
 		bson.M{
 			"$or": []bson.M{
 				{"fromUserId": userID},
 				{"toUserId": userID},
 			},
 		},
-		options.Find().
-			SetSort(bson.D{{Key: "createdAt", Value: -1}}). // Sort by date, newest first
-			SetSkip(int64(skip)).
-			SetLimit(int64(defaultPageSize)),
+		nil, int64(page*DefaultPageSize), DefaultPageSize, fields,
 	)
+}
+
+// BookingSort is the date the booking lists are sorted by.
+type BookingSort string
+
+const (
+	BookingSortCreatedAt BookingSort = "createdAt"
+	BookingSortStartDate BookingSort = "startDate"
+)
+
+// BookingListOptions filter and sort the booking requests and petitions of a user. The zero
+// value lists the bookings not archived by the user, newest first.
+type BookingListOptions struct {
+	// IncludeArchived also lists the bookings archived by the user.
+	IncludeArchived bool
+	// Statuses, if set, are the accepted statuses of the bookings.
+	Statuses []BookingStatus
+	// ToolID, if set, is the tool of the bookings.
+	ToolID string
+	// Counterpart, if set, is the other party of the bookings: the renter of the requests or
+	// the owner of the petitions.
+	Counterpart primitive.ObjectID
+	// From and To, if set, select the bookings overlapping the dates.
+	From time.Time
+	To   time.Time
+	// SortBy is the date the bookings are sorted by, the creation date if empty, in ascending
+	// order if Ascending.
+	SortBy    BookingSort
+	Ascending bool
+}
+
+// filter adds the options to the filter of the bookings of the user, the counterpart being
+// matched on the given field. Without options all the bookings are listed.
+func (opts *BookingListOptions) filter(filter bson.M, userID primitive.ObjectID, counterpartField string) bson.M {
+	if opts == nil {
+		return filter
+	}
+	if !opts.IncludeArchived {
+		filter["archivedBy"] = bson.M{"$ne": userID}
+	}
+	if len(opts.Statuses) > 0 {
+		filter["bookingStatus"] = bson.M{"$in": opts.Statuses}
+	}
+	if opts.ToolID != "" {
+		filter["toolId"] = opts.ToolID
+	}
+	if !opts.Counterpart.IsZero() {
+		filter[counterpartField] = opts.Counterpart
+	}
+	if !opts.From.IsZero() {
+		filter["endDate"] = bson.M{"$gt": opts.From}
+	}
+	if !opts.To.IsZero() {
+		filter["startDate"] = bson.M{"$lt": opts.To}
+	}
+	return filter
+}
+
+// sort returns the sort of the bookings, nil for the default one.
+func (opts *BookingListOptions) sort() bson.D {
+	if opts == nil || (opts.SortBy == "" && !opts.Ascending) {
+		return nil
+	}
+	field := opts.SortBy
+	if field == "" {
+		field = BookingSortCreatedAt
+	}
+	order := -1
+	if opts.Ascending {
+		order = 1
+	}
+	return bson.D{{Key: string(field), Value: order}, {Key: "_id", Value: order}}
+}
+
+// GetUserRequests gets the booking requests for tools owned by the user matching the options,
+// with the summaries of their tool and users. If fields are given, only those document fields
+// are retrieved.
+func (s *BookingService) GetUserRequests(ctx context.Context, userID primitive.ObjectID, opts *BookingListOptions,
+	fields ...string,
+) ([]*Booking, error) {
+	return s.findBookings(ctx, opts.filter(bson.M{"toUserId": userID}, userID, "fromUserId"), opts.sort(), 0, 0, fields)
+}
+
+// GetManagerRequests gets the bookings received by the user and the bookings of the given
+// tools, managed by the user, matching the options, with the summaries of their tool and
+// users. If fields are given, only those document fields are retrieved.
+func (s *BookingService) GetManagerRequests(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	toolIDs []string,
+	opts *BookingListOptions,
+	fields ...string,
+) ([]*Booking, error) {
+	filter := opts.filter(bson.M{"$or": []bson.M{
+		{"toUserId": userID},
+		{"toolId": bson.M{"$in": toolIDs}},
+	}}, userID, "fromUserId")
+	return s.findBookings(ctx, filter, opts.sort(), 0, 0, fields)
+}
+
+// GetUserPetitions gets the bookings made by the user matching the options, with the
+// summaries of their tool and users. If fields are given, only those document fields are
+// retrieved.
+func (s *BookingService) GetUserPetitions(ctx context.Context, userID primitive.ObjectID, opts *BookingListOptions,
+	fields ...string,
+) ([]*Booking, error) {
+	return s.findBookings(ctx, opts.filter(bson.M{"fromUserId": userID}, userID, "toUserId"), opts.sort(), 0, 0, fields)
+}
+
+// SetArchived archives the ended booking for the user, or unarchives it. Archiving a booking
+// that did not end returns ErrBookingStatusChanged.
+func (s *BookingService) SetArchived(ctx context.Context, id, userID primitive.ObjectID, archived bool) error {
+	filter := bson.M{"_id": id}
+	update := bson.M{"$pull": bson.M{"archivedBy": userID}}
+	if archived {
+		filter["bookingStatus"] = bson.M{"$in": endedBookingStatuses}
+		update = bson.M{"$addToSet": bson.M{"archivedBy": userID}}
+	}
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrBookingStatusChanged
+	}
+	return nil
+}
+
+// ArchiveUserBookings archives for the user the ended bookings it made or received that ended
+// before the given time, and returns the number of bookings archived.
+func (s *BookingService) ArchiveUserBookings(ctx context.Context, userID primitive.ObjectID, before time.Time) (int64, error) {
+	result, err := s.collection.UpdateMany(ctx, bson.M{
+		"$or":           []bson.M{{"fromUserId": userID}, {"toUserId": userID}},
+		"bookingStatus": bson.M{"$in": endedBookingStatuses},
+		"endDate":       bson.M{"$lt": before},
+		"archivedBy":    bson.M{"$ne": userID},
+	}, bson.M{"$addToSet": bson.M{"archivedBy": userID}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// GetCommunityBookings gets the paginated bookings of the tools owned by the community,
+// newest first, with the summaries of their tool and users.
+func (s *BookingService) GetCommunityBookings(ctx context.Context, community string, page int) ([]*Booking, error) {
+	if page < 0 {
+		page = 0
+	}
+	return s.findBookings(ctx, bson.M{"community": community}, nil, int64(page*DefaultPageSize), DefaultPageSize, nil)
+}
+
+// UpdateStatus updates the booking status, records the transition made by the given user
+// with an optional note, and handles any related updates. The status is only updated if it did
+// not change since the booking was read, otherwise ErrBookingStatusChanged is returned. Only
+// pending bookings can be accepted. The accepts of a tool are serialized, and fail with
+// ErrBookingDatesConflict if another booking of the tool was accepted for overlapping dates.
+func (s *BookingService) UpdateStatus(
+	ctx context.Context,
+	id primitive.ObjectID,
+	status BookingStatus,
+	by primitive.ObjectID,
+	note string,
+) error {
+	booking, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if booking == nil {
+		return ErrBookingNotFound
+	}
+	if status != BookingStatusAccepted {
+		return s.updateStatus(ctx, booking, status, by, note)
+	}
+	if booking.BookingStatus != BookingStatusPending {
+		return ErrBookingStatusChanged
+	}
+
+	release, err := s.reserveTool(ctx, booking)
+	if err != nil {
+		return err
+	}
+	defer release()
+	conflict, err := s.checkDateConflicts(ctx, booking.ToolID, booking.StartDate, booking.EndDate, booking.ID)
+	if err != nil {
+		return err
+	}
+	if conflict {
+		return ErrBookingDatesConflict
+	}
+	if err := s.updateStatus(ctx, booking, status, by, note); err != nil {
+		return err
+	}
+
+	// Add reserved dates to tool
+	update := touchTool(bson.M{
+		"$push": bson.M{
+			"reservedDates": bson.M{
+				"from": booking.StartDate,
+				"to":   booking.EndDate,
+			},
+		},
+	})
+	if _, err := s.database.Collection("tools").UpdateOne(ctx, bson.M{"_id": booking.ToolID}, update); err != nil {
+		return fmt.Errorf("could not update tool reserved dates: %w", err)
+	}
+	return nil
+}
+
+// updateStatus sets the status of the booking if it is still the one read.
+func (s *BookingService) updateStatus(
+	ctx context.Context,
+	booking *Booking,
+	status BookingStatus,
+	by primitive.ObjectID,
+	note string,
+) error {
+	now := time.Now()
+	set := bson.M{
+		"bookingStatus": status,
+		"updatedAt":     now,
+	}
+	switch status {
+	case BookingStatusReturned:
+		set["returnedAt"] = now
+	case BookingStatusAccepted, BookingStatusRejected:
+		set["respondedAt"] = now
+	}
+	update := bson.M{
+		"$set": set,
+		"$push": bson.M{"history": BookingTransition{
+			From: booking.BookingStatus,
+			To:   status,
+			By:   by,
+			At:   now,
+			Note: note,
+		}},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": booking.ID, "bookingStatus": booking.BookingStatus}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrBookingStatusChanged
+	}
+	return nil
+}
+
+// reserveTool takes the reservation document of the tool of the booking, so its bookings are
+// accepted one at a time, and returns the function releasing it. The reservation is created
+// with findAndModify, which fails with a duplicate key while another accept holds it. It is
+// retried for up to reservationWait, then ErrToolReservationBusy is returned. A reservation
+// not released (i.e. on a crash) is taken over once expired.
+func (s *BookingService) reserveTool(ctx context.Context, booking *Booking) (func(), error) {
+	reservations := s.database.Collection("tool_reservations")
+	deadline := time.Now().Add(reservationWait)
+	for {
+		now := time.Now()
+		err := reservations.FindOneAndUpdate(ctx,
+			bson.M{"_id": booking.ToolID, "expiresAt": bson.M{"$lt": now}},
+			bson.M{"$set": bson.M{"bookingId": booking.ID, "expiresAt": now.Add(reservationTTL)}},
+			options.FindOneAndUpdate().SetUpsert(true),
+		).Err()
+		if err == nil || err == mongo.ErrNoDocuments {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		if now.After(deadline) {
+			return nil, ErrToolReservationBusy
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(reservationRetry):
+		}
+	}
+	return func() {
+		// The request context may be done, the reservation must be released anyway
+		if _, err := reservations.DeleteOne(context.Background(),
+			bson.M{"_id": booking.ToolID, "bookingId": booking.ID}); err != nil {
+			log.Error().Err(err).Msgf("could not release the reservation of tool %s", booking.ToolID)
+		}
+	}, nil
+}
+
+// SetCancellationPenalty records the tokens paid by the renter for the late cancellation of
+// the booking.
+func (s *BookingService) SetCancellationPenalty(ctx context.Context, id primitive.ObjectID, penalty uint64) error {
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"cancellationPenalty": penalty}})
+	return err
+}
+
+// SetCommunityFee records the fee paid by the renter to the token pool of a community for the
+// returned booking.
+func (s *BookingService) SetCommunityFee(ctx context.Context, id primitive.ObjectID, fee uint64) error {
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"communityFee": fee}})
+	return err
+}
+
+// SetPayment stores a new payment of the accepted booking, replacing the previous one unless
+// it is pending or paid. It returns ErrPaymentConflict otherwise.
+func (s *BookingService) SetPayment(ctx context.Context, id primitive.ObjectID, payment *BookingPayment) error {
+	filter := bson.M{
+		"_id":            id,
+		"bookingStatus":  BookingStatusAccepted,
+		"payment.status": bson.M{"$nin": []string{paymentPending, paymentPaid}},
+	}
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"payment": payment, "updatedAt": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrPaymentConflict
+	}
+	return nil
+}
+
+// UpdatePaymentStatus sets the status of the payment of the provider with the given id, and
+// returns its booking. The paid payments are not changed anymore. It returns
+// ErrBookingNotFound if there is no such payment, or ErrPaymentConflict if it is already paid.
+func (s *BookingService) UpdatePaymentStatus(ctx context.Context, provider, paymentID, status string) (*Booking, error) {
+	return s.updatePaymentStatus(ctx, bson.M{"payment.provider": provider, "payment.id": paymentID}, status)
+}
+
+// MarkPaymentPaid sets the payment of the booking as paid, i.e. collected by hand by the owner.
+// It returns ErrBookingNotFound if the booking has no payment, or ErrPaymentConflict if it is
+// already paid.
+func (s *BookingService) MarkPaymentPaid(ctx context.Context, id primitive.ObjectID) (*Booking, error) {
+	return s.updatePaymentStatus(ctx, bson.M{"_id": id, "payment": bson.M{"$exists": true}}, paymentPaid)
+}
+
+// updatePaymentStatus sets the status of the payment of the booking matching the filter,
+// unless it is paid, and returns the updated booking.
+func (s *BookingService) updatePaymentStatus(ctx context.Context, filter bson.M, status string) (*Booking, error) {
+	now := time.Now()
+	set := bson.M{"payment.status": status, "payment.updatedAt": now, "updatedAt": now}
+	if status == paymentPaid {
+		set["payment.paidAt"] = now
+	}
+	filter["payment.status"] = bson.M{"$ne": paymentPaid}
+	var booking Booking
+	err := s.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&booking)
+	if err == mongo.ErrNoDocuments {
+		delete(filter, "payment.status")
+		count, err := s.collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrPaymentConflict
+		}
+		return nil, ErrBookingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// UpdateToolID moves the bookings of a tool to its new ID (the tool ID changes with its
+// owner), so its booking history is kept.
+func (s *BookingService) UpdateToolID(ctx context.Context, oldID, newID string) error {
+	_, err := s.collection.UpdateMany(ctx, bson.M{"toolId": oldID}, bson.M{"$set": bson.M{"toolId": newID}})
+	return err
+}
+
+// HasOpenBookings returns true if the tool has pending or accepted bookings.
+func (s *BookingService) HasOpenBookings(ctx context.Context, toolID string) (bool, error) {
+	count, err := s.collection.CountDocuments(ctx, bson.M{
+		"toolId":        toolID,
+		"bookingStatus": bson.M{"$in": []BookingStatus{BookingStatusPending, BookingStatusAccepted}},
+	}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// HasReturnedBooking returns true if the user rented or lent a tool in a returned booking.
+func (s *BookingService) HasReturnedBooking(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	count, err := s.collection.CountDocuments(ctx, bson.M{
+		"$or":           bson.A{bson.M{"fromUserId": userID}, bson.M{"toUserId": userID}},
+		"bookingStatus": BookingStatusReturned,
+	}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// GetUsersWithReturnedBookings returns which of the users rented or lent a tool in a returned
+// booking.
+func (s *BookingService) GetUsersWithReturnedBookings(
+	ctx context.Context,
+	userIDs []primitive.ObjectID,
+) (map[primitive.ObjectID]bool, error) {
+	users := make(map[primitive.ObjectID]bool)
+	for _, field := range []string{"fromUserId", "toUserId"} {
+		values, err := s.collection.Distinct(ctx, field, bson.M{
+			field:           bson.M{"$in": userIDs},
+			"bookingStatus": BookingStatusReturned,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			if id, ok := value.(primitive.ObjectID); ok {
+				users[id] = true
+			}
+		}
+	}
+	return users, nil
+}
+
+// HasBookingBetween returns true if any of the two users ever requested a booking from the
+// other, whatever its status.
+func (s *BookingService) HasBookingBetween(ctx context.Context, a, b primitive.ObjectID) (bool, error) {
+	count, err := s.collection.CountDocuments(ctx, bson.M{"$or": bson.A{
+		bson.M{"fromUserId": a, "toUserId": b},
+		bson.M{"fromUserId": b, "toUserId": a},
+	}}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// FlagToolBookings marks the ongoing (pending or accepted) bookings of a tool as affected
+// by a tool report, so both parties can see the tool has been reported lost or stolen.
+// Returns the number of flagged bookings.
+func (s *BookingService) FlagToolBookings(ctx context.Context, toolID string) (int64, error) {
+	filter := bson.M{
+		"toolId": toolID,
+		"bookingStatus": bson.M{"$in": []BookingStatus{
+			BookingStatusPending,
+			BookingStatusAccepted,
+		}},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"toolReported": true,
+			"updatedAt":    time.Now(),
+		},
+	}
+	result, err := s.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// UnflagToolBookings clears the tool report flag of the bookings of a tool once it is
+// recovered. Returns the number of unflagged bookings.
+func (s *BookingService) UnflagToolBookings(ctx context.Context, toolID string) (int64, error) {
+	filter := bson.M{
+		"toolId":       toolID,
+		"toolReported": true,
+	}
+	update := bson.M{
+		"$unset": bson.M{"toolReported": ""},
+		"$set":   bson.M{"updatedAt": time.Now()},
+	}
+	result, err := s.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// CancelUserOpenBookings cancels the pending and accepted bookings where the user is either
+// the requester or the tool owner, returning the cancelled bookings.
+func (s *BookingService) CancelUserOpenBookings(ctx context.Context, userID primitive.ObjectID) ([]*Booking, error) {
+	filter := bson.M{
+		"$or": []bson.M{
+			{"fromUserId": userID},
+			{"toUserId": userID},
+		},
+		"bookingStatus": bson.M{"$in": []BookingStatus{BookingStatusPending, BookingStatusAccepted}},
+	}
+	cursor, err := s.collection.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -170,19 +819,112 @@ func (s *BookingService) GetUserBookings(ctx context.Context, userID primitive.O
 			log.Error().Err(err).Msg("Error closing cursor")
 		}
 	}()
-
-	var bookings []*Booking
-	if err = cursor.All(ctx, &bookings); err != nil {
+	bookings := []*Booking{}
+	if err := cursor.All(ctx, &bookings); err != nil {
 		return nil, err
 	}
-	return bookings, nil
+
+	cancelled := []*Booking{}
+	for _, booking := range bookings {
+		// Only cancel the bookings that were not updated meanwhile
+		now := time.Now()
+		result, err := s.collection.UpdateOne(ctx,
+			bson.M{"_id": booking.ID, "bookingStatus": booking.BookingStatus},
+			bson.M{
+				"$set": bson.M{"bookingStatus": BookingStatusCancelled, "updatedAt": now},
+				"$push": bson.M{"history": BookingTransition{
+					From: booking.BookingStatus,
+					To:   BookingStatusCancelled,
+					By:   userID,
+					At:   now,
+					Note: "account deleted",
+				}},
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if result.ModifiedCount > 0 {
+			booking.BookingStatus = BookingStatusCancelled
+			cancelled = append(cancelled, booking)
+		}
+	}
+	return cancelled, nil
+}
+
+// AnonymizeUserBookings removes the contact details and comments written by the user
+// on its booking requests.
+func (s *BookingService) AnonymizeUserBookings(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.collection.UpdateMany(ctx,
+		bson.M{"fromUserId": userID},
+		bson.M{"$set": bson.M{"contact": "", "comments": ""}, "$unset": bson.M{"commentRefs": ""}},
+	)
+	return err
 }
 
-// GetUserRequests gets all booking requests for tools owned by the user
-func (s *BookingService) GetUserRequests(ctx context.Context, userID primitive.ObjectID) ([]*Booking, error) {
-	cursor, err := s.collection.Find(ctx, bson.M{
-		"toUserId": userID,
-	}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+// OpenDisagreement opens a return condition disagreement on a returned booking. It returns
+// ErrDisagreementConflict if the booking is not returned or already has a disagreement.
+func (s *BookingService) OpenDisagreement(
+	ctx context.Context,
+	id primitive.ObjectID,
+	disagreement *BookingDisagreement,
+) error {
+	disagreement.Status = DisagreementStatusOpen
+	filter := bson.M{
+		"_id":           id,
+		"bookingStatus": BookingStatusReturned,
+		"disagreement":  bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"disagreement": disagreement,
+			"updatedAt":    time.Now(),
+		},
+	}
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDisagreementConflict
+	}
+	return nil
+}
+
+// ResolveDisagreement marks the open disagreement of a booking as resolved by the party that
+// opened it. It returns ErrDisagreementConflict if there is no open disagreement opened by it.
+func (s *BookingService) ResolveDisagreement(ctx context.Context, id, by primitive.ObjectID) error {
+	now := time.Now()
+	filter := bson.M{
+		"_id":                   id,
+		"disagreement.status":   DisagreementStatusOpen,
+		"disagreement.openedBy": by,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"disagreement.status":     DisagreementStatusResolved,
+			"disagreement.resolvedAt": now,
+			"updatedAt":               now,
+		},
+	}
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDisagreementConflict
+	}
+	return nil
+}
+
+// EscalateOverdueDisagreements escalates to a dispute the open disagreements whose deadline
+// is before now, and returns the escalated bookings.
+func (s *BookingService) EscalateOverdueDisagreements(ctx context.Context, now time.Time) ([]*Booking, error) {
+	filter := bson.M{
+		"disagreement.status":   DisagreementStatusOpen,
+		"disagreement.deadline": bson.M{"$lt": now},
+	}
+	cursor, err := s.collection.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -192,18 +934,50 @@ func (s *BookingService) GetUserRequests(ctx context.Context, userID primitive.O
 		}
 	}()
 
-	var bookings []*Booking
-	if err = cursor.All(ctx, &bookings); err != nil {
+	var overdue []*Booking
+	if err := cursor.All(ctx, &overdue); err != nil {
 		return nil, err
 	}
-	return bookings, nil
+
+	escalated := []*Booking{}
+	for _, booking := range overdue {
+		// Only escalate if the disagreement is still open, it might have been resolved meanwhile
+		result, err := s.collection.UpdateOne(ctx,
+			bson.M{"_id": booking.ID, "disagreement.status": DisagreementStatusOpen},
+			bson.M{"$set": bson.M{
+				"disagreement.status":      DisagreementStatusEscalated,
+				"disagreement.escalatedAt": now,
+				"updatedAt":                now,
+			}},
+		)
+		if err != nil {
+			return escalated, err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		booking.Disagreement.Status = DisagreementStatusEscalated
+		booking.Disagreement.EscalatedAt = &now
+		escalated = append(escalated, booking)
+	}
+	return escalated, nil
 }
 
-// GetUserPetitions gets all bookings made by the user
-func (s *BookingService) GetUserPetitions(ctx context.Context, userID primitive.ObjectID) ([]*Booking, error) {
-	cursor, err := s.collection.Find(ctx, bson.M{
-		"fromUserId": userID,
-	}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+// ExpirePendingBookings moves to EXPIRED the pending bookings created before now minus ttl or
+// whose start date has already passed, and returns the expired bookings.
+func (s *BookingService) ExpirePendingBookings(
+	ctx context.Context,
+	now time.Time,
+	ttl time.Duration,
+) ([]*Booking, error) {
+	filter := bson.M{
+		"bookingStatus": BookingStatusPending,
+		"$or": []bson.M{
+			{"createdAt": bson.M{"$lte": now.Add(-ttl)}},
+			{"startDate": bson.M{"$lte": now}},
+		},
+	}
+	cursor, err := s.collection.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -213,59 +987,152 @@ func (s *BookingService) GetUserPetitions(ctx context.Context, userID primitive.
 		}
 	}()
 
-	var bookings []*Booking
-	if err = cursor.All(ctx, &bookings); err != nil {
+	var stale []*Booking
+	if err := cursor.All(ctx, &stale); err != nil {
 		return nil, err
 	}
-	return bookings, nil
+
+	expired := []*Booking{}
+	for _, booking := range stale {
+		// Only expire if the booking is still pending, it might have been answered meanwhile
+		result, err := s.collection.UpdateOne(ctx,
+			bson.M{"_id": booking.ID, "bookingStatus": BookingStatusPending},
+			bson.M{
+				"$set": bson.M{
+					"bookingStatus": BookingStatusExpired,
+					"updatedAt":     now,
+				},
+				"$push": bson.M{"history": BookingTransition{
+					From: BookingStatusPending,
+					To:   BookingStatusExpired,
+					At:   now,
+				}},
+			},
+		)
+		if err != nil {
+			return expired, err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		booking.BookingStatus = BookingStatusExpired
+		booking.UpdatedAt = now
+		expired = append(expired, booking)
+	}
+	return expired, nil
 }
 
-// UpdateStatus updates the booking status and handles any related updates
-func (s *BookingService) UpdateStatus(ctx context.Context, id primitive.ObjectID, status BookingStatus) error {
-	booking, err := s.Get(ctx, id)
-	if err != nil {
-		return err
+// GetDueReminders returns the bookings that must receive the reminder at the given time
+// and have not received it yet:
+//   - pickup: accepted bookings starting in the next 24 hours
+//   - return: accepted bookings ending today (UTC) or overdue
+//   - rating: bookings returned more than 48 hours ago
+func (s *BookingService) GetDueReminders(
+	ctx context.Context,
+	reminder BookingReminder,
+	now time.Time,
+) ([]*Booking, error) {
+	filter := bson.M{"remindersSent": bson.M{"$ne": reminder}}
+	switch reminder {
+	case BookingReminderPickup:
+		filter["bookingStatus"] = BookingStatusAccepted
+		filter["startDate"] = bson.M{"$gt": now, "$lte": now.Add(24 * time.Hour)}
+	case BookingReminderReturn:
+		filter["bookingStatus"] = BookingStatusAccepted
+		filter["endDate"] = bson.M{"$lt": now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)}
+	case BookingReminderRating:
+		filter["bookingStatus"] = BookingStatusReturned
+		filter["returnedAt"] = bson.M{"$lte": now.Add(-48 * time.Hour)}
+	default:
+		return nil, fmt.Errorf("unknown reminder %q", reminder)
 	}
-	if booking == nil {
-		return ErrBookingNotFound
+
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
 	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
 
-	update := bson.M{
-		"$set": bson.M{
-			"bookingStatus": status,
-			"updatedAt":     time.Now(),
-		},
+	bookings := []*Booking{}
+	if err := cursor.All(ctx, &bookings); err != nil {
+		return nil, err
 	}
+	return bookings, nil
+}
 
-	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+// MarkReminderSent records the reminder as sent. It returns false if it was already recorded,
+// so concurrent schedulers never send the same reminder twice.
+func (s *BookingService) MarkReminderSent(
+	ctx context.Context,
+	id primitive.ObjectID,
+	reminder BookingReminder,
+) (bool, error) {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "remindersSent": bson.M{"$ne": reminder}},
+		bson.M{"$push": bson.M{"remindersSent": reminder}},
+	)
 	if err != nil {
-		return err
-	}
-	if result.MatchedCount == 0 {
-		return ErrBookingNotFound
+		return false, err
 	}
+	return result.ModifiedCount > 0, nil
+}
 
-	// If accepting booking, update tool's reserved dates
-	if status == BookingStatusAccepted {
-		// Get tool service from database
-		toolService := s.database.Collection("tools")
+// HasAcceptedBooking returns true if the user has an accepted booking from the owner.
+// If toolID is not empty, the booking must be for that tool.
+func (s *BookingService) HasAcceptedBooking(
+	ctx context.Context,
+	fromUserID, toUserID primitive.ObjectID,
+	toolID string,
+) (bool, error) {
+	filter := bson.M{
+		"fromUserId":    fromUserID,
+		"toUserId":      toUserID,
+		"bookingStatus": BookingStatusAccepted,
+	}
+	if toolID != "" {
+		filter["toolId"] = toolID
+	}
+	count, err := s.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
 
-		// Add reserved dates to tool
-		update := bson.M{
-			"$push": bson.M{
-				"reservedDates": bson.M{
-					"from": booking.StartDate,
-					"to":   booking.EndDate,
-				},
-			},
-		}
-		_, err = toolService.UpdateOne(ctx, bson.M{"_id": booking.ToolID}, update)
-		if err != nil {
-			return fmt.Errorf("could not update tool reserved dates: %w", err)
+// GetToolAcceptedBookings gets the accepted bookings of the tool ending after the given time,
+// sorted by start date.
+func (s *BookingService) GetToolAcceptedBookings(ctx context.Context, toolID string, from time.Time) ([]*Booking, error) {
+	cursor, err := s.collection.Find(ctx,
+		bson.M{
+			"toolId":        toolID,
+			"bookingStatus": BookingStatusAccepted,
+			"endDate":       bson.M{"$gt": from},
+		},
+		options.Find().SetSort(bson.D{{Key: "startDate", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
 		}
+	}()
+
+	bookings := []*Booking{}
+	if err = cursor.All(ctx, &bookings); err != nil {
+		return nil, err
 	}
+	return bookings, nil
+}
 
-	return nil
+// HasDateConflicts returns true if the dates overlap an accepted booking of the tool.
+func (s *BookingService) HasDateConflicts(ctx context.Context, toolID string, start, end time.Time) (bool, error) {
+	return s.checkDateConflicts(ctx, toolID, start, end, primitive.NilObjectID)
 }
 
 // checkDateConflicts checks if there are any conflicting bookings for the given tool and dates.
@@ -303,12 +1170,8 @@ func (s *BookingService) checkDateConflicts(
 // GetPendingRatings gets bookings that need to be rated by the user
 func (s *BookingService) GetPendingRatings(ctx context.Context, userID primitive.ObjectID) ([]*Booking, error) {
 	filter := bson.M{
-		"$or": []bson.M{
-			{"fromUserId": userID},
-			{"toUserId": userID},
-		},
+		"$or":           unratedByFilter(userID),
 		"bookingStatus": BookingStatusReturned,
-		// Add additional conditions for unrated bookings
 	}
 
 	cursor, err := s.collection.Find(ctx, filter)
@@ -328,6 +1191,118 @@ func (s *BookingService) GetPendingRatings(ctx context.Context, userID primitive
 	return bookings, nil
 }
 
+// unratedByFilter returns the conditions matching the bookings of the user not rated by the user yet.
+func unratedByFilter(userID primitive.ObjectID) []bson.M {
+	return []bson.M{
+		{"fromUserId": userID, "ownerRating": bson.M{"$exists": false}},
+		{"toUserId": userID, "renterRating": bson.M{"$exists": false}},
+	}
+}
+
+// RateBooking records the rating given by the user to the other party of the booking.
+// Each party can rate a booking once, further ratings return ErrAlreadyRated.
+func (s *BookingService) RateBooking(ctx context.Context, booking *Booking, raterID primitive.ObjectID, rating int) error {
+	field := "renterRating"
+	if raterID == booking.FromUserID {
+		field = "ownerRating"
+	} else if raterID != booking.ToUserID {
+		return fmt.Errorf("user %s is not a party of booking %s", raterID.Hex(), booking.ID.Hex())
+	}
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": booking.ID, field: bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{field: rating, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrAlreadyRated
+	}
+	return nil
+}
+
+// UserBookingStats are the aggregated booking figures of a user.
+type UserBookingStats struct {
+	CompletedAsOwner  int64    `bson:"completedAsOwner"`
+	CompletedAsRenter int64    `bson:"completedAsRenter"`
+	OwnerRating       *float64 `bson:"ownerRating"`
+	OwnerRatings      int64    `bson:"ownerRatings"`
+	RenterRating      *float64 `bson:"renterRating"`
+	RenterRatings     int64    `bson:"renterRatings"`
+	// ResponseTime is the average time the user took to accept or reject the requests
+	// received, in milliseconds (nil if never answered a request).
+	ResponseTime *float64 `bson:"responseTime"`
+	// Disputes is the number of bookings of the user whose disagreement was escalated.
+	Disputes int64 `bson:"disputes"`
+}
+
+// GetUserBookingStats returns the number of returned bookings of the user as owner and as
+// renter, the average rating received in each role (nil if never rated), the average
+// response time to booking requests and the number of escalated disputes.
+func (s *BookingService) GetUserBookingStats(ctx context.Context, userID primitive.ObjectID) (*UserBookingStats, error) {
+	roleStats := func(userField, ratingField string) bson.A {
+		return bson.A{
+			bson.D{{Key: "$match", Value: bson.M{userField: userID, "bookingStatus": BookingStatusReturned}}},
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: nil},
+				{Key: "completed", Value: bson.M{"$sum": 1}},
+				{Key: "rating", Value: bson.M{"$avg": "$" + ratingField}},
+				{Key: "ratings", Value: bson.M{"$sum": bson.M{
+					"$cond": bson.A{bson.M{"$gt": bson.A{"$" + ratingField, nil}}, 1, 0},
+				}}},
+			}}},
+		}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$facet", Value: bson.D{
+			{Key: "owner", Value: roleStats("toUserId", "ownerRating")},
+			{Key: "renter", Value: roleStats("fromUserId", "renterRating")},
+			{Key: "responses", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.M{"toUserId": userID, "respondedAt": bson.M{"$exists": true}}}},
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: nil},
+					{Key: "time", Value: bson.M{"$avg": bson.M{"$subtract": bson.A{"$respondedAt", "$createdAt"}}}},
+				}}},
+			}},
+			{Key: "disputes", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.M{
+					"$or":                 []bson.M{{"fromUserId": userID}, {"toUserId": userID}},
+					"disagreement.status": DisagreementStatusEscalated,
+				}}},
+				bson.D{{Key: "$count", Value: "count"}},
+			}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "completedAsOwner", Value: bson.M{"$ifNull": bson.A{bson.M{"$first": "$owner.completed"}, 0}}},
+			{Key: "ownerRating", Value: bson.M{"$first": "$owner.rating"}},
+			{Key: "ownerRatings", Value: bson.M{"$ifNull": bson.A{bson.M{"$first": "$owner.ratings"}, 0}}},
+			{Key: "completedAsRenter", Value: bson.M{"$ifNull": bson.A{bson.M{"$first": "$renter.completed"}, 0}}},
+			{Key: "renterRating", Value: bson.M{"$first": "$renter.rating"}},
+			{Key: "renterRatings", Value: bson.M{"$ifNull": bson.A{bson.M{"$first": "$renter.ratings"}, 0}}},
+			{Key: "responseTime", Value: bson.M{"$first": "$responses.time"}},
+			{Key: "disputes", Value: bson.M{"$ifNull": bson.A{bson.M{"$first": "$disputes.count"}, 0}}},
+		}}},
+	}
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var results []*UserBookingStats
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return &UserBookingStats{}, nil
+	}
+	return results[0], nil
+}
+
 // CountPendingActionsResponse represents the response for CountPendingActions
 type CountPendingActionsResponse struct {
 	PendingRatingsCount  int64 `json:"pendingRatingsCount"`
@@ -346,10 +1321,7 @@ func (s *BookingService) CountPendingActions(
 				{Key: "pendingRatings", Value: bson.A{
 					bson.D{
 						{Key: "$match", Value: bson.M{
-							"$or": []bson.M{
-								{"fromUserId": userID},
-								{"toUserId": userID},
-							},
+							"$or": unratedByFilter(userID),
 							"bookingStatus": bson.M{
 								"$in": []BookingStatus{
 									BookingStatusReturned,
@@ -406,3 +1378,283 @@ func (s *BookingService) CountPendingActions(
 	// Return the first document in the result (contains the counts)
 	return &result[0], nil
 }
+
+// OriginAttribution is the number of bookings created from an origin and how many of
+// them became loans.
+type OriginAttribution struct {
+	Origin   BookingOrigin `bson:"_id" json:"origin"`
+	Bookings int64         `bson:"bookings" json:"bookings"`
+	Accepted int64         `bson:"accepted" json:"accepted"`
+	Returned int64         `bson:"returned" json:"returned"`
+}
+
+// GetOriginAttribution aggregates the bookings created since the given time by origin.
+// Bookings without origin are grouped under an empty origin. Accepted counts the bookings
+// that were accepted, including the ones already returned.
+func (s *BookingService) GetOriginAttribution(ctx context.Context, since time.Time) ([]*OriginAttribution, error) {
+	countIf := func(statuses ...BookingStatus) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{
+			bson.M{"$in": bson.A{"$bookingStatus", statuses}}, 1, 0,
+		}}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"createdAt": bson.M{"$gte": since}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"$ifNull": bson.A{"$origin", ""}},
+			"bookings": bson.M{"$sum": 1},
+			"accepted": countIf(BookingStatusAccepted, BookingStatusReturned),
+			"returned": countIf(BookingStatusReturned),
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "bookings", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate booking origins: %w", err)
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	result := []*OriginAttribution{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse aggregation result: %w", err)
+	}
+	return result, nil
+}
+
+// OwnerStats are the aggregated figures of the booking requests received by a tool owner.
+type OwnerStats struct {
+	// Requests is the number of requests received, Accepted the ones accepted (including the
+	// returned ones) and Rejected the ones rejected.
+	Requests int64 `bson:"requests"`
+	Accepted int64 `bson:"accepted"`
+	Rejected int64 `bson:"rejected"`
+	// Months are the figures of each month with requests, the oldest first.
+	Months []*OwnerMonthStats `bson:"months"`
+	// Tools are the figures of each requested tool, the most requested first.
+	Tools []*OwnerToolStats `bson:"tools"`
+}
+
+// OwnerMonthStats are the figures of the requests received by an owner in a month.
+type OwnerMonthStats struct {
+	// Month is formatted as YYYY-MM.
+	Month    string `bson:"_id"`
+	Requests int64  `bson:"requests"`
+	Returned int64  `bson:"returned"`
+	// Rating is the average rating received for the bookings of the month (nil if none was
+	// rated), and Ratings the number of ratings.
+	Rating  *float64 `bson:"rating"`
+	Ratings int64    `bson:"ratings"`
+}
+
+// OwnerToolStats are the figures of the requests received for a tool.
+type OwnerToolStats struct {
+	ToolID   string `bson:"_id"`
+	Requests int64  `bson:"requests"`
+	// ReturnedDays is the number of started days of the returned bookings of the tool.
+	ReturnedDays int64 `bson:"returnedDays"`
+}
+
+// GetOwnerStats aggregates the booking requests received by the owner created in the given
+// period. The from and to times are optional, the period is unbounded if they are nil.
+func (s *BookingService) GetOwnerStats(
+	ctx context.Context, ownerID primitive.ObjectID, from, to *time.Time,
+) (*OwnerStats, error) {
+	match := bson.M{"toUserId": ownerID}
+	if from != nil || to != nil {
+		createdAt := bson.M{}
+		if from != nil {
+			createdAt["$gte"] = *from
+		}
+		if to != nil {
+			createdAt["$lt"] = *to
+		}
+		match["createdAt"] = createdAt
+	}
+	countIf := func(statuses ...BookingStatus) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{
+			bson.M{"$in": bson.A{"$bookingStatus", statuses}}, 1, 0,
+		}}}
+	}
+	// The days of a booking are its started days, at least one
+	days := bson.M{"$max": bson.A{1, bson.M{"$ceil": bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{"$endDate", "$startDate"}}, int64(24 * time.Hour / time.Millisecond),
+	}}}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "totals", Value: bson.A{
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: nil},
+					{Key: "requests", Value: bson.M{"$sum": 1}},
+					{Key: "accepted", Value: countIf(BookingStatusAccepted, BookingStatusReturned)},
+					{Key: "rejected", Value: countIf(BookingStatusRejected)},
+				}}},
+			}},
+			{Key: "months", Value: bson.A{
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: bson.M{"$dateToString": bson.M{"format": "%Y-%m", "date": "$createdAt"}}},
+					{Key: "requests", Value: bson.M{"$sum": 1}},
+					{Key: "returned", Value: countIf(BookingStatusReturned)},
+					{Key: "rating", Value: bson.M{"$avg": "$ownerRating"}},
+					{Key: "ratings", Value: bson.M{"$sum": bson.M{
+						"$cond": bson.A{bson.M{"$gt": bson.A{"$ownerRating", nil}}, 1, 0},
+					}}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+			}},
+			{Key: "tools", Value: bson.A{
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: "$toolId"},
+					{Key: "requests", Value: bson.M{"$sum": 1}},
+					{Key: "returnedDays", Value: bson.M{"$sum": bson.M{"$cond": bson.A{
+						bson.M{"$eq": bson.A{"$bookingStatus", BookingStatusReturned}}, days, 0,
+					}}}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "requests", Value: -1}, {Key: "_id", Value: 1}}}},
+			}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "requests", Value: bson.M{"$ifNull": bson.A{bson.M{"$first": "$totals.requests"}, 0}}},
+			{Key: "accepted", Value: bson.M{"$ifNull": bson.A{bson.M{"$first": "$totals.accepted"}, 0}}},
+			{Key: "rejected", Value: bson.M{"$ifNull": bson.A{bson.M{"$first": "$totals.rejected"}, 0}}},
+			{Key: "months", Value: 1},
+			{Key: "tools", Value: 1},
+		}}},
+	}
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate owner stats: %w", err)
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var results []*OwnerStats
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse aggregation result: %w", err)
+	}
+	if len(results) == 0 {
+		return &OwnerStats{Months: []*OwnerMonthStats{}, Tools: []*OwnerToolStats{}}, nil
+	}
+	return results[0], nil
+}
+
+// CommunityBookingStats are the aggregated figures of the returned bookings of a community.
+type CommunityBookingStats struct {
+	Completed int64 `bson:"completed"`
+	// Tools are the number of returned bookings of each tool.
+	Tools []*ToolBookingCount `bson:"tools"`
+	// Members are the members with most returned bookings, as owner or as renter, the most
+	// active first.
+	Members []*MemberBookingCount `bson:"members"`
+}
+
+// ToolBookingCount is the number of bookings of a tool.
+type ToolBookingCount struct {
+	ToolID   string `bson:"_id" json:"toolId"`
+	Bookings int64  `bson:"bookings" json:"bookings"`
+}
+
+// MemberBookingCount is the number of bookings of a user.
+type MemberBookingCount struct {
+	UserID   primitive.ObjectID `bson:"_id" json:"userId"`
+	Bookings int64              `bson:"bookings" json:"bookings"`
+}
+
+// GetCommunityBookingStats aggregates the returned bookings of a community: the bookings of
+// the shared tools of the community and the ones where any of the parties is a member. Up to
+// topMembers of the most active members are returned.
+func (s *BookingService) GetCommunityBookingStats(
+	ctx context.Context, community string, members []primitive.ObjectID, topMembers int,
+) (*CommunityBookingStats, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"bookingStatus": BookingStatusReturned,
+			"$or": []bson.M{
+				{"community": community},
+				{"fromUserId": bson.M{"$in": members}},
+				{"toUserId": bson.M{"$in": members}},
+			},
+		}}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "completed", Value: bson.A{bson.D{{Key: "$count", Value: "count"}}}},
+			{Key: "tools", Value: bson.A{
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: "$toolId"},
+					{Key: "bookings", Value: bson.M{"$sum": 1}},
+				}}},
+			}},
+			{Key: "members", Value: bson.A{
+				bson.D{{Key: "$project", Value: bson.M{"party": bson.A{"$fromUserId", "$toUserId"}}}},
+				bson.D{{Key: "$unwind", Value: "$party"}},
+				bson.D{{Key: "$match", Value: bson.M{"party": bson.M{"$in": members}}}},
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: "$party"},
+					{Key: "bookings", Value: bson.M{"$sum": 1}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "bookings", Value: -1}, {Key: "_id", Value: 1}}}},
+				bson.D{{Key: "$limit", Value: topMembers}},
+			}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "completed", Value: bson.M{"$ifNull": bson.A{bson.M{"$first": "$completed.count"}, 0}}},
+			{Key: "tools", Value: 1},
+			{Key: "members", Value: 1},
+		}}},
+	}
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate community bookings: %w", err)
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var results []*CommunityBookingStats
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse aggregation result: %w", err)
+	}
+	if len(results) == 0 {
+		return &CommunityBookingStats{Tools: []*ToolBookingCount{}, Members: []*MemberBookingCount{}}, nil
+	}
+	return results[0], nil
+}
+
+// GetReturnedBookingsByTool returns the number of returned bookings of each tool, if since is
+// set only the bookings returned after it.
+func (s *BookingService) GetReturnedBookingsByTool(ctx context.Context, since *time.Time) ([]*ToolBookingCount, error) {
+	match := bson.M{"bookingStatus": BookingStatusReturned}
+	if since != nil {
+		match["returnedAt"] = bson.M{"$gte": *since}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$toolId"},
+			{Key: "bookings", Value: bson.M{"$sum": 1}},
+		}}},
+	}
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate returned bookings: %w", err)
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	result := []*ToolBookingCount{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse aggregation result: %w", err)
+	}
+	return result, nil
+}
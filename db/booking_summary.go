@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"slices"
+
+	"github.com/emprius/emprius-app-backend/types"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BookingTool is the summary of the tool of a booking embedded in the booking lists, so the
+// clients do not need to get the tool of each booking.
+type BookingTool struct {
+	Title string `bson:"title" json:"title"`
+	// ImageHash is the hash of the first image of the tool, if it has any
+	ImageHash types.HexBytes `bson:"imageHash,omitempty" json:"imageHash,omitempty"`
+}
+
+// BookingUser is the summary of a party of a booking embedded in the booking lists.
+type BookingUser struct {
+	Name       string         `bson:"name" json:"name"`
+	AvatarHash types.HexBytes `bson:"avatarHash,omitempty" json:"avatarHash,omitempty"`
+	Rating     int32          `bson:"rating" json:"rating"`
+}
+
+// findBookings returns the bookings matching the filter in the given order, newest first if
+// sort is nil. If limit is positive,
+// at most limit bookings are returned after skipping the first skip ones. If fields are given,
+// only those document fields are retrieved.
+//
+// The summaries of the tool and the users of the bookings are looked up with their own
+// projection, so they always reflect the current tool and users without loading them. When
+// fields are given, they are only looked up if "tool", "fromUser" or "toUser" are included.
+func (s *BookingService) findBookings(ctx context.Context, filter bson.M, sort bson.D, skip, limit int64,
+	fields []string,
+) ([]*Booking, error) {
+	if sort == nil {
+		sort = bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: sort}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline,
+			bson.D{{Key: "$skip", Value: skip}},
+			bson.D{{Key: "$limit", Value: limit}},
+		)
+	}
+	if projection := Projection(fields); projection != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: projection}})
+	}
+	lookup := func(field string) bool {
+		return len(fields) == 0 || slices.Contains(fields, field)
+	}
+	if lookup("tool") {
+		// The tool IDs of the bookings are strings
+		toolID := bson.M{"$convert": bson.M{"input": "$toolId", "to": "long", "onError": nil, "onNull": nil}}
+		pipeline = append(pipeline, summaryLookup("tools", "tool", toolID, bson.M{
+			"_id":       0,
+			"title":     1,
+			"imageHash": bson.M{"$first": "$images.hash"},
+		})...)
+	}
+	userProjection := bson.M{"_id": 0, "name": 1, "avatarHash": 1, "rating": 1}
+	if lookup("fromUser") {
+		pipeline = append(pipeline, summaryLookup("users", "fromUser", "$fromUserId", userProjection)...)
+	}
+	if lookup("toUser") {
+		pipeline = append(pipeline, summaryLookup("users", "toUser", "$toUserId", userProjection)...)
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var bookings []*Booking
+	if err = cursor.All(ctx, &bookings); err != nil {
+		return nil, err
+	}
+	return bookings, nil
+}
+
+// summaryLookup returns the stages that set the field to the projection of the document of the
+// collection with the given ID, or leave it unset if there is none.
+func summaryLookup(collection, field string, id interface{}, projection bson.M) []bson.D {
+	return []bson.D{
+		{{Key: "$lookup", Value: bson.M{
+			"from": collection,
+			"let":  bson.M{"id": id},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$id"}}}},
+				bson.M{"$project": projection},
+			},
+			"as": field,
+		}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$" + field, "preserveNullAndEmptyArrays": true}}},
+	}
+}
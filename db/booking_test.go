@@ -2,10 +2,12 @@ package db
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
 	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -81,7 +83,7 @@ func TestBookingService(t *testing.T) {
 		c.Assert(err, qt.IsNil, qt.Commentf("Failed to create first booking"))
 
 		// Accept first booking
-		err = bookingService.UpdateStatus(ctx, booking1.ID, BookingStatusAccepted)
+		err = bookingService.UpdateStatus(ctx, booking1.ID, BookingStatusAccepted, primitive.NilObjectID, "")
 		c.Assert(err, qt.IsNil, qt.Commentf("Failed to accept first booking"))
 
 		// Try to create overlapping booking (should fail since first booking is accepted)
@@ -111,11 +113,132 @@ func TestBookingService(t *testing.T) {
 		}
 
 		// Get requests
-		requests, err := bookingService.GetUserRequests(ctx, toUserID)
+		requests, err := bookingService.GetUserRequests(ctx, toUserID, nil)
 		c.Assert(err, qt.IsNil, qt.Commentf("Failed to get user requests"))
 		c.Assert(len(requests), qt.Equals, 3, qt.Commentf("Expected 3 requests"))
 	})
 
+	c.Run("Filter and Sort User Requests", func(c *qt.C) {
+		toUserID, renterID := primitive.NewObjectID(), primitive.NewObjectID()
+		start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+		var ids []primitive.ObjectID
+		for i, toolID := range []string{"111", "222", "111"} {
+			// The later bookings start earlier
+			req := &CreateBookingRequest{
+				ToolID:    toolID,
+				StartDate: start.Add(time.Duration(10-3*i) * 24 * time.Hour),
+				EndDate:   start.Add(time.Duration(11-3*i) * 24 * time.Hour),
+			}
+			from := primitive.NewObjectID()
+			if i > 0 {
+				from = renterID
+			}
+			booking, err := bookingService.Create(ctx, req, from, toUserID)
+			c.Assert(err, qt.IsNil)
+			ids = append(ids, booking.ID)
+		}
+		c.Assert(bookingService.UpdateStatus(ctx, ids[0], BookingStatusAccepted, toUserID, ""), qt.IsNil)
+		requestIDs := func(opts *BookingListOptions) []primitive.ObjectID {
+			requests, err := bookingService.GetUserRequests(ctx, toUserID, opts)
+			c.Assert(err, qt.IsNil)
+			result := []primitive.ObjectID{}
+			for _, r := range requests {
+				result = append(result, r.ID)
+			}
+			return result
+		}
+
+		c.Assert(requestIDs(nil), qt.DeepEquals, []primitive.ObjectID{ids[2], ids[1], ids[0]})
+		c.Assert(requestIDs(&BookingListOptions{Ascending: true}), qt.DeepEquals, ids)
+		c.Assert(requestIDs(&BookingListOptions{SortBy: BookingSortStartDate, Ascending: true}), qt.DeepEquals,
+			[]primitive.ObjectID{ids[2], ids[1], ids[0]})
+		c.Assert(requestIDs(&BookingListOptions{Statuses: []BookingStatus{BookingStatusAccepted}}), qt.DeepEquals,
+			[]primitive.ObjectID{ids[0]})
+		c.Assert(requestIDs(&BookingListOptions{ToolID: "111", SortBy: BookingSortStartDate}), qt.DeepEquals,
+			[]primitive.ObjectID{ids[0], ids[2]})
+		c.Assert(requestIDs(&BookingListOptions{Counterpart: renterID}), qt.DeepEquals,
+			[]primitive.ObjectID{ids[2], ids[1]})
+		// The date range selects the overlapping bookings
+		c.Assert(requestIDs(&BookingListOptions{
+			From: start.Add(5 * 24 * time.Hour),
+			To:   start.Add(11 * 24 * time.Hour),
+		}), qt.DeepEquals, []primitive.ObjectID{ids[1], ids[0]})
+	})
+
+	c.Run("Archive Bookings", func(c *qt.C) {
+		ownerID, renterID := primitive.NewObjectID(), primitive.NewObjectID()
+		start := time.Now().Add(-10 * 24 * time.Hour)
+		var ids []primitive.ObjectID
+		for i := 0; i < 3; i++ {
+			booking, err := bookingService.Create(ctx, &CreateBookingRequest{
+				ToolID:    "901234",
+				StartDate: start.Add(time.Duration(3*i) * 24 * time.Hour),
+				EndDate:   start.Add(time.Duration(3*i+1) * 24 * time.Hour),
+			}, renterID, ownerID)
+			c.Assert(err, qt.IsNil)
+			ids = append(ids, booking.ID)
+		}
+		for _, id := range ids[:2] {
+			c.Assert(bookingService.UpdateStatus(ctx, id, BookingStatusRejected, ownerID, ""), qt.IsNil)
+		}
+
+		// Only the ended bookings can be archived
+		c.Assert(bookingService.SetArchived(ctx, ids[2], renterID, true), qt.Equals, ErrBookingStatusChanged)
+		c.Assert(bookingService.SetArchived(ctx, ids[0], renterID, true), qt.IsNil)
+		booking, err := bookingService.Get(ctx, ids[0])
+		c.Assert(err, qt.IsNil)
+		c.Assert(booking.ArchivedByUser(renterID), qt.IsTrue)
+		c.Assert(booking.ArchivedByUser(ownerID), qt.IsFalse)
+
+		// The archived bookings are only hidden from the lists of the user
+		petitions, err := bookingService.GetUserPetitions(ctx, renterID, &BookingListOptions{})
+		c.Assert(err, qt.IsNil)
+		c.Assert(petitions, qt.HasLen, 2)
+		petitions, err = bookingService.GetUserPetitions(ctx, renterID, &BookingListOptions{IncludeArchived: true})
+		c.Assert(err, qt.IsNil)
+		c.Assert(petitions, qt.HasLen, 3)
+		requests, err := bookingService.GetUserRequests(ctx, ownerID, &BookingListOptions{})
+		c.Assert(err, qt.IsNil)
+		c.Assert(requests, qt.HasLen, 3)
+
+		// The bulk archive skips the bookings already archived, not ended or ended later
+		archived, err := bookingService.ArchiveUserBookings(ctx, renterID, time.Now())
+		c.Assert(err, qt.IsNil)
+		c.Assert(archived, qt.Equals, int64(1))
+		archived, err = bookingService.ArchiveUserBookings(ctx, ownerID, start.Add(2*24*time.Hour))
+		c.Assert(err, qt.IsNil)
+		c.Assert(archived, qt.Equals, int64(1))
+
+		c.Assert(bookingService.SetArchived(ctx, ids[0], renterID, false), qt.IsNil)
+		petitions, err = bookingService.GetUserPetitions(ctx, renterID, &BookingListOptions{})
+		c.Assert(err, qt.IsNil)
+		c.Assert(petitions, qt.HasLen, 2)
+	})
+
+	c.Run("Flag Tool Bookings", func(c *qt.C) {
+		booking, err := bookingService.Create(ctx, &CreateBookingRequest{
+			ToolID:    "902345",
+			StartDate: time.Now().Add(24 * time.Hour),
+			EndDate:   time.Now().Add(48 * time.Hour),
+		}, primitive.NewObjectID(), primitive.NewObjectID())
+		c.Assert(err, qt.IsNil)
+
+		flagged, err := bookingService.FlagToolBookings(ctx, "902345")
+		c.Assert(err, qt.IsNil)
+		c.Assert(flagged, qt.Equals, int64(1))
+		booking, err = bookingService.Get(ctx, booking.ID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(booking.ToolReported, qt.IsTrue)
+
+		// The recovered tool clears the flag
+		unflagged, err := bookingService.UnflagToolBookings(ctx, "902345")
+		c.Assert(err, qt.IsNil)
+		c.Assert(unflagged, qt.Equals, int64(1))
+		booking, err = bookingService.Get(ctx, booking.ID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(booking.ToolReported, qt.IsFalse)
+	})
+
 	c.Run("Get User Petitions", func(c *qt.C) {
 		fromUserID := primitive.NewObjectID()
 
@@ -132,11 +255,69 @@ func TestBookingService(t *testing.T) {
 		}
 
 		// Get petitions
-		petitions, err := bookingService.GetUserPetitions(ctx, fromUserID)
+		petitions, err := bookingService.GetUserPetitions(ctx, fromUserID, nil)
 		c.Assert(err, qt.IsNil, qt.Commentf("Failed to get user petitions"))
 		c.Assert(len(petitions), qt.Equals, 3, qt.Commentf("Expected 3 petitions"))
 	})
 
+	c.Run("Booking Summaries", func(c *qt.C) {
+		fromUser := &User{ID: primitive.NewObjectID(), Name: "renter", Rating: 60, AvatarHash: []byte{1}}
+		toUser := &User{ID: primitive.NewObjectID(), Name: "owner", Rating: 70}
+		for _, u := range []*User{fromUser, toUser} {
+			_, err := database.Collection("users").InsertOne(ctx, u)
+			c.Assert(err, qt.IsNil)
+		}
+		tool := &Tool{ID: 567890, Title: "drill", Images: []Image{{Hash: []byte{2}}, {Hash: []byte{3}}}}
+		_, err := database.Collection("tools").InsertOne(ctx, tool)
+		c.Assert(err, qt.IsNil)
+
+		_, err = bookingService.Create(ctx, &CreateBookingRequest{
+			ToolID:    "567890",
+			StartDate: time.Now().Add(24 * time.Hour),
+			EndDate:   time.Now().Add(48 * time.Hour),
+		}, fromUser.ID, toUser.ID)
+		c.Assert(err, qt.IsNil)
+
+		requests, err := bookingService.GetUserRequests(ctx, toUser.ID, nil)
+		c.Assert(err, qt.IsNil)
+		c.Assert(requests, qt.HasLen, 1)
+		c.Assert(requests[0].Tool, qt.DeepEquals, &BookingTool{Title: "drill", ImageHash: []byte{2}})
+		c.Assert(requests[0].FromUser, qt.DeepEquals, &BookingUser{Name: "renter", AvatarHash: []byte{1}, Rating: 60})
+		c.Assert(requests[0].ToUser, qt.DeepEquals, &BookingUser{Name: "owner", Rating: 70})
+
+		// The summaries follow the edits of the tool and the users
+		_, err = database.Collection("tools").UpdateOne(ctx, bson.M{"_id": tool.ID},
+			bson.M{"$set": bson.M{"title": "hammer drill", "images": []Image{}}})
+		c.Assert(err, qt.IsNil)
+		_, err = database.Collection("users").UpdateOne(ctx, bson.M{"_id": toUser.ID},
+			bson.M{"$set": bson.M{"name": "new owner"}})
+		c.Assert(err, qt.IsNil)
+		petitions, err := bookingService.GetUserPetitions(ctx, fromUser.ID, nil)
+		c.Assert(err, qt.IsNil)
+		c.Assert(petitions, qt.HasLen, 1)
+		c.Assert(petitions[0].Tool, qt.DeepEquals, &BookingTool{Title: "hammer drill"})
+		c.Assert(petitions[0].ToUser.Name, qt.Equals, "new owner")
+
+		// Only the selected summaries are looked up
+		petitions, err = bookingService.GetUserPetitions(ctx, fromUser.ID, nil, "_id", "toUserId", "toUser")
+		c.Assert(err, qt.IsNil)
+		c.Assert(petitions[0].Tool, qt.IsNil)
+		c.Assert(petitions[0].FromUser, qt.IsNil)
+		c.Assert(petitions[0].ToUser.Name, qt.Equals, "new owner")
+
+		// The summaries of missing tools and users are not set
+		_, err = database.Collection("tools").DeleteOne(ctx, bson.M{"_id": tool.ID})
+		c.Assert(err, qt.IsNil)
+		petitions, err = bookingService.GetUserPetitions(ctx, fromUser.ID, nil)
+		c.Assert(err, qt.IsNil)
+		c.Assert(petitions[0].Tool, qt.IsNil)
+
+		// The summaries are not stored
+		count, err := database.Collection("bookings").CountDocuments(ctx, bson.M{"tool": bson.M{"$exists": true}})
+		c.Assert(err, qt.IsNil)
+		c.Assert(count, qt.Equals, int64(0))
+	})
+
 	c.Run("Update Booking Status", func(c *qt.C) {
 		req := &CreateBookingRequest{
 			ToolID:    "901234",
@@ -148,7 +329,7 @@ func TestBookingService(t *testing.T) {
 		c.Assert(err, qt.IsNil, qt.Commentf("Failed to create booking"))
 
 		// Update status
-		err = bookingService.UpdateStatus(ctx, booking.ID, BookingStatusAccepted)
+		err = bookingService.UpdateStatus(ctx, booking.ID, BookingStatusAccepted, primitive.NilObjectID, "")
 		c.Assert(err, qt.IsNil, qt.Commentf("Failed to update booking status"))
 
 		// Verify update
@@ -173,7 +354,7 @@ func TestBookingService(t *testing.T) {
 		}
 
 		// Update status to returned
-		err = bookingService.UpdateStatus(ctx, booking.ID, BookingStatusReturned)
+		err = bookingService.UpdateStatus(ctx, booking.ID, BookingStatusReturned, primitive.NilObjectID, "")
 		c.Assert(err, qt.IsNil, qt.Commentf("Failed to create test booking"))
 
 		// Get pending ratings
@@ -181,4 +362,407 @@ func TestBookingService(t *testing.T) {
 		c.Assert(err, qt.IsNil, qt.Commentf("Failed to get pending ratings"))
 		c.Assert(len(ratings), qt.Not(qt.Equals), 0, qt.Commentf("Expected at least one pending rating"))
 	})
+
+	c.Run("Return Condition Disagreement", func(c *qt.C) {
+		fromUserID := primitive.NewObjectID()
+		req := &CreateBookingRequest{
+			ToolID:    "345678",
+			StartDate: time.Now().Add(-48 * time.Hour),
+			EndDate:   time.Now().Add(-24 * time.Hour),
+			Contact:   "test@example.com",
+		}
+		booking, err := bookingService.Create(ctx, req, fromUserID, primitive.NewObjectID())
+		c.Assert(err, qt.IsNil, qt.Commentf("Failed to create booking"))
+
+		// Disagreements can only be opened on returned bookings
+		disagreement := &BookingDisagreement{
+			OpenedBy:    fromUserID,
+			Description: "The blade was already broken",
+			OpenedAt:    time.Now().Add(-10 * 24 * time.Hour),
+			Deadline:    time.Now().Add(-time.Hour),
+		}
+		err = bookingService.OpenDisagreement(ctx, booking.ID, disagreement)
+		c.Assert(err, qt.Equals, ErrDisagreementConflict)
+
+		err = bookingService.UpdateStatus(ctx, booking.ID, BookingStatusReturned, primitive.NilObjectID, "")
+		c.Assert(err, qt.IsNil)
+		err = bookingService.OpenDisagreement(ctx, booking.ID, disagreement)
+		c.Assert(err, qt.IsNil, qt.Commentf("Failed to open disagreement"))
+
+		// Only one disagreement per booking
+		err = bookingService.OpenDisagreement(ctx, booking.ID, disagreement)
+		c.Assert(err, qt.Equals, ErrDisagreementConflict)
+
+		// Only the party that opened it resolves it
+		err = bookingService.ResolveDisagreement(ctx, booking.ID, booking.ToUserID)
+		c.Assert(err, qt.Equals, ErrDisagreementConflict)
+
+		// Overdue disagreements are escalated once
+		escalated, err := bookingService.EscalateOverdueDisagreements(ctx, time.Now())
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(escalated), qt.Equals, 1)
+		c.Assert(escalated[0].ID, qt.Equals, booking.ID)
+		escalated, err = bookingService.EscalateOverdueDisagreements(ctx, time.Now())
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(escalated), qt.Equals, 0)
+
+		updated, err := bookingService.Get(ctx, booking.ID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(updated.Disagreement.Status, qt.Equals, DisagreementStatusEscalated)
+		c.Assert(updated.Disagreement.EscalatedAt, qt.Not(qt.IsNil))
+
+		// Escalated disagreements can no longer be resolved by the parties
+		err = bookingService.ResolveDisagreement(ctx, booking.ID, fromUserID)
+		c.Assert(err, qt.Equals, ErrDisagreementConflict)
+	})
+
+	c.Run("Origin Attribution", func(c *qt.C) {
+		since := time.Now().Add(-time.Minute)
+		for i, origin := range []BookingOrigin{BookingOriginSearch, BookingOriginSearch, BookingOriginShareLink} {
+			booking, err := bookingService.Create(ctx, &CreateBookingRequest{
+				ToolID:    "origin-tool",
+				StartDate: time.Now().Add(time.Duration(100+i*10) * 24 * time.Hour),
+				EndDate:   time.Now().Add(time.Duration(101+i*10) * 24 * time.Hour),
+				Origin:    origin,
+			}, primitive.NewObjectID(), primitive.NewObjectID())
+			c.Assert(err, qt.IsNil)
+			if i == 0 {
+				c.Assert(bookingService.UpdateStatus(ctx, booking.ID, BookingStatusAccepted, primitive.NilObjectID, ""), qt.IsNil)
+			}
+		}
+
+		attribution, err := bookingService.GetOriginAttribution(ctx, since)
+		c.Assert(err, qt.IsNil)
+		byOrigin := map[BookingOrigin]*OriginAttribution{}
+		for _, a := range attribution {
+			byOrigin[a.Origin] = a
+		}
+		c.Assert(byOrigin[BookingOriginSearch].Bookings, qt.Equals, int64(2))
+		c.Assert(byOrigin[BookingOriginSearch].Accepted, qt.Equals, int64(1))
+		c.Assert(byOrigin[BookingOriginShareLink].Bookings, qt.Equals, int64(1))
+		c.Assert(byOrigin[BookingOriginShareLink].Accepted, qt.Equals, int64(0))
+		// Bookings created by the previous tests have no origin
+		c.Assert(byOrigin[""], qt.Not(qt.IsNil))
+	})
+
+	c.Run("Owner Stats", func(c *qt.C) {
+		ownerID := primitive.NewObjectID()
+		now := time.Now()
+		create := func(toolID string, days int, status BookingStatus) *Booking {
+			booking, err := bookingService.Create(ctx, &CreateBookingRequest{
+				ToolID:    toolID,
+				StartDate: now.Add(-10 * 24 * time.Hour),
+				EndDate:   now.Add(time.Duration(days-10)*24*time.Hour - time.Hour),
+			}, primitive.NewObjectID(), ownerID)
+			c.Assert(err, qt.IsNil)
+			if status != BookingStatusPending {
+				c.Assert(bookingService.UpdateStatus(ctx, booking.ID, status, ownerID, ""), qt.IsNil)
+				booking.BookingStatus = status
+			}
+			return booking
+		}
+		returned := create("stats-tool-1", 3, BookingStatusReturned)
+		c.Assert(bookingService.RateBooking(ctx, returned, returned.FromUserID, 4), qt.IsNil)
+		create("stats-tool-1", 2, BookingStatusReturned)
+		create("stats-tool-1", 1, BookingStatusRejected)
+		create("stats-tool-2", 1, BookingStatusPending)
+		create("stats-tool-2", 1, BookingStatusAccepted)
+
+		stats, err := bookingService.GetOwnerStats(ctx, ownerID, nil, nil)
+		c.Assert(err, qt.IsNil)
+		c.Assert(stats.Requests, qt.Equals, int64(5))
+		c.Assert(stats.Accepted, qt.Equals, int64(3))
+		c.Assert(stats.Rejected, qt.Equals, int64(1))
+		c.Assert(stats.Months, qt.HasLen, 1)
+		c.Assert(stats.Months[0].Month, qt.Equals, now.UTC().Format("2006-01"))
+		c.Assert(stats.Months[0].Returned, qt.Equals, int64(2))
+		c.Assert(*stats.Months[0].Rating, qt.Equals, 4.0)
+		c.Assert(stats.Months[0].Ratings, qt.Equals, int64(1))
+		c.Assert(stats.Tools, qt.HasLen, 2)
+		c.Assert(stats.Tools[0].ToolID, qt.Equals, "stats-tool-1")
+		c.Assert(stats.Tools[0].Requests, qt.Equals, int64(3))
+		c.Assert(stats.Tools[0].ReturnedDays, qt.Equals, int64(5))
+
+		// The period filters by creation date
+		future := now.Add(time.Hour)
+		stats, err = bookingService.GetOwnerStats(ctx, ownerID, &future, nil)
+		c.Assert(err, qt.IsNil)
+		c.Assert(stats.Requests, qt.Equals, int64(0))
+		c.Assert(stats.Months, qt.HasLen, 0)
+		c.Assert(stats.Tools, qt.HasLen, 0)
+	})
+
+	c.Run("Booking Reminders", func(c *qt.C) {
+		now := time.Now()
+		booking, err := bookingService.Create(ctx, &CreateBookingRequest{
+			ToolID:    "reminder-tool",
+			StartDate: now.Add(12 * time.Hour),
+			EndDate:   now.Add(72 * time.Hour),
+		}, primitive.NewObjectID(), primitive.NewObjectID())
+		c.Assert(err, qt.IsNil)
+
+		isDue := func(reminder BookingReminder, at time.Time) bool {
+			due, err := bookingService.GetDueReminders(ctx, reminder, at)
+			c.Assert(err, qt.IsNil)
+			for _, b := range due {
+				if b.ID == booking.ID {
+					return true
+				}
+			}
+			return false
+		}
+
+		// Pending bookings are not reminded
+		c.Assert(isDue(BookingReminderPickup, now), qt.IsFalse)
+		c.Assert(bookingService.UpdateStatus(ctx, booking.ID, BookingStatusAccepted, primitive.NilObjectID, ""), qt.IsNil)
+		c.Assert(isDue(BookingReminderPickup, now), qt.IsTrue)
+		c.Assert(isDue(BookingReminderReturn, now), qt.IsFalse)
+		c.Assert(isDue(BookingReminderReturn, now.Add(72*time.Hour)), qt.IsTrue)
+
+		// Reminders are only sent once
+		sent, err := bookingService.MarkReminderSent(ctx, booking.ID, BookingReminderPickup)
+		c.Assert(err, qt.IsNil)
+		c.Assert(sent, qt.IsTrue)
+		sent, err = bookingService.MarkReminderSent(ctx, booking.ID, BookingReminderPickup)
+		c.Assert(err, qt.IsNil)
+		c.Assert(sent, qt.IsFalse)
+		c.Assert(isDue(BookingReminderPickup, now), qt.IsFalse)
+
+		// The rating reminder is due 48 hours after the return
+		c.Assert(bookingService.UpdateStatus(ctx, booking.ID, BookingStatusReturned, primitive.NilObjectID, ""), qt.IsNil)
+		c.Assert(isDue(BookingReminderRating, now), qt.IsFalse)
+		c.Assert(isDue(BookingReminderRating, now.Add(49*time.Hour)), qt.IsTrue)
+	})
+
+	c.Run("Expire Pending Bookings", func(c *qt.C) {
+		now := time.Now()
+		future, err := bookingService.Create(ctx, &CreateBookingRequest{
+			ToolID:    "expiration-tool",
+			StartDate: now.Add(30 * 24 * time.Hour),
+			EndDate:   now.Add(31 * 24 * time.Hour),
+		}, primitive.NewObjectID(), primitive.NewObjectID())
+		c.Assert(err, qt.IsNil)
+		soon, err := bookingService.Create(ctx, &CreateBookingRequest{
+			ToolID:    "expiration-tool",
+			StartDate: now.Add(2 * 24 * time.Hour),
+			EndDate:   now.Add(3 * 24 * time.Hour),
+		}, primitive.NewObjectID(), primitive.NewObjectID())
+		c.Assert(err, qt.IsNil)
+
+		isExpired := func(expired []*Booking, id primitive.ObjectID) bool {
+			for _, b := range expired {
+				if b.ID == id {
+					return true
+				}
+			}
+			return false
+		}
+
+		// Recent bookings not started yet are kept pending
+		expired, err := bookingService.ExpirePendingBookings(ctx, now, 7*24*time.Hour)
+		c.Assert(err, qt.IsNil)
+		c.Assert(isExpired(expired, future.ID), qt.IsFalse)
+		c.Assert(isExpired(expired, soon.ID), qt.IsFalse)
+
+		// Bookings whose start date has passed expire even before the ttl
+		expired, err = bookingService.ExpirePendingBookings(ctx, now.Add(3*24*time.Hour), 7*24*time.Hour)
+		c.Assert(err, qt.IsNil)
+		c.Assert(isExpired(expired, future.ID), qt.IsFalse)
+		c.Assert(isExpired(expired, soon.ID), qt.IsTrue)
+
+		// Stale bookings expire once the ttl is over, and only once
+		expired, err = bookingService.ExpirePendingBookings(ctx, now.Add(8*24*time.Hour), 7*24*time.Hour)
+		c.Assert(err, qt.IsNil)
+		c.Assert(isExpired(expired, future.ID), qt.IsTrue)
+		c.Assert(isExpired(expired, soon.ID), qt.IsFalse)
+
+		updated, err := bookingService.Get(ctx, future.ID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(updated.BookingStatus, qt.Equals, BookingStatusExpired)
+
+		// Expired bookings are not counted as pending requests
+		counts, err := bookingService.CountPendingActions(ctx, future.ToUserID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(counts.PendingRequestsCount, qt.Equals, int64(0))
+	})
+
+	c.Run("Has Accepted Booking", func(c *qt.C) {
+		renter, owner := primitive.NewObjectID(), primitive.NewObjectID()
+		booking, err := bookingService.Create(ctx, &CreateBookingRequest{
+			ToolID:    "private-tool",
+			StartDate: time.Now().Add(200 * 24 * time.Hour),
+			EndDate:   time.Now().Add(201 * 24 * time.Hour),
+		}, renter, owner)
+		c.Assert(err, qt.IsNil)
+
+		accepted, err := bookingService.HasAcceptedBooking(ctx, renter, owner, "private-tool")
+		c.Assert(err, qt.IsNil)
+		c.Assert(accepted, qt.IsFalse)
+
+		c.Assert(bookingService.UpdateStatus(ctx, booking.ID, BookingStatusAccepted, primitive.NilObjectID, ""), qt.IsNil)
+		for _, toolID := range []string{"private-tool", ""} {
+			accepted, err = bookingService.HasAcceptedBooking(ctx, renter, owner, toolID)
+			c.Assert(err, qt.IsNil)
+			c.Assert(accepted, qt.IsTrue)
+		}
+		// Only the renter gets access, and only to the booked tool
+		accepted, err = bookingService.HasAcceptedBooking(ctx, owner, renter, "")
+		c.Assert(err, qt.IsNil)
+		c.Assert(accepted, qt.IsFalse)
+		accepted, err = bookingService.HasAcceptedBooking(ctx, renter, owner, "other-tool")
+		c.Assert(err, qt.IsNil)
+		c.Assert(accepted, qt.IsFalse)
+	})
+
+	c.Run("Ratings And Stats", func(c *qt.C) {
+		renter, owner := primitive.NewObjectID(), primitive.NewObjectID()
+		for i, rating := range []int{5, 2, 0} {
+			booking, err := bookingService.Create(ctx, &CreateBookingRequest{
+				ToolID:    "stats-tool",
+				StartDate: time.Now().Add(time.Duration(300+i*10) * 24 * time.Hour),
+				EndDate:   time.Now().Add(time.Duration(301+i*10) * 24 * time.Hour),
+			}, renter, owner)
+			c.Assert(err, qt.IsNil)
+			c.Assert(bookingService.UpdateStatus(ctx, booking.ID, BookingStatusReturned, primitive.NilObjectID, ""), qt.IsNil)
+			if rating == 0 {
+				continue
+			}
+			c.Assert(bookingService.RateBooking(ctx, booking, renter, rating), qt.IsNil)
+			c.Assert(bookingService.RateBooking(ctx, booking, renter, rating), qt.Equals, ErrAlreadyRated)
+		}
+
+		// Rated bookings are no longer pending for the rater, but still are for the other party
+		pending, err := bookingService.GetPendingRatings(ctx, renter)
+		c.Assert(err, qt.IsNil)
+		c.Assert(pending, qt.HasLen, 1)
+		pending, err = bookingService.GetPendingRatings(ctx, owner)
+		c.Assert(err, qt.IsNil)
+		c.Assert(pending, qt.HasLen, 3)
+
+		stats, err := bookingService.GetUserBookingStats(ctx, owner)
+		c.Assert(err, qt.IsNil)
+		c.Assert(stats.CompletedAsOwner, qt.Equals, int64(3))
+		c.Assert(stats.CompletedAsRenter, qt.Equals, int64(0))
+		c.Assert(stats.OwnerRatings, qt.Equals, int64(2))
+		c.Assert(*stats.OwnerRating, qt.Equals, 3.5)
+		c.Assert(stats.RenterRating, qt.IsNil)
+
+		stats, err = bookingService.GetUserBookingStats(ctx, primitive.NewObjectID())
+		c.Assert(err, qt.IsNil)
+		c.Assert(stats.CompletedAsOwner, qt.Equals, int64(0))
+		c.Assert(stats.OwnerRating, qt.IsNil)
+		c.Assert(stats.ResponseTime, qt.IsNil)
+	})
+
+	c.Run("Response Time And Disputes", func(c *qt.C) {
+		renter, owner := primitive.NewObjectID(), primitive.NewObjectID()
+		booking, err := bookingService.Create(ctx, &CreateBookingRequest{
+			ToolID:    "trust-tool",
+			StartDate: time.Now().Add(400 * 24 * time.Hour),
+			EndDate:   time.Now().Add(401 * 24 * time.Hour),
+		}, renter, owner)
+		c.Assert(err, qt.IsNil)
+		c.Assert(bookingService.UpdateStatus(ctx, booking.ID, BookingStatusAccepted, primitive.NilObjectID, ""), qt.IsNil)
+		_, err = bookingService.collection.UpdateOne(ctx, bson.M{"_id": booking.ID}, bson.M{
+			"$set": bson.M{"disagreement.status": DisagreementStatusEscalated},
+		})
+		c.Assert(err, qt.IsNil)
+
+		stats, err := bookingService.GetUserBookingStats(ctx, owner)
+		c.Assert(err, qt.IsNil)
+		c.Assert(stats.ResponseTime, qt.Not(qt.IsNil))
+		c.Assert(*stats.ResponseTime >= 0, qt.IsTrue)
+		c.Assert(stats.Disputes, qt.Equals, int64(1))
+
+		// The renter did not answer any request but was part of the dispute
+		stats, err = bookingService.GetUserBookingStats(ctx, renter)
+		c.Assert(err, qt.IsNil)
+		c.Assert(stats.ResponseTime, qt.IsNil)
+		c.Assert(stats.Disputes, qt.Equals, int64(1))
+	})
+
+	c.Run("Status History", func(c *qt.C) {
+		renter, owner := primitive.NewObjectID(), primitive.NewObjectID()
+		booking, err := bookingService.Create(ctx, &CreateBookingRequest{
+			ToolID:    "history-tool",
+			StartDate: time.Now().Add(500 * 24 * time.Hour),
+			EndDate:   time.Now().Add(501 * 24 * time.Hour),
+		}, renter, owner)
+		c.Assert(err, qt.IsNil)
+		c.Assert(bookingService.UpdateStatus(ctx, booking.ID, BookingStatusAccepted, owner, "see you monday"), qt.IsNil)
+		cancelled, err := bookingService.CancelUserOpenBookings(ctx, renter)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cancelled, qt.HasLen, 1)
+
+		booking, err = bookingService.Get(ctx, booking.ID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(booking.History, qt.HasLen, 3)
+		c.Assert(booking.History[0].From, qt.Equals, BookingStatus(""))
+		c.Assert(booking.History[0].To, qt.Equals, BookingStatusPending)
+		c.Assert(booking.History[0].By, qt.Equals, renter)
+		c.Assert(booking.History[1].From, qt.Equals, BookingStatusPending)
+		c.Assert(booking.History[1].To, qt.Equals, BookingStatusAccepted)
+		c.Assert(booking.History[1].By, qt.Equals, owner)
+		c.Assert(booking.History[1].Note, qt.Equals, "see you monday")
+		c.Assert(booking.History[2].From, qt.Equals, BookingStatusAccepted)
+		c.Assert(booking.History[2].To, qt.Equals, BookingStatusCancelled)
+		c.Assert(booking.History[2].By, qt.Equals, renter)
+	})
+
+	c.Run("Concurrent Accepts", func(c *qt.C) {
+		create := func(toolID string, startDay int) *Booking {
+			booking, err := bookingService.Create(ctx, &CreateBookingRequest{
+				ToolID:    toolID,
+				StartDate: time.Now().Add(time.Duration(200+startDay) * 24 * time.Hour),
+				EndDate:   time.Now().Add(time.Duration(202+startDay) * 24 * time.Hour),
+			}, primitive.NewObjectID(), primitive.NewObjectID())
+			c.Assert(err, qt.IsNil)
+			return booking
+		}
+		acceptAll := func(bookings []*Booking) []error {
+			errs := make([]error, len(bookings))
+			var wg sync.WaitGroup
+			for i, booking := range bookings {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs[i] = bookingService.UpdateStatus(ctx, booking.ID, BookingStatusAccepted, primitive.NilObjectID, "")
+				}()
+			}
+			wg.Wait()
+			return errs
+		}
+
+		// Only one of the overlapping bookings wins
+		overlapping := []*Booking{}
+		for i := 0; i < 8; i++ {
+			overlapping = append(overlapping, create("race-tool", i%2))
+		}
+		accepted := 0
+		for _, err := range acceptAll(overlapping) {
+			if err == nil {
+				accepted++
+				continue
+			}
+			c.Assert(err == ErrBookingDatesConflict || err == ErrToolReservationBusy, qt.IsTrue, qt.Commentf("error %v", err))
+		}
+		c.Assert(accepted, qt.Equals, 1)
+		count, err := bookingService.collection.CountDocuments(ctx,
+			bson.M{"toolId": "race-tool", "bookingStatus": BookingStatusAccepted})
+		c.Assert(err, qt.IsNil)
+		c.Assert(count, qt.Equals, int64(1))
+
+		// The bookings of other dates are all accepted
+		errs := acceptAll([]*Booking{create("race-tool", 10), create("race-tool", 20), create("race-tool", 30)})
+		c.Assert(errs, qt.DeepEquals, []error{nil, nil, nil})
+
+		// A booking is only accepted once
+		booking := create("race-tool-2", 0)
+		errs = acceptAll([]*Booking{booking, booking})
+		c.Assert(errs[0] == nil || errs[1] == nil, qt.IsTrue)
+		c.Assert(errs[0] == nil && errs[1] == nil, qt.IsFalse)
+		updated, err := bookingService.Get(ctx, booking.ID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(updated.History, qt.HasLen, 2)
+	})
 }
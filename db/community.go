@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Community represents the schema for the "communities" collection. Communities are created
+// implicitly by their members, so a document only exists once the community holds tokens, sets
+// a fee or its stats are computed.
+type Community struct {
+	ID string `bson:"_id" json:"id"`
+	// Tokens is the pool of tokens collected by the shared tools of the community.
+	Tokens uint64 `bson:"tokens" json:"tokens"`
+	// Fee is the tokens paid to the pool by the renter of each returned booking of the tools
+	// of the members, 0 if the community charges no fee.
+	Fee uint64 `bson:"fee,omitempty" json:"fee,omitempty"`
+	// Stats are the figures of the community, recalculated periodically (nil until computed).
+	Stats *CommunityStats `bson:"stats,omitempty" json:"stats,omitempty"`
+}
+
+// CommunityStats are the aggregated figures of a community.
+type CommunityStats struct {
+	Members int64 `bson:"members" json:"members"`
+	// MemberGrowth is the number of members by the month they registered, the oldest first.
+	MemberGrowth      []*MonthlyCount `bson:"memberGrowth" json:"memberGrowth"`
+	ToolsShared       int64           `bson:"toolsShared" json:"toolsShared"`
+	BookingsCompleted int64           `bson:"bookingsCompleted" json:"bookingsCompleted"`
+	// MostActive are the members with most completed bookings, the most active first.
+	MostActive []*MemberBookingCount `bson:"mostActive" json:"mostActive"`
+	// EstimatedSavings is the sum of the estimated value of the tools of each completed
+	// booking, what the renters would have spent buying the tools.
+	EstimatedSavings uint64    `bson:"estimatedSavings" json:"estimatedSavings"`
+	UpdatedAt        time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// CommunityService provides methods to interact with the "communities" collection.
+type CommunityService struct {
+	Collection *mongo.Collection
+}
+
+// NewCommunityService creates a new CommunityService.
+func NewCommunityService(db *Database) *CommunityService {
+	return &CommunityService{
+		Collection: db.Database.Collection("communities"),
+	}
+}
+
+// GetCommunity retrieves a community. Communities without document have an empty pool.
+func (s *CommunityService) GetCommunity(ctx context.Context, id string) (*Community, error) {
+	community := Community{ID: id}
+	err := s.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(&community)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	return &community, nil
+}
+
+// SetStats stores the stats of the community.
+func (s *CommunityService) SetStats(ctx context.Context, id string, stats *CommunityStats) error {
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"stats": stats}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// AddTokens adds the amount to the token pool of the community.
+func (s *CommunityService) AddTokens(ctx context.Context, id string, amount uint64) error {
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$inc": bson.M{"tokens": int64(amount)}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// SpendTokens subtracts the amount from the token pool of the community. It returns
+// ErrNotEnoughTokens if the pool has not enough tokens, leaving it untouched.
+func (s *CommunityService) SpendTokens(ctx context.Context, id string, amount uint64) error {
+	result, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "tokens": bson.M{"$gte": amount}},
+		bson.M{"$inc": bson.M{"tokens": -int64(amount)}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotEnoughTokens
+	}
+	return nil
+}
+
+// SetFee sets the fee paid to the token pool of the community by each returned booking of the
+// tools of its members.
+func (s *CommunityService) SetFee(ctx context.Context, id string, fee uint64) error {
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"fee": fee}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PoolMovementKind is the kind of a movement of the token pool of a community.
+type PoolMovementKind string
+
+const (
+	// PoolMovementFee is the fee paid to the pool by the renter of a returned booking.
+	PoolMovementFee PoolMovementKind = "FEE"
+	// PoolMovementPayout is a payout of the pool to a member, made by a community admin.
+	PoolMovementPayout PoolMovementKind = "PAYOUT"
+)
+
+// PoolMovement represents the schema for the "community_pool" collection. Each entry records
+// the fees paid to the token pool of a community and its payouts, the balance being the tokens
+// of the community.
+type PoolMovement struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Community string             `bson:"community" json:"community"`
+	Kind      PoolMovementKind   `bson:"kind" json:"kind"`
+	Amount    uint64             `bson:"amount" json:"amount"`
+	// UserID is the renter paying a fee or the member receiving a payout.
+	UserID primitive.ObjectID `bson:"userId" json:"userId"`
+	// BookingID is the booking paying a fee.
+	BookingID primitive.ObjectID `bson:"bookingId,omitempty" json:"bookingId,omitempty"`
+	// CreatedBy is the admin making a payout, with its reason.
+	CreatedBy primitive.ObjectID `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// CommunityPoolService provides methods to interact with the "community_pool" collection.
+type CommunityPoolService struct {
+	Collection *mongo.Collection
+}
+
+// NewCommunityPoolService creates a new CommunityPoolService.
+func NewCommunityPoolService(db *Database) *CommunityPoolService {
+	return &CommunityPoolService{
+		Collection: db.Database.Collection("community_pool"),
+	}
+}
+
+// InsertMovement inserts a new PoolMovement document.
+func (s *CommunityPoolService) InsertMovement(ctx context.Context, movement *PoolMovement) error {
+	if movement.CreatedAt.IsZero() {
+		movement.CreatedAt = time.Now()
+	}
+	result, err := s.Collection.InsertOne(ctx, movement)
+	if err != nil {
+		return err
+	}
+	movement.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetMovements gets the paginated movements of the token pool of a community, newest first,
+// only those of the kind if it is not empty.
+func (s *CommunityPoolService) GetMovements(
+	ctx context.Context,
+	community string,
+	kind PoolMovementKind,
+	page int,
+) ([]*PoolMovement, error) {
+	if page < 0 {
+		page = 0
+	}
+	filter := bson.M{"community": community}
+	if kind != "" {
+		filter["kind"] = kind
+	}
+	cursor, err := s.Collection.Find(ctx, filter,
+		options.Find().
+			SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+			SetSkip(int64(page*DefaultPageSize)).
+			SetLimit(int64(DefaultPageSize)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	movements := []*PoolMovement{}
+	if err := cursor.All(ctx, &movements); err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCommunityService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	communityService := NewCommunityService(&Database{
+		Client:   client,
+		Database: client.Database(dbName),
+	})
+
+	// Communities without document have an empty pool
+	community, err := communityService.GetCommunity(ctx, "valley")
+	c.Assert(err, qt.IsNil)
+	c.Assert(community.ID, qt.Equals, "valley")
+	c.Assert(community.Tokens, qt.Equals, uint64(0))
+
+	c.Assert(communityService.AddTokens(ctx, "valley", 30), qt.IsNil)
+	c.Assert(communityService.AddTokens(ctx, "valley", 12), qt.IsNil)
+	c.Assert(communityService.AddTokens(ctx, "coast", 5), qt.IsNil)
+	community, err = communityService.GetCommunity(ctx, "valley")
+	c.Assert(err, qt.IsNil)
+	c.Assert(community.Tokens, qt.Equals, uint64(42))
+	c.Assert(community.Stats, qt.IsNil)
+
+	// The stats are stored next to the pool
+	updatedAt := time.Now().UTC().Truncate(time.Millisecond)
+	c.Assert(communityService.SetStats(ctx, "valley", &CommunityStats{Members: 3, UpdatedAt: updatedAt}), qt.IsNil)
+	community, err = communityService.GetCommunity(ctx, "valley")
+	c.Assert(err, qt.IsNil)
+	c.Assert(community.Tokens, qt.Equals, uint64(42))
+	c.Assert(community.Stats.Members, qt.Equals, int64(3))
+	c.Assert(community.Stats.UpdatedAt.Equal(updatedAt), qt.IsTrue)
+
+	// The pool pays out up to its tokens
+	c.Assert(communityService.SpendTokens(ctx, "valley", 50), qt.Equals, ErrNotEnoughTokens)
+	c.Assert(communityService.SpendTokens(ctx, "meadow", 1), qt.Equals, ErrNotEnoughTokens)
+	c.Assert(communityService.SpendTokens(ctx, "valley", 40), qt.IsNil)
+	c.Assert(communityService.SetFee(ctx, "valley", 3), qt.IsNil)
+	community, err = communityService.GetCommunity(ctx, "valley")
+	c.Assert(err, qt.IsNil)
+	c.Assert(community.Tokens, qt.Equals, uint64(2))
+	c.Assert(community.Fee, qt.Equals, uint64(3))
+	c.Assert(community.Stats.Members, qt.Equals, int64(3))
+}
@@ -1,5 +1,19 @@
 package db
 
+// DefaultPageSize and MaxPageSize are the default and maximum sizes of the pages of the lists.
 const (
-	defaultPageSize = 16
+	DefaultPageSize = 16
+	MaxPageSize     = 100
 )
+
+// PageSize returns the effective page size for a requested size. Sizes lower than 1
+// fall back to the default page size and sizes above the maximum are capped.
+func PageSize(size int) int {
+	if size <= 0 {
+		return DefaultPageSize
+	}
+	if size > MaxPageSize {
+		return MaxPageSize
+	}
+	return size
+}
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CrowdfundStatus is the status of a crowdfund.
+type CrowdfundStatus string
+
+const (
+	// CrowdfundOpen crowdfunds accept pledges.
+	CrowdfundOpen CrowdfundStatus = "OPEN"
+	// CrowdfundCompleted crowdfunds reached their goal and the tool was bought and registered.
+	CrowdfundCompleted CrowdfundStatus = "COMPLETED"
+	// CrowdfundCancelled crowdfunds were cancelled, their pledges refunded.
+	CrowdfundCancelled CrowdfundStatus = "CANCELLED"
+)
+
+// Crowdfund represents the schema for the "crowdfunds" collection. It is the joint purchase of
+// a tool by the members of a community, who pledge tokens until the goal is reached. Once the
+// tool is bought, it is registered as a shared tool of the community.
+type Crowdfund struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Community   string             `bson:"community" json:"community"`
+	CreatedBy   primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	Title       string             `bson:"title" json:"title"`
+	Description string             `bson:"description" json:"description"`
+	// ToolCategory and EstimatedValue are those of the prospective tool.
+	ToolCategory   int    `bson:"toolCategory" json:"toolCategory"`
+	EstimatedValue uint64 `bson:"estimatedValue" json:"estimatedValue"`
+	// Goal is the tokens to collect, and Pledged the sum of the contributions.
+	Goal          uint64                  `bson:"goal" json:"goal"`
+	Pledged       uint64                  `bson:"pledged" json:"pledged"`
+	Contributions []CrowdfundContribution `bson:"contributions" json:"contributions"`
+	Status        CrowdfundStatus         `bson:"status" json:"status"`
+	CreatedAt     time.Time               `bson:"createdAt" json:"createdAt"`
+	ClosedAt      *time.Time              `bson:"closedAt,omitempty" json:"closedAt,omitempty"`
+	// ToolID is the shared tool registered when the crowdfund is completed.
+	ToolID int64 `bson:"toolId,omitempty" json:"toolId,omitempty"`
+}
+
+// CrowdfundContribution are the tokens pledged by a member to a crowdfund.
+type CrowdfundContribution struct {
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	Amount    uint64             `bson:"amount" json:"amount"`
+	PledgedAt time.Time          `bson:"pledgedAt" json:"pledgedAt"`
+}
+
+// CrowdfundService provides methods to interact with the "crowdfunds" collection.
+type CrowdfundService struct {
+	Collection *mongo.Collection
+}
+
+// NewCrowdfundService creates a new CrowdfundService.
+func NewCrowdfundService(db *Database) *CrowdfundService {
+	return &CrowdfundService{
+		Collection: db.Database.Collection("crowdfunds"),
+	}
+}
+
+// InsertCrowdfund inserts a new open crowdfund.
+func (s *CrowdfundService) InsertCrowdfund(ctx context.Context, c *Crowdfund) error {
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+	c.Status = CrowdfundOpen
+	if c.Contributions == nil {
+		c.Contributions = []CrowdfundContribution{}
+	}
+	result, err := s.Collection.InsertOne(ctx, c)
+	if err != nil {
+		return err
+	}
+	c.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetCrowdfund retrieves a crowdfund of the community. It returns mongo.ErrNoDocuments if the
+// crowdfund does not exist or belongs to another community.
+func (s *CrowdfundService) GetCrowdfund(ctx context.Context, community string, id primitive.ObjectID) (*Crowdfund, error) {
+	var crowdfund Crowdfund
+	if err := s.Collection.FindOne(ctx, bson.M{"_id": id, "community": community}).Decode(&crowdfund); err != nil {
+		return nil, err
+	}
+	return &crowdfund, nil
+}
+
+// GetCommunityCrowdfunds retrieves the paginated crowdfunds of a community, newest first, only
+// those with the given status if not empty.
+func (s *CrowdfundService) GetCommunityCrowdfunds(
+	ctx context.Context,
+	community string,
+	status CrowdfundStatus,
+	page int,
+) ([]*Crowdfund, error) {
+	if page < 0 {
+		page = 0
+	}
+	filter := bson.M{"community": community}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64(page * DefaultPageSize)).
+		SetLimit(int64(DefaultPageSize))
+	cursor, err := s.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	crowdfunds := []*Crowdfund{}
+	if err := cursor.All(ctx, &crowdfunds); err != nil {
+		return nil, err
+	}
+	return crowdfunds, nil
+}
+
+// Pledge adds a contribution of the user to the open crowdfund and returns the updated
+// crowdfund. It returns ErrCrowdfundConflict if the crowdfund is not open or the amount
+// exceeds the tokens left to reach the goal.
+func (s *CrowdfundService) Pledge(
+	ctx context.Context,
+	id primitive.ObjectID,
+	userID primitive.ObjectID,
+	amount uint64,
+) (*Crowdfund, error) {
+	filter := bson.M{
+		"_id":    id,
+		"status": CrowdfundOpen,
+		"$expr":  bson.M{"$lte": bson.A{bson.M{"$add": bson.A{"$pledged", int64(amount)}}, "$goal"}},
+	}
+	update := bson.M{
+		"$inc":  bson.M{"pledged": int64(amount)},
+		"$push": bson.M{"contributions": CrowdfundContribution{UserID: userID, Amount: amount, PledgedAt: time.Now()}},
+	}
+	return s.update(ctx, filter, update)
+}
+
+// Withdraw removes the contributions of the user to the open crowdfund and returns the
+// withdrawn tokens. It returns ErrCrowdfundConflict if the crowdfund is not open, or changed
+// meanwhile.
+func (s *CrowdfundService) Withdraw(ctx context.Context, crowdfund *Crowdfund, userID primitive.ObjectID) (uint64, error) {
+	var amount uint64
+	for _, c := range crowdfund.Contributions {
+		if c.UserID == userID {
+			amount += c.Amount
+		}
+	}
+	if amount == 0 {
+		return 0, nil
+	}
+	filter := bson.M{"_id": crowdfund.ID, "status": CrowdfundOpen, "pledged": int64(crowdfund.Pledged)}
+	update := bson.M{
+		"$inc":  bson.M{"pledged": -int64(amount)},
+		"$pull": bson.M{"contributions": bson.M{"userId": userID}},
+	}
+	if _, err := s.update(ctx, filter, update); err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
+
+// Complete closes the open crowdfund that reached its goal and returns it. It returns
+// ErrCrowdfundConflict if the crowdfund is not open or did not reach its goal.
+func (s *CrowdfundService) Complete(ctx context.Context, id primitive.ObjectID) (*Crowdfund, error) {
+	filter := bson.M{
+		"_id":    id,
+		"status": CrowdfundOpen,
+		"$expr":  bson.M{"$gte": bson.A{"$pledged", "$goal"}},
+	}
+	return s.update(ctx, filter, bson.M{"$set": bson.M{"status": CrowdfundCompleted, "closedAt": time.Now()}})
+}
+
+// Reopen opens again a crowdfund just completed, i.e. if its tool could not be registered.
+func (s *CrowdfundService) Reopen(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": CrowdfundCompleted, "toolId": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"status": CrowdfundOpen}, "$unset": bson.M{"closedAt": ""}},
+	)
+	return err
+}
+
+// SetTool records the shared tool registered for the completed crowdfund.
+func (s *CrowdfundService) SetTool(ctx context.Context, id primitive.ObjectID, toolID int64) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"toolId": toolID}})
+	return err
+}
+
+// Cancel closes the open crowdfund without buying the tool and returns it, with the
+// contributions to refund. It returns ErrCrowdfundConflict if the crowdfund is not open.
+func (s *CrowdfundService) Cancel(ctx context.Context, id primitive.ObjectID) (*Crowdfund, error) {
+	return s.update(ctx, bson.M{"_id": id, "status": CrowdfundOpen},
+		bson.M{"$set": bson.M{"status": CrowdfundCancelled, "closedAt": time.Now()}})
+}
+
+// update applies the update to the crowdfund matching the filter and returns the updated
+// crowdfund, or ErrCrowdfundConflict if none matches.
+func (s *CrowdfundService) update(ctx context.Context, filter, update bson.M) (*Crowdfund, error) {
+	var crowdfund Crowdfund
+	err := s.Collection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&crowdfund)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCrowdfundConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &crowdfund, nil
+}
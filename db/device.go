@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Device represents the schema for the "devices" collection, the devices registered by the
+// users to receive push notifications. Token is the FCM registration token or the Web Push
+// subscription endpoint, P256dh and Auth are the keys of a Web Push subscription.
+type Device struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	Platform  string             `bson:"platform" json:"platform"`
+	Token     string             `bson:"token" json:"token"`
+	P256dh    string             `bson:"p256dh,omitempty" json:"p256dh,omitempty"`
+	Auth      string             `bson:"auth,omitempty" json:"auth,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// DeviceService provides methods to interact with the "devices" collection.
+type DeviceService struct {
+	Collection *mongo.Collection
+}
+
+// NewDeviceService creates a new DeviceService.
+func NewDeviceService(db *Database) *DeviceService {
+	return &DeviceService{
+		Collection: db.Database.Collection("devices"),
+	}
+}
+
+// RegisterDevice stores the device of the user. A token is unique, registering it again (e.g.
+// after another user logs in on the same device) updates the existing document.
+func (s *DeviceService) RegisterDevice(ctx context.Context, d *Device) error {
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now()
+	}
+	var stored Device
+	err := s.Collection.FindOneAndUpdate(ctx,
+		bson.M{"token": d.Token},
+		bson.M{"$set": bson.M{
+			"userId":    d.UserID,
+			"platform":  d.Platform,
+			"p256dh":    d.P256dh,
+			"auth":      d.Auth,
+			"createdAt": d.CreatedAt,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&stored)
+	if err != nil {
+		return err
+	}
+	d.ID = stored.ID
+	return nil
+}
+
+// GetUserDevices returns the devices of a user, newest first.
+func (s *DeviceService) GetUserDevices(ctx context.Context, userID primitive.ObjectID) ([]*Device, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := s.Collection.Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	devices := []*Device{}
+	if err := cursor.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// DeleteDevice deletes a device of the user. It returns mongo.ErrNoDocuments if the device
+// does not exist or does not belong to the user.
+func (s *DeviceService) DeleteDevice(ctx context.Context, userID, id primitive.ObjectID) error {
+	result, err := s.Collection.DeleteOne(ctx, bson.M{"_id": id, "userId": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteDeviceByToken deletes the device with the token, used when the push service reports
+// the token as no longer valid.
+func (s *DeviceService) DeleteDeviceByToken(ctx context.Context, token string) error {
+	_, err := s.Collection.DeleteOne(ctx, bson.M{"token": token})
+	return err
+}
+
+// DeleteUserDevices deletes all the devices of a user.
+func (s *DeviceService) DeleteUserDevices(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestDeviceService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	database := &Database{Client: client, Database: client.Database(dbName)}
+
+	deviceService := NewDeviceService(database)
+	userID := primitive.NewObjectID()
+	otherID := primitive.NewObjectID()
+
+	device := &Device{UserID: userID, Platform: "fcm", Token: "token-1"}
+	c.Assert(deviceService.RegisterDevice(ctx, device), qt.IsNil)
+	c.Assert(device.ID.IsZero(), qt.IsFalse)
+	c.Assert(deviceService.RegisterDevice(ctx, &Device{UserID: userID, Platform: "fcm", Token: "token-2"}), qt.IsNil)
+
+	devices, err := deviceService.GetUserDevices(ctx, userID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(devices, qt.HasLen, 2)
+
+	// Registering a known token moves the device to the new user
+	moved := &Device{UserID: otherID, Platform: "fcm", Token: "token-1"}
+	c.Assert(deviceService.RegisterDevice(ctx, moved), qt.IsNil)
+	c.Assert(moved.ID, qt.Equals, device.ID)
+	devices, err = deviceService.GetUserDevices(ctx, userID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(devices, qt.HasLen, 1)
+
+	// Devices are only deleted by their user
+	c.Assert(deviceService.DeleteDevice(ctx, userID, device.ID), qt.Equals, mongo.ErrNoDocuments)
+	c.Assert(deviceService.DeleteDevice(ctx, otherID, device.ID), qt.IsNil)
+
+	c.Assert(deviceService.DeleteDeviceByToken(ctx, "token-2"), qt.IsNil)
+	devices, err = deviceService.GetUserDevices(ctx, userID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(devices, qt.HasLen, 0)
+}
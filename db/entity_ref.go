@@ -0,0 +1,24 @@
+package db
+
+// EntityType is the type of the entity referenced by a message.
+type EntityType string
+
+const (
+	// EntityTool is a tool referenced with #tool:<id>.
+	EntityTool EntityType = "tool"
+	// EntityBooking is a booking referenced with #booking:<id>.
+	EntityBooking EntityType = "booking"
+	// EntityUser is a user mentioned with @<name>.
+	EntityUser EntityType = "user"
+)
+
+// EntityRef is a reference to a tool, a booking or a user in the text of a message, resolved
+// when the message was written so the clients can link it.
+type EntityRef struct {
+	Type EntityType `bson:"type" json:"type"`
+	ID   string     `bson:"id" json:"id"`
+	// Text is the reference as written in the message, i.e. #tool:123 or @alice.
+	Text string `bson:"text" json:"text"`
+	// Label is the title of the tool or the name of the user when the message was written.
+	Label string `bson:"label,omitempty" json:"label,omitempty"`
+}
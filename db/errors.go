@@ -7,4 +7,15 @@ var (
 	ErrBookingDatesConflict = errors.New("booking dates conflict with existing booking")
 	ErrBookingNotFound      = errors.New("booking not found")
 	ErrInvalidBookingDates  = errors.New("invalid booking dates")
+	ErrDisagreementConflict = errors.New("booking disagreement cannot be opened or resolved in its current state")
+	ErrAlreadyRated         = errors.New("booking already rated by the user")
+	ErrNotEnoughTokens      = errors.New("not enough tokens")
+	ErrAlreadyWaitlisted    = errors.New("user already in the waitlist of the tool")
+	ErrTransferPending      = errors.New("tool already has a pending transfer")
+	ErrDuplicateAssetTag    = errors.New("asset tag already in use")
+	ErrBookingStatusChanged = errors.New("booking status changed meanwhile")
+	ErrToolReservationBusy  = errors.New("another booking of the tool is being accepted")
+	ErrVersionConflict      = errors.New("the document was changed by another update")
+	ErrPaymentConflict      = errors.New("booking payment cannot be changed in its current state")
+	ErrCrowdfundConflict    = errors.New("crowdfund cannot be changed in its current state")
 )
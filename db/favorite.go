@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Favorite represents the schema for the "favorites" collection (the user tool wishlist).
+type Favorite struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	ToolID    int64              `bson:"toolId" json:"toolId"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// FavoriteService provides methods to interact with the "favorites" collection.
+type FavoriteService struct {
+	Collection *mongo.Collection
+}
+
+// NewFavoriteService creates a new FavoriteService.
+func NewFavoriteService(db *Database) *FavoriteService {
+	return &FavoriteService{
+		Collection: db.Database.Collection("favorites"),
+	}
+}
+
+// AddFavorite adds the tool to the user favorites. Adding an existing favorite is a no-op.
+func (s *FavoriteService) AddFavorite(ctx context.Context, userID primitive.ObjectID, toolID int64) error {
+	filter := bson.M{"userId": userID, "toolId": toolID}
+	update := bson.M{"$setOnInsert": bson.M{"createdAt": time.Now()}}
+	_, err := s.Collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// RemoveFavorite removes the tool from the user favorites. It returns mongo.ErrNoDocuments
+// if the tool was not a favorite.
+func (s *FavoriteService) RemoveFavorite(ctx context.Context, userID primitive.ObjectID, toolID int64) error {
+	result, err := s.Collection.DeleteOne(ctx, bson.M{"userId": userID, "toolId": toolID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// GetUserFavorites retrieves a page of the tool IDs favorited by the user, most recent first.
+func (s *FavoriteService) GetUserFavorites(ctx context.Context, userID primitive.ObjectID, page int) ([]int64, error) {
+	if page < 0 {
+		page = 0
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64(page * DefaultPageSize)).
+		SetLimit(int64(DefaultPageSize))
+	return s.findToolIDs(ctx, bson.M{"userId": userID}, opts)
+}
+
+// FavoriteToolIDs returns which of the given tools are favorites of the user.
+func (s *FavoriteService) FavoriteToolIDs(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	toolIDs []int64,
+) (map[int64]bool, error) {
+	ids, err := s.findToolIDs(ctx, bson.M{"userId": userID, "toolId": bson.M{"$in": toolIDs}}, options.Find())
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		result[id] = true
+	}
+	return result, nil
+}
+
+// GetToolFavoriters retrieves the IDs of the users that have the tool as favorite.
+func (s *FavoriteService) GetToolFavoriters(ctx context.Context, toolID int64) ([]primitive.ObjectID, error) {
+	cursor, err := s.Collection.Find(ctx, bson.M{"toolId": toolID})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var favorites []*Favorite
+	if err := cursor.All(ctx, &favorites); err != nil {
+		return nil, err
+	}
+	users := []primitive.ObjectID{}
+	for _, f := range favorites {
+		users = append(users, f.UserID)
+	}
+	return users, nil
+}
+
+// UpdateToolID moves the favorites of a tool to its new ID (the tool ID changes with its title).
+func (s *FavoriteService) UpdateToolID(ctx context.Context, oldID, newID int64) error {
+	_, err := s.Collection.UpdateMany(ctx, bson.M{"toolId": oldID}, bson.M{"$set": bson.M{"toolId": newID}})
+	return err
+}
+
+// DeleteToolFavorites removes all the favorites of a tool.
+func (s *FavoriteService) DeleteToolFavorites(ctx context.Context, toolID int64) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"toolId": toolID})
+	return err
+}
+
+// DeleteUserFavorites deletes all the favorites of a user.
+func (s *FavoriteService) DeleteUserFavorites(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
+
+func (s *FavoriteService) findToolIDs(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]int64, error) {
+	cursor, err := s.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var favorites []*Favorite
+	if err := cursor.All(ctx, &favorites); err != nil {
+		return nil, err
+	}
+	ids := []int64{}
+	for _, f := range favorites {
+		ids = append(ids, f.ToolID)
+	}
+	return ids, nil
+}
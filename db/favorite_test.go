@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestFavoriteService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	database := client.Database(dbName)
+
+	// Initialize FavoriteService
+	favoriteService := NewFavoriteService(&Database{
+		Client:   client,
+		Database: database,
+	})
+
+	userA := primitive.NewObjectID()
+	userB := primitive.NewObjectID()
+
+	c.Run("Add and List Favorites", func(c *qt.C) {
+		c.Assert(favoriteService.AddFavorite(ctx, userA, 1), qt.IsNil)
+		c.Assert(favoriteService.AddFavorite(ctx, userA, 2), qt.IsNil)
+		// Adding twice is a no-op
+		c.Assert(favoriteService.AddFavorite(ctx, userA, 2), qt.IsNil)
+		c.Assert(favoriteService.AddFavorite(ctx, userB, 2), qt.IsNil)
+
+		ids, err := favoriteService.GetUserFavorites(ctx, userA, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(ids), qt.Equals, 2)
+
+		favorites, err := favoriteService.FavoriteToolIDs(ctx, userB, []int64{1, 2, 3})
+		c.Assert(err, qt.IsNil)
+		c.Assert(favorites, qt.DeepEquals, map[int64]bool{2: true})
+
+		users, err := favoriteService.GetToolFavoriters(ctx, 2)
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(users), qt.Equals, 2)
+	})
+
+	c.Run("Update Tool ID", func(c *qt.C) {
+		c.Assert(favoriteService.UpdateToolID(ctx, 2, 20), qt.IsNil)
+		users, err := favoriteService.GetToolFavoriters(ctx, 20)
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(users), qt.Equals, 2)
+	})
+
+	c.Run("Remove Favorites", func(c *qt.C) {
+		c.Assert(favoriteService.RemoveFavorite(ctx, userA, 1), qt.IsNil)
+		err := favoriteService.RemoveFavorite(ctx, userA, 1)
+		c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+
+		c.Assert(favoriteService.DeleteToolFavorites(ctx, 20), qt.IsNil)
+		ids, err := favoriteService.GetUserFavorites(ctx, userA, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(ids), qt.Equals, 0)
+	})
+}
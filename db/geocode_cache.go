@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GeocodeCacheTTL is the time a geocoding lookup is kept in the cache.
+const GeocodeCacheTTL = 90 * 24 * time.Hour
+
+// GeocodeCacheEntry represents the schema for the "geocode_cache" collection. It stores
+// the result of a geocoding lookup, including lookups that did not match any place so
+// they are not repeated against the provider.
+type GeocodeCacheEntry struct {
+	Key       string    `bson:"_id" json:"key"`
+	Found     bool      `bson:"found" json:"found"`
+	Latitude  int64     `bson:"latitude" json:"latitude"`
+	Longitude int64     `bson:"longitude" json:"longitude"`
+	Locality  string    `bson:"locality" json:"locality"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// GeocodeCacheService provides methods to interact with the "geocode_cache" collection.
+type GeocodeCacheService struct {
+	Collection *mongo.Collection
+}
+
+// NewGeocodeCacheService creates a new GeocodeCacheService.
+func NewGeocodeCacheService(db *Database) *GeocodeCacheService {
+	return &GeocodeCacheService{
+		Collection: db.Database.Collection("geocode_cache"),
+	}
+}
+
+// Get returns the cached lookup for the key. It returns mongo.ErrNoDocuments if the key
+// is not cached or the entry is older than GeocodeCacheTTL.
+func (s *GeocodeCacheService) Get(ctx context.Context, key string) (*GeocodeCacheEntry, error) {
+	filter := bson.M{
+		"_id":       key,
+		"createdAt": bson.M{"$gt": time.Now().Add(-GeocodeCacheTTL)},
+	}
+	var entry GeocodeCacheEntry
+	if err := s.Collection.FindOne(ctx, filter).Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Set stores the lookup, replacing any previous entry with the same key.
+func (s *GeocodeCacheService) Set(ctx context.Context, entry *GeocodeCacheEntry) error {
+	entry.CreatedAt = time.Now()
+	_, err := s.Collection.ReplaceOne(ctx, bson.M{"_id": entry.Key}, entry, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestGeocodeCacheService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	database := client.Database(dbName)
+
+	// Initialize GeocodeCacheService
+	cache := NewGeocodeCacheService(&Database{
+		Client:   client,
+		Database: database,
+	})
+
+	// Missing keys are reported as no documents
+	_, err = cache.Get(ctx, "geocode:barcelona")
+	c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+
+	// Stored lookups are returned and can be replaced
+	err = cache.Set(ctx, &GeocodeCacheEntry{Key: "geocode:barcelona", Found: true, Latitude: 41385100, Longitude: 2173400})
+	c.Assert(err, qt.IsNil)
+	err = cache.Set(ctx, &GeocodeCacheEntry{
+		Key: "geocode:barcelona", Found: true, Latitude: 41385100, Longitude: 2173400, Locality: "Barcelona",
+	})
+	c.Assert(err, qt.IsNil)
+	entry, err := cache.Get(ctx, "geocode:barcelona")
+	c.Assert(err, qt.IsNil)
+	c.Assert(entry.Found, qt.IsTrue)
+	c.Assert(entry.Latitude, qt.Equals, int64(41385100))
+	c.Assert(entry.Locality, qt.Equals, "Barcelona")
+
+	// Negative lookups are cached too
+	c.Assert(cache.Set(ctx, &GeocodeCacheEntry{Key: "geocode:nowhere"}), qt.IsNil)
+	entry, err = cache.Get(ctx, "geocode:nowhere")
+	c.Assert(err, qt.IsNil)
+	c.Assert(entry.Found, qt.IsFalse)
+
+	// Entries older than the TTL are ignored
+	_, err = cache.Collection.UpdateOne(ctx, bson.M{"_id": "geocode:barcelona"},
+		bson.M{"$set": bson.M{"createdAt": time.Now().Add(-GeocodeCacheTTL - time.Hour)}})
+	c.Assert(err, qt.IsNil)
+	_, err = cache.Get(ctx, "geocode:barcelona")
+	c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+}
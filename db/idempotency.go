@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IdempotencyKey represents the schema for the "idempotency_keys" collection. It records the
+// first request sent by a user with an Idempotency-Key header, identified by ID ("<userID>:<key>"),
+// and its response once completed, so the retries of the request get the same response. The
+// documents are deleted by a TTL index once ExpiresAt is reached.
+type IdempotencyKey struct {
+	ID     string `bson:"_id"`
+	UserID string `bson:"userId"`
+	// Endpoint is the method and path of the request, i.e. "POST /bookings".
+	Endpoint string `bson:"endpoint"`
+	// RequestHash is the hash of the request body, the retries must send the same body.
+	RequestHash string `bson:"requestHash"`
+	Completed   bool   `bson:"completed"`
+	// Response is the JSON data of the response of a completed request.
+	Response  []byte    `bson:"response,omitempty"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// IdempotencyService provides methods to interact with the "idempotency_keys" collection.
+type IdempotencyService struct {
+	Collection *mongo.Collection
+}
+
+// NewIdempotencyService creates a new IdempotencyService.
+func NewIdempotencyService(db *Database) *IdempotencyService {
+	return &IdempotencyService{
+		Collection: db.Database.Collection("idempotency_keys"),
+	}
+}
+
+// Start records the key of a request being processed, and returns nil. If the key was already
+// used by a request not expired at the given time, it returns its record instead and the request
+// must not be processed again.
+func (s *IdempotencyService) Start(ctx context.Context, key *IdempotencyKey, now time.Time) (*IdempotencyKey, error) {
+	_, err := s.Collection.InsertOne(ctx, key)
+	if err == nil || !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+	var stored IdempotencyKey
+	err = s.Collection.FindOne(ctx, bson.M{"_id": key.ID}).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		// Deleted meanwhile
+		return s.Start(ctx, key, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.ExpiresAt.After(now) {
+		return &stored, nil
+	}
+	// The TTL index did not delete the expired key yet
+	if _, err := s.Collection.DeleteOne(ctx, bson.M{"_id": key.ID, "expiresAt": stored.ExpiresAt}); err != nil {
+		return nil, err
+	}
+	return s.Start(ctx, key, now)
+}
+
+// Complete stores the response of the request of the key, replayed to its retries until expiresAt.
+func (s *IdempotencyService) Complete(ctx context.Context, id string, response []byte, expiresAt time.Time) error {
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"completed": true, "response": response, "expiresAt": expiresAt}},
+	)
+	return err
+}
+
+// Release deletes the key of a request that was not completed, so it can be retried.
+func (s *IdempotencyService) Release(ctx context.Context, id string) error {
+	_, err := s.Collection.DeleteOne(ctx, bson.M{"_id": id, "completed": false})
+	return err
+}
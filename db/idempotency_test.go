@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestIdempotencyService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	c.Assert(EnsureIndexes(ctx, database), qt.IsNil)
+	service := NewIdempotencyService(database)
+
+	now := time.Now()
+	key := func(id string) *IdempotencyKey {
+		return &IdempotencyKey{
+			ID:          id,
+			UserID:      "user",
+			Endpoint:    "POST /bookings",
+			RequestHash: "hash",
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(time.Minute),
+		}
+	}
+
+	// The first request is processed, the retries get the record in progress
+	stored, err := service.Start(ctx, key("user:1"), now)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored, qt.IsNil)
+	stored, err = service.Start(ctx, key("user:1"), now)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored, qt.IsNotNil)
+	c.Assert(stored.Completed, qt.IsFalse)
+
+	// Once completed, the retries get the response
+	c.Assert(service.Complete(ctx, "user:1", []byte(`{"id":"1"}`), now.Add(24*time.Hour)), qt.IsNil)
+	stored, err = service.Start(ctx, key("user:1"), now.Add(time.Hour))
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored.Completed, qt.IsTrue)
+	c.Assert(string(stored.Response), qt.Equals, `{"id":"1"}`)
+	c.Assert(stored.Endpoint, qt.Equals, "POST /bookings")
+
+	// A completed key is not released
+	c.Assert(service.Release(ctx, "user:1"), qt.IsNil)
+	stored, err = service.Start(ctx, key("user:1"), now)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored, qt.IsNotNil)
+
+	// A released key can be used again
+	_, err = service.Start(ctx, key("user:2"), now)
+	c.Assert(err, qt.IsNil)
+	c.Assert(service.Release(ctx, "user:2"), qt.IsNil)
+	stored, err = service.Start(ctx, key("user:2"), now)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored, qt.IsNil)
+
+	// An expired key is replaced
+	stored, err = service.Start(ctx, key("user:1"), now.Add(25*time.Hour))
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored, qt.IsNil)
+	stored, err = service.Start(ctx, key("user:1"), now)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored.Completed, qt.IsFalse)
+}
@@ -2,11 +2,13 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/emprius/emprius-app-backend/types"
 	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Image represents the schema for the "images" collection.
@@ -15,6 +17,14 @@ type Image struct {
 	Name    string         `bson:"name" json:"name"`
 	Content []byte         `bson:"content" json:"content,omitempty"`
 	Link    string         `bson:"link" json:"link,omitempty"`
+	// CreatedAt is nil on the images added before it was introduced
+	CreatedAt *time.Time `bson:"createdAt,omitempty" json:"-"`
+	// UploadedAt is the last time the image was uploaded, the unreferenced images are kept for
+	// a grace period after it so they can be referenced by the tool or profile being edited.
+	UploadedAt *time.Time `bson:"uploadedAt,omitempty" json:"-"`
+	// Pending is set on the large images until they are processed in the background, their
+	// content is then the uploaded one and must not be served.
+	Pending bool `bson:"pending,omitempty" json:"pending,omitempty"`
 }
 
 // ImageService provides methods to interact with the "images" collection.
@@ -31,9 +41,23 @@ func NewImageService(db *Database) *ImageService {
 
 // InsertImage inserts a new Image document.
 func (s *ImageService) InsertImage(ctx context.Context, image *Image) (*mongo.InsertOneResult, error) {
+	if image.CreatedAt == nil {
+		now := time.Now()
+		image.CreatedAt = &now
+	}
+	if image.UploadedAt == nil {
+		image.UploadedAt = image.CreatedAt
+	}
 	return s.Collection.InsertOne(ctx, image)
 }
 
+// TouchImage records that the image with the given hash was uploaded again, so it is not
+// collected before it is referenced.
+func (s *ImageService) TouchImage(ctx context.Context, hash []byte, uploadedAt time.Time) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"hash": hash}, bson.M{"$set": bson.M{"uploadedAt": uploadedAt}})
+	return err
+}
+
 // GetImage retrieves an Image by its hash.
 func (s *ImageService) GetImage(ctx context.Context, hash []byte) (*Image, error) {
 	var image Image
@@ -45,6 +69,45 @@ func (s *ImageService) GetImage(ctx context.Context, hash []byte) (*Image, error
 	return &image, nil
 }
 
+// GetPendingImages returns the hashes of at most limit images pending to be processed, the
+// oldest first.
+func (s *ImageService) GetPendingImages(ctx context.Context, limit int64) ([]*Image, error) {
+	cursor, err := s.Collection.Find(ctx, bson.M{"pending": true}, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"hash": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var images []*Image
+	if err := cursor.All(ctx, &images); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// SetProcessedContent replaces the content of the pending image with the given hash by its
+// processed content.
+func (s *ImageService) SetProcessedContent(ctx context.Context, hash, content []byte) error {
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.M{"hash": hash, "pending": true},
+		bson.M{"$set": bson.M{"content": content}, "$unset": bson.M{"pending": ""}},
+	)
+	return err
+}
+
+// DeletePendingImage deletes the pending image with the given hash.
+func (s *ImageService) DeletePendingImage(ctx context.Context, hash []byte) error {
+	_, err := s.Collection.DeleteOne(ctx, bson.M{"hash": hash, "pending": true})
+	return err
+}
+
 // GetAllImages retrieves all Image documents.
 func (s *ImageService) GetAllImages(ctx context.Context) ([]*Image, error) {
 	cursor, err := s.Collection.Find(ctx, bson.M{})
@@ -67,3 +130,30 @@ func (s *ImageService) GetAllImages(ctx context.Context) ([]*Image, error) {
 	}
 	return images, nil
 }
+
+// TotalUsage returns the number of images and the bytes of their content.
+func (s *ImageService) TotalUsage(ctx context.Context) (images, bytes int64, err error) {
+	cursor, err := s.Collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":    nil,
+			"images": bson.M{"$sum": 1},
+			"bytes":  bson.M{"$sum": bson.M{"$binarySize": "$content"}},
+		}}},
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+	var totals []struct {
+		Images int64 `bson:"images"`
+		Bytes  int64 `bson:"bytes"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil || len(totals) == 0 {
+		return 0, 0, err
+	}
+	return totals[0].Images, totals[0].Bytes, nil
+}
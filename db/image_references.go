@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// imageReferences are the fields of the documents of each collection holding image hashes.
+var imageReferences = map[string][]string{
+	"tools":    {"images.hash"},
+	"bookings": {"disagreement.images.hash"},
+	"users":    {"avatarHash"},
+}
+
+// ReferencedImages returns the hashes of the images referenced by a tool, a booking
+// disagreement or a user avatar, in any of its sizes.
+func (d *Database) ReferencedImages(ctx context.Context) ([][]byte, error) {
+	seen := make(map[string]bool)
+	hashes := [][]byte{}
+	add := func(hash []byte) {
+		if len(hash) == 0 || seen[string(hash)] {
+			return
+		}
+		seen[string(hash)] = true
+		hashes = append(hashes, hash)
+	}
+	for collection, fields := range imageReferences {
+		for _, field := range fields {
+			values, err := d.Database.Collection(collection).Distinct(ctx, field, bson.M{})
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range values {
+				if binary, ok := value.(primitive.Binary); ok {
+					add(binary.Data)
+				}
+			}
+		}
+	}
+
+	// The resized avatars are a map of the size to the hash
+	cursor, err := d.Database.Collection("users").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"avatarSizes": bson.M{"$exists": true}}}},
+		{{Key: "$project", Value: bson.M{"sizes": bson.M{"$objectToArray": "$avatarSizes"}}}},
+		{{Key: "$unwind", Value: "$sizes"}},
+		{{Key: "$group", Value: bson.M{"_id": "$sizes.v"}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+	for cursor.Next(ctx) {
+		var size struct {
+			Hash []byte `bson:"_id"`
+		}
+		if err := cursor.Decode(&size); err != nil {
+			return nil, err
+		}
+		add(size.Hash)
+	}
+	return hashes, cursor.Err()
+}
+
+// DeleteOrphanImages deletes the images not referenced by any tool, booking or user, unless
+// they were uploaded after the given time, and returns how many were deleted.
+func (d *Database) DeleteOrphanImages(ctx context.Context, uploadedBefore time.Time) (int64, error) {
+	referenced, err := d.ReferencedImages(ctx)
+	if err != nil {
+		return 0, err
+	}
+	result, err := d.ImageService.Collection.DeleteMany(ctx, bson.M{
+		"hash": bson.M{"$nin": referenced},
+		// The images added before the times were introduced have none
+		"$nor": []bson.M{
+			{"uploadedAt": bson.M{"$gte": uploadedBefore}},
+			{"createdAt": bson.M{"$gte": uploadedBefore}},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// UserImageUsage is the storage used by the images referenced by a user, its avatar and the
+// images of its tools.
+type UserImageUsage struct {
+	UserID primitive.ObjectID `bson:"_id" json:"userId"`
+	Name   string             `bson:"name" json:"name"`
+	Images int64              `bson:"images" json:"images"`
+	Bytes  int64              `bson:"bytes" json:"bytes"`
+}
+
+// ImageUsage returns the storage used by the images of each user, the ones using the most
+// first. The images shared by several users count for each of them. Users without images are
+// not included.
+func (d *Database) ImageUsage(ctx context.Context) ([]*UserImageUsage, error) {
+	// The hashes of the avatar, its sizes and the tool images of the user
+	hashes := bson.M{"$setUnion": bson.A{
+		bson.M{"$reduce": bson.M{
+			"input":        "$tools.hashes",
+			"initialValue": bson.A{},
+			"in":           bson.M{"$concatArrays": bson.A{"$$value", "$$this"}},
+		}},
+		bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$avatarHash", nil}}, bson.A{"$avatarHash"}, bson.A{}}},
+		bson.M{"$map": bson.M{
+			"input": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$avatarSizes", bson.M{}}}},
+			"in":    "$$this.v",
+		}},
+	}}
+	cursor, err := d.Database.Collection("users").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "tools",
+			"localField":   "_id",
+			"foreignField": "userId",
+			"pipeline": bson.A{
+				bson.M{"$project": bson.M{"_id": 0, "hashes": bson.M{"$ifNull": bson.A{"$images.hash", bson.A{}}}}},
+			},
+			"as": "tools",
+		}}},
+		{{Key: "$project", Value: bson.M{"name": 1, "hashes": hashes}}},
+		{{Key: "$match", Value: bson.M{"hashes.0": bson.M{"$exists": true}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "images",
+			"localField":   "hashes",
+			"foreignField": "hash",
+			"pipeline": bson.A{
+				bson.M{"$project": bson.M{"_id": 0, "size": bson.M{"$binarySize": "$content"}}},
+			},
+			"as": "images",
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"name":   1,
+			"images": bson.M{"$size": "$images"},
+			"bytes":  bson.M{"$sum": "$images.size"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "bytes", Value: -1}, {Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	usage := []*UserImageUsage{}
+	if err := cursor.All(ctx, &usage); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
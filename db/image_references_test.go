@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/types"
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestImageReferences(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	database.ImageService = NewImageService(database)
+
+	old := time.Now().Add(-48 * time.Hour)
+	addImage := func(hash string, size int, uploadedAt *time.Time) {
+		_, err := database.ImageService.InsertImage(ctx, &Image{
+			Hash:       []byte(hash),
+			Content:    make([]byte, size),
+			CreatedAt:  uploadedAt,
+			UploadedAt: uploadedAt,
+		})
+		c.Assert(err, qt.IsNil)
+	}
+	addImage("tool", 10, &old)
+	addImage("avatar", 20, &old)
+	addImage("size", 5, &old)
+	addImage("disagreement", 1, &old)
+	addImage("orphan", 100, &old)
+	addImage("recent", 100, nil)
+	// Images added before the times were introduced have none
+	_, err = database.ImageService.Collection.InsertOne(ctx, bson.M{"hash": []byte("legacy"), "content": []byte{1}})
+	c.Assert(err, qt.IsNil)
+
+	owner := primitive.NewObjectID()
+	_, err = database.Database.Collection("users").InsertOne(ctx, &User{
+		ID:          owner,
+		Name:        "owner",
+		AvatarHash:  []byte("avatar"),
+		AvatarSizes: map[string]types.HexBytes{"64": []byte("size")},
+	})
+	c.Assert(err, qt.IsNil)
+	_, err = database.Database.Collection("users").InsertOne(ctx, &User{ID: primitive.NewObjectID(), Name: "empty"})
+	c.Assert(err, qt.IsNil)
+	_, err = database.Database.Collection("tools").InsertOne(ctx, &Tool{
+		ID:     1,
+		UserID: owner,
+		Images: []Image{{Hash: []byte("tool")}, {Hash: []byte("avatar")}},
+	})
+	c.Assert(err, qt.IsNil)
+	_, err = database.Database.Collection("bookings").InsertOne(ctx, &Booking{
+		Disagreement: &BookingDisagreement{Images: []Image{{Hash: []byte("disagreement")}}},
+	})
+	c.Assert(err, qt.IsNil)
+
+	referenced, err := database.ReferencedImages(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(referenced, qt.HasLen, 4)
+
+	// The images shared by the avatar and a tool count once
+	usage, err := database.ImageUsage(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(usage, qt.DeepEquals, []*UserImageUsage{{UserID: owner, Name: "owner", Images: 3, Bytes: 35}})
+	images, bytes, err := database.ImageService.TotalUsage(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(images, qt.Equals, int64(7))
+	c.Assert(bytes, qt.Equals, int64(237))
+
+	// The unreferenced images are deleted after the grace period
+	deleted, err := database.DeleteOrphanImages(ctx, time.Now().Add(-24*time.Hour))
+	c.Assert(err, qt.IsNil)
+	c.Assert(deleted, qt.Equals, int64(2))
+	_, err = database.ImageService.GetImage(ctx, []byte("orphan"))
+	c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+	_, err = database.ImageService.GetImage(ctx, []byte("recent"))
+	c.Assert(err, qt.IsNil)
+
+	// Uploading an image again restarts its grace period
+	addImage("reused", 1, &old)
+	c.Assert(database.ImageService.TouchImage(ctx, []byte("reused"), time.Now()), qt.IsNil)
+	deleted, err = database.DeleteOrphanImages(ctx, time.Now().Add(-24*time.Hour))
+	c.Assert(err, qt.IsNil)
+	c.Assert(deleted, qt.Equals, int64(0))
+}
@@ -0,0 +1,717 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// namespaceNotFound is the error code returned when listing the indexes of a collection that
+// does not exist yet.
+const namespaceNotFound = 26
+
+// CollectionIndexes are the indexes defined for a collection.
+type CollectionIndexes struct {
+	Collection string
+	Indexes    []mongo.IndexModel
+}
+
+// MissingIndex is an index defined for a collection that does not exist in the database.
+type MissingIndex struct {
+	Collection string
+	Name       string
+}
+
+// String returns the index as collection.name.
+func (m MissingIndex) String() string {
+	return m.Collection + "." + m.Name
+}
+
+// IndexDefinitions are the indexes of every collection, created if missing at startup.
+var IndexDefinitions = []CollectionIndexes{
+	{
+		Collection: "users",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "email", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "name", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "trustUpdatedAt", Value: 1}, {Key: "_id", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "badgesUpdatedAt", Value: 1}, {Key: "_id", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "lastActiveAt", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "inactivityWarnedAt", Value: 1}},
+				Options: options.Index().
+					SetPartialFilterExpression(bson.M{"inactivityWarnedAt": bson.M{"$exists": true}}),
+			},
+			{
+				Keys: bson.D{{Key: "community", Value: 1}, {Key: "rating", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "active", Value: 1}, {Key: "rating", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "digest.unsubscribeToken", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"digest.unsubscribeToken": bson.M{"$type": "string"}}),
+			},
+			{
+				Keys: bson.D{{Key: "telegram.linkToken", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"telegram.linkToken": bson.M{"$type": "string"}}),
+			},
+			{
+				// Users without location are not indexed
+				Keys: bson.D{{Key: "location", Value: "2dsphere"}},
+				Options: options.Index().
+					SetPartialFilterExpression(bson.M{"location.type": "Point"}),
+			},
+		},
+	},
+	{
+		Collection: "images",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "hash", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "pending", Value: 1}, {Key: "createdAt", Value: 1}},
+				Options: options.Index().SetPartialFilterExpression(bson.M{"pending": true}),
+			},
+		},
+	},
+	{
+		Collection: "media",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "hash", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+	},
+	{
+		Collection: "transports",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "name", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+	},
+	{
+		Collection: "tool_categories",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "name", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+	},
+	{
+		Collection: "tools",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "userId", Value: 1}},
+			},
+			{
+				Keys:    bson.D{{Key: "title", Value: "text"}},
+				Options: options.Index().SetDefaultLanguage("none").SetLanguageOverride("none"),
+			},
+			{
+				Keys: bson.D{
+					{Key: "toolCategory", Value: 1},
+					{Key: "cost", Value: 1},
+					{Key: "mayBeFree", Value: 1},
+				},
+			},
+			{
+				Keys: bson.D{{Key: "transportOptions.id", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "location", Value: "2dsphere"}},
+			},
+			{
+				// For the searches sorted by rating
+				Keys: bson.D{
+					{Key: "ratingAverage", Value: -1},
+					{Key: "ratingCount", Value: -1},
+					{Key: "_id", Value: 1},
+				},
+			},
+			{
+				// For the new tools of the digests
+				Keys: bson.D{{Key: "createdAt", Value: -1}},
+			},
+			{
+				// For the community tools pending approval
+				Keys:    bson.D{{Key: "community", Value: 1}, {Key: "createdAt", Value: 1}},
+				Options: options.Index().SetPartialFilterExpression(bson.M{"pendingApproval": true}),
+			},
+			{
+				Keys:    bson.D{{Key: "managers", Value: 1}},
+				Options: options.Index().SetSparse(true),
+			},
+			{
+				// For the searches sorted by popularity
+				Keys: bson.D{
+					{Key: "popularity", Value: -1},
+					{Key: "_id", Value: 1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "userId", Value: 1},
+					{Key: "serialNumber", Value: 1},
+				},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"serialNumber": bson.M{"$type": "string"}}),
+			},
+			{
+				Keys: bson.D{
+					{Key: "userId", Value: 1},
+					{Key: "assetTag", Value: 1},
+				},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"assetTag": bson.M{"$type": "string"}}),
+			},
+			{
+				// The asset tags of a community library are scanned to check out its tools
+				Keys: bson.D{
+					{Key: "community", Value: 1},
+					{Key: "assetTag", Value: 1},
+				},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+					"community": bson.M{"$type": "string"},
+					"assetTag":  bson.M{"$type": "string"},
+				}),
+			},
+			{
+				Keys:    bson.D{{Key: "serialNumber", Value: 1}},
+				Options: options.Index().SetSparse(true),
+			},
+		},
+	},
+	{
+		Collection: "tool_reports",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "toolId", Value: 1},
+					{Key: "resolved", Value: 1},
+				},
+			},
+			{
+				Keys: bson.D{{Key: "serialNumber", Value: 1}},
+				Options: options.Index().
+					SetCollation(&options.Collation{Locale: "en", Strength: 2}).
+					SetSparse(true),
+			},
+		},
+	},
+	{
+		Collection: "bookings",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "toolId", Value: 1},
+					{Key: "startDate", Value: 1},
+					{Key: "endDate", Value: 1},
+				},
+			},
+			{
+				// For the date conflicts with the accepted bookings of a tool
+				Keys: bson.D{
+					{Key: "toolId", Value: 1},
+					{Key: "bookingStatus", Value: 1},
+					{Key: "startDate", Value: 1},
+					{Key: "endDate", Value: 1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "fromUserId", Value: 1},
+					{Key: "createdAt", Value: -1}, // For efficient sorting by date
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "toUserId", Value: 1},
+					{Key: "createdAt", Value: -1}, // For efficient sorting by date
+				},
+			},
+			{
+				// For the booking lists sorted by start date
+				Keys: bson.D{
+					{Key: "fromUserId", Value: 1},
+					{Key: "startDate", Value: -1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "toUserId", Value: 1},
+					{Key: "startDate", Value: -1},
+				},
+			},
+			{
+				// For the booking lists filtered by status
+				Keys: bson.D{
+					{Key: "fromUserId", Value: 1},
+					{Key: "bookingStatus", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "toUserId", Value: 1},
+					{Key: "bookingStatus", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "disagreement.status", Value: 1},
+					{Key: "disagreement.deadline", Value: 1},
+				},
+				Options: options.Index().SetSparse(true),
+			},
+			{
+				// For the payment webhook notifications
+				Keys: bson.D{
+					{Key: "payment.provider", Value: 1},
+					{Key: "payment.id", Value: 1},
+				},
+				Options: options.Index().SetSparse(true),
+			},
+			{
+				// For the booking reminders
+				Keys: bson.D{
+					{Key: "bookingStatus", Value: 1},
+					{Key: "startDate", Value: 1},
+				},
+			},
+			{
+				// For the origin attribution of the recent bookings
+				Keys: bson.D{{Key: "createdAt", Value: -1}},
+			},
+			{
+				// For the bookings of the shared community tools
+				Keys: bson.D{
+					{Key: "community", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+				Options: options.Index().SetSparse(true),
+			},
+		},
+	},
+	{
+		Collection: "notifications",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "userId", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+		},
+	},
+	{
+		Collection: "saved_searches",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "userId", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "categories", Value: 1}},
+			},
+		},
+	},
+	{
+		Collection: "favorites",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "userId", Value: 1},
+					{Key: "toolId", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "toolId", Value: 1}},
+			},
+		},
+	},
+	{
+		Collection: "account_recoveries",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "userId", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "status", Value: 1},
+					{Key: "community", Value: 1},
+				},
+			},
+		},
+	},
+	{
+		// Expired lookups are removed by MongoDB
+		Collection: "geocode_cache",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "createdAt", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32(GeocodeCacheTTL.Seconds())),
+			},
+		},
+	},
+	{
+		Collection: "devices",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "token", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "userId", Value: 1}},
+			},
+		},
+	},
+	{
+		Collection: "posts",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "community", Value: 1},
+					{Key: "pinned", Value: -1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+		},
+	},
+	{
+		Collection: "post_comments",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "postId", Value: 1},
+					{Key: "createdAt", Value: 1},
+				},
+			},
+		},
+	},
+	{
+		Collection: "messages",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "conversation", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "fromUserId", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "toUserId", Value: 1},
+					{Key: "readAt", Value: 1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "bookingId", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+				Options: options.Index().
+					SetPartialFilterExpression(bson.M{"bookingId": bson.M{"$exists": true}}),
+			},
+		},
+	},
+	{
+		// Entries are removed by MongoDB once their dates start
+		Collection: "waitlist",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "toolId", Value: 1}, {Key: "userId", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "userId", Value: 1}},
+			},
+			{
+				Keys:    bson.D{{Key: "startDate", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	},
+	{
+		// Views are removed by MongoDB after ToolViewTTL
+		Collection: "tool_views",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "toolId", Value: 1},
+					{Key: "userId", Value: 1},
+					{Key: "day", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "createdAt", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32(ToolViewTTL.Seconds())),
+			},
+		},
+	},
+	{
+		Collection: "tool_transfers",
+		Indexes: []mongo.IndexModel{
+			{
+				// A tool has at most one pending transfer
+				Keys: bson.D{{Key: "toolId", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"status": TransferStatusPending}),
+			},
+			{
+				Keys: bson.D{{Key: "fromUserId", Value: 1}, {Key: "status", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "toUserId", Value: 1}, {Key: "status", Value: 1}},
+			},
+		},
+	},
+	{
+		Collection: "sessions",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "userId", Value: 1}, {Key: "lastSeenAt", Value: -1}},
+			},
+			{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	},
+	{
+		Collection: "tool_reservations",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	},
+	{
+		Collection: "login_attempts",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	},
+	{
+		Collection: "idempotency_keys",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	},
+	{
+		Collection: "audit_log",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "createdAt", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "createdAt", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "targetId", Value: 1}, {Key: "createdAt", Value: -1}},
+			},
+		},
+	},
+	{
+		Collection: "tool_maintenance_log",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "toolId", Value: 1},
+					{Key: "startDate", Value: -1},
+				},
+			},
+		},
+	},
+	{
+		Collection: "tool_valuations",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "toolId", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+		},
+	},
+	{
+		Collection: "invite_codes",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "code", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: "userId", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+			{
+				Keys:    bson.D{{Key: "usedBy", Value: 1}},
+				Options: options.Index().SetSparse(true),
+			},
+		},
+	},
+	{
+		Collection: "crowdfunds",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "community", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+		},
+	},
+	{
+		Collection: "community_pool",
+		Indexes: []mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "community", Value: 1},
+					{Key: "kind", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+			},
+		},
+	},
+}
+
+// indexName returns the name of the index, the one set in its options or else the default
+// name given by MongoDB (i.e. toolId_1_startDate_1).
+func indexName(index mongo.IndexModel) string {
+	if index.Options != nil && index.Options.Name != nil {
+		return *index.Options.Name
+	}
+	keys, _ := index.Keys.(bson.D)
+	parts := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		parts = append(parts, key.Key, fmt.Sprint(key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// indexNames returns the names of the indexes that exist in the collection.
+func indexNames(ctx context.Context, collection *mongo.Collection) (map[string]bool, error) {
+	names := make(map[string]bool)
+	specs, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Code == namespaceNotFound {
+			return names, nil
+		}
+		return nil, err
+	}
+	for _, spec := range specs {
+		names[spec.Name] = true
+	}
+	return names, nil
+}
+
+// MissingIndexes returns the defined indexes that do not exist in the database, without
+// creating them.
+func MissingIndexes(ctx context.Context, db *Database) ([]MissingIndex, error) {
+	missing := []MissingIndex{}
+	for _, definition := range IndexDefinitions {
+		existing, err := indexNames(ctx, db.Database.Collection(definition.Collection))
+		if err != nil {
+			return nil, fmt.Errorf("could not list the indexes of %s: %w", definition.Collection, err)
+		}
+		for _, index := range definition.Indexes {
+			if name := indexName(index); !existing[name] {
+				missing = append(missing, MissingIndex{Collection: definition.Collection, Name: name})
+			}
+		}
+	}
+	return missing, nil
+}
+
+// EnsureIndexes creates the defined indexes that do not exist in the database, and then
+// verifies that all of them exist.
+func EnsureIndexes(ctx context.Context, db *Database) error {
+	missing, err := MissingIndexes(ctx, db)
+	if err != nil {
+		return err
+	}
+	create := make(map[string]bool, len(missing))
+	for _, m := range missing {
+		create[m.String()] = true
+	}
+	total := 0
+	for _, definition := range IndexDefinitions {
+		collection := db.Database.Collection(definition.Collection)
+		for _, index := range definition.Indexes {
+			total++
+			name := MissingIndex{Collection: definition.Collection, Name: indexName(index)}.String()
+			if !create[name] {
+				continue
+			}
+			if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+				return fmt.Errorf("could not create index %s: %w", name, err)
+			}
+			log.Info().Msgf("created index %s", name)
+		}
+	}
+
+	missing, err = MissingIndexes(ctx, db)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing indexes after creating them: %v", missing)
+	}
+	log.Info().Msgf("verified %d indexes, %d created", total, len(create))
+	return nil
+}
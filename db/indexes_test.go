@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestIndexName(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(indexName(mongo.IndexModel{
+		Keys: bson.D{{Key: "toolId", Value: 1}, {Key: "createdAt", Value: -1}},
+	}), qt.Equals, "toolId_1_createdAt_-1")
+	c.Assert(indexName(mongo.IndexModel{
+		Keys: bson.D{{Key: "location", Value: "2dsphere"}},
+	}), qt.Equals, "location_2dsphere")
+	c.Assert(indexName(mongo.IndexModel{
+		Keys:    bson.D{{Key: "title", Value: "text"}},
+		Options: options.Index().SetName("search"),
+	}), qt.Equals, "search")
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil)
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil)
+	defer func() { _ = client.Disconnect(ctx) }()
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+
+	// Nothing exists in a new database
+	missing, err := MissingIndexes(ctx, database)
+	c.Assert(err, qt.IsNil)
+	total := 0
+	for _, definition := range IndexDefinitions {
+		total += len(definition.Indexes)
+	}
+	c.Assert(missing, qt.HasLen, total)
+
+	c.Assert(EnsureIndexes(ctx, database), qt.IsNil)
+	missing, err = MissingIndexes(ctx, database)
+	c.Assert(err, qt.IsNil)
+	c.Assert(missing, qt.HasLen, 0)
+
+	// Only the dropped index is reported and created again
+	_, err = database.Database.Collection("bookings").Indexes().DropOne(ctx, "toolId_1_bookingStatus_1_startDate_1_endDate_1")
+	c.Assert(err, qt.IsNil)
+	missing, err = MissingIndexes(ctx, database)
+	c.Assert(err, qt.IsNil)
+	c.Assert(missing, qt.DeepEquals, []MissingIndex{
+		{Collection: "bookings", Name: "toolId_1_bookingStatus_1_startDate_1_endDate_1"},
+	})
+	c.Assert(EnsureIndexes(ctx, database), qt.IsNil)
+}
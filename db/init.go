@@ -4,25 +4,29 @@ import (
 	"context"
 	"log"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Default categories and transports for initialization
-var defaultToolCategories = []string{
-	"other",
-	"transport",
-	"construction",
-	"agriculture",
-	"communication",
+var defaultToolCategories = []ToolCategory{
+	{ID: 1, Name: "other"},
+	{ID: 2, Name: "transport"},
+	{ID: 3, Name: "construction"},
+	{ID: 4, Name: "agriculture"},
+	{ID: 5, Name: "communication"},
+	{ID: 6, Name: "garden", ParentID: 4},
+	{ID: 7, Name: "mowers", ParentID: 6},
+	{ID: 8, Name: "power tools", ParentID: 3},
+	{ID: 9, Name: "ladders", ParentID: 3},
+	{ID: 10, Name: "trailers", ParentID: 2},
 }
 
-var defaultTransports = []string{
-	"Car",
-	"Van",
-	"Truck",
+var defaultTransports = []Transport{
+	{ID: 1, Name: "Car", Kind: TransportVehicle},
+	{ID: 2, Name: "Van", Kind: TransportVehicle},
+	{ID: 3, Name: "Truck", Kind: TransportVehicle},
+	{ID: 4, Name: "Pickup only", Kind: TransportPickup},
+	{ID: 5, Name: "Owner delivers", Kind: TransportDelivery},
+	{ID: 6, Name: "Cargo bike friendly", Kind: TransportCargoBike},
 }
 
 // InitializeDatabase sets up the database with default data and ensures collections are ready for use.
@@ -30,136 +34,49 @@ func InitializeDatabase(db *Database) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Create unique indexes
-	if err := createUniqueIndexes(db, ctx); err != nil {
+	// Create the missing indexes and verify all of them exist
+	if err := EnsureIndexes(ctx, db); err != nil {
+		log.Printf("Error creating indexes: %v\n", err)
 		return err
 	}
 
-	// Initialize Tool Categories
-	toolCategoryService := NewToolCategoryService(db)
-	err := toolCategoryService.InitializeDefaultCategories(ctx, defaultToolCategories)
+	// Move the height and weight of the old tools to their dimensions
+	migrated, err := NewToolService(db).MigrateToolDimensions(ctx)
 	if err != nil {
-		log.Printf("Error initializing tool categories: %v\n", err)
+		log.Printf("Error migrating the tool dimensions: %v\n", err)
 		return err
 	}
-	log.Println("Tool categories initialized.")
-
-	// Initialize Transports
-	transportService := NewTransportService(db)
-	for i, name := range defaultTransports {
-		_, err := transportService.InsertTransport(ctx, &Transport{
-			ID:   int64(i + 1),
-			Name: name,
-		})
-		if err != nil && !mongo.IsDuplicateKeyError(err) {
-			log.Printf("Error initializing transports: %v\n", err)
-			return err
-		}
-	}
-	log.Println("Transports initialized.")
-
-	return nil
-}
-
-// createUniqueIndexes creates all required unique indexes for collections
-func createUniqueIndexes(db *Database, ctx context.Context) error {
-	// User collection indexes
-	userColl := db.Database.Collection("users")
-	_, err := userColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{
-			Keys:    bson.D{{Key: "email", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-		{
-			Keys:    bson.D{{Key: "name", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-	})
-	if err != nil {
-		log.Printf("Error creating user indexes: %v\n", err)
-		return err
+	if migrated > 0 {
+		log.Printf("Migrated the dimensions of %d tools.\n", migrated)
 	}
 
-	// Image collection indexes
-	imageColl := db.Database.Collection("images")
-	_, err = imageColl.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys:    bson.D{{Key: "hash", Value: 1}},
-		Options: options.Index().SetUnique(true),
-	})
+	// Keep the community tools restricted to their community, the others public
+	migrated, err = NewToolService(db).MigrateToolVisibility(ctx)
 	if err != nil {
-		log.Printf("Error creating image indexes: %v\n", err)
+		log.Printf("Error migrating the tool visibility: %v\n", err)
 		return err
 	}
-
-	// Transport collection indexes
-	transportColl := db.Database.Collection("transports")
-	_, err = transportColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{
-			Keys:    bson.D{{Key: "id", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-		{
-			Keys:    bson.D{{Key: "name", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-	})
-	if err != nil {
-		log.Printf("Error creating transport indexes: %v\n", err)
-		return err
+	if migrated > 0 {
+		log.Printf("Migrated the visibility of %d tools.\n", migrated)
 	}
 
-	// Tool category collection indexes
-	toolCategoryColl := db.Database.Collection("tool_categories")
-	_, err = toolCategoryColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{
-			Keys:    bson.D{{Key: "id", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-		{
-			Keys:    bson.D{{Key: "name", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-	})
+	// Initialize Tool Categories
+	toolCategoryService := NewToolCategoryService(db)
+	err = toolCategoryService.InitializeDefaultCategories(ctx, defaultToolCategories)
 	if err != nil {
-		log.Printf("Error creating tool category indexes: %v\n", err)
+		log.Printf("Error initializing tool categories: %v\n", err)
 		return err
 	}
+	log.Println("Tool categories initialized.")
 
-	// Tool collection indexes
-	toolColl := db.Database.Collection("tools")
-	_, err = toolColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{
-			Keys:    bson.D{{Key: "userId", Value: 1}},
-			Options: options.Index(),
-		},
-		{
-			Keys:    bson.D{{Key: "title", Value: "text"}},
-			Options: options.Index().SetDefaultLanguage("none").SetLanguageOverride("none"),
-		},
-		{
-			Keys: bson.D{
-				{Key: "toolCategory", Value: 1},
-				{Key: "cost", Value: 1},
-				{Key: "mayBeFree", Value: 1},
-			},
-			Options: options.Index(),
-		},
-		{
-			Keys: bson.D{
-				{Key: "transportOptions.id", Value: 1},
-			},
-			Options: options.Index(),
-		},
-		{
-			Keys:    bson.D{{Key: "location", Value: "2dsphere"}},
-			Options: options.Index(),
-		},
-	})
+	// Initialize Transports
+	transportService := NewTransportService(db)
+	err = transportService.InitializeDefaultTransports(ctx, defaultTransports)
 	if err != nil {
-		log.Printf("Error creating tool indexes: %v\n", err)
+		log.Printf("Error initializing transports: %v\n", err)
 		return err
 	}
+	log.Println("Transports initialized.")
 
-	log.Println("All indexes created successfully")
 	return nil
 }
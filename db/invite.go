@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InviteStatus is the status of an invite code.
+type InviteStatus string
+
+const (
+	InviteStatusUnused  InviteStatus = "UNUSED"
+	InviteStatusUsed    InviteStatus = "USED"
+	InviteStatusRevoked InviteStatus = "REVOKED"
+)
+
+// InviteCode represents the schema for the "invite_codes" collection. Each code lets one new
+// user register, and links the new user to the inviter. Codes with a community add the new
+// user to it.
+type InviteCode struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Code      string              `bson:"code" json:"code"`
+	UserID    primitive.ObjectID  `bson:"userId" json:"userId"`
+	Community string              `bson:"community,omitempty" json:"community,omitempty"`
+	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`
+	UsedBy    *primitive.ObjectID `bson:"usedBy,omitempty" json:"usedBy,omitempty"`
+	UsedAt    *time.Time          `bson:"usedAt,omitempty" json:"usedAt,omitempty"`
+	RevokedAt *time.Time          `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+// Status returns the status of the invite code.
+func (i *InviteCode) Status() InviteStatus {
+	switch {
+	case i.UsedBy != nil:
+		return InviteStatusUsed
+	case i.RevokedAt != nil:
+		return InviteStatusRevoked
+	default:
+		return InviteStatusUnused
+	}
+}
+
+// unusedInvite adds to the filter the conditions of the codes that can still be used.
+func unusedInvite(filter bson.M) bson.M {
+	filter["usedBy"] = bson.M{"$exists": false}
+	filter["revokedAt"] = bson.M{"$exists": false}
+	return filter
+}
+
+// InviteService provides methods to interact with the "invite_codes" collection.
+type InviteService struct {
+	Collection *mongo.Collection
+}
+
+// NewInviteService creates a new InviteService.
+func NewInviteService(db *Database) *InviteService {
+	return &InviteService{
+		Collection: db.Database.Collection("invite_codes"),
+	}
+}
+
+// InsertInvite inserts a new InviteCode document.
+func (s *InviteService) InsertInvite(ctx context.Context, invite *InviteCode) error {
+	if invite.CreatedAt.IsZero() {
+		invite.CreatedAt = time.Now()
+	}
+	result, err := s.Collection.InsertOne(ctx, invite)
+	if err != nil {
+		return err
+	}
+	invite.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetUserInvites gets all the invite codes created by a user, newest first.
+func (s *InviteService) GetUserInvites(ctx context.Context, userID primitive.ObjectID) ([]*InviteCode, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	return s.find(ctx, bson.M{"userId": userID}, opts)
+}
+
+// GetUsedInvites gets all the invite codes used to register, oldest first.
+func (s *InviteService) GetUsedInvites(ctx context.Context) ([]*InviteCode, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "usedAt", Value: 1}})
+	return s.find(ctx, bson.M{"usedBy": bson.M{"$exists": true}}, opts)
+}
+
+// UseInvite marks an unused invite code as used by the user. It returns mongo.ErrNoDocuments
+// if the code does not exist, or was already used or revoked.
+func (s *InviteService) UseInvite(ctx context.Context, code string, userID primitive.ObjectID) (*InviteCode, error) {
+	filter := unusedInvite(bson.M{"code": code})
+	update := bson.M{"$set": bson.M{"usedBy": userID, "usedAt": time.Now()}}
+	var invite InviteCode
+	err := s.Collection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&invite)
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// ReleaseInvite makes an invite code used by the user unused again, when the registration
+// could not be completed.
+func (s *InviteService) ReleaseInvite(ctx context.Context, code string, userID primitive.ObjectID) error {
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.M{"code": code, "usedBy": userID},
+		bson.M{"$unset": bson.M{"usedBy": "", "usedAt": ""}})
+	return err
+}
+
+// RevokeInvite revokes an unused invite code of a user. It returns mongo.ErrNoDocuments if
+// the user has no such unused code.
+func (s *InviteService) RevokeInvite(ctx context.Context, userID primitive.ObjectID, code string) error {
+	filter := unusedInvite(bson.M{"code": code, "userId": userID})
+	result, err := s.Collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteUnusedInvites deletes the invite codes of a user that were not used. The used ones
+// are kept as they link the users the user invited.
+func (s *InviteService) DeleteUnusedInvites(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{
+		"userId": userID,
+		"usedBy": bson.M{"$exists": false},
+	})
+	return err
+}
+
+func (s *InviteService) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]*InviteCode, error) {
+	cursor, err := s.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	invites := []*InviteCode{}
+	if err := cursor.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
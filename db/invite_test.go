@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestInviteService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	database := &Database{
+		Client:   client,
+		Database: client.Database(dbName),
+	}
+	inviteService := NewInviteService(database)
+
+	now := time.Now()
+	inviter := primitive.NewObjectID()
+	invites := []*InviteCode{
+		{Code: "AAAA", UserID: inviter, CreatedAt: now.Add(-2 * time.Hour)},
+		{Code: "BBBB", UserID: inviter, CreatedAt: now.Add(-time.Hour)},
+		{Code: "CCCC", UserID: inviter, CreatedAt: now},
+	}
+	for _, i := range invites {
+		c.Assert(inviteService.InsertInvite(ctx, i), qt.IsNil)
+		c.Assert(i.ID.IsZero(), qt.IsFalse)
+		c.Assert(i.Status(), qt.Equals, InviteStatusUnused)
+	}
+
+	// Newest first
+	userInvites, err := inviteService.GetUserInvites(ctx, inviter)
+	c.Assert(err, qt.IsNil)
+	c.Assert(userInvites, qt.HasLen, 3)
+	c.Assert(userInvites[0].Code, qt.Equals, "CCCC")
+	c.Assert(userInvites[2].Code, qt.Equals, "AAAA")
+
+	// A code can only be used once
+	invitee := primitive.NewObjectID()
+	used, err := inviteService.UseInvite(ctx, "AAAA", invitee)
+	c.Assert(err, qt.IsNil)
+	c.Assert(used.Status(), qt.Equals, InviteStatusUsed)
+	c.Assert(*used.UsedBy, qt.Equals, invitee)
+	_, err = inviteService.UseInvite(ctx, "AAAA", primitive.NewObjectID())
+	c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+	_, err = inviteService.UseInvite(ctx, "XXXX", primitive.NewObjectID())
+	c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+
+	// A released code can be used again
+	other := primitive.NewObjectID()
+	_, err = inviteService.UseInvite(ctx, "BBBB", other)
+	c.Assert(err, qt.IsNil)
+	c.Assert(inviteService.ReleaseInvite(ctx, "BBBB", other), qt.IsNil)
+	_, err = inviteService.UseInvite(ctx, "BBBB", other)
+	c.Assert(err, qt.IsNil)
+
+	// Only the unused codes of the user can be revoked
+	c.Assert(inviteService.RevokeInvite(ctx, inviter, "AAAA"), qt.Equals, mongo.ErrNoDocuments)
+	c.Assert(inviteService.RevokeInvite(ctx, invitee, "CCCC"), qt.Equals, mongo.ErrNoDocuments)
+	c.Assert(inviteService.RevokeInvite(ctx, inviter, "CCCC"), qt.IsNil)
+	_, err = inviteService.UseInvite(ctx, "CCCC", primitive.NewObjectID())
+	c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+
+	// Used codes, oldest first
+	usedInvites, err := inviteService.GetUsedInvites(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(usedInvites, qt.HasLen, 2)
+	c.Assert(usedInvites[0].Code, qt.Equals, "AAAA")
+	c.Assert(usedInvites[1].Code, qt.Equals, "BBBB")
+
+	// The used codes are kept
+	c.Assert(inviteService.DeleteUnusedInvites(ctx, inviter), qt.IsNil)
+	userInvites, err = inviteService.GetUserInvites(ctx, inviter)
+	c.Assert(err, qt.IsNil)
+	c.Assert(userInvites, qt.HasLen, 2)
+	for _, i := range userInvites {
+		c.Assert(i.Status(), qt.Equals, InviteStatusUsed)
+	}
+}
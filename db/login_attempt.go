@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttempts represents the schema for the "login_attempts" collection. It counts the
+// consecutive failed logins of an account or an IP, identified by Key (i.e. "email:<email>" or
+// "ip:<ip>"). The documents are deleted by a TTL index once ExpiresAt is reached, which resets
+// the count.
+type LoginAttempts struct {
+	Key           string     `bson:"_id"`
+	Failures      int        `bson:"failures"`
+	LastFailureAt time.Time  `bson:"lastFailureAt"`
+	LockedUntil   *time.Time `bson:"lockedUntil,omitempty"`
+	ExpiresAt     time.Time  `bson:"expiresAt"`
+}
+
+// LoginAttemptService provides methods to interact with the "login_attempts" collection.
+type LoginAttemptService struct {
+	Collection *mongo.Collection
+}
+
+// NewLoginAttemptService creates a new LoginAttemptService.
+func NewLoginAttemptService(db *Database) *LoginAttemptService {
+	return &LoginAttemptService{
+		Collection: db.Database.Collection("login_attempts"),
+	}
+}
+
+// LockedUntil returns the latest end of the lockouts of the keys after the given time, or the
+// zero time if none of them is locked.
+func (s *LoginAttemptService) LockedUntil(ctx context.Context, now time.Time, keys ...string) (time.Time, error) {
+	var attempts LoginAttempts
+	err := s.Collection.FindOne(ctx,
+		bson.M{"_id": bson.M{"$in": keys}, "lockedUntil": bson.M{"$gt": now}},
+		options.FindOne().SetSort(bson.D{{Key: "lockedUntil", Value: -1}}),
+	).Decode(&attempts)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return *attempts.LockedUntil, nil
+}
+
+// RecordFailure counts a failed login of the key, kept until expiresAt at least, and returns the
+// number of consecutive failures.
+func (s *LoginAttemptService) RecordFailure(ctx context.Context, key string, now, expiresAt time.Time) (int, error) {
+	var attempts LoginAttempts
+	err := s.Collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{
+			"$inc": bson.M{"failures": 1},
+			"$set": bson.M{"lastFailureAt": now},
+			"$max": bson.M{"expiresAt": expiresAt},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempts)
+	if err != nil {
+		return 0, err
+	}
+	return attempts.Failures, nil
+}
+
+// Lock rejects the logins of the key until the given time, keeping its failures until expiresAt.
+func (s *LoginAttemptService) Lock(ctx context.Context, key string, until, expiresAt time.Time) error {
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": key},
+		bson.M{"$set": bson.M{"lockedUntil": until}, "$max": bson.M{"expiresAt": expiresAt}},
+	)
+	return err
+}
+
+// Reset deletes the failures of the key, after a successful login.
+func (s *LoginAttemptService) Reset(ctx context.Context, key string) error {
+	_, err := s.Collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
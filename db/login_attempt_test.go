@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestLoginAttemptService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	c.Assert(EnsureIndexes(ctx, database), qt.IsNil)
+	service := NewLoginAttemptService(database)
+
+	now := time.Now().Truncate(time.Millisecond)
+	for i := 1; i <= 3; i++ {
+		failures, err := service.RecordFailure(ctx, "email:foo@test.com", now, now.Add(time.Hour))
+		c.Assert(err, qt.IsNil)
+		c.Assert(failures, qt.Equals, i)
+	}
+	until, err := service.LockedUntil(ctx, now, "email:foo@test.com", "ip:10.0.0.1")
+	c.Assert(err, qt.IsNil)
+	c.Assert(until.IsZero(), qt.IsTrue)
+
+	// The latest lockout of the keys is returned while not over
+	_, err = service.RecordFailure(ctx, "ip:10.0.0.1", now, now.Add(time.Hour))
+	c.Assert(err, qt.IsNil)
+	c.Assert(service.Lock(ctx, "email:foo@test.com", now.Add(time.Minute), now.Add(2*time.Hour)), qt.IsNil)
+	c.Assert(service.Lock(ctx, "ip:10.0.0.1", now.Add(time.Hour), now.Add(2*time.Hour)), qt.IsNil)
+	until, err = service.LockedUntil(ctx, now, "email:foo@test.com", "ip:10.0.0.1")
+	c.Assert(err, qt.IsNil)
+	c.Assert(until.Equal(now.Add(time.Hour)), qt.IsTrue)
+	until, err = service.LockedUntil(ctx, now.Add(2*time.Minute), "email:foo@test.com")
+	c.Assert(err, qt.IsNil)
+	c.Assert(until.IsZero(), qt.IsTrue)
+
+	// A reset starts counting again
+	c.Assert(service.Reset(ctx, "email:foo@test.com"), qt.IsNil)
+	failures, err := service.RecordFailure(ctx, "email:foo@test.com", now, now.Add(time.Hour))
+	c.Assert(err, qt.IsNil)
+	c.Assert(failures, qt.Equals, 1)
+}
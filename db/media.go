@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MediaType is the kind of a media attachment of a tool.
+type MediaType string
+
+const (
+	// MediaVideo is a short video showing the tool.
+	MediaVideo MediaType = "video"
+	// MediaDocument is a document about the tool, i.e. its PDF manual.
+	MediaDocument MediaType = "document"
+)
+
+// Media represents the schema for the "media" collection, the content of the video and
+// document attachments of the tools. Like the images, the media are addressed by the hash of
+// their content.
+type Media struct {
+	Hash     types.HexBytes `bson:"hash" json:"hash"`
+	Type     MediaType      `bson:"type" json:"type"`
+	MimeType string         `bson:"mimeType" json:"mimeType"`
+	Size     int64          `bson:"size" json:"size"`
+	Content  []byte         `bson:"content" json:"-"`
+	// CreatedAt is the time the media was uploaded first
+	CreatedAt time.Time `bson:"createdAt" json:"-"`
+}
+
+// ToolMedia is a media attachment of a tool, its content is in the "media" collection.
+type ToolMedia struct {
+	Hash     types.HexBytes `bson:"hash" json:"hash"`
+	Name     string         `bson:"name" json:"name"`
+	Type     MediaType      `bson:"type" json:"type"`
+	MimeType string         `bson:"mimeType" json:"mimeType"`
+	Size     int64          `bson:"size" json:"size"`
+}
+
+// MediaService provides methods to interact with the "media" collection.
+type MediaService struct {
+	Collection *mongo.Collection
+}
+
+// NewMediaService creates a new MediaService.
+func NewMediaService(db *Database) *MediaService {
+	return &MediaService{
+		Collection: db.Database.Collection("media"),
+	}
+}
+
+// InsertMedia inserts the media, unless there is already one with its hash.
+func (s *MediaService) InsertMedia(ctx context.Context, media *Media) error {
+	if media.CreatedAt.IsZero() {
+		media.CreatedAt = time.Now()
+	}
+	_, err := s.Collection.InsertOne(ctx, media)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// GetMedia retrieves the media with the given hash.
+func (s *MediaService) GetMedia(ctx context.Context, hash []byte) (*Media, error) {
+	var media Media
+	if err := s.Collection.FindOne(ctx, bson.M{"hash": hash}).Decode(&media); err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// DeleteOrphanMedia deletes the media not attached to any tool, unless they were uploaded
+// after the given time, and returns how many were deleted.
+func (d *Database) DeleteOrphanMedia(ctx context.Context, uploadedBefore time.Time) (int64, error) {
+	values, err := d.ToolService.Collection.Distinct(ctx, "media.hash", bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	referenced := [][]byte{}
+	for _, value := range values {
+		if binary, ok := value.(primitive.Binary); ok {
+			referenced = append(referenced, binary.Data)
+		}
+	}
+	result, err := d.MediaService.Collection.DeleteMany(ctx, bson.M{
+		"hash":      bson.M{"$nin": referenced},
+		"createdAt": bson.M{"$lt": uploadedBefore},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// AddMedia attaches the media to the tool, unless it is already attached.
+func (s *ToolService) AddMedia(ctx context.Context, id int64, media *ToolMedia) error {
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "media.hash": bson.M{"$ne": media.Hash}},
+		touchTool(bson.M{"$push": bson.M{"media": media}}),
+	)
+	return err
+}
+
+// RemoveMedia detaches the media with the given hash from the tool, and returns false if it
+// was not attached.
+func (s *ToolService) RemoveMedia(ctx context.Context, id int64, hash []byte) (bool, error) {
+	result, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "media.hash": hash},
+		touchTool(bson.M{"$pull": bson.M{"media": bson.M{"hash": hash}}}),
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMedia(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	database.ToolService = NewToolService(database)
+	database.MediaService = NewMediaService(database)
+	c.Assert(EnsureIndexes(ctx, database), qt.IsNil)
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, hash := range []string{"manual", "video", "orphan"} {
+		c.Assert(database.MediaService.InsertMedia(ctx, &Media{
+			Hash:      []byte(hash),
+			Type:      MediaDocument,
+			MimeType:  "application/pdf",
+			Size:      3,
+			Content:   []byte{1, 2, 3},
+			CreatedAt: old,
+		}), qt.IsNil)
+	}
+	// Uploading the same media again is not an error
+	c.Assert(database.MediaService.InsertMedia(ctx, &Media{Hash: []byte("manual")}), qt.IsNil)
+	c.Assert(database.MediaService.InsertMedia(ctx, &Media{Hash: []byte("recent")}), qt.IsNil)
+	media, err := database.MediaService.GetMedia(ctx, []byte("manual"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(media.Content, qt.DeepEquals, []byte{1, 2, 3})
+
+	_, err = database.ToolService.Collection.InsertOne(ctx, &Tool{ID: 1, UserID: primitive.NewObjectID()})
+	c.Assert(err, qt.IsNil)
+	for _, hash := range []string{"manual", "video", "manual"} {
+		c.Assert(database.ToolService.AddMedia(ctx, 1, &ToolMedia{Hash: []byte(hash), Name: hash}), qt.IsNil)
+	}
+	tool, err := database.ToolService.GetToolByID(ctx, 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tool.Media, qt.HasLen, 2)
+	c.Assert(tool.UpdatedAt, qt.IsNotNil)
+
+	removed, err := database.ToolService.RemoveMedia(ctx, 1, []byte("video"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(removed, qt.IsTrue)
+	removed, err = database.ToolService.RemoveMedia(ctx, 1, []byte("video"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(removed, qt.IsFalse)
+
+	// The detached media are deleted after the grace period
+	deleted, err := database.DeleteOrphanMedia(ctx, time.Now().Add(-24*time.Hour))
+	c.Assert(err, qt.IsNil)
+	c.Assert(deleted, qt.Equals, int64(2))
+	_, err = database.MediaService.GetMedia(ctx, []byte("video"))
+	c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+	_, err = database.MediaService.GetMedia(ctx, []byte("recent"))
+	c.Assert(err, qt.IsNil)
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Message represents the schema for the "messages" collection, the direct messages between
+// two users.
+type Message struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	// Conversation identifies the conversation of the two users, see ConversationID.
+	Conversation string             `bson:"conversation" json:"conversation"`
+	FromUserID   primitive.ObjectID `bson:"fromUserId" json:"fromUserId"`
+	ToUserID     primitive.ObjectID `bson:"toUserId" json:"toUserId"`
+	Text         string             `bson:"text" json:"text"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	// ReadAt is when the recipient read the message, nil while unread.
+	ReadAt *time.Time `bson:"readAt,omitempty" json:"readAt,omitempty"`
+	// Refs are the tools, bookings and users referenced by the text.
+	Refs []EntityRef `bson:"refs,omitempty" json:"refs,omitempty"`
+	// BookingID is the booking the message is about, if sent in its thread.
+	BookingID *primitive.ObjectID `bson:"bookingId,omitempty" json:"bookingId,omitempty"`
+	// ViaEmail is true if the message was received as a reply to a notification email.
+	ViaEmail bool `bson:"viaEmail,omitempty" json:"viaEmail,omitempty"`
+}
+
+// Conversation is the summary of the conversation of a user with another user.
+type Conversation struct {
+	// UserID is the other user of the conversation.
+	UserID      primitive.ObjectID `bson:"_id"`
+	LastMessage *Message           `bson:"lastMessage"`
+	// Unread is the number of messages of the other user not read yet.
+	Unread int64 `bson:"unread"`
+}
+
+// ConversationID returns the identifier of the conversation between two users, the same
+// whoever sends the message.
+func ConversationID(a, b primitive.ObjectID) string {
+	if a.Hex() > b.Hex() {
+		a, b = b, a
+	}
+	return a.Hex() + "-" + b.Hex()
+}
+
+// MessageService provides methods to interact with the "messages" collection.
+type MessageService struct {
+	Collection *mongo.Collection
+}
+
+// NewMessageService creates a new MessageService.
+func NewMessageService(db *Database) *MessageService {
+	return &MessageService{
+		Collection: db.Database.Collection("messages"),
+	}
+}
+
+// InsertMessage inserts a new Message document.
+func (s *MessageService) InsertMessage(ctx context.Context, m *Message) error {
+	m.Conversation = ConversationID(m.FromUserID, m.ToUserID)
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	result, err := s.Collection.InsertOne(ctx, m)
+	if err != nil {
+		return err
+	}
+	m.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetConversations retrieves a page of the conversations of the user, the one with the most
+// recent message first.
+func (s *MessageService) GetConversations(ctx context.Context, userID primitive.ObjectID, page int) ([]*Conversation, error) {
+	if page < 0 {
+		page = 0
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": bson.A{bson.M{"fromUserId": userID}, bson.M{"toUserId": userID}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":         bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$fromUserId", userID}}, "$toUserId", "$fromUserId"}},
+			"lastMessage": bson.M{"$first": "$$ROOT"},
+			"unread": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{bson.M{"$eq": bson.A{"$toUserId", userID}}, bson.M{"$not": bson.A{"$readAt"}}}},
+				1, 0,
+			}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "lastMessage.createdAt", Value: -1}, {Key: "lastMessage._id", Value: -1}}}},
+		{{Key: "$skip", Value: int64(page * DefaultPageSize)}},
+		{{Key: "$limit", Value: int64(DefaultPageSize)}},
+	}
+	cursor, err := s.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	conversations := []*Conversation{}
+	if err := cursor.All(ctx, &conversations); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// GetMessages retrieves a page of the messages between the two users, newest first.
+func (s *MessageService) GetMessages(ctx context.Context, userID, otherID primitive.ObjectID, page int) ([]*Message, error) {
+	if page < 0 {
+		page = 0
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(page * DefaultPageSize)).
+		SetLimit(int64(DefaultPageSize))
+	cursor, err := s.Collection.Find(ctx, bson.M{"conversation": ConversationID(userID, otherID)}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	messages := []*Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// GetBookingMessages retrieves a page of the messages of the thread of the booking, newest first.
+func (s *MessageService) GetBookingMessages(ctx context.Context, bookingID primitive.ObjectID, page int) ([]*Message, error) {
+	if page < 0 {
+		page = 0
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(page * DefaultPageSize)).
+		SetLimit(int64(DefaultPageSize))
+	cursor, err := s.Collection.Find(ctx, bson.M{"bookingId": bookingID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	messages := []*Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// MarkRead marks as read the messages the other user sent to the user. It returns the
+// number of messages marked.
+func (s *MessageService) MarkRead(ctx context.Context, userID, otherID primitive.ObjectID) (int64, error) {
+	result, err := s.Collection.UpdateMany(ctx,
+		bson.M{"fromUserId": otherID, "toUserId": userID, "readAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"readAt": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// CountUnread returns the number of messages received by the user not read yet.
+func (s *MessageService) CountUnread(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return s.Collection.CountDocuments(ctx, bson.M{"toUserId": userID, "readAt": bson.M{"$exists": false}})
+}
+
+// HasUnreadMessages returns true if the user has messages of the other user not read yet.
+func (s *MessageService) HasUnreadMessages(ctx context.Context, userID, otherID primitive.ObjectID) (bool, error) {
+	count, err := s.Collection.CountDocuments(ctx,
+		bson.M{"fromUserId": otherID, "toUserId": userID, "readAt": bson.M{"$exists": false}},
+		options.Count().SetLimit(1),
+	)
+	return count > 0, err
+}
+
+// CountRecentMessages returns the number of messages sent by the user after since.
+func (s *MessageService) CountRecentMessages(ctx context.Context, userID primitive.ObjectID, since time.Time) (int64, error) {
+	return s.Collection.CountDocuments(ctx, bson.M{
+		"fromUserId": userID,
+		"createdAt":  bson.M{"$gte": since},
+	})
+}
+
+// DeleteUserMessages deletes the messages sent or received by the user.
+func (s *MessageService) DeleteUserMessages(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"$or": bson.A{bson.M{"fromUserId": userID}, bson.M{"toUserId": userID}}})
+	return err
+}
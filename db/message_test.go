@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMessageService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	messageService := NewMessageService(&Database{
+		Client:   client,
+		Database: client.Database(dbName),
+	})
+
+	alice, bob, carol := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	c.Assert(ConversationID(alice, bob), qt.Equals, ConversationID(bob, alice))
+
+	now := time.Now()
+	for i, m := range []*Message{
+		{FromUserID: alice, ToUserID: bob, Text: "hello"},
+		{FromUserID: bob, ToUserID: alice, Text: "hi"},
+		{FromUserID: alice, ToUserID: bob, Text: "can I borrow the drill?"},
+		{FromUserID: carol, ToUserID: alice, Text: "about the ladder"},
+	} {
+		m.CreatedAt = now.Add(time.Duration(i) * time.Minute)
+		c.Assert(messageService.InsertMessage(ctx, m), qt.IsNil)
+	}
+
+	// The conversation with the most recent message first, with the unread count of the user
+	conversations, err := messageService.GetConversations(ctx, alice, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(conversations, qt.HasLen, 2)
+	c.Assert(conversations[0].UserID, qt.Equals, carol)
+	c.Assert(conversations[0].LastMessage.Text, qt.Equals, "about the ladder")
+	c.Assert(conversations[0].Unread, qt.Equals, int64(1))
+	c.Assert(conversations[1].UserID, qt.Equals, bob)
+	c.Assert(conversations[1].LastMessage.Text, qt.Equals, "can I borrow the drill?")
+	c.Assert(conversations[1].Unread, qt.Equals, int64(1))
+
+	conversations, err = messageService.GetConversations(ctx, bob, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(conversations, qt.HasLen, 1)
+	c.Assert(conversations[0].UserID, qt.Equals, alice)
+	c.Assert(conversations[0].Unread, qt.Equals, int64(2))
+
+	// Newest first
+	messages, err := messageService.GetMessages(ctx, bob, alice, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(messages, qt.HasLen, 3)
+	c.Assert(messages[0].Text, qt.Equals, "can I borrow the drill?")
+	c.Assert(messages[2].Text, qt.Equals, "hello")
+
+	// Only the messages received are marked as read
+	unread, err := messageService.HasUnreadMessages(ctx, bob, alice)
+	c.Assert(err, qt.IsNil)
+	c.Assert(unread, qt.IsTrue)
+	marked, err := messageService.MarkRead(ctx, bob, alice)
+	c.Assert(err, qt.IsNil)
+	c.Assert(marked, qt.Equals, int64(2))
+	unread, err = messageService.HasUnreadMessages(ctx, bob, alice)
+	c.Assert(err, qt.IsNil)
+	c.Assert(unread, qt.IsFalse)
+	count, err := messageService.CountUnread(ctx, alice)
+	c.Assert(err, qt.IsNil)
+	c.Assert(count, qt.Equals, int64(2))
+
+	count, err = messageService.CountRecentMessages(ctx, alice, now.Add(time.Minute))
+	c.Assert(err, qt.IsNil)
+	c.Assert(count, qt.Equals, int64(1))
+
+	// The messages of a booking thread
+	bookingID := primitive.NewObjectID()
+	thread := &Message{FromUserID: bob, ToUserID: alice, Text: "see you", BookingID: &bookingID}
+	c.Assert(messageService.InsertMessage(ctx, thread), qt.IsNil)
+	messages, err = messageService.GetBookingMessages(ctx, bookingID, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(messages, qt.HasLen, 1)
+	c.Assert(messages[0].Text, qt.Equals, "see you")
+
+	// Deleting a user deletes the messages it sent and received
+	c.Assert(messageService.DeleteUserMessages(ctx, carol), qt.IsNil)
+	conversations, err = messageService.GetConversations(ctx, alice, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(conversations, qt.HasLen, 1)
+	c.Assert(conversations[0].UserID, qt.Equals, bob)
+}
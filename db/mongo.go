@@ -2,17 +2,24 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"regexp"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
-	// DatabaseName is the name of the MongoDB database.
+	// DatabaseName is the name of the MongoDB database. The databases of the tenants are named
+	// after it followed by the tenant id.
 	DatabaseName = "emprius-backend"
 )
 
+// tenantIDRegexp matches the valid tenant ids, which are part of the database names.
+var tenantIDRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
 // Database struct encapsulates MongoDB client and database.
 type Database struct {
 	Client              *mongo.Client
@@ -20,9 +27,33 @@ type Database struct {
 	ToolService         *ToolService
 	ToolCategoryService *ToolCategoryService
 	ImageService        *ImageService
+	MediaService        *MediaService
 	TransportService    *TransportService
 	UserService         *UserService
 	BookingService      *BookingService
+	ToolReportService   *ToolReportService
+	NotificationService *NotificationService
+	SavedSearchService  *SavedSearchService
+	FavoriteService     *FavoriteService
+	RecoveryService     *AccountRecoveryService
+	GeocodeCache        *GeocodeCacheService
+	DeviceService       *DeviceService
+	PostService         *PostService
+	CommunityService    *CommunityService
+	WaitlistService     *WaitlistService
+	MaintenanceService  *ToolMaintenanceService
+	InviteService       *InviteService
+	ToolViewService     *ToolViewService
+	TransferService     *ToolTransferService
+	AuditLogService     *AuditLogService
+	SessionService      *SessionService
+	LoginAttemptService *LoginAttemptService
+	IdempotencyService  *IdempotencyService
+	MessageService      *MessageService
+	TermsService        *TermsService
+	CrowdfundService    *CrowdfundService
+	ValuationService    *ToolValuationService
+	PoolService         *CommunityPoolService
 }
 
 // New initializes a new MongoDB connection.
@@ -40,18 +71,61 @@ func New(uri string) (*Database, error) {
 		return nil, err
 	}
 
-	db := client.Database(DatabaseName)
+	return newDatabase(client, DatabaseName), nil
+}
+
+// Tenant returns the database of a tenant of a multi-tenant deployment, on the same connection.
+// Each tenant has its own MongoDB database, so their data is fully separated.
+func (db *Database) Tenant(id string) (*Database, error) {
+	if !ValidTenantID(id) {
+		return nil, fmt.Errorf("invalid tenant id %q", id)
+	}
+	return newDatabase(db.Client, DatabaseName+"-"+id), nil
+}
+
+// ValidTenantID returns true if the id can identify a tenant: lower case letters, digits and
+// dashes, up to 32 characters.
+func ValidTenantID(id string) bool {
+	return tenantIDRegexp.MatchString(id)
+}
+
+// newDatabase returns the database with the given name of the client, with its services.
+func newDatabase(client *mongo.Client, name string) *Database {
 	database := &Database{
 		Client:   client,
-		Database: db,
+		Database: client.Database(name),
 	}
 	database.ToolService = NewToolService(database)
 	database.ToolCategoryService = NewToolCategoryService(database)
 	database.ImageService = NewImageService(database)
+	database.MediaService = NewMediaService(database)
 	database.TransportService = NewTransportService(database)
 	database.UserService = NewUserService(database)
 	database.BookingService = NewBookingService(database.Database)
-	return database, nil
+	database.ToolReportService = NewToolReportService(database)
+	database.NotificationService = NewNotificationService(database)
+	database.SavedSearchService = NewSavedSearchService(database)
+	database.FavoriteService = NewFavoriteService(database)
+	database.RecoveryService = NewAccountRecoveryService(database)
+	database.GeocodeCache = NewGeocodeCacheService(database)
+	database.DeviceService = NewDeviceService(database)
+	database.PostService = NewPostService(database)
+	database.CommunityService = NewCommunityService(database)
+	database.WaitlistService = NewWaitlistService(database)
+	database.MaintenanceService = NewToolMaintenanceService(database)
+	database.InviteService = NewInviteService(database)
+	database.ToolViewService = NewToolViewService(database)
+	database.TransferService = NewToolTransferService(database)
+	database.AuditLogService = NewAuditLogService(database)
+	database.SessionService = NewSessionService(database)
+	database.LoginAttemptService = NewLoginAttemptService(database)
+	database.IdempotencyService = NewIdempotencyService(database)
+	database.MessageService = NewMessageService(database)
+	database.TermsService = NewTermsService(database)
+	database.CrowdfundService = NewCrowdfundService(database)
+	database.ValuationService = NewToolValuationService(database)
+	database.PoolService = NewCommunityPoolService(database)
+	return database
 }
 
 // Close disconnects the MongoDB client.
@@ -63,3 +137,16 @@ func (db *Database) Close(ctx context.Context) error {
 func (db *Database) CreateTables() error {
 	return InitializeDatabase(db)
 }
+
+// Projection returns the projection that includes only the given document fields, or nil if
+// there are no fields (all the fields are included).
+func Projection(fields []string) bson.M {
+	if len(fields) == 0 {
+		return nil
+	}
+	projection := make(bson.M, len(fields))
+	for _, field := range fields {
+		projection[field] = 1
+	}
+	return projection
+}
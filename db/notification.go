@@ -0,0 +1,218 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NotificationType identifies the event that originated a notification.
+type NotificationType string
+
+const (
+	NotificationSavedSearchMatch      NotificationType = "SAVED_SEARCH_MATCH"
+	NotificationFavoriteAvailable     NotificationType = "FAVORITE_AVAILABLE"
+	NotificationDisagreement          NotificationType = "BOOKING_DISAGREEMENT"
+	NotificationDispute               NotificationType = "BOOKING_DISPUTE"
+	NotificationAccountRecovery       NotificationType = "ACCOUNT_RECOVERY"
+	NotificationBookingCancelled      NotificationType = "BOOKING_CANCELLED"
+	NotificationToolsTransferred      NotificationType = "TOOLS_TRANSFERRED"
+	NotificationBookingReminder       NotificationType = "BOOKING_REMINDER"
+	NotificationBookingExpired        NotificationType = "BOOKING_EXPIRED"
+	NotificationBookingStatus         NotificationType = "BOOKING_STATUS"
+	NotificationBookingRequest        NotificationType = "BOOKING_REQUEST"
+	NotificationRatingReminder        NotificationType = "RATING_REMINDER"
+	NotificationCommunityAnnouncement NotificationType = "COMMUNITY_ANNOUNCEMENT"
+	NotificationPostComment           NotificationType = "POST_COMMENT"
+	NotificationWaitlist              NotificationType = "WAITLIST_AVAILABLE"
+	NotificationInviteUsed            NotificationType = "INVITE_USED"
+	NotificationToolManager           NotificationType = "TOOL_MANAGER"
+	NotificationToolTransfer          NotificationType = "TOOL_TRANSFER"
+	NotificationToolApproval          NotificationType = "TOOL_APPROVAL"
+	NotificationDirectMessage         NotificationType = "DIRECT_MESSAGE"
+	NotificationMention               NotificationType = "MENTION"
+	NotificationCrowdfund             NotificationType = "CROWDFUND"
+	NotificationPoolPayout            NotificationType = "POOL_PAYOUT"
+)
+
+// NotificationTypes are the notification types, in the order they are listed to the users.
+var NotificationTypes = []NotificationType{
+	NotificationBookingRequest,
+	NotificationBookingStatus,
+	NotificationBookingCancelled,
+	NotificationWaitlist,
+	NotificationBookingExpired,
+	NotificationBookingReminder,
+	NotificationRatingReminder,
+	NotificationDisagreement,
+	NotificationDispute,
+	NotificationSavedSearchMatch,
+	NotificationFavoriteAvailable,
+	NotificationToolsTransferred,
+	NotificationToolManager,
+	NotificationToolTransfer,
+	NotificationToolApproval,
+	NotificationCommunityAnnouncement,
+	NotificationPostComment,
+	NotificationCrowdfund,
+	NotificationPoolPayout,
+	NotificationDirectMessage,
+	NotificationMention,
+	NotificationInviteUsed,
+	NotificationAccountRecovery,
+}
+
+// IsValidNotificationType returns true if the notification type exists.
+func IsValidNotificationType(t NotificationType) bool {
+	return slices.Contains(NotificationTypes, t)
+}
+
+// NotificationChannels are the channels a notification type is delivered through.
+type NotificationChannels struct {
+	Email bool `bson:"email" json:"email"`
+	Push  bool `bson:"push" json:"push"`
+	InApp bool `bson:"inApp" json:"inApp"`
+	// Telegram is only delivered to the users that linked their Telegram account.
+	Telegram bool `bson:"telegram" json:"telegram"`
+}
+
+// DefaultNotificationChannels returns the channels of a notification type for the users that
+// did not set their preferences. Every notification is delivered in-app and pushed, only the
+// reminders are also sent by email. The booking, comment, message and mention notifications
+// are sent to Telegram.
+func DefaultNotificationChannels(t NotificationType) NotificationChannels {
+	return NotificationChannels{
+		Email: t == NotificationBookingReminder || t == NotificationRatingReminder,
+		Push:  true,
+		InApp: true,
+		Telegram: slices.Contains([]NotificationType{
+			NotificationBookingRequest,
+			NotificationBookingStatus,
+			NotificationBookingCancelled,
+			NotificationBookingExpired,
+			NotificationBookingReminder,
+			NotificationWaitlist,
+			NotificationDisagreement,
+			NotificationDispute,
+			NotificationPostComment,
+			NotificationDirectMessage,
+			NotificationMention,
+		}, t),
+	}
+}
+
+// Notification represents the schema for the "notifications" collection (in-app notifications).
+type Notification struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	Type      NotificationType   `bson:"type" json:"type"`
+	Message   string             `bson:"message" json:"message"`
+	ToolID    int64              `bson:"toolId,omitempty" json:"toolId,omitempty"`
+	BookingID primitive.ObjectID `bson:"bookingId,omitempty" json:"bookingId,omitempty"`
+	PostID    primitive.ObjectID `bson:"postId,omitempty" json:"postId,omitempty"`
+	Read      bool               `bson:"read" json:"read"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// NotificationService provides methods to interact with the "notifications" collection.
+type NotificationService struct {
+	Collection *mongo.Collection
+}
+
+// NewNotificationService creates a new NotificationService.
+func NewNotificationService(db *Database) *NotificationService {
+	return &NotificationService{
+		Collection: db.Database.Collection("notifications"),
+	}
+}
+
+// InsertNotification inserts a new Notification document.
+func (s *NotificationService) InsertNotification(ctx context.Context, n *Notification) (*mongo.InsertOneResult, error) {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+	result, err := s.Collection.InsertOne(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	n.ID = result.InsertedID.(primitive.ObjectID)
+	return result, nil
+}
+
+// GetUserNotifications retrieves the paginated notifications of a user, newest first.
+func (s *NotificationService) GetUserNotifications(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	page int,
+	unreadOnly bool,
+) ([]*Notification, error) {
+	if page < 0 {
+		page = 0
+	}
+	filter := bson.M{"userId": userID}
+	if unreadOnly {
+		filter["read"] = false
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64(page * DefaultPageSize)).
+		SetLimit(int64(DefaultPageSize))
+
+	cursor, err := s.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	notifications := []*Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// CountUnread returns the number of unread notifications of a user.
+func (s *NotificationService) CountUnread(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return s.Collection.CountDocuments(ctx, bson.M{"userId": userID, "read": false})
+}
+
+// MarkAsRead marks a notification of the user as read. It returns mongo.ErrNoDocuments
+// if the notification does not exist or does not belong to the user.
+func (s *NotificationService) MarkAsRead(ctx context.Context, userID, id primitive.ObjectID) error {
+	result, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "userId": userID},
+		bson.M{"$set": bson.M{"read": true}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// MarkAllAsRead marks all the notifications of the user as read.
+func (s *NotificationService) MarkAllAsRead(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.UpdateMany(ctx,
+		bson.M{"userId": userID, "read": false},
+		bson.M{"$set": bson.M{"read": true}},
+	)
+	return err
+}
+
+// DeleteUserNotifications deletes all the notifications of a user.
+func (s *NotificationService) DeleteUserNotifications(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestNotificationService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	database := client.Database(dbName)
+
+	// Initialize NotificationService
+	notificationService := NewNotificationService(&Database{
+		Client:   client,
+		Database: database,
+	})
+
+	userID := primitive.NewObjectID()
+	otherID := primitive.NewObjectID()
+
+	for i := 0; i < 3; i++ {
+		_, err := notificationService.InsertNotification(ctx, &Notification{
+			UserID:  userID,
+			Type:    NotificationSavedSearchMatch,
+			Message: "A new tool matches your saved search",
+			ToolID:  int64(i),
+		})
+		c.Assert(err, qt.IsNil)
+	}
+
+	notifications, err := notificationService.GetUserNotifications(ctx, userID, 0, false)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(notifications), qt.Equals, 3)
+
+	unread, err := notificationService.CountUnread(ctx, userID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(unread, qt.Equals, int64(3))
+
+	// Other users cannot mark the notification as read
+	err = notificationService.MarkAsRead(ctx, otherID, notifications[0].ID)
+	c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+
+	c.Assert(notificationService.MarkAsRead(ctx, userID, notifications[0].ID), qt.IsNil)
+	notifications, err = notificationService.GetUserNotifications(ctx, userID, 0, true)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(notifications), qt.Equals, 2)
+
+	c.Assert(notificationService.MarkAllAsRead(ctx, userID), qt.IsNil)
+	unread, err = notificationService.CountUnread(ctx, userID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(unread, qt.Equals, int64(0))
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Post represents the schema for the "posts" collection, the messages of the community boards.
+// Announcements are posts of the community admins notified to every member.
+type Post struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Community    string             `bson:"community" json:"community"`
+	AuthorID     primitive.ObjectID `bson:"authorId" json:"authorId"`
+	Title        string             `bson:"title" json:"title"`
+	Body         string             `bson:"body" json:"body"`
+	Announcement bool               `bson:"announcement,omitempty" json:"announcement,omitempty"`
+	Pinned       bool               `bson:"pinned" json:"pinned"`
+	Comments     int64              `bson:"comments" json:"comments"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	// Refs are the tools, bookings and users referenced by the body.
+	Refs []EntityRef `bson:"refs,omitempty" json:"refs,omitempty"`
+}
+
+// PostComment represents the schema for the "post_comments" collection.
+type PostComment struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	PostID    primitive.ObjectID `bson:"postId" json:"postId"`
+	AuthorID  primitive.ObjectID `bson:"authorId" json:"authorId"`
+	Body      string             `bson:"body" json:"body"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	// Refs are the tools, bookings and users referenced by the body.
+	Refs []EntityRef `bson:"refs,omitempty" json:"refs,omitempty"`
+}
+
+// PostService provides methods to interact with the "posts" and "post_comments" collections.
+type PostService struct {
+	Collection *mongo.Collection
+	Comments   *mongo.Collection
+}
+
+// NewPostService creates a new PostService.
+func NewPostService(db *Database) *PostService {
+	return &PostService{
+		Collection: db.Database.Collection("posts"),
+		Comments:   db.Database.Collection("post_comments"),
+	}
+}
+
+// InsertPost inserts a new Post document.
+func (s *PostService) InsertPost(ctx context.Context, p *Post) error {
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now()
+	}
+	result, err := s.Collection.InsertOne(ctx, p)
+	if err != nil {
+		return err
+	}
+	p.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetPost retrieves a post of the community. It returns mongo.ErrNoDocuments if the post does
+// not exist or belongs to another community.
+func (s *PostService) GetPost(ctx context.Context, community string, id primitive.ObjectID) (*Post, error) {
+	var post Post
+	if err := s.Collection.FindOne(ctx, bson.M{"_id": id, "community": community}).Decode(&post); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// GetCommunityPosts retrieves the paginated posts of a community, pinned first and then newest first.
+func (s *PostService) GetCommunityPosts(ctx context.Context, community string, page int) ([]*Post, error) {
+	if page < 0 {
+		page = 0
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "pinned", Value: -1}, {Key: "createdAt", Value: -1}}).
+		SetSkip(int64(page * DefaultPageSize)).
+		SetLimit(int64(DefaultPageSize))
+	cursor, err := s.Collection.Find(ctx, bson.M{"community": community}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	posts := []*Post{}
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// SetPinned pins or unpins a post of the community. It returns mongo.ErrNoDocuments if the
+// post does not exist or belongs to another community.
+func (s *PostService) SetPinned(ctx context.Context, community string, id primitive.ObjectID, pinned bool) error {
+	result, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "community": community},
+		bson.M{"$set": bson.M{"pinned": pinned}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// InsertComment inserts a new comment and increments the comment count of its post.
+func (s *PostService) InsertComment(ctx context.Context, comment *PostComment) error {
+	if comment.CreatedAt.IsZero() {
+		comment.CreatedAt = time.Now()
+	}
+	result, err := s.Comments.InsertOne(ctx, comment)
+	if err != nil {
+		return err
+	}
+	comment.ID = result.InsertedID.(primitive.ObjectID)
+	_, err = s.Collection.UpdateOne(ctx, bson.M{"_id": comment.PostID}, bson.M{"$inc": bson.M{"comments": 1}})
+	return err
+}
+
+// GetPostComments retrieves the paginated comments of a post, oldest first.
+func (s *PostService) GetPostComments(ctx context.Context, postID primitive.ObjectID, page int) ([]*PostComment, error) {
+	if page < 0 {
+		page = 0
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(page * DefaultPageSize)).
+		SetLimit(int64(DefaultPageSize))
+	cursor, err := s.Comments.Find(ctx, bson.M{"postId": postID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	comments := []*PostComment{}
+	if err := cursor.All(ctx, &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
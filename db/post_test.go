@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestPostService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	postService := NewPostService(&Database{
+		Client:   client,
+		Database: client.Database(dbName),
+	})
+
+	authorID := primitive.NewObjectID()
+	now := time.Now()
+	var posts []*Post
+	for i, title := range []string{"First", "Second", "Third"} {
+		post := &Post{
+			Community: "valley",
+			AuthorID:  authorID,
+			Title:     title,
+			Body:      "body",
+			CreatedAt: now.Add(time.Duration(i) * time.Minute),
+		}
+		c.Assert(postService.InsertPost(ctx, post), qt.IsNil)
+		posts = append(posts, post)
+	}
+	c.Assert(postService.InsertPost(ctx, &Post{Community: "coast", AuthorID: authorID, Title: "Other"}), qt.IsNil)
+
+	// Newest first, with the pinned posts on top
+	c.Assert(postService.SetPinned(ctx, "valley", posts[0].ID, true), qt.IsNil)
+	list, err := postService.GetCommunityPosts(ctx, "valley", 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(list, qt.HasLen, 3)
+	c.Assert(list[0].Title, qt.Equals, "First")
+	c.Assert(list[1].Title, qt.Equals, "Third")
+
+	// Posts are only found in their community
+	_, err = postService.GetPost(ctx, "coast", posts[0].ID)
+	c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+	c.Assert(postService.SetPinned(ctx, "coast", posts[0].ID, true), qt.Equals, mongo.ErrNoDocuments)
+
+	for _, body := range []string{"one", "two"} {
+		c.Assert(postService.InsertComment(ctx, &PostComment{PostID: posts[1].ID, AuthorID: authorID, Body: body}), qt.IsNil)
+	}
+	comments, err := postService.GetPostComments(ctx, posts[1].ID, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(comments, qt.HasLen, 2)
+	c.Assert(comments[0].Body, qt.Equals, "one")
+	post, err := postService.GetPost(ctx, "valley", posts[1].ID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(post.Comments, qt.Equals, int64(2))
+}
@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SavedSearch represents the schema for the "saved_searches" collection.
+// Users are notified when a newly published tool matches one of their saved searches.
+type SavedSearch struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID           primitive.ObjectID `bson:"userId" json:"userId"`
+	SearchTerm       string             `bson:"searchTerm,omitempty" json:"searchTerm,omitempty"`
+	Categories       []int              `bson:"categories,omitempty" json:"categories,omitempty"`
+	Distance         int                `bson:"distance" json:"distance"`
+	MaxCost          *uint64            `bson:"maxCost,omitempty" json:"maxCost,omitempty"`
+	MayBeFree        *bool              `bson:"mayBeFree,omitempty" json:"mayBeFree,omitempty"`
+	TransportOptions []int              `bson:"transportOptions,omitempty" json:"transportOptions,omitempty"`
+	Location         DBLocation         `bson:"location" json:"-"`
+	NotifiedTools    []int64            `bson:"notifiedTools,omitempty" json:"-"`
+	CreatedAt        time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// Matches returns true if the tool satisfies all the criteria of the saved search,
+// using the same semantics as ToolService.SearchTools. The toolCategories are the tool
+// category and its ancestors (see CategoryTree.Ancestors), so a search by a parent
+// category matches the tools of its subcategories. If empty, only the tool category is used.
+func (ss *SavedSearch) Matches(tool *Tool, toolCategories []int) bool {
+	if len(toolCategories) == 0 {
+		toolCategories = []int{tool.ToolCategory}
+	}
+	if !tool.IsAvailable || tool.PendingApproval || slices.Contains(hiddenToolStatuses, tool.Status) {
+		return false
+	}
+	if ss.SearchTerm != "" {
+		matched, err := regexp.MatchString(SanitizeString(ss.SearchTerm), tool.Title)
+		if err != nil || !matched {
+			return false
+		}
+	}
+	if len(ss.Categories) > 0 && !slices.ContainsFunc(toolCategories, func(c int) bool {
+		return slices.Contains(ss.Categories, c)
+	}) {
+		return false
+	}
+	if ss.MayBeFree != nil && tool.MayBeFree != *ss.MayBeFree {
+		return false
+	}
+	if ss.MaxCost != nil && *ss.MaxCost > 0 && tool.Cost > *ss.MaxCost {
+		return false
+	}
+	if len(ss.TransportOptions) > 0 {
+		found := false
+		for _, t := range tool.TransportOptions {
+			if slices.Contains(ss.TransportOptions, int(t.ID)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if ss.Distance > 0 && !WithinCircumference(ss.Location, tool.Location, ss.Distance) {
+		return false
+	}
+	return true
+}
+
+// SavedSearchService provides methods to interact with the "saved_searches" collection.
+type SavedSearchService struct {
+	Collection *mongo.Collection
+}
+
+// NewSavedSearchService creates a new SavedSearchService.
+func NewSavedSearchService(db *Database) *SavedSearchService {
+	return &SavedSearchService{
+		Collection: db.Database.Collection("saved_searches"),
+	}
+}
+
+// InsertSavedSearch inserts a new SavedSearch document.
+func (s *SavedSearchService) InsertSavedSearch(ctx context.Context, ss *SavedSearch) (*mongo.InsertOneResult, error) {
+	if ss.CreatedAt.IsZero() {
+		ss.CreatedAt = time.Now()
+	}
+	result, err := s.Collection.InsertOne(ctx, ss)
+	if err != nil {
+		return nil, err
+	}
+	ss.ID = result.InsertedID.(primitive.ObjectID)
+	return result, nil
+}
+
+// GetUserSavedSearches retrieves all the saved searches of a user.
+func (s *SavedSearchService) GetUserSavedSearches(ctx context.Context, userID primitive.ObjectID) ([]*SavedSearch, error) {
+	cursor, err := s.Collection.Find(ctx, bson.M{"userId": userID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	searches := []*SavedSearch{}
+	if err := cursor.All(ctx, &searches); err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+// CountUserSavedSearches returns the number of saved searches of a user.
+func (s *SavedSearchService) CountUserSavedSearches(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return s.Collection.CountDocuments(ctx, bson.M{"userId": userID})
+}
+
+// DeleteSavedSearch deletes a saved search of the user. It returns mongo.ErrNoDocuments
+// if the saved search does not exist or does not belong to the user.
+func (s *SavedSearchService) DeleteSavedSearch(ctx context.Context, userID, id primitive.ObjectID) error {
+	result, err := s.Collection.DeleteOne(ctx, bson.M{"_id": id, "userId": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteUserSavedSearches deletes all the saved searches of a user.
+func (s *SavedSearchService) DeleteUserSavedSearches(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
+
+// FindMatches returns the saved searches, not owned by the tool owner, that match the tool
+// and have not been notified about it yet. The non geographic filters are resolved by the
+// database while the term and distance are checked by SavedSearch.Matches.
+func (s *SavedSearchService) FindMatches(ctx context.Context, tool *Tool, toolCategories []int) ([]*SavedSearch, error) {
+	if len(toolCategories) == 0 {
+		toolCategories = []int{tool.ToolCategory}
+	}
+	transportIDs := []int64{}
+	for _, t := range tool.TransportOptions {
+		transportIDs = append(transportIDs, t.ID)
+	}
+	filter := bson.M{
+		"userId":        bson.M{"$ne": tool.UserID},
+		"notifiedTools": bson.M{"$ne": tool.ID},
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"categories": bson.M{"$exists": false}},
+				{"categories": bson.M{"$in": toolCategories}},
+			}},
+			{"$or": []bson.M{
+				{"maxCost": bson.M{"$exists": false}},
+				{"maxCost": 0},
+				{"maxCost": bson.M{"$gte": tool.Cost}},
+			}},
+			{"$or": []bson.M{
+				{"mayBeFree": bson.M{"$exists": false}},
+				{"mayBeFree": tool.MayBeFree},
+			}},
+			{"$or": []bson.M{
+				{"transportOptions": bson.M{"$exists": false}},
+				{"transportOptions": bson.M{"$in": transportIDs}},
+			}},
+		},
+	}
+	cursor, err := s.Collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var candidates []*SavedSearch
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+	matches := []*SavedSearch{}
+	for _, ss := range candidates {
+		if ss.Matches(tool, toolCategories) {
+			matches = append(matches, ss)
+		}
+	}
+	return matches, nil
+}
+
+// MarkNotified records that the owner of the saved search has been notified about the tool.
+func (s *SavedSearchService) MarkNotified(ctx context.Context, id primitive.ObjectID, toolID int64) error {
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$addToSet": bson.M{"notifiedTools": toolID}},
+	)
+	return err
+}
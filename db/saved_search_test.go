@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestSavedSearchMatches(t *testing.T) {
+	c := qt.New(t)
+
+	barcelona := NewLocation(41385063, 2173404)
+	girona := NewLocation(41979401, 2821426)
+	maxCost := uint64(20)
+	free := true
+
+	tool := &Tool{
+		ID:               1,
+		Title:            "Electric drill",
+		IsAvailable:      true,
+		MayBeFree:        true,
+		Cost:             10,
+		ToolCategory:     2,
+		Location:         barcelona,
+		TransportOptions: []Transport{{ID: 1}},
+	}
+
+	c.Assert((&SavedSearch{SearchTerm: "drill"}).Matches(tool, nil), qt.IsTrue)
+	c.Assert((&SavedSearch{SearchTerm: "saw"}).Matches(tool, nil), qt.IsFalse)
+	c.Assert((&SavedSearch{Categories: []int{1, 2}}).Matches(tool, nil), qt.IsTrue)
+	c.Assert((&SavedSearch{Categories: []int{3}}).Matches(tool, nil), qt.IsFalse)
+	// A parent category matches the tools of its subcategories
+	c.Assert((&SavedSearch{Categories: []int{4}}).Matches(tool, []int{2, 4}), qt.IsTrue)
+	c.Assert((&SavedSearch{MaxCost: &maxCost, MayBeFree: &free}).Matches(tool, nil), qt.IsTrue)
+	c.Assert((&SavedSearch{TransportOptions: []int{2}}).Matches(tool, nil), qt.IsFalse)
+
+	// Distance is checked against the saved search location
+	c.Assert((&SavedSearch{Distance: 10000, Location: barcelona}).Matches(tool, nil), qt.IsTrue)
+	c.Assert((&SavedSearch{Distance: 10000, Location: girona}).Matches(tool, nil), qt.IsFalse)
+
+	// Unavailable or reported tools never match
+	lost := *tool
+	lost.Status = ToolStatusLost
+	c.Assert((&SavedSearch{SearchTerm: "drill"}).Matches(&lost, nil), qt.IsFalse)
+	unavailable := *tool
+	unavailable.IsAvailable = false
+	c.Assert((&SavedSearch{SearchTerm: "drill"}).Matches(&unavailable, nil), qt.IsFalse)
+}
+
+func TestSavedSearchService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	database := client.Database(dbName)
+
+	// Initialize SavedSearchService
+	searchService := NewSavedSearchService(&Database{
+		Client:   client,
+		Database: database,
+	})
+
+	owner := primitive.NewObjectID()
+	userA := primitive.NewObjectID()
+	userB := primitive.NewObjectID()
+	location := NewLocation(41385063, 2173404)
+	tool := &Tool{
+		ID:               42,
+		UserID:           owner,
+		Title:            "Hammer",
+		IsAvailable:      true,
+		Cost:             5,
+		ToolCategory:     1,
+		Location:         location,
+		TransportOptions: []Transport{{ID: 1}},
+	}
+
+	c.Run("Find Matches", func(c *qt.C) {
+		searches := []*SavedSearch{
+			{UserID: userA, SearchTerm: "Hammer", Location: location},
+			{UserID: userB, Categories: []int{2}, Location: location},
+			{UserID: owner, SearchTerm: "Hammer", Location: location},
+		}
+		for _, s := range searches {
+			_, err := searchService.InsertSavedSearch(ctx, s)
+			c.Assert(err, qt.IsNil)
+		}
+
+		// Searches of the tool owner are excluded
+		matches, err := searchService.FindMatches(ctx, tool, nil)
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(matches), qt.Equals, 1)
+		c.Assert(matches[0].UserID, qt.Equals, userA)
+
+		// Once notified the search does not match the same tool again
+		c.Assert(searchService.MarkNotified(ctx, matches[0].ID, tool.ID), qt.IsNil)
+		matches, err = searchService.FindMatches(ctx, tool, nil)
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(matches), qt.Equals, 0)
+	})
+
+	c.Run("List and Delete", func(c *qt.C) {
+		searches, err := searchService.GetUserSavedSearches(ctx, userB)
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(searches), qt.Equals, 1)
+
+		// Only the owner can delete the search
+		err = searchService.DeleteSavedSearch(ctx, userA, searches[0].ID)
+		c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+		c.Assert(searchService.DeleteSavedSearch(ctx, userB, searches[0].ID), qt.IsNil)
+
+		count, err := searchService.CountUserSavedSearches(ctx, userB)
+		c.Assert(err, qt.IsNil)
+		c.Assert(count, qt.Equals, int64(0))
+	})
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Session represents the schema for the "sessions" collection. A session is created on each
+// login and identified by the sid claim of its tokens, which are rejected once it is deleted.
+// The expired sessions are deleted by a TTL index.
+type Session struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	IP        string             `bson:"ip,omitempty"`
+	UserAgent string             `bson:"userAgent,omitempty"`
+	// Country is the ISO code of the login country, if known.
+	Country    string    `bson:"country,omitempty"`
+	CreatedAt  time.Time `bson:"createdAt"`
+	LastSeenAt time.Time `bson:"lastSeenAt"`
+	ExpiresAt  time.Time `bson:"expiresAt"`
+}
+
+// SessionService provides methods to interact with the "sessions" collection.
+type SessionService struct {
+	Collection *mongo.Collection
+}
+
+// NewSessionService creates a new SessionService.
+func NewSessionService(db *Database) *SessionService {
+	return &SessionService{
+		Collection: db.Database.Collection("sessions"),
+	}
+}
+
+// CreateSession inserts a new session.
+func (s *SessionService) CreateSession(ctx context.Context, session *Session) error {
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	session.LastSeenAt = session.CreatedAt
+	result, err := s.Collection.InsertOne(ctx, session)
+	if err != nil {
+		return err
+	}
+	session.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetSession returns the session with the given ID.
+func (s *SessionService) GetSession(ctx context.Context, id primitive.ObjectID) (*Session, error) {
+	var session Session
+	if err := s.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetUserSessions returns the sessions of the user not expired at the given time, the most
+// recently used first.
+func (s *SessionService) GetUserSessions(ctx context.Context, userID primitive.ObjectID, now time.Time) ([]*Session, error) {
+	cursor, err := s.Collection.Find(ctx,
+		bson.M{"userId": userID, "expiresAt": bson.M{"$gt": now}},
+		options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+	sessions := []*Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Touch updates the last use of the session and the IP it was used from.
+func (s *SessionService) Touch(ctx context.Context, id primitive.ObjectID, ip string, now time.Time) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastSeenAt": now, "ip": ip}})
+	return err
+}
+
+// Extend sets the expiration of the session, when its token is refreshed.
+func (s *SessionService) Extend(ctx context.Context, id primitive.ObjectID, expiresAt time.Time) error {
+	result, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"expiresAt": expiresAt}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteSession deletes the session of the user, its tokens are no longer accepted. It returns
+// mongo.ErrNoDocuments if the user has no such session.
+func (s *SessionService) DeleteSession(ctx context.Context, id, userID primitive.ObjectID) error {
+	result, err := s.Collection.DeleteOne(ctx, bson.M{"_id": id, "userId": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteUserSessions deletes every session of the user.
+func (s *SessionService) DeleteUserSessions(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
+
+// KnownLogin returns whether the user has any session, and whether any of them was created
+// from the given user agent and from the given country (true if the country is empty).
+func (s *SessionService) KnownLogin(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	userAgent, country string,
+) (hasSessions, knownDevice, knownCountry bool, err error) {
+	sessions, err := s.GetUserSessions(ctx, userID, time.Time{})
+	if err != nil {
+		return false, false, false, err
+	}
+	knownCountry = country == ""
+	for _, session := range sessions {
+		knownDevice = knownDevice || session.UserAgent == userAgent
+		knownCountry = knownCountry || session.Country == country
+	}
+	return len(sessions) > 0, knownDevice, knownCountry, nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestSessionService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	c.Assert(EnsureIndexes(ctx, database), qt.IsNil)
+	service := NewSessionService(database)
+
+	now := time.Now().Truncate(time.Millisecond)
+	userID, otherID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	// A user without sessions has no known device
+	hasSessions, knownDevice, knownCountry, err := service.KnownLogin(ctx, userID, "firefox", "ES")
+	c.Assert(err, qt.IsNil)
+	c.Assert(hasSessions, qt.IsFalse)
+	c.Assert(knownDevice, qt.IsFalse)
+	c.Assert(knownCountry, qt.IsFalse)
+
+	first := &Session{UserID: userID, IP: "10.0.0.1", UserAgent: "firefox", Country: "ES",
+		CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)}
+	second := &Session{UserID: userID, IP: "10.0.0.2", UserAgent: "chrome",
+		CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(time.Hour)}
+	expired := &Session{UserID: userID, UserAgent: "safari",
+		CreatedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+	for _, session := range []*Session{first, second, expired} {
+		c.Assert(service.CreateSession(ctx, session), qt.IsNil)
+		c.Assert(session.ID.IsZero(), qt.IsFalse)
+	}
+
+	// Only the sessions not expired are listed, the most recently used first
+	c.Assert(service.Touch(ctx, second.ID, "10.0.0.3", now), qt.IsNil)
+	sessions, err := service.GetUserSessions(ctx, userID, now)
+	c.Assert(err, qt.IsNil)
+	c.Assert(sessions, qt.HasLen, 2)
+	c.Assert(sessions[0].ID, qt.Equals, second.ID)
+	c.Assert(sessions[0].IP, qt.Equals, "10.0.0.3")
+	c.Assert(sessions[1].ID, qt.Equals, first.ID)
+
+	hasSessions, knownDevice, knownCountry, err = service.KnownLogin(ctx, userID, "chrome", "FR")
+	c.Assert(err, qt.IsNil)
+	c.Assert(hasSessions, qt.IsTrue)
+	c.Assert(knownDevice, qt.IsTrue)
+	c.Assert(knownCountry, qt.IsFalse)
+	_, knownDevice, knownCountry, err = service.KnownLogin(ctx, userID, "curl", "")
+	c.Assert(err, qt.IsNil)
+	c.Assert(knownDevice, qt.IsFalse)
+	c.Assert(knownCountry, qt.IsTrue)
+
+	// Refreshing extends the session
+	c.Assert(service.Extend(ctx, expired.ID, now.Add(time.Hour)), qt.IsNil)
+	c.Assert(service.Extend(ctx, primitive.NewObjectID(), now), qt.Equals, mongo.ErrNoDocuments)
+	sessions, err = service.GetUserSessions(ctx, userID, now)
+	c.Assert(err, qt.IsNil)
+	c.Assert(sessions, qt.HasLen, 3)
+
+	// Users can only delete their own sessions
+	c.Assert(service.DeleteSession(ctx, first.ID, otherID), qt.Equals, mongo.ErrNoDocuments)
+	c.Assert(service.DeleteSession(ctx, first.ID, userID), qt.IsNil)
+	_, err = service.GetSession(ctx, first.ID)
+	c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+
+	c.Assert(service.DeleteUserSessions(ctx, userID), qt.IsNil)
+	sessions, err = service.GetUserSessions(ctx, userID, now)
+	c.Assert(err, qt.IsNil)
+	c.Assert(sessions, qt.HasLen, 0)
+}
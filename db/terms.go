@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TermsVersion represents the schema for the "terms" collection, the published versions of the
+// terms of service and privacy policy the users must accept. The latest version is the current one.
+type TermsVersion struct {
+	// Version is the number of the version, starting at 1.
+	Version     int       `bson:"_id" json:"version"`
+	URL         string    `bson:"url" json:"url"`
+	PrivacyURL  string    `bson:"privacyUrl,omitempty" json:"privacyUrl,omitempty"`
+	Summary     string    `bson:"summary,omitempty" json:"summary,omitempty"`
+	PublishedAt time.Time `bson:"publishedAt" json:"publishedAt"`
+	// PublishedBy is the admin that published the version.
+	PublishedBy primitive.ObjectID `bson:"publishedBy" json:"-"`
+}
+
+// TermsAcceptance records the acceptance of a terms version by a user.
+type TermsAcceptance struct {
+	Version    int       `bson:"version" json:"version"`
+	AcceptedAt time.Time `bson:"acceptedAt" json:"acceptedAt"`
+}
+
+// TermsService provides methods to interact with the "terms" collection.
+type TermsService struct {
+	Collection *mongo.Collection
+}
+
+// NewTermsService creates a new TermsService.
+func NewTermsService(db *Database) *TermsService {
+	return &TermsService{
+		Collection: db.Database.Collection("terms"),
+	}
+}
+
+// Publish inserts the terms as the next version. If another version is published at the same
+// time, the insert fails with a duplicate key error.
+func (s *TermsService) Publish(ctx context.Context, terms *TermsVersion) error {
+	current, err := s.Current(ctx)
+	if err != nil {
+		return err
+	}
+	terms.Version = 1
+	if current != nil {
+		terms.Version = current.Version + 1
+	}
+	if terms.PublishedAt.IsZero() {
+		terms.PublishedAt = time.Now()
+	}
+	_, err = s.Collection.InsertOne(ctx, terms)
+	return err
+}
+
+// Current returns the latest published terms version, or nil if none was published.
+func (s *TermsService) Current(ctx context.Context) (*TermsVersion, error) {
+	var terms TermsVersion
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})
+	if err := s.Collection.FindOne(ctx, bson.M{}, opts).Decode(&terms); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &terms, nil
+}
+
+// List returns every published terms version, the latest first.
+func (s *TermsService) List(ctx context.Context) ([]*TermsVersion, error) {
+	cursor, err := s.Collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	versions := []*TermsVersion{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
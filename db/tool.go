@@ -2,8 +2,11 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"regexp"
+	"slices"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
@@ -53,6 +56,117 @@ type DateRange struct {
 	To   uint32 `bson:"to" json:"to"`
 }
 
+// ToolStatus represents an exceptional state of a tool. Tools in a normal state
+// have an empty status.
+type ToolStatus string
+
+const (
+	ToolStatusLost   ToolStatus = "LOST"
+	ToolStatusStolen ToolStatus = "STOLEN"
+	// ToolStatusDraft is set on the incomplete tools of their owner until they are published.
+	ToolStatusDraft ToolStatus = "DRAFT"
+)
+
+// hiddenToolStatuses are the statuses that exclude a tool from search results.
+var hiddenToolStatuses = []ToolStatus{ToolStatusLost, ToolStatusStolen, ToolStatusDraft}
+
+// IsValidReportStatus returns true if the status can be used to report a tool incident.
+func IsValidReportStatus(status ToolStatus) bool {
+	return status == ToolStatusLost || status == ToolStatusStolen
+}
+
+// PricingMode is how the renters of a tool pay for it.
+type PricingMode string
+
+const (
+	// PricingFixed tools cost their cost for each booked day.
+	PricingFixed PricingMode = "fixed"
+	// PricingFree tools are lent for free.
+	PricingFree PricingMode = "free"
+	// PricingPayWhatYouWant tools let the renter propose the amount of the booking, the
+	// suggested amount per day is a hint.
+	PricingPayWhatYouWant PricingMode = "payWhatYouWant"
+)
+
+// IsValidPricingMode returns true if the mode is a known pricing mode.
+func IsValidPricingMode(mode PricingMode) bool {
+	return mode == PricingFixed || mode == PricingFree || mode == PricingPayWhatYouWant
+}
+
+// CancellationPolicy is what the renters of a tool pay when they cancel an accepted booking.
+type CancellationPolicy string
+
+const (
+	// CancellationFlexible bookings can be cancelled for free until they start.
+	CancellationFlexible CancellationPolicy = "flexible"
+	// CancellationStrict bookings cancelled shortly before they start pay a penalty to the owner.
+	CancellationStrict CancellationPolicy = "strict"
+)
+
+// IsValidCancellationPolicy returns true if the policy is a known cancellation policy.
+func IsValidCancellationPolicy(policy CancellationPolicy) bool {
+	return policy == CancellationFlexible || policy == CancellationStrict
+}
+
+// AutoAcceptRules accept the booking requests matching any of them, every one optional.
+type AutoAcceptRules struct {
+	// MinRating accepts the requests of the renters with an average rating as renter (1 to 5)
+	// of at least MinRating, the renters never rated excluded
+	MinRating float64 `bson:"minRating,omitempty" json:"minRating,omitempty"`
+	// Communities accepts the requests of the members of the communities
+	Communities []string `bson:"communities,omitempty" json:"communities,omitempty"`
+	// MaxDays accepts the bookings of at most MaxDays days
+	MaxDays int `bson:"maxDays,omitempty" json:"maxDays,omitempty"`
+}
+
+// IsEmpty returns true if no rule is set.
+func (r *AutoAcceptRules) IsEmpty() bool {
+	return r == nil || (r.MinRating == 0 && len(r.Communities) == 0 && r.MaxDays == 0)
+}
+
+// AvailabilityRules are the recurring periods a tool can be booked in, every one optional.
+// The days are evaluated in UTC, as the booking dates.
+type AvailabilityRules struct {
+	// Weekdays are the days of the week the tool can be booked on, from 0 (Sunday) to 6
+	// (Saturday), every day if empty
+	Weekdays []int `bson:"weekdays,omitempty" json:"weekdays,omitempty"`
+	// ExcludedMonths are the months the tool cannot be booked in, from 1 (January) to 12
+	// (December)
+	ExcludedMonths []int `bson:"excludedMonths,omitempty" json:"excludedMonths,omitempty"`
+}
+
+// IsEmpty returns true if no rule is set.
+func (r *AvailabilityRules) IsEmpty() bool {
+	return r == nil || (len(r.Weekdays) == 0 && len(r.ExcludedMonths) == 0)
+}
+
+// Allows returns true if the tool can be booked on the day.
+func (r *AvailabilityRules) Allows(day time.Time) bool {
+	if r.IsEmpty() {
+		return true
+	}
+	day = day.UTC()
+	if len(r.Weekdays) > 0 && !slices.Contains(r.Weekdays, int(day.Weekday())) {
+		return false
+	}
+	return !slices.Contains(r.ExcludedMonths, int(day.Month()))
+}
+
+// FirstUnavailableDay returns the first day from start to end the tool cannot be booked on,
+// the day of the start included even if the dates end on it, or nil if every day is allowed.
+func (r *AvailabilityRules) FirstUnavailableDay(start, end time.Time) *time.Time {
+	if r.IsEmpty() {
+		return nil
+	}
+	first := start.UTC().Truncate(24 * time.Hour)
+	for day := first; day.Equal(first) || day.Before(end); day = day.AddDate(0, 0, 1) {
+		if !r.Allows(day) {
+			return &day
+		}
+	}
+	return nil
+}
+
 // Tool represents the schema for the "tools" collection.
 type Tool struct {
 	ID               int64              `bson:"_id" json:"id"`
@@ -67,11 +181,114 @@ type Tool struct {
 	TransportOptions []Transport        `bson:"transportOptions" json:"transportOptions"`
 	ToolCategory     int                `bson:"toolCategory" json:"toolCategory"`
 	Location         DBLocation         `bson:"location" json:"-"`
+	Locality         string             `bson:"locality,omitempty" json:"locality,omitempty"`
 	Rating           int32              `bson:"rating" json:"rating"`
 	EstimatedValue   uint64             `bson:"estimatedValue" json:"estimatedValue"`
-	Height           uint32             `bson:"height" json:"height"`
-	Weight           uint32             `bson:"weight" json:"weight"`
 	ReservedDates    []DateRange        `bson:"reservedDates" json:"reservedDates"`
+	Status           ToolStatus         `bson:"status,omitempty" json:"status,omitempty"`
+	SerialNumber     string             `bson:"serialNumber,omitempty" json:"serialNumber,omitempty"`
+	AssetTag         string             `bson:"assetTag,omitempty" json:"assetTag,omitempty"`
+	// Community is set on shared tools owned by a community, managed by its admins. UserID is
+	// then the admin who registered the tool, or the member who shared it.
+	Community string `bson:"community,omitempty" json:"community,omitempty"`
+	// PendingApproval is set on the tools shared by the community members until an admin of
+	// the community approves them. They are not listed nor can be booked meanwhile.
+	PendingApproval bool `bson:"pendingApproval,omitempty" json:"pendingApproval,omitempty"`
+	// Visibility is who can find, see and book the tool, VisibleTo the communities of the
+	// tools visible to specific communities. It is empty on tools not migrated yet, see
+	// MigrateToolVisibility.
+	Visibility ToolVisibility `bson:"visibility,omitempty" json:"visibility,omitempty"`
+	VisibleTo  []string       `bson:"visibleTo,omitempty" json:"visibleTo,omitempty"`
+	// UsageTerms are the optional terms the renters must accept to book the tool. The version
+	// is increased each time they change.
+	UsageTerms        string `bson:"usageTerms,omitempty" json:"usageTerms,omitempty"`
+	UsageTermsVersion int    `bson:"usageTermsVersion,omitempty" json:"usageTermsVersion,omitempty"`
+	// Maintenance is set while the owner has the tool offline for repairs.
+	Maintenance *ToolMaintenance `bson:"maintenance,omitempty" json:"maintenance,omitempty"`
+	// Media are the video and document attachments of the tool.
+	Media []ToolMedia `bson:"media,omitempty" json:"media,omitempty"`
+	// Specs are the structured attributes of the tool: its condition, brand, model...
+	Specs *ToolSpecs `bson:"specs,omitempty" json:"specs,omitempty"`
+	// Dimensions are the size and the weight of the tool, replacing the height and weight
+	// without units of the tools created before, see MigrateToolDimensions.
+	Dimensions *Dimensions `bson:"dimensions,omitempty" json:"dimensions,omitempty"`
+	// OwnerTrustScore is a copy of the owner trust score, kept up to date by the trust job.
+	OwnerTrustScore *int `bson:"ownerTrustScore,omitempty" json:"ownerTrustScore,omitempty"`
+	// RatingAverage is the average rating (1 to 5) given by the renters of the tool when rating
+	// their bookings, nil until first rated. It is updated with each new rating.
+	RatingAverage *float64 `bson:"ratingAverage,omitempty" json:"ratingAverage,omitempty"`
+	RatingCount   int64    `bson:"ratingCount,omitempty" json:"ratingCount,omitempty"`
+	RatingSum     int64    `bson:"ratingSum,omitempty" json:"-"`
+	// ViewCount is the number of views of the tool details, counting each user once per day.
+	ViewCount int64 `bson:"viewCount,omitempty" json:"viewCount,omitempty"`
+	// Popularity ranks the tools by their recent views and completed bookings, it is
+	// recalculated periodically by the popularity job.
+	Popularity float64 `bson:"popularity,omitempty" json:"-"`
+	// UpdatedAt is the time of the last change of the tool, nil on tools not changed since
+	// it was introduced.
+	UpdatedAt *time.Time `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+	// CreatedAt is the time the tool was published, nil on tools published before it was
+	// introduced. It is kept when the tool is replaced by a copy with a new ID.
+	CreatedAt *time.Time `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+	// PricingMode is empty on tools created before it was introduced, see Pricing.
+	PricingMode     PricingMode `bson:"pricingMode,omitempty" json:"pricingMode,omitempty"`
+	SuggestedAmount uint64      `bson:"suggestedAmount,omitempty" json:"suggestedAmount,omitempty"`
+	// CancellationPolicy is empty on tools created before it was introduced, which are flexible.
+	CancellationPolicy CancellationPolicy `bson:"cancellationPolicy,omitempty" json:"cancellationPolicy,omitempty"`
+	// AutoAccept are the rules accepting the booking requests of the tool on behalf of the
+	// owner, nil if the owner answers every request.
+	AutoAccept *AutoAcceptRules `bson:"autoAccept,omitempty" json:"autoAccept,omitempty"`
+	// Availability are the recurring periods the tool can be booked in, nil if it can be booked
+	// any day.
+	Availability *AvailabilityRules `bson:"availability,omitempty" json:"availability,omitempty"`
+	// Managers are the users the owner granted the management of the tool: editing it and
+	// answering its booking requests.
+	Managers []primitive.ObjectID `bson:"managers,omitempty" json:"managers,omitempty"`
+	// UpdatedBy is the user who last edited the tool, the owner or a manager.
+	UpdatedBy *primitive.ObjectID `bson:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+	// Version is increased by each edit of the tool, which must give the version it changes so
+	// concurrent edits do not overwrite each other.
+	Version int64 `bson:"version,omitempty" json:"version"`
+	// Contributors are the members who funded the shared tools bought through a crowdfund of
+	// the community, with the tokens each one contributed.
+	Contributors []ToolContributor `bson:"contributors,omitempty" json:"contributors,omitempty"`
+}
+
+// ToolContributor is a member who funded the purchase of a shared tool.
+type ToolContributor struct {
+	UserID primitive.ObjectID `bson:"userId" json:"userId"`
+	Amount uint64             `bson:"amount" json:"amount"`
+}
+
+// IsManager returns true if the user is a manager of the tool.
+func (t *Tool) IsManager(userID primitive.ObjectID) bool {
+	return slices.Contains(t.Managers, userID)
+}
+
+// Cancellation returns the cancellation policy of the tool, flexible if not set.
+func (t *Tool) Cancellation() CancellationPolicy {
+	if t.CancellationPolicy == "" {
+		return CancellationFlexible
+	}
+	return t.CancellationPolicy
+}
+
+// Pricing returns the pricing mode of the tool. The tools without one are free if they cost
+// nothing, and fixed otherwise.
+func (t *Tool) Pricing() PricingMode {
+	if t.PricingMode != "" {
+		return t.PricingMode
+	}
+	if t.Cost == 0 {
+		return PricingFree
+	}
+	return PricingFixed
+}
+
+// touchTool adds to a tool update the change of its UpdatedAt time.
+func touchTool(update bson.M) bson.M {
+	update["$currentDate"] = bson.M{"updatedAt": true}
+	return update
 }
 
 // SanitizeString removes all non-alphanumeric characters from a string,
@@ -102,13 +319,23 @@ func (s *ToolService) InsertTool(ctx context.Context, tool *Tool) (*mongo.Insert
 	if err != nil {
 		return nil, err
 	}
+	now := time.Now()
+	tool.UpdatedAt = &now
+	if tool.CreatedAt == nil {
+		tool.CreatedAt = &now
+	}
 	return s.Collection.InsertOne(ctx, tool)
 }
 
-// GetToolByID retrieves a Tool by its ID.
-func (s *ToolService) GetToolByID(ctx context.Context, id int64) (*Tool, error) {
+// GetToolByID retrieves a Tool by its ID. If fields are given, only those document fields are
+// retrieved.
+func (s *ToolService) GetToolByID(ctx context.Context, id int64, fields ...string) (*Tool, error) {
+	opts := options.FindOne()
+	if projection := Projection(fields); projection != nil {
+		opts.SetProjection(projection)
+	}
 	var tool Tool
-	err := s.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(&tool)
+	err := s.Collection.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&tool)
 	if err != nil {
 		return nil, err
 	}
@@ -118,7 +345,7 @@ func (s *ToolService) GetToolByID(ctx context.Context, id int64) (*Tool, error)
 // UpdateTool updates a Tool document by ID.
 func (s *ToolService) UpdateTool(ctx context.Context, id int64, update bson.M) (*mongo.UpdateResult, error) {
 	filter := bson.M{"_id": id}
-	return s.Collection.UpdateOne(ctx, filter, bson.M{"$set": update})
+	return s.Collection.UpdateOne(ctx, filter, touchTool(bson.M{"$set": update}))
 }
 
 // SearchToolsByLocation finds tools within a given radius (in meters) from a Location.
@@ -169,9 +396,88 @@ func (s *ToolService) GetAllTools(ctx context.Context) ([]*Tool, error) {
 	return tools, nil
 }
 
-// GetToolsByUserID retrieves all tools owned by a given user.
-func (s *ToolService) GetToolsByUserID(ctx context.Context, userID primitive.ObjectID) ([]*Tool, error) {
-	cursor, err := s.Collection.Find(ctx, bson.M{"userId": userID})
+// GetToolsByUserID retrieves all tools owned by a given user. If fields are given, only those
+// document fields are retrieved.
+func (s *ToolService) GetToolsByUserID(ctx context.Context, userID primitive.ObjectID, fields ...string) ([]*Tool, error) {
+	opts := options.Find()
+	if projection := Projection(fields); projection != nil {
+		opts.SetProjection(projection)
+	}
+	cursor, err := s.Collection.Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := cursor.Close(ctx); closeErr != nil {
+			log.Error().Err(closeErr).Msg("Error closing cursor")
+		}
+	}()
+
+	var tools []*Tool
+	if err := cursor.All(ctx, &tools); err != nil {
+		return nil, err
+	}
+	return tools, nil
+}
+
+// GetToolsByIDs retrieves the tools with the given IDs. Missing tools are ignored. If fields
+// are given, only those fields of the tools are retrieved.
+func (s *ToolService) GetToolsByIDs(ctx context.Context, ids []int64, fields ...string) ([]*Tool, error) {
+	opts := options.Find()
+	if projection := Projection(fields); projection != nil {
+		opts.SetProjection(projection)
+	}
+	cursor, err := s.Collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := cursor.Close(ctx); closeErr != nil {
+			log.Error().Err(closeErr).Msg("Error closing cursor")
+		}
+	}()
+
+	var tools []*Tool
+	if err := cursor.All(ctx, &tools); err != nil {
+		return nil, err
+	}
+	return tools, nil
+}
+
+// IsIdentifierTaken checks if the user owns a tool, other than excludeID, with the given
+// value for an identifier field (serialNumber or assetTag).
+func (s *ToolService) IsIdentifierTaken(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	field, value string,
+	excludeID int64,
+) (bool, error) {
+	filter := bson.M{
+		"userId": userID,
+		field:    value,
+		"_id":    bson.M{"$ne": excludeID},
+	}
+	count, err := s.Collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetToolsByIdentifier retrieves all the tools, of any owner, with the given serial number
+// and/or asset tag. Empty values are ignored. At least one of them must be provided.
+func (s *ToolService) GetToolsByIdentifier(ctx context.Context, serialNumber, assetTag string) ([]*Tool, error) {
+	filter := bson.M{}
+	if serialNumber != "" {
+		filter["serialNumber"] = serialNumber
+	}
+	if assetTag != "" {
+		filter["assetTag"] = assetTag
+	}
+	if len(filter) == 0 {
+		return nil, fmt.Errorf("missing serial number or asset tag")
+	}
+	cursor, err := s.Collection.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -188,10 +494,34 @@ func (s *ToolService) GetToolsByUserID(ctx context.Context, userID primitive.Obj
 	return tools, nil
 }
 
+// GetCommunityToolByAssetTag retrieves the shared tool of a community with the given asset
+// tag. It returns mongo.ErrNoDocuments if not found.
+func (s *ToolService) GetCommunityToolByAssetTag(ctx context.Context, community, assetTag string) (*Tool, error) {
+	var tool Tool
+	if err := s.Collection.FindOne(ctx, bson.M{"community": community, "assetTag": assetTag}).Decode(&tool); err != nil {
+		return nil, err
+	}
+	return &tool, nil
+}
+
+// SetAssetTag sets the asset tag of a tool, or removes it if empty. It returns
+// ErrDuplicateAssetTag if the tag is already used by another tool of the owner or community.
+func (s *ToolService) SetAssetTag(ctx context.Context, id int64, assetTag string) error {
+	update := bson.M{"$set": bson.M{"assetTag": assetTag}}
+	if assetTag == "" {
+		update = bson.M{"$unset": bson.M{"assetTag": ""}}
+	}
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, touchTool(update))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateAssetTag
+	}
+	return err
+}
+
 // UpdateToolFields updates specific fields of a tool.
 func (s *ToolService) UpdateToolFields(ctx context.Context, id int64, updates map[string]interface{}) error {
 	filter := bson.M{"_id": id}
-	update := bson.M{"$set": updates}
+	update := touchTool(bson.M{"$set": updates})
 
 	log.Debug().
 		Int64("id", id).
@@ -212,6 +542,32 @@ func (s *ToolService) UpdateToolFields(ctx context.Context, id int64, updates ma
 	return nil
 }
 
+// UpdateToolVersion updates specific fields of a tool if it is still at the given version, and
+// increases its version. The unset fields are removed. It returns ErrVersionConflict if the tool
+// was edited meanwhile.
+func (s *ToolService) UpdateToolVersion(
+	ctx context.Context, id int64, version int64, updates map[string]interface{}, unset ...string,
+) error {
+	update := bson.M{"$set": updates}
+	if len(unset) > 0 {
+		fields := bson.M{}
+		for _, field := range unset {
+			fields[field] = ""
+		}
+		update["$unset"] = fields
+	}
+	return updateVersion(ctx, s.Collection, id, version, touchTool(update))
+}
+
+// PublishTool publishes the draft tool if it is still at the given version, setting its
+// publication time. It returns ErrVersionConflict if the tool was edited meanwhile.
+func (s *ToolService) PublishTool(ctx context.Context, id int64, version int64, now time.Time) error {
+	return updateVersion(ctx, s.Collection, id, version, touchTool(bson.M{
+		"$set":   bson.M{"createdAt": now},
+		"$unset": bson.M{"status": ""},
+	}))
+}
+
 // SearchToolsOptions represents the criteria for searching tools.
 type SearchToolsOptions struct {
 	SearchTerm       string
@@ -221,10 +577,50 @@ type SearchToolsOptions struct {
 	Distance         int
 	Location         *DBLocation
 	TransportOptions []int
+	// Delivery only matches the tools their owner delivers, to the search location if any
+	// (within the maximum distance of the owner)
+	Delivery bool
+	// Conditions and PowerTypes, if set, are the accepted conditions and power types
+	Conditions []ToolCondition
+	PowerTypes []PowerType
+	// Brand, if set, is the brand of the tools, case insensitive
+	Brand string
+	// MaxWeightKg, MaxHeightCm, MaxWidthCm and MaxLengthCm, if positive, are the maximum
+	// dimensions of the tools, the tools without the dimension are excluded
+	MaxWeightKg float64
+	MaxHeightCm float64
+	MaxWidthCm  float64
+	MaxLengthCm float64
+	// Viewer, if set, also finds the tools restricted to its community, otherwise only the
+	// public tools are found
+	Viewer *ToolViewer
+	// SortByRating sorts the tools by their average rating, the unrated last
+	SortByRating bool
+	// SortByPopularity sorts the tools by their popularity, the most popular first
+	SortByPopularity bool
+	// Fields, if set, are the only document fields of the tools retrieved
+	Fields   []string
+	Page     int
+	PageSize int
 }
 
-// SearchTools finds tools by title, categories, cost, distance, etc.
-func (s *ToolService) SearchTools(ctx context.Context, opts SearchToolsOptions) ([]*Tool, error) {
+// ToolSearchResult is a Tool returned by a search, including its distance (in meters)
+// to the search location. Distance is zero if the search has no location.
+type ToolSearchResult struct {
+	Tool     `bson:",inline"`
+	Distance float64 `bson:"distance,omitempty"`
+}
+
+// toolSearchFacet is the result document of the search $facet stage.
+type toolSearchFacet struct {
+	Metadata []struct {
+		Total int64 `bson:"total"`
+	} `bson:"metadata"`
+	Tools []*ToolSearchResult `bson:"tools"`
+}
+
+// searchFilter builds the MongoDB filter for the given search options.
+func (opts *SearchToolsOptions) searchFilter() bson.M {
 	filter := bson.M{}
 
 	// Title search
@@ -252,53 +648,293 @@ func (s *ToolService) SearchTools(ctx context.Context, opts SearchToolsOptions)
 	if len(opts.TransportOptions) > 0 {
 		filter["transportOptions.id"] = bson.M{"$in": opts.TransportOptions}
 	}
+	if opts.Delivery {
+		filter["transportOptions.kind"] = TransportDelivery
+	}
+
+	// Specs filters
+	if len(opts.Conditions) > 0 {
+		filter["specs.condition"] = bson.M{"$in": opts.Conditions}
+	}
+	if len(opts.PowerTypes) > 0 {
+		filter["specs.powerType"] = bson.M{"$in": opts.PowerTypes}
+	}
+	if opts.Brand != "" {
+		filter["specs.brand"] = bson.M{"$regex": "^" + regexp.QuoteMeta(opts.Brand) + "$", "$options": "i"}
+	}
+
+	// Dimensions filters
+	for field, limit := range map[string]float64{
+		"dimensions.weightKg": opts.MaxWeightKg,
+		"dimensions.heightCm": opts.MaxHeightCm,
+		"dimensions.widthCm":  opts.MaxWidthCm,
+		"dimensions.lengthCm": opts.MaxLengthCm,
+	} {
+		if limit > 0 {
+			filter[field] = bson.M{"$gt": 0, "$lte": limit}
+		}
+	}
 
 	// Only show available tools
 	filter["isAvailable"] = true
 
-	// If distance + location => use $geoNear
-	if opts.Distance > 0 && opts.Location != nil {
-		pipeline := []bson.D{{
-			{Key: "$geoNear", Value: bson.D{
-				{Key: "near", Value: opts.Location},
-				{Key: "distanceField", Value: "distance"},
-				{Key: "maxDistance", Value: float64(opts.Distance)}, // meters
-				{Key: "spherical", Value: true},
-				{Key: "distanceMultiplier", Value: 0.001}, // meters => km in output
-				{Key: "query", Value: filter},
+	// Hide lost or stolen tools
+	filter["status"] = bson.M{"$nin": hiddenToolStatuses}
+
+	// Hide the community tools not approved yet
+	filter["pendingApproval"] = bson.M{"$ne": true}
+
+	// Hide the tools restricted to other communities
+	filter["$or"] = visibilityFilter(opts.Viewer)
+
+	return filter
+}
+
+// deliveryDistanceFilter matches the tools delivered to the search location, those with a
+// delivery option with no maximum distance or a maximum distance not below their distance.
+func deliveryDistanceFilter() bson.M {
+	return bson.M{"$expr": bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$transportOptions", bson.A{}}},
+		"as":    "option",
+		"in": bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{"$$option.kind", TransportDelivery}},
+			bson.M{"$or": bson.A{
+				bson.M{"$not": bson.A{bson.M{"$gt": bson.A{"$$option.maxDistanceKm", 0}}}},
+				bson.M{"$lte": bson.A{"$distance", bson.M{"$multiply": bson.A{"$$option.maxDistanceKm", 1000}}}},
 			}},
-		}}
+		}},
+	}}}}}
+}
+
+// searchStages returns the aggregation stages selecting the tools matching the search options,
+// with their distance to the search location if any ($geoNear).
+func (opts *SearchToolsOptions) searchStages() mongo.Pipeline {
+	filter := opts.searchFilter()
+	if opts.Location == nil {
+		return mongo.Pipeline{{{Key: "$match", Value: filter}}}
+	}
+	geoNear := bson.D{
+		{Key: "near", Value: opts.Location},
+		{Key: "distanceField", Value: "distance"},
+		{Key: "spherical", Value: true},
+		{Key: "query", Value: filter},
+	}
+	if opts.Distance > 0 {
+		geoNear = append(geoNear, bson.E{Key: "maxDistance", Value: float64(opts.Distance)}) // meters
+	}
+	pipeline := mongo.Pipeline{{{Key: "$geoNear", Value: geoNear}}}
+	if opts.Delivery {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: deliveryDistanceFilter()}})
+	}
+	return pipeline
+}
+
+// SearchTools finds tools by title, categories, cost, distance, etc.
+// It runs a single aggregation pipeline that filters the tools (using $geoNear if a location
+// is provided, so the results are sorted by distance), and paginates them with $facet.
+// Returns the requested page of results and the total number of matching tools.
+func (s *ToolService) SearchTools(ctx context.Context, opts SearchToolsOptions) ([]*ToolSearchResult, int64, error) {
+	if opts.Page < 0 {
+		opts.Page = 0
+	}
+	opts.PageSize = PageSize(opts.PageSize)
+
+	pipeline := opts.searchStages()
+	switch {
+	case opts.SortByRating:
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{
+			{Key: "ratingAverage", Value: -1},
+			{Key: "ratingCount", Value: -1},
+			{Key: "_id", Value: 1},
+		}}})
+	case opts.SortByPopularity:
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{
+			{Key: "popularity", Value: -1},
+			{Key: "_id", Value: 1},
+		}}})
+	case opts.Location == nil:
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}})
+	}
+	page := bson.A{
+		bson.D{{Key: "$skip", Value: int64(opts.Page * opts.PageSize)}},
+		bson.D{{Key: "$limit", Value: int64(opts.PageSize)}},
+	}
+	if len(opts.Fields) > 0 {
+		fields := append(slices.Clone(opts.Fields), "distance")
+		page = append(page, bson.D{{Key: "$project", Value: Projection(fields)}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$facet", Value: bson.D{
+		{Key: "metadata", Value: bson.A{
+			bson.D{{Key: "$count", Value: "total"}},
+		}},
+		{Key: "tools", Value: page},
+	}}})
+
+	log.Debug().Interface("pipeline", pipeline).Msg("executing search pipeline")
+
+	cursor, err := s.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if closeErr := cursor.Close(ctx); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("could not close db cursor")
+		}
+	}()
+
+	var facets []toolSearchFacet
+	if err := cursor.All(ctx, &facets); err != nil {
+		return nil, 0, err
+	}
+	if len(facets) == 0 || len(facets[0].Metadata) == 0 {
+		return []*ToolSearchResult{}, 0, nil
+	}
+	log.Debug().Int64("total_tools", facets[0].Metadata[0].Total).Msg("search completed")
+	return facets[0].Tools, facets[0].Metadata[0].Total, nil
+}
 
-		log.Debug().Interface("pipeline", pipeline).Msg("executing geoNear pipeline")
+// AddRating adds a rating (1 to 5) given by a renter to the aggregate rating of the tool.
+func (s *ToolService) AddRating(ctx context.Context, id int64, rating int) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"ratingSum":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$ratingSum", 0}}, rating}},
+			"ratingCount": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$ratingCount", 0}}, 1}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"ratingAverage": bson.M{"$divide": bson.A{"$ratingSum", "$ratingCount"}},
+			"updatedAt":     "$$NOW",
+		}}},
+	})
+	return err
+}
 
-		cursor, err := s.Collection.Aggregate(ctx, pipeline)
-		if err != nil {
-			return nil, err
+// SetPopularity sets the popularity of the given tools, and resets the popularity of the
+// other tools. The popularity does not change the updatedAt time of the tools.
+func (s *ToolService) SetPopularity(ctx context.Context, popularity map[int64]float64) error {
+	ids := make([]int64, 0, len(popularity))
+	models := make([]mongo.WriteModel, 0, len(popularity))
+	for id, score := range popularity {
+		ids = append(ids, id)
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{"$set": bson.M{"popularity": score}}))
+	}
+	if len(models) > 0 {
+		if _, err := s.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return fmt.Errorf("failed to set the popularity of the tools: %w", err)
 		}
-		defer func() {
-			if closeErr := cursor.Close(ctx); closeErr != nil {
-				log.Warn().Err(closeErr).Msg("could not close db cursor")
-			}
-		}()
-
-		var tools []*Tool
-		if err := cursor.All(ctx, &tools); err != nil {
-			return nil, err
+	}
+	_, err := s.Collection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$nin": ids}, "popularity": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"popularity": ""}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reset the popularity of the tools: %w", err)
+	}
+	return nil
+}
+
+// NewToolsOptions are the criteria of the new tools listed in a digest.
+type NewToolsOptions struct {
+	// Since is the time after which the tools were published.
+	Since time.Time
+	// Location and Radius (meters) select the tools near a location.
+	Location DBLocation
+	Radius   int
+	// Community, if set, also selects the tools shared in the community by its members or
+	// owned by the community, at any distance.
+	Community string
+	Members   []primitive.ObjectID
+	// Viewer is the user of the digest, only the tools visible to it are selected.
+	Viewer *ToolViewer
+	// ExcludeUserID excludes the tools of the user.
+	ExcludeUserID primitive.ObjectID
+	Limit         int
+}
+
+// GetNewTools returns up to opts.Limit available tools published after opts.Since near the
+// location or shared in the community, the newest first, and the total number of them.
+func (s *ToolService) GetNewTools(ctx context.Context, opts NewToolsOptions) ([]*Tool, int64, error) {
+	var where []bson.M
+	if opts.Radius > 0 && len(opts.Location.Coordinates) == 2 {
+		where = append(where, bson.M{"location": bson.M{"$geoWithin": bson.M{
+			"$centerSphere": bson.A{opts.Location.Coordinates, float64(opts.Radius) / (earthRadius * 1000)},
+		}}})
+	}
+	if opts.Community != "" {
+		where = append(where,
+			bson.M{"community": opts.Community},
+			bson.M{"userId": bson.M{"$in": opts.Members}},
+		)
+	}
+	if len(where) == 0 {
+		return []*Tool{}, 0, nil
+	}
+	filter := bson.M{
+		"createdAt":       bson.M{"$gt": opts.Since},
+		"isAvailable":     true,
+		"status":          bson.M{"$nin": hiddenToolStatuses},
+		"pendingApproval": bson.M{"$ne": true},
+		"userId":          bson.M{"$ne": opts.ExcludeUserID},
+		"$and":            bson.A{bson.M{"$or": where}, bson.M{"$or": visibilityFilter(opts.Viewer)}},
+	}
+	total, err := s.Collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := s.Collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(opts.Limit)))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
 		}
-		log.Debug().Int("total_tools", len(tools)).Msg("search completed")
-		return tools, nil
+	}()
+
+	var tools []*Tool
+	if err := cursor.All(ctx, &tools); err != nil {
+		return nil, 0, err
 	}
+	return tools, total, nil
+}
 
-	// Otherwise, do a normal Find
-	log.Debug().Interface("filter", filter).Msg("executing search with filter")
+// AddManager grants the user the management of the tool.
+func (s *ToolService) AddManager(ctx context.Context, id int64, userID primitive.ObjectID) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, touchTool(bson.M{
+		"$addToSet": bson.M{"managers": userID},
+	}))
+	return err
+}
 
-	cursor, err := s.Collection.Find(ctx, filter)
+// RemoveManager revokes the management of the tool from the user.
+func (s *ToolService) RemoveManager(ctx context.Context, id int64, userID primitive.ObjectID) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, touchTool(bson.M{
+		"$pull": bson.M{"managers": userID},
+	}))
+	return err
+}
+
+// RemoveManagerFromTools revokes the management of all the tools from the user.
+func (s *ToolService) RemoveManagerFromTools(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.UpdateMany(ctx, bson.M{"managers": userID}, touchTool(bson.M{
+		"$pull": bson.M{"managers": userID},
+	}))
+	return err
+}
+
+// GetManagedToolIDs returns the IDs of the tools managed by the user.
+func (s *ToolService) GetManagedToolIDs(ctx context.Context, userID primitive.ObjectID) ([]int64, error) {
+	cursor, err := s.Collection.Find(ctx, bson.M{"managers": userID},
+		options.Find().SetProjection(bson.M{"_id": 1}))
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
-		if closeErr := cursor.Close(ctx); closeErr != nil {
-			log.Warn().Err(closeErr).Msg("could not close db cursor")
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
 		}
 	}()
 
@@ -306,8 +942,11 @@ func (s *ToolService) SearchTools(ctx context.Context, opts SearchToolsOptions)
 	if err := cursor.All(ctx, &tools); err != nil {
 		return nil, err
 	}
-	log.Debug().Int("total_tools", len(tools)).Msg("search completed")
-	return tools, nil
+	ids := make([]int64, len(tools))
+	for i, tool := range tools {
+		ids[i] = tool.ID
+	}
+	return ids, nil
 }
 
 // CountTools returns the total number of tool documents.
@@ -315,6 +954,41 @@ func (s *ToolService) CountTools(ctx context.Context) (int64, error) {
 	return s.Collection.CountDocuments(ctx, bson.M{})
 }
 
+// CountUserTools returns the number of tools owned by the user, excluding the drafts.
+func (s *ToolService) CountUserTools(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return s.Collection.CountDocuments(ctx, bson.M{"userId": userID, "status": bson.M{"$ne": ToolStatusDraft}})
+}
+
+// GetToolOwners returns which of the users own at least one published tool.
+func (s *ToolService) GetToolOwners(ctx context.Context, userIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	values, err := s.Collection.Distinct(ctx, "userId", bson.M{
+		"userId": bson.M{"$in": userIDs},
+		"status": bson.M{"$ne": ToolStatusDraft},
+	})
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[primitive.ObjectID]bool, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			owners[id] = true
+		}
+	}
+	return owners, nil
+}
+
+// CountCommunityTools returns the number of tools shared in a community: the tools of its
+// members and the shared tools owned by the community.
+func (s *ToolService) CountCommunityTools(ctx context.Context, community string, members []primitive.ObjectID) (int64, error) {
+	return s.Collection.CountDocuments(ctx, bson.M{
+		"pendingApproval": bson.M{"$ne": true},
+		"$or": []bson.M{
+			{"userId": bson.M{"$in": members}},
+			{"community": community},
+		},
+	})
+}
+
 // WithinCircumference checks if two GeoJSON points are within a given radius (meters).
 // This uses the Haversine formula and a small distanceMargin to account for rounding.
 func WithinCircumference(point1, point2 DBLocation, distance int) bool {
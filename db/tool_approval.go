@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetPendingCommunityTools returns a page of the tools shared with the community by its members
+// that wait for the approval of its admins, the oldest first.
+func (s *ToolService) GetPendingCommunityTools(ctx context.Context, community string, page int) ([]*Tool, error) {
+	if page < 0 {
+		page = 0
+	}
+	cursor, err := s.Collection.Find(ctx,
+		bson.M{"community": community, "pendingApproval": true},
+		options.Find().
+			SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+			SetSkip(int64(page*DefaultPageSize)).
+			SetLimit(DefaultPageSize),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	tools := []*Tool{}
+	if err := cursor.All(ctx, &tools); err != nil {
+		return nil, err
+	}
+	return tools, nil
+}
+
+// ApproveTool lists the pending tool in its community catalog. It returns false if the tool
+// was not pending approval.
+func (s *ToolService) ApproveTool(ctx context.Context, id int64) (bool, error) {
+	result, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "pendingApproval": true},
+		touchTool(bson.M{"$unset": bson.M{"pendingApproval": ""}}),
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// RejectTool gives the pending tool back to the member that shared it, as one of their own
+// tools, unavailable until they make it available. It returns false if the tool was not
+// pending approval.
+func (s *ToolService) RejectTool(ctx context.Context, id int64) (bool, error) {
+	result, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "pendingApproval": true},
+		touchTool(bson.M{
+			"$set":   bson.M{"isAvailable": false},
+			"$unset": bson.M{"pendingApproval": "", "community": ""},
+		}),
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
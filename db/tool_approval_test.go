@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestToolApproval(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	toolService := NewToolService(database)
+
+	member := primitive.NewObjectID()
+	createdAt := func(ago time.Duration) *time.Time {
+		t := time.Now().Add(-ago)
+		return &t
+	}
+	for i, tool := range []*Tool{
+		{ID: 1, Title: "Mixer", Community: "valley", PendingApproval: true, CreatedAt: createdAt(2 * time.Hour)},
+		{ID: 2, Title: "Chainsaw", Community: "valley", PendingApproval: true, CreatedAt: createdAt(time.Hour)},
+		{ID: 3, Title: "Boat", Community: "coast", PendingApproval: true, CreatedAt: createdAt(0)},
+		{ID: 4, Title: "Scaffolding", Community: "valley", CreatedAt: createdAt(0)},
+	} {
+		tool.UserID = member
+		tool.IsAvailable = true
+		_, err := toolService.Collection.InsertOne(ctx, tool)
+		c.Assert(err, qt.IsNil, qt.Commentf("tool %d", i))
+	}
+
+	pending, err := toolService.GetPendingCommunityTools(ctx, "valley", 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(pending, qt.HasLen, 2)
+	c.Assert(pending[0].ID, qt.Equals, int64(1))
+
+	// The pending tools are not found by the searches
+	_, total, err := toolService.SearchTools(ctx, SearchToolsOptions{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(1))
+
+	approved, err := toolService.ApproveTool(ctx, 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(approved, qt.IsTrue)
+	approved, err = toolService.ApproveTool(ctx, 4)
+	c.Assert(err, qt.IsNil)
+	c.Assert(approved, qt.IsFalse)
+
+	rejected, err := toolService.RejectTool(ctx, 2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(rejected, qt.IsTrue)
+	tool, err := toolService.GetToolByID(ctx, 2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tool.Community, qt.Equals, "")
+	c.Assert(tool.PendingApproval, qt.IsFalse)
+	c.Assert(tool.IsAvailable, qt.IsFalse)
+
+	pending, err = toolService.GetPendingCommunityTools(ctx, "valley", 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(pending, qt.HasLen, 0)
+	_, total, err = toolService.SearchTools(ctx, SearchToolsOptions{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(2))
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"slices"
 
 	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
@@ -9,10 +10,13 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// ToolCategory represents the schema for the "tool_categories" collection.
+// ToolCategory represents the schema for the "tool_categories" collection. Categories
+// can be nested under a parent category (e.g. "garden > mowers"), root categories have
+// no parent.
 type ToolCategory struct {
-	ID   int    `bson:"id" json:"id"`
-	Name string `bson:"name" json:"name"`
+	ID       int    `bson:"id" json:"id"`
+	Name     string `bson:"name" json:"name"`
+	ParentID int    `bson:"parentId,omitempty" json:"parentId,omitempty"`
 }
 
 // ToolCategoryService provides methods to interact with the "tool_categories" collection.
@@ -67,12 +71,12 @@ func (s *ToolCategoryService) GetAllToolCategories(ctx context.Context) ([]*Tool
 }
 
 // InitializeDefaultCategories ensures the default tool categories exist in the collection.
-func (s *ToolCategoryService) InitializeDefaultCategories(ctx context.Context, defaultCategories []string) error {
-	for i, name := range defaultCategories {
+func (s *ToolCategoryService) InitializeDefaultCategories(ctx context.Context, defaultCategories []ToolCategory) error {
+	for _, category := range defaultCategories {
 		_, err := s.Collection.UpdateOne(
 			ctx,
-			bson.M{"id": i + 1},
-			bson.M{"$setOnInsert": bson.M{"id": i + 1, "name": name}},
+			bson.M{"id": category.ID},
+			bson.M{"$setOnInsert": category},
 			options.Update().SetUpsert(true),
 		)
 		if err != nil {
@@ -81,3 +85,73 @@ func (s *ToolCategoryService) InitializeDefaultCategories(ctx context.Context, d
 	}
 	return nil
 }
+
+// CategoryTree indexes the tool categories by ID to navigate their hierarchy.
+type CategoryTree map[int]*ToolCategory
+
+// NewCategoryTree builds the CategoryTree of the given categories.
+func NewCategoryTree(categories []*ToolCategory) CategoryTree {
+	tree := make(CategoryTree, len(categories))
+	for _, c := range categories {
+		tree[c.ID] = c
+	}
+	return tree
+}
+
+// Breadcrumbs returns the path from the root category to the given category, both included.
+// Unknown categories return an empty path.
+func (t CategoryTree) Breadcrumbs(id int) []ToolCategory {
+	path := []ToolCategory{}
+	for c, ok := t[id]; ok; c, ok = t[c.ParentID] {
+		// guard against cycles on malformed data
+		if slices.ContainsFunc(path, func(p ToolCategory) bool { return p.ID == c.ID }) {
+			break
+		}
+		path = append(path, *c)
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// Ancestors returns the given category followed by its ancestors, nearest first.
+func (t CategoryTree) Ancestors(id int) []int {
+	ids := []int{id}
+	path := t.Breadcrumbs(id)
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].ID != id {
+			ids = append(ids, path[i].ID)
+		}
+	}
+	return ids
+}
+
+// Descendants returns the given categories and all their descendants, sorted and without
+// duplicates. Searching by a parent category must match the tools of its subcategories.
+func (t CategoryTree) Descendants(ids []int) []int {
+	if len(ids) == 0 {
+		return ids
+	}
+	children := map[int][]int{}
+	for _, c := range t {
+		if c.ParentID != 0 {
+			children[c.ParentID] = append(children[c.ParentID], c.ID)
+		}
+	}
+	seen := map[int]bool{}
+	queue := slices.Clone(ids)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		queue = append(queue, children[id]...)
+	}
+	result := make([]int, 0, len(seen))
+	for id := range seen {
+		result = append(result, id)
+	}
+	slices.Sort(result)
+	return result
+}
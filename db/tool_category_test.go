@@ -0,0 +1,48 @@
+package db
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestCategoryTree(t *testing.T) {
+	c := qt.New(t)
+
+	tree := NewCategoryTree([]*ToolCategory{
+		{ID: 1, Name: "other"},
+		{ID: 4, Name: "agriculture"},
+		{ID: 6, Name: "garden", ParentID: 4},
+		{ID: 7, Name: "mowers", ParentID: 6},
+		{ID: 8, Name: "irrigation", ParentID: 6},
+	})
+
+	c.Run("Breadcrumbs", func(c *qt.C) {
+		path := tree.Breadcrumbs(7)
+		c.Assert(path, qt.HasLen, 3)
+		c.Assert(path[0].Name, qt.Equals, "agriculture")
+		c.Assert(path[2].Name, qt.Equals, "mowers")
+		c.Assert(tree.Breadcrumbs(1), qt.HasLen, 1)
+		c.Assert(tree.Breadcrumbs(99), qt.HasLen, 0)
+	})
+
+	c.Run("Ancestors", func(c *qt.C) {
+		c.Assert(tree.Ancestors(7), qt.DeepEquals, []int{7, 6, 4})
+		c.Assert(tree.Ancestors(1), qt.DeepEquals, []int{1})
+	})
+
+	c.Run("Descendants", func(c *qt.C) {
+		c.Assert(tree.Descendants([]int{4}), qt.DeepEquals, []int{4, 6, 7, 8})
+		c.Assert(tree.Descendants([]int{7, 1, 7}), qt.DeepEquals, []int{1, 7})
+		c.Assert(tree.Descendants(nil), qt.HasLen, 0)
+	})
+
+	c.Run("Cycles", func(c *qt.C) {
+		cyclic := NewCategoryTree([]*ToolCategory{
+			{ID: 1, Name: "a", ParentID: 2},
+			{ID: 2, Name: "b", ParentID: 1},
+		})
+		c.Assert(cyclic.Breadcrumbs(1), qt.HasLen, 2)
+		c.Assert(cyclic.Descendants([]int{1}), qt.DeepEquals, []int{1, 2})
+	})
+}
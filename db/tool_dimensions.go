@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Dimensions are the size of a tool in centimeters and its weight in kilograms. Zero is an
+// unknown value.
+type Dimensions struct {
+	HeightCm float64 `bson:"heightCm,omitempty" json:"heightCm,omitempty"`
+	WidthCm  float64 `bson:"widthCm,omitempty" json:"widthCm,omitempty"`
+	LengthCm float64 `bson:"lengthCm,omitempty" json:"lengthCm,omitempty"`
+	WeightKg float64 `bson:"weightKg,omitempty" json:"weightKg,omitempty"`
+}
+
+// IsEmpty returns true if no dimension is known.
+func (d *Dimensions) IsEmpty() bool {
+	return d == nil || (d.HeightCm == 0 && d.WidthCm == 0 && d.LengthCm == 0 && d.WeightKg == 0)
+}
+
+// MigrateToolDimensions moves the height and weight of the tools created before the dimensions
+// were introduced, bare numbers taken as centimeters and kilograms, to their dimensions. It
+// returns the number of tools migrated, none once all of them are.
+func (s *ToolService) MigrateToolDimensions(ctx context.Context) (int64, error) {
+	known := func(field string) bson.M {
+		return bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$" + field, 0}}, "$" + field, "$$REMOVE"}}
+	}
+	result, err := s.Collection.UpdateMany(ctx,
+		bson.M{"$or": bson.A{
+			bson.M{"height": bson.M{"$exists": true}},
+			bson.M{"weight": bson.M{"$exists": true}},
+		}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"dimensions.heightCm": known("height"),
+				"dimensions.weightKg": known("weight"),
+			}}},
+			{{Key: "$unset", Value: bson.A{"height", "weight"}}},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMigrateToolDimensions(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	toolService := NewToolService(database)
+
+	// The tools created before the dimensions have a height and weight without units
+	_, err = toolService.Collection.InsertMany(ctx, []interface{}{
+		bson.M{"_id": int64(1), "title": "Ladder", "isAvailable": true, "height": 250, "weight": 12},
+		bson.M{"_id": int64(2), "title": "Unknown", "isAvailable": true, "height": 0, "weight": 0},
+		bson.M{"_id": int64(3), "title": "Drill", "isAvailable": true, "dimensions": bson.M{"heightCm": 10.5}},
+	})
+	c.Assert(err, qt.IsNil)
+
+	migrated, err := toolService.MigrateToolDimensions(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(migrated, qt.Equals, int64(2))
+	tool, err := toolService.GetToolByID(ctx, 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tool.Dimensions, qt.DeepEquals, &Dimensions{HeightCm: 250, WeightKg: 12})
+	tool, err = toolService.GetToolByID(ctx, 2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tool.Dimensions.IsEmpty(), qt.IsTrue)
+	count, err := toolService.Collection.CountDocuments(ctx, bson.M{"height": bson.M{"$exists": true}})
+	c.Assert(err, qt.IsNil)
+	c.Assert(count, qt.Equals, int64(0))
+
+	// Migrated once
+	migrated, err = toolService.MigrateToolDimensions(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(migrated, qt.Equals, int64(0))
+
+	// Searched by their maximum dimensions, the tools without them are excluded
+	tools, total, err := toolService.SearchTools(ctx, SearchToolsOptions{MaxHeightCm: 100})
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(1))
+	c.Assert(tools[0].ID, qt.Equals, int64(3))
+}
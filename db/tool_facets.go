@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ToolFacets are the counts of the tools matching a search by category, price, distance and
+// availability, for the clients to render the filters of the search.
+type ToolFacets struct {
+	Total int64
+	// Categories are the number of tools of each category, the most common first.
+	Categories []*CategoryCount
+	// Prices are the number of tools by cost, one bucket per lower boundary.
+	Prices []*FacetBucket
+	// Distances are the number of tools by distance to the search location, one bucket per
+	// lower boundary, empty if the search has no location.
+	Distances []*FacetBucket
+	// Available and InMaintenance are the number of tools that can be booked now and the
+	// number of tools taken offline for maintenance.
+	Available     int64
+	InMaintenance int64
+}
+
+// CategoryCount is the number of tools of a category.
+type CategoryCount struct {
+	ID    int   `bson:"_id"`
+	Count int64 `bson:"count"`
+}
+
+// FacetBucket is the number of tools with a value from Min up to the Min of the next bucket,
+// the last bucket being open ended.
+type FacetBucket struct {
+	Min   int64 `bson:"_id"`
+	Count int64 `bson:"count"`
+}
+
+// toolFacetsResult is the result document of the facets $facet stage.
+type toolFacetsResult struct {
+	Metadata []struct {
+		Total int64 `bson:"total"`
+	} `bson:"metadata"`
+	Categories   []*CategoryCount `bson:"categories"`
+	Prices       []*FacetBucket   `bson:"prices"`
+	Distances    []*FacetBucket   `bson:"distances"`
+	Availability []struct {
+		Available     int64 `bson:"available"`
+		InMaintenance int64 `bson:"inMaintenance"`
+	} `bson:"availability"`
+}
+
+// bucketStage returns the $bucket stage counting the documents by the field, with the given
+// ascending lower boundaries. The documents without the field or below the first boundary go
+// to the -1 bucket.
+func bucketStage(field string, boundaries []int64) bson.A {
+	bounds := make(bson.A, 0, len(boundaries)+1)
+	for _, b := range boundaries {
+		bounds = append(bounds, b)
+	}
+	bounds = append(bounds, int64(math.MaxInt64))
+	return bson.A{bson.D{{Key: "$bucket", Value: bson.D{
+		{Key: "groupBy", Value: field},
+		{Key: "boundaries", Value: bounds},
+		{Key: "default", Value: int64(-1)},
+		{Key: "output", Value: bson.M{"count": bson.M{"$sum": 1}}},
+	}}}}
+}
+
+// fillBuckets returns a bucket for each boundary with the counted documents, zero if none.
+func fillBuckets(boundaries []int64, counted []*FacetBucket) []*FacetBucket {
+	counts := make(map[int64]int64, len(counted))
+	for _, b := range counted {
+		counts[b.Min] = b.Count
+	}
+	buckets := make([]*FacetBucket, len(boundaries))
+	for i, bound := range boundaries {
+		buckets[i] = &FacetBucket{Min: bound, Count: counts[bound]}
+	}
+	return buckets
+}
+
+// inMaintenanceExpr returns the aggregation expression true for the tools in maintenance at
+// the given time.
+func inMaintenanceExpr(now time.Time) bson.M {
+	return bson.M{"$and": bson.A{
+		bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$maintenance.startDate", nil}}, nil}},
+		bson.M{"$lte": bson.A{"$maintenance.startDate", now}},
+		bson.M{"$or": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$maintenance.endDate", nil}}, nil}},
+			bson.M{"$gt": bson.A{"$maintenance.endDate", now}},
+		}},
+	}}
+}
+
+// SearchToolFacets counts the tools matching the search options by category, by cost in the
+// price buckets, by distance in the distance bands and by availability, in a single
+// aggregation with $facet. The buckets are given by their ascending lower boundaries, the
+// distance bands in meters. Paging, sorting and fields options are ignored.
+func (s *ToolService) SearchToolFacets(
+	ctx context.Context,
+	opts SearchToolsOptions,
+	prices, distances []int64,
+) (*ToolFacets, error) {
+	inMaintenance := inMaintenanceExpr(time.Now())
+	facets := bson.D{
+		{Key: "metadata", Value: bson.A{bson.D{{Key: "$count", Value: "total"}}}},
+		{Key: "categories", Value: bson.A{
+			bson.D{{Key: "$group", Value: bson.M{"_id": "$toolCategory", "count": bson.M{"$sum": 1}}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		}},
+		{Key: "prices", Value: bucketStage("$cost", prices)},
+		{Key: "availability", Value: bson.A{
+			bson.D{{Key: "$group", Value: bson.M{
+				"_id":           nil,
+				"available":     bson.M{"$sum": bson.M{"$cond": bson.A{inMaintenance, 0, 1}}},
+				"inMaintenance": bson.M{"$sum": bson.M{"$cond": bson.A{inMaintenance, 1, 0}}},
+			}}},
+		}},
+	}
+	if opts.Location != nil {
+		facets = append(facets, bson.E{Key: "distances", Value: bucketStage("$distance", distances)})
+	}
+	pipeline := append(opts.searchStages(), bson.D{{Key: "$facet", Value: facets}})
+
+	log.Debug().Interface("pipeline", pipeline).Msg("executing search facets pipeline")
+
+	cursor, err := s.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := cursor.Close(ctx); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("could not close db cursor")
+		}
+	}()
+
+	var results []toolFacetsResult
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	result := &toolFacetsResult{}
+	if len(results) > 0 {
+		result = &results[0]
+	}
+	toolFacets := &ToolFacets{
+		Categories: result.Categories,
+		Prices:     fillBuckets(prices, result.Prices),
+		Distances:  []*FacetBucket{},
+	}
+	if toolFacets.Categories == nil {
+		toolFacets.Categories = []*CategoryCount{}
+	}
+	if opts.Location != nil {
+		toolFacets.Distances = fillBuckets(distances, result.Distances)
+	}
+	if len(result.Metadata) > 0 {
+		toolFacets.Total = result.Metadata[0].Total
+	}
+	if len(result.Availability) > 0 {
+		toolFacets.Available = result.Availability[0].Available
+		toolFacets.InMaintenance = result.Availability[0].InMaintenance
+	}
+	return toolFacets, nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ToolMaintenance is the maintenance window of a tool taken offline by its owner. Bookings
+// overlapping the window are rejected. Without EndDate the tool stays in maintenance until
+// the owner ends it.
+type ToolMaintenance struct {
+	StartDate time.Time  `bson:"startDate" json:"startDate"`
+	EndDate   *time.Time `bson:"endDate,omitempty" json:"endDate,omitempty"`
+	Note      string     `bson:"note,omitempty" json:"note,omitempty"`
+}
+
+// Overlaps returns true if the maintenance window overlaps the given dates.
+func (m *ToolMaintenance) Overlaps(start, end time.Time) bool {
+	if m == nil {
+		return false
+	}
+	if m.EndDate != nil && !m.EndDate.After(start) {
+		return false
+	}
+	return m.StartDate.Before(end)
+}
+
+// Ended returns true if the maintenance window is over at the given time.
+func (m *ToolMaintenance) Ended(now time.Time) bool {
+	return m == nil || m.EndDate != nil && !m.EndDate.After(now)
+}
+
+// MaintenanceLogEntry represents the schema for the "tool_maintenance_log" collection.
+// Each entry records a repair or service of a tool, with its cost. Public entries are
+// shown in the tool history to the other users.
+type MaintenanceLogEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ToolID    int64              `bson:"toolId" json:"toolId"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	StartDate time.Time          `bson:"startDate" json:"startDate"`
+	EndDate   *time.Time         `bson:"endDate,omitempty" json:"endDate,omitempty"`
+	Note      string             `bson:"note" json:"note"`
+	Cost      uint64             `bson:"cost" json:"cost"`
+	Public    bool               `bson:"public" json:"public"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// ToolMaintenanceService provides methods to interact with the "tool_maintenance_log" collection.
+type ToolMaintenanceService struct {
+	Collection *mongo.Collection
+}
+
+// NewToolMaintenanceService creates a new ToolMaintenanceService.
+func NewToolMaintenanceService(db *Database) *ToolMaintenanceService {
+	return &ToolMaintenanceService{
+		Collection: db.Database.Collection("tool_maintenance_log"),
+	}
+}
+
+// InsertEntry inserts a new MaintenanceLogEntry document.
+func (s *ToolMaintenanceService) InsertEntry(ctx context.Context, entry *MaintenanceLogEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	result, err := s.Collection.InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetToolEntries gets paginated maintenance log entries of a tool, newest first.
+// If publicOnly is true only the entries shared in the tool history are returned.
+func (s *ToolMaintenanceService) GetToolEntries(
+	ctx context.Context, toolID int64, publicOnly bool, page int,
+) ([]*MaintenanceLogEntry, error) {
+	if page < 0 {
+		page = 0
+	}
+	filter := bson.M{"toolId": toolID}
+	if publicOnly {
+		filter["public"] = true
+	}
+	cursor, err := s.Collection.Find(ctx, filter,
+		options.Find().
+			SetSort(bson.D{{Key: "startDate", Value: -1}, {Key: "createdAt", Value: -1}}).
+			SetSkip(int64(page*DefaultPageSize)).
+			SetLimit(int64(DefaultPageSize)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	entries := []*MaintenanceLogEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// UpdateToolID moves the maintenance log of a tool to its new ID.
+func (s *ToolMaintenanceService) UpdateToolID(ctx context.Context, oldID, newID int64) error {
+	_, err := s.Collection.UpdateMany(ctx, bson.M{"toolId": oldID}, bson.M{"$set": bson.M{"toolId": newID}})
+	return err
+}
+
+// DeleteToolEntries deletes the maintenance log of a tool.
+func (s *ToolMaintenanceService) DeleteToolEntries(ctx context.Context, toolID int64) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"toolId": toolID})
+	return err
+}
+
+// SetMaintenance sets the maintenance window of a tool, or clears it if nil.
+func (s *ToolService) SetMaintenance(ctx context.Context, id int64, maintenance *ToolMaintenance) error {
+	update := bson.M{"$unset": bson.M{"maintenance": ""}}
+	if maintenance != nil {
+		update = bson.M{"$set": bson.M{"maintenance": maintenance}}
+	}
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, touchTool(update))
+	return err
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestToolMaintenanceOverlaps(t *testing.T) {
+	c := qt.New(t)
+
+	now := time.Now()
+	day := 24 * time.Hour
+	end := now.Add(3 * day)
+	window := &ToolMaintenance{StartDate: now.Add(day), EndDate: &end}
+
+	c.Assert(window.Overlaps(now, now.Add(2*day)), qt.IsTrue)
+	c.Assert(window.Overlaps(now.Add(2*day), now.Add(5*day)), qt.IsTrue)
+	c.Assert(window.Overlaps(now, now.Add(day)), qt.IsFalse)
+	c.Assert(window.Overlaps(end, end.Add(day)), qt.IsFalse)
+	c.Assert(window.Ended(now), qt.IsFalse)
+	c.Assert(window.Ended(end), qt.IsTrue)
+
+	// Without end date, every date after the start is blocked
+	open := &ToolMaintenance{StartDate: now.Add(day)}
+	c.Assert(open.Overlaps(now.Add(100*day), now.Add(101*day)), qt.IsTrue)
+	c.Assert(open.Overlaps(now, now.Add(day)), qt.IsFalse)
+	c.Assert(open.Ended(now.Add(100*day)), qt.IsFalse)
+
+	var none *ToolMaintenance
+	c.Assert(none.Overlaps(now, end), qt.IsFalse)
+	c.Assert(none.Ended(now), qt.IsTrue)
+}
+
+func TestToolMaintenanceService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	database := &Database{
+		Client:   client,
+		Database: client.Database(dbName),
+	}
+	maintenanceService := NewToolMaintenanceService(database)
+	toolService := NewToolService(database)
+
+	now := time.Now()
+	owner := primitive.NewObjectID()
+	entries := []*MaintenanceLogEntry{
+		{ToolID: 1, UserID: owner, StartDate: now.Add(-48 * time.Hour), Note: "New blade", Cost: 15, Public: true},
+		{ToolID: 1, UserID: owner, StartDate: now, Note: "Motor repair", Cost: 60},
+		{ToolID: 2, UserID: owner, StartDate: now, Note: "Cleaning"},
+	}
+	for _, e := range entries {
+		c.Assert(maintenanceService.InsertEntry(ctx, e), qt.IsNil)
+		c.Assert(e.ID.IsZero(), qt.IsFalse)
+	}
+
+	// Newest first
+	all, err := maintenanceService.GetToolEntries(ctx, 1, false, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(all, qt.HasLen, 2)
+	c.Assert(all[0].Note, qt.Equals, "Motor repair")
+	c.Assert(all[1].Cost, qt.Equals, uint64(15))
+
+	public, err := maintenanceService.GetToolEntries(ctx, 1, true, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(public, qt.HasLen, 1)
+	c.Assert(public[0].Note, qt.Equals, "New blade")
+
+	c.Assert(maintenanceService.DeleteToolEntries(ctx, 1), qt.IsNil)
+	all, err = maintenanceService.GetToolEntries(ctx, 1, false, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(all, qt.HasLen, 0)
+	all, err = maintenanceService.GetToolEntries(ctx, 2, false, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(all, qt.HasLen, 1)
+
+	// The maintenance window is set and cleared on the tool
+	_, err = toolService.InsertTool(ctx, &Tool{ID: 1, Title: "Saw", UserID: owner, Location: NewLocation(41385063, 2173404)})
+	c.Assert(err, qt.IsNil)
+	c.Assert(toolService.SetMaintenance(ctx, 1, &ToolMaintenance{StartDate: now, Note: "Motor repair"}), qt.IsNil)
+	tool, err := toolService.GetToolByID(ctx, 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tool.Maintenance, qt.IsNotNil)
+	c.Assert(tool.Maintenance.Note, qt.Equals, "Motor repair")
+	c.Assert(tool.Maintenance.EndDate, qt.IsNil)
+
+	c.Assert(toolService.SetMaintenance(ctx, 1, nil), qt.IsNil)
+	tool, err = toolService.GetToolByID(ctx, 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tool.Maintenance, qt.IsNil)
+}
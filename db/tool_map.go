@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+
+	"github.com/emprius/emprius-app-backend/geohash"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BoundingBox is a map area in degrees. MinLon is greater than MaxLon when the area
+// crosses the antimeridian.
+type BoundingBox struct {
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
+}
+
+// filter returns the MongoDB filter matching the tool locations inside the box.
+func (b BoundingBox) filter() bson.M {
+	filter := bson.M{
+		"location.coordinates.1": bson.M{"$gte": b.MinLat, "$lte": b.MaxLat},
+	}
+	if b.MinLon <= b.MaxLon {
+		filter["location.coordinates.0"] = bson.M{"$gte": b.MinLon, "$lte": b.MaxLon}
+		return filter
+	}
+	filter["$or"] = []bson.M{
+		{"location.coordinates.0": bson.M{"$gte": b.MinLon}},
+		{"location.coordinates.0": bson.M{"$lte": b.MaxLon}},
+	}
+	return filter
+}
+
+// ToolCluster is a group of tools whose location falls in the same geohash cell.
+type ToolCluster struct {
+	Geohash   string
+	Count     int64
+	Latitude  float64 // Centroid latitude of the tools, in degrees
+	Longitude float64 // Centroid longitude of the tools, in degrees
+	ToolID    int64   // Set only if the cluster has a single tool
+}
+
+// toolClusterGroup is the result document of the clustering $group stage.
+type toolClusterGroup struct {
+	ID struct {
+		Lat int64 `bson:"lat"`
+		Lon int64 `bson:"lon"`
+	} `bson:"_id"`
+	Count     int64   `bson:"count"`
+	Latitude  float64 `bson:"latitude"`
+	Longitude float64 `bson:"longitude"`
+	ToolID    int64   `bson:"toolId"`
+}
+
+// boxFilter returns the search filter restricted to the bounding box.
+func (opts *SearchToolsOptions) boxFilter(box BoundingBox) bson.M {
+	return bson.M{"$and": []bson.M{opts.searchFilter(), box.filter()}}
+}
+
+// ClusterTools groups the tools matching the search options inside the bounding box by
+// geohash cell of the given precision. Cells are computed by the aggregation pipeline on the
+// geohash grid, so no geohash needs to be stored in the tools. Location, distance and paging
+// options are ignored.
+func (s *ToolService) ClusterTools(
+	ctx context.Context,
+	opts SearchToolsOptions,
+	box BoundingBox,
+	precision int,
+) ([]*ToolCluster, error) {
+	cellLat, cellLon := geohash.CellSize(precision)
+	latitude := bson.M{"$arrayElemAt": bson.A{"$location.coordinates", 1}}
+	longitude := bson.M{"$arrayElemAt": bson.A{"$location.coordinates", 0}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: opts.boxFilter(box)}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "lat", Value: bson.M{"$floor": bson.M{"$divide": bson.A{bson.M{"$add": bson.A{latitude, 90}}, cellLat}}}},
+				{Key: "lon", Value: bson.M{"$floor": bson.M{"$divide": bson.A{bson.M{"$add": bson.A{longitude, 180}}, cellLon}}}},
+			}},
+			{Key: "count", Value: bson.M{"$sum": 1}},
+			{Key: "latitude", Value: bson.M{"$avg": latitude}},
+			{Key: "longitude", Value: bson.M{"$avg": longitude}},
+			{Key: "toolId", Value: bson.M{"$first": "$_id"}},
+		}}},
+	}
+
+	cursor, err := s.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := cursor.Close(ctx); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("could not close db cursor")
+		}
+	}()
+
+	var groups []toolClusterGroup
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	clusters := make([]*ToolCluster, 0, len(groups))
+	for _, g := range groups {
+		cluster := &ToolCluster{
+			// The hash of the cell center identifies the cell
+			Geohash: geohash.Encode(
+				-90+(float64(g.ID.Lat)+0.5)*cellLat,
+				-180+(float64(g.ID.Lon)+0.5)*cellLon,
+				precision,
+			),
+			Count:     g.Count,
+			Latitude:  g.Latitude,
+			Longitude: g.Longitude,
+		}
+		if g.Count == 1 {
+			cluster.ToolID = g.ToolID
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+// GetToolsInBox returns up to limit tools matching the search options inside the bounding
+// box, and whether there were more tools than the limit. Location, distance and paging
+// options are ignored.
+func (s *ToolService) GetToolsInBox(
+	ctx context.Context,
+	opts SearchToolsOptions,
+	box BoundingBox,
+	limit int,
+) ([]*Tool, bool, error) {
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit + 1))
+	cursor, err := s.Collection.Find(ctx, opts.boxFilter(box), findOpts)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		if closeErr := cursor.Close(ctx); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("could not close db cursor")
+		}
+	}()
+
+	tools := []*Tool{}
+	if err := cursor.All(ctx, &tools); err != nil {
+		return nil, false, err
+	}
+	if len(tools) > limit {
+		return tools[:limit], true, nil
+	}
+	return tools, false, nil
+}
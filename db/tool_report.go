@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ToolReport represents the schema for the "tool_reports" collection.
+// A report is created when an owner marks a tool as lost or stolen and acts as
+// the public registry entry that communities can check serial numbers against.
+type ToolReport struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ToolID       int64              `bson:"toolId" json:"toolId"`
+	UserID       primitive.ObjectID `bson:"userId" json:"userId"`
+	Status       ToolStatus         `bson:"status" json:"status"`
+	Description  string             `bson:"description" json:"description"`
+	SerialNumber string             `bson:"serialNumber,omitempty" json:"serialNumber,omitempty"`
+	ToolTitle    string             `bson:"toolTitle" json:"toolTitle"`
+	Resolved     bool               `bson:"resolved" json:"resolved"`
+	ReportedAt   time.Time          `bson:"reportedAt" json:"reportedAt"`
+	ResolvedAt   time.Time          `bson:"resolvedAt,omitempty" json:"resolvedAt,omitempty"`
+}
+
+// ToolReportService provides methods to interact with the "tool_reports" collection.
+type ToolReportService struct {
+	Collection *mongo.Collection
+}
+
+// NewToolReportService creates a new ToolReportService.
+func NewToolReportService(db *Database) *ToolReportService {
+	return &ToolReportService{
+		Collection: db.Database.Collection("tool_reports"),
+	}
+}
+
+// InsertReport inserts a new ToolReport document.
+func (s *ToolReportService) InsertReport(ctx context.Context, report *ToolReport) (*mongo.InsertOneResult, error) {
+	if report.ReportedAt.IsZero() {
+		report.ReportedAt = time.Now()
+	}
+	result, err := s.Collection.InsertOne(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+	report.ID = result.InsertedID.(primitive.ObjectID)
+	return result, nil
+}
+
+// GetActiveReportByToolID retrieves the unresolved report of a tool.
+func (s *ToolReportService) GetActiveReportByToolID(ctx context.Context, toolID int64) (*ToolReport, error) {
+	var report ToolReport
+	filter := bson.M{"toolId": toolID, "resolved": false}
+	err := s.Collection.FindOne(ctx, filter).Decode(&report)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ResolveToolReports marks all the unresolved reports of a tool as resolved.
+func (s *ToolReportService) ResolveToolReports(ctx context.Context, toolID int64) (*mongo.UpdateResult, error) {
+	filter := bson.M{"toolId": toolID, "resolved": false}
+	update := bson.M{"$set": bson.M{"resolved": true, "resolvedAt": time.Now()}}
+	return s.Collection.UpdateMany(ctx, filter, update)
+}
+
+// SearchBySerialNumber retrieves the unresolved reports matching the given serial number.
+// The comparison is case insensitive.
+func (s *ToolReportService) SearchBySerialNumber(ctx context.Context, serial string) ([]*ToolReport, error) {
+	filter := bson.M{
+		"serialNumber": serial,
+		"resolved":     false,
+	}
+	opts := options.Find().
+		SetCollation(&options.Collation{Locale: "en", Strength: 2}).
+		SetSort(bson.D{{Key: "reportedAt", Value: -1}})
+
+	cursor, err := s.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var reports []*ToolReport
+	if err := cursor.All(ctx, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestToolReportService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	database := client.Database(dbName)
+
+	// Initialize ToolReportService
+	reportService := NewToolReportService(&Database{
+		Client:   client,
+		Database: database,
+	})
+
+	c.Run("Insert and Search Report", func(c *qt.C) {
+		report := &ToolReport{
+			ToolID:       1234,
+			UserID:       primitive.NewObjectID(),
+			Status:       ToolStatusStolen,
+			Description:  "Stolen from the van",
+			SerialNumber: "SN-ABC-123",
+			ToolTitle:    "Drill",
+		}
+		_, err := reportService.InsertReport(ctx, report)
+		c.Assert(err, qt.IsNil, qt.Commentf("Failed to insert report"))
+		c.Assert(report.ID, qt.Not(qt.Equals), primitive.NilObjectID)
+		c.Assert(report.ReportedAt.IsZero(), qt.IsFalse)
+
+		// Search is case insensitive
+		reports, err := reportService.SearchBySerialNumber(ctx, "sn-abc-123")
+		c.Assert(err, qt.IsNil, qt.Commentf("Failed to search reports"))
+		c.Assert(len(reports), qt.Equals, 1)
+		c.Assert(reports[0].ToolID, qt.Equals, int64(1234))
+		c.Assert(reports[0].Status, qt.Equals, ToolStatusStolen)
+
+		// Unknown serial number
+		reports, err = reportService.SearchBySerialNumber(ctx, "unknown")
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(reports), qt.Equals, 0)
+	})
+
+	c.Run("Resolve Reports", func(c *qt.C) {
+		report := &ToolReport{
+			ToolID:       5678,
+			UserID:       primitive.NewObjectID(),
+			Status:       ToolStatusLost,
+			Description:  "Lost during a move",
+			SerialNumber: "LOST-1",
+		}
+		_, err := reportService.InsertReport(ctx, report)
+		c.Assert(err, qt.IsNil)
+
+		active, err := reportService.GetActiveReportByToolID(ctx, 5678)
+		c.Assert(err, qt.IsNil)
+		c.Assert(active.ID, qt.Equals, report.ID)
+
+		result, err := reportService.ResolveToolReports(ctx, 5678)
+		c.Assert(err, qt.IsNil)
+		c.Assert(result.ModifiedCount, qt.Equals, int64(1))
+
+		// Resolved reports are no longer in the registry
+		_, err = reportService.GetActiveReportByToolID(ctx, 5678)
+		c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+		reports, err := reportService.SearchBySerialNumber(ctx, "LOST-1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(reports), qt.Equals, 0)
+	})
+}
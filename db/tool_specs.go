@@ -0,0 +1,61 @@
+package db
+
+// ToolCondition is the state of wear of a tool.
+type ToolCondition string
+
+const (
+	ConditionNew     ToolCondition = "new"
+	ConditionLikeNew ToolCondition = "likeNew"
+	ConditionGood    ToolCondition = "good"
+	ConditionFair    ToolCondition = "fair"
+	ConditionPoor    ToolCondition = "poor"
+)
+
+// IsValidToolCondition returns true if the condition is a known tool condition.
+func IsValidToolCondition(condition ToolCondition) bool {
+	switch condition {
+	case ConditionNew, ConditionLikeNew, ConditionGood, ConditionFair, ConditionPoor:
+		return true
+	}
+	return false
+}
+
+// PowerType is how a tool is powered.
+type PowerType string
+
+const (
+	PowerManual    PowerType = "manual"
+	PowerElectric  PowerType = "electric"
+	PowerBattery   PowerType = "battery"
+	PowerFuel      PowerType = "fuel"
+	PowerPneumatic PowerType = "pneumatic"
+)
+
+// IsValidPowerType returns true if the power type is a known power type.
+func IsValidPowerType(powerType PowerType) bool {
+	switch powerType {
+	case PowerManual, PowerElectric, PowerBattery, PowerFuel, PowerPneumatic:
+		return true
+	}
+	return false
+}
+
+// ToolSpecs are the structured attributes of a tool, every one optional.
+type ToolSpecs struct {
+	Condition ToolCondition `bson:"condition,omitempty" json:"condition,omitempty"`
+	Brand     string        `bson:"brand,omitempty" json:"brand,omitempty"`
+	Model     string        `bson:"model,omitempty" json:"model,omitempty"`
+	// Year is the year the tool was manufactured or bought
+	Year      int       `bson:"year,omitempty" json:"year,omitempty"`
+	PowerType PowerType `bson:"powerType,omitempty" json:"powerType,omitempty"`
+	// Accessories are the accessories lent with the tool
+	Accessories []string `bson:"accessories,omitempty" json:"accessories,omitempty"`
+	// Consumables are the consumables the renter must bring, i.e. blades or fuel
+	Consumables []string `bson:"consumables,omitempty" json:"consumables,omitempty"`
+}
+
+// IsEmpty returns true if no attribute is set.
+func (s *ToolSpecs) IsEmpty() bool {
+	return s == nil || (s.Condition == "" && s.Brand == "" && s.Model == "" && s.Year == 0 &&
+		s.PowerType == "" && len(s.Accessories) == 0 && len(s.Consumables) == 0)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"math"
 	"testing"
+	"time"
 
 	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -358,4 +360,392 @@ func TestSearchToolsByLocation(t *testing.T) {
 			}
 		}
 	})
+
+	// Test paginated search with distance
+	t.Run("Search is paginated and includes distance", func(t *testing.T) {
+		opts := SearchToolsOptions{
+			Location: &baseLocation,
+			Distance: 30000,
+			PageSize: 3,
+		}
+		page0, total, err := toolService.SearchTools(ctx, opts)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, total, qt.Equals, int64(4))
+		qt.Assert(t, len(page0), qt.Equals, 3)
+		qt.Assert(t, page0[0].Title, qt.Equals, "Tool at origin")
+		qt.Assert(t, page0[1].Distance > 4900 && page0[1].Distance < 5100, qt.IsTrue,
+			qt.Commentf("unexpected distance %f", page0[1].Distance))
+
+		opts.Page = 1
+		page1, total, err := toolService.SearchTools(ctx, opts)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, total, qt.Equals, int64(4))
+		qt.Assert(t, len(page1), qt.Equals, 1)
+		qt.Assert(t, page1[0].Title, qt.Equals, "Tool at 25km north")
+
+		opts.Page = 2
+		empty, total, err := toolService.SearchTools(ctx, opts)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, total, qt.Equals, int64(4))
+		qt.Assert(t, len(empty), qt.Equals, 0)
+	})
+
+	// Test the aggregate rating and the sort by rating
+	t.Run("Search sorted by rating", func(t *testing.T) {
+		for _, r := range []struct {
+			id     int64
+			rating int
+		}{{3, 4}, {3, 5}, {2, 3}, {4, 5}} {
+			qt.Assert(t, toolService.AddRating(ctx, r.id, r.rating), qt.IsNil)
+		}
+		tool, err := toolService.GetToolByID(ctx, 3)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, tool.RatingCount, qt.Equals, int64(2))
+		qt.Assert(t, *tool.RatingAverage, qt.Equals, 4.5)
+
+		found, _, err := toolService.SearchTools(ctx, SearchToolsOptions{
+			Location:     &baseLocation,
+			Distance:     30000,
+			SortByRating: true,
+		})
+		qt.Assert(t, err, qt.IsNil)
+		titles := []string{}
+		for _, f := range found {
+			titles = append(titles, f.Title)
+		}
+		// The unrated tool goes last
+		qt.Assert(t, titles, qt.DeepEquals, []string{
+			"Tool at 25km north", "Tool at 15km north", "Tool at 5km north", "Tool at origin",
+		})
+	})
+}
+
+func TestToolIdentifiers(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	database, err := New(mongoURI)
+	c.Assert(err, qt.IsNil)
+	defer func() { _ = database.Close(ctx) }()
+	c.Assert(database.CreateTables(), qt.IsNil)
+
+	owner1 := primitive.NewObjectID()
+	owner2 := primitive.NewObjectID()
+	for i, tool := range []*Tool{
+		{ID: 1, UserID: owner1, Title: "drill", SerialNumber: "SN-1", AssetTag: "LIB-1"},
+		{ID: 2, UserID: owner1, Title: "saw"},
+		{ID: 3, UserID: owner2, Title: "drill", SerialNumber: "SN-1"},
+	} {
+		tool.Location = NewLocation(41695384, 2492793)
+		_, err := database.ToolService.InsertTool(ctx, tool)
+		c.Assert(err, qt.IsNil, qt.Commentf("Failed to insert tool %d", i))
+	}
+
+	c.Run("Identifiers are unique per owner", func(c *qt.C) {
+		taken, err := database.ToolService.IsIdentifierTaken(ctx, owner1, "serialNumber", "SN-1", 2)
+		c.Assert(err, qt.IsNil)
+		c.Assert(taken, qt.IsTrue)
+
+		// The tool owning the identifier is excluded
+		taken, err = database.ToolService.IsIdentifierTaken(ctx, owner1, "serialNumber", "SN-1", 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(taken, qt.IsFalse)
+
+		// The unique index rejects duplicates of the same owner
+		_, err = database.ToolService.InsertTool(ctx, &Tool{
+			ID: 4, UserID: owner1, AssetTag: "LIB-1", Location: NewLocation(41695384, 2492793),
+		})
+		c.Assert(mongo.IsDuplicateKeyError(err), qt.IsTrue)
+	})
+
+	c.Run("Search by identifier", func(c *qt.C) {
+		tools, err := database.ToolService.GetToolsByIdentifier(ctx, "SN-1", "")
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(tools), qt.Equals, 2)
+
+		tools, err = database.ToolService.GetToolsByIdentifier(ctx, "SN-1", "LIB-1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(tools), qt.Equals, 1)
+		c.Assert(tools[0].ID, qt.Equals, int64(1))
+
+		_, err = database.ToolService.GetToolsByIdentifier(ctx, "", "")
+		c.Assert(err, qt.Not(qt.IsNil))
+	})
+}
+
+func TestToolMap(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	database, err := New(mongoURI)
+	c.Assert(err, qt.IsNil)
+	defer func() { _ = database.Close(ctx) }()
+	c.Assert(database.CreateTables(), qt.IsNil)
+
+	owner := primitive.NewObjectID()
+	for _, tool := range []*Tool{
+		// Three tools in Barcelona, one in Girona and one in Madrid (outside the box)
+		{ID: 1, Title: "drill", ToolCategory: 1, Location: NewLocation(41385100, 2173400)},
+		{ID: 2, Title: "saw", ToolCategory: 2, Location: NewLocation(41387000, 2170000)},
+		{ID: 3, Title: "ladder", ToolCategory: 1, Location: NewLocation(41390000, 2180000)},
+		{ID: 4, Title: "mower", ToolCategory: 1, Location: NewLocation(41979400, 2821400)},
+		{ID: 5, Title: "trailer", ToolCategory: 1, Location: NewLocation(40416800, -3703800)},
+	} {
+		tool.UserID = owner
+		tool.IsAvailable = true
+		_, err := database.ToolService.InsertTool(ctx, tool)
+		c.Assert(err, qt.IsNil)
+	}
+	catalonia := BoundingBox{MinLat: 40.5, MinLon: 0.1, MaxLat: 42.9, MaxLon: 3.4}
+
+	// Tools are grouped by geohash cell
+	clusters, err := database.ToolService.ClusterTools(ctx, SearchToolsOptions{}, catalonia, 4)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(clusters), qt.Equals, 2)
+	byHash := map[string]*ToolCluster{}
+	for _, cluster := range clusters {
+		byHash[cluster.Geohash] = cluster
+	}
+	barcelona, girona := byHash["sp3e"], byHash["sp6n"]
+	c.Assert(barcelona, qt.Not(qt.IsNil))
+	c.Assert(barcelona.Count, qt.Equals, int64(3))
+	c.Assert(barcelona.ToolID, qt.Equals, int64(0))
+	c.Assert(math.Abs(barcelona.Latitude-41.3874) < 0.001, qt.IsTrue)
+	c.Assert(girona, qt.Not(qt.IsNil))
+	c.Assert(girona.Count, qt.Equals, int64(1))
+	c.Assert(girona.ToolID, qt.Equals, int64(4))
+
+	// Search filters are applied
+	clusters, err = database.ToolService.ClusterTools(ctx, SearchToolsOptions{Categories: []int{2}}, catalonia, 4)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(clusters), qt.Equals, 1)
+	c.Assert(clusters[0].ToolID, qt.Equals, int64(2))
+
+	// Individual tools are limited
+	tools, truncated, err := database.ToolService.GetToolsInBox(ctx, SearchToolsOptions{}, catalonia, 10)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(tools), qt.Equals, 4)
+	c.Assert(truncated, qt.IsFalse)
+	tools, truncated, err = database.ToolService.GetToolsInBox(ctx, SearchToolsOptions{}, catalonia, 2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(tools), qt.Equals, 2)
+	c.Assert(truncated, qt.IsTrue)
+
+	// Boxes crossing the antimeridian wrap around
+	tools, _, err = database.ToolService.GetToolsInBox(ctx, SearchToolsOptions{},
+		BoundingBox{MinLat: 40, MinLon: 2.5, MaxLat: 43, MaxLon: -3}, 10)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(tools), qt.Equals, 2) // Girona and Madrid
+}
+
+func TestSearchToolFacets(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	database, err := New(mongoURI)
+	c.Assert(err, qt.IsNil)
+	defer func() { _ = database.Close(ctx) }()
+	c.Assert(database.CreateTables(), qt.IsNil)
+
+	owner := primitive.NewObjectID()
+	yesterday := time.Now().Add(-24 * time.Hour)
+	for _, tool := range []*Tool{
+		// Three tools in Barcelona and one in Girona (about 85 km away)
+		{ID: 1, Title: "drill", ToolCategory: 1, Cost: 0, Location: NewLocation(41385100, 2173400)},
+		{ID: 2, Title: "saw", ToolCategory: 2, Cost: 5, Location: NewLocation(41387000, 2170000)},
+		{
+			ID: 3, Title: "ladder", ToolCategory: 1, Cost: 30, Location: NewLocation(41390000, 2180000),
+			Maintenance: &ToolMaintenance{StartDate: yesterday},
+		},
+		{ID: 4, Title: "mower", ToolCategory: 1, Cost: 5, Location: NewLocation(41979400, 2821400)},
+	} {
+		tool.UserID = owner
+		tool.IsAvailable = true
+		_, err := database.ToolService.InsertTool(ctx, tool)
+		c.Assert(err, qt.IsNil)
+	}
+	barcelona := NewLocation(41385100, 2173400)
+	prices := []int64{0, 1, 10}
+	distances := []int64{0, 10000}
+
+	facets, err := database.ToolService.SearchToolFacets(ctx, SearchToolsOptions{Location: &barcelona}, prices, distances)
+	c.Assert(err, qt.IsNil)
+	c.Assert(facets.Total, qt.Equals, int64(4))
+	c.Assert(facets.Categories, qt.DeepEquals, []*CategoryCount{{ID: 1, Count: 3}, {ID: 2, Count: 1}})
+	c.Assert(facets.Prices, qt.DeepEquals, []*FacetBucket{{Min: 0, Count: 1}, {Min: 1, Count: 2}, {Min: 10, Count: 1}})
+	c.Assert(facets.Distances, qt.DeepEquals, []*FacetBucket{{Min: 0, Count: 3}, {Min: 10000, Count: 1}})
+	c.Assert(facets.Available, qt.Equals, int64(3))
+	c.Assert(facets.InMaintenance, qt.Equals, int64(1))
+
+	// The search filters are applied, and without location there are no distances
+	facets, err = database.ToolService.SearchToolFacets(ctx, SearchToolsOptions{Categories: []int{1}}, prices, distances)
+	c.Assert(err, qt.IsNil)
+	c.Assert(facets.Total, qt.Equals, int64(3))
+	c.Assert(facets.Categories, qt.DeepEquals, []*CategoryCount{{ID: 1, Count: 3}})
+	c.Assert(facets.Prices, qt.DeepEquals, []*FacetBucket{{Min: 0, Count: 1}, {Min: 1, Count: 1}, {Min: 10, Count: 1}})
+	c.Assert(facets.Distances, qt.HasLen, 0)
+
+	// Nothing matches
+	facets, err = database.ToolService.SearchToolFacets(ctx, SearchToolsOptions{SearchTerm: "hammer"}, prices, distances)
+	c.Assert(err, qt.IsNil)
+	c.Assert(facets.Total, qt.Equals, int64(0))
+	c.Assert(facets.Categories, qt.HasLen, 0)
+	c.Assert(facets.Prices, qt.DeepEquals, []*FacetBucket{{Min: 0, Count: 0}, {Min: 1, Count: 0}, {Min: 10, Count: 0}})
+}
+
+func TestNewTools(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	database, err := New(mongoURI)
+	c.Assert(err, qt.IsNil)
+	defer func() { _ = database.Close(ctx) }()
+	c.Assert(database.CreateTables(), qt.IsNil)
+
+	barcelona := NewLocation(41385063, 2173404)
+	girona := NewLocation(41979401, 2821426)
+	user, member, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	since := time.Now()
+	old := since.Add(-time.Hour)
+	for _, tool := range []*Tool{
+		{ID: 1, UserID: other, Title: "near", Location: barcelona},
+		{ID: 2, UserID: other, Title: "far", Location: girona},
+		{ID: 3, UserID: member, Title: "member", Location: girona},
+		{ID: 4, UserID: other, Title: "community", Location: girona, Community: "garden"},
+		{ID: 5, UserID: user, Title: "own", Location: barcelona},
+		{ID: 6, UserID: other, Title: "old", Location: barcelona, CreatedAt: &old},
+	} {
+		tool.IsAvailable = true
+		_, err := database.ToolService.InsertTool(ctx, tool)
+		c.Assert(err, qt.IsNil)
+	}
+	titles := func(tools []*Tool) []string {
+		result := []string{}
+		for _, tool := range tools {
+			result = append(result, tool.Title)
+		}
+		return result
+	}
+
+	opts := NewToolsOptions{
+		Since:         since.Add(-time.Minute),
+		Location:      barcelona,
+		Radius:        10000,
+		ExcludeUserID: user,
+		Limit:         10,
+	}
+	tools, total, err := database.ToolService.GetNewTools(ctx, opts)
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(1))
+	c.Assert(titles(tools), qt.DeepEquals, []string{"near"})
+
+	// The community tools are included at any distance
+	opts.Community, opts.Members = "garden", []primitive.ObjectID{member}
+	tools, total, err = database.ToolService.GetNewTools(ctx, opts)
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(3))
+	c.Assert(titles(tools), qt.HasLen, 3)
+	c.Assert(titles(tools), qt.Not(qt.Contains), "far")
+
+	opts.Limit = 1
+	tools, total, err = database.ToolService.GetNewTools(ctx, opts)
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(3))
+	c.Assert(tools, qt.HasLen, 1)
+}
+
+func TestUpdateToolVersion(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	database, err := New(mongoURI)
+	c.Assert(err, qt.IsNil)
+	defer func() { _ = database.Close(ctx) }()
+	c.Assert(database.CreateTables(), qt.IsNil)
+
+	// The tools without version are at the version 0
+	_, err = database.ToolService.InsertTool(ctx, &Tool{ID: 1, Title: "drill", Location: NewLocation(41695384, 2492793)})
+	c.Assert(err, qt.IsNil)
+	c.Assert(database.ToolService.UpdateToolVersion(ctx, 1, 0, map[string]interface{}{"title": "hammer drill"}), qt.IsNil)
+	tool, err := database.ToolService.GetToolByID(ctx, 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tool.Title, qt.Equals, "hammer drill")
+	c.Assert(tool.Version, qt.Equals, int64(1))
+
+	// Only one of the updates of the same version is applied
+	err = database.ToolService.UpdateToolVersion(ctx, 1, 0, map[string]interface{}{"title": "stale"})
+	c.Assert(err, qt.Equals, ErrVersionConflict)
+	c.Assert(database.ToolService.UpdateToolVersion(ctx, 1, 1, map[string]interface{}{"title": "drill"}), qt.IsNil)
+	tool, err = database.ToolService.GetToolByID(ctx, 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tool.Title, qt.Equals, "drill")
+	c.Assert(tool.Version, qt.Equals, int64(2))
+
+	err = database.ToolService.UpdateToolVersion(ctx, 2, 0, map[string]interface{}{"title": "missing"})
+	c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+}
+
+func TestAvailabilityRules(t *testing.T) {
+	c := qt.New(t)
+
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	var anyDay *AvailabilityRules
+	c.Assert(anyDay.FirstUnavailableDay(date(8, 1), date(8, 20)), qt.IsNil)
+
+	// Only weekends, not in August. June 8th 2024 is a Saturday
+	rules := &AvailabilityRules{Weekdays: []int{0, 6}, ExcludedMonths: []int{8}}
+	c.Assert(rules.FirstUnavailableDay(date(6, 8), date(6, 10)), qt.IsNil)
+	c.Assert(rules.FirstUnavailableDay(date(6, 8).Add(10*time.Hour), date(6, 9).Add(18*time.Hour)), qt.IsNil)
+	c.Assert(*rules.FirstUnavailableDay(date(6, 8), date(6, 10).Add(time.Hour)), qt.Equals, date(6, 10))
+	c.Assert(*rules.FirstUnavailableDay(date(6, 7), date(6, 9)), qt.Equals, date(6, 7))
+	// The start day counts even for dates ending when they start
+	c.Assert(*rules.FirstUnavailableDay(date(6, 12), date(6, 12)), qt.Equals, date(6, 12))
+	c.Assert(*rules.FirstUnavailableDay(date(8, 3), date(8, 5)), qt.Equals, date(8, 3))
 }
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TransferStatus is the status of a tool transfer.
+type TransferStatus string
+
+const (
+	TransferStatusPending   TransferStatus = "PENDING"
+	TransferStatusAccepted  TransferStatus = "ACCEPTED"
+	TransferStatusRejected  TransferStatus = "REJECTED"
+	TransferStatusCancelled TransferStatus = "CANCELLED"
+)
+
+// ToolTransfer represents the schema for the "tool_transfers" collection. It is the offer of
+// the owner of a tool to give it to another user, who must accept it. A tool has at most one
+// pending transfer.
+type ToolTransfer struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ToolID      int64              `bson:"toolId" json:"toolId"`
+	ToolTitle   string             `bson:"toolTitle" json:"toolTitle"`
+	FromUserID  primitive.ObjectID `bson:"fromUserId" json:"fromUserId"`
+	ToUserID    primitive.ObjectID `bson:"toUserId" json:"toUserId"`
+	Message     string             `bson:"message,omitempty" json:"message,omitempty"`
+	Status      TransferStatus     `bson:"status" json:"status"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	RespondedAt *time.Time         `bson:"respondedAt,omitempty" json:"respondedAt,omitempty"`
+	// NewToolID is the ID of the tool once transferred, it depends on the owner.
+	NewToolID int64 `bson:"newToolId,omitempty" json:"newToolId,omitempty"`
+}
+
+// ToolTransferService provides methods to interact with the "tool_transfers" collection.
+type ToolTransferService struct {
+	Collection *mongo.Collection
+}
+
+// NewToolTransferService creates a new ToolTransferService.
+func NewToolTransferService(db *Database) *ToolTransferService {
+	return &ToolTransferService{
+		Collection: db.Database.Collection("tool_transfers"),
+	}
+}
+
+// CreateTransfer inserts a new pending transfer. It returns ErrTransferPending if the tool
+// already has a pending transfer.
+func (s *ToolTransferService) CreateTransfer(ctx context.Context, t *ToolTransfer) error {
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	t.Status = TransferStatusPending
+	result, err := s.Collection.InsertOne(ctx, t)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrTransferPending
+	}
+	if err != nil {
+		return err
+	}
+	t.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetTransfer retrieves a transfer by its ID. It returns mongo.ErrNoDocuments if not found.
+func (s *ToolTransferService) GetTransfer(ctx context.Context, id primitive.ObjectID) (*ToolTransfer, error) {
+	var transfer ToolTransfer
+	if err := s.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(&transfer); err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+// GetUserTransfers retrieves the pending transfers offered by or to the user, newest first.
+func (s *ToolTransferService) GetUserTransfers(ctx context.Context, userID primitive.ObjectID) ([]*ToolTransfer, error) {
+	cursor, err := s.Collection.Find(ctx,
+		bson.M{
+			"status": TransferStatusPending,
+			"$or":    []bson.M{{"fromUserId": userID}, {"toUserId": userID}},
+		},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	transfers := []*ToolTransfer{}
+	if err := cursor.All(ctx, &transfers); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+// SetStatus moves a pending transfer to the given status. It returns mongo.ErrNoDocuments if
+// the transfer is no longer pending.
+func (s *ToolTransferService) SetStatus(ctx context.Context, id primitive.ObjectID, status TransferStatus) error {
+	result, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": TransferStatusPending},
+		bson.M{"$set": bson.M{"status": status, "respondedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Reopen moves an accepted transfer back to pending, when the tool could not be moved to the
+// recipient.
+func (s *ToolTransferService) Reopen(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": TransferStatusAccepted},
+		bson.M{"$set": bson.M{"status": TransferStatusPending}, "$unset": bson.M{"respondedAt": ""}},
+	)
+	return err
+}
+
+// SetNewToolID records the ID of the transferred tool.
+func (s *ToolTransferService) SetNewToolID(ctx context.Context, id primitive.ObjectID, toolID int64) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"newToolId": toolID}})
+	return err
+}
+
+// UpdateToolID moves the pending transfers of a tool to its new ID (the tool ID changes with
+// its title).
+func (s *ToolTransferService) UpdateToolID(ctx context.Context, oldID, newID int64) error {
+	_, err := s.Collection.UpdateMany(ctx,
+		bson.M{"toolId": oldID, "status": TransferStatusPending},
+		bson.M{"$set": bson.M{"toolId": newID}},
+	)
+	return err
+}
+
+// CancelToolTransfers cancels the pending transfers of a tool, i.e. when it is deleted or
+// given to another user.
+func (s *ToolTransferService) CancelToolTransfers(ctx context.Context, toolID int64) error {
+	_, err := s.Collection.UpdateMany(ctx,
+		bson.M{"toolId": toolID, "status": TransferStatusPending},
+		bson.M{"$set": bson.M{"status": TransferStatusCancelled, "respondedAt": time.Now()}},
+	)
+	return err
+}
+
+// CancelUserTransfers cancels the pending transfers offered by or to the user.
+func (s *ToolTransferService) CancelUserTransfers(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.UpdateMany(ctx,
+		bson.M{
+			"status": TransferStatusPending,
+			"$or":    []bson.M{{"fromUserId": userID}, {"toUserId": userID}},
+		},
+		bson.M{"$set": bson.M{"status": TransferStatusCancelled, "respondedAt": time.Now()}},
+	)
+	return err
+}
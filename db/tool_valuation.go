@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ValuationSource is the origin of a valuation of a tool.
+type ValuationSource string
+
+const (
+	// ValuationCreated is the estimated value given when the tool was published.
+	ValuationCreated ValuationSource = "CREATED"
+	// ValuationEdited is an estimated value changed by the owner or a manager of the tool.
+	ValuationEdited ValuationSource = "EDITED"
+	// ValuationDepreciation is the yearly depreciation suggested by the app and applied by the
+	// owner or a manager of the tool.
+	ValuationDepreciation ValuationSource = "DEPRECIATION"
+)
+
+// ToolValuation represents the schema for the "tool_valuations" collection. Each entry records
+// a change of the estimated value of a tool, the current valuation being the estimated value
+// of the tool.
+type ToolValuation struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ToolID int64              `bson:"toolId" json:"toolId"`
+	// UserID is the user who changed the valuation.
+	UserID primitive.ObjectID `bson:"userId" json:"userId"`
+	Value  uint64             `bson:"value" json:"value"`
+	// Previous is the estimated value before the change, 0 for the first valuation.
+	Previous  uint64          `bson:"previous,omitempty" json:"previous,omitempty"`
+	Source    ValuationSource `bson:"source" json:"source"`
+	CreatedAt time.Time       `bson:"createdAt" json:"createdAt"`
+}
+
+// ToolValuationService provides methods to interact with the "tool_valuations" collection.
+type ToolValuationService struct {
+	Collection *mongo.Collection
+}
+
+// NewToolValuationService creates a new ToolValuationService.
+func NewToolValuationService(db *Database) *ToolValuationService {
+	return &ToolValuationService{
+		Collection: db.Database.Collection("tool_valuations"),
+	}
+}
+
+// InsertValuation inserts a new ToolValuation document.
+func (s *ToolValuationService) InsertValuation(ctx context.Context, valuation *ToolValuation) error {
+	if valuation.CreatedAt.IsZero() {
+		valuation.CreatedAt = time.Now()
+	}
+	result, err := s.Collection.InsertOne(ctx, valuation)
+	if err != nil {
+		return err
+	}
+	valuation.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetToolValuations gets the paginated valuation history of a tool, newest first.
+func (s *ToolValuationService) GetToolValuations(ctx context.Context, toolID int64, page int) ([]*ToolValuation, error) {
+	if page < 0 {
+		page = 0
+	}
+	cursor, err := s.Collection.Find(ctx, bson.M{"toolId": toolID},
+		options.Find().
+			SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+			SetSkip(int64(page*DefaultPageSize)).
+			SetLimit(int64(DefaultPageSize)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	valuations := []*ToolValuation{}
+	if err := cursor.All(ctx, &valuations); err != nil {
+		return nil, err
+	}
+	return valuations, nil
+}
+
+// LastValuation returns the latest valuation of a tool, or nil if the tool has no valuation
+// history (i.e. it was published before the history was introduced).
+func (s *ToolValuationService) LastValuation(ctx context.Context, toolID int64) (*ToolValuation, error) {
+	var valuation ToolValuation
+	err := s.Collection.FindOne(ctx, bson.M{"toolId": toolID},
+		options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})).Decode(&valuation)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &valuation, nil
+}
+
+// UpdateToolID moves the valuation history of a tool to its new ID.
+func (s *ToolValuationService) UpdateToolID(ctx context.Context, oldID, newID int64) error {
+	_, err := s.Collection.UpdateMany(ctx, bson.M{"toolId": oldID}, bson.M{"$set": bson.M{"toolId": newID}})
+	return err
+}
+
+// DeleteToolValuations deletes the valuation history of a tool.
+func (s *ToolValuationService) DeleteToolValuations(ctx context.Context, toolID int64) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"toolId": toolID})
+	return err
+}
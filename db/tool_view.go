@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ToolViewTTL is the time the views of the tools are kept, the window used to rank the tools
+// by popularity.
+const ToolViewTTL = 30 * 24 * time.Hour
+
+// ToolView represents the schema for the "tool_views" collection. It records that a user
+// viewed the details of a tool on a day (UTC), so each user counts once per tool and day.
+type ToolView struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	ToolID    int64              `bson:"toolId"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	Day       string             `bson:"day"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+// ToolViewCount is the number of views of a tool.
+type ToolViewCount struct {
+	ToolID int64 `bson:"_id"`
+	Views  int64 `bson:"views"`
+}
+
+// ToolViewService provides methods to interact with the "tool_views" collection.
+type ToolViewService struct {
+	Collection *mongo.Collection
+}
+
+// NewToolViewService creates a new ToolViewService.
+func NewToolViewService(db *Database) *ToolViewService {
+	return &ToolViewService{
+		Collection: db.Database.Collection("tool_views"),
+	}
+}
+
+// RecordView records a view of the tool by the user and increases the view count of the tool.
+// Returns false, without counting it again, if the user already viewed the tool that day.
+func (s *ToolViewService) RecordView(ctx context.Context, toolID int64, userID primitive.ObjectID, now time.Time) (bool, error) {
+	_, err := s.Collection.InsertOne(ctx, &ToolView{
+		ToolID:    toolID,
+		UserID:    userID,
+		Day:       now.UTC().Format(time.DateOnly),
+		CreatedAt: now,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// The view count is not a change of the tool, its updatedAt is kept
+	_, err = s.Collection.Database().Collection("tools").UpdateOne(ctx,
+		bson.M{"_id": toolID},
+		bson.M{"$inc": bson.M{"viewCount": 1}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to increase the view count: %w", err)
+	}
+	return true, nil
+}
+
+// CountViewsSince returns the number of views of each tool since the given time.
+func (s *ToolViewService) CountViewsSince(ctx context.Context, since time.Time) ([]*ToolViewCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"createdAt": bson.M{"$gte": since}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$toolId"},
+			{Key: "views", Value: bson.M{"$sum": 1}},
+		}}},
+	}
+	cursor, err := s.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate tool views: %w", err)
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	result := []*ToolViewCount{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse aggregation result: %w", err)
+	}
+	return result, nil
+}
+
+// UpdateToolID moves the views of a tool to its new ID (the tool ID changes with its title).
+func (s *ToolViewService) UpdateToolID(ctx context.Context, oldID, newID int64) error {
+	_, err := s.Collection.UpdateMany(ctx, bson.M{"toolId": oldID}, bson.M{"$set": bson.M{"toolId": newID}})
+	return err
+}
+
+// DeleteToolViews removes all the views of a tool.
+func (s *ToolViewService) DeleteToolViews(ctx context.Context, toolID int64) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"toolId": toolID})
+	return err
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestToolViewService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation, with the indexes that deduplicate the views
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	c.Assert(EnsureIndexes(ctx, database), qt.IsNil)
+	viewService := NewToolViewService(database)
+	toolService := NewToolService(database)
+	location := NewLocation(41385063, 2173404)
+	for _, id := range []int64{1, 2} {
+		_, err := toolService.InsertTool(ctx, &Tool{ID: id, Title: "tool", IsAvailable: true, Location: location})
+		c.Assert(err, qt.IsNil)
+	}
+
+	// Each user counts once per tool and day
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	for _, view := range []struct {
+		toolID int64
+		userID primitive.ObjectID
+		time   time.Time
+		added  bool
+	}{
+		{1, first, now, true},
+		{1, first, now.Add(time.Hour), false},
+		{1, second, now, true},
+		{1, first, now.Add(24 * time.Hour), true},
+		{2, first, now, true},
+	} {
+		added, err := viewService.RecordView(ctx, view.toolID, view.userID, view.time)
+		c.Assert(err, qt.IsNil)
+		c.Assert(added, qt.Equals, view.added)
+	}
+	tool, err := toolService.GetToolByID(ctx, 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tool.ViewCount, qt.Equals, int64(3))
+	c.Assert(tool.UpdatedAt, qt.IsNil)
+
+	counts, err := viewService.CountViewsSince(ctx, now.Add(time.Minute))
+	c.Assert(err, qt.IsNil)
+	c.Assert(counts, qt.DeepEquals, []*ToolViewCount{{ToolID: 1, Views: 1}})
+
+	// The popularity of the tools not given is reset
+	c.Assert(toolService.SetPopularity(ctx, map[int64]float64{1: 3, 2: 8}), qt.IsNil)
+	c.Assert(toolService.SetPopularity(ctx, map[int64]float64{1: 4}), qt.IsNil)
+	tools, _, err := toolService.SearchTools(ctx, SearchToolsOptions{SortByPopularity: true})
+	c.Assert(err, qt.IsNil)
+	c.Assert(tools, qt.HasLen, 2)
+	c.Assert(tools[0].ID, qt.Equals, int64(1))
+	c.Assert(tools[0].Popularity, qt.Equals, 4.0)
+	c.Assert(tools[1].Popularity, qt.Equals, 0.0)
+
+	c.Assert(viewService.UpdateToolID(ctx, 1, 3), qt.IsNil)
+	c.Assert(viewService.DeleteToolViews(ctx, 3), qt.IsNil)
+	count, err := viewService.Collection.CountDocuments(ctx, bson.M{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(count, qt.Equals, int64(1))
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ToolVisibility is who can find, see and book a tool.
+type ToolVisibility string
+
+const (
+	// VisibilityPublic tools are visible to every user and to the federation peers.
+	VisibilityPublic ToolVisibility = "public"
+	// VisibilityCommunity tools are only visible to the members of the community owning the
+	// tool or, on personal tools, of the owner community.
+	VisibilityCommunity ToolVisibility = "community"
+	// VisibilityCommunities tools are only visible to the members of the communities the tool
+	// is visible to.
+	VisibilityCommunities ToolVisibility = "communities"
+)
+
+// IsValidToolVisibility returns true if the visibility is a known tool visibility.
+func IsValidToolVisibility(visibility ToolVisibility) bool {
+	switch visibility {
+	case VisibilityPublic, VisibilityCommunity, VisibilityCommunities:
+		return true
+	}
+	return false
+}
+
+// ToolViewer is the user searching the tools, that also finds the tools restricted to its
+// community.
+type ToolViewer struct {
+	Community string
+	// Members are the members of the community, the owners of the personal tools visible to
+	// the community.
+	Members []primitive.ObjectID
+}
+
+// visibilityFilter matches the tools visible to the viewer, only the public tools if the
+// viewer is nil or has no community.
+func visibilityFilter(viewer *ToolViewer) bson.A {
+	filter := bson.A{bson.M{"visibility": bson.M{"$nin": bson.A{VisibilityCommunity, VisibilityCommunities}}}}
+	if viewer == nil || viewer.Community == "" {
+		return filter
+	}
+	return append(filter,
+		bson.M{"visibility": VisibilityCommunity, "$or": bson.A{
+			bson.M{"community": viewer.Community},
+			bson.M{"community": bson.M{"$exists": false}, "userId": bson.M{"$in": viewer.Members}},
+		}},
+		bson.M{"visibility": VisibilityCommunities, "visibleTo": viewer.Community},
+	)
+}
+
+// MigrateToolVisibility sets the visibility of the tools created before it was introduced:
+// the community tools, which only the members could book, are visible to their community and
+// the personal tools are public. It returns the number of tools migrated, none once all of
+// them are.
+func (s *ToolService) MigrateToolVisibility(ctx context.Context) (int64, error) {
+	var migrated int64
+	for visibility, community := range map[ToolVisibility]bool{
+		VisibilityCommunity: true,
+		VisibilityPublic:    false,
+	} {
+		result, err := s.Collection.UpdateMany(ctx,
+			bson.M{"visibility": bson.M{"$exists": false}, "community": bson.M{"$exists": community}},
+			bson.M{"$set": bson.M{"visibility": visibility}},
+		)
+		if err != nil {
+			return migrated, err
+		}
+		migrated += result.ModifiedCount
+	}
+	return migrated, nil
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestToolVisibility(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	toolService := NewToolService(database)
+
+	member, stranger := primitive.NewObjectID(), primitive.NewObjectID()
+	_, err = toolService.Collection.InsertMany(ctx, []interface{}{
+		// Created before the visibility
+		bson.M{"_id": int64(1), "title": "Ladder", "isAvailable": true, "userId": stranger},
+		bson.M{"_id": int64(2), "title": "Mixer", "isAvailable": true, "userId": stranger, "community": "valley"},
+		// Personal tools visible to the owner community and to other communities
+		bson.M{"_id": int64(3), "title": "Drill", "isAvailable": true, "userId": member, "visibility": "community"},
+		bson.M{
+			"_id": int64(4), "title": "Saw", "isAvailable": true, "userId": stranger,
+			"visibility": "communities", "visibleTo": bson.A{"coast", "valley"},
+		},
+		bson.M{"_id": int64(5), "title": "Hammer", "isAvailable": true, "userId": stranger, "visibility": "community"},
+	})
+	c.Assert(err, qt.IsNil)
+
+	migrated, err := toolService.MigrateToolVisibility(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(migrated, qt.Equals, int64(2))
+	tool, err := toolService.GetToolByID(ctx, 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tool.Visibility, qt.Equals, VisibilityPublic)
+	tool, err = toolService.GetToolByID(ctx, 2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tool.Visibility, qt.Equals, VisibilityCommunity)
+
+	// Migrated once
+	migrated, err = toolService.MigrateToolVisibility(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(migrated, qt.Equals, int64(0))
+
+	search := func(viewer *ToolViewer) []int64 {
+		tools, _, err := toolService.SearchTools(ctx, SearchToolsOptions{Viewer: viewer})
+		c.Assert(err, qt.IsNil)
+		ids := []int64{}
+		for _, tool := range tools {
+			ids = append(ids, tool.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	// Without viewer only the public tools are found
+	c.Assert(search(nil), qt.DeepEquals, []int64{1})
+	c.Assert(search(&ToolViewer{Community: "valley", Members: []primitive.ObjectID{member}}),
+		qt.DeepEquals, []int64{1, 2, 3, 4})
+	c.Assert(search(&ToolViewer{Community: "coast", Members: []primitive.ObjectID{stranger}}),
+		qt.DeepEquals, []int64{1, 4, 5})
+}
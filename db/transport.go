@@ -6,12 +6,34 @@ import (
 	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Transport represents the schema for the "transports" collection.
+// TransportKind is how a tool gets from its owner to the renter.
+type TransportKind string
+
+const (
+	// TransportVehicle is a vehicle the renter needs to carry the tool.
+	TransportVehicle TransportKind = "vehicle"
+	// TransportPickup is the renter picking the tool up, with no delivery.
+	TransportPickup TransportKind = "pickup"
+	// TransportDelivery is the owner delivering the tool, optionally within a distance and
+	// for a fee.
+	TransportDelivery TransportKind = "delivery"
+	// TransportCargoBike is a tool that can be carried on a cargo bike.
+	TransportCargoBike TransportKind = "cargoBike"
+)
+
+// Transport represents the schema for the "transports" collection, the catalog of transport
+// options. The tools keep the options they offer, with the delivery terms of the owner.
 type Transport struct {
-	ID   int64  `bson:"id" json:"id"`
-	Name string `bson:"name" json:"name"`
+	ID   int64         `bson:"id" json:"id"`
+	Name string        `bson:"name" json:"name"`
+	Kind TransportKind `bson:"kind,omitempty" json:"kind,omitempty"`
+	// MaxDistanceKm is the distance the owner delivers the tool to, zero if not limited
+	MaxDistanceKm int `bson:"maxDistanceKm,omitempty" json:"maxDistanceKm,omitempty"`
+	// DeliveryFee is the tokens the owner charges for delivering the tool
+	DeliveryFee uint64 `bson:"deliveryFee,omitempty" json:"deliveryFee,omitempty"`
 }
 
 // TransportService provides methods to interact with the "transports" collection.
@@ -31,6 +53,26 @@ func (s *TransportService) InsertTransport(ctx context.Context, transport *Trans
 	return s.Collection.InsertOne(ctx, transport)
 }
 
+// InitializeDefaultTransports inserts the missing default transports, and sets the kind of the
+// existing ones, which are defined by the code.
+func (s *TransportService) InitializeDefaultTransports(ctx context.Context, defaultTransports []Transport) error {
+	for _, transport := range defaultTransports {
+		_, err := s.Collection.UpdateOne(
+			ctx,
+			bson.M{"id": transport.ID},
+			bson.M{
+				"$setOnInsert": bson.M{"name": transport.Name},
+				"$set":         bson.M{"kind": transport.Kind},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetTransportByID retrieves a Transport by its ID.
 func (s *TransportService) GetTransportByID(ctx context.Context, id int64) (*Transport, error) {
 	var transport Transport
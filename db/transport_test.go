@@ -120,4 +120,24 @@ func TestTransportService(t *testing.T) {
 		_, err = transportService.InsertTransport(ctx, duplicate)
 		c.Assert(err, qt.Not(qt.IsNil), qt.Commentf("Expected error when inserting duplicate transport ID"))
 	})
+
+	c.Run("Initialize Default Transports", func(c *qt.C) {
+		defaults := []Transport{
+			{ID: 1, Name: "Car", Kind: TransportVehicle},
+			{ID: 5, Name: "Owner delivers", Kind: TransportDelivery},
+		}
+		c.Assert(transportService.InitializeDefaultTransports(ctx, defaults), qt.IsNil)
+		// Initializing twice does not duplicate them
+		c.Assert(transportService.InitializeDefaultTransports(ctx, defaults), qt.IsNil)
+
+		// The existing transports keep their name and get their kind
+		transport, err := transportService.GetTransportByID(ctx, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(transport.Name, qt.Equals, "Test Transport")
+		c.Assert(transport.Kind, qt.Equals, TransportVehicle)
+		transport, err = transportService.GetTransportByID(ctx, 5)
+		c.Assert(err, qt.IsNil)
+		c.Assert(transport.Name, qt.Equals, "Owner delivers")
+		c.Assert(transport.Kind, qt.Equals, TransportDelivery)
+	})
 }
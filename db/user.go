@@ -3,6 +3,8 @@ package db
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"time"
 
 	"github.com/emprius/emprius-app-backend/types"
 	"github.com/rs/zerolog/log"
@@ -12,6 +14,14 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// UserRole represents the role of a user in the platform.
+type UserRole string
+
+const (
+	// UserRoleAdmin grants access to the administration endpoints.
+	UserRoleAdmin UserRole = "admin"
+)
+
 // User represents the schema for the "users" collection.
 type User struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
@@ -24,7 +34,85 @@ type User struct {
 	Rating     int32              `bson:"rating" json:"rating" default:"50"`
 	AvatarHash types.HexBytes     `bson:"avatarHash,omitempty" json:"avatarHash,omitempty"`
 	Location   DBLocation         `bson:"location" json:"location"`
+	Locality   string             `bson:"locality,omitempty" json:"locality,omitempty"`
 	Verified   bool               `bson:"verified" json:"verified" default:"false"`
+	Role       UserRole           `bson:"role,omitempty" json:"role,omitempty"`
+	Blocked    bool               `bson:"blocked,omitempty" json:"blocked,omitempty"`
+	DeletedAt  *time.Time         `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	// AvatarSizes are the avatar images resized to the standard sizes, keyed by size name
+	AvatarSizes map[string]types.HexBytes `bson:"avatarSizes,omitempty" json:"avatarSizes,omitempty"`
+	// HideCommunity hides the community from the public profile
+	HideCommunity bool `bson:"hideCommunity,omitempty" json:"hideCommunity,omitempty"`
+	// TrustScore is the 0 to 100 trust score, recalculated periodically (nil until computed).
+	TrustScore     *int       `bson:"trustScore,omitempty" json:"trustScore,omitempty"`
+	TrustUpdatedAt *time.Time `bson:"trustUpdatedAt,omitempty" json:"-"`
+	// Badges are the badges awarded to the user, recalculated periodically.
+	Badges          []UserBadge `bson:"badges,omitempty" json:"-"`
+	BadgesUpdatedAt *time.Time  `bson:"badgesUpdatedAt,omitempty" json:"-"`
+	// NotificationPreferences are the channels chosen by the user for each notification type.
+	// The types not present use the default channels.
+	NotificationPreferences map[NotificationType]NotificationChannels `bson:"notificationPreferences,omitempty" json:"-"`
+	// Digest are the settings of the weekly digest of new nearby tools, nil if never enabled.
+	Digest *DigestPreferences `bson:"digest,omitempty" json:"-"`
+	// Telegram is the Telegram account linked by the user, nil if never linked.
+	Telegram *TelegramLink `bson:"telegram,omitempty" json:"-"`
+	// BlockedUsers are the users blocked by the user, who cannot message each other.
+	BlockedUsers []primitive.ObjectID `bson:"blockedUsers,omitempty" json:"-"`
+	// TermsAcceptances are the terms versions accepted by the user, the latest last.
+	TermsAcceptances []TermsAcceptance `bson:"termsAcceptances,omitempty" json:"-"`
+	// LastActiveAt is the time of the last login or use of a session of the user, nil if the user
+	// was not active since it was tracked. The creation of the account is used then.
+	LastActiveAt *time.Time `bson:"lastActiveAt,omitempty" json:"-"`
+	// InactivityWarnedAt is the time the user was warned that the inactive account will be
+	// anonymized, nil if not warned since the last activity.
+	InactivityWarnedAt *time.Time `bson:"inactivityWarnedAt,omitempty" json:"-"`
+	// Version is increased by each update of the profile, which must give the version it changes
+	// so concurrent updates do not overwrite each other.
+	Version int64 `bson:"version,omitempty" json:"version"`
+}
+
+// AcceptedTermsVersion returns the latest terms version accepted by the user, 0 if none.
+func (u *User) AcceptedTermsVersion() int {
+	if len(u.TermsAcceptances) == 0 {
+		return 0
+	}
+	return u.TermsAcceptances[len(u.TermsAcceptances)-1].Version
+}
+
+// TelegramLink is the Telegram chat the notifications of the user are sent to.
+type TelegramLink struct {
+	// LinkToken is sent by the user to the bot from the deep link, to link the chat.
+	LinkToken string `bson:"linkToken,omitempty"`
+	// ChatID is the chat of the user with the bot, zero until linked.
+	ChatID   int64      `bson:"chatId,omitempty"`
+	LinkedAt *time.Time `bson:"linkedAt,omitempty"`
+}
+
+// DigestPreferences are the settings of the weekly email digest of the new tools published
+// near the user.
+type DigestPreferences struct {
+	Enabled bool `bson:"enabled"`
+	// Radius is the distance in meters to the user location of the tools included.
+	Radius int `bson:"radius"`
+	// Community also includes the tools shared in the community of the user, at any distance.
+	Community bool `bson:"community"`
+	// UnsubscribeToken disables the digest from the link of the emails, without logging in.
+	UnsubscribeToken string `bson:"unsubscribeToken"`
+	// LastSentAt is the time of the last digest, the next one lists the tools published after it.
+	LastSentAt *time.Time `bson:"lastSentAt,omitempty"`
+}
+
+// IsAdmin returns true if the user has the admin role.
+func (u *User) IsAdmin() bool {
+	return u.Role == UserRoleAdmin
+}
+
+// NotificationChannels returns the channels the notifications of the type are delivered to the user.
+func (u *User) NotificationChannels(t NotificationType) NotificationChannels {
+	if channels, ok := u.NotificationPreferences[t]; ok {
+		return channels
+	}
+	return DefaultNotificationChannels(t)
 }
 
 // Validate checks if the user data meets the required constraints
@@ -75,20 +163,26 @@ func (s *UserService) UpdateUser(ctx context.Context, id primitive.ObjectID, upd
 	return s.Collection.UpdateOne(ctx, filter, bson.M{"$set": update})
 }
 
-// GetAllUsers retrieves paginated User documents.
+// UpdateUserVersion updates a User document if it is still at the given version, and increases
+// its version. It returns ErrVersionConflict if the user was updated meanwhile.
+func (s *UserService) UpdateUserVersion(ctx context.Context, id primitive.ObjectID, version int64, update bson.M) error {
+	return updateVersion(ctx, s.Collection, id, version, bson.M{"$set": update})
+}
+
+// GetAllUsers retrieves paginated User documents, excluding the deleted users.
 func (s *UserService) GetAllUsers(ctx context.Context, page int) ([]*User, error) {
 	if page < 0 {
 		page = 0
 	}
 
-	skip := page * defaultPageSize
+	skip := page * DefaultPageSize
 
 	opts := options.Find().
 		SetSort(bson.D{{Key: "_id", Value: 1}}). // Sort by ID for consistent pagination
 		SetSkip(int64(skip)).
-		SetLimit(int64(defaultPageSize))
+		SetLimit(int64(DefaultPageSize))
 
-	cursor, err := s.Collection.Find(ctx, bson.M{}, opts)
+	cursor, err := s.Collection.Find(ctx, bson.M{"deletedAt": bson.M{"$exists": false}}, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -109,15 +203,195 @@ func (s *UserService) GetAllUsers(ctx context.Context, page int) ([]*User, error
 	return users, nil
 }
 
+// SearchUsersOptions are the filters of a user search. Zero values are not filtered.
+type SearchUsersOptions struct {
+	// Name matches the users whose name contains it, case insensitive
+	Name      string
+	Community string
+	Active    *bool
+	MinRating int32
+	// Location sorts the users by distance, up to Distance meters if not zero
+	Location *DBLocation
+	Distance int
+	Page     int
+	PageSize int
+}
+
+// UserSearchResult is a User returned by a search, including its distance (in meters)
+// to the search location. Distance is zero if the search has no location.
+type UserSearchResult struct {
+	User     `bson:",inline"`
+	Distance float64 `bson:"distance,omitempty"`
+}
+
+// userSearchFacet is the result document of the user search $facet stage.
+type userSearchFacet struct {
+	Metadata []struct {
+		Total int64 `bson:"total"`
+	} `bson:"metadata"`
+	Users []*UserSearchResult `bson:"users"`
+}
+
+// userPrivateFields are the fields never returned by a user search.
+var userPrivateFields = bson.D{
+	{Key: "password", Value: 0},
+	{Key: "email", Value: 0},
+	{Key: "tokens", Value: 0},
+	{Key: "notificationPreferences", Value: 0},
+	{Key: "trustUpdatedAt", Value: 0},
+}
+
+// searchFilter builds the MongoDB filter for the given search options.
+func (opts *SearchUsersOptions) searchFilter() bson.M {
+	filter := bson.M{"deletedAt": bson.M{"$exists": false}}
+	if opts.Name != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(opts.Name), "$options": "i"}
+	}
+	// The users hiding their community are not found by it
+	if opts.Community != "" {
+		filter["community"] = opts.Community
+		filter["hideCommunity"] = bson.M{"$ne": true}
+	}
+	if opts.Active != nil {
+		filter["active"] = *opts.Active
+	}
+	if opts.MinRating > 0 {
+		filter["rating"] = bson.M{"$gte": opts.MinRating}
+	}
+	// Only the users with a location can be sorted by distance
+	if opts.Location != nil {
+		filter["location.type"] = "Point"
+	}
+	return filter
+}
+
+// SearchUsers finds users by name, community, active status, rating and distance, without
+// their private fields. The results are sorted by distance if a location is provided.
+// Returns the requested page of results and the total number of matching users.
+func (s *UserService) SearchUsers(ctx context.Context, opts SearchUsersOptions) ([]*UserSearchResult, int64, error) {
+	if opts.Page < 0 {
+		opts.Page = 0
+	}
+	opts.PageSize = PageSize(opts.PageSize)
+	filter := opts.searchFilter()
+
+	var pipeline mongo.Pipeline
+	if opts.Location != nil {
+		geoNear := bson.D{
+			{Key: "near", Value: opts.Location},
+			{Key: "distanceField", Value: "distance"},
+			{Key: "spherical", Value: true},
+			{Key: "query", Value: filter},
+		}
+		if opts.Distance > 0 {
+			geoNear = append(geoNear, bson.E{Key: "maxDistance", Value: float64(opts.Distance)}) // meters
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$geoNear", Value: geoNear}})
+	} else {
+		pipeline = append(pipeline,
+			bson.D{{Key: "$match", Value: filter}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		)
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$project", Value: userPrivateFields}},
+		bson.D{{Key: "$facet", Value: bson.D{
+			{Key: "metadata", Value: bson.A{
+				bson.D{{Key: "$count", Value: "total"}},
+			}},
+			{Key: "users", Value: bson.A{
+				bson.D{{Key: "$skip", Value: int64(opts.Page * opts.PageSize)}},
+				bson.D{{Key: "$limit", Value: int64(opts.PageSize)}},
+			}},
+		}}},
+	)
+
+	cursor, err := s.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var facets []userSearchFacet
+	if err := cursor.All(ctx, &facets); err != nil {
+		return nil, 0, err
+	}
+	if len(facets) == 0 || len(facets[0].Metadata) == 0 {
+		return []*UserSearchResult{}, 0, nil
+	}
+	return facets[0].Users, facets[0].Metadata[0].Total, nil
+}
+
 // DeleteUser deletes a User document by their ID.
 func (s *UserService) DeleteUser(ctx context.Context, id primitive.ObjectID) (*mongo.DeleteResult, error) {
 	filter := bson.M{"_id": id}
 	return s.Collection.DeleteOne(ctx, filter)
 }
 
-// CountUsers returns the total number of users.
+// AnonymizeUser removes the personal data of a deleted user. The document is kept, anonymized
+// and inactive, so the bookings of other users still reference an existing user.
+func (s *UserService) AnonymizeUser(ctx context.Context, id primitive.ObjectID) error {
+	now := time.Now()
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"email":     fmt.Sprintf("deleted-%s@deleted.invalid", id.Hex()),
+			"name":      fmt.Sprintf("Deleted user %s", id.Hex()),
+			"password":  []byte{},
+			"active":    false,
+			"verified":  false,
+			"location":  NewLocation(0, 0),
+			"deletedAt": now,
+		},
+		"$unset": bson.M{
+			"community":               "",
+			"avatarHash":              "",
+			"avatarSizes":             "",
+			"role":                    "",
+			"locality":                "",
+			"trustScore":              "",
+			"badges":                  "",
+			"notificationPreferences": "",
+			"digest":                  "",
+			"telegram":                "",
+			"blockedUsers":            "",
+			"lastActiveAt":            "",
+			"inactivityWarnedAt":      "",
+		},
+	})
+	return err
+}
+
+// CountUsers returns the total number of users, excluding the deleted users.
 func (s *UserService) CountUsers(ctx context.Context) (int64, error) {
-	return s.Collection.CountDocuments(ctx, bson.M{})
+	return s.Collection.CountDocuments(ctx, bson.M{"deletedAt": bson.M{"$exists": false}})
+}
+
+// GetAdmins retrieves the users with the admin role. If community is not empty, the admins
+// of that community are returned.
+func (s *UserService) GetAdmins(ctx context.Context, community string) ([]*User, error) {
+	filter := bson.M{"role": UserRoleAdmin}
+	if community != "" {
+		filter["community"] = community
+	}
+	cursor, err := s.Collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var users []*User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
 }
 
 // GetUserByID retrieves a User by their ID.
@@ -130,3 +404,466 @@ func (s *UserService) GetUserByID(ctx context.Context, id primitive.ObjectID) (*
 	}
 	return &user, nil
 }
+
+// GetUsersByIDs retrieves the users with the given IDs.
+func (s *UserService) GetUsersByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*User, error) {
+	cursor, err := s.Collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var users []*User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetUsersByNames retrieves the users with the given names, excluding the deleted users.
+func (s *UserService) GetUsersByNames(ctx context.Context, names []string) ([]*User, error) {
+	cursor, err := s.Collection.Find(ctx, bson.M{"name": bson.M{"$in": names}, "deletedAt": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var users []*User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetUsersForTrustUpdate returns up to limit users, excluding the deleted users, whose trust
+// score was never computed or was computed before the given time, the oldest first.
+func (s *UserService) GetUsersForTrustUpdate(ctx context.Context, before time.Time, limit int) ([]*User, error) {
+	filter := bson.M{
+		"deletedAt": bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"trustUpdatedAt": bson.M{"$exists": false}},
+			{"trustUpdatedAt": bson.M{"$lt": before}},
+		},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "trustUpdatedAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := s.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var users []*User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// TouchActivity stores the time of the last activity of the user, which cancels the warning
+// of the anonymization of the inactive account.
+func (s *UserService) TouchActivity(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":   bson.M{"lastActiveAt": at},
+		"$unset": bson.M{"inactivityWarnedAt": ""},
+	})
+	return err
+}
+
+// GetInactiveUsers returns up to limit users, excluding the deleted users and the users already
+// warned, that were not active since the given time. The users never active since the activity
+// is tracked are inactive if they registered before it.
+func (s *UserService) GetInactiveUsers(ctx context.Context, activeBefore time.Time, limit int) ([]*User, error) {
+	filter := bson.M{
+		"deletedAt":          bson.M{"$exists": false},
+		"inactivityWarnedAt": bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"lastActiveAt": bson.M{"$lt": activeBefore}},
+			{
+				"lastActiveAt": bson.M{"$exists": false},
+				"_id":          bson.M{"$lt": primitive.NewObjectIDFromTimestamp(activeBefore)},
+			},
+		},
+	}
+	return s.findUsers(ctx, filter, limit)
+}
+
+// SetInactivityWarned stores the time the user was warned of the anonymization of the inactive
+// account.
+func (s *UserService) SetInactivityWarned(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"inactivityWarnedAt": at}})
+	return err
+}
+
+// GetUsersToAnonymize returns up to limit users, excluding the deleted users, that were warned
+// of the anonymization of the inactive account before the given time and were not active since.
+func (s *UserService) GetUsersToAnonymize(ctx context.Context, warnedBefore time.Time, limit int) ([]*User, error) {
+	filter := bson.M{
+		"deletedAt":          bson.M{"$exists": false},
+		"inactivityWarnedAt": bson.M{"$lt": warnedBefore},
+	}
+	return s.findUsers(ctx, filter, limit)
+}
+
+// findUsers returns up to limit users matching the filter, the oldest first.
+func (s *UserService) findUsers(ctx context.Context, filter bson.M, limit int) ([]*User, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := s.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var users []*User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SetTrustScore stores the trust score of the user and copies it to the user tools.
+func (s *UserService) SetTrustScore(ctx context.Context, id primitive.ObjectID, score int, now time.Time) error {
+	if _, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"trustScore": score, "trustUpdatedAt": now},
+	}); err != nil {
+		return err
+	}
+	// Only the tools with a different score are changed, to keep their update time
+	_, err := s.Collection.Database().Collection("tools").UpdateMany(ctx,
+		bson.M{"userId": id, "ownerTrustScore": bson.M{"$ne": score}},
+		touchTool(bson.M{"$set": bson.M{"ownerTrustScore": score}}),
+	)
+	return err
+}
+
+// SpendTokens subtracts the amount from the tokens of the user. It returns ErrNotEnoughTokens
+// if the user does not exist or has not enough tokens, leaving them untouched.
+func (s *UserService) SpendTokens(ctx context.Context, id primitive.ObjectID, amount uint64) error {
+	result, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "tokens": bson.M{"$gte": amount}},
+		bson.M{"$inc": bson.M{"tokens": -int64(amount)}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotEnoughTokens
+	}
+	return nil
+}
+
+// AddTokens adds the amount to the tokens of the user.
+func (s *UserService) AddTokens(ctx context.Context, id primitive.ObjectID, amount uint64) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"tokens": int64(amount)}})
+	return err
+}
+
+// SetNotificationPreferences sets the channels of the given notification types for the user,
+// keeping the preferences of the other types.
+func (s *UserService) SetNotificationPreferences(
+	ctx context.Context,
+	id primitive.ObjectID,
+	preferences map[NotificationType]NotificationChannels,
+) error {
+	if len(preferences) == 0 {
+		return nil
+	}
+	update := bson.M{}
+	for t, channels := range preferences {
+		update["notificationPreferences."+string(t)] = channels
+	}
+	result, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetDigestPreferences sets the digest settings of the user, keeping the time of the last
+// digest sent.
+func (s *UserService) SetDigestPreferences(ctx context.Context, id primitive.ObjectID, digest *DigestPreferences) error {
+	result, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"digest.enabled":          digest.Enabled,
+		"digest.radius":           digest.Radius,
+		"digest.community":        digest.Community,
+		"digest.unsubscribeToken": digest.UnsubscribeToken,
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// UnsubscribeDigest disables the digest of the user with the unsubscribe token. It returns
+// mongo.ErrNoDocuments if no user has the token.
+func (s *UserService) UnsubscribeDigest(ctx context.Context, token string) error {
+	result, err := s.Collection.UpdateOne(ctx,
+		bson.M{"digest.unsubscribeToken": token},
+		bson.M{"$set": bson.M{"digest.enabled": false}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetRole sets the role of the user, or removes it if empty.
+func (s *UserService) SetRole(ctx context.Context, id primitive.ObjectID, role UserRole) error {
+	update := bson.M{"$set": bson.M{"role": role}}
+	if role == "" {
+		update = bson.M{"$unset": bson.M{"role": ""}}
+	}
+	result, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetBlocked blocks or unblocks the user, the blocked users cannot perform any action.
+func (s *UserService) SetBlocked(ctx context.Context, id primitive.ObjectID, blocked bool) error {
+	update := bson.M{"$set": bson.M{"blocked": true}}
+	if !blocked {
+		update = bson.M{"$unset": bson.M{"blocked": ""}}
+	}
+	result, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetCommunity sets the community of the user, or removes it if empty.
+func (s *UserService) SetCommunity(ctx context.Context, id primitive.ObjectID, community string) error {
+	update := bson.M{"$set": bson.M{"community": community}}
+	if community == "" {
+		update = bson.M{"$unset": bson.M{"community": ""}}
+	}
+	result, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetTelegramLinkToken sets the token the user sends to the bot to link the Telegram chat,
+// keeping the chat already linked until the new one is.
+func (s *UserService) SetTelegramLinkToken(ctx context.Context, id primitive.ObjectID, token string) error {
+	result, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"telegram.linkToken": token}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// LinkTelegram links the chat to the user with the link token, which can only be used once.
+// It returns mongo.ErrNoDocuments if no user has the token.
+func (s *UserService) LinkTelegram(ctx context.Context, token string, chatID int64) (*User, error) {
+	var user User
+	err := s.Collection.FindOneAndUpdate(ctx,
+		bson.M{"telegram.linkToken": token, "deletedAt": bson.M{"$exists": false}},
+		bson.M{
+			"$set":   bson.M{"telegram.chatId": chatID, "telegram.linkedAt": time.Now()},
+			"$unset": bson.M{"telegram.linkToken": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UnlinkTelegram forgets the Telegram chat of the user.
+func (s *UserService) UnlinkTelegram(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$unset": bson.M{"telegram": ""}})
+	return err
+}
+
+// BlockUser adds the other user to the users blocked by the user. Blocking a blocked user is
+// a no-op.
+func (s *UserService) BlockUser(ctx context.Context, id, blockedID primitive.ObjectID) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$addToSet": bson.M{"blockedUsers": blockedID}})
+	return err
+}
+
+// UnblockUser removes the other user from the users blocked by the user. It returns
+// mongo.ErrNoDocuments if the other user was not blocked.
+func (s *UserService) UnblockUser(ctx context.Context, id, blockedID primitive.ObjectID) error {
+	result, err := s.Collection.UpdateOne(ctx,
+		bson.M{"_id": id, "blockedUsers": blockedID},
+		bson.M{"$pull": bson.M{"blockedUsers": blockedID}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// AcceptTerms records the acceptance of the terms version by the user.
+func (s *UserService) AcceptTerms(ctx context.Context, id primitive.ObjectID, version int) (*TermsAcceptance, error) {
+	acceptance := &TermsAcceptance{Version: version, AcceptedAt: time.Now()}
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$push": bson.M{"termsAcceptances": acceptance}})
+	if err != nil {
+		return nil, err
+	}
+	return acceptance, nil
+}
+
+// GetDigestSubscribers returns the active users with the digest enabled that did not receive
+// a digest since the given time.
+func (s *UserService) GetDigestSubscribers(ctx context.Context, sentBefore time.Time) ([]*User, error) {
+	filter := bson.M{
+		"digest.enabled": true,
+		"active":         true,
+		"deletedAt":      bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"digest.lastSentAt": bson.M{"$exists": false}},
+			{"digest.lastSentAt": bson.M{"$lt": sentBefore}},
+		},
+	}
+	cursor, err := s.Collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var users []*User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SetDigestSent stores the time of the last digest sent to the user.
+func (s *UserService) SetDigestSent(ctx context.Context, id primitive.ObjectID, sentAt time.Time) error {
+	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"digest.lastSentAt": sentAt}})
+	return err
+}
+
+// GetCommunities returns the communities with active members.
+func (s *UserService) GetCommunities(ctx context.Context) ([]string, error) {
+	values, err := s.Collection.Distinct(ctx, "community", bson.M{
+		"community": bson.M{"$nin": bson.A{nil, ""}},
+		"active":    true,
+		"deletedAt": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return nil, err
+	}
+	communities := make([]string, 0, len(values))
+	for _, value := range values {
+		if community, ok := value.(string); ok {
+			communities = append(communities, community)
+		}
+	}
+	return communities, nil
+}
+
+// MonthlyCount is a number of events of a month.
+type MonthlyCount struct {
+	// Month is formatted as YYYY-MM.
+	Month string `bson:"_id" json:"month"`
+	Count int64  `bson:"count" json:"count"`
+}
+
+// GetMemberGrowth returns the number of active members of the community by the month they
+// registered, the oldest first.
+func (s *UserService) GetMemberGrowth(ctx context.Context, community string) ([]*MonthlyCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"community": community, "active": true, "deletedAt": bson.M{"$exists": false}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.M{"$dateToString": bson.M{"format": "%Y-%m", "date": bson.M{"$toDate": "$_id"}}}},
+			{Key: "count", Value: bson.M{"$sum": 1}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+	cursor, err := s.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	growth := []*MonthlyCount{}
+	if err := cursor.All(ctx, &growth); err != nil {
+		return nil, err
+	}
+	return growth, nil
+}
+
+// GetCommunityMemberIDs returns the IDs of the active members of a community.
+func (s *UserService) GetCommunityMemberIDs(ctx context.Context, community string) ([]primitive.ObjectID, error) {
+	cursor, err := s.Collection.Find(ctx,
+		bson.M{"community": community, "active": true, "deletedAt": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	var members []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(members))
+	for i, m := range members {
+		ids[i] = m.ID
+	}
+	return ids, nil
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"testing"
+	"time"
 
 	qt "github.com/frankban/quicktest"
 	"go.mongodb.org/mongo-driver/bson"
@@ -175,4 +176,254 @@ func TestUserService(t *testing.T) {
 		c.Assert(err, qt.Not(qt.IsNil), qt.Commentf("Expected error when retrieving deleted user"))
 		c.Assert(err, qt.Equals, mongo.ErrNoDocuments, qt.Commentf("Expected no documents error"))
 	})
+
+	c.Run("Trust Score", func(c *qt.C) {
+		insertResult, err := userService.InsertUser(ctx, &User{
+			Email:    "trust@example.com",
+			Name:     "Trust Test",
+			Password: []byte("trustpass"),
+			Active:   true,
+		})
+		c.Assert(err, qt.IsNil)
+		userID := insertResult.InsertedID.(primitive.ObjectID)
+		_, err = database.Collection("tools").InsertOne(ctx, bson.M{"_id": 4046, "userId": userID})
+		c.Assert(err, qt.IsNil)
+
+		now := time.Now()
+		users, err := userService.GetUsersForTrustUpdate(ctx, now, 1000)
+		c.Assert(err, qt.IsNil)
+		c.Assert(containsUser(users, userID), qt.IsTrue)
+
+		c.Assert(userService.SetTrustScore(ctx, userID, 72, now), qt.IsNil)
+		user, err := userService.GetUserByID(ctx, userID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(*user.TrustScore, qt.Equals, 72)
+		var tool Tool
+		c.Assert(database.Collection("tools").FindOne(ctx, bson.M{"_id": 4046}).Decode(&tool), qt.IsNil)
+		c.Assert(*tool.OwnerTrustScore, qt.Equals, 72)
+
+		// Recently updated scores are skipped
+		users, err = userService.GetUsersForTrustUpdate(ctx, now.Add(-time.Hour), 1000)
+		c.Assert(err, qt.IsNil)
+		c.Assert(containsUser(users, userID), qt.IsFalse)
+	})
+
+	c.Run("Notification Preferences", func(c *qt.C) {
+		insertResult, err := userService.InsertUser(ctx, &User{
+			Email:    "prefs@example.com",
+			Name:     "Preferences Test",
+			Password: []byte("prefspass"),
+			Active:   true,
+		})
+		c.Assert(err, qt.IsNil)
+		userID := insertResult.InsertedID.(primitive.ObjectID)
+
+		c.Assert(userService.SetNotificationPreferences(ctx, userID, map[NotificationType]NotificationChannels{
+			NotificationBookingRequest: {Email: true},
+		}), qt.IsNil)
+		c.Assert(userService.SetNotificationPreferences(ctx, userID, map[NotificationType]NotificationChannels{
+			NotificationRatingReminder: {InApp: true},
+		}), qt.IsNil)
+
+		user, err := userService.GetUserByID(ctx, userID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(user.NotificationChannels(NotificationBookingRequest), qt.Equals, NotificationChannels{Email: true})
+		c.Assert(user.NotificationChannels(NotificationRatingReminder), qt.Equals, NotificationChannels{InApp: true})
+		c.Assert(user.NotificationChannels(NotificationBookingStatus), qt.Equals,
+			DefaultNotificationChannels(NotificationBookingStatus))
+
+		err = userService.SetNotificationPreferences(ctx, primitive.NewObjectID(), map[NotificationType]NotificationChannels{
+			NotificationBookingRequest: {},
+		})
+		c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+	})
+
+	c.Run("Telegram", func(c *qt.C) {
+		insertResult, err := userService.InsertUser(ctx, &User{
+			Email:    "telegram@example.com",
+			Name:     "Telegram Test",
+			Password: []byte("telegrampass"),
+			Active:   true,
+		})
+		c.Assert(err, qt.IsNil)
+		userID := insertResult.InsertedID.(primitive.ObjectID)
+
+		c.Assert(userService.SetTelegramLinkToken(ctx, userID, "link-token"), qt.IsNil)
+		user, err := userService.LinkTelegram(ctx, "link-token", 42)
+		c.Assert(err, qt.IsNil)
+		c.Assert(user.ID, qt.Equals, userID)
+		c.Assert(user.Telegram.ChatID, qt.Equals, int64(42))
+		c.Assert(user.Telegram.LinkToken, qt.Equals, "")
+
+		// The link token can only be used once
+		_, err = userService.LinkTelegram(ctx, "link-token", 43)
+		c.Assert(err, qt.Equals, mongo.ErrNoDocuments)
+
+		c.Assert(userService.UnlinkTelegram(ctx, userID), qt.IsNil)
+		user, err = userService.GetUserByID(ctx, userID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(user.Telegram, qt.IsNil)
+	})
+
+	c.Run("Spend Tokens", func(c *qt.C) {
+		insertResult, err := userService.InsertUser(ctx, &User{
+			Email:    "tokens@example.com",
+			Name:     "Tokens Test",
+			Password: []byte("tokenspass"),
+			Tokens:   100,
+			Active:   true,
+		})
+		c.Assert(err, qt.IsNil)
+		userID := insertResult.InsertedID.(primitive.ObjectID)
+
+		c.Assert(userService.SpendTokens(ctx, userID, 60), qt.IsNil)
+		// Not enough tokens left, the balance is untouched
+		c.Assert(userService.SpendTokens(ctx, userID, 60), qt.Equals, ErrNotEnoughTokens)
+		c.Assert(userService.AddTokens(ctx, userID, 5), qt.IsNil)
+
+		user, err := userService.GetUserByID(ctx, userID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(user.Tokens, qt.Equals, uint64(45))
+	})
+
+	c.Run("Digest", func(c *qt.C) {
+		insertResult, err := userService.InsertUser(ctx, &User{
+			Email:    "digest@example.com",
+			Name:     "Digest Test",
+			Password: []byte("digestpass"),
+			Active:   true,
+		})
+		c.Assert(err, qt.IsNil)
+		userID := insertResult.InsertedID.(primitive.ObjectID)
+		now := time.Now()
+
+		digest := &DigestPreferences{Enabled: true, Radius: 5000, UnsubscribeToken: "token"}
+		c.Assert(userService.SetDigestPreferences(ctx, userID, digest), qt.IsNil)
+		users, err := userService.GetDigestSubscribers(ctx, now)
+		c.Assert(err, qt.IsNil)
+		c.Assert(containsUser(users, userID), qt.IsTrue)
+
+		// The users that received a digest after the given time are skipped
+		c.Assert(userService.SetDigestSent(ctx, userID, now), qt.IsNil)
+		users, err = userService.GetDigestSubscribers(ctx, now.Add(-time.Hour))
+		c.Assert(err, qt.IsNil)
+		c.Assert(containsUser(users, userID), qt.IsFalse)
+
+		// Changing the settings keeps the time of the last digest
+		digest.Radius = 20000
+		c.Assert(userService.SetDigestPreferences(ctx, userID, digest), qt.IsNil)
+		user, err := userService.GetUserByID(ctx, userID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(user.Digest.Radius, qt.Equals, 20000)
+		c.Assert(user.Digest.LastSentAt, qt.IsNotNil)
+
+		c.Assert(userService.UnsubscribeDigest(ctx, "token"), qt.IsNil)
+		c.Assert(userService.UnsubscribeDigest(ctx, "other"), qt.Equals, mongo.ErrNoDocuments)
+		users, err = userService.GetDigestSubscribers(ctx, now.Add(time.Hour))
+		c.Assert(err, qt.IsNil)
+		c.Assert(containsUser(users, userID), qt.IsFalse)
+	})
+}
+
+func containsUser(users []*User, id primitive.ObjectID) bool {
+	for _, u := range users {
+		if u.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSearchUsers(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation, with the indexes the search relies on
+	database := &Database{
+		Client:   client,
+		Database: client.Database(RandomDatabaseName()),
+	}
+	c.Assert(EnsureIndexes(ctx, database), qt.IsNil)
+	userService := NewUserService(database)
+
+	now := time.Now()
+	users := []*User{
+		{Email: "near@example.com", Name: "Near Gardener", Community: "gardeners", Active: true, Rating: 80,
+			Location: NewLocation(41695384, 2492793)},
+		{Email: "far@example.com", Name: "Far Gardener", Community: "gardeners", Active: true, Rating: 40,
+			Location: NewLocation(41385063, 2173404)},
+		{Email: "hidden@example.com", Name: "Hidden Gardener", Community: "gardeners", Active: true, Rating: 90,
+			HideCommunity: true, Location: NewLocation(41695384, 2492793)},
+		{Email: "inactive@example.com", Name: "Inactive Carpenter", Community: "carpenters", Rating: 70},
+		{Email: "deleted@example.com", Name: "Deleted Carpenter", Community: "carpenters", Active: true, DeletedAt: &now},
+	}
+	for _, u := range users {
+		_, err := userService.InsertUser(ctx, u)
+		c.Assert(err, qt.IsNil)
+	}
+	names := func(results []*UserSearchResult) []string {
+		n := []string{}
+		for _, r := range results {
+			n = append(n, r.Name)
+		}
+		return n
+	}
+
+	results, total, err := userService.SearchUsers(ctx, SearchUsersOptions{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(4))
+	for _, r := range results {
+		c.Assert(r.Email, qt.Equals, "")
+		c.Assert(r.Password, qt.IsNil)
+	}
+
+	results, _, err = userService.SearchUsers(ctx, SearchUsersOptions{Name: "gardener"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(results, qt.HasLen, 3)
+
+	// The users hiding their community are not found by it
+	results, _, err = userService.SearchUsers(ctx, SearchUsersOptions{Community: "gardeners"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(names(results), qt.DeepEquals, []string{"Near Gardener", "Far Gardener"})
+
+	active := false
+	results, _, err = userService.SearchUsers(ctx, SearchUsersOptions{Active: &active})
+	c.Assert(err, qt.IsNil)
+	c.Assert(names(results), qt.DeepEquals, []string{"Inactive Carpenter"})
+
+	results, _, err = userService.SearchUsers(ctx, SearchUsersOptions{MinRating: 75})
+	c.Assert(err, qt.IsNil)
+	c.Assert(names(results), qt.DeepEquals, []string{"Near Gardener", "Hidden Gardener"})
+
+	// Sorted by distance, the users without location are skipped
+	location := NewLocation(41385063, 2173404)
+	results, total, err = userService.SearchUsers(ctx, SearchUsersOptions{Location: &location})
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(3))
+	c.Assert(results[0].Name, qt.Equals, "Far Gardener")
+	c.Assert(results[0].Distance < 1, qt.IsTrue)
+	c.Assert(results[1].Distance > 40000, qt.IsTrue)
+
+	results, _, err = userService.SearchUsers(ctx, SearchUsersOptions{Location: &location, Distance: 10000})
+	c.Assert(err, qt.IsNil)
+	c.Assert(names(results), qt.DeepEquals, []string{"Far Gardener"})
+
+	results, total, err = userService.SearchUsers(ctx, SearchUsersOptions{PageSize: 1, Page: 1})
+	c.Assert(err, qt.IsNil)
+	c.Assert(total, qt.Equals, int64(4))
+	c.Assert(results, qt.HasLen, 1)
 }
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// versionFilter returns the filter of the document with the given ID at the given version. The
+// documents created before the versions were introduced have none, which is the version 0.
+func versionFilter(id interface{}, version int64) bson.M {
+	if version == 0 {
+		return bson.M{"_id": id, "version": bson.M{"$in": bson.A{0, nil}}}
+	}
+	return bson.M{"_id": id, "version": version}
+}
+
+// updateVersion applies the update to the document with the given ID only if it is still at the
+// given version, and increases its version. It returns ErrVersionConflict if the document was
+// changed meanwhile, and mongo.ErrNoDocuments if it does not exist.
+func updateVersion(ctx context.Context, collection *mongo.Collection, id interface{}, version int64, update bson.M) error {
+	update["$inc"] = bson.M{"version": 1}
+	result, err := collection.UpdateOne(ctx, versionFilter(id, version), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return ErrVersionConflict
+}
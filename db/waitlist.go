@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WaitlistEntry represents the schema for the "waitlist" collection. It is a booking request
+// for dates taken by an accepted booking, sent to the owner if that booking is cancelled.
+// Entries are removed by MongoDB once their start date has passed.
+type WaitlistEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ToolID    int64              `bson:"toolId" json:"toolId"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	StartDate time.Time          `bson:"startDate" json:"startDate"`
+	EndDate   time.Time          `bson:"endDate" json:"endDate"`
+	Contact   string             `bson:"contact" json:"contact"`
+	Comments  string             `bson:"comments" json:"comments"`
+	Origin    BookingOrigin      `bson:"origin,omitempty" json:"origin,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	// AcceptedTerms are the usage terms of the tool accepted when joining the waitlist.
+	AcceptedTerms *AcceptedTerms `bson:"acceptedTerms,omitempty" json:"acceptedTerms,omitempty"`
+}
+
+// WaitlistService provides methods to interact with the "waitlist" collection.
+type WaitlistService struct {
+	Collection *mongo.Collection
+}
+
+// NewWaitlistService creates a new WaitlistService.
+func NewWaitlistService(db *Database) *WaitlistService {
+	return &WaitlistService{
+		Collection: db.Database.Collection("waitlist"),
+	}
+}
+
+// JoinWaitlist inserts a new entry in the waitlist of the tool. Users can only wait for a
+// tool once, it returns ErrAlreadyWaitlisted otherwise.
+func (s *WaitlistService) JoinWaitlist(ctx context.Context, e *WaitlistEntry) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	result, err := s.Collection.InsertOne(ctx, e)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyWaitlisted
+	}
+	if err != nil {
+		return err
+	}
+	e.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// LeaveWaitlist removes the entry of the user from the waitlist of the tool. It returns
+// mongo.ErrNoDocuments if the user was not waiting for the tool.
+func (s *WaitlistService) LeaveWaitlist(ctx context.Context, toolID int64, userID primitive.ObjectID) error {
+	result, err := s.Collection.DeleteOne(ctx, bson.M{"toolId": toolID, "userId": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// GetToolWaitlist retrieves the entries of the tool overlapping the given dates that have not
+// started yet, in the order they joined the waitlist.
+func (s *WaitlistService) GetToolWaitlist(ctx context.Context, toolID int64, start, end time.Time) ([]*WaitlistEntry, error) {
+	cursor, err := s.Collection.Find(ctx,
+		bson.M{
+			"toolId":    toolID,
+			"startDate": bson.M{"$lte": end, "$gt": time.Now()},
+			"endDate":   bson.M{"$gte": start},
+		},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			log.Error().Err(err).Msg("Error closing cursor")
+		}
+	}()
+
+	entries := []*WaitlistEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// DeleteEntry removes an entry of the waitlist.
+func (s *WaitlistService) DeleteEntry(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.Collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// DeleteToolWaitlist removes the waitlist of a tool.
+func (s *WaitlistService) DeleteToolWaitlist(ctx context.Context, toolID int64) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"toolId": toolID})
+	return err
+}
+
+// DeleteUserEntries removes every waitlist entry of the user.
+func (s *WaitlistService) DeleteUserEntries(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
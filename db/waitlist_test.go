@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestWaitlistService(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Start MongoDB container
+	container, err := StartMongoContainer(ctx)
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to start MongoDB container"))
+	defer func() { _ = container.Terminate(ctx) }()
+
+	// Get MongoDB connection string
+	mongoURI, err := container.Endpoint(ctx, "mongodb")
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to get MongoDB connection string"))
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	c.Assert(err, qt.IsNil, qt.Commentf("Failed to create MongoDB client"))
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	// Use a random database name for isolation
+	dbName := RandomDatabaseName()
+	waitlistService := NewWaitlistService(&Database{
+		Client:   client,
+		Database: client.Database(dbName),
+	})
+
+	now := time.Now()
+	day := 24 * time.Hour
+	first, second, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	entries := []*WaitlistEntry{
+		{ToolID: 1, UserID: first, StartDate: now.Add(2 * day), EndDate: now.Add(3 * day), CreatedAt: now},
+		{ToolID: 1, UserID: second, StartDate: now.Add(day), EndDate: now.Add(4 * day), CreatedAt: now.Add(time.Minute)},
+		// Not overlapping the released dates
+		{ToolID: 1, UserID: other, StartDate: now.Add(10 * day), EndDate: now.Add(11 * day), CreatedAt: now},
+		// Another tool
+		{ToolID: 2, UserID: first, StartDate: now.Add(2 * day), EndDate: now.Add(3 * day), CreatedAt: now},
+	}
+	for _, e := range entries {
+		c.Assert(waitlistService.JoinWaitlist(ctx, e), qt.IsNil)
+	}
+
+	// Overlapping entries, in the order they joined the waitlist
+	waiting, err := waitlistService.GetToolWaitlist(ctx, 1, now.Add(day), now.Add(5*day))
+	c.Assert(err, qt.IsNil)
+	c.Assert(waiting, qt.HasLen, 2)
+	c.Assert(waiting[0].UserID, qt.Equals, first)
+	c.Assert(waiting[1].UserID, qt.Equals, second)
+
+	c.Assert(waitlistService.LeaveWaitlist(ctx, 1, first), qt.IsNil)
+	c.Assert(waitlistService.LeaveWaitlist(ctx, 1, first), qt.Equals, mongo.ErrNoDocuments)
+	c.Assert(waitlistService.DeleteEntry(ctx, waiting[1].ID), qt.IsNil)
+	waiting, err = waitlistService.GetToolWaitlist(ctx, 1, now.Add(day), now.Add(5*day))
+	c.Assert(err, qt.IsNil)
+	c.Assert(waiting, qt.HasLen, 0)
+
+	c.Assert(waitlistService.DeleteUserEntries(ctx, first), qt.IsNil)
+	c.Assert(waitlistService.DeleteToolWaitlist(ctx, 1), qt.IsNil)
+	count, err := waitlistService.Collection.CountDocuments(ctx, bson.M{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(count, qt.Equals, int64(0))
+}
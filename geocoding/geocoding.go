@@ -0,0 +1,150 @@
+// Package geocoding resolves postal addresses and place names to coordinates and
+// coordinates to human-readable localities. Coordinates are expressed in microdegrees,
+// as everywhere else in the backend.
+package geocoding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the address or coordinates do not match any place.
+var ErrNotFound = errors.New("place not found")
+
+// Place is a geocoded location.
+type Place struct {
+	Latitude  int64  // Latitude in microdegrees
+	Longitude int64  // Longitude in microdegrees
+	Locality  string // Human-readable municipality name, empty if unknown
+}
+
+// Provider resolves addresses to places and places to localities.
+type Provider interface {
+	// Geocode returns the place best matching the address or municipality name.
+	Geocode(ctx context.Context, address string) (*Place, error)
+	// Reverse returns the place at the given coordinates (in microdegrees).
+	Reverse(ctx context.Context, latitude, longitude int64) (*Place, error)
+}
+
+// DefaultNominatimURL is the public OpenStreetMap Nominatim instance.
+const DefaultNominatimURL = "https://nominatim.openstreetmap.org"
+
+// nominatimTimeout is the maximum duration of a request when no client is set.
+const nominatimTimeout = 5 * time.Second
+
+// Nominatim is a Provider backed by a Nominatim server. The public instance requires an
+// identifying UserAgent and allows at most one request per second, so lookups should be cached.
+type Nominatim struct {
+	URL       string
+	UserAgent string
+	Client    *http.Client
+}
+
+// nominatimPlace is a place as returned by the Nominatim jsonv2 format.
+type nominatimPlace struct {
+	Lat     string            `json:"lat"`
+	Lon     string            `json:"lon"`
+	Address map[string]string `json:"address"`
+	Error   string            `json:"error"`
+}
+
+// Geocode returns the first place matching the address.
+func (n *Nominatim) Geocode(ctx context.Context, address string) (*Place, error) {
+	query := url.Values{}
+	query.Set("q", address)
+	query.Set("format", "jsonv2")
+	query.Set("addressdetails", "1")
+	query.Set("limit", "1")
+	var places []nominatimPlace
+	if err := n.get(ctx, "/search", query, &places); err != nil {
+		return nil, err
+	}
+	if len(places) == 0 {
+		return nil, ErrNotFound
+	}
+	return places[0].place()
+}
+
+// Reverse returns the place at the coordinates, at municipality level of detail.
+func (n *Nominatim) Reverse(ctx context.Context, latitude, longitude int64) (*Place, error) {
+	query := url.Values{}
+	query.Set("lat", strconv.FormatFloat(float64(latitude)/1e6, 'f', 6, 64))
+	query.Set("lon", strconv.FormatFloat(float64(longitude)/1e6, 'f', 6, 64))
+	query.Set("format", "jsonv2")
+	query.Set("addressdetails", "1")
+	query.Set("zoom", "10")
+	var place nominatimPlace
+	if err := n.get(ctx, "/reverse", query, &place); err != nil {
+		return nil, err
+	}
+	if place.Error != "" {
+		return nil, ErrNotFound
+	}
+	return place.place()
+}
+
+// get performs a GET request to the Nominatim endpoint and decodes the JSON response.
+func (n *Nominatim) get(ctx context.Context, path string, query url.Values, result any) error {
+	base := n.URL
+	if base == "" {
+		base = DefaultNominatimURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(base, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if n.UserAgent != "" {
+		req.Header.Set("User-Agent", n.UserAgent)
+	}
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: nominatimTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("nominatim request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("nominatim returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("could not decode nominatim response: %w", err)
+	}
+	return nil
+}
+
+// place converts the Nominatim place to a Place.
+func (p *nominatimPlace) place() (*Place, error) {
+	lat, err := strconv.ParseFloat(p.Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude %q: %w", p.Lat, err)
+	}
+	lon, err := strconv.ParseFloat(p.Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude %q: %w", p.Lon, err)
+	}
+	return &Place{
+		Latitude:  int64(math.Round(lat * 1e6)),
+		Longitude: int64(math.Round(lon * 1e6)),
+		Locality:  locality(p.Address),
+	}, nil
+}
+
+// locality returns the most specific municipality level name of the address.
+func locality(address map[string]string) string {
+	for _, key := range []string{"city", "town", "village", "municipality", "county", "state"} {
+		if name := address[key]; name != "" {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package geocoding
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestNominatim(t *testing.T) {
+	c := qt.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Header.Get("User-Agent"), qt.Equals, "emprius-test")
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/search":
+			if r.URL.Query().Get("q") == "nowhere" {
+				_, _ = w.Write([]byte(`[]`))
+				return
+			}
+			_, _ = w.Write([]byte(`[{"lat":"41.385100","lon":"2.173400","address":{"city":"Barcelona","country":"Spain"}}]`))
+		case "/reverse":
+			if r.URL.Query().Get("lat") == "0.000000" {
+				_, _ = w.Write([]byte(`{"error":"Unable to geocode"}`))
+				return
+			}
+			c.Check(r.URL.Query().Get("lat"), qt.Equals, "41.500000")
+			c.Check(r.URL.Query().Get("lon"), qt.Equals, "2.100000")
+			_, _ = w.Write([]byte(`{"lat":"41.5","lon":"2.1","address":{"village":"Sant Cugat","county":"Valles"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	n := &Nominatim{URL: srv.URL, UserAgent: "emprius-test"}
+
+	place, err := n.Geocode(ctx, "Barcelona")
+	c.Assert(err, qt.IsNil)
+	c.Assert(*place, qt.DeepEquals, Place{Latitude: 41385100, Longitude: 2173400, Locality: "Barcelona"})
+
+	_, err = n.Geocode(ctx, "nowhere")
+	c.Assert(errors.Is(err, ErrNotFound), qt.IsTrue)
+
+	place, err = n.Reverse(ctx, 41500000, 2100000)
+	c.Assert(err, qt.IsNil)
+	c.Assert(place.Locality, qt.Equals, "Sant Cugat")
+
+	_, err = n.Reverse(ctx, 0, 0)
+	c.Assert(errors.Is(err, ErrNotFound), qt.IsTrue)
+
+	// Server errors are not reported as missing places
+	n.URL = srv.URL + "/broken"
+	_, err = n.Geocode(ctx, "Barcelona")
+	c.Assert(err, qt.Not(qt.IsNil))
+	c.Assert(errors.Is(err, ErrNotFound), qt.IsFalse)
+}
@@ -0,0 +1,141 @@
+// Package geohash implements the geohash encoding of geographic coordinates,
+// used to bucket locations into cells for caching and clustering.
+package geohash
+
+import (
+	"math"
+	"strings"
+)
+
+// MaxPrecision is the maximum supported geohash length.
+const MaxPrecision = 12
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Encode returns the geohash of the given coordinates (in degrees) with the given
+// precision (number of characters, between 1 and MaxPrecision).
+func Encode(latitude, longitude float64, precision int) string {
+	precision = clampPrecision(precision)
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	var sb strings.Builder
+	sb.Grow(precision)
+	bit, ch := 0, 0
+	even := true // even bits encode longitude
+	for sb.Len() < precision {
+		if even {
+			mid := (lonRange[0] + lonRange[1]) / 2
+			if longitude >= mid {
+				ch |= 1 << (4 - bit)
+				lonRange[0] = mid
+			} else {
+				lonRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if latitude >= mid {
+				ch |= 1 << (4 - bit)
+				latRange[0] = mid
+			} else {
+				latRange[1] = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+			continue
+		}
+		sb.WriteByte(base32[ch])
+		bit, ch = 0, 0
+	}
+	return sb.String()
+}
+
+// Decode returns the center coordinates (in degrees) of the given geohash cell.
+// Invalid characters are ignored.
+func Decode(hash string) (latitude, longitude float64) {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	even := true
+	for _, c := range hash {
+		idx := strings.IndexRune(base32, c)
+		if idx < 0 {
+			continue
+		}
+		for bit := 4; bit >= 0; bit-- {
+			r := &latRange
+			if even {
+				r = &lonRange
+			}
+			mid := (r[0] + r[1]) / 2
+			if idx&(1<<bit) != 0 {
+				r[0] = mid
+			} else {
+				r[1] = mid
+			}
+			even = !even
+		}
+	}
+	return (latRange[0] + latRange[1]) / 2, (lonRange[0] + lonRange[1]) / 2
+}
+
+// CellSize returns the height and width (in degrees) of a geohash cell with the given precision.
+func CellSize(precision int) (latDegrees, lonDegrees float64) {
+	bits := 5 * clampPrecision(precision)
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lonBits))
+}
+
+// Cover returns the geohash cells of the given precision that intersect the bounding
+// box defined by its south-west and north-east corners (in degrees). If the number of
+// cells exceeds maxCells, it returns nil and false.
+func Cover(minLat, minLon, maxLat, maxLon float64, precision, maxCells int) ([]string, bool) {
+	minLat, maxLat = clamp(minLat, -90, 90), clamp(maxLat, -90, 90)
+	minLon, maxLon = clamp(minLon, -180, 180), clamp(maxLon, -180, 180)
+	cellLat, cellLon := CellSize(precision)
+	rows := int(math.Ceil((maxLat-minLat)/cellLat)) + 1
+	cols := int(math.Ceil((maxLon-minLon)/cellLon)) + 1
+	if rows*cols > maxCells*4 {
+		return nil, false
+	}
+
+	seen := make(map[string]bool)
+	cells := []string{}
+	for lat := minLat; ; lat += cellLat {
+		lat = math.Min(lat, maxLat)
+		for lon := minLon; ; lon += cellLon {
+			lon = math.Min(lon, maxLon)
+			hash := Encode(lat, lon, precision)
+			if !seen[hash] {
+				seen[hash] = true
+				cells = append(cells, hash)
+				if len(cells) > maxCells {
+					return nil, false
+				}
+			}
+			if lon >= maxLon {
+				break
+			}
+		}
+		if lat >= maxLat {
+			break
+		}
+	}
+	return cells, true
+}
+
+func clampPrecision(precision int) int {
+	if precision < 1 {
+		return 1
+	}
+	if precision > MaxPrecision {
+		return MaxPrecision
+	}
+	return precision
+}
+
+func clamp(v, lower, upper float64) float64 {
+	return math.Max(lower, math.Min(upper, v))
+}
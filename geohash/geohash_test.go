@@ -0,0 +1,50 @@
+package geohash
+
+import (
+	"math"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestEncode(t *testing.T) {
+	c := qt.New(t)
+	// Well known reference values
+	c.Assert(Encode(57.64911, 10.40744, 11), qt.Equals, "u4pruydqqvj")
+	c.Assert(Encode(41.695384, 2.492793, 5), qt.Equals, "sp3v0")
+	c.Assert(Encode(41.695384, 2.492793, 0), qt.HasLen, 1)
+	c.Assert(Encode(41.695384, 2.492793, 20), qt.HasLen, MaxPrecision)
+}
+
+func TestDecode(t *testing.T) {
+	c := qt.New(t)
+	lat, lon := Decode(Encode(41.695384, 2.492793, 9))
+	c.Assert(math.Abs(lat-41.695384) < 0.0001, qt.IsTrue)
+	c.Assert(math.Abs(lon-2.492793) < 0.0001, qt.IsTrue)
+}
+
+func TestCover(t *testing.T) {
+	c := qt.New(t)
+
+	// A small box inside a single cell
+	cells, ok := Cover(41.69, 2.49, 41.70, 2.50, 4, 64)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(cells, qt.DeepEquals, []string{Encode(41.69, 2.49, 4)})
+
+	// Every point of a larger box is covered
+	cells, ok = Cover(41.0, 2.0, 42.0, 3.0, 4, 256)
+	c.Assert(ok, qt.IsTrue)
+	set := map[string]bool{}
+	for _, cell := range cells {
+		set[cell] = true
+	}
+	for lat := 41.0; lat <= 42.0; lat += 0.05 {
+		for lon := 2.0; lon <= 3.0; lon += 0.05 {
+			c.Assert(set[Encode(lat, lon, 4)], qt.IsTrue, qt.Commentf("%f,%f not covered", lat, lon))
+		}
+	}
+
+	// Too many cells
+	_, ok = Cover(30.0, -10.0, 50.0, 10.0, 5, 64)
+	c.Assert(ok, qt.IsFalse)
+}
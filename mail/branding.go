@@ -0,0 +1,127 @@
+package mail
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultAppName is the name of the app in the emails of the instances without branding.
+	DefaultAppName = "Emprius"
+	// DefaultPrimaryColor is the color of the header and links of the HTML emails.
+	DefaultPrimaryColor = "#2e7d32"
+)
+
+//go:embed templates/layout.html
+var layoutHTML string
+
+// layoutTemplate is the HTML version of every email, with the branding of the instance.
+var layoutTemplate = template.Must(template.New("layout").Parse(layoutHTML))
+
+// colorRegexp matches the hexadecimal CSS colors, i.e. #2e7d32.
+var colorRegexp = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Link is a link of the footer of the emails.
+type Link struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Branding is the look of the emails of an instance. The empty fields use the defaults.
+type Branding struct {
+	AppName      string `json:"appName"`
+	LogoURL      string `json:"logoUrl,omitempty"`
+	PrimaryColor string `json:"primaryColor"`
+	FooterLinks  []Link `json:"footerLinks,omitempty"`
+	// ReplyTo is the address the users reply to, if not the sender of the emails.
+	ReplyTo string `json:"replyTo,omitempty"`
+}
+
+// ParseFooterLinks parses a comma separated list of title=URL pairs, for example
+// "Terms=https://example.com/terms,Help=https://example.com/help".
+func ParseFooterLinks(s string) ([]Link, error) {
+	var links []Link
+	if strings.TrimSpace(s) == "" {
+		return links, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		title, link, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			return nil, fmt.Errorf("invalid footer link %q, expected title=URL", pair)
+		}
+		links = append(links, Link{Title: strings.TrimSpace(title), URL: strings.TrimSpace(link)})
+	}
+	return links, nil
+}
+
+// WithDefaults returns a copy of the branding with the defaults of the empty fields.
+func (b Branding) WithDefaults() Branding {
+	if b.AppName == "" {
+		b.AppName = DefaultAppName
+	}
+	if b.PrimaryColor == "" {
+		b.PrimaryColor = DefaultPrimaryColor
+	}
+	return b
+}
+
+// Validate checks the colors, URLs and addresses of the branding.
+func (b Branding) Validate() error {
+	if b.PrimaryColor != "" && !colorRegexp.MatchString(b.PrimaryColor) {
+		return fmt.Errorf("invalid primary color %q, expected #rrggbb", b.PrimaryColor)
+	}
+	if b.LogoURL != "" && !isWebURL(b.LogoURL) {
+		return fmt.Errorf("invalid logo URL %q", b.LogoURL)
+	}
+	for _, link := range b.FooterLinks {
+		if link.Title == "" || !isWebURL(link.URL) {
+			return fmt.Errorf("invalid footer link %q: %q", link.Title, link.URL)
+		}
+	}
+	if b.ReplyTo != "" {
+		if _, err := mail.ParseAddress(b.ReplyTo); err != nil {
+			return fmt.Errorf("invalid reply-to address %q: %w", b.ReplyTo, err)
+		}
+	}
+	return nil
+}
+
+// Apply brands the message: it sets its reply-to address, appends the footer to the plain
+// text body and renders the HTML version of the body.
+func (b Branding) Apply(msg *Message) error {
+	b = b.WithDefaults()
+	if msg.ReplyTo == "" {
+		msg.ReplyTo = b.ReplyTo
+	}
+	var paragraphs [][]string
+	for _, paragraph := range strings.Split(strings.TrimSpace(msg.Body), "\n\n") {
+		paragraphs = append(paragraphs, strings.Split(paragraph, "\n"))
+	}
+	var html strings.Builder
+	if err := layoutTemplate.Execute(&html, struct {
+		Branding
+		Subject    string
+		Paragraphs [][]string
+	}{b, msg.Subject, paragraphs}); err != nil {
+		return fmt.Errorf("could not render the email: %w", err)
+	}
+	msg.HTML = html.String()
+
+	footer := "\n\n-- \n" + b.AppName
+	for _, link := range b.FooterLinks {
+		footer += "\n" + link.Title + ": " + link.URL
+	}
+	msg.Body = strings.TrimRight(msg.Body, "\n") + footer + "\n"
+	return nil
+}
+
+// isWebURL returns true if s is an absolute http or https URL.
+func isWebURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
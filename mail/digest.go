@@ -0,0 +1,49 @@
+package mail
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/digest.txt
+var digestText string
+
+// digestTemplate is the body of the digest emails.
+var digestTemplate = template.Must(template.New("digest").Parse(digestText))
+
+// Digest is the weekly summary of the new tools published near a user.
+type Digest struct {
+	// AppName is the name of the app, DefaultAppName if empty.
+	AppName string
+	Name    string
+	Tools   []DigestTool
+	// More is the number of new tools not listed.
+	More int
+	// UnsubscribeURL disables the digest without logging in, omitted if empty.
+	UnsubscribeURL string
+}
+
+// DigestTool is a new tool listed in a digest. The tools without cost are listed as free.
+type DigestTool struct {
+	Title    string
+	Locality string
+	Cost     uint64
+}
+
+// Message renders the digest as the email message sent to the given address.
+func (d *Digest) Message(to string) (*Message, error) {
+	if d.AppName == "" {
+		d.AppName = DefaultAppName
+	}
+	var body strings.Builder
+	if err := digestTemplate.Execute(&body, d); err != nil {
+		return nil, fmt.Errorf("could not render digest: %w", err)
+	}
+	return &Message{
+		To:      to,
+		Subject: "New tools near you",
+		Body:    body.String(),
+	}, nil
+}
@@ -0,0 +1,132 @@
+// Package mail provides the outgoing email senders used to notify users out of the app.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Message is an outgoing email. Body is the plain text version, sent alone if HTML is empty.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	HTML    string
+	// ReplyTo is the address the recipient replies to, the sender if empty.
+	ReplyTo string
+}
+
+// Sender sends email messages.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Checker is implemented by the senders that can check if their mail server is reachable.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// LogSender is the Sender used when no mail server is configured. Messages are only logged.
+type LogSender struct{}
+
+// Send logs the message.
+func (LogSender) Send(_ context.Context, msg *Message) error {
+	log.Info().Str("to", msg.To).Str("subject", msg.Subject).Msg("mail server not configured, email not sent")
+	return nil
+}
+
+// SMTPSender sends messages through an SMTP server using PLAIN authentication.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Send sends the message through the SMTP server. The context is not used
+// since net/smtp does not support cancellation.
+func (s *SMTPSender) Send(_ context.Context, msg *Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := fmt.Sprintf("%s:%d", s.Host, s.Port)
+	if err := smtp.SendMail(addr, auth, s.From, []string{msg.To}, msg.bytes(s.From, time.Now())); err != nil {
+		return fmt.Errorf("could not send email to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// Check connects to the SMTP server and greets it, without authenticating.
+func (s *SMTPSender) Check(ctx context.Context) error {
+	addr := fmt.Sprintf("%s:%d", s.Host, s.Port)
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			_ = conn.Close()
+			return err
+		}
+	}
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("no SMTP greeting from %s: %w", addr, err)
+	}
+	return client.Quit()
+}
+
+// bytes returns the RFC 5322 representation of the message.
+func (m *Message) bytes(from string, date time.Time) []byte {
+	var sb strings.Builder
+	sb.WriteString("From: " + from + "\r\n")
+	sb.WriteString("To: " + m.To + "\r\n")
+	sb.WriteString("Subject: " + sanitizeHeader(m.Subject) + "\r\n")
+	sb.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	if m.ReplyTo != "" {
+		sb.WriteString("Reply-To: " + sanitizeHeader(m.ReplyTo) + "\r\n")
+	}
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	if m.HTML == "" {
+		sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		sb.WriteString("\r\n")
+		sb.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+		return []byte(sb.String())
+	}
+
+	// The HTML version is quoted-printable encoded, its lines may exceed the SMTP limit
+	var parts bytes.Buffer
+	writer := multipart.NewWriter(&parts)
+	sb.WriteString("Content-Type: multipart/alternative; boundary=" + writer.Boundary() + "\r\n")
+	sb.WriteString("\r\n")
+	text, _ := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}})
+	_, _ = text.Write([]byte(strings.ReplaceAll(m.Body, "\n", "\r\n")))
+	html, _ := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	qp := quotedprintable.NewWriter(html)
+	_, _ = qp.Write([]byte(m.HTML))
+	_ = qp.Close()
+	_ = writer.Close()
+	sb.Write(parts.Bytes())
+	return []byte(sb.String())
+}
+
+// sanitizeHeader removes line breaks from a header value to prevent header injection.
+func sanitizeHeader(value string) string {
+	return strings.NewReplacer("\r", "", "\n", " ").Replace(value)
+}
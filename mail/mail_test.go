@@ -0,0 +1,167 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestMessageBytes(t *testing.T) {
+	c := qt.New(t)
+
+	msg := &Message{
+		To:      "user@example.com",
+		Subject: "Account\r\nBcc: attacker@example.com",
+		Body:    "line one\nline two",
+	}
+	data := string(msg.bytes("noreply@example.com", time.Unix(0, 0).UTC()))
+
+	headers, body, found := strings.Cut(data, "\r\n\r\n")
+	c.Assert(found, qt.IsTrue)
+	c.Assert(headers, qt.Contains, "From: noreply@example.com\r\n")
+	c.Assert(headers, qt.Contains, "To: user@example.com\r\n")
+	// Line breaks in headers cannot inject new headers
+	c.Assert(headers, qt.Contains, "Subject: Account Bcc: attacker@example.com\r\n")
+	c.Assert(strings.Contains(headers, "\r\nBcc:"), qt.IsFalse)
+	c.Assert(body, qt.Equals, "line one\r\nline two")
+}
+
+func TestSMTPSenderCheck(t *testing.T) {
+	c := qt.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	defer func() { _ = listener.Close() }()
+	commands := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		reader := bufio.NewReader(conn)
+		_, _ = conn.Write([]byte("220 test ESMTP\r\n"))
+		for _, reply := range []string{"250 test\r\n", "221 bye\r\n"} {
+			line, _ := reader.ReadString('\n')
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				return
+			}
+			commands <- fields[0]
+			_, _ = conn.Write([]byte(reply))
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sender := &SMTPSender{Host: "127.0.0.1", Port: addr.Port}
+	c.Assert(sender.Check(ctx), qt.IsNil)
+	c.Assert(<-commands, qt.Equals, "EHLO")
+	c.Assert(<-commands, qt.Equals, "QUIT")
+
+	// Nothing listens on the port once closed
+	c.Assert(listener.Close(), qt.IsNil)
+	c.Assert(sender.Check(ctx), qt.IsNotNil)
+}
+
+func TestDigestMessage(t *testing.T) {
+	c := qt.New(t)
+
+	digest := &Digest{
+		Name: "Alice",
+		Tools: []DigestTool{
+			{Title: "Ladder", Locality: "Girona", Cost: 10},
+			{Title: "Drill"},
+		},
+		More:           3,
+		UnsubscribeURL: "https://emprius.example/digest/unsubscribe?token=abc",
+	}
+	msg, err := digest.Message("alice@example.com")
+	c.Assert(err, qt.IsNil)
+	c.Assert(msg.To, qt.Equals, "alice@example.com")
+	c.Assert(msg.Subject, qt.Equals, "New tools near you")
+	c.Assert(msg.Body, qt.Equals, `Hi Alice,
+
+2 new tools were published near you on Emprius this week:
+
+- Ladder (Girona), 10 tokens/day
+- Drill, free
+
+...and 3 more, search them in the app.
+
+You receive this digest because you enabled it in your profile. To stop receiving it, open:
+https://emprius.example/digest/unsubscribe?token=abc
+`)
+
+	// Without unsubscribe URL the digest is disabled from the profile
+	digest = &Digest{Name: "Bob", Tools: []DigestTool{{Title: "Saw", Cost: 5}}}
+	msg, err = digest.Message("bob@example.com")
+	c.Assert(err, qt.IsNil)
+	c.Assert(msg.Body, qt.Contains, "1 new tool was published")
+	c.Assert(msg.Body, qt.Not(qt.Contains), "more")
+	c.Assert(msg.Body, qt.Contains, "You can disable it from your profile settings.")
+}
+
+func TestBranding(t *testing.T) {
+	c := qt.New(t)
+
+	links, err := ParseFooterLinks("Terms=https://example.com/terms, Help=https://example.com/help")
+	c.Assert(err, qt.IsNil)
+	c.Assert(links, qt.DeepEquals, []Link{
+		{Title: "Terms", URL: "https://example.com/terms"},
+		{Title: "Help", URL: "https://example.com/help"},
+	})
+	_, err = ParseFooterLinks("https://example.com/terms")
+	c.Assert(err, qt.IsNotNil)
+
+	for _, invalid := range []Branding{
+		{PrimaryColor: "red"},
+		{LogoURL: "javascript:alert(1)"},
+		{FooterLinks: []Link{{Title: "Terms", URL: "/terms"}}},
+		{ReplyTo: "not an address"},
+	} {
+		c.Assert(invalid.Validate(), qt.IsNotNil, qt.Commentf("%+v", invalid))
+	}
+	branding := Branding{
+		AppName:      "ToolShare",
+		LogoURL:      "https://example.com/logo.png",
+		PrimaryColor: "#123abc",
+		FooterLinks:  links,
+		ReplyTo:      "support@example.com",
+	}
+	c.Assert(branding.Validate(), qt.IsNil)
+
+	msg := &Message{To: "user@example.com", Subject: "Hello", Body: "Hi <Alice>,\n\nFirst line\nsecond line"}
+	c.Assert(branding.Apply(msg), qt.IsNil)
+	c.Assert(msg.ReplyTo, qt.Equals, "support@example.com")
+	c.Assert(msg.Body, qt.Equals, "Hi <Alice>,\n\nFirst line\nsecond line\n\n-- \nToolShare\n"+
+		"Terms: https://example.com/terms\nHelp: https://example.com/help\n")
+	c.Assert(msg.HTML, qt.Contains, `<img src="https://example.com/logo.png" alt="ToolShare"`)
+	c.Assert(msg.HTML, qt.Contains, "background-color:#123abc")
+	c.Assert(msg.HTML, qt.Contains, "Hi &lt;Alice&gt;,")
+	c.Assert(msg.HTML, qt.Contains, "First line<br>second line")
+	c.Assert(msg.HTML, qt.Contains, `<a href="https://example.com/help"`)
+
+	// The HTML version is sent as an alternative of the plain text
+	data := string(msg.bytes("noreply@example.com", time.Unix(0, 0).UTC()))
+	headers, body, found := strings.Cut(data, "\r\n\r\n")
+	c.Assert(found, qt.IsTrue)
+	c.Assert(headers, qt.Contains, "Reply-To: support@example.com\r\n")
+	c.Assert(headers, qt.Contains, "Content-Type: multipart/alternative; boundary=")
+	c.Assert(body, qt.Contains, "Content-Type: text/plain; charset=UTF-8")
+	c.Assert(body, qt.Contains, "Content-Type: text/html; charset=UTF-8")
+	c.Assert(body, qt.Contains, "Content-Transfer-Encoding: quoted-printable")
+
+	// The defaults are used without branding
+	msg = &Message{To: "user@example.com", Subject: "Hello", Body: "Hi"}
+	c.Assert(Branding{}.Apply(msg), qt.IsNil)
+	c.Assert(msg.ReplyTo, qt.Equals, "")
+	c.Assert(msg.Body, qt.Equals, "Hi\n\n-- \nEmprius\n")
+	c.Assert(msg.HTML, qt.Contains, "background-color:"+DefaultPrimaryColor)
+}
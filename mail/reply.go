@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"bufio"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// quoteHeaderRegexp matches the line most mail clients add before the quoted message of a
+// reply, i.e. "On Mon, 3 Jun 2024 at 10:00, Emprius <replies@example.com> wrote:".
+var quoteHeaderRegexp = regexp.MustCompile(`^(On\s.+wrote:|-+\s*Original Message\s*-+)$`)
+
+// PlusAddress returns the address with the tag appended to its local part, i.e.
+// replies+tag@example.com for replies@example.com.
+func PlusAddress(address, tag string) (string, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	local, domain, found := strings.Cut(parsed.Address, "@")
+	if !found {
+		return "", fmt.Errorf("invalid address %q", address)
+	}
+	if base, _, tagged := strings.Cut(local, "+"); tagged {
+		local = base
+	}
+	return local + "+" + tag + "@" + domain, nil
+}
+
+// AddressTag returns the tag of a plus address, the part of the local part after the first
+// plus sign, or an empty string if the address has no tag.
+func AddressTag(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+	local, _, _ := strings.Cut(address, "@")
+	_, tag, _ := strings.Cut(local, "+")
+	return tag
+}
+
+// AddressOf returns the bare address of a header value such as "Name <user@example.com>",
+// lower cased, or the value trimmed if it cannot be parsed.
+func AddressOf(value string) string {
+	if parsed, err := mail.ParseAddress(value); err == nil {
+		return strings.ToLower(parsed.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// ReplyText returns the text written in the plain text body of a reply, without the quoted
+// message and the signature.
+func ReplyText(body string) string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(body, "\r\n", "\n")))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		// The signature delimiter is "-- ", trimmed above
+		if line == "--" || quoteHeaderRegexp.MatchString(strings.TrimSpace(line)) {
+			break
+		}
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestPlusAddress(t *testing.T) {
+	c := qt.New(t)
+
+	address, err := PlusAddress("Emprius <replies@example.com>", "abc123")
+	c.Assert(err, qt.IsNil)
+	c.Assert(address, qt.Equals, "replies+abc123@example.com")
+	// The tag of the configured address is replaced
+	address, err = PlusAddress("replies+old@example.com", "abc123")
+	c.Assert(err, qt.IsNil)
+	c.Assert(address, qt.Equals, "replies+abc123@example.com")
+	_, err = PlusAddress("not an address", "abc123")
+	c.Assert(err, qt.IsNotNil)
+
+	c.Assert(AddressTag("Emprius <replies+abc123@example.com>"), qt.Equals, "abc123")
+	c.Assert(AddressTag("replies+abc123@example.com"), qt.Equals, "abc123")
+	c.Assert(AddressTag("replies@example.com"), qt.Equals, "")
+
+	c.Assert(AddressOf("Maria <Maria@Example.com>"), qt.Equals, "maria@example.com")
+	c.Assert(AddressOf(" maria@example.com "), qt.Equals, "maria@example.com")
+}
+
+func TestReplyText(t *testing.T) {
+	c := qt.New(t)
+
+	body := "Sure, I will bring it back on Sunday.\r\n" +
+		"Thanks!\r\n" +
+		"\r\n" +
+		"On Mon, 3 Jun 2024 at 10:00, Emprius <replies+abc@example.com> wrote:\r\n" +
+		"> Your booking request was accepted\r\n"
+	c.Assert(ReplyText(body), qt.Equals, "Sure, I will bring it back on Sunday.\nThanks!")
+
+	// Quoted lines are skipped and the signature is removed
+	body = "> Is the drill free?\nYes, it is.\n\n-- \nMaria\n"
+	c.Assert(ReplyText(body), qt.Equals, "Yes, it is.")
+
+	body = "Ok\n\n-----Original Message-----\nFrom: Emprius\n"
+	c.Assert(ReplyText(body), qt.Equals, "Ok")
+
+	c.Assert(ReplyText("> only quoted text\n"), qt.Equals, "")
+}
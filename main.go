@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	flag "github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
+	"github.com/emprius/emprius-app-backend/api"
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/geocoding"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/emprius/emprius-app-backend/password"
+	"github.com/emprius/emprius-app-backend/payment"
+	"github.com/emprius/emprius-app-backend/push"
 	"github.com/emprius/emprius-app-backend/service"
+	"github.com/emprius/emprius-app-backend/telegram"
+	"github.com/emprius/emprius-app-backend/trust"
 
 	"github.com/rs/zerolog/log"
 )
@@ -23,6 +34,69 @@ func main() {
 	flag.String("secret", "", "sets the secret for JWT")
 	flag.String("mongo", "mongodb://localhost:27017", "sets the mongo URI")
 	flag.String("registerAuthToken", "", "sets the registerAuthToken new users need to provide")
+	flag.String("smtpHost", "", "sets the SMTP server host used to send emails (emails are only logged if empty)")
+	flag.Int("smtpPort", 587, "sets the SMTP server port")
+	flag.String("smtpUser", "", "sets the SMTP server username")
+	flag.String("smtpPassword", "", "sets the SMTP server password")
+	flag.String("smtpFrom", "", "sets the sender address of the emails")
+	flag.String("brandingAppName", mail.DefaultAppName, "sets the app name shown in the emails")
+	flag.String("brandingLogoURL", "", "sets the URL of the logo shown in the emails")
+	flag.String("brandingPrimaryColor", mail.DefaultPrimaryColor, "sets the color of the header and links of the emails")
+	flag.String("brandingFooterLinks", "", "sets the comma separated title=URL links of the footer of the emails")
+	flag.String("brandingReplyTo", "", "sets the reply-to address of the emails")
+	flag.String("inboundAddress", "", "sets the address receiving the replies to the booking emails, e.g. replies@example.com")
+	flag.String("inboundMailToken", "", "sets the token of the inbound mail webhook of the mail provider (disabled if empty)")
+	flag.Bool("adminRecovery", false, "enables the account recovery flow approved by community admins")
+	flag.Bool("communityToolApproval", false, "lets the community members share tools, listed once approved by a community admin")
+	flag.Int("maxInviteCodes", 5, "sets the maximum number of unused invite codes a user can have")
+	flag.Duration("inviteCodeCooldown", 24*time.Hour, "sets the minimum time between two invite codes of a user")
+	flag.Duration("bookingExpiration", 7*24*time.Hour, "sets the time a booking request can stay pending before it expires")
+	flag.Duration("disagreementPeriod", 7*24*time.Hour, "sets the time to resolve a return disagreement before it is escalated")
+	flag.Duration("cancellationWindow", 48*time.Hour, "sets how long before a strict booking starts cancelling it has a penalty")
+	flag.Int("cancellationFee", 50, "sets the percentage of the booking price paid to the owner for a late strict cancellation")
+	flag.Int("depreciationRate", 10, "sets the percentage of its estimated value a tool loses each year, suggested to the owners")
+	flag.String("mapCenter", "41.695384,2.492793", "sets the default center of the maps of the clients, as latitude,longitude")
+	flag.Int("defaultSearchRadius", 0, "sets the radius in meters of the tool searches without distance (not limited if zero)")
+	flag.Int("maxSearchRadius", 0, "sets the maximum radius in meters of the tool searches (not limited if zero)")
+	flag.String("geocodingURL", "", "sets the Nominatim server URL used to geocode addresses (geocoding is disabled if empty)")
+	flag.String("federationPeers", "", "sets the comma separated base URLs of the peer instances for federated tool searches")
+	flag.String("federationToken", "", "sets the token shared by the federation instances (peer searches are refused if empty)")
+	flag.String("trustWeights", "", "sets the trust score weights, e.g. bookings=0.3,rating=0.3,age=0.1,response=0.15,disputes=0.15")
+	flag.String("fcmCredentials", "", "sets the path of the Google service account JSON key used to send FCM push notifications")
+	flag.String("vapidPrivateKey", "", "sets the base64url VAPID private key used to send Web Push notifications")
+	flag.String("vapidSubject", "", "sets the VAPID contact of the Web Push notifications, e.g. mailto:admin@example.com")
+	flag.String("telegramToken", "", "sets the token of the Telegram bot used to send notifications (disabled if empty)")
+	flag.String("telegramBotUsername", "", "sets the username of the Telegram bot, used in the links that link the accounts")
+	flag.String("paymentProvider", "", "sets the provider of the booking payments in money, manual or stripe (disabled if empty)")
+	flag.String("stripeSecretKey", "", "sets the secret API key of the Stripe account of the payments")
+	flag.String("stripeWebhookSecret", "", "sets the signing secret of the Stripe webhook endpoint /payments/webhook")
+	flag.String("paymentCurrency", "eur", "sets the ISO 4217 currency of the booking payments")
+	flag.Int64("paymentTokenValue", 100, "sets the value of a token of the booking prices in cents of the payment currency")
+	flag.String("paymentReturnURL", "", "sets the page the payers return to after paying, {booking} is replaced by the booking id")
+	flag.String("publicURL", "", "sets the public base URL of the API used in the links of the emails, e.g. https://api.example.com")
+	flag.Duration("auditRetention", 8760*time.Hour, "sets the time the audit log entries are kept")
+	flag.Duration("inactivityPeriod", 0, "sets the time without activity after which an account is anonymized (disabled if zero)")
+	flag.Duration("inactivityGracePeriod", 720*time.Hour, "sets the time between the inactivity warning and the anonymization")
+	flag.Bool("trustProxy", false, "takes the client IP from the X-Forwarded-For and X-Real-IP headers of the reverse proxy")
+	flag.String("countryHeader", "", "sets the header with the client country set by the reverse proxy, e.g. CF-IPCountry")
+	flag.Int("loginMaxAttempts", 5, "sets the number of consecutive failed logins after which an account is locked")
+	flag.Duration("loginLockout", 5*time.Minute, "sets the duration of the first login lockout, doubled on each further failure")
+	flag.Int("passwordMinLength", 8, "sets the minimum length of the passwords")
+	flag.Int("passwordMinScore", 2, "sets the minimum strength of the passwords, from 0 (only common ones rejected) to 4")
+	flag.Uint32("passwordHashTime", 1, "sets the Argon2id passes over the memory of the password hashes")
+	flag.Uint32("passwordHashMemory", 64*1024, "sets the Argon2id memory in KiB of the password hashes")
+	flag.Uint8("passwordHashThreads", 4, "sets the Argon2id threads of the password hashes")
+	flag.Duration("searchCacheTTL", 30*time.Second, "sets the time the tool search results are cached (disabled if negative)")
+	flag.Duration("infoCacheTTL", time.Minute, "sets the time the /info response is cached (disabled if negative)")
+	flag.Bool("backupImages", false, "includes the images and media in the backups made with the backup command")
+	flag.Int("users", 50, "sets the number of users generated by the seed command")
+	flag.Int("tools", 200, "sets the number of tools generated by the seed command")
+	flag.Int("bookings", 500, "sets the number of bookings generated by the seed command")
+	flag.Int64("randomSeed", 1, "sets the random seed of the seed command, the same seed generates the same data")
+	flag.String("locale", "en", "sets the locale of the names, localities and tools generated by the seed command")
+	flag.String("tenants", "", "sets the path of the JSON file with the tenants of a multi-tenant deployment")
+	flag.String("tenant", "", "sets the tenant whose database is used by the backup, restore, seed and dry-run-indexes commands")
+	flag.Bool("dry-run-indexes", false, "reports the missing database indexes without creating them, and exits")
 	flag.Parse()
 
 	// Initialize Viper
@@ -37,6 +111,33 @@ func main() {
 	mongoURI := viper.GetString("mongo")
 	registerAuthToken := viper.GetString("registerAuthToken")
 	debug := viper.GetBool("debug")
+	smtpHost := viper.GetString("smtpHost")
+	adminRecovery := viper.GetBool("adminRecovery")
+
+	// backup and restore commands, the path of the backup is their argument, and seed command
+	switch command := flag.Arg(0); command {
+	case "":
+	case "seed":
+		os.Exit(seedCommand(mongoURI, api.SeedOptions{
+			Users:    viper.GetInt("users"),
+			Tools:    viper.GetInt("tools"),
+			Bookings: viper.GetInt("bookings"),
+			Seed:     viper.GetInt64("randomSeed"),
+			Locale:   viper.GetString("locale"),
+			Now:      time.Now().UTC().Truncate(24 * time.Hour),
+		}))
+	case "backup", "restore":
+		if flag.NArg() != 2 {
+			log.Fatal().Msgf("usage: %s [flags] %s <file.tar.gz>", os.Args[0], command)
+		}
+		os.Exit(backupCommand(mongoURI, command, flag.Arg(1), viper.GetBool("backupImages")))
+	default:
+		log.Fatal().Msgf("unknown command %q, expected backup, restore or seed", command)
+	}
+
+	if viper.GetBool("dry-run-indexes") {
+		os.Exit(dryRunIndexes(mongoURI))
+	}
 
 	// if no secret is provided, generate a random one
 	if secret == "" {
@@ -64,6 +165,158 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to create service")
 	}
 	defer s.Close()
+	s.Options.AdminRecovery = adminRecovery
+	s.Options.CommunityToolApproval = viper.GetBool("communityToolApproval")
+	s.Options.PendingBookingTTL = viper.GetDuration("bookingExpiration")
+	s.Options.DisagreementPeriod = viper.GetDuration("disagreementPeriod")
+	s.Options.CancellationWindow = viper.GetDuration("cancellationWindow")
+	s.Options.CancellationFee = viper.GetInt("cancellationFee")
+	s.Options.DepreciationRate = viper.GetInt("depreciationRate")
+	s.Options.MaxInviteCodes = viper.GetInt("maxInviteCodes")
+	s.Options.InviteCodeCooldown = viper.GetDuration("inviteCodeCooldown")
+	s.Options.PublicURL = viper.GetString("publicURL")
+	s.Options.AuditRetention = viper.GetDuration("auditRetention")
+	s.Options.InactivityPeriod = viper.GetDuration("inactivityPeriod")
+	s.Options.InactivityGracePeriod = viper.GetDuration("inactivityGracePeriod")
+	s.Options.TrustProxy = viper.GetBool("trustProxy")
+	s.Options.CountryHeader = viper.GetString("countryHeader")
+	s.Options.LoginMaxAttempts = viper.GetInt("loginMaxAttempts")
+	s.Options.LoginLockout = viper.GetDuration("loginLockout")
+	s.Options.SearchCacheTTL = viper.GetDuration("searchCacheTTL")
+	s.Options.InfoCacheTTL = viper.GetDuration("infoCacheTTL")
+	s.Options.PasswordPolicy = &password.Policy{
+		MinLength: viper.GetInt("passwordMinLength"),
+		MaxLength: password.DefaultPolicy.MaxLength,
+		MinScore:  viper.GetInt("passwordMinScore"),
+	}
+	s.Options.PasswordHashing = &password.Argon2Params{
+		Time:    viper.GetUint32("passwordHashTime"),
+		Memory:  viper.GetUint32("passwordHashMemory"),
+		Threads: uint8(viper.GetUint("passwordHashThreads")),
+	}
+	if s.Options.PasswordHashing.Time == 0 || s.Options.PasswordHashing.Threads == 0 {
+		log.Fatal().Msg("the password hash time and threads must be at least 1")
+	}
+	if s.Options.MapCenter, err = api.ParseLocation(viper.GetString("mapCenter")); err != nil {
+		log.Fatal().Err(err).Msg("invalid map center")
+	}
+	s.Options.DefaultSearchRadius = viper.GetInt("defaultSearchRadius")
+	s.Options.MaxSearchRadius = viper.GetInt("maxSearchRadius")
+	if geocodingURL := viper.GetString("geocodingURL"); geocodingURL != "" {
+		s.Options.Geocoder = &geocoding.Nominatim{
+			URL:       geocodingURL,
+			UserAgent: "emprius-app-backend",
+		}
+	}
+	trustWeights, err := trust.ParseWeights(viper.GetString("trustWeights"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid trust score weights")
+	}
+	s.Options.TrustWeights = &trustWeights
+	for _, peer := range strings.Split(viper.GetString("federationPeers"), ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			s.Options.FederationPeers = append(s.Options.FederationPeers, peer)
+		}
+	}
+	s.Options.FederationToken = viper.GetString("federationToken")
+	pushRouter := push.Router{}
+	if fcmCredentials := viper.GetString("fcmCredentials"); fcmCredentials != "" {
+		credentials, err := os.ReadFile(fcmCredentials)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not read the FCM credentials")
+		}
+		fcm, err := push.NewFCM(credentials)
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid FCM credentials")
+		}
+		pushRouter[push.PlatformFCM] = fcm
+	}
+	if vapidPrivateKey := viper.GetString("vapidPrivateKey"); vapidPrivateKey != "" {
+		webPush, err := push.NewWebPush(vapidPrivateKey, viper.GetString("vapidSubject"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid VAPID private key")
+		}
+		pushRouter[push.PlatformWebPush] = webPush
+		s.Options.VAPIDPublicKey = webPush.PublicKey()
+	}
+	if len(pushRouter) > 0 {
+		s.Options.Push = pushRouter
+	}
+	footerLinks, err := mail.ParseFooterLinks(viper.GetString("brandingFooterLinks"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid email footer links")
+	}
+	branding := &mail.Branding{
+		AppName:      viper.GetString("brandingAppName"),
+		LogoURL:      viper.GetString("brandingLogoURL"),
+		PrimaryColor: viper.GetString("brandingPrimaryColor"),
+		FooterLinks:  footerLinks,
+		ReplyTo:      viper.GetString("brandingReplyTo"),
+	}
+	if err := branding.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid email branding")
+	}
+	s.Options.Branding = branding
+	if inboundAddress := viper.GetString("inboundAddress"); inboundAddress != "" {
+		if _, err := mail.PlusAddress(inboundAddress, "token"); err != nil {
+			log.Fatal().Err(err).Msg("invalid inbound address")
+		}
+		s.Options.InboundAddress = inboundAddress
+	}
+	s.Options.InboundMailToken = viper.GetString("inboundMailToken")
+	if telegramToken := viper.GetString("telegramToken"); telegramToken != "" {
+		bot := &telegram.Bot{
+			Token:    telegramToken,
+			Username: strings.TrimPrefix(viper.GetString("telegramBotUsername"), "@"),
+		}
+		if bot.Username == "" {
+			log.Fatal().Msg("the telegram bot username is required with the telegram token")
+		}
+		if s.Options.PublicURL != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := bot.SetWebhook(ctx, strings.TrimSuffix(s.Options.PublicURL, "/")+"/telegram/webhook"); err != nil {
+				log.Error().Err(err).Msg("could not register the telegram webhook")
+			}
+			cancel()
+		}
+		s.Options.Telegram = bot
+	}
+	switch provider := viper.GetString("paymentProvider"); provider {
+	case "":
+	case "manual":
+		s.Options.Payments = payment.Manual{}
+	case "stripe":
+		stripe := &payment.Stripe{
+			SecretKey:     viper.GetString("stripeSecretKey"),
+			WebhookSecret: viper.GetString("stripeWebhookSecret"),
+		}
+		if stripe.SecretKey == "" || stripe.WebhookSecret == "" {
+			log.Fatal().Msg("the stripe secret key and webhook secret are required with the stripe payments")
+		}
+		if viper.GetString("paymentReturnURL") == "" {
+			log.Fatal().Msg("the payment return URL is required with the stripe payments")
+		}
+		s.Options.Payments = stripe
+	default:
+		log.Fatal().Msgf("unknown payment provider %q, expected manual or stripe", provider)
+	}
+	s.Options.PaymentCurrency = viper.GetString("paymentCurrency")
+	s.Options.PaymentTokenValue = viper.GetInt64("paymentTokenValue")
+	s.Options.PaymentReturnURL = viper.GetString("paymentReturnURL")
+	if smtpHost != "" {
+		s.Options.Mailer = &mail.SMTPSender{
+			Host:     smtpHost,
+			Port:     viper.GetInt("smtpPort"),
+			Username: viper.GetString("smtpUser"),
+			Password: viper.GetString("smtpPassword"),
+			From:     viper.GetString("smtpFrom"),
+		}
+	}
+	if tenantsFile := viper.GetString("tenants"); tenantsFile != "" {
+		if s.Tenants, err = service.LoadTenants(tenantsFile); err != nil {
+			log.Fatal().Err(err).Msg("could not load the tenants")
+		}
+	}
 	s.Start(host, port)
 
 	log.Info().Msg("startup complete")
@@ -75,3 +328,95 @@ func main() {
 	log.Warn().Msgf("received SIGTERM, exiting at %s", time.Now().Format(time.RFC850))
 	os.Exit(0)
 }
+
+// openDatabase connects to the database of the commands, the database of the tenant given by
+// the tenant flag in a multi-tenant deployment.
+func openDatabase(mongoURI string) *db.Database {
+	database, err := db.New(mongoURI)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to the database")
+	}
+	if tenant := viper.GetString("tenant"); tenant != "" {
+		if database, err = database.Tenant(tenant); err != nil {
+			log.Fatal().Err(err).Msg("invalid tenant")
+		}
+	}
+	return database
+}
+
+// dryRunIndexes reports the indexes missing in the database, and returns the exit code: 1 if
+// any index is missing.
+func dryRunIndexes(mongoURI string) int {
+	database := openDatabase(mongoURI)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	defer func() {
+		if err := database.Close(ctx); err != nil {
+			log.Warn().Err(err).Msg("failed to close the database")
+		}
+	}()
+	missing, err := db.MissingIndexes(ctx, database)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list the indexes")
+		return 1
+	}
+	for _, index := range missing {
+		log.Warn().Msgf("missing index %s", index)
+	}
+	if len(missing) > 0 {
+		log.Warn().Msgf("%d indexes missing, they will be created on the next startup", len(missing))
+		return 1
+	}
+	log.Info().Msg("all indexes exist")
+	return 0
+}
+
+// backupCommand backs up the database to the file at path, or restores it from the file, and
+// returns the exit code.
+func backupCommand(mongoURI, command, path string, images bool) int {
+	database := openDatabase(mongoURI)
+	ctx := context.Background()
+	defer func() {
+		if err := database.Close(ctx); err != nil {
+			log.Warn().Err(err).Msg("failed to close the database")
+		}
+	}()
+	var manifest *db.BackupManifest
+	var err error
+	if command == "backup" {
+		manifest, err = database.WriteBackup(ctx, path, images)
+	} else {
+		manifest, err = database.RestoreBackup(ctx, path)
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("%s failed", command)
+		return 1
+	}
+	for name, count := range manifest.Collections {
+		log.Info().Msgf("%s: %d documents", name, count)
+	}
+	log.Info().Msgf("%s of %s completed", command, path)
+	return 0
+}
+
+// seedCommand fills the empty database with demo data, and returns the exit code.
+func seedCommand(mongoURI string, opts api.SeedOptions) int {
+	database := openDatabase(mongoURI)
+	defer func() {
+		if err := database.Close(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("failed to close the database")
+		}
+	}()
+	if err := database.CreateTables(); err != nil {
+		log.Error().Err(err).Msg("failed to create tables")
+		return 1
+	}
+	start := time.Now()
+	if err := api.Seed(context.Background(), database, opts); err != nil {
+		log.Error().Err(err).Msg("seed failed")
+		return 1
+	}
+	log.Info().Msgf("seeded %d users, %d tools and %d bookings in %s, their password is %s",
+		opts.Users, opts.Tools, opts.Bookings, time.Since(start).Round(time.Millisecond), api.DefaultSeedPassword)
+	return 0
+}
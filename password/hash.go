@@ -0,0 +1,93 @@
+package password
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// argon2Prefix starts the Argon2id hashes in the PHC string format.
+	argon2Prefix = "$argon2id$"
+	// saltLength is the length in bytes of the random salt of the hashes.
+	saltLength = 16
+	// keyLength is the length in bytes of the hashes.
+	keyLength = 32
+)
+
+// Argon2Params are the cost parameters of the Argon2id hashes.
+type Argon2Params struct {
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Memory is the memory used in KiB.
+	Memory uint32
+	// Threads is the number of lanes hashed in parallel.
+	Threads uint8
+}
+
+// DefaultArgon2 are the parameters recommended by the x/crypto/argon2 package: one pass over
+// 64 MiB with 4 threads.
+var DefaultArgon2 = Argon2Params{
+	Time:    1,
+	Memory:  64 * 1024,
+	Threads: 4,
+}
+
+// Hash returns the Argon2id hash of the password with a random salt, in the PHC string format
+// (e.g. $argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>), which keeps the parameters.
+func (p Argon2Params) Hash(password string) ([]byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("could not generate salt: %w", err)
+	}
+	return p.HashWithSalt(password, salt), nil
+}
+
+// HashWithSalt returns the Argon2id hash of the password with the given salt. Hash must be used
+// instead, unless the hash must be reproducible (i.e. for generated data).
+func (p Argon2Params) HashWithSalt(password string, salt []byte) []byte {
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, keyLength)
+	return []byte(fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)))
+}
+
+// Verify returns whether the password matches the Argon2id hash, and whether the hash was made
+// with other parameters than p, so it should be replaced with a new one.
+func (p Argon2Params) Verify(password string, hash []byte) (match, rehash bool) {
+	parts := bytes.Split(hash, []byte("$"))
+	if !IsArgon2id(hash) || len(parts) != 6 {
+		return false, false
+	}
+	var version int
+	if _, err := fmt.Sscanf(string(parts[2]), "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+	var params Argon2Params
+	if _, err := fmt.Sscanf(string(parts[3]), "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil ||
+		params.Time == 0 || params.Threads == 0 {
+		return false, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(string(parts[4]))
+	if err != nil {
+		return false, false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(string(parts[5]))
+	if err != nil || len(key) == 0 {
+		return false, false
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, computed) != 1 {
+		return false, false
+	}
+	return true, params != p || len(key) != keyLength
+}
+
+// IsArgon2id returns whether the hash is an Argon2id hash, as opposed to the hashes of an older
+// scheme.
+func IsArgon2id(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte(argon2Prefix))
+}
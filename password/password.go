@@ -0,0 +1,337 @@
+// Package password checks the passwords against the policy of the instance: a length range, a
+// denylist of common passwords and a minimum strength. The strength is estimated in the manner
+// of zxcvbn, as the number of guesses needed by an attacker trying the common passwords, the
+// personal data of the user, the keyboard and alphabetical sequences, the repetitions and the
+// years before brute force. The passwords are stored as Argon2id hashes.
+package password
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	// bruteforceCardinality is the number of guesses of each character not in any pattern.
+	bruteforceCardinality = 10
+	// minMatchGuesses is the minimum number of guesses of a pattern, so short patterns are not
+	// cheaper than the characters they replace.
+	minMatchGuesses = 10
+	// minMatchLength is the minimum length of a pattern.
+	minMatchLength = 3
+)
+
+// Violation codes of the policy.
+const (
+	TooShort = "too_short"
+	TooLong  = "too_long"
+	Common   = "common"
+	Weak     = "weak"
+)
+
+// Policy is the password policy of an instance.
+type Policy struct {
+	MinLength int `json:"minLength"`
+	MaxLength int `json:"maxLength"`
+	// MinScore is the minimum strength of the passwords, from 0 (any) to 4 (very hard to guess).
+	MinScore int `json:"minScore"`
+}
+
+// DefaultPolicy is the policy used when none is configured.
+var DefaultPolicy = Policy{
+	MinLength: 8,
+	MaxLength: 128,
+	MinScore:  2,
+}
+
+// Violation is a rule of the policy a password does not follow.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Check returns the violations of the policy by the password, none if it is valid. The personal
+// data of the user (i.e. the name and email) are the first words tried to guess the password.
+// The common passwords are always rejected, even with a MinScore of 0.
+func (p Policy) Check(password string, personal ...string) []Violation {
+	violations := []Violation{}
+	length := len([]rune(password))
+	if length < p.MinLength {
+		violations = append(violations, Violation{
+			Code:    TooShort,
+			Message: fmt.Sprintf("the password must have at least %d characters", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{
+			Code:    TooLong,
+			Message: fmt.Sprintf("the password must have at most %d characters", p.MaxLength),
+		})
+	}
+	if isCommon(password) {
+		violations = append(violations, Violation{
+			Code:    Common,
+			Message: "the password is too common",
+		})
+	} else if score := Score(password, personal...); score < p.MinScore {
+		violations = append(violations, Violation{
+			Code: Weak,
+			Message: fmt.Sprintf("the password is too easy to guess (strength %d of 4, at least %d required), "+
+				"avoid personal data, common words, sequences and repetitions", score, p.MinScore),
+		})
+	}
+	return violations
+}
+
+// Score returns the strength of the password from 0 to 4, with the zxcvbn thresholds: 0 if it is
+// guessed in less than 10^3 guesses, 1 in less than 10^6, 2 in less than 10^8, 3 in less than
+// 10^10 and 4 otherwise.
+func Score(password string, personal ...string) int {
+	guesses := Guesses(password, personal...)
+	for score, threshold := range []float64{1e3, 1e6, 1e8, 1e10} {
+		if guesses < threshold+5 {
+			return score
+		}
+	}
+	return 4
+}
+
+// Guesses returns the estimated number of guesses needed to find the password. The password is
+// split in the sequence of patterns and brute forced characters needing the fewest guesses, and
+// its guesses are the product of theirs.
+func Guesses(password string, personal ...string) float64 {
+	original := []rune(password)
+	if len(original) == 0 {
+		return 1
+	}
+	lower := []rune(strings.ToLower(password))
+	if len(lower) != len(original) {
+		// Lowercasing changed the length of the password, only brute force is estimated
+		return math.Pow(bruteforceCardinality, float64(len(original)))
+	}
+	normalized := []rune(unleet(string(lower)))
+	dictionary := personalRanks(personal)
+
+	// best[i] is the fewest guesses of the first i characters
+	best := make([]float64, len(normalized)+1)
+	best[0] = 1
+	for end := 1; end <= len(normalized); end++ {
+		best[end] = best[end-1] * bruteforceCardinality
+		for start := end - minMatchLength; start >= 0; start-- {
+			guesses := matchGuesses(original[start:end], lower[start:end], normalized[start:end], dictionary)
+			if guesses == 0 {
+				continue
+			}
+			best[end] = math.Min(best[end], best[start]*math.Max(guesses, minMatchGuesses))
+		}
+	}
+	return best[len(normalized)]
+}
+
+// matchGuesses returns the fewest guesses of the token as a single pattern, or 0 if it does not
+// match any. The token is given as typed, lowercased and with the l33t substitutions undone.
+func matchGuesses(original, lower, normalized []rune, dictionary map[string]int) float64 {
+	var guesses float64
+	better := func(g float64) {
+		if g > 0 && (guesses == 0 || g < guesses) {
+			guesses = g
+		}
+	}
+	variations := uppercaseVariations(original)
+	words := map[string]float64{string(lower): variations, reverse(string(lower)): variations * 2}
+	if string(lower) != string(normalized) {
+		words[string(normalized)] = variations * 2
+		words[reverse(string(normalized))] = variations * 4
+	}
+	for word, factor := range words {
+		if rank, ok := dictionary[word]; ok {
+			better(float64(rank) * factor)
+		}
+		if rank, ok := ranks[word]; ok {
+			better(float64(len(dictionary)+rank) * factor)
+		}
+	}
+	better(sequenceGuesses(lower))
+	better(keyboardGuesses(lower))
+	better(repeatGuesses(lower))
+	better(yearGuesses(lower))
+	return guesses
+}
+
+// isCommon returns whether the password is a common one, ignoring the case and l33t substitutions.
+func isCommon(password string) bool {
+	lower := strings.ToLower(password)
+	_, common := ranks[lower]
+	_, leet := ranks[unleet(lower)]
+	return common || leet
+}
+
+// ranks are the ranks of the common passwords, starting at 1.
+var ranks = func() map[string]int {
+	ranks := make(map[string]int, len(common))
+	for i, word := range common {
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}()
+
+// personalRanks returns the ranks of the personal data and their words (i.e. the parts of an
+// email), which are the first guesses.
+func personalRanks(personal []string) map[string]int {
+	dictionary := map[string]int{}
+	add := func(word string) {
+		word = unleet(strings.ToLower(word))
+		if len([]rune(word)) < minMatchLength {
+			return
+		}
+		if _, ok := dictionary[word]; !ok {
+			dictionary[word] = len(dictionary) + 1
+		}
+	}
+	for _, data := range personal {
+		add(data)
+		for _, word := range strings.FieldsFunc(data, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			add(word)
+		}
+	}
+	return dictionary
+}
+
+// leet are the l33t substitutions undone before looking for words.
+var leet = strings.NewReplacer("4", "a", "@", "a", "8", "b", "3", "e", "6", "g", "1", "i", "!", "i",
+	"0", "o", "5", "s", "$", "s", "7", "t", "+", "t", "2", "z")
+
+// unleet undoes the l33t substitutions of a lowercased word. A word made only of digits is kept,
+// to be found as a number.
+func unleet(word string) string {
+	if strings.IndexFunc(word, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+		return word
+	}
+	return leet.Replace(word)
+}
+
+// uppercaseVariations returns how many capitalizations of a word are tried to find the token: 1 if
+// it is lowercase, 2 if only its first letter or every letter is uppercase, and the number of
+// ways to place its uppercase letters otherwise.
+func uppercaseVariations(token []rune) float64 {
+	upper, letters := 0, 0
+	for _, r := range token {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	if upper == letters || (upper == 1 && unicode.IsUpper(token[0])) {
+		return 2
+	}
+	variations := 0.0
+	for k := 1; k <= min(upper, letters-upper); k++ {
+		variations += binomial(letters, k)
+	}
+	return math.Max(variations, 2)
+}
+
+// sequenceGuesses returns the guesses of an alphabetical or numerical sequence with a constant step
+// of one (i.e. "abcd" or "9876"), or 0 if the token is not one.
+func sequenceGuesses(token []rune) float64 {
+	step := token[1] - token[0]
+	if step != 1 && step != -1 {
+		return 0
+	}
+	for i := 1; i < len(token); i++ {
+		if token[i]-token[i-1] != step || isDigit(token[i]) != isDigit(token[0]) {
+			return 0
+		}
+	}
+	var base float64
+	switch {
+	case strings.ContainsRune("az019", token[0]):
+		base = 4
+	case isDigit(token[0]):
+		base = 10
+	default:
+		base = 26
+	}
+	if step < 0 {
+		base *= 2
+	}
+	return base * float64(len(token))
+}
+
+// keyboardRows are the rows of a QWERTY keyboard.
+var keyboardRows = []string{"1234567890-=", "qwertyuiop[]", "asdfghjkl;'", "zxcvbnm,./"}
+
+// keyboardGuesses returns the guesses of adjacent keys of a keyboard row (i.e. "qwerty"), or 0 if
+// the token is not one.
+func keyboardGuesses(token []rune) float64 {
+	if len(token) < minMatchLength+1 {
+		return 0
+	}
+	for _, row := range keyboardRows {
+		if strings.Contains(row, string(token)) || strings.Contains(row, reverse(string(token))) {
+			return 40 * float64(len(token))
+		}
+	}
+	return 0
+}
+
+// repeatGuesses returns the guesses of a repetition of a shorter token (i.e. "aaa" or "abab"), or
+// 0 if the token is not one.
+func repeatGuesses(token []rune) float64 {
+	for size := 1; size <= len(token)/2; size++ {
+		if len(token)%size != 0 {
+			continue
+		}
+		base := string(token[:size])
+		if strings.Repeat(base, len(token)/size) != string(token) {
+			continue
+		}
+		count := float64(len(token) / size)
+		if size == 1 {
+			return bruteforceCardinality * count
+		}
+		return Guesses(base) * count
+	}
+	return 0
+}
+
+// yearGuesses returns the guesses of a recent year (1900 to 2039), or 0 if the token is not one.
+func yearGuesses(token []rune) float64 {
+	if len(token) != 4 || !isDigit(token[0]) || !isDigit(token[1]) || !isDigit(token[2]) || !isDigit(token[3]) {
+		return 0
+	}
+	if year := string(token); year >= "1900" && year <= "2039" {
+		return 140
+	}
+	return 0
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package password
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestScore(t *testing.T) {
+	c := qt.New(t)
+
+	for _, tc := range []struct {
+		password string
+		score    int
+	}{
+		{"password", 0},
+		{"P@ssw0rd", 0},
+		{"abcdefgh", 0},
+		{"qwertyuiop", 0},
+		{"aaaaaaaaaaaa", 0},
+		{"barcelona1992", 1},
+		{"correcthorsebatterystaple", 4},
+		{"Tr0ub4dor&3", 4},
+	} {
+		c.Assert(Score(tc.password), qt.Equals, tc.score, qt.Commentf("password %q", tc.password))
+	}
+
+	// The personal data of the user are guessed first
+	c.Assert(Score("mariagarcia77", "Maria Garcia", "maria.garcia@example.com"), qt.Equals, 1)
+	c.Assert(Score("mariagarcia77"), qt.Equals, 4)
+}
+
+func TestCheck(t *testing.T) {
+	c := qt.New(t)
+
+	codes := func(violations []Violation) []string {
+		result := []string{}
+		for _, v := range violations {
+			result = append(result, v.Code)
+		}
+		return result
+	}
+	c.Assert(codes(DefaultPolicy.Check("correcthorsebatterystaple")), qt.DeepEquals, []string{})
+	c.Assert(codes(DefaultPolicy.Check("Tr0ub4")), qt.DeepEquals, []string{TooShort, Weak})
+	c.Assert(codes(DefaultPolicy.Check("Dragon")), qt.DeepEquals, []string{TooShort, Common})
+	c.Assert(codes(DefaultPolicy.Check("ownerpass", "owner")), qt.DeepEquals, []string{Weak})
+
+	// Without a minimum score only the length and the common passwords are checked
+	lenient := Policy{MinLength: 4, MaxLength: 10}
+	c.Assert(codes(lenient.Check("ownerpass", "owner")), qt.DeepEquals, []string{})
+	c.Assert(codes(lenient.Check("letmein")), qt.DeepEquals, []string{Common})
+	c.Assert(codes(lenient.Check("correcthorse")), qt.DeepEquals, []string{TooLong})
+}
+
+func TestHash(t *testing.T) {
+	c := qt.New(t)
+	params := Argon2Params{Time: 1, Memory: 1024, Threads: 1}
+
+	hash, err := params.Hash("correct horse")
+	c.Assert(err, qt.IsNil)
+	c.Assert(IsArgon2id(hash), qt.IsTrue)
+	c.Assert(string(hash), qt.Matches, `\$argon2id\$v=19\$m=1024,t=1,p=1\$[^$]+\$[^$]+`)
+	again, err := params.Hash("correct horse")
+	c.Assert(err, qt.IsNil)
+	c.Assert(again, qt.Not(qt.DeepEquals), hash)
+
+	match, rehash := params.Verify("correct horse", hash)
+	c.Assert(match, qt.IsTrue)
+	c.Assert(rehash, qt.IsFalse)
+	match, _ = params.Verify("wrong horse", hash)
+	c.Assert(match, qt.IsFalse)
+
+	// The hashes made with other parameters are still verified, and must be replaced
+	stronger := Argon2Params{Time: 2, Memory: 2048, Threads: 1}
+	match, rehash = stronger.Verify("correct horse", hash)
+	c.Assert(match, qt.IsTrue)
+	c.Assert(rehash, qt.IsTrue)
+
+	for _, invalid := range []string{
+		"",
+		"legacy",
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5",
+		"$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5",
+	} {
+		match, _ = params.Verify("correct horse", []byte(invalid))
+		c.Assert(match, qt.IsFalse)
+	}
+	c.Assert(params.HashWithSalt("correct horse", []byte("saltsaltsaltsalt")), qt.DeepEquals,
+		params.HashWithSalt("correct horse", []byte("saltsaltsaltsalt")))
+}
@@ -0,0 +1,92 @@
+// Package payment collects in real money the price of the bookings, for the groups that charge
+// it, through a payment provider: a Stripe Checkout page, or by hand outside the platform.
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrInvalidSignature is returned when a webhook notification is not signed by the provider.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrIgnoredEvent is returned for the webhook notifications not changing the status of a
+	// payment, which must be acknowledged anyway.
+	ErrIgnoredEvent = errors.New("ignored webhook event")
+)
+
+// Status is the status of a payment.
+type Status string
+
+const (
+	// StatusPending payments are waiting for the payer.
+	StatusPending Status = "pending"
+	// StatusPaid payments are completed.
+	StatusPaid Status = "paid"
+	// StatusFailed payments were declined by the provider.
+	StatusFailed Status = "failed"
+	// StatusExpired payments were not completed in time.
+	StatusExpired Status = "expired"
+)
+
+// Request is a payment to collect.
+type Request struct {
+	// Reference identifies the paid object (the booking), it is returned in the events.
+	Reference string
+	// Amount is in the minor unit of the currency (i.e. cents), and Currency is the lower
+	// case ISO 4217 code.
+	Amount      int64
+	Currency    string
+	Description string
+	// Email is the address of the payer, if known.
+	Email string
+	// ReturnURL is the page the payer is sent to after paying or giving up.
+	ReturnURL string
+}
+
+// Intent is a payment created in the provider.
+type Intent struct {
+	ID string
+	// URL is the page the payer pays at, empty if the payment is collected outside the
+	// provider.
+	URL string
+}
+
+// Event is a change of the status of a payment notified by the provider.
+type Event struct {
+	PaymentID string
+	Reference string
+	Status    Status
+}
+
+// Provider creates the payments and handles the notifications of their status.
+type Provider interface {
+	// Name identifies the provider in the stored payments.
+	Name() string
+	// Create creates a pending payment.
+	Create(ctx context.Context, req *Request) (*Intent, error)
+	// Webhook verifies and parses a webhook notification of the provider. It returns
+	// ErrIgnoredEvent if the notification does not change the status of a payment.
+	Webhook(payload []byte, header http.Header) (*Event, error)
+}
+
+// Manual is the Provider of the payments collected outside the platform (i.e. in cash or by
+// bank transfer), marked as paid by the tool owner.
+type Manual struct{}
+
+// Name returns "manual".
+func (Manual) Name() string {
+	return "manual"
+}
+
+// Create returns a payment without payment page, identified by the reference.
+func (Manual) Create(_ context.Context, req *Request) (*Intent, error) {
+	return &Intent{ID: "manual-" + req.Reference}, nil
+}
+
+// Webhook always fails, the manual payments have no notifications.
+func (Manual) Webhook([]byte, http.Header) (*Event, error) {
+	return nil, fmt.Errorf("manual payments have no webhook: %w", ErrInvalidSignature)
+}
@@ -0,0 +1,175 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultStripeURL is the Stripe API.
+	defaultStripeURL = "https://api.stripe.com"
+	// stripeTimeout is the maximum duration of a request when no client is set.
+	stripeTimeout = 10 * time.Second
+	// stripeSignatureTolerance is the maximum age of a webhook notification, older ones are
+	// rejected to prevent replays.
+	stripeSignatureTolerance = 5 * time.Minute
+	// StripeSignatureHeader is the header of the webhook requests with their signature.
+	StripeSignatureHeader = "Stripe-Signature"
+)
+
+// Stripe is the Provider of the payments through a Stripe Checkout page. The webhook endpoint
+// must be registered in Stripe with the checkout.session events.
+type Stripe struct {
+	// SecretKey is the API key of the Stripe account, and WebhookSecret the signing secret of
+	// its webhook endpoint.
+	SecretKey     string
+	WebhookSecret string
+	// URL is the Stripe API, the default if empty.
+	URL    string
+	Client *http.Client
+}
+
+// stripeSession is a Stripe Checkout Session, as returned by the API and in the webhook events.
+type stripeSession struct {
+	ID                string `json:"id"`
+	URL               string `json:"url"`
+	ClientReferenceID string `json:"client_reference_id"`
+	PaymentStatus     string `json:"payment_status"`
+}
+
+// stripeEvent is a Stripe webhook event about a Checkout Session.
+type stripeEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		Object stripeSession `json:"object"`
+	} `json:"data"`
+}
+
+// Name returns "stripe".
+func (*Stripe) Name() string {
+	return "stripe"
+}
+
+// Create creates a Checkout Session for the payment, whose URL is the page the payer pays at.
+func (s *Stripe) Create(ctx context.Context, req *Request) (*Intent, error) {
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("client_reference_id", req.Reference)
+	form.Set("success_url", req.ReturnURL)
+	form.Set("cancel_url", req.ReturnURL)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", req.Currency)
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(req.Amount, 10))
+	form.Set("line_items[0][price_data][product_data][name]", req.Description)
+	if req.Email != "" {
+		form.Set("customer_email", req.Email)
+	}
+	base := s.URL
+	if base == "" {
+		base = defaultStripeURL
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(base, "/")+"/v1/checkout/sessions",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+s.SecretKey)
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: stripeTimeout}
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("stripe returned status %d: %s", resp.StatusCode, body)
+	}
+	var session stripeSession
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, fmt.Errorf("could not decode stripe response: %w", err)
+	}
+	return &Intent{ID: session.ID, URL: session.URL}, nil
+}
+
+// Webhook verifies the signature of a Stripe webhook event and returns the new status of its
+// Checkout Session.
+func (s *Stripe) Webhook(payload []byte, header http.Header) (*Event, error) {
+	if err := s.verifySignature(payload, header.Get(StripeSignatureHeader), time.Now()); err != nil {
+		return nil, err
+	}
+	var event stripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("could not decode stripe event: %w", err)
+	}
+	var status Status
+	switch event.Type {
+	case "checkout.session.completed":
+		// The delayed payment methods complete the session before the payment succeeds
+		if event.Data.Object.PaymentStatus == "unpaid" {
+			return nil, ErrIgnoredEvent
+		}
+		status = StatusPaid
+	case "checkout.session.async_payment_succeeded":
+		status = StatusPaid
+	case "checkout.session.async_payment_failed":
+		status = StatusFailed
+	case "checkout.session.expired":
+		status = StatusExpired
+	default:
+		return nil, ErrIgnoredEvent
+	}
+	return &Event{
+		PaymentID: event.Data.Object.ID,
+		Reference: event.Data.Object.ClientReferenceID,
+		Status:    status,
+	}, nil
+}
+
+// verifySignature checks the Stripe-Signature header of the payload, with the t=timestamp and
+// v1=signature fields, the signature being the HMAC-SHA256 of "timestamp.payload".
+func (s *Stripe) verifySignature(payload []byte, signature string, now time.Time) error {
+	var timestamp string
+	var signatures [][]byte
+	for _, field := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return fmt.Errorf("webhook event too old: %w", ErrInvalidSignature)
+	}
+	mac := hmac.New(sha256.New, []byte(s.WebhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
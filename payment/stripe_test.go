@@ -0,0 +1,104 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestStripeCreate(t *testing.T) {
+	c := qt.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, qt.Equals, "/v1/checkout/sessions")
+		c.Check(r.Header.Get("Authorization"), qt.Equals, "Bearer sk_test")
+		c.Check(r.FormValue("mode"), qt.Equals, "payment")
+		c.Check(r.FormValue("client_reference_id"), qt.Equals, "booking1")
+		c.Check(r.FormValue("line_items[0][price_data][currency]"), qt.Equals, "eur")
+		c.Check(r.FormValue("line_items[0][price_data][unit_amount]"), qt.Equals, "1500")
+		c.Check(r.FormValue("customer_email"), qt.Equals, "renter@example.com")
+		_, _ = w.Write([]byte(`{"id":"cs_test_1","url":"https://checkout.stripe.com/c/pay/cs_test_1"}`))
+	}))
+	defer srv.Close()
+
+	stripe := &Stripe{SecretKey: "sk_test", URL: srv.URL}
+	intent, err := stripe.Create(context.Background(), &Request{
+		Reference:   "booking1",
+		Amount:      1500,
+		Currency:    "eur",
+		Description: "Booking of Drill",
+		Email:       "renter@example.com",
+		ReturnURL:   "https://app.example.com/bookings/booking1",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(intent.ID, qt.Equals, "cs_test_1")
+	c.Assert(intent.URL, qt.Equals, "https://checkout.stripe.com/c/pay/cs_test_1")
+
+	stripe.SecretKey = "wrong"
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer failing.Close()
+	stripe.URL = failing.URL
+	_, err = stripe.Create(context.Background(), &Request{Reference: "booking1"})
+	c.Assert(err, qt.ErrorMatches, "stripe returned status 401.*")
+}
+
+func TestStripeWebhook(t *testing.T) {
+	c := qt.New(t)
+
+	stripe := &Stripe{WebhookSecret: "whsec_test"}
+	sign := func(payload string, at time.Time) http.Header {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte("whsec_test"))
+		mac.Write([]byte(timestamp + "." + payload))
+		header := http.Header{}
+		header.Set(StripeSignatureHeader, fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil))))
+		return header
+	}
+	event := func(eventType, paymentStatus string) string {
+		return fmt.Sprintf(`{"type":%q,"data":{"object":{"id":"cs_test_1","client_reference_id":"booking1",`+
+			`"payment_status":%q}}}`, eventType, paymentStatus)
+	}
+
+	payload := event("checkout.session.completed", "paid")
+	got, err := stripe.Webhook([]byte(payload), sign(payload, time.Now()))
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.DeepEquals, &Event{PaymentID: "cs_test_1", Reference: "booking1", Status: StatusPaid})
+
+	payload = event("checkout.session.expired", "unpaid")
+	got, err = stripe.Webhook([]byte(payload), sign(payload, time.Now()))
+	c.Assert(err, qt.IsNil)
+	c.Assert(got.Status, qt.Equals, StatusExpired)
+
+	// The delayed payments are notified when they succeed or fail
+	payload = event("checkout.session.completed", "unpaid")
+	_, err = stripe.Webhook([]byte(payload), sign(payload, time.Now()))
+	c.Assert(err, qt.Equals, ErrIgnoredEvent)
+	payload = event("checkout.session.async_payment_failed", "unpaid")
+	got, err = stripe.Webhook([]byte(payload), sign(payload, time.Now()))
+	c.Assert(err, qt.IsNil)
+	c.Assert(got.Status, qt.Equals, StatusFailed)
+
+	payload = event("customer.created", "")
+	_, err = stripe.Webhook([]byte(payload), sign(payload, time.Now()))
+	c.Assert(err, qt.Equals, ErrIgnoredEvent)
+
+	// Tampered, replayed and unsigned events are rejected
+	payload = event("checkout.session.completed", "paid")
+	_, err = stripe.Webhook([]byte(event("checkout.session.completed", "no_payment_required")), sign(payload, time.Now()))
+	c.Assert(err, qt.ErrorIs, ErrInvalidSignature)
+	_, err = stripe.Webhook([]byte(payload), sign(payload, time.Now().Add(-time.Hour)))
+	c.Assert(err, qt.ErrorIs, ErrInvalidSignature)
+	_, err = stripe.Webhook([]byte(payload), http.Header{})
+	c.Assert(err, qt.ErrorIs, ErrInvalidSignature)
+}
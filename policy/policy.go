@@ -0,0 +1,241 @@
+// Package policy centralizes the access rules of the platform. Every action on a resource
+// is declared with the relation the user must have with the resource, so handlers only need
+// to describe who is acting and on what. Unknown actions are always denied.
+package policy
+
+import (
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Action identifies an operation performed on a resource.
+type Action string
+
+const (
+	ToolView          Action = "tool:view"
+	ToolEdit          Action = "tool:edit"
+	ToolDelete        Action = "tool:delete"
+	ToolReport        Action = "tool:report"
+	ToolBook          Action = "tool:book"
+	ToolManagers      Action = "tool:managers"
+	ToolTransfer      Action = "tool:transfer"
+	BookingRead       Action = "booking:read"
+	BookingAccept     Action = "booking:accept"
+	BookingDeny       Action = "booking:deny"
+	BookingCancel     Action = "booking:cancel"
+	BookingReturn     Action = "booking:return"
+	BookingRate       Action = "booking:rate"
+	BookingDisagree   Action = "booking:disagree"
+	BookingPay        Action = "booking:pay"
+	BookingMarkPaid   Action = "booking:mark-paid"
+	UserBookings      Action = "user:bookings"
+	AdminAccess       Action = "admin:access"
+	CommunityContent  Action = "community:content"
+	CommunityModerate Action = "community:moderate"
+	RecoveryApprove   Action = "recovery:approve"
+)
+
+// Relation is the relationship the subject must have with the resource.
+type Relation int
+
+const (
+	// Anyone allows any (not blocked) user.
+	Anyone Relation = iota
+	// Owner requires the subject to own the resource (the tool owner on bookings). Resources
+	// owned by a community are owned by the admins of that community.
+	Owner
+	// Requester requires the subject to be the booking requester.
+	Requester
+	// Party requires the subject to be either the owner or the requester.
+	Party
+	// NotOwner requires the subject not to own the resource.
+	NotOwner
+	// Member requires the subject to belong to the resource community.
+	Member
+	// Admin requires the subject to have the admin role.
+	Admin
+	// CommunityAdmin requires the subject to be an admin of the resource community (or an
+	// admin without community) other than the resource owner.
+	CommunityAdmin
+	// Audience requires, on restricted resources, the subject to own the resource or to belong
+	// to one of the resource audience communities. The admins without community are always
+	// in the audience.
+	Audience
+)
+
+// Reason explains why an action was denied.
+type Reason string
+
+const (
+	ReasonUnknownAction  Reason = "unknown action"
+	ReasonBlocked        Reason = "user is blocked"
+	ReasonInactive       Reason = "user is inactive"
+	ReasonOwnerInactive  Reason = "resource owner is inactive"
+	ReasonNotOwner       Reason = "user is not the owner"
+	ReasonNotRequester   Reason = "user is not the requester"
+	ReasonNotParty       Reason = "user is not involved"
+	ReasonOwnResource    Reason = "user owns the resource"
+	ReasonNotMember      Reason = "user is not a community member"
+	ReasonNotAdmin       Reason = "user is not an admin"
+	ReasonOtherCommunity Reason = "user is an admin of another community"
+	ReasonSelfApproval   Reason = "user cannot approve its own request"
+	ReasonNotAudience    Reason = "resource is not visible to the user"
+)
+
+// Rule declares the requirements of an action.
+type Rule struct {
+	Relation Relation
+	// Active requires the subject to be active.
+	Active bool
+	// ActiveOwner requires the resource owner to be active.
+	ActiveOwner bool
+	// AdminOverride allows admins regardless of the relation.
+	AdminOverride bool
+	// ManagerOverride allows the managers of the resource regardless of the relation.
+	ManagerOverride bool
+}
+
+// rules is the declarative table of the access rules for each action.
+var rules = map[Action]Rule{
+	ToolView:          {Relation: Audience, ManagerOverride: true},
+	ToolEdit:          {Relation: Owner, ManagerOverride: true},
+	ToolDelete:        {Relation: Owner},
+	ToolReport:        {Relation: Owner},
+	ToolBook:          {Relation: NotOwner, Active: true, ActiveOwner: true},
+	ToolManagers:      {Relation: Owner},
+	ToolTransfer:      {Relation: Owner},
+	BookingRead:       {Relation: Party, AdminOverride: true, ManagerOverride: true},
+	BookingAccept:     {Relation: Owner, ManagerOverride: true},
+	BookingDeny:       {Relation: Owner, ManagerOverride: true},
+	BookingCancel:     {Relation: Requester},
+	BookingReturn:     {Relation: Owner},
+	BookingRate:       {Relation: Party},
+	BookingDisagree:   {Relation: Party},
+	BookingPay:        {Relation: Requester},
+	BookingMarkPaid:   {Relation: Owner, ManagerOverride: true},
+	UserBookings:      {Relation: Owner, AdminOverride: true},
+	AdminAccess:       {Relation: Admin},
+	CommunityContent:  {Relation: Member, Active: true},
+	CommunityModerate: {Relation: CommunityAdmin, Active: true},
+	RecoveryApprove:   {Relation: CommunityAdmin, Active: true},
+}
+
+// Subject is the user performing an action.
+type Subject struct {
+	ID        primitive.ObjectID
+	Active    bool
+	Blocked   bool
+	Admin     bool
+	Community string
+}
+
+// Resource is the object an action is performed on. Only the fields relevant to the
+// action need to be set.
+type Resource struct {
+	OwnerID       primitive.ObjectID
+	RequesterID   primitive.ObjectID
+	OwnerInactive bool
+	Community     string
+	// OwnerCommunity is the community owning the resource (i.e. a shared community tool).
+	// If set, the admins of the community act as the owner instead of OwnerID.
+	OwnerCommunity string
+	// Managers are the users the owner granted the management of the resource (the tool
+	// on bookings).
+	Managers []primitive.ObjectID
+	// Restricted resources are only visible to their owner and to the members of the
+	// Audience communities.
+	Restricted bool
+	Audience   []string
+}
+
+// Denial is the error returned when an action is not allowed.
+type Denial struct {
+	Action Action
+	Reason Reason
+}
+
+// Error implements the error interface.
+func (d *Denial) Error() string {
+	return fmt.Sprintf("%s denied: %s", d.Action, d.Reason)
+}
+
+// Check returns nil if the subject can perform the action on the resource,
+// or a *Denial explaining why it cannot.
+func Check(action Action, subject Subject, resource Resource) error {
+	rule, ok := rules[action]
+	if !ok {
+		return &Denial{Action: action, Reason: ReasonUnknownAction}
+	}
+	if subject.Blocked {
+		return &Denial{Action: action, Reason: ReasonBlocked}
+	}
+	if rule.Active && !subject.Active {
+		return &Denial{Action: action, Reason: ReasonInactive}
+	}
+	if reason, ok := checkRelation(rule.Relation, subject, resource); !ok && !(rule.AdminOverride && subject.Admin) &&
+		!(rule.ManagerOverride && isManager(subject, resource)) {
+		return &Denial{Action: action, Reason: reason}
+	}
+	if rule.ActiveOwner && resource.OwnerInactive {
+		return &Denial{Action: action, Reason: ReasonOwnerInactive}
+	}
+	return nil
+}
+
+// checkRelation checks the relation between the subject and the resource.
+func checkRelation(relation Relation, subject Subject, resource Resource) (Reason, bool) {
+	switch relation {
+	case Anyone:
+		return "", true
+	case Owner:
+		return ReasonNotOwner, isOwner(subject, resource)
+	case Requester:
+		return ReasonNotRequester, isSet(resource.RequesterID) && subject.ID == resource.RequesterID
+	case Party:
+		return ReasonNotParty, isOwner(subject, resource) ||
+			(isSet(resource.RequesterID) && subject.ID == resource.RequesterID)
+	case NotOwner:
+		return ReasonOwnResource, subject.ID != resource.OwnerID && !isOwner(subject, resource)
+	case Member:
+		return ReasonNotMember, resource.Community != "" && subject.Community == resource.Community
+	case Admin:
+		return ReasonNotAdmin, subject.Admin
+	case CommunityAdmin:
+		if !subject.Admin {
+			return ReasonNotAdmin, false
+		}
+		if subject.ID == resource.OwnerID {
+			return ReasonSelfApproval, false
+		}
+		return ReasonOtherCommunity, subject.Community == "" || subject.Community == resource.Community
+	case Audience:
+		return ReasonNotAudience, !resource.Restricted || isOwner(subject, resource) ||
+			(isSet(resource.OwnerID) && subject.ID == resource.OwnerID) ||
+			(subject.Admin && subject.Community == "") ||
+			(subject.Community != "" && slices.Contains(resource.Audience, subject.Community))
+	default:
+		return ReasonUnknownAction, false
+	}
+}
+
+// isOwner returns true if the subject owns the resource, either directly or as an admin of
+// the community owning it.
+func isOwner(subject Subject, resource Resource) bool {
+	if resource.OwnerCommunity != "" {
+		return subject.Admin && subject.Community == resource.OwnerCommunity
+	}
+	return isSet(resource.OwnerID) && subject.ID == resource.OwnerID
+}
+
+// isManager returns true if the subject is one of the managers of the resource.
+func isManager(subject Subject, resource Resource) bool {
+	return isSet(subject.ID) && slices.Contains(resource.Managers, subject.ID)
+}
+
+// isSet returns true if the ID is not the nil ObjectID, so a zero subject never matches
+// a zero resource.
+func isSet(id primitive.ObjectID) bool {
+	return id != primitive.NilObjectID
+}
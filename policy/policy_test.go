@@ -0,0 +1,176 @@
+package policy
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCheck(t *testing.T) {
+	c := qt.New(t)
+
+	owner := Subject{ID: primitive.NewObjectID(), Active: true, Community: "valley"}
+	requester := Subject{ID: primitive.NewObjectID(), Active: true, Community: "valley"}
+	stranger := Subject{ID: primitive.NewObjectID(), Active: true, Community: "coast"}
+	admin := Subject{ID: primitive.NewObjectID(), Active: true, Admin: true}
+	tool := Resource{OwnerID: owner.ID, Community: "valley"}
+	booking := Resource{OwnerID: owner.ID, RequesterID: requester.ID}
+
+	reason := func(err error) Reason {
+		denial, ok := err.(*Denial)
+		c.Assert(ok, qt.IsTrue, qt.Commentf("expected a denial, got %v", err))
+		return denial.Reason
+	}
+
+	c.Run("Tool Owner", func(c *qt.C) {
+		c.Assert(Check(ToolEdit, owner, tool), qt.IsNil)
+		c.Assert(Check(ToolDelete, owner, tool), qt.IsNil)
+		c.Assert(reason(Check(ToolEdit, stranger, tool)), qt.Equals, ReasonNotOwner)
+		// Admins do not override ownership of tools
+		c.Assert(reason(Check(ToolDelete, admin, tool)), qt.Equals, ReasonNotOwner)
+	})
+
+	c.Run("Tool Booking", func(c *qt.C) {
+		c.Assert(Check(ToolBook, requester, tool), qt.IsNil)
+		c.Assert(reason(Check(ToolBook, owner, tool)), qt.Equals, ReasonOwnResource)
+
+		inactive := requester
+		inactive.Active = false
+		c.Assert(reason(Check(ToolBook, inactive, tool)), qt.Equals, ReasonInactive)
+
+		inactiveOwner := tool
+		inactiveOwner.OwnerInactive = true
+		c.Assert(reason(Check(ToolBook, requester, inactiveOwner)), qt.Equals, ReasonOwnerInactive)
+	})
+
+	c.Run("Tool Visibility", func(c *qt.C) {
+		c.Assert(Check(ToolView, stranger, tool), qt.IsNil)
+
+		restricted := tool
+		restricted.Restricted, restricted.Audience = true, []string{"valley"}
+		c.Assert(Check(ToolView, owner, restricted), qt.IsNil)
+		c.Assert(Check(ToolView, requester, restricted), qt.IsNil)
+		c.Assert(Check(ToolView, admin, restricted), qt.IsNil)
+		c.Assert(reason(Check(ToolView, stranger, restricted)), qt.Equals, ReasonNotAudience)
+
+		// The admins of other communities are not in the audience
+		coastAdmin := stranger
+		coastAdmin.Admin = true
+		c.Assert(reason(Check(ToolView, coastAdmin, restricted)), qt.Equals, ReasonNotAudience)
+
+		managed := restricted
+		managed.Managers = []primitive.ObjectID{stranger.ID}
+		c.Assert(Check(ToolView, stranger, managed), qt.IsNil)
+	})
+
+	c.Run("Booking Parties", func(c *qt.C) {
+		c.Assert(Check(BookingAccept, owner, booking), qt.IsNil)
+		c.Assert(reason(Check(BookingAccept, requester, booking)), qt.Equals, ReasonNotOwner)
+		c.Assert(Check(BookingCancel, requester, booking), qt.IsNil)
+		c.Assert(reason(Check(BookingCancel, owner, booking)), qt.Equals, ReasonNotRequester)
+		c.Assert(Check(BookingRate, owner, booking), qt.IsNil)
+		c.Assert(Check(BookingRate, requester, booking), qt.IsNil)
+		c.Assert(reason(Check(BookingRate, stranger, booking)), qt.Equals, ReasonNotParty)
+		c.Assert(Check(BookingPay, requester, booking), qt.IsNil)
+		c.Assert(Check(BookingMarkPaid, owner, booking), qt.IsNil)
+		c.Assert(reason(Check(BookingMarkPaid, requester, booking)), qt.Equals, ReasonNotOwner)
+
+		// Admins can read any booking (i.e. to mediate disputes) but not act on it
+		c.Assert(Check(BookingRead, admin, booking), qt.IsNil)
+		c.Assert(reason(Check(BookingRead, stranger, booking)), qt.Equals, ReasonNotParty)
+		c.Assert(reason(Check(BookingReturn, admin, booking)), qt.Equals, ReasonNotOwner)
+	})
+
+	c.Run("Tool Managers", func(c *qt.C) {
+		managed := Resource{OwnerID: owner.ID, Managers: []primitive.ObjectID{stranger.ID}}
+		c.Assert(Check(ToolEdit, stranger, managed), qt.IsNil)
+		c.Assert(reason(Check(ToolDelete, stranger, managed)), qt.Equals, ReasonNotOwner)
+		c.Assert(reason(Check(ToolManagers, stranger, managed)), qt.Equals, ReasonNotOwner)
+		c.Assert(Check(ToolManagers, owner, managed), qt.IsNil)
+		c.Assert(reason(Check(ToolTransfer, stranger, managed)), qt.Equals, ReasonNotOwner)
+
+		managedBooking := booking
+		managedBooking.Managers = managed.Managers
+		c.Assert(Check(BookingRead, stranger, managedBooking), qt.IsNil)
+		c.Assert(Check(BookingAccept, stranger, managedBooking), qt.IsNil)
+		c.Assert(Check(BookingDeny, stranger, managedBooking), qt.IsNil)
+		c.Assert(reason(Check(BookingReturn, stranger, managedBooking)), qt.Equals, ReasonNotOwner)
+		c.Assert(reason(Check(BookingRate, stranger, managedBooking)), qt.Equals, ReasonNotParty)
+	})
+
+	c.Run("Community Members", func(c *qt.C) {
+		c.Assert(Check(CommunityContent, requester, tool), qt.IsNil)
+		c.Assert(reason(Check(CommunityContent, stranger, tool)), qt.Equals, ReasonNotMember)
+		// Resources without community are not accessible as community content
+		c.Assert(reason(Check(CommunityContent, stranger, Resource{})), qt.Equals, ReasonNotMember)
+	})
+
+	c.Run("Admin", func(c *qt.C) {
+		c.Assert(Check(AdminAccess, admin, Resource{}), qt.IsNil)
+		c.Assert(reason(Check(AdminAccess, owner, Resource{})), qt.Equals, ReasonNotAdmin)
+	})
+
+	c.Run("User Bookings", func(c *qt.C) {
+		bookings := Resource{OwnerID: requester.ID}
+		c.Assert(Check(UserBookings, requester, bookings), qt.IsNil)
+		c.Assert(Check(UserBookings, admin, bookings), qt.IsNil)
+		c.Assert(reason(Check(UserBookings, owner, bookings)), qt.Equals, ReasonNotOwner)
+	})
+
+	c.Run("Community Admin", func(c *qt.C) {
+		valleyAdmin := Subject{ID: primitive.NewObjectID(), Active: true, Admin: true, Community: "valley"}
+		recovery := Resource{OwnerID: requester.ID, Community: "valley"}
+		c.Assert(Check(RecoveryApprove, valleyAdmin, recovery), qt.IsNil)
+		// Admins without community can approve requests of any community
+		c.Assert(Check(RecoveryApprove, admin, recovery), qt.IsNil)
+		c.Assert(reason(Check(RecoveryApprove, requester, recovery)), qt.Equals, ReasonNotAdmin)
+
+		coastAdmin := valleyAdmin
+		coastAdmin.Community = "coast"
+		c.Assert(reason(Check(RecoveryApprove, coastAdmin, recovery)), qt.Equals, ReasonOtherCommunity)
+		c.Assert(Check(CommunityModerate, valleyAdmin, Resource{Community: "valley"}), qt.IsNil)
+		c.Assert(reason(Check(CommunityModerate, coastAdmin, Resource{Community: "valley"})), qt.Equals, ReasonOtherCommunity)
+		c.Assert(reason(Check(RecoveryApprove, valleyAdmin, Resource{OwnerID: valleyAdmin.ID, Community: "valley"})),
+			qt.Equals, ReasonSelfApproval)
+	})
+
+	c.Run("Community Owned", func(c *qt.C) {
+		valleyAdmin := Subject{ID: primitive.NewObjectID(), Active: true, Admin: true, Community: "valley"}
+		coastAdmin := valleyAdmin
+		coastAdmin.Community = "coast"
+		shared := Resource{OwnerID: owner.ID, OwnerCommunity: "valley"}
+		c.Assert(Check(ToolEdit, valleyAdmin, shared), qt.IsNil)
+		c.Assert(reason(Check(ToolEdit, coastAdmin, shared)), qt.Equals, ReasonNotOwner)
+		// The user who registered the tool does not own it
+		c.Assert(reason(Check(ToolEdit, owner, shared)), qt.Equals, ReasonNotOwner)
+		c.Assert(reason(Check(ToolBook, valleyAdmin, shared)), qt.Equals, ReasonOwnResource)
+		c.Assert(Check(ToolBook, requester, shared), qt.IsNil)
+
+		sharedBooking := Resource{OwnerID: owner.ID, RequesterID: requester.ID, OwnerCommunity: "valley"}
+		c.Assert(Check(BookingAccept, valleyAdmin, sharedBooking), qt.IsNil)
+		c.Assert(Check(BookingRate, valleyAdmin, sharedBooking), qt.IsNil)
+		c.Assert(Check(BookingRate, requester, sharedBooking), qt.IsNil)
+		c.Assert(reason(Check(BookingAccept, coastAdmin, sharedBooking)), qt.Equals, ReasonNotOwner)
+		// Admins without community do not own community tools
+		c.Assert(reason(Check(BookingAccept, admin, sharedBooking)), qt.Equals, ReasonNotOwner)
+	})
+
+	c.Run("Blocked Users", func(c *qt.C) {
+		blocked := owner
+		blocked.Blocked = true
+		c.Assert(reason(Check(ToolEdit, blocked, tool)), qt.Equals, ReasonBlocked)
+		blockedAdmin := admin
+		blockedAdmin.Blocked = true
+		c.Assert(reason(Check(AdminAccess, blockedAdmin, Resource{})), qt.Equals, ReasonBlocked)
+	})
+
+	c.Run("Zero Values Never Match", func(c *qt.C) {
+		c.Assert(reason(Check(ToolEdit, Subject{}, Resource{})), qt.Equals, ReasonNotOwner)
+		c.Assert(reason(Check(BookingRate, Subject{}, Resource{})), qt.Equals, ReasonNotParty)
+	})
+
+	c.Run("Unknown Action", func(c *qt.C) {
+		c.Assert(reason(Check(Action("tool:unknown"), admin, tool)), qt.Equals, ReasonUnknownAction)
+	})
+}
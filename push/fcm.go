@@ -0,0 +1,213 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	// fcmScope is the OAuth2 scope required to send messages.
+	fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+	// defaultFCMURL is the Firebase Cloud Messaging HTTP v1 API.
+	defaultFCMURL = "https://fcm.googleapis.com"
+	// defaultTokenURL is the Google OAuth2 token endpoint.
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+	// requestTimeout is the maximum duration of a request when no client is set.
+	requestTimeout = 10 * time.Second
+)
+
+// FCM sends notifications through the Firebase Cloud Messaging HTTP v1 API, authenticated
+// with a Google service account.
+type FCM struct {
+	ProjectID   string
+	ClientEmail string
+	PrivateKey  *rsa.PrivateKey
+	// TokenURL and URL default to the Google endpoints.
+	TokenURL string
+	URL      string
+	Client   *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expires     time.Time
+}
+
+// serviceAccount is the subset of a Google service account JSON key used by FCM.
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// NewFCM creates an FCM sender from a Google service account JSON key.
+func NewFCM(serviceAccountJSON []byte) (*FCM, error) {
+	var sa serviceAccount
+	if err := json.Unmarshal(serviceAccountJSON, &sa); err != nil {
+		return nil, fmt.Errorf("invalid service account: %w", err)
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" {
+		return nil, fmt.Errorf("service account without project_id or client_email")
+	}
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("service account without a PEM private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service account private key is not an RSA key")
+	}
+	return &FCM{
+		ProjectID:   sa.ProjectID,
+		ClientEmail: sa.ClientEmail,
+		PrivateKey:  rsaKey,
+		TokenURL:    sa.TokenURI,
+	}, nil
+}
+
+// fcmRequest is the body of the messages:send request.
+type fcmRequest struct {
+	Message fcmMessage `json:"message"`
+}
+
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// Send sends the message to the FCM registration token of the target.
+func (f *FCM) Send(ctx context.Context, target *Target, msg *Message) error {
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get fcm access token: %w", err)
+	}
+	body, err := json.Marshal(&fcmRequest{Message: fcmMessage{
+		Token:        target.Token,
+		Notification: fcmNotification{Title: msg.Title, Body: msg.Body},
+		Data:         msg.Data,
+	}})
+	if err != nil {
+		return err
+	}
+	base := f.URL
+	if base == "" {
+		base = defaultFCMURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/v1/projects/%s/messages:send", strings.TrimSuffix(base, "/"), f.ProjectID),
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client(f.Client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusNotFound || bytes.Contains(respBody, []byte("UNREGISTERED")) {
+		return ErrInvalidToken
+	}
+	return fmt.Errorf("fcm returned status %d: %s", resp.StatusCode, respBody)
+}
+
+// token returns a valid OAuth2 access token, requesting a new one with a signed service
+// account assertion when the cached one is about to expire.
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	if f.accessToken != "" && now.Add(time.Minute).Before(f.expires) {
+		return f.accessToken, nil
+	}
+	tokenURL := f.TokenURL
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL
+	}
+	assertion, err := jwt.NewBuilder().
+		Issuer(f.ClientEmail).
+		Audience([]string{tokenURL}).
+		IssuedAt(now).
+		Expiration(now.Add(time.Hour)).
+		Claim("scope", fcmScope).
+		Build()
+	if err != nil {
+		return "", err
+	}
+	signed, err := jwt.Sign(assertion, jwt.WithKey(jwa.RS256, f.PrivateKey))
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", string(signed))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client(f.Client).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint returned no access token")
+	}
+	f.accessToken = token.AccessToken
+	f.expires = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	return f.accessToken, nil
+}
+
+// client returns the client, or a client with the default timeout if nil.
+func client(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return &http.Client{Timeout: requestTimeout}
+}
+
+// closeBody drains and closes the response body so the connection can be reused.
+func closeBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,75 @@
+// Package push sends push notifications to the devices of the users, through Firebase Cloud
+// Messaging (mobile apps) or the Web Push protocol (browsers).
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidToken is returned when the push service no longer accepts the device token or
+// subscription, so the device should be forgotten.
+var ErrInvalidToken = errors.New("invalid device token")
+
+// Platform is the push service a device is registered with.
+type Platform string
+
+const (
+	// PlatformFCM devices are registered with a Firebase Cloud Messaging token.
+	PlatformFCM Platform = "fcm"
+	// PlatformWebPush devices are registered with a Web Push subscription endpoint.
+	PlatformWebPush Platform = "webpush"
+)
+
+// IsValidPlatform returns true if the platform is supported.
+func IsValidPlatform(p Platform) bool {
+	return p == PlatformFCM || p == PlatformWebPush
+}
+
+// Target is a device a notification is sent to. Token is the FCM registration token or the
+// Web Push subscription endpoint. P256dh and Auth are the base64url encoded keys of a Web Push
+// subscription, used to encrypt the payload.
+type Target struct {
+	Platform Platform
+	Token    string
+	P256dh   string
+	Auth     string
+}
+
+// Message is a push notification.
+type Message struct {
+	Title string
+	Body  string
+	// Data are additional key-value pairs delivered to the app (e.g. the notification type).
+	Data map[string]string
+}
+
+// Sender sends push notifications.
+type Sender interface {
+	Send(ctx context.Context, target *Target, msg *Message) error
+}
+
+// Router is a Sender dispatching each message to the Sender of the target platform.
+type Router map[Platform]Sender
+
+// Send sends the message with the Sender of the target platform.
+func (r Router) Send(ctx context.Context, target *Target, msg *Message) error {
+	sender, ok := r[target.Platform]
+	if !ok {
+		return fmt.Errorf("push platform %q not configured", target.Platform)
+	}
+	return sender.Send(ctx, target, msg)
+}
+
+// LogSender is the Sender used when no push service is configured. Messages are only logged.
+type LogSender struct{}
+
+// Send logs the message.
+func (LogSender) Send(_ context.Context, target *Target, msg *Message) error {
+	log.Info().Str("platform", string(target.Platform)).Str("title", msg.Title).
+		Msg("push service not configured, notification not sent")
+	return nil
+}
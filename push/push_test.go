@@ -0,0 +1,156 @@
+package push
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestFCM(t *testing.T) {
+	c := qt.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, qt.IsNil)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	c.Assert(err, qt.IsNil)
+
+	tokenRequests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenRequests++
+			c.Check(r.FormValue("grant_type"), qt.Equals, "urn:ietf:params:oauth:grant-type:jwt-bearer")
+			c.Check(r.FormValue("assertion"), qt.Not(qt.Equals), "")
+			_, _ = w.Write([]byte(`{"access_token":"access","expires_in":3600}`))
+		case "/v1/projects/emprius/messages:send":
+			c.Check(r.Header.Get("Authorization"), qt.Equals, "Bearer access")
+			var req fcmRequest
+			c.Check(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+			if req.Message.Token == "stale" {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+				return
+			}
+			c.Check(req.Message.Notification.Title, qt.Equals, "New booking")
+			c.Check(req.Message.Data["type"], qt.Equals, "BOOKING_REQUEST")
+			_, _ = w.Write([]byte(`{"name":"projects/emprius/messages/1"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	account, err := json.Marshal(&serviceAccount{
+		ProjectID:   "emprius",
+		ClientEmail: "push@emprius.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:    srv.URL + "/token",
+	})
+	c.Assert(err, qt.IsNil)
+	fcm, err := NewFCM(account)
+	c.Assert(err, qt.IsNil)
+	fcm.URL = srv.URL
+
+	msg := &Message{Title: "New booking", Body: "Someone wants your drill", Data: map[string]string{"type": "BOOKING_REQUEST"}}
+	c.Assert(fcm.Send(context.Background(), &Target{Platform: PlatformFCM, Token: "device"}, msg), qt.IsNil)
+	c.Assert(fcm.Send(context.Background(), &Target{Platform: PlatformFCM, Token: "stale"}, msg), qt.Equals, ErrInvalidToken)
+	// The access token is reused
+	c.Assert(tokenRequests, qt.Equals, 1)
+
+	_, err = NewFCM([]byte(`{"project_id":"emprius"}`))
+	c.Assert(err, qt.ErrorMatches, "service account without project_id or client_email")
+}
+
+func TestWebPush(t *testing.T) {
+	c := qt.New(t)
+
+	vapidKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	c.Assert(err, qt.IsNil)
+	wp, err := NewWebPush(base64.RawURLEncoding.EncodeToString(vapidKey.Bytes()), "mailto:admin@emprius.cat")
+	c.Assert(err, qt.IsNil)
+	c.Assert(wp.PublicKey(), qt.Equals, base64.RawURLEncoding.EncodeToString(vapidKey.PublicKey().Bytes()))
+
+	// The browser subscription keys
+	uaKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	c.Assert(err, qt.IsNil)
+	authSecret := make([]byte, 16)
+	_, err = rand.Read(authSecret)
+	c.Assert(err, qt.IsNil)
+
+	var received []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		c.Check(strings.HasPrefix(r.Header.Get("Authorization"), "vapid t="), qt.IsTrue)
+		c.Check(strings.HasSuffix(r.Header.Get("Authorization"), ", k="+wp.PublicKey()), qt.IsTrue)
+		c.Check(r.Header.Get("Content-Encoding"), qt.Equals, "aes128gcm")
+		c.Check(r.Header.Get("TTL"), qt.Not(qt.Equals), "")
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	target := &Target{
+		Platform: PlatformWebPush,
+		Token:    srv.URL + "/push/abc",
+		P256dh:   base64.RawURLEncoding.EncodeToString(uaKey.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(authSecret),
+	}
+	msg := &Message{Title: "Booking accepted", Body: "Your booking was accepted"}
+	c.Assert(wp.Send(context.Background(), target, msg), qt.IsNil)
+
+	// Decrypt the payload as the browser would
+	c.Assert(len(received) > 86, qt.IsTrue)
+	salt, recordSize, keyLen := received[:16], binary.BigEndian.Uint32(received[16:20]), int(received[20])
+	c.Assert(recordSize, qt.Equals, uint32(webPushRecordSize))
+	asPublicBytes := received[21 : 21+keyLen]
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	c.Assert(err, qt.IsNil)
+	secret, err := uaKey.ECDH(asPublic)
+	c.Assert(err, qt.IsNil)
+	cek, nonce := deriveContentKeys(secret, authSecret, salt, uaKey.PublicKey().Bytes(), asPublicBytes)
+	block, err := aes.NewCipher(cek)
+	c.Assert(err, qt.IsNil)
+	gcm, err := cipher.NewGCM(block)
+	c.Assert(err, qt.IsNil)
+	plaintext, err := gcm.Open(nil, nonce, received[21+keyLen:], nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(plaintext[len(plaintext)-1], qt.Equals, byte(0x02))
+	var payload webPushPayload
+	c.Assert(json.Unmarshal(plaintext[:len(plaintext)-1], &payload), qt.IsNil)
+	c.Assert(payload.Title, qt.Equals, "Booking accepted")
+
+	// Expired subscriptions are reported as invalid
+	target.Token = srv.URL + "/gone"
+	c.Assert(wp.Send(context.Background(), target, msg), qt.Equals, ErrInvalidToken)
+	target.Token = srv.URL + "/push/abc"
+	target.P256dh = "invalid"
+	c.Assert(wp.Send(context.Background(), target, msg), qt.ErrorIs, ErrInvalidToken)
+}
+
+func TestRouter(t *testing.T) {
+	c := qt.New(t)
+
+	router := Router{PlatformFCM: LogSender{}}
+	msg := &Message{Title: "title"}
+	c.Assert(router.Send(context.Background(), &Target{Platform: PlatformFCM, Token: "t"}, msg), qt.IsNil)
+	c.Assert(router.Send(context.Background(), &Target{Platform: PlatformWebPush, Token: "t"}, msg),
+		qt.ErrorMatches, `push platform "webpush" not configured`)
+}
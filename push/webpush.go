@@ -0,0 +1,207 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	// webPushTTL is the time the push service keeps the message if the browser is offline.
+	webPushTTL = 24 * time.Hour
+	// webPushRecordSize is the record size of the aes128gcm content encoding.
+	webPushRecordSize = 4096
+)
+
+// WebPush sends notifications with the Web Push protocol (RFC 8030), identified with VAPID
+// (RFC 8292) and with the payload encrypted for the subscription (RFC 8291).
+type WebPush struct {
+	// Subject is the contact of the application server, a mailto: or https: URL.
+	Subject string
+	Client  *http.Client
+
+	key       *ecdsa.PrivateKey
+	publicKey string
+}
+
+// NewWebPush creates a WebPush sender from the base64url encoded VAPID private key, as generated
+// by the usual web-push tools. The public key, derived from it, is the applicationServerKey the
+// browsers must subscribe with.
+func NewWebPush(vapidPrivateKey, subject string) (*WebPush, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(vapidPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vapid private key: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vapid private key: %w", err)
+	}
+	pub := key.PublicKey().Bytes()
+	ecdsaKey := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}
+	return &WebPush{
+		Subject:   subject,
+		key:       ecdsaKey,
+		publicKey: base64.RawURLEncoding.EncodeToString(pub),
+	}, nil
+}
+
+// PublicKey returns the base64url encoded VAPID public key.
+func (w *WebPush) PublicKey() string {
+	return w.publicKey
+}
+
+// webPushPayload is the JSON payload received by the service worker.
+type webPushPayload struct {
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// Send sends the message to the Web Push subscription of the target.
+func (w *WebPush) Send(ctx context.Context, target *Target, msg *Message) error {
+	endpoint, err := url.Parse(target.Token)
+	if err != nil || endpoint.Scheme != "https" && endpoint.Scheme != "http" {
+		return ErrInvalidToken
+	}
+	payload, err := json.Marshal(&webPushPayload{Title: msg.Title, Body: msg.Body, Data: msg.Data})
+	if err != nil {
+		return err
+	}
+	body, err := encryptPayload(payload, target.P256dh, target.Auth)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	now := time.Now()
+	vapid, err := jwt.NewBuilder().
+		Audience([]string{endpoint.Scheme + "://" + endpoint.Host}).
+		Subject(w.Subject).
+		Expiration(now.Add(12 * time.Hour)).
+		Build()
+	if err != nil {
+		return err
+	}
+	signed, err := jwt.Sign(vapid, jwt.WithKey(jwa.ES256, w.key))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", signed, w.publicKey))
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(webPushTTL.Seconds())))
+	resp, err := client(w.Client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrInvalidToken
+	default:
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("push service returned status %d: %s", resp.StatusCode, respBody)
+	}
+}
+
+// encryptPayload encrypts the payload for the subscription keys with the aes128gcm content
+// encoding, as a single record.
+func encryptPayload(payload []byte, p256dh, auth string) ([]byte, error) {
+	uaPublicBytes, err := base64.RawURLEncoding.DecodeString(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := base64.RawURLEncoding.DecodeString(auth)
+	if err != nil || len(authSecret) == 0 {
+		return nil, fmt.Errorf("invalid auth secret")
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	asPublicBytes := asPrivate.PublicKey().Bytes()
+	cek, nonce := deriveContentKeys(secret, authSecret, salt, uaPublicBytes, asPublicBytes)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// The 0x02 delimiter marks the last (and only) record, without padding
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	if len(plaintext)+gcm.Overhead() > webPushRecordSize {
+		return nil, fmt.Errorf("payload too large")
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asPublicBytes))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublicBytes)))
+	header = append(header, asPublicBytes...)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// deriveContentKeys derives the content encryption key and nonce from the ECDH shared secret,
+// as defined by RFC 8291.
+func deriveContentKeys(secret, authSecret, salt, uaPublic, asPublic []byte) (cek, nonce []byte) {
+	keyInfo := append(append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...), 0x01)
+	ikm := hmacSHA256(hmacSHA256(authSecret, secret), keyInfo)
+	prk := hmacSHA256(salt, ikm)
+	cek = hmacSHA256(prk, []byte("Content-Encoding: aes128gcm\x00\x01"))[:16]
+	nonce = hmacSHA256(prk, []byte("Content-Encoding: nonce\x00\x01"))[:12]
+	return cek, nonce
+}
+
+// hmacSHA256 returns the HMAC-SHA-256 of the data. Used as HKDF extract and, with the 0x01
+// counter appended to the info, as a single-block HKDF expand.
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
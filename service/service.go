@@ -17,11 +17,23 @@ type Service struct {
 	API           *api.API
 	jwtSecret     string
 	registerToken string
+	// Options are the optional API settings, they must be set before Service.Start().
+	Options api.Options
+	// Tenants are the tenants of a multi-tenant deployment, which serves each of them with its own
+	// database instead of a single instance. They must be set before Service.Start().
+	Tenants []*TenantConfig
 }
 
 // Start starts the API service.
 func (s *Service) Start(host string, port int) {
-	s.API = api.New(s.jwtSecret, s.registerToken, s.Database)
+	if len(s.Tenants) > 0 {
+		if err := s.startTenants(host, port); err != nil {
+			log.Fatal().Err(err).Msg("failed to start the tenants")
+		}
+		log.Info().Msgf("api service started at %s:%d with %d tenants", host, port, len(s.Tenants))
+		return
+	}
+	s.API = api.New(s.jwtSecret, s.registerToken, s.Database, &s.Options)
 	s.API.Start(host, port)
 	log.Info().Msgf("api service started at %s:%d", host, port)
 }
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/emprius/emprius-app-backend/api"
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/emprius/emprius-app-backend/payment"
+	"github.com/rs/zerolog/log"
+)
+
+// TenantConfig is the configuration of a tenant of a multi-tenant deployment. The tenant has its
+// own database, and the settings not given here are those of the deployment.
+type TenantConfig struct {
+	// ID identifies the tenant in its database name, tokens and /t/{id} path prefix.
+	ID string `json:"id"`
+	// Hosts are the hostnames the requests to the tenant are sent to.
+	Hosts             []string `json:"hosts"`
+	RegisterAuthToken string   `json:"registerAuthToken"`
+	// PublicURL is the base URL of the tenant in the links of the emails, i.e.
+	// https://tools.example.org or https://api.example.org/t/{id}.
+	PublicURL string         `json:"publicUrl,omitempty"`
+	Branding  *mail.Branding `json:"branding,omitempty"`
+	// SMTP is the server sending the emails of the tenant, with the host, port, username,
+	// password and from fields.
+	SMTP *mail.SMTPSender `json:"smtp,omitempty"`
+}
+
+// LoadTenants reads the JSON array of tenant configurations at path and validates it.
+func LoadTenants(path string) ([]*TenantConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []*TenantConfig
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("invalid tenants file: %w", err)
+	}
+	ids := make(map[string]bool, len(tenants))
+	for _, tenant := range tenants {
+		if !db.ValidTenantID(tenant.ID) {
+			return nil, fmt.Errorf("invalid tenant id %q, expected lower case letters, digits and dashes", tenant.ID)
+		}
+		if ids[tenant.ID] {
+			return nil, fmt.Errorf("duplicated tenant %q", tenant.ID)
+		}
+		ids[tenant.ID] = true
+		if tenant.RegisterAuthToken == "" {
+			return nil, fmt.Errorf("tenant %q has no register auth token", tenant.ID)
+		}
+		if tenant.Branding != nil {
+			if err := tenant.Branding.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid branding of tenant %q: %w", tenant.ID, err)
+			}
+		}
+	}
+	return tenants, nil
+}
+
+// startTenants creates the database and API of every tenant and starts serving them.
+func (s *Service) startTenants(host string, port int) error {
+	tenants := make([]*api.Tenant, 0, len(s.Tenants))
+	for _, config := range s.Tenants {
+		database, err := s.Database.Tenant(config.ID)
+		if err != nil {
+			return err
+		}
+		if err := database.CreateTables(); err != nil {
+			return fmt.Errorf("failed to create the tables of tenant %q: %w", config.ID, err)
+		}
+		opts := s.Options
+		opts.Tenant = config.ID
+		// The Telegram bot and the inbound mail webhook are registered once per deployment, they
+		// cannot tell the tenants apart
+		opts.Telegram = nil
+		opts.InboundAddress = ""
+		opts.InboundMailToken = ""
+		// The Stripe webhook endpoint is registered once per deployment too, with its own secret
+		if _, ok := opts.Payments.(*payment.Stripe); ok {
+			opts.Payments = nil
+		}
+		if config.PublicURL != "" {
+			opts.PublicURL = config.PublicURL
+		}
+		if config.Branding != nil {
+			opts.Branding = config.Branding
+		}
+		if config.SMTP != nil {
+			opts.Mailer = config.SMTP
+		}
+		tenants = append(tenants, &api.Tenant{
+			ID:    config.ID,
+			Hosts: config.Hosts,
+			API:   api.New(s.jwtSecret, config.RegisterAuthToken, database, &opts),
+		})
+		log.Info().Msgf("tenant %s served at %v and under %s", config.ID, config.Hosts, "/t/"+config.ID)
+	}
+	return api.StartTenants(host, port, tenants)
+}
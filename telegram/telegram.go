@@ -0,0 +1,140 @@
+// Package telegram delivers the notifications of the users that linked their Telegram account
+// through a Telegram bot, and handles the updates the bot receives.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/mail"
+)
+
+const (
+	// defaultAPIURL is the Telegram Bot API.
+	defaultAPIURL = "https://api.telegram.org"
+	// requestTimeout is the maximum duration of a request when no client is set.
+	requestTimeout = 10 * time.Second
+	// SecretHeader is the header of the webhook requests with the secret token of the bot.
+	SecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+)
+
+// Bot sends messages through the Telegram Bot API. It implements mail.Sender, the To field of
+// the messages is the chat ID of the recipient.
+type Bot struct {
+	Token string
+	// Username is the username of the bot, without the @, used in the deep links.
+	Username string
+	// URL defaults to the Telegram Bot API.
+	URL    string
+	Client *http.Client
+}
+
+// Update is the subset of a Telegram update used by the webhook.
+type Update struct {
+	UpdateID int64          `json:"update_id"`
+	Message  *UpdateMessage `json:"message,omitempty"`
+}
+
+// UpdateMessage is a message received by the bot.
+type UpdateMessage struct {
+	Text string `json:"text"`
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+}
+
+// StartToken returns the token of a /start command, sent by Telegram when the user opens a
+// deep link of the bot, and the chat ID the command comes from.
+func (u *Update) StartToken() (string, int64, bool) {
+	if u.Message == nil {
+		return "", 0, false
+	}
+	fields := strings.Fields(u.Message.Text)
+	if len(fields) != 2 || (fields[0] != "/start" && !strings.HasPrefix(fields[0], "/start@")) {
+		return "", 0, false
+	}
+	return fields[1], u.Message.Chat.ID, true
+}
+
+// DeepLink returns the link that opens the chat with the bot and sends it the token.
+func (b *Bot) DeepLink(token string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", b.Username, url.QueryEscape(token))
+}
+
+// WebhookSecret returns the secret token the bot sends in the SecretHeader of the webhook
+// requests, derived from the bot token so no additional setting is needed.
+func (b *Bot) WebhookSecret() string {
+	sum := sha256.Sum256([]byte("webhook:" + b.Token))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Send sends the subject and body of the message to the chat ID of its recipient.
+func (b *Bot) Send(ctx context.Context, msg *mail.Message) error {
+	text := msg.Body
+	if msg.Subject != "" {
+		text = msg.Subject + "\n\n" + msg.Body
+	}
+	return b.call(ctx, "sendMessage", map[string]string{
+		"chat_id": msg.To,
+		"text":    text,
+	})
+}
+
+// SetWebhook registers the URL Telegram sends the updates of the bot to.
+func (b *Bot) SetWebhook(ctx context.Context, webhookURL string) error {
+	return b.call(ctx, "setWebhook", map[string]string{
+		"url":          webhookURL,
+		"secret_token": b.WebhookSecret(),
+	})
+}
+
+// call calls a method of the Bot API with the JSON encoded parameters.
+func (b *Bot) call(ctx context.Context, method string, params any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	base := b.URL
+	if base == "" {
+		base = defaultAPIURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/bot%s/%s", strings.TrimSuffix(base, "/"), b.Token, method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := b.Client
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The error contains the URL, with the token of the bot
+		return fmt.Errorf("telegram %s request failed", method)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&result); err != nil {
+		return fmt.Errorf("telegram %s returned status %d", method, resp.StatusCode)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram %s failed: %s", method, result.Description)
+	}
+	return nil
+}
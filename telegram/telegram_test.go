@@ -0,0 +1,75 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emprius/emprius-app-backend/mail"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestBot(t *testing.T) {
+	c := qt.New(t)
+
+	var sent map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bot123:abc/sendMessage":
+			c.Check(json.NewDecoder(r.Body).Decode(&sent), qt.IsNil)
+			if sent["chat_id"] == "0" {
+				_, _ = w.Write([]byte(`{"ok":false,"description":"Bad Request: chat not found"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"ok":true,"result":{}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"ok":false,"description":"Not Found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	bot := &Bot{Token: "123:abc", Username: "emprius_bot", URL: srv.URL}
+	var sender mail.Sender = bot
+	c.Assert(sender.Send(context.Background(), &mail.Message{To: "42", Subject: "New booking request", Body: "Drill"}),
+		qt.IsNil)
+	c.Assert(sent["chat_id"], qt.Equals, "42")
+	c.Assert(sent["text"], qt.Equals, "New booking request\n\nDrill")
+
+	err := bot.Send(context.Background(), &mail.Message{To: "0", Body: "Drill"})
+	c.Assert(err, qt.ErrorMatches, "telegram sendMessage failed: Bad Request: chat not found")
+	err = (&Bot{Token: "wrong", URL: srv.URL}).Send(context.Background(), &mail.Message{To: "42"})
+	c.Assert(err, qt.ErrorMatches, "telegram sendMessage failed: Not Found")
+
+	c.Assert(bot.DeepLink("a1b2"), qt.Equals, "https://t.me/emprius_bot?start=a1b2")
+	c.Assert(bot.WebhookSecret(), qt.HasLen, 32)
+	c.Assert(bot.WebhookSecret(), qt.Not(qt.Equals), (&Bot{Token: "other"}).WebhookSecret())
+}
+
+func TestStartToken(t *testing.T) {
+	c := qt.New(t)
+
+	for _, tc := range []struct {
+		text  string
+		token string
+		ok    bool
+	}{
+		{"/start a1b2", "a1b2", true},
+		{"/start@emprius_bot a1b2", "a1b2", true},
+		{"/start", "", false},
+		{"hello a1b2", "", false},
+	} {
+		update := &Update{Message: &UpdateMessage{Text: tc.text}}
+		update.Message.Chat.ID = 42
+		token, chatID, ok := update.StartToken()
+		c.Assert(ok, qt.Equals, tc.ok, qt.Commentf("%q", tc.text))
+		c.Assert(token, qt.Equals, tc.token)
+		if ok {
+			c.Assert(chatID, qt.Equals, int64(42))
+		}
+	}
+	_, _, ok := (&Update{}).StartToken()
+	c.Assert(ok, qt.IsFalse)
+}
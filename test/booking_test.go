@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/emprius/emprius-app-backend/api"
 	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/payment"
 	"github.com/emprius/emprius-app-backend/test/utils"
 	qt "github.com/frankban/quicktest"
 )
@@ -37,8 +39,22 @@ func TestBookings(t *testing.T) {
 		)
 		qt.Assert(t, code, qt.Equals, 401)
 
+		// Owners cannot book their own tools
+		resp, code := c.Request(http.MethodPost, ownerJWT,
+			map[string]interface{}{
+				"toolId":    fmt.Sprint(toolID),
+				"startDate": time.Now().Add(24 * time.Hour).Unix(),
+				"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+				"contact":   "test@example.com",
+				"comments":  "Test booking",
+			},
+			"bookings",
+		)
+		qt.Assert(t, code, qt.Equals, 403)
+		qt.Assert(t, c.ErrorCode(resp), qt.Equals, "booking.own_tool")
+
 		// Create booking with auth
-		resp, code := c.Request(http.MethodPost, renterJWT,
+		resp, code = c.Request(http.MethodPost, renterJWT,
 			map[string]interface{}{
 				"toolId":    fmt.Sprint(toolID),
 				"startDate": time.Now().Add(24 * time.Hour).Unix(),
@@ -58,7 +74,7 @@ func TestBookings(t *testing.T) {
 		bookingID := response.Data.ID
 
 		// Create overlapping booking (should be allowed since first booking is pending)
-		_, code = c.Request(http.MethodPost, renterJWT,
+		resp, code = c.Request(http.MethodPost, renterJWT,
 			map[string]interface{}{
 				"toolId":    fmt.Sprint(toolID),
 				"startDate": time.Now().Add(36 * time.Hour).Unix(),
@@ -69,6 +85,9 @@ func TestBookings(t *testing.T) {
 			"bookings",
 		)
 		qt.Assert(t, code, qt.Equals, 200)
+		err = json.Unmarshal(resp, &response)
+		qt.Assert(t, err, qt.IsNil)
+		overlappingID := response.Data.ID
 
 		// Accept first booking
 		_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", bookingID, "accept")
@@ -87,6 +106,11 @@ func TestBookings(t *testing.T) {
 		)
 		qt.Assert(t, code, qt.Equals, 500, qt.Commentf("Response: %s", string(data)))
 
+		// Accepting the overlapping booking conflicts with the accepted one
+		data, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", overlappingID, "accept")
+		qt.Assert(t, code, qt.Equals, 409, qt.Commentf("Response: %s", string(data)))
+		qt.Assert(t, string(data), qt.Contains, "booking.accept_conflict")
+
 		// Get booking requests (owner) - should show both pending and accepted bookings
 		resp, code = c.Request(http.MethodGet, ownerJWT, nil, "bookings", "requests")
 		qt.Assert(t, code, qt.Equals, 200)
@@ -143,8 +167,9 @@ func TestBookings(t *testing.T) {
 		qt.Assert(t, bookingResp.Data.ID, qt.Equals, bookingID)
 
 		// Try to mark as returned by renter (should fail)
-		_, code = c.Request(http.MethodPost, renterJWT, nil, "bookings", bookingID, "return")
+		resp, code = c.Request(http.MethodPost, renterJWT, nil, "bookings", bookingID, "return")
 		qt.Assert(t, code, qt.Equals, 403)
+		qt.Assert(t, c.ErrorCode(resp), qt.Equals, "booking.owner_only_return")
 
 		// Mark as returned by owner
 		_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", bookingID, "return")
@@ -170,6 +195,32 @@ func TestBookings(t *testing.T) {
 		)
 		qt.Assert(t, code, qt.Equals, 200)
 
+		// The rating of the renter is added to the tool rating
+		resp, code = c.Request(http.MethodGet, renterJWT, nil, "tools", fmt.Sprint(toolID))
+		qt.Assert(t, code, qt.Equals, 200)
+		var toolResp struct {
+			Data api.Tool `json:"data"`
+		}
+		err = json.Unmarshal(resp, &toolResp)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, toolResp.Data.Rating, qt.IsNotNil)
+		qt.Assert(t, *toolResp.Data.Rating, qt.Equals, 5.0)
+		qt.Assert(t, toolResp.Data.RatingCount, qt.Equals, int64(1))
+
+		// Search results can be sorted by rating
+		resp, code = c.Request(http.MethodGet, renterJWT, nil, "tools/search?sort=rating")
+		qt.Assert(t, code, qt.Equals, 200)
+		var searchResp struct {
+			Data api.ToolSearchResponse `json:"data"`
+		}
+		err = json.Unmarshal(resp, &searchResp)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, searchResp.Data.Tools, qt.Not(qt.HasLen), 0)
+		qt.Assert(t, searchResp.Data.Tools[0].ID, qt.Equals, toolID)
+		qt.Assert(t, *searchResp.Data.Tools[0].Rating, qt.Equals, 5.0)
+		_, code = c.Request(http.MethodGet, renterJWT, nil, "tools/search?sort=price")
+		qt.Assert(t, code, qt.Equals, 400)
+
 		// Test deny petition
 		t.Run("Deny Petition", func(t *testing.T) {
 			// Create a new booking to deny
@@ -200,8 +251,18 @@ func TestBookings(t *testing.T) {
 			_, code = c.Request(http.MethodPost, renterJWT, nil, "bookings", "petitions", denyBookingID, "deny")
 			qt.Assert(t, code, qt.Equals, 403)
 
-			// Deny as owner
-			_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", denyBookingID, "deny")
+			// Notes are limited in length
+			_, code = c.Request(http.MethodPost, ownerJWT,
+				map[string]interface{}{"note": strings.Repeat("a", 501)},
+				"bookings", "petitions", denyBookingID, "deny",
+			)
+			qt.Assert(t, code, qt.Equals, 400)
+
+			// Deny as owner, with a note for the renter
+			_, code = c.Request(http.MethodPost, ownerJWT,
+				map[string]interface{}{"note": "Tool is under repair"},
+				"bookings", "petitions", denyBookingID, "deny",
+			)
 			qt.Assert(t, code, qt.Equals, 200)
 
 			// Verify booking status is REJECTED
@@ -213,6 +274,22 @@ func TestBookings(t *testing.T) {
 			err = json.Unmarshal(resp, &bookingResp)
 			qt.Assert(t, err, qt.IsNil)
 			qt.Assert(t, bookingResp.Data.BookingStatus, qt.Equals, "REJECTED")
+
+			// The history records the request and the denial with its note
+			resp, code = c.Request(http.MethodGet, renterJWT, nil, "bookings", denyBookingID, "history")
+			qt.Assert(t, code, qt.Equals, 200)
+			var historyResp struct {
+				Data []api.BookingTransition `json:"data"`
+			}
+			err = json.Unmarshal(resp, &historyResp)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, historyResp.Data, qt.HasLen, 2)
+			qt.Assert(t, historyResp.Data[0].To, qt.Equals, "PENDING")
+			qt.Assert(t, historyResp.Data[0].By, qt.Equals, renterID)
+			qt.Assert(t, historyResp.Data[1].From, qt.Equals, "PENDING")
+			qt.Assert(t, historyResp.Data[1].To, qt.Equals, "REJECTED")
+			qt.Assert(t, historyResp.Data[1].By, qt.Not(qt.Equals), renterID)
+			qt.Assert(t, historyResp.Data[1].Note, qt.Equals, "Tool is under repair")
 		})
 
 		// Test cancel request
@@ -290,6 +367,10 @@ func TestBookings(t *testing.T) {
 			// Test without authentication
 			_, code = c.Request(http.MethodGet, "", nil, "bookings", "user", renterID)
 			qt.Assert(t, code, qt.Equals, 401)
+
+			// The bookings of a user are only listed to the user and the admins
+			_, code = c.Request(http.MethodGet, ownerJWT, nil, "bookings", "user", renterID)
+			qt.Assert(t, code, qt.Equals, 403)
 		})
 
 		// Test count pending actions
@@ -362,3 +443,955 @@ func TestBookings(t *testing.T) {
 		})
 	})
 }
+
+func TestWaitlist(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	waiterJWT := c.RegisterAndLogin("waiter@test.com", "waiter", "waiterpass")
+	toolID := c.CreateTool(ownerJWT, "Test Tool")
+
+	dates := func(fromDay, toDay int) map[string]interface{} {
+		return map[string]interface{}{
+			"toolId":    fmt.Sprint(toolID),
+			"startDate": time.Now().Add(time.Duration(fromDay) * 24 * time.Hour).Unix(),
+			"endDate":   time.Now().Add(time.Duration(toDay) * 24 * time.Hour).Unix(),
+			"contact":   "test@example.com",
+		}
+	}
+
+	// The renter booking is accepted
+	resp, code := c.Request(http.MethodPost, renterJWT, dates(1, 3), "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", bookingResp.Data.ID, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// The suggested dates start after the accepted booking
+	_, code = c.Request(http.MethodGet, waiterJWT, nil, "tools", fmt.Sprint(toolID), "suggested-dates")
+	qt.Assert(t, code, qt.Equals, 400)
+	resp, code = c.Request(http.MethodGet, waiterJWT, nil, "tools", fmt.Sprint(toolID), "suggested-dates?duration=2")
+	qt.Assert(t, code, qt.Equals, 200)
+	var suggestionsResp struct {
+		Data api.SuggestedDatesResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &suggestionsResp), qt.IsNil)
+	qt.Assert(t, suggestionsResp.Data.Suggestions, qt.HasLen, 3)
+	qt.Assert(t, suggestionsResp.Data.Suggestions[0].StartDate >= bookingResp.Data.EndDate, qt.IsTrue)
+
+	// The dates are taken, the waiter joins the waitlist instead
+	resp, code = c.Request(http.MethodPost, waiterJWT, dates(2, 4), "bookings")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "booking.conflict")
+	resp, code = c.Request(http.MethodPost, waiterJWT, dates(10, 11), "tools", fmt.Sprint(toolID), "waitlist")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "waitlist.dates_available")
+	_, code = c.Request(http.MethodPost, ownerJWT, dates(2, 4), "tools", fmt.Sprint(toolID), "waitlist")
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = c.Request(http.MethodPost, waiterJWT, dates(2, 4), "tools", fmt.Sprint(toolID), "waitlist")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodPost, waiterJWT, dates(2, 4), "tools", fmt.Sprint(toolID), "waitlist")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "waitlist.already_joined")
+
+	// Cancelling the accepted booking sends the waiting request to the owner
+	_, code = c.Request(http.MethodPost, renterJWT, nil, "bookings", "request", bookingResp.Data.ID, "cancel")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodGet, waiterJWT, nil, "bookings", "petitions")
+	qt.Assert(t, code, qt.Equals, 200)
+	var petitionsResp struct {
+		Data []api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &petitionsResp), qt.IsNil)
+	qt.Assert(t, petitionsResp.Data, qt.HasLen, 1)
+	qt.Assert(t, petitionsResp.Data[0].BookingStatus, qt.Equals, string(db.BookingStatusPending))
+
+	resp, code = c.Request(http.MethodGet, waiterJWT, nil, "profile", "notifications")
+	qt.Assert(t, code, qt.Equals, 200)
+	var notificationsResp struct {
+		Data api.NotificationsWrapper `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &notificationsResp), qt.IsNil)
+	qt.Assert(t, notificationsResp.Data.Notifications[0].Type, qt.Equals, string(db.NotificationWaitlist))
+
+	// The entry was consumed
+	_, code = c.Request(http.MethodDelete, waiterJWT, nil, "tools", fmt.Sprint(toolID), "waitlist")
+	qt.Assert(t, code, qt.Equals, 404)
+}
+
+func TestBookingUsageTerms(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Chainsaw"))
+
+	booking := func(fromDay, toDay, termsVersion int) map[string]interface{} {
+		return map[string]interface{}{
+			"toolId":               toolID,
+			"startDate":            time.Now().Add(time.Duration(fromDay) * 24 * time.Hour).Unix(),
+			"endDate":              time.Now().Add(time.Duration(toDay) * 24 * time.Hour).Unix(),
+			"contact":              "test@example.com",
+			"acceptedTermsVersion": termsVersion,
+		}
+	}
+	getTool := func() api.Tool {
+		resp, code := c.Request(http.MethodGet, renterJWT, nil, "tools", toolID)
+		qt.Assert(t, code, qt.Equals, 200)
+		var toolResp struct {
+			Data api.Tool `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+		return toolResp.Data
+	}
+
+	// The owner sets the usage terms of the tool
+	_, code := c.Request(http.MethodPut, ownerJWT,
+		map[string]interface{}{"usageTerms": "Wear protective gear", "version": c.ToolVersion(ownerJWT, toolID)}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	tool := getTool()
+	qt.Assert(t, *tool.UsageTerms, qt.Equals, "Wear protective gear")
+	qt.Assert(t, tool.UsageTermsVersion, qt.Equals, 1)
+
+	// The terms must be accepted to book the tool
+	resp, code := c.Request(http.MethodPost, renterJWT, booking(1, 2, 0), "bookings")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "booking.terms_not_accepted")
+	resp, code = c.Request(http.MethodPost, renterJWT, booking(1, 2, 1), "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	qt.Assert(t, bookingResp.Data.AcceptedTerms, qt.IsNotNil)
+	qt.Assert(t, bookingResp.Data.AcceptedTerms.Version, qt.Equals, 1)
+
+	// Changing the terms makes a new version, the booking keeps the accepted ones
+	_, code = c.Request(http.MethodPut, ownerJWT,
+		map[string]interface{}{"usageTerms": "Return it clean", "version": c.ToolVersion(ownerJWT, toolID)}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, getTool().UsageTermsVersion, qt.Equals, 2)
+	_, code = c.Request(http.MethodPost, renterJWT, booking(3, 4, 1), "bookings")
+	qt.Assert(t, code, qt.Equals, 400)
+
+	resp, code = c.Request(http.MethodGet, ownerJWT, nil, "bookings", bookingResp.Data.ID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	qt.Assert(t, bookingResp.Data.AcceptedTerms.Text, qt.Equals, "Wear protective gear")
+
+	// Without terms any booking is accepted
+	_, code = c.Request(http.MethodPut, ownerJWT,
+		map[string]interface{}{"usageTerms": "", "version": c.ToolVersion(ownerJWT, toolID)}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, getTool().UsageTerms, qt.IsNil)
+	_, code = c.Request(http.MethodPost, renterJWT, booking(3, 4, 0), "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+}
+
+func TestBookingPricing(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Drill"))
+
+	// Two days from tomorrow, shifted by week so the bookings do not conflict
+	now := time.Now()
+	dates := func(week int) (int64, int64) {
+		start := now.Add(time.Duration(1+7*week) * 24 * time.Hour)
+		return start.Unix(), start.Add(48 * time.Hour).Unix()
+	}
+	quote := func(week int, query string) api.Quote {
+		start, end := dates(week)
+		resp, code := c.Request(http.MethodGet, renterJWT, nil, "tools", toolID,
+			fmt.Sprintf("quote?startDate=%d&endDate=%d%s", start, end, query))
+		qt.Assert(t, code, qt.Equals, 200)
+		var quoteResp struct {
+			Data api.Quote `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &quoteResp), qt.IsNil)
+		return quoteResp.Data
+	}
+	book := func(week int, amount *uint64) ([]byte, int) {
+		start, end := dates(week)
+		req := map[string]interface{}{"toolId": toolID, "startDate": start, "endDate": end}
+		if amount != nil {
+			req["amount"] = *amount
+		}
+		return c.Request(http.MethodPost, renterJWT, req, "bookings")
+	}
+	getTool := func() api.Tool {
+		resp, code := c.Request(http.MethodGet, renterJWT, nil, "tools", toolID)
+		qt.Assert(t, code, qt.Equals, 200)
+		var toolResp struct {
+			Data api.Tool `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+		return toolResp.Data
+	}
+	amount := uint64(4)
+
+	// Tools without pricing mode cost their cost for each day
+	qt.Assert(t, getTool().PricingMode, qt.Equals, "fixed")
+	q := quote(0, "")
+	qt.Assert(t, q.Days, qt.Equals, uint64(2))
+	qt.Assert(t, q.Price, qt.Equals, uint64(20))
+	qt.Assert(t, *q.CostPerDay, qt.Equals, uint64(10))
+	resp, code := book(0, &amount)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "booking.amount_not_allowed")
+
+	resp, code = c.Request(http.MethodPut, ownerJWT,
+		map[string]interface{}{"pricingMode": "auction", "version": c.ToolVersion(ownerJWT, toolID)}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.invalid_pricing_mode")
+
+	// Pay what you want tools cost the amount proposed by the renter, or the suggested amount
+	_, code = c.Request(http.MethodPut, ownerJWT,
+		map[string]interface{}{"pricingMode": "payWhatYouWant", "suggestedAmount": 3, "version": c.ToolVersion(ownerJWT, toolID)},
+		"tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	tool := getTool()
+	qt.Assert(t, tool.PricingMode, qt.Equals, "payWhatYouWant")
+	qt.Assert(t, *tool.SuggestedAmount, qt.Equals, uint64(3))
+	qt.Assert(t, quote(0, "").Price, qt.Equals, uint64(6))
+	qt.Assert(t, quote(0, "&amount=4").Price, qt.Equals, uint64(4))
+
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	resp, code = book(0, &amount)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	qt.Assert(t, bookingResp.Data.PricingMode, qt.Equals, "payWhatYouWant")
+	qt.Assert(t, *bookingResp.Data.Price, qt.Equals, uint64(4))
+	resp, code = book(1, nil)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	qt.Assert(t, *bookingResp.Data.Price, qt.Equals, uint64(6))
+
+	// Free tools cost nothing
+	_, code = c.Request(http.MethodPut, ownerJWT,
+		map[string]interface{}{"pricingMode": "free", "version": c.ToolVersion(ownerJWT, toolID)}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	tool = getTool()
+	qt.Assert(t, tool.PricingMode, qt.Equals, "free")
+	qt.Assert(t, tool.SuggestedAmount, qt.IsNil)
+	qt.Assert(t, quote(2, "").Price, qt.Equals, uint64(0))
+}
+
+func TestBookingCancellationPolicy(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Ladder"))
+
+	// Accepted bookings of two days from the given day, costing 20 tokens
+	now := time.Now()
+	book := func(fromDay int) api.BookingResponse {
+		start := now.Add(time.Duration(fromDay) * 24 * time.Hour)
+		resp, code := c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+			"toolId":    toolID,
+			"startDate": start.Unix(),
+			"endDate":   start.Add(48 * time.Hour).Unix(),
+		}, "bookings")
+		qt.Assert(t, code, qt.Equals, 200)
+		var bookingResp struct {
+			Data api.BookingResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+		_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", bookingResp.Data.ID, "accept")
+		qt.Assert(t, code, qt.Equals, 200)
+		return bookingResp.Data
+	}
+	cancel := func(id string) api.BookingResponse {
+		_, code := c.Request(http.MethodPost, renterJWT, nil, "bookings", "request", id, "cancel")
+		qt.Assert(t, code, qt.Equals, 200)
+		resp, code := c.Request(http.MethodGet, renterJWT, nil, "bookings", id)
+		qt.Assert(t, code, qt.Equals, 200)
+		var bookingResp struct {
+			Data api.BookingResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+		return bookingResp.Data
+	}
+	tokens := func(jwt string) uint64 {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "profile")
+		qt.Assert(t, code, qt.Equals, 200)
+		var profileResp struct {
+			Data api.User `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &profileResp), qt.IsNil)
+		return profileResp.Data.Tokens
+	}
+
+	// Tools are flexible by default, late cancellations are free
+	booking := book(1)
+	qt.Assert(t, booking.CancellationPolicy, qt.Equals, "flexible")
+	qt.Assert(t, cancel(booking.ID).CancellationPenalty, qt.Equals, uint64(0))
+	qt.Assert(t, tokens(renterJWT), qt.Equals, uint64(1000))
+
+	resp, code := c.Request(http.MethodPut, ownerJWT,
+		map[string]interface{}{"cancellationPolicy": "never", "version": c.ToolVersion(ownerJWT, toolID)}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.invalid_cancellation_policy")
+	_, code = c.Request(http.MethodPut, ownerJWT,
+		map[string]interface{}{"cancellationPolicy": "strict", "version": c.ToolVersion(ownerJWT, toolID)}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// The quote shows the penalty of a late cancellation
+	start := now.Add(24 * time.Hour)
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "tools", toolID,
+		fmt.Sprintf("quote?startDate=%d&endDate=%d", start.Unix(), start.Add(48*time.Hour).Unix()))
+	qt.Assert(t, code, qt.Equals, 200)
+	var quoteResp struct {
+		Data api.Quote `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &quoteResp), qt.IsNil)
+	qt.Assert(t, quoteResp.Data.CancellationPolicy, qt.Equals, "strict")
+	qt.Assert(t, quoteResp.Data.CancellationWindow, qt.Equals, int64(48*3600))
+	qt.Assert(t, quoteResp.Data.CancellationPenalty, qt.Equals, uint64(10))
+
+	// Strict bookings cancelled in time are free, late ones pay the penalty to the owner
+	booking = book(7)
+	qt.Assert(t, booking.CancellationPolicy, qt.Equals, "strict")
+	qt.Assert(t, cancel(booking.ID).CancellationPenalty, qt.Equals, uint64(0))
+	qt.Assert(t, tokens(renterJWT), qt.Equals, uint64(1000))
+	booking = book(1)
+	qt.Assert(t, cancel(booking.ID).CancellationPenalty, qt.Equals, uint64(10))
+	qt.Assert(t, tokens(renterJWT), qt.Equals, uint64(990))
+	qt.Assert(t, tokens(ownerJWT), qt.Equals, uint64(1010))
+}
+
+func TestBookingPayments(t *testing.T) {
+	c := utils.NewTestService(t, func(opts *api.Options) {
+		opts.Payments = payment.Manual{}
+	})
+
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Saw"))
+
+	start := time.Now().Add(24 * time.Hour)
+	resp, code := c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+		"toolId":    toolID,
+		"startDate": start.Unix(),
+		"endDate":   start.Add(48 * time.Hour).Unix(),
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	bookingID := bookingResp.Data.ID
+	qt.Assert(t, bookingResp.Data.Payment, qt.IsNil)
+
+	// Pending bookings cannot be paid yet
+	resp, code = c.Request(http.MethodPost, renterJWT, nil, "bookings", bookingID, "payment")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "payment.not_payable")
+
+	// The payment of the price is created on acceptance, a token is worth a euro by default
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", bookingID, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "bookings", bookingID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	qt.Assert(t, bookingResp.Data.Payment, qt.IsNotNil)
+	qt.Assert(t, bookingResp.Data.Payment.Provider, qt.Equals, "manual")
+	qt.Assert(t, bookingResp.Data.Payment.Status, qt.Equals, "pending")
+	qt.Assert(t, bookingResp.Data.Payment.Amount, qt.Equals, int64(2000))
+	qt.Assert(t, bookingResp.Data.Payment.Currency, qt.Equals, "eur")
+
+	resp, code = c.Request(http.MethodPost, renterJWT, nil, "bookings", bookingID, "payment")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "payment.conflict")
+
+	// Only the owner marks the payment collected by hand as paid, once
+	_, code = c.Request(http.MethodPost, renterJWT, nil, "bookings", bookingID, "payment", "paid")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", bookingID, "payment", "paid")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	qt.Assert(t, bookingResp.Data.Payment.Status, qt.Equals, "paid")
+	qt.Assert(t, bookingResp.Data.Payment.PaidAt, qt.IsNotNil)
+	resp, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", bookingID, "payment", "paid")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "payment.conflict")
+
+	// The manual payments have no webhook
+	resp, code = c.Request(http.MethodPost, "", map[string]string{"type": "checkout.session.completed"}, "payments", "webhook")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "payment.invalid_webhook")
+}
+
+func TestBookingAgreement(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	strangerJWT := c.RegisterAndLogin("stranger@test.com", "stranger", "strangerpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Saw"))
+
+	start := time.Now().Add(24 * time.Hour)
+	resp, code := c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+		"toolId":    toolID,
+		"startDate": start.Unix(),
+		"endDate":   start.Add(48 * time.Hour).Unix(),
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	bookingID := bookingResp.Data.ID
+
+	// Only the accepted bookings have an agreement, for their parties
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "bookings", bookingID, "agreement.pdf")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "booking.no_agreement")
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", bookingID, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodGet, strangerJWT, nil, "bookings", bookingID, "agreement.pdf")
+	qt.Assert(t, code, qt.Equals, 403)
+
+	for _, jwt := range []string{ownerJWT, renterJWT} {
+		data, header, code := c.HeaderRequest(http.MethodGet, jwt, nil, "bookings", bookingID, "agreement.pdf")
+		qt.Assert(t, code, qt.Equals, 200)
+		qt.Assert(t, header.Get("Content-Type"), qt.Equals, "application/pdf")
+		qt.Assert(t, header.Get("Content-Disposition"), qt.Contains, "agreement-"+bookingID+".pdf")
+		qt.Assert(t, strings.HasPrefix(string(data), "%PDF-"), qt.IsTrue)
+		qt.Assert(t, string(data), qt.Contains, "(Lender: owner <owner@test.com>)")
+		qt.Assert(t, string(data), qt.Contains, "(Borrower: renter <renter@test.com>)")
+		qt.Assert(t, string(data), qt.Contains, "(Saw)")
+		qt.Assert(t, string(data), qt.Contains, "(Price: 20 tokens.)")
+	}
+}
+
+func TestOwnerStats(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	toolID := c.CreateTool(ownerJWT, "Test Tool")
+
+	book := func(fromDay, toDay int) string {
+		resp, code := c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+			"toolId":    fmt.Sprint(toolID),
+			"startDate": time.Now().Add(time.Duration(fromDay) * 24 * time.Hour).Unix(),
+			"endDate":   time.Now().Add(time.Duration(toDay) * 24 * time.Hour).Unix(),
+			"contact":   "test@example.com",
+		}, "bookings")
+		qt.Assert(t, code, qt.Equals, 200)
+		var bookingResp struct {
+			Data api.BookingResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+		return bookingResp.Data.ID
+	}
+
+	// A two days booking is returned and rated, another one is denied
+	returned := book(1, 3)
+	_, code := c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", returned, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", returned, "return")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodPost, renterJWT, map[string]interface{}{"rating": 4, "bookingId": returned}, "bookings", "rates")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", book(5, 6), "deny")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	resp, code := c.Request(http.MethodGet, ownerJWT, nil, "profile", "stats")
+	qt.Assert(t, code, qt.Equals, 200)
+	var statsResp struct {
+		Data api.OwnerStatsResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &statsResp), qt.IsNil)
+	stats := statsResp.Data
+	qt.Assert(t, stats.Requests, qt.Equals, int64(2))
+	qt.Assert(t, *stats.AcceptanceRate, qt.Equals, 0.5)
+	qt.Assert(t, stats.TokensEarned, qt.Equals, uint64(20))
+	qt.Assert(t, stats.Months, qt.HasLen, 1)
+	qt.Assert(t, *stats.Months[0].Rating, qt.Equals, 4.0)
+	qt.Assert(t, stats.TopTools, qt.HasLen, 1)
+	qt.Assert(t, stats.TopTools[0].ToolID, qt.Equals, toolID)
+	qt.Assert(t, stats.TopTools[0].Requests, qt.Equals, int64(2))
+
+	// The renter received no requests, and the period is validated
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "profile", "stats")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &statsResp), qt.IsNil)
+	qt.Assert(t, statsResp.Data.Requests, qt.Equals, int64(0))
+	qt.Assert(t, statsResp.Data.AcceptanceRate, qt.IsNil)
+	resp, code = c.Request(http.MethodGet, ownerJWT, nil, "profile", "stats?from=20&to=10")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "request.invalid_data")
+
+	// The returned booking is counted in the public stats
+	resp, header, code := c.HeaderRequest(http.MethodGet, "", nil, "info", "stats")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, header.Get("Cache-Control"), qt.Equals, "public, max-age=300")
+	var publicResp struct {
+		Data api.PublicStats `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &publicResp), qt.IsNil)
+	qt.Assert(t, publicResp.Data.Users, qt.Equals, int64(2))
+	qt.Assert(t, publicResp.Data.Tools, qt.Equals, int64(1))
+	qt.Assert(t, publicResp.Data.CompletedBookings, qt.Equals, int64(1))
+	qt.Assert(t, publicResp.Data.EstimatedValueShared, qt.Equals, uint64(20))
+}
+
+func TestBookingIdempotencyKey(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	otherJWT := c.RegisterAndLogin("other@test.com", "other", "otherpass")
+	toolID := c.CreateTool(ownerJWT, "Test Tool")
+
+	booking := map[string]interface{}{
+		"toolId":    fmt.Sprint(toolID),
+		"startDate": time.Now().Add(24 * time.Hour).Unix(),
+		"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+		"contact":   "test@example.com",
+	}
+	key := http.Header{"Idempotency-Key": []string{"retry-1"}}
+	first, header, code := c.JSONHeaderRequest(http.MethodPost, renterJWT, booking, key, "bookings")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(first)))
+	qt.Assert(t, header.Get("Idempotent-Replayed"), qt.Equals, "")
+
+	// The retry gets the same response and does not create another booking
+	retry, header, code := c.JSONHeaderRequest(http.MethodPost, renterJWT, booking, key, "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, header.Get("Idempotent-Replayed"), qt.Equals, "true")
+	qt.Assert(t, string(retry), qt.Equals, string(first))
+	resp, code := c.Request(http.MethodGet, renterJWT, nil, "bookings", "petitions")
+	qt.Assert(t, code, qt.Equals, 200)
+	var petitions struct {
+		Data []api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &petitions), qt.IsNil)
+	qt.Assert(t, petitions.Data, qt.HasLen, 1)
+
+	// The key cannot be reused with another body
+	booking["comments"] = "changed"
+	resp, _, code = c.JSONHeaderRequest(http.MethodPost, renterJWT, booking, key, "bookings")
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "request.idempotency_key_reused")
+
+	// The keys are scoped by user
+	_, header, code = c.JSONHeaderRequest(http.MethodPost, otherJWT, booking, key, "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, header.Get("Idempotent-Replayed"), qt.Equals, "")
+
+	// Failed requests are not stored
+	failKey := http.Header{"Idempotency-Key": []string{"retry-2"}}
+	booking["toolId"] = "999999"
+	_, _, code = c.JSONHeaderRequest(http.MethodPost, renterJWT, booking, failKey, "bookings")
+	qt.Assert(t, code, qt.Not(qt.Equals), 200)
+	booking["toolId"] = fmt.Sprint(toolID)
+	_, header, code = c.JSONHeaderRequest(http.MethodPost, renterJWT, booking, failKey, "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, header.Get("Idempotent-Replayed"), qt.Equals, "")
+
+	// Too long keys are rejected
+	longKey := http.Header{"Idempotency-Key": []string{strings.Repeat("k", 256)}}
+	resp, _, code = c.JSONHeaderRequest(http.MethodPost, renterJWT, booking, longKey, "bookings")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "request.invalid_idempotency_key")
+}
+
+func TestBookingSummaries(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	toolID := c.CreateTool(ownerJWT, "Test Tool")
+
+	resp, code := c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+		"toolId":    fmt.Sprint(toolID),
+		"startDate": time.Now().Add(24 * time.Hour).Unix(),
+		"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+		"contact":   "test@example.com",
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+
+	bookings := func(jwt string, path ...string) []api.BookingResponse {
+		resp, code := c.Request(http.MethodGet, jwt, nil, path...)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var response struct {
+			Data []api.BookingResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &response), qt.IsNil)
+		qt.Assert(t, response.Data, qt.HasLen, 1)
+		return response.Data
+	}
+
+	// The lists include the summaries of the tool and both parties
+	requests := bookings(ownerJWT, "bookings", "requests")
+	qt.Assert(t, requests[0].Tool.Title, qt.Equals, "Test Tool")
+	qt.Assert(t, requests[0].FromUser.Name, qt.Equals, "renter")
+	qt.Assert(t, requests[0].ToUser.Name, qt.Equals, "owner")
+
+	// A new title changes the tool ID, the bookings follow the tool
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"title":   "Renamed Tool",
+		"version": c.ToolVersion(ownerJWT, toolID),
+	}, "tools", fmt.Sprint(toolID))
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var edited struct {
+		Data api.ToolID `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &edited), qt.IsNil)
+	petitions := bookings(renterJWT, "bookings", "petitions")
+	qt.Assert(t, petitions[0].ToolID, qt.Equals, fmt.Sprint(edited.Data.ID))
+	qt.Assert(t, petitions[0].Tool.Title, qt.Equals, "Renamed Tool")
+
+	// The summaries can be selected as any other field
+	requests = bookings(ownerJWT, "bookings", "requests?fields=fromUser")
+	qt.Assert(t, requests[0].Tool, qt.IsNil)
+	qt.Assert(t, requests[0].ToUser, qt.IsNil)
+	qt.Assert(t, requests[0].FromUser.Name, qt.Equals, "renter")
+}
+
+func TestBookingListFilters(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("list-owner@test.com", "owner", "ownerpass")
+	renterJWT, renterID := c.RegisterAndLoginWithID("list-renter@test.com", "renter", "renterpass")
+	otherJWT := c.RegisterAndLogin("list-other@test.com", "other", "otherpass")
+	drillID := fmt.Sprint(c.CreateTool(ownerJWT, "Drill"))
+	sawID := fmt.Sprint(c.CreateTool(ownerJWT, "Saw"))
+
+	book := func(jwt, toolID string, days int) string {
+		resp, code := c.Request(http.MethodPost, jwt, map[string]interface{}{
+			"toolId":    toolID,
+			"startDate": time.Now().Add(time.Duration(days) * 24 * time.Hour).Unix(),
+			"endDate":   time.Now().Add(time.Duration(days+1) * 24 * time.Hour).Unix(),
+			"contact":   "test@example.com",
+		}, "bookings")
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var booking struct {
+			Data api.BookingResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &booking), qt.IsNil)
+		return booking.Data.ID
+	}
+	late := book(renterJWT, drillID, 10)
+	soon := book(otherJWT, drillID, 2)
+	saw := book(renterJWT, sawID, 5)
+	_, code := c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", soon, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	bookings := func(jwt, path string) []string {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "bookings", path)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var response struct {
+			Data []api.BookingResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &response), qt.IsNil)
+		ids := []string{}
+		for _, b := range response.Data {
+			ids = append(ids, b.ID)
+		}
+		return ids
+	}
+
+	qt.Assert(t, bookings(ownerJWT, "requests"), qt.DeepEquals, []string{saw, soon, late})
+	qt.Assert(t, bookings(ownerJWT, "requests?sort=startDate&order=asc"), qt.DeepEquals, []string{soon, saw, late})
+	qt.Assert(t, bookings(ownerJWT, "requests?status=PENDING"), qt.DeepEquals, []string{saw, late})
+	qt.Assert(t, bookings(ownerJWT, "requests?toolId="+drillID), qt.DeepEquals, []string{soon, late})
+	qt.Assert(t, bookings(ownerJWT, "requests?user="+renterID), qt.DeepEquals, []string{saw, late})
+	from, to := time.Now().Add(4*24*time.Hour).Unix(), time.Now().Add(8*24*time.Hour).Unix()
+	qt.Assert(t, bookings(ownerJWT, fmt.Sprintf("requests?from=%d&to=%d", from, to)), qt.DeepEquals, []string{saw})
+	qt.Assert(t, bookings(renterJWT, "petitions?order=asc"), qt.DeepEquals, []string{late, saw})
+	qt.Assert(t, bookings(renterJWT, "petitions?toolId="+sawID+"&status=pending"), qt.DeepEquals, []string{saw})
+
+	_, code = c.Request(http.MethodGet, ownerJWT, nil, "bookings", "requests?sort=price")
+	qt.Assert(t, code, qt.Equals, 400)
+}
+
+func TestBookingArchive(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("archive-owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("archive-renter@test.com", "renter", "renterpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Archived drill"))
+
+	book := func(days int) string {
+		resp, code := c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+			"toolId":    toolID,
+			"startDate": time.Now().Add(time.Duration(days) * 24 * time.Hour).Unix(),
+			"endDate":   time.Now().Add(time.Duration(days+1) * 24 * time.Hour).Unix(),
+			"contact":   "renter@test.com",
+		}, "bookings")
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var booking struct {
+			Data api.BookingResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &booking), qt.IsNil)
+		return booking.Data.ID
+	}
+	denied := book(2)
+	cancelled := book(5)
+	pending := book(8)
+
+	bookings := func(jwt, path string) map[string]bool {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "bookings", path)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var response struct {
+			Data []api.BookingResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &response), qt.IsNil)
+		archived := map[string]bool{}
+		for _, b := range response.Data {
+			archived[b.ID] = b.Archived
+		}
+		return archived
+	}
+
+	// Only the ended bookings can be archived
+	resp, code := c.Request(http.MethodPost, renterJWT, nil, "bookings", pending, "archive")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "booking.not_ended")
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", denied, "deny")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodPost, renterJWT, nil, "bookings", "request", cancelled, "cancel")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// The archived booking is only hidden from the lists of the user archiving it
+	resp, code = c.Request(http.MethodPost, renterJWT, nil, "bookings", denied, "archive")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	qt.Assert(t, bookings(renterJWT, "petitions"), qt.DeepEquals, map[string]bool{cancelled: false, pending: false})
+	qt.Assert(t, bookings(renterJWT, "petitions?includeArchived=true"), qt.DeepEquals,
+		map[string]bool{denied: true, cancelled: false, pending: false})
+	qt.Assert(t, bookings(ownerJWT, "requests"), qt.DeepEquals,
+		map[string]bool{denied: false, cancelled: false, pending: false})
+
+	// Unarchived, it is listed again
+	_, code = c.Request(http.MethodDelete, renterJWT, nil, "bookings", denied, "archive")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, bookings(renterJWT, "petitions"), qt.DeepEquals,
+		map[string]bool{denied: false, cancelled: false, pending: false})
+
+	// The bulk archive only archives the bookings ended before the date
+	_, code = c.Request(http.MethodPost, ownerJWT, map[string]interface{}{}, "bookings", "archive")
+	qt.Assert(t, code, qt.Equals, 400)
+	resp, code = c.Request(http.MethodPost, ownerJWT, map[string]interface{}{
+		"before": time.Now().Add(4 * 24 * time.Hour).Unix(),
+	}, "bookings", "archive")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var archived struct {
+		Data api.ArchivedBookings `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &archived), qt.IsNil)
+	qt.Assert(t, archived.Data.Archived, qt.Equals, int64(1))
+	resp, code = c.Request(http.MethodPost, ownerJWT, map[string]interface{}{
+		"before": time.Now().Add(30 * 24 * time.Hour).Unix(),
+	}, "bookings", "archive")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &archived), qt.IsNil)
+	qt.Assert(t, archived.Data.Archived, qt.Equals, int64(1))
+	qt.Assert(t, bookings(ownerJWT, "requests"), qt.DeepEquals, map[string]bool{pending: false})
+}
+
+func TestBookingAutoAccept(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("auto-owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("auto-renter@test.com", "renter", "renterpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Self service drill"))
+
+	resp, code := c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version":    c.ToolVersion(ownerJWT, toolID),
+		"autoAccept": map[string]interface{}{"minRating": 7},
+	}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.invalid_auto_accept")
+
+	// The bookings of up to two days are accepted right away
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version":    c.ToolVersion(ownerJWT, toolID),
+		"autoAccept": map[string]interface{}{"maxDays": 2},
+	}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	book := func(startDays, days int) api.BookingResponse {
+		start := time.Now().Add(time.Duration(startDays) * 24 * time.Hour)
+		resp, code := c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+			"toolId":    toolID,
+			"startDate": start.Unix(),
+			"endDate":   start.Add(time.Duration(days) * 24 * time.Hour).Unix(),
+			"contact":   "renter@test.com",
+		}, "bookings")
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var bookingResp struct {
+			Data api.BookingResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+		return bookingResp.Data
+	}
+	qt.Assert(t, book(1, 1).BookingStatus, qt.Equals, string(db.BookingStatusAccepted))
+	qt.Assert(t, book(10, 5).BookingStatus, qt.Equals, string(db.BookingStatusPending))
+
+	notifications := func(jwt string) []string {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "profile", "notifications")
+		qt.Assert(t, code, qt.Equals, 200)
+		var notificationsResp struct {
+			Data api.NotificationsWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &notificationsResp), qt.IsNil)
+		types := []string{}
+		for _, n := range notificationsResp.Data.Notifications {
+			types = append(types, n.Type)
+		}
+		return types
+	}
+	// The owner is informed of the accepted booking and asked to answer the other one
+	qt.Assert(t, notifications(ownerJWT), qt.ContentEquals,
+		[]string{string(db.NotificationBookingStatus), string(db.NotificationBookingRequest)})
+	qt.Assert(t, notifications(renterJWT), qt.DeepEquals, []string{string(db.NotificationBookingStatus)})
+}
+
+func TestBookingAvailability(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("weekend-owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("weekend-renter@test.com", "renter", "renterpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Weekend trailer"))
+
+	resp, code := c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version":      c.ToolVersion(ownerJWT, toolID),
+		"availability": map[string]interface{}{"weekdays": []int{7}},
+	}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.invalid_availability")
+
+	// The tool can only be booked on weekends
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version":      c.ToolVersion(ownerJWT, toolID),
+		"availability": map[string]interface{}{"weekdays": []int{6, 0, 6}},
+	}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.Availability.Weekdays, qt.DeepEquals, []int{0, 6})
+
+	saturday := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	for saturday.Weekday() != time.Saturday {
+		saturday = saturday.AddDate(0, 0, 1)
+	}
+	book := func(start, end time.Time) ([]byte, int) {
+		return c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+			"toolId":    toolID,
+			"startDate": start.Unix(),
+			"endDate":   end.Unix(),
+			"contact":   "renter@test.com",
+		}, "bookings")
+	}
+	resp, code = book(saturday.AddDate(0, 0, 2), saturday.AddDate(0, 0, 3))
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "booking.outside_availability")
+	resp, code = book(saturday.Add(-time.Hour), saturday.Add(10*time.Hour))
+	qt.Assert(t, code, qt.Equals, 400, qt.Commentf("Friday night is not available"))
+	resp, code = book(saturday.Add(9*time.Hour), saturday.AddDate(0, 0, 2))
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+
+	// The suggested dates only cover weekends
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "tools", toolID, "suggested-dates?duration=1&count=4")
+	qt.Assert(t, code, qt.Equals, 200)
+	var suggestionsResp struct {
+		Data api.SuggestedDatesResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &suggestionsResp), qt.IsNil)
+	qt.Assert(t, suggestionsResp.Data.Suggestions, qt.HasLen, 4)
+	for _, window := range suggestionsResp.Data.Suggestions {
+		weekday := time.Unix(window.StartDate, 0).UTC().Weekday()
+		qt.Assert(t, weekday == time.Saturday || weekday == time.Sunday, qt.IsTrue)
+	}
+
+	// An empty object removes the rules
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version":      c.ToolVersion(ownerJWT, toolID),
+		"availability": map[string]interface{}{},
+	}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	resp, code = book(saturday.AddDate(0, 0, 9), saturday.AddDate(0, 0, 10))
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+}
+
+func TestBookingBatch(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("batch-owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("batch-renter@test.com", "renter", "renterpass")
+	otherJWT := c.RegisterAndLogin("batch-other@test.com", "other", "otherpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Popular drill"))
+
+	book := func(jwt string, days int) string {
+		resp, code := c.Request(http.MethodPost, jwt, map[string]interface{}{
+			"toolId":    toolID,
+			"startDate": time.Now().Add(time.Duration(days) * 24 * time.Hour).Unix(),
+			"endDate":   time.Now().Add(time.Duration(days+1) * 24 * time.Hour).Unix(),
+			"contact":   "renter@test.com",
+		}, "bookings")
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var booking struct {
+			Data api.BookingResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &booking), qt.IsNil)
+		return booking.Data.ID
+	}
+	first := book(renterJWT, 2)
+	overlapping := book(otherJWT, 2)
+	later := book(renterJWT, 10)
+
+	batch := func(jwt string, req api.BookingBatchRequest) api.BookingBatchResponse {
+		resp, code := c.Request(http.MethodPut, jwt, req, "bookings", "batch")
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var response struct {
+			Data api.BookingBatchResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &response), qt.IsNil)
+		return response.Data
+	}
+
+	// The batch must have a valid status and some bookings
+	_, code := c.Request(http.MethodPut, ownerJWT, api.BookingBatchRequest{IDs: []string{first}, Status: "RETURNED"},
+		"bookings", "batch")
+	qt.Assert(t, code, qt.Equals, 400)
+	_, code = c.Request(http.MethodPut, ownerJWT, api.BookingBatchRequest{Status: "ACCEPTED"}, "bookings", "batch")
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// Only the owner can accept the requests
+	result := batch(renterJWT, api.BookingBatchRequest{IDs: []string{first}, Status: "ACCEPTED"})
+	qt.Assert(t, result.Updated, qt.Equals, 0)
+	qt.Assert(t, result.Failed, qt.Equals, 1)
+	qt.Assert(t, result.Results[0].ErrorCode, qt.Not(qt.Equals), "")
+
+	// Each booking is validated on its own, the overlapping request conflicts with the first one
+	result = batch(ownerJWT, api.BookingBatchRequest{
+		IDs:    []string{first, overlapping, later, "invalid"},
+		Status: "accepted",
+		Note:   "See you soon",
+	})
+	qt.Assert(t, result.Updated, qt.Equals, 2)
+	qt.Assert(t, result.Failed, qt.Equals, 2)
+	qt.Assert(t, result.Results, qt.HasLen, 4)
+	qt.Assert(t, result.Results[0], qt.DeepEquals, &api.BookingBatchResult{ID: first, BookingStatus: "ACCEPTED"})
+	qt.Assert(t, result.Results[1].ErrorCode, qt.Equals, "booking.accept_conflict")
+	qt.Assert(t, result.Results[2].BookingStatus, qt.Equals, "ACCEPTED")
+	qt.Assert(t, result.Results[3].ErrorCode, qt.Equals, "request.invalid_data")
+
+	// The note is recorded in the history of the bookings
+	resp, code := c.Request(http.MethodGet, ownerJWT, nil, "bookings", later, "history")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, strings.Contains(string(resp), "See you soon"), qt.IsTrue)
+
+	// The pending request is denied, the accepted ones can't be
+	result = batch(ownerJWT, api.BookingBatchRequest{IDs: []string{overlapping, first}, Status: "REJECTED"})
+	qt.Assert(t, result.Updated, qt.Equals, 1)
+	qt.Assert(t, result.Results[0].BookingStatus, qt.Equals, "REJECTED")
+	qt.Assert(t, result.Results[1].ErrorCode, qt.Equals, "booking.deny_not_pending")
+}
@@ -0,0 +1,817 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/api"
+	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/test/utils"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestCommunityPosts(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	adminJWT, adminID := c.RegisterAndLoginWithID("admin@test.com", "admin", "adminpass")
+	c.MakeAdmin(adminID)
+	memberJWT := c.RegisterAndLogin("member@test.com", "member", "memberpass")
+	strangerJWT := c.RegisterAndLogin("stranger@test.com", "stranger", "strangerpass")
+	c.SetCommunity(strangerJWT, "otherCommunity")
+
+	createPost := func(jwt string, post *api.PostRequest) (*api.Post, int) {
+		resp, code := c.Request(http.MethodPost, jwt, post, "communities", "testCommunity", "posts")
+		var postResp struct {
+			Data *api.Post `json:"data"`
+		}
+		if code == 200 {
+			qt.Assert(t, json.Unmarshal(resp, &postResp), qt.IsNil)
+		}
+		return postResp.Data, code
+	}
+	listPosts := func(jwt string) []*api.Post {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "communities", "testCommunity", "posts")
+		qt.Assert(t, code, qt.Equals, 200)
+		var postsResp struct {
+			Data api.PostsWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &postsResp), qt.IsNil)
+		return postsResp.Data.Posts
+	}
+
+	t.Run("Posts", func(t *testing.T) {
+		first, code := createPost(memberJWT, &api.PostRequest{Title: "Chainsaw maintenance day", Body: "Saturday at the square"})
+		qt.Assert(t, code, qt.Equals, 200)
+		qt.Assert(t, first.Announcement, qt.IsFalse)
+		_, code = createPost(memberJWT, &api.PostRequest{Title: "Ladder needed", Body: "Anyone has a long ladder?"})
+		qt.Assert(t, code, qt.Equals, 200)
+
+		// Only members can post and read
+		_, code = createPost(strangerJWT, &api.PostRequest{Title: "Hello", Body: "From another community"})
+		qt.Assert(t, code, qt.Equals, 403)
+		_, code = c.Request(http.MethodGet, strangerJWT, nil, "communities", "testCommunity", "posts")
+		qt.Assert(t, code, qt.Equals, 403)
+		_, code = createPost(memberJWT, &api.PostRequest{Title: "", Body: "No title"})
+		qt.Assert(t, code, qt.Equals, 422)
+
+		// Newest first, until a post is pinned by an admin
+		posts := listPosts(memberJWT)
+		qt.Assert(t, posts, qt.HasLen, 2)
+		qt.Assert(t, posts[0].Title, qt.Equals, "Ladder needed")
+		_, code = c.Request(http.MethodPost, memberJWT, nil, "communities", "testCommunity", "posts", first.ID, "pin")
+		qt.Assert(t, code, qt.Equals, 403)
+		_, code = c.Request(http.MethodPost, adminJWT, nil, "communities", "testCommunity", "posts", first.ID, "pin")
+		qt.Assert(t, code, qt.Equals, 200)
+		posts = listPosts(memberJWT)
+		qt.Assert(t, posts[0].ID, qt.Equals, first.ID)
+		qt.Assert(t, posts[0].Pinned, qt.IsTrue)
+		_, code = c.Request(http.MethodDelete, adminJWT, nil, "communities", "testCommunity", "posts", first.ID, "pin")
+		qt.Assert(t, code, qt.Equals, 200)
+		qt.Assert(t, listPosts(memberJWT)[0].Title, qt.Equals, "Ladder needed")
+	})
+
+	t.Run("Comments", func(t *testing.T) {
+		post, code := createPost(memberJWT, &api.PostRequest{Title: "Tool swap", Body: "Next month"})
+		qt.Assert(t, code, qt.Equals, 200)
+		_, code = c.Request(http.MethodPost, adminJWT, &api.CommentRequest{Body: "Count me in"},
+			"communities", "testCommunity", "posts", post.ID, "comments")
+		qt.Assert(t, code, qt.Equals, 200)
+		_, code = c.Request(http.MethodPost, strangerJWT, &api.CommentRequest{Body: "Me too"},
+			"communities", "testCommunity", "posts", post.ID, "comments")
+		qt.Assert(t, code, qt.Equals, 403)
+
+		resp, code := c.Request(http.MethodGet, memberJWT, nil, "communities", "testCommunity", "posts", post.ID, "comments")
+		qt.Assert(t, code, qt.Equals, 200)
+		var commentsResp struct {
+			Data api.PostCommentsWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &commentsResp), qt.IsNil)
+		qt.Assert(t, commentsResp.Data.Comments, qt.HasLen, 1)
+		qt.Assert(t, commentsResp.Data.Comments[0].Body, qt.Equals, "Count me in")
+
+		resp, code = c.Request(http.MethodGet, memberJWT, nil, "communities", "testCommunity", "posts", post.ID)
+		qt.Assert(t, code, qt.Equals, 200)
+		var postResp struct {
+			Data api.Post `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &postResp), qt.IsNil)
+		qt.Assert(t, postResp.Data.Comments, qt.Equals, int64(1))
+	})
+
+	t.Run("Announcements", func(t *testing.T) {
+		_, code := createPost(memberJWT, &api.PostRequest{Title: "Announcement", Body: "Not an admin", Announcement: true})
+		qt.Assert(t, code, qt.Equals, 403)
+		post, code := createPost(adminJWT, &api.PostRequest{Title: "General assembly", Body: "Friday 19h", Announcement: true})
+		qt.Assert(t, code, qt.Equals, 200)
+		qt.Assert(t, post.Announcement, qt.IsTrue)
+
+		// The members are notified in the background, after the comment of the previous test
+		var latest *api.Notification
+		for i := 0; i < 20; i++ {
+			resp, code := c.Request(http.MethodGet, memberJWT, nil, "profile", "notifications")
+			qt.Assert(t, code, qt.Equals, 200)
+			var notificationsResp struct {
+				Data api.NotificationsWrapper `json:"data"`
+			}
+			qt.Assert(t, json.Unmarshal(resp, &notificationsResp), qt.IsNil)
+			latest = notificationsResp.Data.Notifications[0]
+			if latest.Type == "COMMUNITY_ANNOUNCEMENT" {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		qt.Assert(t, latest.Type, qt.Equals, "COMMUNITY_ANNOUNCEMENT")
+		qt.Assert(t, latest.PostID, qt.Equals, post.ID)
+	})
+
+	t.Run("Mentions", func(t *testing.T) {
+		toolID := c.CreateTool(memberJWT, "Long ladder")
+		post, code := createPost(adminJWT, &api.PostRequest{
+			Title: "Ladders",
+			Body:  fmt.Sprintf("Thanks @member for #tool:%d! Also ask @stranger and #tool:999999.", toolID),
+		})
+		qt.Assert(t, code, qt.Equals, 200)
+		// The stranger is not a member and the last tool does not exist, they are plain text
+		qt.Assert(t, post.Refs, qt.HasLen, 2)
+		qt.Assert(t, post.Refs[0].Type, qt.Equals, db.EntityUser)
+		qt.Assert(t, post.Refs[0].Text, qt.Equals, "@member")
+		qt.Assert(t, post.Refs[0].Label, qt.Equals, "member")
+		qt.Assert(t, post.Refs[1].Type, qt.Equals, db.EntityTool)
+		qt.Assert(t, post.Refs[1].ID, qt.Equals, fmt.Sprint(toolID))
+		qt.Assert(t, post.Refs[1].Label, qt.Equals, "Long ladder")
+
+		resp, code := c.Request(http.MethodGet, memberJWT, nil, "profile", "notifications")
+		qt.Assert(t, code, qt.Equals, 200)
+		var notificationsResp struct {
+			Data api.NotificationsWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &notificationsResp), qt.IsNil)
+		qt.Assert(t, notificationsResp.Data.Notifications[0].Type, qt.Equals, "MENTION")
+		qt.Assert(t, notificationsResp.Data.Notifications[0].PostID, qt.Equals, post.ID)
+	})
+}
+
+func TestCommunityTools(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	adminJWT, adminID := c.RegisterAndLoginWithID("admin@test.com", "admin", "adminpass")
+	c.MakeAdmin(adminID)
+	otherAdminJWT, otherAdminID := c.RegisterAndLoginWithID("admin2@test.com", "admin2", "adminpass")
+	c.MakeAdmin(otherAdminID)
+	memberJWT := c.RegisterAndLogin("member@test.com", "member", "memberpass")
+	strangerJWT := c.RegisterAndLogin("stranger@test.com", "stranger", "strangerpass")
+	c.SetCommunity(strangerJWT, "otherCommunity")
+
+	newTool := func(jwt string) ([]byte, int) {
+		return c.Request(http.MethodPost, jwt,
+			map[string]interface{}{
+				"title":          "Community cement mixer",
+				"description":    "Shared by the community",
+				"mayBeFree":      false,
+				"askWithFee":     true,
+				"cost":           10,
+				"estimatedValue": 300,
+				"community":      "testCommunity",
+				"location": map[string]interface{}{
+					"latitude":  41695384,
+					"longitude": 2492793,
+				},
+			},
+			"tools",
+		)
+	}
+	book := func(jwt string, toolID int64) (string, int) {
+		resp, code := c.Request(http.MethodPost, jwt,
+			map[string]interface{}{
+				"toolId":    fmt.Sprint(toolID),
+				"startDate": time.Now().Add(24 * time.Hour).Unix(),
+				"endDate":   time.Now().Add(72 * time.Hour).Unix(),
+				"contact":   "member@test.com",
+			},
+			"bookings",
+		)
+		var bookingResp struct {
+			Data api.BookingResponse `json:"data"`
+		}
+		if code == 200 {
+			qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+		}
+		return bookingResp.Data.ID, code
+	}
+	tokens := func(jwt string) uint64 {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "profile")
+		qt.Assert(t, code, qt.Equals, 200)
+		var profileResp struct {
+			Data api.User `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &profileResp), qt.IsNil)
+		return profileResp.Data.Tokens
+	}
+
+	// Only the community admins can register shared tools
+	resp, code := newTool(memberJWT)
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = newTool(adminJWT)
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.ToolID `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	toolID := toolResp.Data.ID
+
+	resp, code = c.Request(http.MethodGet, memberJWT, nil, "tools", fmt.Sprint(toolID))
+	qt.Assert(t, code, qt.Equals, 200)
+	var getToolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &getToolResp), qt.IsNil)
+	qt.Assert(t, getToolResp.Data.Community, qt.Equals, "testCommunity")
+
+	// Any admin of the community manages the tool
+	_, code = c.Request(http.MethodPut, otherAdminJWT,
+		map[string]interface{}{"description": "Updated", "version": c.ToolVersion(otherAdminJWT, toolID)},
+		"tools", fmt.Sprint(toolID))
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// Only the members can book it, and the admins cannot book their own tools
+	_, code = book(strangerJWT, toolID)
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = book(otherAdminJWT, toolID)
+	qt.Assert(t, code, qt.Equals, 403)
+	bookingID, code := book(memberJWT, toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// Accepting the booking pays two days of the tool to the community pool
+	_, code = c.Request(http.MethodPost, memberJWT, nil, "bookings", "petitions", bookingID, "accept")
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = c.Request(http.MethodPost, otherAdminJWT, nil, "bookings", "petitions", bookingID, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, tokens(memberJWT), qt.Equals, uint64(980))
+
+	resp, code = c.Request(http.MethodGet, memberJWT, nil, "communities", "testCommunity", "pool")
+	qt.Assert(t, code, qt.Equals, 200)
+	var poolResp struct {
+		Data api.CommunityPool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &poolResp), qt.IsNil)
+	qt.Assert(t, poolResp.Data.Tokens, qt.Equals, uint64(20))
+	_, code = c.Request(http.MethodGet, strangerJWT, nil, "communities", "testCommunity", "pool")
+	qt.Assert(t, code, qt.Equals, 403)
+
+	// The community admins list the bookings of the shared tools
+	_, code = c.Request(http.MethodGet, memberJWT, nil, "communities", "testCommunity", "bookings")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = c.Request(http.MethodGet, adminJWT, nil, "communities", "testCommunity", "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingsResp struct {
+		Data []api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingsResp), qt.IsNil)
+	qt.Assert(t, bookingsResp.Data, qt.HasLen, 1)
+	qt.Assert(t, bookingsResp.Data[0].ID, qt.Equals, bookingID)
+	qt.Assert(t, bookingsResp.Data[0].Community, qt.Equals, "testCommunity")
+}
+
+func TestCommunityCrowdfunds(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	adminJWT, adminID := c.RegisterAndLoginWithID("admin@test.com", "admin", "adminpass")
+	c.MakeAdmin(adminID)
+	memberJWT, memberID := c.RegisterAndLoginWithID("member@test.com", "member", "memberpass")
+	otherJWT, otherID := c.RegisterAndLoginWithID("other@test.com", "other", "otherpass")
+	strangerJWT := c.RegisterAndLogin("stranger@test.com", "stranger", "strangerpass")
+	c.SetCommunity(strangerJWT, "otherCommunity")
+
+	tokens := func(jwt string) uint64 {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "profile")
+		qt.Assert(t, code, qt.Equals, 200)
+		var profileResp struct {
+			Data api.User `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &profileResp), qt.IsNil)
+		return profileResp.Data.Tokens
+	}
+	crowdfund := func(resp []byte) api.Crowdfund {
+		var crowdfundResp struct {
+			Data api.Crowdfund `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &crowdfundResp), qt.IsNil)
+		return crowdfundResp.Data
+	}
+	newCrowdfund := func(jwt string) (string, int) {
+		resp, code := c.Request(http.MethodPost, jwt,
+			map[string]interface{}{
+				"title":          "Wood chipper",
+				"description":    "A chipper for the community gardens",
+				"estimatedValue": 300,
+				"goal":           100,
+			},
+			"communities", "testCommunity", "crowdfunds")
+		if code != 200 {
+			return "", code
+		}
+		return crowdfund(resp).ID, code
+	}
+	pledge := func(jwt, id string, amount uint64) ([]byte, int) {
+		return c.Request(http.MethodPost, jwt, map[string]interface{}{"amount": amount},
+			"communities", "testCommunity", "crowdfunds", id, "pledge")
+	}
+	toolBody := map[string]interface{}{
+		"mayBeFree":  false,
+		"askWithFee": true,
+		"cost":       5,
+		"location": map[string]interface{}{
+			"latitude":  41695384,
+			"longitude": 2492793,
+		},
+	}
+
+	// Only the members start crowdfunds
+	_, code := newCrowdfund(strangerJWT)
+	qt.Assert(t, code, qt.Equals, 403)
+	id, code := newCrowdfund(memberJWT)
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// The pledges take the tokens of the members, up to the goal
+	resp, code := pledge(memberJWT, id, 0)
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "crowdfund.invalid_pledge")
+	_, code = pledge(strangerJWT, id, 10)
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = pledge(memberJWT, id, 30)
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = pledge(memberJWT, id, 30)
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = pledge(otherJWT, id, 50)
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "crowdfund.conflict")
+	resp, code = pledge(otherJWT, id, 30)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, crowdfund(resp).Pledged, qt.Equals, uint64(90))
+	qt.Assert(t, crowdfund(resp).Contributions, qt.HasLen, 3)
+	qt.Assert(t, tokens(memberJWT), qt.Equals, uint64(940))
+	qt.Assert(t, tokens(otherJWT), qt.Equals, uint64(970))
+
+	// Withdrawing gives the tokens back
+	resp, code = c.Request(http.MethodDelete, otherJWT, nil, "communities", "testCommunity", "crowdfunds", id, "pledge")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, crowdfund(resp).Pledged, qt.Equals, uint64(60))
+	qt.Assert(t, tokens(otherJWT), qt.Equals, uint64(1000))
+
+	// Only the admins complete the crowdfunds, once the goal is reached
+	resp, code = c.Request(http.MethodPost, adminJWT, toolBody, "communities", "testCommunity", "crowdfunds", id, "complete")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "crowdfund.goal_not_reached")
+	_, code = pledge(otherJWT, id, 40)
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodPost, memberJWT, toolBody, "communities", "testCommunity", "crowdfunds", id, "complete")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = c.Request(http.MethodPost, adminJWT, toolBody, "communities", "testCommunity", "crowdfunds", id, "complete")
+	qt.Assert(t, code, qt.Equals, 200)
+	completed := crowdfund(resp)
+	qt.Assert(t, completed.Status, qt.Equals, string(db.CrowdfundCompleted))
+	qt.Assert(t, completed.ToolID, qt.Not(qt.Equals), int64(0))
+	_, code = pledge(otherJWT, id, 1)
+	qt.Assert(t, code, qt.Equals, 409)
+
+	// The tool is shared by the community, with its contributors, and the tokens go to its pool
+	resp, code = c.Request(http.MethodGet, memberJWT, nil, "tools", fmt.Sprint(completed.ToolID))
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.Title, qt.Equals, "Wood chipper")
+	qt.Assert(t, toolResp.Data.Community, qt.Equals, "testCommunity")
+	qt.Assert(t, toolResp.Data.Contributors, qt.DeepEquals, []api.ToolContributor{
+		{UserID: memberID, Amount: 60},
+		{UserID: otherID, Amount: 40},
+	})
+	resp, code = c.Request(http.MethodGet, memberJWT, nil, "communities", "testCommunity", "pool")
+	qt.Assert(t, code, qt.Equals, 200)
+	var poolResp struct {
+		Data api.CommunityPool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &poolResp), qt.IsNil)
+	qt.Assert(t, poolResp.Data.Tokens, qt.Equals, uint64(100))
+
+	// Cancelling gives the pledges back, only the creator or the admins cancel
+	id, code = newCrowdfund(memberJWT)
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = pledge(otherJWT, id, 25)
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodPost, otherJWT, nil, "communities", "testCommunity", "crowdfunds", id, "cancel")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = c.Request(http.MethodPost, memberJWT, nil, "communities", "testCommunity", "crowdfunds", id, "cancel")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, crowdfund(resp).Status, qt.Equals, string(db.CrowdfundCancelled))
+	qt.Assert(t, tokens(otherJWT), qt.Equals, uint64(960))
+
+	resp, code = c.Request(http.MethodGet, memberJWT, nil, "communities", "testCommunity", "crowdfunds?status=open")
+	qt.Assert(t, code, qt.Equals, 200)
+	var listResp struct {
+		Data api.CrowdfundsWrapper `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &listResp), qt.IsNil)
+	qt.Assert(t, listResp.Data.Crowdfunds, qt.HasLen, 0)
+	resp, code = c.Request(http.MethodGet, memberJWT, nil, "communities", "testCommunity", "crowdfunds")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &listResp), qt.IsNil)
+	qt.Assert(t, listResp.Data.Crowdfunds, qt.HasLen, 2)
+}
+
+func TestCommunityPoolFees(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	adminJWT, adminID := c.RegisterAndLoginWithID("admin@test.com", "admin", "adminpass")
+	c.MakeAdmin(adminID)
+	ownerJWT, ownerID := c.RegisterAndLoginWithID("owner@test.com", "owner", "ownerpass")
+	renterJWT, renterID := c.RegisterAndLoginWithID("renter@test.com", "renter", "renterpass")
+	strangerJWT, strangerID := c.RegisterAndLoginWithID("stranger@test.com", "stranger", "strangerpass")
+	c.SetCommunity(strangerJWT, "otherCommunity")
+
+	tokens := func(jwt string) uint64 {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "profile")
+		qt.Assert(t, code, qt.Equals, 200)
+		var profileResp struct {
+			Data api.User `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &profileResp), qt.IsNil)
+		return profileResp.Data.Tokens
+	}
+	pool := func() api.CommunityPool {
+		resp, code := c.Request(http.MethodGet, ownerJWT, nil, "communities", "testCommunity", "pool")
+		qt.Assert(t, code, qt.Equals, 200)
+		var poolResp struct {
+			Data api.CommunityPool `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &poolResp), qt.IsNil)
+		return poolResp.Data
+	}
+	movements := func(query string) []api.PoolMovement {
+		resp, code := c.Request(http.MethodGet, ownerJWT, nil, "communities", "testCommunity", "pool", "movements"+query)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var movementsResp struct {
+			Data []api.PoolMovement `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &movementsResp), qt.IsNil)
+		return movementsResp.Data
+	}
+
+	// Only the admins set the fee, up to 10 tokens
+	setFee := func(jwt string, fee int) ([]byte, int) {
+		return c.Request(http.MethodPut, jwt, map[string]interface{}{"fee": fee}, "communities", "testCommunity", "pool", "fee")
+	}
+	resp, code := setFee(ownerJWT, 5)
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = setFee(adminJWT, 20)
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "pool.invalid_fee")
+	resp, code = setFee(adminJWT, 5)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	qt.Assert(t, pool().Fee, qt.Equals, uint64(5))
+
+	// The renter pays the fee to the pool when the booking of a member tool is returned
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Member drill"))
+	resp, code = c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+		"toolId":    toolID,
+		"startDate": time.Now().Add(24 * time.Hour).Unix(),
+		"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+		"contact":   "renter@test.com",
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	bookingID := bookingResp.Data.ID
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", bookingID, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, pool().Tokens, qt.Equals, uint64(0))
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", bookingID, "return")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, tokens(renterJWT), qt.Equals, uint64(995))
+	qt.Assert(t, pool().Tokens, qt.Equals, uint64(5))
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "bookings", bookingID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	qt.Assert(t, bookingResp.Data.CommunityFee, qt.Equals, uint64(5))
+	fees := movements("?kind=fee")
+	qt.Assert(t, fees, qt.HasLen, 1)
+	qt.Assert(t, fees[0].Amount, qt.Equals, uint64(5))
+	qt.Assert(t, fees[0].UserID, qt.Equals, renterID)
+	qt.Assert(t, fees[0].BookingID, qt.Equals, bookingID)
+
+	// Only the admins pay the members, not themselves nor other communities, within the pool
+	payout := func(jwt, userID string, amount int, reason string) ([]byte, int) {
+		return c.Request(http.MethodPost, jwt, map[string]interface{}{
+			"userId": userID,
+			"amount": amount,
+			"reason": reason,
+		}, "communities", "testCommunity", "pool", "payouts")
+	}
+	_, code = payout(ownerJWT, ownerID, 3, "Drill bits")
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = payout(adminJWT, adminID, 3, "Drill bits")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = payout(adminJWT, strangerID, 3, "Drill bits")
+	qt.Assert(t, code, qt.Equals, 403)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "community.not_member")
+	resp, code = payout(adminJWT, ownerID, 3, " ")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "pool.invalid_payout")
+	resp, code = payout(adminJWT, ownerID, 10, "Drill bits")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "pool.not_enough_tokens")
+	resp, code = payout(adminJWT, ownerID, 3, "Drill bits")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	qt.Assert(t, tokens(ownerJWT), qt.Equals, uint64(1003))
+	qt.Assert(t, pool().Tokens, qt.Equals, uint64(2))
+
+	history := movements("")
+	qt.Assert(t, history, qt.HasLen, 2)
+	qt.Assert(t, history[0].Kind, qt.Equals, string(db.PoolMovementPayout))
+	qt.Assert(t, history[0].UserID, qt.Equals, ownerID)
+	qt.Assert(t, history[0].CreatedBy, qt.Equals, adminID)
+	qt.Assert(t, history[0].Reason, qt.Equals, "Drill bits")
+	_, code = c.Request(http.MethodGet, strangerJWT, nil, "communities", "testCommunity", "pool", "movements")
+	qt.Assert(t, code, qt.Equals, 403)
+}
+
+func TestCommunityStats(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	ownerJWT, ownerID := c.RegisterAndLoginWithID("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	strangerJWT := c.RegisterAndLogin("stranger@test.com", "stranger", "strangerpass")
+	for _, jwt := range []string{ownerJWT, renterJWT} {
+		c.SetCommunity(jwt, "statsCommunity")
+	}
+	toolID := c.CreateTool(ownerJWT, "Ladder")
+	c.CreateTool(ownerJWT, "Drill")
+
+	// A booking between members is returned
+	resp, code := c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+		"toolId":    fmt.Sprint(toolID),
+		"startDate": time.Now().Add(24 * time.Hour).Unix(),
+		"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", bookingResp.Data.ID, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", bookingResp.Data.ID, "return")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// Only members can see the stats
+	resp, code = c.Request(http.MethodGet, strangerJWT, nil, "communities", "statsCommunity", "stats")
+	qt.Assert(t, code, qt.Equals, 403)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "community.not_member")
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "communities", "statsCommunity", "stats")
+	qt.Assert(t, code, qt.Equals, 200)
+	var statsResp struct {
+		Data api.CommunityStatsResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &statsResp), qt.IsNil)
+	stats := statsResp.Data
+	qt.Assert(t, stats.Members, qt.Equals, int64(2))
+	qt.Assert(t, stats.MemberGrowth, qt.HasLen, 1)
+	qt.Assert(t, stats.MemberGrowth[0].Count, qt.Equals, int64(2))
+	qt.Assert(t, stats.ToolsShared, qt.Equals, int64(2))
+	qt.Assert(t, stats.BookingsCompleted, qt.Equals, int64(1))
+	qt.Assert(t, stats.EstimatedSavings, qt.Equals, uint64(20))
+	qt.Assert(t, stats.MostActive, qt.HasLen, 2)
+	ids := []string{stats.MostActive[0].ID, stats.MostActive[1].ID}
+	qt.Assert(t, ids, qt.Contains, ownerID)
+}
+
+func TestCommunityLibrary(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	adminJWT, adminID := c.RegisterAndLoginWithID("admin@test.com", "admin", "adminpass")
+	c.MakeAdmin(adminID)
+	memberJWT, memberID := c.RegisterAndLoginWithID("member@test.com", "member", "memberpass")
+	otherJWT := c.RegisterAndLogin("other@test.com", "other", "otherpass")
+
+	resp, code := c.Request(http.MethodPost, adminJWT,
+		map[string]interface{}{
+			"title":          "Library drill",
+			"description":    "Shared by the community",
+			"cost":           10,
+			"estimatedValue": 100,
+			"community":      "testCommunity",
+			"location": map[string]interface{}{
+				"latitude":  41695384,
+				"longitude": 2492793,
+			},
+		},
+		"tools",
+	)
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.ToolID `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	toolID := toolResp.Data.ID
+
+	// Only the community admins register the asset tags
+	tag := map[string]interface{}{"toolId": toolID, "assetTag": "LIB-0001"}
+	_, code = c.Request(http.MethodPost, memberJWT, tag, "communities", "testCommunity", "library", "tags")
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = c.Request(http.MethodPost, adminJWT, tag, "communities", "testCommunity", "library", "tags")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	resp, code = c.Request(http.MethodGet, memberJWT, nil, "communities", "testCommunity", "library", "tags", "LIB-0001")
+	qt.Assert(t, code, qt.Equals, 200)
+	var getToolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &getToolResp), qt.IsNil)
+	qt.Assert(t, getToolResp.Data.ID, qt.Equals, toolID)
+	qt.Assert(t, getToolResp.Data.AssetTag, qt.IsNil)
+	// The exact location is only shown to the owner and to renters with an accepted booking
+	qt.Assert(t, getToolResp.Data.Location, qt.Not(qt.Equals), api.Location{Latitude: 41695384, Longitude: 2492793})
+	_, code = c.Request(http.MethodGet, memberJWT, nil, "communities", "testCommunity", "library", "tags", "LIB-0002")
+	qt.Assert(t, code, qt.Equals, 404)
+
+	// The identifiers are only shown to the community admins
+	resp, code = c.Request(http.MethodGet, adminJWT, nil, "communities", "testCommunity", "library", "tags", "LIB-0001")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &getToolResp), qt.IsNil)
+	qt.Assert(t, getToolResp.Data.AssetTag, qt.IsNotNil)
+	qt.Assert(t, *getToolResp.Data.AssetTag, qt.Equals, "LIB-0001")
+	qt.Assert(t, getToolResp.Data.Location, qt.Equals, api.Location{Latitude: 41695384, Longitude: 2492793})
+
+	// Checking out creates an accepted booking, paid to the community pool
+	checkout := func(jwt string) ([]byte, int) {
+		return c.Request(http.MethodPost, jwt, map[string]interface{}{
+			"assetTag": "LIB-0001",
+			"endDate":  time.Now().Add(48 * time.Hour).Unix(),
+		}, "communities", "testCommunity", "library", "checkout")
+	}
+	resp, code = checkout(memberJWT)
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	qt.Assert(t, bookingResp.Data.FromUserID, qt.Equals, memberID)
+	qt.Assert(t, bookingResp.Data.BookingStatus, qt.Equals, "ACCEPTED")
+	qt.Assert(t, bookingResp.Data.Origin, qt.Equals, "LIBRARY")
+	bookingID := bookingResp.Data.ID
+
+	resp, code = c.Request(http.MethodGet, memberJWT, nil, "communities", "testCommunity", "pool")
+	qt.Assert(t, code, qt.Equals, 200)
+	var poolResp struct {
+		Data api.CommunityPool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &poolResp), qt.IsNil)
+	qt.Assert(t, poolResp.Data.Tokens, qt.Equals, uint64(20))
+
+	// The tool cannot be checked out twice
+	_, code = checkout(otherJWT)
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// Only the renter or the community admins check it in
+	checkin := map[string]interface{}{"assetTag": "LIB-0001"}
+	_, code = c.Request(http.MethodPost, otherJWT, checkin, "communities", "testCommunity", "library", "checkin")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = c.Request(http.MethodPost, memberJWT, checkin, "communities", "testCommunity", "library", "checkin")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	qt.Assert(t, bookingResp.Data.ID, qt.Equals, bookingID)
+	qt.Assert(t, bookingResp.Data.BookingStatus, qt.Equals, "RETURNED")
+
+	resp, code = c.Request(http.MethodPost, adminJWT, checkin, "communities", "testCommunity", "library", "checkin")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "library.not_checked_out")
+}
+
+func TestCommunityToolApproval(t *testing.T) {
+	c := utils.NewTestService(t, func(opts *api.Options) {
+		opts.CommunityToolApproval = true
+	})
+
+	adminJWT, adminID := c.RegisterAndLoginWithID("admin@test.com", "admin", "adminpass")
+	c.MakeAdmin(adminID)
+	memberJWT := c.RegisterAndLogin("member@test.com", "member", "memberpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+
+	share := func(jwt, title string) int64 {
+		resp, code := c.Request(http.MethodPost, jwt,
+			map[string]interface{}{
+				"title":          title,
+				"description":    "Shared with the community",
+				"mayBeFree":      true,
+				"askWithFee":     false,
+				"cost":           0,
+				"estimatedValue": 100,
+				"community":      "testCommunity",
+				"location": map[string]interface{}{
+					"latitude":  41695384,
+					"longitude": 2492793,
+				},
+			},
+			"tools",
+		)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var toolResp struct {
+			Data api.ToolID `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+		return toolResp.Data.ID
+	}
+	search := func() []string {
+		resp, code := c.Request(http.MethodGet, renterJWT, nil, "tools/search")
+		qt.Assert(t, code, qt.Equals, 200)
+		var searchResp struct {
+			Data api.ToolSearchResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &searchResp), qt.IsNil)
+		titles := []string{}
+		for _, tool := range searchResp.Data.Tools {
+			titles = append(titles, tool.Title)
+		}
+		slices.Sort(titles)
+		return titles
+	}
+	lastNotification := func(jwt string) *api.Notification {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "profile", "notifications")
+		qt.Assert(t, code, qt.Equals, 200)
+		var notificationsResp struct {
+			Data api.NotificationsWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &notificationsResp), qt.IsNil)
+		qt.Assert(t, notificationsResp.Data.Notifications, qt.Not(qt.HasLen), 0)
+		return notificationsResp.Data.Notifications[0]
+	}
+
+	// The tools shared by the members wait for the approval, the ones of the admins do not
+	mixerID := share(memberJWT, "Cement mixer")
+	sawID := share(memberJWT, "Chainsaw")
+	share(adminJWT, "Scaffolding")
+	qt.Assert(t, search(), qt.DeepEquals, []string{"Scaffolding"})
+	resp, code := c.Request(http.MethodGet, memberJWT, nil, "tools", fmt.Sprint(mixerID))
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.PendingApproval, qt.IsTrue)
+	resp, code = c.Request(http.MethodPost, renterJWT,
+		map[string]interface{}{
+			"toolId":    fmt.Sprint(mixerID),
+			"startDate": time.Now().Add(24 * time.Hour).Unix(),
+			"endDate":   time.Now().Add(72 * time.Hour).Unix(),
+			"contact":   "renter@test.com",
+		},
+		"bookings",
+	)
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.pending_approval")
+
+	// Only the community admins see the pending tools
+	_, code = c.Request(http.MethodGet, memberJWT, nil, "communities", "testCommunity", "tools", "pending")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = c.Request(http.MethodGet, adminJWT, nil, "communities", "testCommunity", "tools", "pending")
+	qt.Assert(t, code, qt.Equals, 200)
+	var pendingResp struct {
+		Data []api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &pendingResp), qt.IsNil)
+	qt.Assert(t, pendingResp.Data, qt.HasLen, 2)
+	qt.Assert(t, pendingResp.Data[0].ID, qt.Equals, mixerID)
+
+	_, code = c.Request(http.MethodPut, memberJWT, nil, "communities", "testCommunity", "tools", fmt.Sprint(mixerID), "approve")
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = c.Request(http.MethodPut, adminJWT, nil, "communities", "testCommunity", "tools", fmt.Sprint(mixerID), "approve")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodPut, adminJWT, nil, "communities", "testCommunity", "tools", fmt.Sprint(mixerID), "approve")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.not_pending_approval")
+	qt.Assert(t, search(), qt.DeepEquals, []string{"Cement mixer", "Scaffolding"})
+	notification := lastNotification(memberJWT)
+	qt.Assert(t, notification.Type, qt.Equals, "TOOL_APPROVAL")
+	qt.Assert(t, notification.ToolID, qt.Equals, mixerID)
+
+	// The rejected tools go back to the member, unavailable
+	_, code = c.Request(http.MethodPut, adminJWT, map[string]interface{}{"reason": "We already have one"},
+		"communities", "testCommunity", "tools", fmt.Sprint(sawID), "reject")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodGet, memberJWT, nil, "tools", fmt.Sprint(sawID))
+	qt.Assert(t, code, qt.Equals, 200)
+	toolResp.Data = api.Tool{}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.PendingApproval, qt.IsFalse)
+	qt.Assert(t, toolResp.Data.Community, qt.Equals, "")
+	qt.Assert(t, *toolResp.Data.IsAvailable, qt.IsFalse)
+	qt.Assert(t, lastNotification(memberJWT).Message, qt.Contains, "We already have one")
+	qt.Assert(t, search(), qt.DeepEquals, []string{"Cement mixer", "Scaffolding"})
+}
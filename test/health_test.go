@@ -0,0 +1,31 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/emprius/emprius-app-backend/api"
+	"github.com/emprius/emprius-app-backend/test/utils"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestHealth(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	resp, header, code := c.HeaderRequest(http.MethodGet, "", nil, "healthz")
+	qt.Assert(t, code, qt.Equals, http.StatusOK)
+	qt.Assert(t, header.Get("Cache-Control"), qt.Equals, "no-store")
+	var health api.HealthResponse
+	qt.Assert(t, json.Unmarshal(resp, &health), qt.IsNil)
+	qt.Assert(t, health.Status, qt.Equals, "ok")
+
+	// The database is reachable and has all the indexes
+	resp, _, code = c.HeaderRequest(http.MethodGet, "", nil, "readyz")
+	qt.Assert(t, code, qt.Equals, http.StatusOK)
+	qt.Assert(t, json.Unmarshal(resp, &health), qt.IsNil)
+	qt.Assert(t, health.Status, qt.Equals, "ok")
+	qt.Assert(t, health.Checks["mongodb"].Status, qt.Equals, "ok")
+	qt.Assert(t, health.Checks["indexes"].Status, qt.Equals, "ok")
+	qt.Assert(t, health.Checks["smtp"], qt.IsNil)
+}
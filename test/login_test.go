@@ -1,11 +1,14 @@
 package test
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/emprius/emprius-app-backend/api"
+	"github.com/emprius/emprius-app-backend/password"
 	"github.com/emprius/emprius-app-backend/test/utils"
 	qt "github.com/frankban/quicktest"
 )
@@ -68,3 +71,184 @@ func TestLogin(t *testing.T) {
 	err := json.Unmarshal(resp, logResp)
 	qt.Assert(t, err, qt.IsNil)
 }
+
+func TestSessions(t *testing.T) {
+	c := utils.NewTestService(t)
+	jwt := c.RegisterAndLogin("sessions@test.com", "sessions", "sessionspass")
+
+	login := func() string {
+		resp, code := c.Request(http.MethodPost, "", &api.Login{Email: "sessions@test.com", Password: "sessionspass"}, "login")
+		qt.Assert(t, code, qt.Equals, 200)
+		var loginResp struct {
+			Data api.LoginResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &loginResp), qt.IsNil)
+		return loginResp.Data.Token
+	}
+	getSessions := func(jwt string) []*api.Session {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "profile", "sessions")
+		qt.Assert(t, code, qt.Equals, 200)
+		var sessionsResp struct {
+			Data api.SessionsWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &sessionsResp), qt.IsNil)
+		return sessionsResp.Data.Sessions
+	}
+
+	// The registration and each login open a session
+	other := login()
+	sessions := getSessions(jwt)
+	qt.Assert(t, sessions, qt.HasLen, 3)
+	current := 0
+	for _, session := range sessions {
+		qt.Assert(t, session.IP, qt.Not(qt.Equals), "")
+		if session.Current {
+			current++
+		}
+	}
+	qt.Assert(t, current, qt.Equals, 1)
+
+	// A closed session no longer accepts its token, even refreshed
+	var otherID string
+	for _, session := range getSessions(other) {
+		if session.Current {
+			otherID = session.ID
+		}
+	}
+	resp, code := c.Request(http.MethodGet, other, nil, "refresh")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", resp))
+	var refreshResp struct {
+		Data api.LoginResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &refreshResp), qt.IsNil)
+	_, code = c.Request(http.MethodDelete, jwt, nil, "profile", "sessions", otherID)
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodGet, other, nil, "profile")
+	qt.Assert(t, code, qt.Equals, 401)
+	_, code = c.Request(http.MethodGet, refreshResp.Data.Token, nil, "profile")
+	qt.Assert(t, code, qt.Equals, 401)
+	qt.Assert(t, getSessions(jwt), qt.HasLen, 2)
+
+	resp, code = c.Request(http.MethodDelete, jwt, nil, "profile", "sessions", otherID)
+	qt.Assert(t, code, qt.Equals, 404)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "auth.session_not_found")
+}
+
+func TestLoginLockout(t *testing.T) {
+	c := utils.NewTestService(t)
+	c.RegisterAndLogin("lockout@test.com", "lockout", "lockoutpass")
+
+	login := func(password string) ([]byte, int) {
+		return c.Request(http.MethodPost, "", &api.Login{Email: "lockout@test.com", Password: password}, "login")
+	}
+
+	// The failures before the maximum are plain wrong logins
+	for i := 0; i < 4; i++ {
+		resp, code := login("wrongpass")
+		qt.Assert(t, code, qt.Equals, 400)
+		qt.Assert(t, c.ErrorCode(resp), qt.Equals, "auth.invalid_credentials")
+	}
+	// The fifth failure locks the account, with the end of the lockout
+	resp, code := login("wrongpass")
+	qt.Assert(t, code, qt.Equals, 429)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "auth.login_locked")
+	var lockedResp struct {
+		Data api.LoginLocked `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &lockedResp), qt.IsNil)
+	qt.Assert(t, lockedResp.Data.LockedUntil.After(time.Now()), qt.IsTrue)
+
+	// While locked, even the right password is rejected
+	resp, code = login("lockoutpass")
+	qt.Assert(t, code, qt.Equals, 429)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "auth.login_locked")
+
+	// Other accounts can still log in from the same IP
+	c.RegisterAndLogin("other@test.com", "other", "otherpass")
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	c := utils.NewTestService(t, func(opts *api.Options) {
+		opts.PasswordPolicy = &password.DefaultPolicy
+	})
+
+	// The policy is public
+	resp, code := c.Request(http.MethodGet, "", nil, "info", "password-policy")
+	qt.Assert(t, code, qt.Equals, 200)
+	var policyResp struct {
+		Data password.Policy `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &policyResp), qt.IsNil)
+	qt.Assert(t, policyResp.Data, qt.DeepEquals, password.DefaultPolicy)
+
+	register := func(pw string) ([]byte, int) {
+		return c.Request(http.MethodPost, "",
+			&api.Register{
+				UserEmail:         "maria@test.com",
+				RegisterAuthToken: utils.RegisterToken,
+				UserProfile: api.UserProfile{
+					Name:     "maria",
+					Password: pw,
+				},
+			},
+			"register",
+		)
+	}
+	violations := func(resp []byte) []string {
+		var errResp struct {
+			Data api.PasswordViolations `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &errResp), qt.IsNil)
+		codes := []string{}
+		for _, v := range errResp.Data.Violations {
+			codes = append(codes, v.Code)
+		}
+		return codes
+	}
+
+	// Each violation of the policy is returned
+	resp, code = register("letmein")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "auth.weak_password")
+	qt.Assert(t, violations(resp), qt.DeepEquals, []string{password.TooShort, password.Common})
+	resp, code = register("maria1234")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, violations(resp), qt.DeepEquals, []string{password.Weak})
+
+	resp, code = register("correct horse battery staple")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", resp))
+	var registerResp struct {
+		Data api.LoginResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &registerResp), qt.IsNil)
+
+	// The password changes follow the policy too
+	version := c.ProfileVersion(registerResp.Data.Token)
+	resp, code = c.Request(http.MethodPost, registerResp.Data.Token,
+		&api.UserProfile{Password: "qwerty123", Version: &version}, "profile")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "auth.weak_password")
+}
+
+func TestPasswordRehash(t *testing.T) {
+	c := utils.NewTestService(t)
+	_, userID := c.RegisterAndLoginWithID("rehash@test.com", "rehash", "rehashpass")
+	qt.Assert(t, password.IsArgon2id(c.UserPassword(userID)), qt.IsTrue)
+
+	// The hashes of the legacy scheme (salted SHA-256) are replaced on the first login
+	c.SetUserPassword(userID, sha256.New().Sum([]byte("emprius"+"rehashpass")))
+	resp, code := c.Request(http.MethodPost, "", &api.Login{Email: "rehash@test.com", Password: "wrongpass"}, "login")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "auth.invalid_credentials")
+	qt.Assert(t, password.IsArgon2id(c.UserPassword(userID)), qt.IsFalse)
+
+	_, code = c.Request(http.MethodPost, "", &api.Login{Email: "rehash@test.com", Password: "rehashpass"}, "login")
+	qt.Assert(t, code, qt.Equals, 200)
+	hash := c.UserPassword(userID)
+	qt.Assert(t, password.IsArgon2id(hash), qt.IsTrue)
+
+	// Once rehashed, the hash is kept
+	_, code = c.Request(http.MethodPost, "", &api.Login{Email: "rehash@test.com", Password: "rehashpass"}, "login")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, c.UserPassword(userID), qt.DeepEquals, hash)
+}
@@ -0,0 +1,294 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emprius/emprius-app-backend/api"
+	"github.com/emprius/emprius-app-backend/mail"
+	"github.com/emprius/emprius-app-backend/test/utils"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDirectMessages(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	aliceJWT, aliceID := c.RegisterAndLoginWithID("alice@test.com", "alice", "alicepass")
+	bobJWT, bobID := c.RegisterAndLoginWithID("bob@test.com", "bob", "bobpass")
+	strangerJWT, strangerID := c.RegisterAndLoginWithID("stranger@test.com", "stranger", "strangerpass")
+	c.SetCommunity(strangerJWT, "otherCommunity")
+
+	send := func(jwt, to, text string) (*api.Message, []byte, int) {
+		resp, code := c.Request(http.MethodPost, jwt, &api.MessageRequest{Text: text}, "messages", to)
+		var messageResp struct {
+			Data *api.Message `json:"data"`
+		}
+		if code == 200 {
+			qt.Assert(t, json.Unmarshal(resp, &messageResp), qt.IsNil)
+		}
+		return messageResp.Data, resp, code
+	}
+	conversations := func(jwt string) api.ConversationsWrapper {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "messages")
+		qt.Assert(t, code, qt.Equals, 200)
+		var conversationsResp struct {
+			Data api.ConversationsWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &conversationsResp), qt.IsNil)
+		return conversationsResp.Data
+	}
+
+	t.Run("Members", func(t *testing.T) {
+		message, _, code := send(aliceJWT, bobID, "Hi Bob, is the ladder free on Saturday?")
+		qt.Assert(t, code, qt.Equals, 200)
+		qt.Assert(t, message.FromUserID, qt.Equals, aliceID)
+		_, _, code = send(aliceJWT, bobID, "I would bring it back on Sunday")
+		qt.Assert(t, code, qt.Equals, 200)
+		_, resp, code := send(aliceJWT, bobID, "  ")
+		qt.Assert(t, code, qt.Equals, 422)
+		qt.Assert(t, c.ErrorCode(resp), qt.Equals, "message.invalid")
+
+		// Bob is notified once of the unread messages
+		resp, code = c.Request(http.MethodGet, bobJWT, nil, "profile", "notifications")
+		qt.Assert(t, code, qt.Equals, 200)
+		var notificationsResp struct {
+			Data api.NotificationsWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &notificationsResp), qt.IsNil)
+		messageNotifications := 0
+		for _, notification := range notificationsResp.Data.Notifications {
+			if notification.Type == "DIRECT_MESSAGE" {
+				messageNotifications++
+			}
+		}
+		qt.Assert(t, messageNotifications, qt.Equals, 1)
+
+		list := conversations(bobJWT)
+		qt.Assert(t, list.Unread, qt.Equals, int64(2))
+		qt.Assert(t, list.Conversations, qt.HasLen, 1)
+		qt.Assert(t, list.Conversations[0].User.ID, qt.Equals, aliceID)
+		qt.Assert(t, list.Conversations[0].User.Name, qt.Equals, "alice")
+		qt.Assert(t, list.Conversations[0].LastMessage.Text, qt.Equals, "I would bring it back on Sunday")
+
+		// Reading the conversation marks the messages as read
+		resp, code = c.Request(http.MethodGet, bobJWT, nil, "messages", aliceID)
+		qt.Assert(t, code, qt.Equals, 200)
+		var messagesResp struct {
+			Data api.MessagesWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &messagesResp), qt.IsNil)
+		qt.Assert(t, messagesResp.Data.Messages, qt.HasLen, 2)
+		qt.Assert(t, messagesResp.Data.Messages[0].Text, qt.Equals, "I would bring it back on Sunday")
+		qt.Assert(t, conversations(bobJWT).Unread, qt.Equals, int64(0))
+	})
+
+	t.Run("Strangers", func(t *testing.T) {
+		_, resp, code := send(strangerJWT, aliceID, "Hello")
+		qt.Assert(t, code, qt.Equals, 403)
+		qt.Assert(t, c.ErrorCode(resp), qt.Equals, "message.not_allowed")
+
+		// A booking request allows the two users to message each other
+		toolID := c.CreateTool(aliceJWT, "Drill")
+		_, code = c.Request(http.MethodPost, strangerJWT, map[string]interface{}{
+			"toolId":    fmt.Sprint(toolID),
+			"startDate": time.Now().Add(24 * time.Hour).Unix(),
+			"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+			"contact":   "stranger@test.com",
+		}, "bookings")
+		qt.Assert(t, code, qt.Equals, 200)
+		_, _, code = send(strangerJWT, aliceID, "Hello, I requested your drill")
+		qt.Assert(t, code, qt.Equals, 200)
+		_, _, code = send(aliceJWT, strangerID, "Hello, come by any time")
+		qt.Assert(t, code, qt.Equals, 200)
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		_, code := c.Request(http.MethodPost, bobJWT, nil, "users", aliceID, "block")
+		qt.Assert(t, code, qt.Equals, 200)
+		_, resp, code := send(aliceJWT, bobID, "Are you there?")
+		qt.Assert(t, code, qt.Equals, 403)
+		qt.Assert(t, c.ErrorCode(resp), qt.Equals, "message.blocked")
+		_, _, code = send(bobJWT, aliceID, "Bye")
+		qt.Assert(t, code, qt.Equals, 403)
+
+		resp, code = c.Request(http.MethodGet, bobJWT, nil, "profile", "blocked")
+		qt.Assert(t, code, qt.Equals, 200)
+		var blockedResp struct {
+			Data api.ContactsWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &blockedResp), qt.IsNil)
+		qt.Assert(t, blockedResp.Data.Users, qt.HasLen, 1)
+		qt.Assert(t, blockedResp.Data.Users[0].ID, qt.Equals, aliceID)
+
+		_, code = c.Request(http.MethodDelete, bobJWT, nil, "users", aliceID, "block")
+		qt.Assert(t, code, qt.Equals, 200)
+		resp, code = c.Request(http.MethodDelete, bobJWT, nil, "users", aliceID, "block")
+		qt.Assert(t, code, qt.Equals, 404)
+		qt.Assert(t, c.ErrorCode(resp), qt.Equals, "user.not_blocked")
+		_, _, code = send(aliceJWT, bobID, "Are you there?")
+		qt.Assert(t, code, qt.Equals, 200)
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		// Alice sent 4 messages in the previous tests
+		for i := 4; i < 30; i++ {
+			_, _, code := send(aliceJWT, bobID, fmt.Sprintf("Message %d", i))
+			qt.Assert(t, code, qt.Equals, 200)
+		}
+		_, resp, code := send(aliceJWT, bobID, "One too many")
+		qt.Assert(t, code, qt.Equals, 429)
+		qt.Assert(t, c.ErrorCode(resp), qt.Equals, "message.too_many")
+	})
+}
+
+// recordingMailer keeps the emails sent by the service.
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []*mail.Message
+}
+
+func (m *recordingMailer) Send(_ context.Context, msg *mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// last returns the last email sent to the address.
+func (m *recordingMailer) last(to string) *mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i]
+		}
+	}
+	return nil
+}
+
+func TestBookingEmailReplies(t *testing.T) {
+	mailer := &recordingMailer{}
+	c := utils.NewTestService(t, func(opts *api.Options) {
+		opts.Mailer = mailer
+		opts.InboundAddress = "replies@example.com"
+		opts.InboundMailToken = "inbound-token"
+	})
+	ownerJWT, ownerID := c.RegisterAndLoginWithID("owner@test.com", "owner", "ownerpass")
+	renterJWT, renterID := c.RegisterAndLoginWithID("renter@test.com", "renter", "renterpass")
+	strangerJWT := c.RegisterAndLogin("stranger@test.com", "stranger", "strangerpass")
+
+	// The owner follows the booking requests and messages by email
+	_, code := c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"BOOKING_REQUEST": map[string]bool{"inApp": true, "email": true},
+		"DIRECT_MESSAGE":  map[string]bool{"inApp": true, "email": true},
+	}, "profile", "notification-preferences")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	toolID := c.CreateTool(ownerJWT, "Ladder")
+	resp, code := c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+		"toolId":    fmt.Sprint(toolID),
+		"startDate": time.Now().Add(24 * time.Hour).Unix(),
+		"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+		"contact":   "renter@test.com",
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	bookingID := bookingResp.Data.ID
+
+	// The booking request email is answered to a reply address of the booking and the owner
+	request := mailer.last("owner@test.com")
+	qt.Assert(t, request, qt.IsNotNil)
+	qt.Assert(t, strings.HasPrefix(request.ReplyTo, "replies+"), qt.IsTrue, qt.Commentf("reply-to: %s", request.ReplyTo))
+	qt.Assert(t, strings.HasSuffix(request.ReplyTo, "@example.com"), qt.IsTrue)
+
+	inbound := func(token string, mail *api.InboundMail) (*api.Message, []byte, int) {
+		resp, _, code := c.JSONHeaderRequest(http.MethodPost, "", mail,
+			http.Header{"X-Inbound-Token": []string{token}}, "mail", "inbound")
+		var messageResp struct {
+			Data *api.Message `json:"data"`
+		}
+		if code == 200 {
+			qt.Assert(t, json.Unmarshal(resp, &messageResp), qt.IsNil)
+		}
+		return messageResp.Data, resp, code
+	}
+	reply := &api.InboundMail{
+		From: "Owner <Owner@test.com>",
+		To:   request.ReplyTo,
+		Text: "Sure, come by at 10.\n\nOn Mon, 3 Jun 2024 at 10:00, Emprius <" + request.ReplyTo + "> wrote:\n> New booking request\n",
+	}
+	_, _, code = inbound("wrong-token", reply)
+	qt.Assert(t, code, qt.Equals, 401)
+
+	message, resp, code := inbound("inbound-token", reply)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	qt.Assert(t, message, qt.IsNotNil)
+	qt.Assert(t, message.Text, qt.Equals, "Sure, come by at 10.")
+	qt.Assert(t, message.FromUserID, qt.Equals, ownerID)
+	qt.Assert(t, message.ToUserID, qt.Equals, renterID)
+	qt.Assert(t, message.BookingID, qt.Equals, bookingID)
+	qt.Assert(t, message.ViaEmail, qt.IsTrue)
+
+	// Replies not sent by the recipient of the email, or to a tampered address, are ignored
+	message, _, code = inbound("inbound-token", &api.InboundMail{From: "stranger@test.com", To: reply.To, Text: "Hi"})
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, message, qt.IsNil)
+	tampered := strings.Replace(reply.To, "replies+a", "replies+b", 1)
+	if tampered == reply.To {
+		tampered = strings.Replace(reply.To, "replies+", "replies+a", 1)
+	}
+	message, _, code = inbound("inbound-token", &api.InboundMail{From: reply.From, To: tampered, Text: "Hi"})
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, message, qt.IsNil)
+
+	// The renter answers in the booking thread, and the owner gets the text by email
+	resp, code = c.Request(http.MethodPost, renterJWT,
+		&api.MessageRequest{Text: "Great, see you", BookingID: bookingID}, "messages", ownerID)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	notification := mailer.last("owner@test.com")
+	qt.Assert(t, notification.Body, qt.Contains, "Great, see you")
+	qt.Assert(t, notification.ReplyTo, qt.Equals, request.ReplyTo)
+
+	// A form posted by the mail provider with the token as URL parameter
+	form := url.Values{
+		"sender":     {"owner@test.com"},
+		"recipient":  {request.ReplyTo},
+		"body-plain": {"Bring a bag too\n-- \nOwner"},
+	}
+	resp, code = c.RawRequest(http.MethodPost, "", "application/x-www-form-urlencoded", []byte(form.Encode()),
+		"mail", "inbound?token=inbound-token")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+
+	messages := func(jwt string) ([]*api.Message, int) {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "bookings", bookingID, "messages")
+		var messagesResp struct {
+			Data api.MessagesWrapper `json:"data"`
+		}
+		if code == 200 {
+			qt.Assert(t, json.Unmarshal(resp, &messagesResp), qt.IsNil)
+		}
+		return messagesResp.Data.Messages, code
+	}
+	thread, code := messages(renterJWT)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, thread, qt.HasLen, 3)
+	qt.Assert(t, thread[0].Text, qt.Equals, "Bring a bag too")
+	qt.Assert(t, thread[2].Text, qt.Equals, "Sure, come by at 10.")
+	_, code = messages(strangerJWT)
+	qt.Assert(t, code, qt.Not(qt.Equals), 200)
+
+	// Only the bookings between the two users can be used as thread
+	_, code = c.Request(http.MethodPost, strangerJWT,
+		&api.MessageRequest{Text: "Hi", BookingID: bookingID}, "messages", ownerID)
+	qt.Assert(t, code, qt.Equals, 403)
+}
@@ -29,6 +29,19 @@ func TestSync(t *testing.T) {
 		qt.Assert(t, syncResp.Data.Tools, qt.Equals, 0)
 		qt.Assert(t, len(syncResp.Data.Categories), qt.Not(qt.Equals), 0)
 		qt.Assert(t, len(syncResp.Data.Transports), qt.Not(qt.Equals), 0)
+		// The map and search defaults of the instance
+		qt.Assert(t, syncResp.Data.Search, qt.IsNotNil)
+		qt.Assert(t, syncResp.Data.Search.MapCenter.Latitude, qt.Not(qt.Equals), int64(0))
+		qt.Assert(t, syncResp.Data.Search.MaxRadius, qt.Equals, 0)
+		// The features, limits and versions the clients bootstrap with
+		qt.Assert(t, syncResp.Data.Features, qt.IsNotNil)
+		qt.Assert(t, syncResp.Data.Features.Federation, qt.IsFalse)
+		qt.Assert(t, syncResp.Data.Limits.DefaultPageSize, qt.Equals, 16)
+		qt.Assert(t, syncResp.Data.Limits.MaxPageSize, qt.Equals, 100)
+		qt.Assert(t, syncResp.Data.PasswordPolicy, qt.IsNotNil)
+		qt.Assert(t, syncResp.Data.Terms, qt.IsNil)
+		qt.Assert(t, syncResp.Data.Version.LatestAPI, qt.Equals, api.LatestAPIVersion)
+		qt.Assert(t, syncResp.Data.Version.APIVersions, qt.DeepEquals, []int{1, 2})
 
 		// Create a user and verify user count increases
 		c.RegisterAndLogin("test@test.com", "test", "testpass")
@@ -39,4 +52,19 @@ func TestSync(t *testing.T) {
 		qt.Assert(t, err, qt.IsNil)
 		qt.Assert(t, syncResp.Data.Users, qt.Equals, 1)
 	})
+
+	t.Run("Cached Sync Data", func(t *testing.T) {
+		// The cached info is invalidated by the tool writes
+		jwt := c.RegisterAndLogin("cache@test.com", "cache", "cachepass")
+		c.CreateTool(jwt, "Cached Tool")
+
+		resp, code := c.Request(http.MethodGet, "", nil, "info")
+		qt.Assert(t, code, qt.Equals, 200)
+		var syncResp struct {
+			Data api.Info `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &syncResp), qt.IsNil)
+		qt.Assert(t, syncResp.Data.Users, qt.Equals, 2)
+		qt.Assert(t, syncResp.Data.Tools, qt.Equals, 1)
+	})
 }
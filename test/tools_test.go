@@ -1,12 +1,19 @@
 package test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/emprius/emprius-app-backend/api"
+	"github.com/emprius/emprius-app-backend/db"
 	"github.com/emprius/emprius-app-backend/test/utils"
 	qt "github.com/frankban/quicktest"
 )
@@ -135,6 +142,7 @@ func TestTools(t *testing.T) {
 					"latitude":  41695384, // 41.695384 * 1e6 (center)
 					"longitude": 2492793,  // 2.492793 * 1e6
 				},
+				"version": c.ToolVersion(userJWT, toolID),
 			},
 			"tools", fmt.Sprint(toolID),
 		)
@@ -429,3 +437,1415 @@ func TestTools(t *testing.T) {
 		qt.Assert(t, code, qt.Equals, 404)
 	})
 }
+
+func TestToolsCSV(t *testing.T) {
+	c := utils.NewTestService(t)
+	userJWT := c.RegisterAndLogin("csv@test.com", "csvuser", "csvpass")
+
+	csvFile := []byte(`title,description,category,valuation,location
+Drill,Cordless drill,0,120,"41.695384,2.492793"
+Saw,Hand saw,99999,30,"41.695384,2.492793"
+Ladder,,0,80,"41.695384,2.492793"
+Shovel,Garden shovel,0,20,Girona
+`)
+	_, code := c.RawRequest(http.MethodPost, "", "text/csv", csvFile, "tools", "import")
+	qt.Assert(t, code, qt.Equals, 401)
+
+	resp, code := c.RawRequest(http.MethodPost, userJWT, "text/csv", csvFile, "tools", "import")
+	qt.Assert(t, code, qt.Equals, 200)
+	var importResp struct {
+		Data api.ToolImportResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &importResp), qt.IsNil)
+	qt.Assert(t, importResp.Data.Imported, qt.Equals, 1)
+	qt.Assert(t, importResp.Data.Failed, qt.Equals, 3)
+	qt.Assert(t, importResp.Data.Results, qt.HasLen, 4)
+	qt.Assert(t, importResp.Data.Results[0].Row, qt.Equals, 2)
+	qt.Assert(t, importResp.Data.Results[0].ID, qt.Not(qt.Equals), int64(0))
+	qt.Assert(t, importResp.Data.Results[0].Error, qt.Equals, "")
+	// Invalid category, empty description and an address without geocoding enabled
+	for _, result := range importResp.Data.Results[1:] {
+		qt.Assert(t, result.ID, qt.Equals, int64(0))
+		qt.Assert(t, result.Error, qt.Not(qt.Equals), "")
+	}
+
+	// A file without the required columns is rejected
+	_, code = c.RawRequest(http.MethodPost, userJWT, "text/csv", []byte("title,description\nDrill,Drill\n"), "tools", "import")
+	qt.Assert(t, code, qt.Equals, 400)
+
+	resp, code = c.RawRequest(http.MethodGet, userJWT, "", nil, "tools", "export")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, string(resp), qt.Equals, "id,title,description,category,valuation,location\n"+
+		fmt.Sprintf("%d,Drill,Cordless drill,0,120,\"41.695384,2.492793\"\n", importResp.Data.Results[0].ID))
+}
+
+func TestToolMaintenance(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("maintenance@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Lawn mower"))
+	day := 24 * time.Hour
+
+	booking := func(fromDay, toDay int) map[string]interface{} {
+		return map[string]interface{}{
+			"toolId":    toolID,
+			"startDate": time.Now().Add(time.Duration(fromDay) * day).Unix(),
+			"endDate":   time.Now().Add(time.Duration(toDay) * day).Unix(),
+			"contact":   "test@example.com",
+		}
+	}
+
+	// Only the owner takes the tool offline, with a note
+	maintenance := map[string]interface{}{
+		"startDate": time.Now().Add(2 * day).Unix(),
+		"endDate":   time.Now().Add(5 * day).Unix(),
+		"note":      "Motor repair",
+		"cost":      60,
+	}
+	_, code := c.Request(http.MethodPost, renterJWT, maintenance, "tools", toolID, "maintenance")
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = c.Request(http.MethodPost, ownerJWT, map[string]interface{}{"cost": 10}, "tools", toolID, "maintenance")
+	qt.Assert(t, code, qt.Equals, 422)
+	_, code = c.Request(http.MethodPost, ownerJWT, maintenance, "tools", toolID, "maintenance")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	resp, code := c.Request(http.MethodGet, renterJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.Maintenance, qt.IsNotNil)
+	qt.Assert(t, toolResp.Data.Maintenance.Note, qt.Equals, "Motor repair")
+
+	// Bookings overlapping the maintenance are rejected
+	_, code = c.Request(http.MethodPost, renterJWT, booking(3, 4), "bookings")
+	qt.Assert(t, code, qt.Equals, 400)
+	_, code = c.Request(http.MethodPost, renterJWT, booking(6, 7), "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// A past service shared in the tool history does not take the tool offline
+	_, code = c.Request(http.MethodPost, ownerJWT, map[string]interface{}{
+		"startDate": time.Now().Add(-10 * day).Unix(),
+		"endDate":   time.Now().Add(-9 * day).Unix(),
+		"note":      "New blade",
+		"cost":      15,
+		"public":    true,
+	}, "tools", toolID, "maintenance")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// The owner sees the whole log, the other users only the public entries
+	var logResp struct {
+		Data []api.MaintenanceLogEntry `json:"data"`
+	}
+	resp, code = c.Request(http.MethodGet, ownerJWT, nil, "tools", toolID, "maintenance")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &logResp), qt.IsNil)
+	qt.Assert(t, logResp.Data, qt.HasLen, 2)
+	qt.Assert(t, logResp.Data[0].Cost, qt.Equals, uint64(60))
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "tools", toolID, "maintenance")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &logResp), qt.IsNil)
+	qt.Assert(t, logResp.Data, qt.HasLen, 1)
+	qt.Assert(t, logResp.Data[0].Note, qt.Equals, "New blade")
+
+	// Ending the maintenance makes the tool bookable again
+	_, code = c.Request(http.MethodDelete, renterJWT, nil, "tools", toolID, "maintenance")
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = c.Request(http.MethodDelete, ownerJWT, nil, "tools", toolID, "maintenance")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodDelete, ownerJWT, nil, "tools", toolID, "maintenance")
+	qt.Assert(t, code, qt.Equals, 400)
+	_, code = c.Request(http.MethodPost, renterJWT, booking(3, 4), "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+}
+
+func TestToolConditionalGet(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("etag@test.com", "owner", "ownerpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Ladder"))
+
+	// The tool has an ETag, but no Last-Modified time as the body depends on the viewer
+	resp, header, code := c.HeaderRequest(http.MethodGet, ownerJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	etag := header.Get("ETag")
+	qt.Assert(t, etag, qt.Not(qt.Equals), "")
+	qt.Assert(t, header.Get("Last-Modified"), qt.Equals, "")
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.UpdatedAt, qt.IsNotNil)
+
+	// Unchanged tools are not sent again
+	resp, _, code = c.HeaderRequest(http.MethodGet, ownerJWT, http.Header{"If-None-Match": {etag}}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, http.StatusNotModified)
+	qt.Assert(t, resp, qt.HasLen, 0)
+	_, _, code = c.HeaderRequest(http.MethodGet, ownerJWT, http.Header{"If-None-Match": {`"other"`}}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// A change of the viewer state, not of the tool, also changes the ETag
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "tools", toolID, "favorite")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, header, code = c.HeaderRequest(http.MethodGet, ownerJWT, http.Header{"If-None-Match": {etag}}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, header.Get("ETag"), qt.Not(qt.Equals), etag)
+	etag = header.Get("ETag")
+
+	// The tool lists also have an ETag
+	_, header, code = c.HeaderRequest(http.MethodGet, ownerJWT, nil, "tools")
+	qt.Assert(t, code, qt.Equals, 200)
+	listETag := header.Get("ETag")
+	qt.Assert(t, listETag, qt.Not(qt.Equals), "")
+	_, _, code = c.HeaderRequest(http.MethodGet, ownerJWT, http.Header{"If-None-Match": {listETag}}, "tools")
+	qt.Assert(t, code, qt.Equals, http.StatusNotModified)
+
+	// Changing the tool changes the ETag
+	time.Sleep(time.Second)
+	_, code = c.Request(http.MethodPut, ownerJWT,
+		map[string]interface{}{"description": "Aluminium", "version": c.ToolVersion(ownerJWT, toolID)}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	_, header, code = c.HeaderRequest(http.MethodGet, ownerJWT, http.Header{"If-None-Match": {etag}}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, header.Get("ETag"), qt.Not(qt.Equals), etag)
+	_, _, code = c.HeaderRequest(http.MethodGet, ownerJWT, http.Header{"If-None-Match": {listETag}}, "tools")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// Images never change
+	var pixel bytes.Buffer
+	qt.Assert(t, png.Encode(&pixel, image.NewRGBA(image.Rect(0, 0, 1, 1))), qt.IsNil)
+	resp, code = c.Request(http.MethodPost, ownerJWT, map[string]interface{}{
+		"name":    "pixel",
+		"content": pixel.Bytes(),
+	}, "images")
+	qt.Assert(t, code, qt.Equals, 200)
+	var imageResp struct {
+		Data struct {
+			Hash string `json:"hash"`
+		} `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &imageResp), qt.IsNil)
+	_, header, code = c.HeaderRequest(http.MethodGet, ownerJWT, nil, "images", imageResp.Data.Hash)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, header.Get("ETag"), qt.Equals, `"`+imageResp.Data.Hash+`"`)
+	qt.Assert(t, header.Get("Cache-Control"), qt.Contains, "immutable")
+	_, _, code = c.HeaderRequest(http.MethodGet, ownerJWT,
+		http.Header{"If-None-Match": {header.Get("ETag")}}, "images", imageResp.Data.Hash)
+	qt.Assert(t, code, qt.Equals, http.StatusNotModified)
+}
+
+func TestSparseFields(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("fields@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("fieldsrenter@test.com", "renter", "renterpass")
+	toolID := c.CreateTool(ownerJWT, "Wheelbarrow")
+
+	var toolResp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	resp, code := c.Request(http.MethodGet, ownerJWT, nil, "tools", fmt.Sprintf("%d?fields=title,cost", toolID))
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data, qt.HasLen, 3)
+	qt.Assert(t, toolResp.Data["title"], qt.Equals, "Wheelbarrow")
+	qt.Assert(t, toolResp.Data["id"], qt.Equals, float64(toolID))
+	qt.Assert(t, toolResp.Data["cost"], qt.IsNotNil)
+
+	_, code = c.Request(http.MethodGet, ownerJWT, nil, "tools", fmt.Sprintf("%d?fields=title,secret", toolID))
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// The lists and the search results are also projected
+	var listResp struct {
+		Data struct {
+			Tools []map[string]interface{} `json:"tools"`
+		} `json:"data"`
+	}
+	resp, code = c.Request(http.MethodGet, ownerJWT, nil, "tools?fields=title")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &listResp), qt.IsNil)
+	qt.Assert(t, listResp.Data.Tools, qt.HasLen, 1)
+	qt.Assert(t, listResp.Data.Tools[0], qt.DeepEquals, map[string]interface{}{
+		"id": float64(toolID), "title": "Wheelbarrow",
+	})
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "tools/search?term=Wheelbarrow&fields=title,distance")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &listResp), qt.IsNil)
+	qt.Assert(t, listResp.Data.Tools, qt.HasLen, 1)
+	qt.Assert(t, listResp.Data.Tools[0], qt.HasLen, 3)
+	qt.Assert(t, listResp.Data.Tools[0]["distance"], qt.IsNotNil)
+
+	// Bookings
+	_, code = c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+		"toolId":    fmt.Sprint(toolID),
+		"startDate": time.Now().Add(24 * time.Hour).Unix(),
+		"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+		"contact":   "renter@example.com",
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingsResp struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	resp, code = c.Request(http.MethodGet, ownerJWT, nil, "bookings/requests?fields=startDate,bookingStatus")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &bookingsResp), qt.IsNil)
+	qt.Assert(t, bookingsResp.Data, qt.HasLen, 1)
+	qt.Assert(t, bookingsResp.Data[0], qt.HasLen, 3)
+	qt.Assert(t, bookingsResp.Data[0]["bookingStatus"], qt.Equals, "PENDING")
+	qt.Assert(t, bookingsResp.Data[0]["contact"], qt.IsNil)
+}
+
+func TestToolViews(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("views@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("viewsrenter@test.com", "renter", "renterpass")
+	otherJWT := c.RegisterAndLogin("viewsother@test.com", "other", "otherpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Chainsaw"))
+
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	viewCount := func(jwt string, path ...string) *int64 {
+		resp, code := c.Request(http.MethodGet, jwt, nil, path...)
+		qt.Assert(t, code, qt.Equals, 200)
+		toolResp.Data = api.Tool{}
+		qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+		return toolResp.Data.ViewCount
+	}
+
+	// The views are counted once per user and day, the owner views are not counted
+	qt.Assert(t, viewCount(renterJWT, "tools", toolID), qt.IsNil)
+	qt.Assert(t, viewCount(renterJWT, "tools", toolID), qt.IsNil)
+	qt.Assert(t, viewCount(otherJWT, "tools", toolID), qt.IsNil)
+	count := viewCount(ownerJWT, "tools", toolID)
+	qt.Assert(t, count, qt.IsNotNil)
+	qt.Assert(t, *count, qt.Equals, int64(2))
+	count = viewCount(ownerJWT, "tools", toolID)
+	qt.Assert(t, *count, qt.Equals, int64(2))
+
+	// The owner also sees the view count in the tool lists
+	var listResp struct {
+		Data api.ToolsWrapper `json:"data"`
+	}
+	resp, code := c.Request(http.MethodGet, ownerJWT, nil, "tools")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &listResp), qt.IsNil)
+	qt.Assert(t, listResp.Data.Tools, qt.HasLen, 1)
+	qt.Assert(t, *listResp.Data.Tools[0].ViewCount, qt.Equals, int64(2))
+
+	// The search results can be sorted by popularity
+	var searchResp struct {
+		Data api.ToolSearchResponse `json:"data"`
+	}
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "tools/search?sort=popular")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &searchResp), qt.IsNil)
+	qt.Assert(t, searchResp.Data.Tools, qt.HasLen, 1)
+	qt.Assert(t, searchResp.Data.Tools[0].ViewCount, qt.IsNil)
+}
+
+func TestToolManagers(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	ownerJWT, ownerID := c.RegisterAndLoginWithID("owner@test.com", "owner", "ownerpass")
+	managerJWT, managerID := c.RegisterAndLoginWithID("manager@test.com", "manager", "managerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Lawnmower"))
+
+	edit := func(jwt, description string) ([]byte, int) {
+		return c.Request(http.MethodPut, jwt,
+			map[string]interface{}{"description": description, "version": c.ToolVersion(jwt, toolID)}, "tools", toolID)
+	}
+	addManager := func(jwt, userID string) ([]byte, int) {
+		return c.Request(http.MethodPost, jwt, map[string]interface{}{"userId": userID}, "tools", toolID, "managers")
+	}
+
+	resp, code := edit(managerJWT, "Edited")
+	qt.Assert(t, code, qt.Equals, 403)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.not_owned")
+
+	// Only the owner grants the management of the tool, to other users
+	_, code = addManager(renterJWT, managerID)
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = addManager(ownerJWT, ownerID)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.manager_is_owner")
+	_, code = addManager(ownerJWT, managerID)
+	qt.Assert(t, code, qt.Equals, 200)
+
+	resp, code = c.Request(http.MethodGet, managerJWT, nil, "tools", toolID, "managers")
+	qt.Assert(t, code, qt.Equals, 200)
+	var managersResp struct {
+		Data api.ToolManagersWrapper `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &managersResp), qt.IsNil)
+	qt.Assert(t, managersResp.Data.Managers, qt.HasLen, 1)
+	qt.Assert(t, managersResp.Data.Managers[0].ID, qt.Equals, managerID)
+	_, code = c.Request(http.MethodGet, renterJWT, nil, "tools", toolID, "managers")
+	qt.Assert(t, code, qt.Equals, 403)
+
+	// The manager edits the tool, recorded as its last editor
+	_, code = edit(managerJWT, "Edited by the manager")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.Description, qt.Equals, "Edited by the manager")
+	qt.Assert(t, toolResp.Data.UpdatedBy, qt.Equals, managerID)
+	qt.Assert(t, toolResp.Data.Managers, qt.DeepEquals, []string{managerID})
+
+	// The manager gets the booking requests of the tool and accepts them
+	resp, code = c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+		"toolId":    toolID,
+		"startDate": time.Now().Add(24 * time.Hour).Unix(),
+		"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	bookingID := bookingResp.Data.ID
+
+	resp, code = c.Request(http.MethodGet, managerJWT, nil, "bookings", "requests")
+	qt.Assert(t, code, qt.Equals, 200)
+	var requestsResp struct {
+		Data []api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &requestsResp), qt.IsNil)
+	qt.Assert(t, requestsResp.Data, qt.HasLen, 1)
+	qt.Assert(t, requestsResp.Data[0].ID, qt.Equals, bookingID)
+
+	_, code = c.Request(http.MethodPost, managerJWT, nil, "bookings", "petitions", bookingID, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodGet, ownerJWT, nil, "bookings", bookingID, "history")
+	qt.Assert(t, code, qt.Equals, 200)
+	var historyResp struct {
+		Data []api.BookingTransition `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &historyResp), qt.IsNil)
+	qt.Assert(t, historyResp.Data, qt.HasLen, 2)
+	qt.Assert(t, historyResp.Data[1].By, qt.Equals, managerID)
+
+	// The manager stops managing the tool
+	_, code = c.Request(http.MethodDelete, managerJWT, nil, "tools", toolID, "managers", managerID)
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = edit(managerJWT, "Edited again")
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = c.Request(http.MethodGet, managerJWT, nil, "bookings", bookingID)
+	qt.Assert(t, code, qt.Equals, 403)
+}
+
+func TestToolTransfer(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	ownerJWT, ownerID := c.RegisterAndLoginWithID("owner@test.com", "owner", "ownerpass")
+	recipientJWT, recipientID := c.RegisterAndLoginWithID("recipient@test.com", "recipient", "recipientpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Drill"))
+
+	transfer := func(jwt, userID string) ([]byte, int) {
+		return c.Request(http.MethodPost, jwt, map[string]interface{}{"userId": userID, "message": "A gift"},
+			"tools", toolID, "transfer")
+	}
+
+	// A booking of the tool, pending while the tool is offered
+	resp, code := c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+		"toolId":    toolID,
+		"startDate": time.Now().Add(24 * time.Hour).Unix(),
+		"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	bookingID := bookingResp.Data.ID
+
+	_, code = transfer(recipientJWT, recipientID)
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = transfer(ownerJWT, ownerID)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "transfer.self")
+	resp, code = transfer(ownerJWT, recipientID)
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "transfer.open_bookings")
+
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", bookingID, "deny")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = transfer(ownerJWT, recipientID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var transferResp struct {
+		Data api.ToolTransfer `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &transferResp), qt.IsNil)
+	transferID := transferResp.Data.ID
+	qt.Assert(t, transferResp.Data.Status, qt.Equals, "PENDING")
+	resp, code = transfer(ownerJWT, recipientID)
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "transfer.pending")
+
+	// Both users list the transfer
+	resp, code = c.Request(http.MethodGet, recipientJWT, nil, "transfers")
+	qt.Assert(t, code, qt.Equals, 200)
+	var transfersResp struct {
+		Data api.ToolTransfersWrapper `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &transfersResp), qt.IsNil)
+	qt.Assert(t, transfersResp.Data.Sent, qt.HasLen, 0)
+	qt.Assert(t, transfersResp.Data.Received, qt.HasLen, 1)
+	qt.Assert(t, transfersResp.Data.Received[0].ID, qt.Equals, transferID)
+
+	// Only the recipient accepts it
+	resp, code = c.Request(http.MethodPost, ownerJWT, nil, "transfers", transferID, "accept")
+	qt.Assert(t, code, qt.Equals, 403)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "transfer.only_recipient")
+	resp, code = c.Request(http.MethodPost, renterJWT, nil, "transfers", transferID, "accept")
+	qt.Assert(t, code, qt.Equals, 404)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "transfer.not_found")
+	resp, code = c.Request(http.MethodPost, recipientJWT, nil, "transfers", transferID, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+	var idResp struct {
+		Data api.ToolID `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &idResp), qt.IsNil)
+	newToolID := fmt.Sprint(idResp.Data.ID)
+
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "tools", newToolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.UserID, qt.Equals, recipientID)
+	_, code = c.Request(http.MethodGet, renterJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 404)
+
+	// The booking history moved with the tool
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "bookings", bookingID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	qt.Assert(t, bookingResp.Data.ToolID, qt.Equals, newToolID)
+
+	// The answered transfer cannot be answered again
+	resp, code = c.Request(http.MethodPost, recipientJWT, nil, "transfers", transferID, "reject")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "transfer.not_pending")
+
+	// The new owner offers it back, and cancels the offer
+	toolID = newToolID
+	resp, code = transfer(recipientJWT, ownerID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &transferResp), qt.IsNil)
+	resp, code = c.Request(http.MethodPost, ownerJWT, nil, "transfers", transferResp.Data.ID, "cancel")
+	qt.Assert(t, code, qt.Equals, 403)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "transfer.only_sender")
+	_, code = c.Request(http.MethodPost, recipientJWT, nil, "transfers", transferResp.Data.ID, "cancel")
+	qt.Assert(t, code, qt.Equals, 200)
+}
+
+func TestEditVersions(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Ladder"))
+	conflictVersion := func(resp []byte) int64 {
+		var conflict struct {
+			Data api.VersionConflict `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &conflict), qt.IsNil)
+		return conflict.Data.Version
+	}
+
+	// The tool edits require the version, and increase it
+	qt.Assert(t, c.ToolVersion(ownerJWT, toolID), qt.Equals, int64(0))
+	resp, code := c.Request(http.MethodPut, ownerJWT, map[string]interface{}{"description": "Aluminium"}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "request.version_required")
+	_, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{"description": "Aluminium", "version": 0}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, c.ToolVersion(ownerJWT, toolID), qt.Equals, int64(1))
+
+	// A stale edit gets the current version to merge its changes
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{"description": "Steel", "version": 0}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "request.version_conflict")
+	qt.Assert(t, conflictVersion(resp), qt.Equals, int64(1))
+
+	// The version is kept when the tool gets a new ID from its title
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{"title": "Tall ladder", "version": 1}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var edited struct {
+		Data api.ToolID `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &edited), qt.IsNil)
+	qt.Assert(t, c.ToolVersion(ownerJWT, edited.Data.ID), qt.Equals, int64(2))
+
+	// The profile updates follow the same rules
+	qt.Assert(t, c.ProfileVersion(ownerJWT), qt.Equals, int64(0))
+	resp, code = c.Request(http.MethodPost, ownerJWT, map[string]interface{}{"name": "Owner"}, "profile")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "request.version_required")
+	_, code = c.Request(http.MethodPost, ownerJWT, map[string]interface{}{"name": "Owner", "version": 0}, "profile")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodPost, ownerJWT, map[string]interface{}{"name": "Stale", "version": 0}, "profile")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, conflictVersion(resp), qt.Equals, int64(1))
+	qt.Assert(t, c.ProfileVersion(ownerJWT), qt.Equals, int64(1))
+}
+
+func TestBatchGet(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT, ownerID := c.RegisterAndLoginWithID("owner@test.com", "owner", "ownerpass")
+	renterJWT, renterID := c.RegisterAndLoginWithID("renter@test.com", "renter", "renterpass")
+	drill := c.CreateTool(ownerJWT, "Drill")
+	saw := c.CreateTool(ownerJWT, "Saw")
+	ladder := c.CreateTool(renterJWT, "Ladder")
+
+	getTools := func(jwt, ids string) []*api.Tool {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "tools?ids="+ids)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var toolsResp struct {
+			Data api.ToolsWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &toolsResp), qt.IsNil)
+		return toolsResp.Data.Tools
+	}
+
+	// The tools are returned in the requested order, the missing ones skipped
+	tools := getTools(renterJWT, fmt.Sprintf("%d,%d,999,%d", saw, ladder, drill))
+	qt.Assert(t, tools, qt.HasLen, 3)
+	qt.Assert(t, tools[0].ID, qt.Equals, saw)
+	qt.Assert(t, tools[1].ID, qt.Equals, ladder)
+	qt.Assert(t, tools[2].ID, qt.Equals, drill)
+
+	// Each tool is seen as in GET /tools/{id}: the exact location and the views only by the owner
+	qt.Assert(t, tools[1].ViewCount, qt.IsNotNil)
+	qt.Assert(t, tools[0].ViewCount, qt.IsNil)
+	qt.Assert(t, tools[0].Location, qt.Not(qt.Equals), tools[1].Location)
+	tools = getTools(ownerJWT, fmt.Sprint(drill))
+	qt.Assert(t, tools[0].ViewCount, qt.IsNotNil)
+	qt.Assert(t, tools[0].Location, qt.Equals, api.Location{Latitude: 41695384, Longitude: 2492793})
+
+	// The sparse fieldsets apply to the batches
+	resp, code := c.Request(http.MethodGet, renterJWT, nil, fmt.Sprintf("tools?ids=%d&fields=title", drill))
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, string(resp), qt.Not(qt.Contains), "estimatedValue")
+
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "tools?ids=1,abc")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "request.invalid_data")
+	many := "0"
+	for i := 1; i <= 100; i++ {
+		many += fmt.Sprintf(",%d", i)
+	}
+	_, code = c.Request(http.MethodGet, renterJWT, nil, "tools?ids="+many)
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// The users batch hides the private data of the others
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, fmt.Sprintf("users?ids=%s,%s,%s",
+		ownerID, renterID, "000000000000000000000000"))
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var usersResp struct {
+		Data api.UsersWrapper `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &usersResp), qt.IsNil)
+	qt.Assert(t, usersResp.Data.Users, qt.HasLen, 2)
+	qt.Assert(t, usersResp.Data.Users[0].ID, qt.Equals, ownerID)
+	qt.Assert(t, usersResp.Data.Users[1].ID, qt.Equals, renterID)
+	resp, code = c.Request(http.MethodGet, renterJWT, nil, "users?ids=notanid")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "user.invalid_id")
+}
+
+func TestImageUsage(t *testing.T) {
+	c := utils.NewTestService(t)
+	adminJWT, adminID := c.RegisterAndLoginWithID("images-admin@test.com", "admin", "adminpass")
+	ownerJWT, ownerID := c.RegisterAndLoginWithID("images-owner@test.com", "owner", "ownerpass")
+	c.MakeAdmin(adminID)
+
+	var pixel bytes.Buffer
+	qt.Assert(t, png.Encode(&pixel, image.NewRGBA(image.Rect(0, 0, 1, 1))), qt.IsNil)
+	resp, code := c.Request(http.MethodPost, ownerJWT, map[string]interface{}{
+		"name":    "pixel",
+		"content": pixel.Bytes(),
+	}, "images")
+	qt.Assert(t, code, qt.Equals, 200)
+	var imageResp struct {
+		Data struct {
+			Hash    string `json:"hash"`
+			Content []byte `json:"content"`
+		} `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &imageResp), qt.IsNil)
+	resp, code = c.Request(http.MethodPost, ownerJWT, map[string]interface{}{
+		"title":       "Pictured tool",
+		"description": "Test tool",
+		"mayBeFree":   true,
+		"cost":        10,
+		"category":    1,
+		"images":      []string{imageResp.Data.Hash},
+		"location": map[string]interface{}{
+			"latitude":  41695384,
+			"longitude": 2492793,
+		},
+	}, "tools")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+
+	// Only the admins get the usage
+	_, code = c.Request(http.MethodGet, ownerJWT, nil, "admin", "images", "usage")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = c.Request(http.MethodGet, adminJWT, nil, "admin", "images", "usage")
+	qt.Assert(t, code, qt.Equals, 200)
+	var usage struct {
+		Data api.ImageUsageResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &usage), qt.IsNil)
+	qt.Assert(t, usage.Data.Images, qt.Equals, int64(1))
+	// The stored content is the normalized image
+	qt.Assert(t, usage.Data.Bytes, qt.Equals, int64(len(imageResp.Data.Content)))
+	qt.Assert(t, usage.Data.Users, qt.HasLen, 1)
+	qt.Assert(t, usage.Data.Users[0].UserID.Hex(), qt.Equals, ownerID)
+	qt.Assert(t, usage.Data.Users[0].Images, qt.Equals, int64(1))
+}
+
+func TestToolMedia(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("media-owner@test.com", "owner", "ownerpass")
+	otherJWT := c.RegisterAndLogin("media-other@test.com", "other", "otherpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Documented tool"))
+
+	upload := func(jwt, filename string, content []byte) ([]byte, int) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", filename)
+		qt.Assert(t, err, qt.IsNil)
+		_, err = part.Write(content)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, writer.Close(), qt.IsNil)
+		return c.RawRequest(http.MethodPost, jwt, writer.FormDataContentType(), body.Bytes(), "tools", toolID, "media")
+	}
+	pdf := []byte("%PDF-1.4\n% the manual of the tool\n%%EOF\n")
+
+	// Only the owner attaches media, which must be a video or a PDF
+	_, code := upload(otherJWT, "manual.pdf", pdf)
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code := upload(ownerJWT, "notes.txt", []byte("plain text"))
+	qt.Assert(t, code, qt.Equals, http.StatusUnsupportedMediaType)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "media.invalid_type")
+	resp, code = upload(ownerJWT, "manual.pdf", pdf)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var mediaResp struct {
+		Data api.ToolMedia `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &mediaResp), qt.IsNil)
+	qt.Assert(t, mediaResp.Data.Name, qt.Equals, "manual.pdf")
+	qt.Assert(t, mediaResp.Data.Type, qt.Equals, "document")
+	qt.Assert(t, mediaResp.Data.MimeType, qt.Equals, "application/pdf")
+	qt.Assert(t, mediaResp.Data.Size, qt.Equals, int64(len(pdf)))
+
+	// The media are listed with the tool
+	resp, code = c.Request(http.MethodGet, otherJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.Media, qt.HasLen, 1)
+	qt.Assert(t, toolResp.Data.Media[0].URL, qt.Equals, "/media/"+mediaResp.Data.Hash.String())
+
+	// The media are downloaded whole or by ranges
+	hash := mediaResp.Data.Hash.String()
+	resp, header, code := c.HeaderRequest(http.MethodGet, otherJWT, nil, "media", hash)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, resp, qt.DeepEquals, pdf)
+	qt.Assert(t, header.Get("Content-Type"), qt.Equals, "application/pdf")
+	qt.Assert(t, header.Get("Accept-Ranges"), qt.Equals, "bytes")
+	resp, header, code = c.HeaderRequest(http.MethodGet, otherJWT, http.Header{"Range": {"bytes=0-4"}}, "media", hash)
+	qt.Assert(t, code, qt.Equals, http.StatusPartialContent)
+	qt.Assert(t, string(resp), qt.Equals, "%PDF-")
+	qt.Assert(t, header.Get("Content-Range"), qt.Equals, fmt.Sprintf("bytes 0-4/%d", len(pdf)))
+	_, _, code = c.HeaderRequest(http.MethodGet, otherJWT, http.Header{"If-None-Match": {`"` + hash + `"`}}, "media", hash)
+	qt.Assert(t, code, qt.Equals, http.StatusNotModified)
+	_, _, code = c.HeaderRequest(http.MethodGet, "", nil, "media", hash)
+	qt.Assert(t, code, qt.Equals, 401)
+
+	// Detached media are not listed anymore
+	_, code = c.Request(http.MethodDelete, otherJWT, nil, "tools", toolID, "media", hash)
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = c.Request(http.MethodDelete, ownerJWT, nil, "tools", toolID, "media", hash)
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodDelete, ownerJWT, nil, "tools", toolID, "media", hash)
+	qt.Assert(t, code, qt.Equals, 404)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "media.not_found")
+	resp, code = c.Request(http.MethodGet, ownerJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	toolResp.Data = api.Tool{}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.Media, qt.HasLen, 0)
+}
+
+func TestToolSpecs(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("specs-owner@test.com", "owner", "ownerpass")
+	drillID := fmt.Sprint(c.CreateTool(ownerJWT, "Cordless drill"))
+	c.CreateTool(ownerJWT, "Hand saw")
+
+	// Invalid specs are rejected
+	resp, code := c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version": c.ToolVersion(ownerJWT, drillID),
+		"specs":   map[string]interface{}{"powerType": "nuclear"},
+	}, "tools", drillID)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.invalid_specs")
+
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version": c.ToolVersion(ownerJWT, drillID),
+		"specs": map[string]interface{}{
+			"condition":   "likeNew",
+			"brand":       "Makita",
+			"model":       "DDF485",
+			"year":        2021,
+			"powerType":   "battery",
+			"accessories": []string{"2 batteries", "charger"},
+			"consumables": []string{"drill bits"},
+		},
+	}, "tools", drillID)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	resp, code = c.Request(http.MethodGet, ownerJWT, nil, "tools", drillID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.Specs, qt.IsNotNil)
+	qt.Assert(t, toolResp.Data.Specs.Model, qt.Equals, "DDF485")
+	qt.Assert(t, toolResp.Data.Specs.Accessories, qt.DeepEquals, []string{"2 batteries", "charger"})
+
+	search := func(query string) []string {
+		resp, code := c.Request(http.MethodGet, ownerJWT, nil, "tools/search?"+query)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var searchResp struct {
+			Data api.ToolSearchResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &searchResp), qt.IsNil)
+		titles := []string{}
+		for _, tool := range searchResp.Data.Tools {
+			titles = append(titles, tool.Title)
+		}
+		return titles
+	}
+	qt.Assert(t, search(""), qt.HasLen, 2)
+	qt.Assert(t, search("powerType=battery"), qt.DeepEquals, []string{"Cordless drill"})
+	qt.Assert(t, search("powerType=manual&powerType=battery"), qt.DeepEquals, []string{"Cordless drill"})
+	qt.Assert(t, search("powerType=electric"), qt.HasLen, 0)
+	qt.Assert(t, search("condition=likeNew&brand=makita"), qt.DeepEquals, []string{"Cordless drill"})
+	qt.Assert(t, search("brand=Bosch"), qt.HasLen, 0)
+	_, code = c.Request(http.MethodGet, ownerJWT, nil, "tools/search?condition=broken")
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// An empty object removes the specs
+	_, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version": c.ToolVersion(ownerJWT, drillID),
+		"specs":   map[string]interface{}{},
+	}, "tools", drillID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, search("powerType=battery"), qt.HasLen, 0)
+}
+
+func TestToolDimensions(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("dimensions-owner@test.com", "owner", "ownerpass")
+	ladderID := fmt.Sprint(c.CreateTool(ownerJWT, "Ladder"))
+	c.CreateTool(ownerJWT, "Hand saw")
+
+	// Unknown units are rejected
+	resp, code := c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version":    c.ToolVersion(ownerJWT, ladderID),
+		"dimensions": map[string]interface{}{"height": 2, "lengthUnit": "yards"},
+	}, "tools", ladderID)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.invalid_dimensions")
+
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version": c.ToolVersion(ownerJWT, ladderID),
+		"dimensions": map[string]interface{}{
+			"height":     1.2,
+			"width":      0.45,
+			"weight":     2500,
+			"lengthUnit": "m",
+			"weightUnit": "g",
+		},
+	}, "tools", ladderID)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	resp, code = c.Request(http.MethodGet, ownerJWT, nil, "tools", ladderID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.Dimensions, qt.DeepEquals, &api.Dimensions{
+		Height:     120,
+		Width:      45,
+		Weight:     2.5,
+		LengthUnit: "cm",
+		WeightUnit: "kg",
+	})
+	// The older clients still get the height and weight rounded
+	qt.Assert(t, toolResp.Data.Height, qt.Equals, uint32(120))
+	qt.Assert(t, toolResp.Data.Weight, qt.Equals, uint32(3))
+
+	search := func(query string) []string {
+		resp, code := c.Request(http.MethodGet, ownerJWT, nil, "tools/search?"+query)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var searchResp struct {
+			Data api.ToolSearchResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &searchResp), qt.IsNil)
+		titles := []string{}
+		for _, tool := range searchResp.Data.Tools {
+			titles = append(titles, tool.Title)
+		}
+		return titles
+	}
+	qt.Assert(t, search("maxWeight=3kg&maxHeight=1.5m"), qt.DeepEquals, []string{"Ladder"})
+	qt.Assert(t, search("maxWeight=2"), qt.HasLen, 0)
+	qt.Assert(t, search("maxWeight=50&maxHeight=40"), qt.DeepEquals, []string{"Hand saw"})
+	// The tools without a known width are excluded
+	qt.Assert(t, search("maxWidth=18in"), qt.DeepEquals, []string{"Ladder"})
+	_, code = c.Request(http.MethodGet, ownerJWT, nil, "tools/search?maxHeight=2parsecs")
+	qt.Assert(t, code, qt.Equals, 400)
+}
+
+func TestToolIdentifiers(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("identifiers-owner@test.com", "owner", "ownerpass")
+	drillID := fmt.Sprint(c.CreateTool(ownerJWT, "Drill"))
+	sawID := fmt.Sprint(c.CreateTool(ownerJWT, "Saw"))
+
+	edit := func(toolID string, fields map[string]interface{}) ([]byte, int) {
+		fields["version"] = c.ToolVersion(ownerJWT, toolID)
+		return c.Request(http.MethodPut, ownerJWT, fields, "tools", toolID)
+	}
+	get := func(jwt, toolID string) api.Tool {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "tools", toolID)
+		qt.Assert(t, code, qt.Equals, 200)
+		var toolResp struct {
+			Data api.Tool `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+		return toolResp.Data
+	}
+
+	resp, code := edit(drillID, map[string]interface{}{"serialNumber": " SN-1 ", "assetTag": "TAG-1"})
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	drill := get(ownerJWT, drillID)
+	qt.Assert(t, drill.SerialNumber, qt.IsNotNil)
+	qt.Assert(t, *drill.SerialNumber, qt.Equals, "SN-1")
+	qt.Assert(t, *drill.AssetTag, qt.Equals, "TAG-1")
+
+	// The identifiers are only shown to those who can edit the tool and to the admins
+	otherJWT := c.RegisterAndLogin("identifiers-other@test.com", "other", "otherpass")
+	drill = get(otherJWT, drillID)
+	qt.Assert(t, drill.SerialNumber, qt.IsNil)
+	qt.Assert(t, drill.AssetTag, qt.IsNil)
+	adminJWT, adminID := c.RegisterAndLoginWithID("identifiers-admin@test.com", "admin", "adminpass")
+	c.MakeAdmin(adminID)
+	qt.Assert(t, *get(adminJWT, drillID).SerialNumber, qt.Equals, "SN-1")
+
+	// The identifiers are unique among the owner tools
+	resp, code = edit(sawID, map[string]interface{}{"serialNumber": "SN-1"})
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.duplicate_serial_number")
+
+	// Editing other fields keeps them
+	resp, code = edit(drillID, map[string]interface{}{"description": "Cordless drill"})
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	qt.Assert(t, *get(ownerJWT, drillID).SerialNumber, qt.Equals, "SN-1")
+
+	// An empty string removes a wrong identifier, freeing it for another tool
+	resp, code = edit(drillID, map[string]interface{}{"serialNumber": ""})
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	drill = get(ownerJWT, drillID)
+	qt.Assert(t, drill.SerialNumber, qt.IsNil)
+	qt.Assert(t, *drill.AssetTag, qt.Equals, "TAG-1")
+	resp, code = edit(sawID, map[string]interface{}{"serialNumber": "SN-1"})
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	qt.Assert(t, *get(ownerJWT, sawID).SerialNumber, qt.Equals, "SN-1")
+}
+
+func TestToolTransports(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("transports-owner@test.com", "owner", "ownerpass")
+	nearID := fmt.Sprint(c.CreateTool(ownerJWT, "Near ladder"))
+	farID := fmt.Sprint(c.CreateTool(ownerJWT, "Far trailer"))
+	c.CreateTool(ownerJWT, "Hand saw")
+
+	// The catalog of transport options
+	resp, code := c.Request(http.MethodGet, "", nil, "info", "transports")
+	qt.Assert(t, code, qt.Equals, 200)
+	var catalogResp struct {
+		Data []db.Transport `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &catalogResp), qt.IsNil)
+	kinds := map[int64]db.TransportKind{}
+	for _, transport := range catalogResp.Data {
+		kinds[transport.ID] = transport.Kind
+	}
+	qt.Assert(t, kinds[4], qt.Equals, db.TransportPickup)
+	qt.Assert(t, kinds[5], qt.Equals, db.TransportDelivery)
+
+	// Only the delivery options have a fee
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version":    c.ToolVersion(ownerJWT, nearID),
+		"transports": []map[string]interface{}{{"id": 4, "deliveryFee": 2}},
+	}, "tools", nearID)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.invalid_transport_option")
+
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version": c.ToolVersion(ownerJWT, nearID),
+		"transports": []map[string]interface{}{
+			{"id": 4},
+			{"id": 5, "maxDistanceKm": 5, "deliveryFee": 3},
+		},
+	}, "tools", nearID)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	resp, code = c.Request(http.MethodGet, ownerJWT, nil, "tools", nearID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.TransportOptions, qt.DeepEquals, []int{4, 5})
+	qt.Assert(t, toolResp.Data.Transports, qt.DeepEquals, []api.ToolTransport{
+		{ID: 4, Kind: "pickup"},
+		{ID: 5, Kind: "delivery", MaxDistanceKm: 5, DeliveryFee: 3},
+	})
+
+	// The far tool, about 12 km away, is delivered within 5 km
+	_, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version": c.ToolVersion(ownerJWT, farID),
+		"location": map[string]interface{}{
+			"latitude":  41800000,
+			"longitude": 2492793,
+		},
+		"transports": []map[string]interface{}{{"id": 5, "maxDistanceKm": 5}},
+	}, "tools", farID)
+	qt.Assert(t, code, qt.Equals, 200)
+
+	search := func(query string) []string {
+		resp, code := c.Request(http.MethodGet, ownerJWT, nil, "tools/search?"+query)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var searchResp struct {
+			Data api.ToolSearchResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &searchResp), qt.IsNil)
+		titles := []string{}
+		for _, tool := range searchResp.Data.Tools {
+			titles = append(titles, tool.Title)
+		}
+		return titles
+	}
+	qt.Assert(t, search("delivery=true"), qt.DeepEquals, []string{"Near ladder"})
+	qt.Assert(t, search("transports=4"), qt.DeepEquals, []string{"Near ladder"})
+
+	// Without a maximum distance the owner delivers anywhere
+	_, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version":    c.ToolVersion(ownerJWT, farID),
+		"transports": []map[string]interface{}{{"id": 5}},
+	}, "tools", farID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, search("delivery=true"), qt.DeepEquals, []string{"Near ladder", "Far trailer"})
+
+	// The quote includes the delivery fee of the chosen option
+	start := time.Now().Add(24 * time.Hour).Unix()
+	quoteQuery := fmt.Sprintf("quote?startDate=%d&endDate=%d&transport=", start, start+3600)
+	resp, code = c.Request(http.MethodGet, ownerJWT, nil, "tools", nearID, quoteQuery+"5")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var quoteResp struct {
+		Data api.Quote `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &quoteResp), qt.IsNil)
+	qt.Assert(t, quoteResp.Data.Transport, qt.Equals, int64(5))
+	qt.Assert(t, quoteResp.Data.DeliveryFee, qt.Equals, uint64(3))
+	_, code = c.Request(http.MethodGet, ownerJWT, nil, "tools", nearID, quoteQuery+"1")
+	qt.Assert(t, code, qt.Equals, 422)
+}
+
+func TestToolVisibility(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("visibility-owner@test.com", "owner", "ownerpass")
+	memberJWT := c.RegisterAndLogin("visibility-member@test.com", "member", "memberpass")
+	strangerJWT := c.RegisterAndLogin("visibility-stranger@test.com", "stranger", "strangerpass")
+	c.SetCommunity(strangerJWT, "otherCommunity")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Private drill"))
+
+	setVisibility := func(visibility string, visibleTo []string) ([]byte, int) {
+		return c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+			"version":    c.ToolVersion(ownerJWT, toolID),
+			"visibility": visibility,
+			"visibleTo":  visibleTo,
+		}, "tools", toolID)
+	}
+	search := func(jwt string) []string {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "tools/search")
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var searchResp struct {
+			Data api.ToolSearchResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &searchResp), qt.IsNil)
+		titles := []string{}
+		for _, tool := range searchResp.Data.Tools {
+			titles = append(titles, tool.Title)
+		}
+		return titles
+	}
+	book := func(jwt string) ([]byte, int) {
+		return c.Request(http.MethodPost, jwt, map[string]interface{}{
+			"toolId":    toolID,
+			"startDate": time.Now().Add(24 * time.Hour).Unix(),
+			"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+			"contact":   "visibility@test.com",
+		}, "bookings")
+	}
+
+	// The tools are public by default
+	resp, code := c.Request(http.MethodGet, strangerJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.Visibility, qt.Equals, "public")
+	qt.Assert(t, search(strangerJWT), qt.DeepEquals, []string{"Private drill"})
+	_, code = c.Request(http.MethodPost, strangerJWT, nil, "tools", toolID, "favorite")
+	qt.Assert(t, code, qt.Equals, 200)
+	listed := func(jwt string, path ...string) int {
+		resp, code := c.Request(http.MethodGet, jwt, nil, path...)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var toolsResp struct {
+			Data api.ToolsWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &toolsResp), qt.IsNil)
+		return len(toolsResp.Data.Tools)
+	}
+	qt.Assert(t, listed(strangerJWT, "profile", "favorites"), qt.Equals, 1)
+
+	resp, code = setVisibility("secret", nil)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.invalid_visibility")
+	resp, code = setVisibility("communities", nil)
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.invalid_visibility")
+
+	// Visible to the owner community only
+	resp, code = setVisibility("community", nil)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	_, code = c.Request(http.MethodGet, ownerJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodGet, memberJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodGet, strangerJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 404)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.not_found")
+	qt.Assert(t, search(memberJWT), qt.DeepEquals, []string{"Private drill"})
+	qt.Assert(t, search(strangerJWT), qt.DeepEquals, []string{})
+	resp, code = book(strangerJWT)
+	qt.Assert(t, code, qt.Equals, 403)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "community.not_member")
+	// Nor read by any other endpoint
+	qt.Assert(t, listed(strangerJWT, "tools?ids="+toolID), qt.Equals, 0)
+	qt.Assert(t, listed(memberJWT, "tools?ids="+toolID), qt.Equals, 1)
+	qt.Assert(t, listed(strangerJWT, "profile", "favorites"), qt.Equals, 0)
+	for _, path := range []string{"quote", "suggested-dates?duration=1", "valuations"} {
+		resp, code = c.Request(http.MethodGet, strangerJWT, nil, "tools", toolID, path)
+		qt.Assert(t, code, qt.Equals, 404, qt.Commentf("Path: %s", path))
+		qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.not_found")
+	}
+	_, code = c.Request(http.MethodPost, strangerJWT, nil, "tools", toolID, "favorite")
+	qt.Assert(t, code, qt.Equals, 404)
+
+	// Visible to specific communities, not including the owner one
+	resp, code = setVisibility("communities", []string{"otherCommunity", " otherCommunity "})
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	resp, code = c.Request(http.MethodGet, strangerJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.VisibleTo, qt.DeepEquals, []string{"otherCommunity"})
+	_, code = c.Request(http.MethodGet, memberJWT, nil, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 404)
+	qt.Assert(t, search(strangerJWT), qt.DeepEquals, []string{"Private drill"})
+	qt.Assert(t, search(memberJWT), qt.DeepEquals, []string{})
+	_, code = book(memberJWT)
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = book(strangerJWT)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+}
+
+func TestToolValuations(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("valuation-owner@test.com", "owner", "ownerpass")
+	otherJWT := c.RegisterAndLogin("valuation-other@test.com", "other", "otherpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Chainsaw"))
+
+	valuations := func(jwt string) api.ToolValuations {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "tools", toolID, "valuations")
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var valuationsResp struct {
+			Data api.ToolValuations `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &valuationsResp), qt.IsNil)
+		return valuationsResp.Data
+	}
+
+	// The publication is the first valuation
+	v := valuations(ownerJWT)
+	qt.Assert(t, v.EstimatedValue, qt.Equals, uint64(20))
+	qt.Assert(t, v.SuggestedValue, qt.IsNil)
+	qt.Assert(t, v.History, qt.HasLen, 1)
+	qt.Assert(t, v.History[0].Source, qt.Equals, "CREATED")
+	qt.Assert(t, v.History[0].Value, qt.Equals, uint64(20))
+
+	// The edits of the estimated value are recorded, the other edits are not
+	_, code := c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version":     c.ToolVersion(ownerJWT, toolID),
+		"description": "Petrol chainsaw",
+	}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code := c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version":        c.ToolVersion(ownerJWT, toolID),
+		"estimatedValue": 300,
+	}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	v = valuations(ownerJWT)
+	qt.Assert(t, v.EstimatedValue, qt.Equals, uint64(300))
+	qt.Assert(t, v.History, qt.HasLen, 2)
+	qt.Assert(t, v.History[0].Source, qt.Equals, "EDITED")
+	qt.Assert(t, v.History[0].Value, qt.Equals, uint64(300))
+	qt.Assert(t, v.History[0].Previous, qt.Equals, uint64(20))
+
+	// Nothing to depreciate until a year has passed
+	resp, code = c.Request(http.MethodPost, ownerJWT, nil, "tools", toolID, "valuations", "depreciate")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.no_depreciation")
+
+	// After a year the depreciation is suggested to the owner only
+	c.AgeToolValuations(toolID, 400*24*time.Hour)
+	v = valuations(ownerJWT)
+	qt.Assert(t, v.SuggestedValue, qt.IsNotNil)
+	qt.Assert(t, *v.SuggestedValue, qt.Equals, uint64(270))
+	v = valuations(otherJWT)
+	qt.Assert(t, v.SuggestedValue, qt.IsNil)
+	qt.Assert(t, v.History, qt.HasLen, 2)
+
+	_, code = c.Request(http.MethodPost, otherJWT, nil, "tools", toolID, "valuations", "depreciate")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = c.Request(http.MethodPost, ownerJWT, nil, "tools", toolID, "valuations", "depreciate")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	v = valuations(ownerJWT)
+	qt.Assert(t, v.EstimatedValue, qt.Equals, uint64(270))
+	qt.Assert(t, v.SuggestedValue, qt.IsNil)
+	qt.Assert(t, v.History, qt.HasLen, 3)
+	qt.Assert(t, v.History[0].Source, qt.Equals, "DEPRECIATION")
+	qt.Assert(t, v.History[0].Previous, qt.Equals, uint64(300))
+
+	// The history follows the tool when its title changes
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"version": c.ToolVersion(ownerJWT, toolID),
+		"title":   "Big chainsaw",
+	}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var editResp struct {
+		Data struct {
+			ID int64 `json:"id"`
+		} `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &editResp), qt.IsNil)
+	toolID = fmt.Sprint(editResp.Data.ID)
+	qt.Assert(t, valuations(ownerJWT).History, qt.HasLen, 3)
+}
+
+func TestToolSearchFacets(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("facets-owner@test.com", "owner", "ownerpass")
+	searcherJWT := c.RegisterAndLogin("facets-searcher@test.com", "searcher", "searcherpass")
+	c.CreateTool(ownerJWT, "Drill")
+	c.CreateTool(ownerJWT, "Hammer Drill")
+	sawID := c.CreateTool(ownerJWT, "Saw")
+	_, code := c.Request(http.MethodPost, ownerJWT, map[string]interface{}{"note": "New blade"},
+		"tools", fmt.Sprint(sawID), "maintenance")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	facets := func(query string) api.ToolSearchFacets {
+		resp, code := c.Request(http.MethodGet, searcherJWT, nil, "tools/search/facets?"+query)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var facetsResp struct {
+			Data api.ToolSearchFacets `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &facetsResp), qt.IsNil)
+		return facetsResp.Data
+	}
+
+	// The test tools cost 10 per day and are at the location of the users
+	f := facets("")
+	qt.Assert(t, f.Total, qt.Equals, int64(3))
+	qt.Assert(t, f.Categories, qt.DeepEquals, []*api.CategoryFacet{{ID: 1, Count: 3}})
+	qt.Assert(t, f.Prices, qt.HasLen, 6)
+	qt.Assert(t, f.Prices[2].Min, qt.Equals, int64(10))
+	qt.Assert(t, f.Prices[2].Count, qt.Equals, int64(3))
+	qt.Assert(t, f.Distances[0].Count, qt.Equals, int64(3))
+	qt.Assert(t, f.Available, qt.Equals, int64(2))
+	qt.Assert(t, f.InMaintenance, qt.Equals, int64(1))
+
+	// The search filters apply to the counts
+	f = facets("term=Drill&distance=3000")
+	qt.Assert(t, f.Total, qt.Equals, int64(2))
+	qt.Assert(t, f.Distances, qt.HasLen, 2)
+	qt.Assert(t, f.Available, qt.Equals, int64(2))
+	qt.Assert(t, facets("maxCost=5").Total, qt.Equals, int64(0))
+
+	_, code = c.Request(http.MethodGet, searcherJWT, nil, "tools/search/facets?distance=far")
+	qt.Assert(t, code, qt.Equals, 400)
+}
+
+func TestToolDrafts(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("draft-owner@test.com", "owner", "ownerpass")
+	otherJWT := c.RegisterAndLogin("draft-other@test.com", "other", "otherpass")
+
+	// The drafts can be created without image, location nor valuation
+	resp, code := c.Request(http.MethodPost, ownerJWT, map[string]interface{}{
+		"title":       "Unfinished sander",
+		"description": "Test tool",
+		"mayBeFree":   true,
+		"askWithFee":  false,
+		"cost":        10,
+		"category":    1,
+		"status":      "draft",
+	}, "tools")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var idResp struct {
+		Data api.ToolID `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &idResp), qt.IsNil)
+	toolID := fmt.Sprint(idResp.Data.ID)
+
+	getTool := func(jwt string) (api.Tool, int) {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "tools", toolID)
+		var toolResp struct {
+			Data api.Tool `json:"data"`
+		}
+		if code == 200 {
+			qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+		}
+		return toolResp.Data, code
+	}
+	searchCount := func() int {
+		resp, code := c.Request(http.MethodGet, otherJWT, nil, "tools/search?term=sander")
+		qt.Assert(t, code, qt.Equals, 200)
+		var searchResp struct {
+			Data struct {
+				Tools []api.Tool `json:"tools"`
+			} `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &searchResp), qt.IsNil)
+		return len(searchResp.Data.Tools)
+	}
+
+	// The draft is only visible to its owner
+	tool, code := getTool(ownerJWT)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, tool.Status, qt.Equals, string(db.ToolStatusDraft))
+	_, code = getTool(otherJWT)
+	qt.Assert(t, code, qt.Equals, 404)
+	qt.Assert(t, searchCount(), qt.Equals, 0)
+	resp, code = c.Request(http.MethodPost, otherJWT, map[string]interface{}{
+		"toolId":    toolID,
+		"startDate": time.Now().Add(24 * time.Hour).Unix(),
+		"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+		"contact":   "other@test.com",
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.draft")
+
+	// Only the complete tools can be published
+	_, code = c.Request(http.MethodPost, otherJWT, nil, "tools", toolID, "publish")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = c.Request(http.MethodPost, ownerJWT, nil, "tools", toolID, "publish")
+	qt.Assert(t, code, qt.Equals, 400)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.incomplete")
+	var incompleteResp struct {
+		Data api.IncompleteTool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &incompleteResp), qt.IsNil)
+	qt.Assert(t, incompleteResp.Data.Missing, qt.DeepEquals, []string{"images", "location", "estimatedValue"})
+
+	var pixel bytes.Buffer
+	qt.Assert(t, png.Encode(&pixel, image.NewRGBA(image.Rect(0, 0, 1, 1))), qt.IsNil)
+	resp, code = c.Request(http.MethodPost, ownerJWT, map[string]interface{}{
+		"name":    "pixel",
+		"content": pixel.Bytes(),
+	}, "images")
+	qt.Assert(t, code, qt.Equals, 200)
+	var imageResp struct {
+		Data struct {
+			Hash string `json:"hash"`
+		} `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &imageResp), qt.IsNil)
+	resp, code = c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"images":         []string{imageResp.Data.Hash},
+		"estimatedValue": 80,
+		"location":       map[string]interface{}{"latitude": 41695384, "longitude": 2492793},
+		"version":        c.ToolVersion(ownerJWT, toolID),
+	}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+
+	// Once published, it is found by the other users
+	resp, code = c.Request(http.MethodPost, ownerJWT, nil, "tools", toolID, "publish")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	tool, code = getTool(otherJWT)
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, tool.Status, qt.Equals, "")
+	qt.Assert(t, searchCount(), qt.Equals, 1)
+	resp, code = c.Request(http.MethodPost, ownerJWT, nil, "tools", toolID, "publish")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "tool.not_draft")
+}
+
+func TestToolListingQuality(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("quality-owner@test.com", "owner", "ownerpass")
+	otherJWT := c.RegisterAndLogin("quality-other@test.com", "other", "otherpass")
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Plain hammer"))
+
+	getTool := func(jwt string) api.Tool {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "tools", toolID)
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var toolResp struct {
+			Data api.Tool `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+		return toolResp.Data
+	}
+
+	// The owner gets the hints for the missing photos and the short description
+	quality := getTool(ownerJWT).Quality
+	qt.Assert(t, quality, qt.IsNotNil)
+	qt.Assert(t, quality.Score, qt.Equals, 50)
+	qt.Assert(t, quality.Hints, qt.DeepEquals, []string{"addPhotos", "extendDescription"})
+
+	resp, code := c.Request(http.MethodPut, ownerJWT, map[string]interface{}{
+		"description": strings.Repeat("A solid hammer with a wooden handle. ", 6),
+		"version":     c.ToolVersion(ownerJWT, toolID),
+	}, "tools", toolID)
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	quality = getTool(ownerJWT).Quality
+	qt.Assert(t, quality.Score, qt.Equals, 75)
+	qt.Assert(t, quality.Hints, qt.DeepEquals, []string{"addPhotos"})
+
+	// The other users don't get the quality
+	qt.Assert(t, getTool(otherJWT).Quality, qt.IsNil)
+}
@@ -1,13 +1,23 @@
 package test
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/emprius/emprius-app-backend/api"
+	"github.com/emprius/emprius-app-backend/db"
 	"github.com/emprius/emprius-app-backend/test/utils"
 	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestUser(t *testing.T) {
@@ -61,24 +71,30 @@ func TestUser(t *testing.T) {
 		// Update profile
 		_, code = c.Request(http.MethodPost, user1JWT,
 			map[string]interface{}{
-				"name":      "Updated User1",
-				"community": "Updated Community",
+				"name": "Updated User1",
 				"location": map[string]int64{
 					"latitude":  41695384000,
 					"longitude": 2492793000,
 				},
+				"version": c.ProfileVersion(user1JWT),
 			},
 			"profile",
 		)
 		qt.Assert(t, code, qt.Equals, 200)
 
+		// The community cannot be changed in the profile
+		resp, code = c.Request(http.MethodPost, user1JWT,
+			map[string]interface{}{"community": "Updated Community", "version": c.ProfileVersion(user1JWT)}, "profile")
+		qt.Assert(t, code, qt.Equals, 403)
+		qt.Assert(t, c.ErrorCode(resp), qt.Equals, "community.change_not_allowed")
+
 		// Verify profile update
 		resp, code = c.Request(http.MethodGet, user1JWT, nil, "profile")
 		qt.Assert(t, code, qt.Equals, 200)
 		err = json.Unmarshal(resp, &profileResp)
 		qt.Assert(t, err, qt.IsNil)
 		qt.Assert(t, profileResp.Data.Name, qt.Equals, "Updated User1")
-		qt.Assert(t, profileResp.Data.Community, qt.Equals, "Updated Community")
+		qt.Assert(t, profileResp.Data.Community, qt.Equals, "")
 
 		// Get other user's profile
 		var user1ID string
@@ -117,3 +133,818 @@ func TestUser(t *testing.T) {
 		qt.Assert(t, refreshResp.Data.Token, qt.Not(qt.IsNil))
 	})
 }
+
+func TestDeleteAccount(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	toolID := c.CreateTool(ownerJWT, "Ladder")
+
+	resp, code := c.Request(http.MethodPost, renterJWT,
+		map[string]interface{}{
+			"toolId":    fmt.Sprint(toolID),
+			"startDate": time.Now().Add(24 * time.Hour).Unix(),
+			"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+			"contact":   "renter@test.com",
+		},
+		"bookings",
+	)
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+
+	t.Run("Export", func(t *testing.T) {
+		resp, code := c.Request(http.MethodGet, ownerJWT, nil, "profile", "export")
+		qt.Assert(t, code, qt.Equals, 200)
+		var exportResp struct {
+			Data api.ProfileExport `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &exportResp), qt.IsNil)
+		qt.Assert(t, exportResp.Data.Profile.Email, qt.Equals, "owner@test.com")
+		qt.Assert(t, exportResp.Data.Tools, qt.HasLen, 1)
+		qt.Assert(t, exportResp.Data.Bookings, qt.HasLen, 1)
+
+		_, code = c.Request(http.MethodGet, ownerJWT, nil, "profile", "export?format=zip")
+		qt.Assert(t, code, qt.Equals, 200)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		_, code := c.Request(http.MethodDelete, ownerJWT, map[string]string{"password": "wrong"}, "profile")
+		qt.Assert(t, code, qt.Equals, 400)
+
+		_, code = c.Request(http.MethodDelete, ownerJWT, map[string]string{"password": "ownerpass"}, "profile")
+		qt.Assert(t, code, qt.Equals, 200)
+
+		// The user can no longer log in and its tools are gone
+		_, code = c.Request(http.MethodPost, "", &api.Login{Email: "owner@test.com", Password: "ownerpass"}, "login")
+		qt.Assert(t, code, qt.Equals, 400)
+		_, code = c.Request(http.MethodGet, renterJWT, nil, "tools", fmt.Sprint(toolID))
+		qt.Assert(t, code, qt.Equals, 404)
+
+		// The open booking was cancelled
+		resp, code := c.Request(http.MethodGet, renterJWT, nil, "bookings", bookingResp.Data.ID)
+		qt.Assert(t, code, qt.Equals, 200)
+		var booking struct {
+			Data api.BookingResponse `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &booking), qt.IsNil)
+		qt.Assert(t, booking.Data.BookingStatus, qt.Equals, "CANCELLED")
+	})
+}
+
+func TestPublicProfile(t *testing.T) {
+	c := utils.NewTestService(t)
+
+	ownerJWT, ownerID := c.RegisterAndLoginWithID("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+	toolID := c.CreateTool(ownerJWT, "Drill")
+
+	resp, code := c.Request(http.MethodPost, renterJWT,
+		map[string]interface{}{
+			"toolId":    fmt.Sprint(toolID),
+			"startDate": time.Now().Add(24 * time.Hour).Unix(),
+			"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+			"contact":   "renter@test.com",
+		},
+		"bookings",
+	)
+	qt.Assert(t, code, qt.Equals, 200)
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	bookingID := bookingResp.Data.ID
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", bookingID, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", bookingID, "return")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// Ratings are recorded once per party
+	rating := map[string]interface{}{"rating": 4, "bookingId": bookingID}
+	_, code = c.Request(http.MethodPost, renterJWT, rating, "bookings", "rates")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodPost, renterJWT, rating, "bookings", "rates")
+	qt.Assert(t, code, qt.Equals, 400)
+
+	getProfile := func(jwt string) api.PublicProfile {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "users", ownerID, "profile")
+		qt.Assert(t, code, qt.Equals, 200)
+		var profileResp struct {
+			Data api.PublicProfile `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &profileResp), qt.IsNil)
+		return profileResp.Data
+	}
+
+	profile := getProfile(renterJWT)
+	qt.Assert(t, profile.Name, qt.Equals, "owner")
+	qt.Assert(t, profile.Stats.ToolsShared, qt.Equals, int64(1))
+	qt.Assert(t, profile.Stats.CompletedAsOwner, qt.Equals, int64(1))
+	qt.Assert(t, profile.Stats.CompletedAsRenter, qt.Equals, int64(0))
+	qt.Assert(t, profile.Stats.OwnerRatings, qt.Equals, int64(1))
+	qt.Assert(t, *profile.Stats.OwnerRating, qt.Equals, 4.0)
+	qt.Assert(t, profile.Stats.RenterRating, qt.IsNil)
+	qt.Assert(t, profile.MemberSince.IsZero(), qt.IsFalse)
+
+	// The community is hidden from others if the user asks so
+	c.SetCommunity(ownerJWT, "makers")
+	_, code = c.Request(http.MethodPost, ownerJWT,
+		map[string]interface{}{"hideCommunity": true, "version": c.ProfileVersion(ownerJWT)}, "profile")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, getProfile(renterJWT).Community, qt.Equals, "")
+	qt.Assert(t, getProfile(ownerJWT).Community, qt.Equals, "makers")
+}
+
+func TestDevices(t *testing.T) {
+	c := utils.NewTestService(t)
+	jwt := c.RegisterAndLogin("devices@test.com", "devices", "devicespass")
+	otherJWT := c.RegisterAndLogin("other@test.com", "other", "otherpass")
+
+	// Register an FCM device and a Web Push subscription
+	_, code := c.Request(http.MethodPost, jwt, &api.DeviceRequest{Platform: "fcm", Token: "fcm-token"}, "profile", "devices")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodPost, jwt, &api.DeviceRequest{
+		Platform: "webpush",
+		Token:    "https://push.example.com/send/abc",
+		P256dh:   "p256dh",
+		Auth:     "auth",
+	}, "profile", "devices")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// Invalid devices are rejected
+	_, code = c.Request(http.MethodPost, jwt, &api.DeviceRequest{Platform: "apns", Token: "token"}, "profile", "devices")
+	qt.Assert(t, code, qt.Equals, 400)
+	_, code = c.Request(http.MethodPost, jwt, &api.DeviceRequest{
+		Platform: "webpush",
+		Token:    "https://push.example.com/send/def",
+	}, "profile", "devices")
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// A token registered again moves to the new user
+	_, code = c.Request(http.MethodPost, otherJWT, &api.DeviceRequest{Platform: "fcm", Token: "fcm-token"}, "profile", "devices")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	resp, code := c.Request(http.MethodGet, jwt, nil, "profile", "devices")
+	qt.Assert(t, code, qt.Equals, 200)
+	var devicesResp struct {
+		Data []*api.Device `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &devicesResp), qt.IsNil)
+	qt.Assert(t, devicesResp.Data, qt.HasLen, 1)
+	qt.Assert(t, devicesResp.Data[0].Platform, qt.Equals, "webpush")
+
+	// Devices can only be deleted by their user
+	_, code = c.Request(http.MethodDelete, otherJWT, nil, "profile", "devices", devicesResp.Data[0].ID)
+	qt.Assert(t, code, qt.Equals, 404)
+	_, code = c.Request(http.MethodDelete, jwt, nil, "profile", "devices", devicesResp.Data[0].ID)
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodGet, jwt, nil, "profile", "devices")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &devicesResp), qt.IsNil)
+	qt.Assert(t, devicesResp.Data, qt.HasLen, 0)
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("renter@test.com", "renter", "renterpass")
+
+	getPreferences := func() api.NotificationPreferences {
+		resp, code := c.Request(http.MethodGet, ownerJWT, nil, "profile", "notification-preferences")
+		qt.Assert(t, code, qt.Equals, 200)
+		var prefsResp struct {
+			Data api.NotificationPreferences `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &prefsResp), qt.IsNil)
+		return prefsResp.Data
+	}
+
+	// Every type is listed with its default channels
+	prefs := getPreferences()
+	qt.Assert(t, prefs[db.NotificationBookingRequest], qt.Equals,
+		db.NotificationChannels{Push: true, InApp: true, Telegram: true})
+	qt.Assert(t, prefs[db.NotificationRatingReminder], qt.Equals, db.NotificationChannels{Email: true, Push: true, InApp: true})
+
+	// Only the given types are updated
+	_, code := c.Request(http.MethodPut, ownerJWT, api.NotificationPreferences{
+		db.NotificationBookingRequest: {Email: true},
+	}, "profile", "notification-preferences")
+	qt.Assert(t, code, qt.Equals, 200)
+	prefs = getPreferences()
+	qt.Assert(t, prefs[db.NotificationBookingRequest], qt.Equals, db.NotificationChannels{Email: true})
+	qt.Assert(t, prefs[db.NotificationRatingReminder], qt.Equals, db.NotificationChannels{Email: true, Push: true, InApp: true})
+
+	_, code = c.Request(http.MethodPut, ownerJWT, map[string]any{
+		"UNKNOWN": db.NotificationChannels{},
+	}, "profile", "notification-preferences")
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// The booking requests are no longer notified in-app
+	toolID := c.CreateTool(ownerJWT, "Preferences Tool")
+	_, code = c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+		"toolId":    fmt.Sprint(toolID),
+		"startDate": time.Now().Add(24 * time.Hour).Unix(),
+		"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+		"contact":   "test@example.com",
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code := c.Request(http.MethodGet, ownerJWT, nil, "profile", "notifications")
+	qt.Assert(t, code, qt.Equals, 200)
+	var notificationsResp struct {
+		Data api.NotificationsWrapper `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &notificationsResp), qt.IsNil)
+	qt.Assert(t, notificationsResp.Data.Notifications, qt.HasLen, 0)
+}
+
+func TestDigestPreferences(t *testing.T) {
+	c := utils.NewTestService(t)
+	jwt := c.RegisterAndLogin("digest@test.com", "digest", "digestpass")
+
+	getDigest := func() api.DigestPreferences {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "profile", "digest")
+		qt.Assert(t, code, qt.Equals, 200)
+		var digestResp struct {
+			Data api.DigestPreferences `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &digestResp), qt.IsNil)
+		return digestResp.Data
+	}
+
+	// The digest is disabled by default
+	qt.Assert(t, getDigest(), qt.DeepEquals, api.DigestPreferences{Radius: 10000})
+
+	_, code := c.Request(http.MethodPut, jwt, api.DigestPreferences{
+		Enabled: true, Radius: 5000, Community: true,
+	}, "profile", "digest")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, getDigest(), qt.DeepEquals, api.DigestPreferences{Enabled: true, Radius: 5000, Community: true})
+
+	// Without radius the default one is used
+	_, code = c.Request(http.MethodPut, jwt, api.DigestPreferences{Enabled: true}, "profile", "digest")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, getDigest().Radius, qt.Equals, 10000)
+
+	_, code = c.Request(http.MethodPut, jwt, api.DigestPreferences{Radius: 500000}, "profile", "digest")
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// The unsubscribe links need a valid token, not a login
+	resp, code := c.Request(http.MethodGet, "", nil, "digest", "unsubscribe?token=unknown")
+	qt.Assert(t, code, qt.Equals, 404)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "digest.token_not_found")
+	_, code = c.Request(http.MethodGet, "", nil, "digest", "unsubscribe")
+	qt.Assert(t, code, qt.Equals, 400)
+}
+
+func TestTelegram(t *testing.T) {
+	c := utils.NewTestService(t)
+	jwt := c.RegisterAndLogin("telegram@test.com", "telegram", "telegrampass")
+
+	// Without a bot the channel is disabled
+	resp, code := c.Request(http.MethodGet, jwt, nil, "profile", "telegram")
+	qt.Assert(t, code, qt.Equals, 200)
+	var statusResp struct {
+		Data api.TelegramStatus `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &statusResp), qt.IsNil)
+	qt.Assert(t, statusResp.Data, qt.DeepEquals, api.TelegramStatus{})
+
+	resp, code = c.Request(http.MethodPost, jwt, nil, "profile", "telegram", "link")
+	qt.Assert(t, code, qt.Equals, 404)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "telegram.disabled")
+	resp, code = c.Request(http.MethodPost, "", map[string]any{"update_id": 1}, "telegram", "webhook")
+	qt.Assert(t, code, qt.Equals, 404)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "telegram.disabled")
+
+	_, code = c.Request(http.MethodDelete, jwt, nil, "profile", "telegram")
+	qt.Assert(t, code, qt.Equals, 200)
+}
+
+func TestAuditLog(t *testing.T) {
+	c := utils.NewTestService(t)
+	adminJWT, adminID := c.RegisterAndLoginWithID("audit-admin@test.com", "auditadmin", "adminpass")
+	userJWT, userID := c.RegisterAndLoginWithID("audit-user@test.com", "audituser", "userpass")
+	c.MakeAdmin(adminID)
+
+	// Failed logins are recorded too
+	_, code := c.Request(http.MethodPost, "", &api.Login{Email: "audit-user@test.com", Password: "wrong"}, "login")
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// Only the admins can change roles and read the log
+	resp, code := c.Request(http.MethodPut, userJWT, api.UserRoleRequest{Role: "admin"}, "admin", "users", userID, "role")
+	qt.Assert(t, code, qt.Equals, 403, qt.Commentf("Response: %s", resp))
+	_, code = c.Request(http.MethodGet, userJWT, nil, "admin", "audit")
+	qt.Assert(t, code, qt.Equals, 403)
+
+	_, code = c.Request(http.MethodPut, adminJWT, api.UserRoleRequest{Role: "owner"}, "admin", "users", userID, "role")
+	qt.Assert(t, code, qt.Equals, 400)
+	_, code = c.Request(http.MethodPut, adminJWT, api.UserRoleRequest{}, "admin", "users", adminID, "role")
+	qt.Assert(t, code, qt.Equals, 400)
+	_, code = c.Request(http.MethodPut, adminJWT, api.UserRoleRequest{Role: "admin"}, "admin", "users", userID, "role")
+	qt.Assert(t, code, qt.Equals, 200)
+	_, code = c.Request(http.MethodGet, userJWT, nil, "admin", "audit")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	resp, code = c.Request(http.MethodGet, adminJWT, nil, "admin", "audit?target="+userID)
+	qt.Assert(t, code, qt.Equals, 200)
+	var logResp struct {
+		Data api.AuditLogWrapper `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &logResp), qt.IsNil)
+	actions := []db.AuditAction{}
+	for _, entry := range logResp.Data.Entries {
+		actions = append(actions, entry.Action)
+	}
+	// The newest first: the role change, the failed login and the login of the registration
+	qt.Assert(t, actions, qt.DeepEquals, []db.AuditAction{db.AuditRoleChange, db.AuditLoginFailed, db.AuditLogin})
+	qt.Assert(t, logResp.Data.Entries[0].ActorID.Hex(), qt.Equals, adminID)
+	qt.Assert(t, logResp.Data.Entries[0].IP, qt.Not(qt.Equals), "")
+
+	_, code = c.Request(http.MethodGet, adminJWT, nil, "admin", "audit?from=yesterday")
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// The export has one entry per line
+	resp, code = c.Request(http.MethodGet, adminJWT, nil, "admin", "audit", "export?action=user.role_change")
+	qt.Assert(t, code, qt.Equals, 200)
+	lines := strings.Split(strings.TrimSpace(string(resp)), "\n")
+	qt.Assert(t, lines, qt.HasLen, 1)
+	var entry db.AuditEntry
+	qt.Assert(t, json.Unmarshal([]byte(lines[0]), &entry), qt.IsNil)
+	qt.Assert(t, entry.TargetID, qt.Equals, userID)
+}
+
+func TestTermsOfService(t *testing.T) {
+	c := utils.NewTestService(t)
+	adminJWT, adminID := c.RegisterAndLoginWithID("terms-admin@test.com", "termsadmin", "adminpass")
+	userJWT := c.RegisterAndLogin("terms-user@test.com", "termsuser", "userpass")
+	c.MakeAdmin(adminID)
+
+	// Without published terms the writes are not gated
+	resp, code := c.Request(http.MethodGet, "", nil, "info", "terms")
+	qt.Assert(t, code, qt.Equals, 404)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "terms.not_found")
+	c.CreateTool(userJWT, "Before the terms")
+
+	_, code = c.Request(http.MethodPost, userJWT, api.TermsRequest{URL: "https://example.com/terms"}, "admin", "terms")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = c.Request(http.MethodPost, adminJWT, api.TermsRequest{URL: "not a url"}, "admin", "terms")
+	qt.Assert(t, code, qt.Equals, 422)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "terms.invalid")
+	publish := func(url string) int {
+		resp, code := c.Request(http.MethodPost, adminJWT, api.TermsRequest{URL: url, Summary: "New terms"}, "admin", "terms")
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", resp))
+		var termsResp struct {
+			Data db.TermsVersion `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &termsResp), qt.IsNil)
+		return termsResp.Data.Version
+	}
+	qt.Assert(t, publish("https://example.com/terms/1"), qt.Equals, 1)
+
+	// The writes are rejected until the terms are accepted, the reads are allowed
+	toolBody := map[string]any{"title": "After the terms", "description": "Tool", "estimatedValue": 10}
+	resp, code = c.Request(http.MethodPost, userJWT, toolBody, "tools")
+	qt.Assert(t, code, qt.Equals, 403)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "terms.not_accepted")
+	_, code = c.Request(http.MethodGet, userJWT, nil, "profile")
+	qt.Assert(t, code, qt.Equals, 200)
+
+	// The login tells the terms must be accepted
+	resp, code = c.Request(http.MethodPost, "", &api.Login{Email: "terms-user@test.com", Password: "userpass"}, "login")
+	qt.Assert(t, code, qt.Equals, 200)
+	var loginResp struct {
+		Data api.LoginResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &loginResp), qt.IsNil)
+	qt.Assert(t, loginResp.Data.TermsVersion, qt.Equals, 1)
+
+	// A newer version is published while the user reads the first one
+	qt.Assert(t, publish("https://example.com/terms/2"), qt.Equals, 2)
+	resp, code = c.Request(http.MethodPost, userJWT, api.AcceptTermsRequest{Version: 1}, "profile", "accept-terms")
+	qt.Assert(t, code, qt.Equals, 409)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "terms.outdated")
+	resp, code = c.Request(http.MethodPost, userJWT, api.AcceptTermsRequest{Version: 2}, "profile", "accept-terms")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", resp))
+	var statusResp struct {
+		Data api.TermsStatus `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &statusResp), qt.IsNil)
+	qt.Assert(t, statusResp.Data.AcceptedVersion, qt.Equals, 2)
+	qt.Assert(t, statusResp.Data.AcceptanceRequired, qt.IsFalse)
+	qt.Assert(t, statusResp.Data.Acceptances, qt.HasLen, 1)
+	c.CreateTool(userJWT, "After the terms")
+
+	// Registering with the current version accepts it
+	_, code = c.Request(http.MethodPost, "", &api.Register{
+		UserEmail:            "terms-new@test.com",
+		RegisterAuthToken:    utils.RegisterToken,
+		UserProfile:          api.UserProfile{Name: "termsnew", Community: "testCommunity", Password: "newpass"},
+		AcceptedTermsVersion: 2,
+	}, "register")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodPost, "", &api.Login{Email: "terms-new@test.com", Password: "newpass"}, "login")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &loginResp), qt.IsNil)
+	qt.Assert(t, loginResp.Data.TermsVersion, qt.Equals, 0)
+	resp, code = c.Request(http.MethodGet, loginResp.Data.Token, nil, "profile", "terms")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, json.Unmarshal(resp, &statusResp), qt.IsNil)
+	qt.Assert(t, statusResp.Data.AcceptanceRequired, qt.IsFalse)
+
+	resp, code = c.Request(http.MethodGet, adminJWT, nil, "admin", "terms")
+	qt.Assert(t, code, qt.Equals, 200)
+	var versionsResp struct {
+		Data []db.TermsVersion `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &versionsResp), qt.IsNil)
+	qt.Assert(t, versionsResp.Data, qt.HasLen, 2)
+	qt.Assert(t, versionsResp.Data[0].Version, qt.Equals, 2)
+}
+
+func TestInvites(t *testing.T) {
+	c := utils.NewTestService(t)
+	inviterJWT, inviterID := c.RegisterAndLoginWithID("inviter@test.com", "inviter", "inviterpass")
+	adminJWT, adminID := c.RegisterAndLoginWithID("admin@test.com", "admin", "adminpass")
+	c.MakeAdmin(adminID)
+
+	getInvites := func() api.InvitesWrapper {
+		resp, code := c.Request(http.MethodGet, inviterJWT, nil, "profile", "invites")
+		qt.Assert(t, code, qt.Equals, 200)
+		var invitesResp struct {
+			Data api.InvitesWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &invitesResp), qt.IsNil)
+		return invitesResp.Data
+	}
+	qt.Assert(t, getInvites().Invites, qt.HasLen, 0)
+
+	resp, code := c.Request(http.MethodPost, inviterJWT, nil, "profile", "invites")
+	qt.Assert(t, code, qt.Equals, 200)
+	var inviteResp struct {
+		Data api.Invite `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &inviteResp), qt.IsNil)
+	invite := inviteResp.Data
+	qt.Assert(t, invite.Code, qt.Not(qt.Equals), "")
+	qt.Assert(t, invite.Status, qt.Equals, string(db.InviteStatusUnused))
+
+	// The next code must wait the cooldown
+	_, code = c.Request(http.MethodPost, inviterJWT, nil, "profile", "invites")
+	qt.Assert(t, code, qt.Equals, 429)
+	qt.Assert(t, getInvites().NextInviteAt, qt.IsNotNil)
+
+	register := func(email, token string) int {
+		_, code := c.Request(http.MethodPost, "", &api.Register{
+			UserEmail:         email,
+			RegisterAuthToken: token,
+			UserProfile: api.UserProfile{
+				Name:      email,
+				Community: "testCommunity",
+				Password:  "inviteepass",
+				Location:  &api.Location{Latitude: 41695384, Longitude: 2492793},
+			},
+		}, "register")
+		return code
+	}
+
+	// The code is case insensitive and can only be used once
+	qt.Assert(t, register("invitee@test.com", strings.ToLower(invite.Code)), qt.Equals, 200)
+	qt.Assert(t, register("other@test.com", invite.Code), qt.Equals, 400)
+	qt.Assert(t, register("other@test.com", "UNKNOWN"), qt.Equals, 400)
+
+	invites := getInvites().Invites
+	qt.Assert(t, invites, qt.HasLen, 1)
+	qt.Assert(t, invites[0].Status, qt.Equals, string(db.InviteStatusUsed))
+	qt.Assert(t, invites[0].UsedByName, qt.Equals, "invitee@test.com")
+	qt.Assert(t, invites[0].UsedAt, qt.IsNotNil)
+	qt.Assert(t, invites[0].UsedByActive, qt.IsFalse)
+	qt.Assert(t, getInvites().Referrals, qt.Equals, api.ReferralStats{Invited: 1, Active: 0})
+
+	// The invitee becomes active sharing a tool
+	resp, code = c.Request(http.MethodPost, "", &api.Login{Email: "invitee@test.com", Password: "inviteepass"}, "login")
+	qt.Assert(t, code, qt.Equals, 200)
+	var loginResp struct {
+		Data api.LoginResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &loginResp), qt.IsNil)
+	c.CreateTool(loginResp.Data.Token, "invitee tool")
+	invites = getInvites().Invites
+	qt.Assert(t, invites[0].UsedByActive, qt.IsTrue)
+	qt.Assert(t, getInvites().Referrals, qt.Equals, api.ReferralStats{Invited: 1, Active: 1})
+
+	// Used codes can't be revoked
+	_, code = c.Request(http.MethodDelete, inviterJWT, nil, "profile", "invites", invite.Code)
+	qt.Assert(t, code, qt.Equals, 404)
+
+	// Only admins can see the invite tree
+	_, code = c.Request(http.MethodGet, inviterJWT, nil, "admin", "invites")
+	qt.Assert(t, code, qt.Equals, 403)
+	resp, code = c.Request(http.MethodGet, adminJWT, nil, "admin", "invites")
+	qt.Assert(t, code, qt.Equals, 200)
+	var treeResp struct {
+		Data api.InviteTreeResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &treeResp), qt.IsNil)
+	qt.Assert(t, treeResp.Data.Roots, qt.HasLen, 1)
+	qt.Assert(t, treeResp.Data.Roots[0].UserID, qt.Equals, inviterID)
+	qt.Assert(t, treeResp.Data.Roots[0].Name, qt.Equals, "inviter")
+	qt.Assert(t, treeResp.Data.Roots[0].Invited, qt.HasLen, 1)
+	qt.Assert(t, treeResp.Data.Roots[0].Invited[0].Name, qt.Equals, "invitee@test.com")
+}
+
+func TestCommunityInvites(t *testing.T) {
+	c := utils.NewTestService(t)
+	inviterJWT := c.RegisterAndLogin("inviter@test.com", "inviter", "inviterpass")
+
+	// Only the members of a community can invite to it
+	_, code := c.Request(http.MethodPost, inviterJWT, api.CreateInviteRequest{Community: true}, "profile", "invites")
+	qt.Assert(t, code, qt.Equals, 403)
+	c.SetCommunity(inviterJWT, "gardeners")
+
+	resp, code := c.Request(http.MethodPost, inviterJWT, api.CreateInviteRequest{Community: true}, "profile", "invites")
+	qt.Assert(t, code, qt.Equals, 200)
+	var inviteResp struct {
+		Data api.Invite `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &inviteResp), qt.IsNil)
+	qt.Assert(t, inviteResp.Data.Community, qt.Equals, "gardeners")
+
+	// The invitee joins the community of the inviter
+	_, code = c.Request(http.MethodPost, "", &api.Register{
+		UserEmail:         "invitee@test.com",
+		RegisterAuthToken: inviteResp.Data.Code,
+		UserProfile: api.UserProfile{
+			Name:     "invitee",
+			Password: "inviteepass",
+			Location: &api.Location{Latitude: 41695384, Longitude: 2492793},
+		},
+	}, "register")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = c.Request(http.MethodPost, "", &api.Login{Email: "invitee@test.com", Password: "inviteepass"}, "login")
+	qt.Assert(t, code, qt.Equals, 200)
+	var loginResp struct {
+		Data api.LoginResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &loginResp), qt.IsNil)
+	resp, code = c.Request(http.MethodGet, loginResp.Data.Token, nil, "profile")
+	qt.Assert(t, code, qt.Equals, 200)
+	var profileResp struct {
+		Data struct {
+			Community string `json:"community"`
+		} `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &profileResp), qt.IsNil)
+	qt.Assert(t, profileResp.Data.Community, qt.Equals, "gardeners")
+
+	// The inviter is notified
+	resp, code = c.Request(http.MethodGet, inviterJWT, nil, "profile", "notifications")
+	qt.Assert(t, code, qt.Equals, 200)
+	var notificationsResp struct {
+		Data api.NotificationsWrapper `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &notificationsResp), qt.IsNil)
+	qt.Assert(t, notificationsResp.Data.Notifications, qt.HasLen, 1)
+	qt.Assert(t, notificationsResp.Data.Notifications[0].Type, qt.Equals, string(db.NotificationInviteUsed))
+}
+
+func TestUserCommunityChange(t *testing.T) {
+	c := utils.NewTestService(t)
+	adminJWT, adminID := c.RegisterAndLoginWithID("community-admin@test.com", "admin", "adminpass")
+	c.MakeAdmin(adminID)
+	userJWT, userID := c.RegisterAndLoginWithID("community-user@test.com", "user", "userpass")
+	community := func() string {
+		resp, code := c.Request(http.MethodGet, userJWT, nil, "profile")
+		qt.Assert(t, code, qt.Equals, 200)
+		var profileResp struct {
+			Data api.User `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &profileResp), qt.IsNil)
+		return profileResp.Data.Community
+	}
+
+	// Only the admins change the community of the users
+	_, code := c.Request(http.MethodPut, userJWT,
+		api.UserCommunityRequest{Community: "gardeners"}, "admin", "users", userID, "community")
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = c.Request(http.MethodPut, adminJWT,
+		api.UserCommunityRequest{Community: " gardeners "}, "admin", "users", userID, "community")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, community(), qt.Equals, "gardeners")
+
+	// The profile updates keep it
+	_, code = c.Request(http.MethodPost, userJWT,
+		map[string]interface{}{"community": "gardeners", "name": "gardener", "version": c.ProfileVersion(userJWT)}, "profile")
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code := c.Request(http.MethodPost, userJWT,
+		map[string]interface{}{"community": "makers", "version": c.ProfileVersion(userJWT)}, "profile")
+	qt.Assert(t, code, qt.Equals, 403)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "community.change_not_allowed")
+	qt.Assert(t, community(), qt.Equals, "gardeners")
+
+	// An empty community removes the user from it
+	_, code = c.Request(http.MethodPut, adminJWT,
+		api.UserCommunityRequest{}, "admin", "users", userID, "community")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, community(), qt.Equals, "")
+	_, code = c.Request(http.MethodPut, adminJWT,
+		api.UserCommunityRequest{Community: "gardeners"}, "admin", "users", primitive.NewObjectID().Hex(), "community")
+	qt.Assert(t, code, qt.Equals, 404)
+}
+
+func TestUserBlock(t *testing.T) {
+	c := utils.NewTestService(t)
+	adminJWT, adminID := c.RegisterAndLoginWithID("block-admin@test.com", "admin", "adminpass")
+	c.MakeAdmin(adminID)
+	userJWT, userID := c.RegisterAndLoginWithID("block-user@test.com", "user", "userpass")
+	toolID := fmt.Sprint(c.CreateTool(userJWT, "Hammer"))
+	block := func(jwt, id string, blocked bool) ([]byte, int) {
+		return c.Request(http.MethodPut, jwt, api.UserBlockRequest{Blocked: blocked}, "admin", "users", id, "blocked")
+	}
+	editTool := func() ([]byte, int) {
+		return c.Request(http.MethodPut, userJWT, map[string]interface{}{
+			"description": "Claw hammer",
+			"version":     c.ToolVersion(userJWT, toolID),
+		}, "tools", toolID)
+	}
+
+	// Only the admins block users, not themselves
+	_, code := block(userJWT, adminID, true)
+	qt.Assert(t, code, qt.Equals, 403)
+	_, code = block(adminJWT, adminID, true)
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// The blocked users are denied every action
+	_, code = block(adminJWT, userID, true)
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code := editTool()
+	qt.Assert(t, code, qt.Equals, 403)
+	qt.Assert(t, c.ErrorCode(resp), qt.Equals, "user.blocked")
+
+	_, code = block(adminJWT, userID, false)
+	qt.Assert(t, code, qt.Equals, 200)
+	resp, code = editTool()
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+}
+
+func TestUserSearch(t *testing.T) {
+	c := utils.NewTestService(t)
+	aliceJWT := c.RegisterAndLogin("alice@test.com", "alice", "alicepass")
+	bobJWT := c.RegisterAndLogin("bob@test.com", "bob", "bobpass")
+	c.RegisterAndLogin("carol@test.com", "carol", "carolpass")
+	for _, jwt := range []string{aliceJWT, bobJWT} {
+		c.SetCommunity(jwt, "gardeners")
+	}
+
+	search := func(query string) api.UsersWrapper {
+		resp, code := c.Request(http.MethodGet, aliceJWT, nil, "users?"+query)
+		qt.Assert(t, code, qt.Equals, 200)
+		var usersResp struct {
+			Data api.UsersWrapper `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &usersResp), qt.IsNil)
+		return usersResp.Data
+	}
+
+	result := search("")
+	qt.Assert(t, result.Total, qt.Equals, int64(3))
+	for _, u := range result.Users {
+		qt.Assert(t, u.Email, qt.Equals, "")
+		qt.Assert(t, u.Distance, qt.IsNil)
+	}
+
+	result = search("name=BO")
+	qt.Assert(t, result.Users, qt.HasLen, 1)
+	qt.Assert(t, result.Users[0].Name, qt.Equals, "bob")
+
+	qt.Assert(t, search("community=gardeners").Total, qt.Equals, int64(2))
+	qt.Assert(t, search("community=gardeners&name=carol").Total, qt.Equals, int64(0))
+	qt.Assert(t, search("active=true&minRating=50").Total, qt.Equals, int64(3))
+	qt.Assert(t, search("minRating=51").Total, qt.Equals, int64(0))
+
+	result = search("distance=1000&pageSize=2")
+	qt.Assert(t, result.Total, qt.Equals, int64(3))
+	qt.Assert(t, result.Users, qt.HasLen, 2)
+	qt.Assert(t, result.Users[0].Distance, qt.IsNotNil)
+
+	for _, query := range []string{"active=maybe", "minRating=101", "distance=-1", "sort=name"} {
+		_, code := c.Request(http.MethodGet, aliceJWT, nil, "users?"+query)
+		qt.Assert(t, code, qt.Equals, 400, qt.Commentf("query %s", query))
+	}
+}
+
+func TestAvatar(t *testing.T) {
+	c := utils.NewTestService(t)
+	jwt, userID := c.RegisterAndLoginWithID("avatar@test.com", "avatar", "avatarpass")
+
+	// No avatar yet
+	_, code := c.RawRequest(http.MethodGet, "", "", nil, "users", userID, "avatar")
+	qt.Assert(t, code, qt.Equals, 404)
+
+	img := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	var pngData bytes.Buffer
+	qt.Assert(t, png.Encode(&pngData, img), qt.IsNil)
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("avatar", "avatar.png")
+	qt.Assert(t, err, qt.IsNil)
+	_, err = part.Write(pngData.Bytes())
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, writer.Close(), qt.IsNil)
+
+	_, code = c.RawRequest(http.MethodPut, "", writer.FormDataContentType(), body.Bytes(), "profile", "avatar")
+	qt.Assert(t, code, qt.Equals, 401)
+	_, code = c.RawRequest(http.MethodPut, jwt, "application/json", []byte(`{}`), "profile", "avatar")
+	qt.Assert(t, code, qt.Equals, 400)
+	resp, code := c.RawRequest(http.MethodPut, jwt, writer.FormDataContentType(), body.Bytes(), "profile", "avatar")
+	qt.Assert(t, code, qt.Equals, 200)
+	var profileResp struct {
+		Data api.User `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &profileResp), qt.IsNil)
+	qt.Assert(t, profileResp.Data.AvatarURL, qt.Equals, "/users/"+userID+"/avatar")
+
+	// The avatar is public and served in the standard sizes, medium by default
+	for size, pixels := range map[string]int{"": 256, "small": 64, "large": 512} {
+		path := "avatar"
+		if size != "" {
+			path += "?size=" + size
+		}
+		resp, code := c.RawRequest(http.MethodGet, "", "", nil, "users", userID, path)
+		qt.Assert(t, code, qt.Equals, 200)
+		avatar, err := jpeg.Decode(bytes.NewReader(resp))
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, avatar.Bounds().Dx(), qt.Equals, pixels)
+	}
+	_, code = c.RawRequest(http.MethodGet, "", "", nil, "users", userID, "avatar?size=huge")
+	qt.Assert(t, code, qt.Equals, 400)
+
+	// The avatar of the owner is linked from the tools
+	toolID := c.CreateTool(jwt, "Avatar Tool")
+	resp, code = c.Request(http.MethodGet, jwt, nil, "tools", fmt.Sprint(toolID))
+	qt.Assert(t, code, qt.Equals, 200)
+	var toolResp struct {
+		Data api.Tool `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &toolResp), qt.IsNil)
+	qt.Assert(t, toolResp.Data.OwnerAvatarURL, qt.Equals, "/users/"+userID+"/avatar")
+}
+
+func TestOnboarding(t *testing.T) {
+	c := utils.NewTestService(t)
+	ownerJWT := c.RegisterAndLogin("onboarding-owner@test.com", "owner", "ownerpass")
+	renterJWT := c.RegisterAndLogin("onboarding-renter@test.com", "renter", "renterpass")
+
+	onboarding := func(jwt string) map[string]bool {
+		resp, code := c.Request(http.MethodGet, jwt, nil, "profile", "onboarding")
+		qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+		var onboardingResp struct {
+			Data api.Onboarding `json:"data"`
+		}
+		qt.Assert(t, json.Unmarshal(resp, &onboardingResp), qt.IsNil)
+		qt.Assert(t, onboardingResp.Data.Total, qt.Equals, len(onboardingResp.Data.Steps))
+		steps := map[string]bool{}
+		for _, step := range onboardingResp.Data.Steps {
+			steps[step.Step] = step.Completed
+		}
+		return steps
+	}
+
+	// The registered users have a location and a community
+	qt.Assert(t, onboarding(ownerJWT), qt.DeepEquals, map[string]bool{
+		"verifiedEmail": false,
+		"location":      true,
+		"avatar":        false,
+		"firstTool":     false,
+		"community":     true,
+		"firstBooking":  false,
+	})
+	_, code := c.Request(http.MethodGet, "", nil, "profile", "onboarding")
+	qt.Assert(t, code, qt.Equals, 401)
+
+	toolID := fmt.Sprint(c.CreateTool(ownerJWT, "Onboarding drill"))
+	qt.Assert(t, onboarding(ownerJWT)["firstTool"], qt.IsTrue)
+
+	// A returned booking completes the first booking of both parties
+	resp, code := c.Request(http.MethodPost, renterJWT, map[string]interface{}{
+		"toolId":    toolID,
+		"startDate": time.Now().Add(24 * time.Hour).Unix(),
+		"endDate":   time.Now().Add(48 * time.Hour).Unix(),
+		"contact":   "renter@test.com",
+	}, "bookings")
+	qt.Assert(t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var bookingResp struct {
+		Data api.BookingResponse `json:"data"`
+	}
+	qt.Assert(t, json.Unmarshal(resp, &bookingResp), qt.IsNil)
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", "petitions", bookingResp.Data.ID, "accept")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, onboarding(renterJWT)["firstBooking"], qt.IsFalse)
+	_, code = c.Request(http.MethodPost, ownerJWT, nil, "bookings", bookingResp.Data.ID, "return")
+	qt.Assert(t, code, qt.Equals, 200)
+	qt.Assert(t, onboarding(renterJWT)["firstBooking"], qt.IsTrue)
+	qt.Assert(t, onboarding(ownerJWT)["firstBooking"], qt.IsTrue)
+	qt.Assert(t, onboarding(renterJWT)["firstTool"], qt.IsFalse)
+}
@@ -10,14 +10,18 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/emprius/emprius-app-backend/api"
 	"github.com/emprius/emprius-app-backend/db"
+	"github.com/emprius/emprius-app-backend/password"
 	"github.com/emprius/emprius-app-backend/service"
 	qt "github.com/frankban/quicktest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const (
@@ -34,8 +38,10 @@ type TestService struct {
 	c   *http.Client
 }
 
-// NewTestService creates a new test service.
-func NewTestService(t *testing.T) *TestService {
+// NewTestService creates a new test service. The passwords of the test users are not checked for
+// strength and are hashed with cheap parameters, the options can override them and set any other
+// API option.
+func NewTestService(t *testing.T, options ...func(*api.Options)) *TestService {
 	ctx := context.Background()
 
 	// Start MongoDB container
@@ -49,6 +55,11 @@ func NewTestService(t *testing.T) *TestService {
 
 	s, err := service.New(mongoURI, jwtSecret, RegisterToken, true)
 	qt.Assert(t, err, qt.IsNil)
+	s.Options.PasswordPolicy = &password.Policy{MinLength: 8, MaxLength: 128}
+	s.Options.PasswordHashing = &password.Argon2Params{Time: 1, Memory: 1024, Threads: 1}
+	for _, option := range options {
+		option(&s.Options)
+	}
 	rand.NewSource(time.Now().UnixNano())
 	port := 20000 + rand.New(rand.NewSource(time.Now().UnixNano())).Intn(8192)
 	s.Start("127.0.0.1", port)
@@ -67,6 +78,44 @@ func NewTestService(t *testing.T) *TestService {
 func (s *TestService) Request(method, jwt string, jsonBody any, urlPath ...string) ([]byte, int) {
 	body, err := json.Marshal(jsonBody)
 	qt.Assert(s.t, err, qt.IsNil)
+	return s.RawRequest(method, jwt, "application/json", body, urlPath...)
+}
+
+// RawRequest sends a request with a body of the given content type to the service and returns
+// the response body and status code. If jwt is not empty, it will be sent as a Bearer token.
+func (s *TestService) RawRequest(method, jwt, contentType string, body []byte, urlPath ...string) ([]byte, int) {
+	data, _, code := s.send(method, jwt, contentType, body, nil, urlPath...)
+	return data, code
+}
+
+// HeaderRequest sends a request without body and with the given headers to the service, and
+// returns the response body, headers and status code. If jwt is not empty, it will be sent as
+// a Bearer token.
+func (s *TestService) HeaderRequest(method, jwt string, header http.Header, urlPath ...string) ([]byte, http.Header, int) {
+	return s.send(method, jwt, "", nil, header, urlPath...)
+}
+
+// JSONHeaderRequest sends a request with a JSON body and the given headers to the service, and
+// returns the response body, headers and status code. If jwt is not empty, it will be sent as
+// a Bearer token.
+func (s *TestService) JSONHeaderRequest(method, jwt string, jsonBody any, header http.Header,
+	urlPath ...string,
+) ([]byte, http.Header, int) {
+	body, err := json.Marshal(jsonBody)
+	qt.Assert(s.t, err, qt.IsNil)
+	return s.send(method, jwt, "application/json", body, header, urlPath...)
+}
+
+// ErrorCode returns the error code in the header of the response body.
+func (s *TestService) ErrorCode(body []byte) string {
+	var resp api.Response
+	qt.Assert(s.t, json.Unmarshal(body, &resp), qt.IsNil)
+	return resp.Header.ErrorCode
+}
+
+func (s *TestService) send(method, jwt, contentType string, body []byte, header http.Header,
+	urlPath ...string,
+) ([]byte, http.Header, int) {
 	u, err := url.Parse(s.url)
 	qt.Assert(s.t, err, qt.IsNil)
 	// Handle the case where the last path component contains query parameters
@@ -86,8 +135,11 @@ func (s *TestService) Request(method, jwt string, jsonBody any, urlPath ...strin
 	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
 	qt.Assert(s.t, err, qt.IsNil)
 	req.Header = headers
+	for key, values := range header {
+		req.Header[key] = values
+	}
 	if method == http.MethodPost || method == http.MethodPut {
-		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Type", contentType)
 	}
 	resp, err := s.c.Do(req)
 	if err != nil {
@@ -97,7 +149,7 @@ func (s *TestService) Request(method, jwt string, jsonBody any, urlPath ...strin
 	if err != nil {
 		s.t.Logf("read error: %v", err)
 	}
-	return data, resp.StatusCode
+	return data, resp.Header, resp.StatusCode
 }
 
 // RegisterAndLogin registers a new user and returns the JWT token
@@ -159,6 +211,55 @@ func (s *TestService) RegisterAndLoginWithID(email, name, password string) (stri
 	return jwt, profileResponse.Data.ID
 }
 
+// MakeAdmin grants the admin role to the user, admins are only created by the operators.
+func (s *TestService) MakeAdmin(userID string) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	qt.Assert(s.t, err, qt.IsNil)
+	_, err = s.s.Database.UserService.UpdateUser(context.Background(), id, bson.M{"role": db.UserRoleAdmin})
+	qt.Assert(s.t, err, qt.IsNil)
+}
+
+// SetCommunity moves the user to the community, as an admin does, since the users cannot change
+// their community themselves.
+func (s *TestService) SetCommunity(jwt, community string) {
+	resp, code := s.Request(http.MethodGet, jwt, nil, "profile")
+	qt.Assert(s.t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var response struct {
+		Data api.User `json:"data"`
+	}
+	qt.Assert(s.t, json.Unmarshal(resp, &response), qt.IsNil)
+	id, err := primitive.ObjectIDFromHex(response.Data.ID)
+	qt.Assert(s.t, err, qt.IsNil)
+	qt.Assert(s.t, s.s.Database.UserService.SetCommunity(context.Background(), id, community), qt.IsNil)
+}
+
+// UserPassword returns the stored password hash of the user.
+func (s *TestService) UserPassword(userID string) []byte {
+	id, err := primitive.ObjectIDFromHex(userID)
+	qt.Assert(s.t, err, qt.IsNil)
+	user, err := s.s.Database.UserService.GetUserByID(context.Background(), id)
+	qt.Assert(s.t, err, qt.IsNil)
+	return user.Password
+}
+
+// SetUserPassword replaces the stored password hash of the user, i.e. with a hash of a legacy scheme.
+func (s *TestService) SetUserPassword(userID string, hash []byte) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	qt.Assert(s.t, err, qt.IsNil)
+	_, err = s.s.Database.UserService.UpdateUser(context.Background(), id, bson.M{"password": hash})
+	qt.Assert(s.t, err, qt.IsNil)
+}
+
+// AgeToolValuations moves the valuation history of the tool back in time, i.e. to get its
+// yearly depreciation suggested.
+func (s *TestService) AgeToolValuations(toolID any, age time.Duration) {
+	id, err := strconv.ParseInt(fmt.Sprint(toolID), 10, 64)
+	qt.Assert(s.t, err, qt.IsNil)
+	_, err = s.s.Database.ValuationService.Collection.UpdateMany(context.Background(),
+		bson.M{"toolId": id}, bson.M{"$set": bson.M{"createdAt": time.Now().Add(-age)}})
+	qt.Assert(s.t, err, qt.IsNil)
+}
+
 // CreateTool creates a new tool and returns its ID
 func (s *TestService) CreateTool(jwt string, title string) int64 {
 	resp, code := s.Request(http.MethodPost, jwt,
@@ -190,3 +291,27 @@ func (s *TestService) CreateTool(jwt string, title string) int64 {
 	qt.Assert(s.t, err, qt.IsNil)
 	return response.Data.ID
 }
+
+// ToolVersion returns the current version of the tool, required to edit it.
+func (s *TestService) ToolVersion(jwt string, toolID any) int64 {
+	resp, code := s.Request(http.MethodGet, jwt, nil, "tools", fmt.Sprint(toolID))
+	qt.Assert(s.t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var response struct {
+		Data struct {
+			Version int64 `json:"version"`
+		} `json:"data"`
+	}
+	qt.Assert(s.t, json.Unmarshal(resp, &response), qt.IsNil)
+	return response.Data.Version
+}
+
+// ProfileVersion returns the current version of the profile of the user, required to update it.
+func (s *TestService) ProfileVersion(jwt string) int64 {
+	resp, code := s.Request(http.MethodGet, jwt, nil, "profile")
+	qt.Assert(s.t, code, qt.Equals, 200, qt.Commentf("Response: %s", string(resp)))
+	var response struct {
+		Data api.User `json:"data"`
+	}
+	qt.Assert(s.t, json.Unmarshal(resp, &response), qt.IsNil)
+	return response.Data.Version
+}
@@ -0,0 +1,122 @@
+// Package trust computes the trust score of the users, a 0 to 100 figure combining their
+// booking history, the ratings received, the account age, how fast they answer booking
+// requests and the disputes they were involved in.
+package trust
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// bookingsScale is the number of completed bookings giving about two thirds of the bookings component.
+	bookingsScale = 10
+	// matureAccountAge is the account age giving the full age component.
+	matureAccountAge = 365 * 24 * time.Hour
+	// responseTimeScale is the average response time giving half of the response component.
+	responseTimeScale = 24 * time.Hour
+	// neutral is the value of the components without data (e.g. a user never rated).
+	neutral = 0.5
+)
+
+// Weights are the relative weights of the score components. They do not need to add up to one.
+type Weights struct {
+	Bookings     float64
+	Rating       float64
+	Age          float64
+	ResponseTime float64
+	Disputes     float64
+}
+
+// DefaultWeights are the weights used when none are configured.
+var DefaultWeights = Weights{
+	Bookings:     0.3,
+	Rating:       0.3,
+	Age:          0.1,
+	ResponseTime: 0.15,
+	Disputes:     0.15,
+}
+
+// Inputs are the figures of a user the score is computed from.
+type Inputs struct {
+	CompletedBookings int64
+	// Rating is the average rating received (1 to 5), nil if never rated.
+	Rating *float64
+	// AccountAge is the time since the account was created.
+	AccountAge time.Duration
+	// ResponseTime is the average time to accept or deny booking requests, nil if never requested.
+	ResponseTime *time.Duration
+	// Disputes is the number of bookings escalated to the community admins.
+	Disputes int64
+}
+
+// Score returns the trust score (0 to 100) of the inputs with the given weights. Each component
+// is normalized to [0, 1] and the score is their weighted average. Components without data
+// count as neutral, so new users start in the middle of the scale.
+func Score(in Inputs, w Weights) int {
+	total := w.Bookings + w.Rating + w.Age + w.ResponseTime + w.Disputes
+	if total <= 0 {
+		return 0
+	}
+	bookings := 1 - math.Exp(-float64(in.CompletedBookings)/bookingsScale)
+	rating := neutral
+	if in.Rating != nil {
+		rating = clamp((*in.Rating - 1) / 4)
+	}
+	age := clamp(float64(in.AccountAge) / float64(matureAccountAge))
+	response := neutral
+	if in.ResponseTime != nil {
+		response = 1 / (1 + math.Max(0, float64(*in.ResponseTime))/float64(responseTimeScale))
+	}
+	disputes := math.Exp(-float64(in.Disputes))
+
+	score := (w.Bookings*bookings + w.Rating*rating + w.Age*age +
+		w.ResponseTime*response + w.Disputes*disputes) / total
+	return int(math.Round(100 * score))
+}
+
+// ParseWeights parses a comma separated list of component=weight pairs, for example
+// "bookings=0.3,rating=0.3,age=0.1,response=0.15,disputes=0.15". Missing components
+// keep their default weight.
+func ParseWeights(s string) (Weights, error) {
+	w := DefaultWeights
+	if strings.TrimSpace(s) == "" {
+		return w, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			return Weights{}, fmt.Errorf("invalid weight %q, expected component=weight", pair)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || weight < 0 {
+			return Weights{}, fmt.Errorf("invalid weight value %q", value)
+		}
+		switch strings.TrimSpace(name) {
+		case "bookings":
+			w.Bookings = weight
+		case "rating":
+			w.Rating = weight
+		case "age":
+			w.Age = weight
+		case "response":
+			w.ResponseTime = weight
+		case "disputes":
+			w.Disputes = weight
+		default:
+			return Weights{}, fmt.Errorf("unknown trust score component %q", name)
+		}
+	}
+	if w.Bookings+w.Rating+w.Age+w.ResponseTime+w.Disputes <= 0 {
+		return Weights{}, fmt.Errorf("at least one weight must be positive")
+	}
+	return w, nil
+}
+
+// clamp limits the value to [0, 1].
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,69 @@
+package trust
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestScore(t *testing.T) {
+	c := qt.New(t)
+
+	// New users without history get a middle score
+	newUser := Score(Inputs{}, DefaultWeights)
+	c.Assert(newUser > 30 && newUser < 60, qt.IsTrue, qt.Commentf("score %d", newUser))
+
+	five, quick := 5.0, time.Hour
+	veteran := Inputs{
+		CompletedBookings: 50,
+		Rating:            &five,
+		AccountAge:        2 * matureAccountAge,
+		ResponseTime:      &quick,
+	}
+	c.Assert(Score(veteran, DefaultWeights) >= 95, qt.IsTrue)
+
+	// Each worse input lowers the score
+	one, slow := 1.0, 7*24*time.Hour
+	for _, worse := range []func(in *Inputs){
+		func(in *Inputs) { in.CompletedBookings = 1 },
+		func(in *Inputs) { in.Rating = &one },
+		func(in *Inputs) { in.AccountAge = 0 },
+		func(in *Inputs) { in.ResponseTime = &slow },
+		func(in *Inputs) { in.Disputes = 2 },
+	} {
+		in := veteran
+		worse(&in)
+		c.Assert(Score(in, DefaultWeights) < Score(veteran, DefaultWeights), qt.IsTrue)
+	}
+
+	// The score stays in range and only weighted components count
+	c.Assert(Score(Inputs{Disputes: 100}, Weights{Disputes: 1}), qt.Equals, 0)
+	c.Assert(Score(veteran, Weights{Rating: 1}), qt.Equals, 100)
+	c.Assert(Score(veteran, Weights{}), qt.Equals, 0)
+}
+
+func TestParseWeights(t *testing.T) {
+	c := qt.New(t)
+
+	w, err := ParseWeights("")
+	c.Assert(err, qt.IsNil)
+	c.Assert(w, qt.Equals, DefaultWeights)
+
+	w, err = ParseWeights("rating=1, disputes=0")
+	c.Assert(err, qt.IsNil)
+	c.Assert(w.Rating, qt.Equals, 1.0)
+	c.Assert(w.Disputes, qt.Equals, 0.0)
+	c.Assert(w.Bookings, qt.Equals, DefaultWeights.Bookings)
+
+	for _, s := range []string{
+		"rating",
+		"rating=abc",
+		"rating=-1",
+		"karma=1",
+		"bookings=0,rating=0,age=0,response=0,disputes=0",
+	} {
+		_, err := ParseWeights(s)
+		c.Assert(err, qt.Not(qt.IsNil), qt.Commentf("weights %q", s))
+	}
+}